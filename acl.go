@@ -0,0 +1,160 @@
+package sftp
+
+import (
+	sshfx "github.com/pkg/sftp/internal/encoding/ssh/filexfer"
+)
+
+// ACLExtension is the name of the extended attribute carrying the access control list of a file.
+// Its data is the ACL as it is encoded in the attributes of version 6 of the protocol:
+// the ACL flags, then the count of entries, and the type, flags, mask and who of each entry.
+//
+// Version 3 of the protocol has no ACL attribute, so this carries the ACLs of servers that have them,
+// such as those backed by NFSv4 or Windows shares, through this package's Client and servers.
+// The Server never sends it, and only applies it in SSH_FXP_SETSTAT and SSH_FXP_FSETSTAT through WithACLSetter.
+// The Handlers of a RequestServer get it from Request.Attributes.
+const ACLExtension = "acl@pkg.sftp"
+
+// An ACL is an access control list, as defined by the attributes of versions 4 to 6 of the protocol.
+// The Flags, such as ACLControlPresent, are those of version 6.
+type ACL = sshfx.ACL
+
+// An ACE is an entry of an ACL, allowing or denying the access in its Mask to the principal Who,
+// such as "user@domain", or one of the special names, such as "OWNER@".
+type ACE = sshfx.ACE
+
+// ACE types.
+const (
+	ACEAccessAllowed = sshfx.ACEAccessAllowed
+	ACEAccessDenied  = sshfx.ACEAccessDenied
+	ACESystemAudit   = sshfx.ACESystemAudit
+	ACESystemAlarm   = sshfx.ACESystemAlarm
+)
+
+// ACE flags.
+const (
+	ACEFlagFileInherit        = sshfx.ACEFlagFileInherit
+	ACEFlagDirectoryInherit   = sshfx.ACEFlagDirectoryInherit
+	ACEFlagNoPropagateInherit = sshfx.ACEFlagNoPropagateInherit
+	ACEFlagInheritOnly        = sshfx.ACEFlagInheritOnly
+	ACEFlagSuccessfulAccess   = sshfx.ACEFlagSuccessfulAccess
+	ACEFlagFailedAccess       = sshfx.ACEFlagFailedAccess
+	ACEFlagIdentifierGroup    = sshfx.ACEFlagIdentifierGroup
+)
+
+// ACE access masks.
+const (
+	ACEMaskReadData        = sshfx.ACEMaskReadData
+	ACEMaskListDirectory   = sshfx.ACEMaskListDirectory
+	ACEMaskWriteData       = sshfx.ACEMaskWriteData
+	ACEMaskAddFile         = sshfx.ACEMaskAddFile
+	ACEMaskAppendData      = sshfx.ACEMaskAppendData
+	ACEMaskAddSubdirectory = sshfx.ACEMaskAddSubdirectory
+	ACEMaskReadNamedAttrs  = sshfx.ACEMaskReadNamedAttrs
+	ACEMaskWriteNamedAttrs = sshfx.ACEMaskWriteNamedAttrs
+	ACEMaskExecute         = sshfx.ACEMaskExecute
+	ACEMaskDeleteChild     = sshfx.ACEMaskDeleteChild
+	ACEMaskReadAttributes  = sshfx.ACEMaskReadAttributes
+	ACEMaskWriteAttributes = sshfx.ACEMaskWriteAttributes
+	ACEMaskDelete          = sshfx.ACEMaskDelete
+	ACEMaskReadACL         = sshfx.ACEMaskReadACL
+	ACEMaskWriteACL        = sshfx.ACEMaskWriteACL
+	ACEMaskWriteOwner      = sshfx.ACEMaskWriteOwner
+	ACEMaskSynchronize     = sshfx.ACEMaskSynchronize
+)
+
+// ACL flags.
+const (
+	ACLControlIncluded     = sshfx.ACLControlIncluded
+	ACLControlPresent      = sshfx.ACLControlPresent
+	ACLControlInherited    = sshfx.ACLControlInherited
+	ACLAuditAlarmIncluded  = sshfx.ACLAuditAlarmIncluded
+	ACLAuditAlarmInherited = sshfx.ACLAuditAlarmInherited
+)
+
+// aclVersion is the version of the protocol whose encoding of the ACL attribute is used by the ACLExtension.
+const aclVersion = 6
+
+// ACL returns the access control list carried in the extended attributes, if any.
+// The error is that of decoding a malformed list.
+func (fs *FileStat) ACL() (ACL, bool, error) {
+	for _, ext := range fs.Extended {
+		if ext.ExtType != ACLExtension {
+			continue
+		}
+
+		attrs := &sshfx.VersionedAttributes{
+			Version: aclVersion,
+			Flags:   sshfx.AttrV4ACL,
+			ACL:     []byte(ext.ExtData),
+		}
+		acl, _, err := attrs.GetACL()
+		if err != nil {
+			return ACL{}, false, err
+		}
+		return acl, true, nil
+	}
+
+	return ACL{}, false, nil
+}
+
+// SetACL sets the access control list carried in the extended attributes,
+// replacing any already present.
+func (fs *FileStat) SetACL(acl ACL) {
+	attrs := &sshfx.VersionedAttributes{
+		Version: aclVersion,
+	}
+	attrs.SetACL(acl)
+	data := string(attrs.ACL)
+
+	for i, ext := range fs.Extended {
+		if ext.ExtType == ACLExtension {
+			fs.Extended[i].ExtData = data
+			return
+		}
+	}
+
+	fs.Extended = append(fs.Extended, StatExtended{
+		ExtType: ACLExtension,
+		ExtData: data,
+	})
+}
+
+// SetACL sets the access control list of the named file, through the ACLExtension, in an SSH_FXP_SETSTAT.
+// Servers which do not implement the extension ignore it.
+func (c *Client) SetACL(path string, acl ACL) error {
+	fs := new(FileStat)
+	fs.SetACL(acl)
+	return c.SetExtendedData(path, fs.Extended)
+}
+
+// SetACL sets the access control list of the current file, through the ACLExtension, in an SSH_FXP_FSETSTAT.
+// Servers which do not implement the extension ignore it.
+func (f *File) SetACL(acl ACL) error {
+	fs := new(FileStat)
+	fs.SetACL(acl)
+	return f.SetExtendedData(f.path, fs.Extended)
+}
+
+// WithACLSetter has the Server call set with the local path of the file, and the access control list,
+// whenever an SSH_FXP_SETSTAT or SSH_FXP_FSETSTAT carries the ACLExtension,
+// answering the request with the error it returns, if any.
+// Setting an ACL depends on the filesystem, so without this the Server ignores the extension.
+func WithACLSetter(set func(path string, acl ACL) error) ServerOption {
+	return func(s *Server) error {
+		s.setACL = set
+		return nil
+	}
+}
+
+// applyACL passes on the access control list of fs to the ACL setter of the Server, if both are present.
+func (s *Server) applyACL(path string, fs *FileStat) error {
+	if s.setACL == nil {
+		return nil
+	}
+
+	acl, ok, err := fs.ACL()
+	if err != nil || !ok {
+		return err
+	}
+	return s.setACL(path, acl)
+}
@@ -0,0 +1,123 @@
+package sftp
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testACL = ACL{
+	Flags: ACLControlIncluded | ACLControlPresent,
+	Entries: []ACE{
+		{Type: ACEAccessAllowed, Mask: ACEMaskReadData | ACEMaskWriteData, Who: "OWNER@"},
+		{Type: ACEAccessDenied, Flags: ACEFlagIdentifierGroup, Mask: ACEMaskWriteData, Who: "staff@example.com"},
+	},
+}
+
+func TestFileStatACL(t *testing.T) {
+	fs := &FileStat{
+		Extended: []StatExtended{
+			{ExtType: "foo@example.com", ExtData: "bar"},
+		},
+	}
+
+	_, ok, err := fs.ACL()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	fs.SetACL(ACL{})
+	fs.SetACL(testACL)
+	assert.Len(t, fs.Extended, 2)
+
+	// the list survives a round trip through the wire format.
+	b := marshalFileStat(nil, sshFileXferAttrExtended, fs)
+	decoded, _, err := unmarshalFileStat(sshFileXferAttrExtended, b)
+	require.NoError(t, err)
+	acl, ok, err := decoded.ACL()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, testACL, acl)
+
+	// malformed data is reported.
+	fs = &FileStat{Extended: []StatExtended{{ExtType: ACLExtension, ExtData: "short"}}}
+	_, ok, err = fs.ACL()
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestServerACLSetter(t *testing.T) {
+	var mu sync.Mutex
+	set := make(map[string]ACL)
+
+	client, server := clientServerPair(t, WithACLSetter(func(path string, acl ACL) error {
+		mu.Lock()
+		defer mu.Unlock()
+		set[filepath.Base(path)] = acl
+		return nil
+	}))
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	f, err := client.Create(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, client.Mkdir(filepath.Join(dir, "dir")))
+	require.NoError(t, client.SetACL(filepath.Join(dir, "dir"), testACL))
+	require.NoError(t, f.SetACL(testACL))
+
+	// other extended attributes do not call the setter.
+	require.NoError(t, client.SetExtendedData(filepath.Join(dir, "dir"), []StatExtended{{ExtType: "foo@example.com"}}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]ACL{"dir": testACL, "file": testACL}, set)
+}
+
+// aclRecorder records the ACLs of the setstat requests passed on to the FileCmder.
+type aclRecorder struct {
+	FileCmder
+
+	mu   sync.Mutex
+	acls []ACL
+}
+
+func (r *aclRecorder) Filecmd(req *Request) error {
+	if req.Method == "Setstat" {
+		if acl, ok, err := req.Attributes().ACL(); err != nil {
+			return err
+		} else if ok {
+			r.mu.Lock()
+			r.acls = append(r.acls, acl)
+			r.mu.Unlock()
+		}
+	}
+	return r.FileCmder.Filecmd(req)
+}
+
+func TestRequestServerACL(t *testing.T) {
+	handlers := InMemHandler()
+	recorder := &aclRecorder{FileCmder: handlers.FileCmd}
+	handlers.FileCmd = recorder
+
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+	require.NoError(t, p.cli.SetACL("/foo", testACL))
+
+	f, err := p.cli.OpenFile("/foo", 0)
+	require.NoError(t, err)
+	defer f.Close()
+	// FSETSTAT reaches the Handlers as a Setstat too.
+	require.NoError(t, f.SetACL(ACL{Entries: testACL.Entries[:1]}))
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, []ACL{testACL, {Entries: testACL.Entries[:1]}}, recorder.acls)
+}
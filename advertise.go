@@ -0,0 +1,184 @@
+package sftp
+
+import "fmt"
+
+// advertisement is the protocol version and extensions advertised by a server,
+// which may differ from those implemented in order to test the fallback paths of clients.
+type advertisement struct {
+	version uint32   // if zero, sftpProtocolVersion
+	without []string // extensions neither advertised nor served
+	extra   []sshExtensionPair
+
+	rejectMismatch bool
+	onMismatch     func(clientVersion uint32)
+}
+
+// versionPacket returns the SSH_FXP_VERSION packet to send in response to SSH_FXP_INIT.
+func (a *advertisement) versionPacket() *sshFxVersionPacket {
+	pkt := &sshFxVersionPacket{
+		Version:    sftpProtocolVersion,
+		Extensions: sftpExtensions,
+	}
+
+	if len(a.without) > 0 {
+		pkt.Extensions = nil
+		for _, ext := range sftpExtensions {
+			if !a.disabled(ext.Name) {
+				pkt.Extensions = append(pkt.Extensions, ext)
+			}
+		}
+	}
+
+	if a.version != 0 && a.version != sftpProtocolVersion {
+		pkt.Version = a.version
+		// version 3 is offered for selection, unless the extension is removed to test clients which cannot select it.
+		if !a.disabled(versionsExtension) {
+			pkt.Extensions = append(pkt.Extensions[:len(pkt.Extensions):len(pkt.Extensions)], versionsExtensionPair())
+		}
+	}
+
+	if len(a.extra) > 0 {
+		pkt.Extensions = append(pkt.Extensions[:len(pkt.Extensions):len(pkt.Extensions)], a.extra...)
+	}
+
+	return pkt
+}
+
+// checkInit checks the protocol version requested by the client in SSH_FXP_INIT,
+// returning a *VersionMismatchError if it is not version 3, and the mismatch is to be refused.
+func (a *advertisement) checkInit(p *sshFxInitPacket) error {
+	if p.Version == sftpProtocolVersion {
+		return nil
+	}
+
+	if a.onMismatch != nil {
+		a.onMismatch(p.Version)
+	}
+
+	if a.rejectMismatch {
+		return &VersionMismatchError{Version: p.Version}
+	}
+	return nil
+}
+
+// disabled reports whether the extension has been removed from the advertisement.
+func (a *advertisement) disabled(extension string) bool {
+	for _, name := range a.without {
+		if name == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// WithServerAdvertisedVersion makes the Server advertise the given protocol version in SSH_FXP_VERSION,
+// rather than the version 3 it implements, which it then lists in the "versions" extension for the client to select,
+// unless WithoutExtension("versions") is also given.
+// This is intended for testing how clients handle a version mismatch.
+func WithServerAdvertisedVersion(version uint32) ServerOption {
+	return func(s *Server) error {
+		s.advert.version = version
+		return nil
+	}
+}
+
+// WithoutExtension removes the named extension from those advertised by the Server,
+// and answers requests for it with SSH_FX_OP_UNSUPPORTED, as a server without the extension would.
+// This is intended for testing the fallback paths of clients, such as when "posix-rename@openssh.com" is absent.
+func WithoutExtension(extension string) ServerOption {
+	return func(s *Server) error {
+		s.advert.without = append(s.advert.without, extension)
+		return nil
+	}
+}
+
+// WithExtension adds the named extension pair to those advertised by the Server in SSH_FXP_VERSION,
+// such as to echo an extension the client sent in SSH_FXP_INIT, as returned by ClientExtensions.
+// The extension is only advertised: requests for it are answered as for any other unknown extension.
+func WithExtension(name, data string) ServerOption {
+	return func(s *Server) error {
+		s.advert.extra = append(s.advert.extra, sshExtensionPair{Name: name, Data: data})
+		return nil
+	}
+}
+
+// WithRSExtension adds the named extension pair to those advertised by the RequestServer,
+// in the same way as WithExtension.
+func WithRSExtension(name, data string) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.advert.extra = append(rs.advert.extra, sshExtensionPair{Name: name, Data: data})
+	}
+}
+
+// WithRSAdvertisedVersion makes the RequestServer advertise the given protocol version,
+// in the same way as WithServerAdvertisedVersion.
+func WithRSAdvertisedVersion(version uint32) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.advert.version = version
+	}
+}
+
+// WithoutRSExtension removes the named extension from those advertised and served by the RequestServer,
+// in the same way as WithoutExtension.
+func WithoutRSExtension(extension string) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.advert.without = append(rs.advert.without, extension)
+	}
+}
+
+// VersionMismatch is the action taken by a server when a client requests a protocol version other than 3.
+type VersionMismatch int
+
+// Actions on a protocol version mismatch.
+const (
+	// VersionMismatchNegotiate answers with version 3 regardless, leaving the client to decide whether to continue.
+	// This is the default.
+	VersionMismatchNegotiate VersionMismatch = iota
+
+	// VersionMismatchReject answers with an SSH_FX_OP_UNSUPPORTED status, and ends the session.
+	// Serve then returns a *VersionMismatchError.
+	VersionMismatchReject
+)
+
+// VersionMismatchError is returned by Serve when a client requested a protocol version other than 3,
+// and the server was configured with VersionMismatchReject.
+type VersionMismatchError struct {
+	// Version is the protocol version requested by the client.
+	Version uint32
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("sftp: client requested protocol version %d, only version %d is supported", e.Version, sftpProtocolVersion)
+}
+
+// WithVersionMismatch sets the action taken by the Server when a client requests a protocol version other than 3.
+// If onMismatch is not nil, it is called with the requested version whenever this happens, such as to log it.
+func WithVersionMismatch(action VersionMismatch, onMismatch func(clientVersion uint32)) ServerOption {
+	return func(s *Server) error {
+		s.advert.rejectMismatch = action == VersionMismatchReject
+		s.advert.onMismatch = onMismatch
+		return nil
+	}
+}
+
+// WithRSVersionMismatch sets the action taken by the RequestServer when a client requests a protocol version other than 3,
+// in the same way as WithVersionMismatch.
+func WithRSVersionMismatch(action VersionMismatch, onMismatch func(clientVersion uint32)) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.advert.rejectMismatch = action == VersionMismatchReject
+		rs.advert.onMismatch = onMismatch
+	}
+}
+
+// refuseInit answers the SSH_FXP_INIT of a client whose protocol version has been refused.
+// There is no request id in SSH_FXP_INIT, so zero is used.
+func (s *serverConn) refuseInit(err error) {
+	s.sendPacket(&sshFxpStatusPacket{
+		ID: 0,
+		StatusError: StatusError{
+			Code: sshFxOPUnsupported,
+			msg:  err.Error(),
+		},
+	})
+	s.conn.Close()
+}
@@ -0,0 +1,138 @@
+package sftp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/binary"
+	"os"
+)
+
+// zipExtraUnix is the id of the extra field of Info-ZIP for the uid and gid of a file, of any size ("ux").
+const zipExtraUnix = 0x7875
+
+// TarHeader returns a tar.Header for the file described by fi, as tar.FileInfoHeader does,
+// with the uid and gid of fi, if it is of a remote file, as returned by the Stat and ReadDir methods of the Client.
+// The link is the target of a symbolic link, and is otherwise ignored.
+//
+// The Name of the header is the base name of fi, which the caller is expected to replace with the path within the archive.
+// The access time is not set, as it would need the PAX or GNU format.
+func TarHeader(fi os.FileInfo, link string) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return nil, err
+	}
+	if fs, ok := fi.Sys().(*FileStat); ok {
+		hdr.Uid, hdr.Gid = int(fs.UID), int(fs.GID)
+	}
+	return hdr, nil
+}
+
+// FileStatFromTarHeader returns the attributes of the file of hdr: its size, mode, times, and uid and gid.
+// The access time is the modification time, unless the header has one of its own.
+func FileStatFromTarHeader(hdr *tar.Header) *FileStat {
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+
+	return &FileStat{
+		Size:  uint64(hdr.Size),
+		Mode:  fromFileMode(hdr.FileInfo().Mode()),
+		Mtime: uint32(hdr.ModTime.Unix()),
+		Atime: uint32(atime.Unix()),
+		UID:   uint32(hdr.Uid),
+		GID:   uint32(hdr.Gid),
+	}
+}
+
+// ZipHeader returns a zip.FileHeader for the file described by fi, as zip.FileInfoHeader does,
+// with the uid and gid of fi, if it is of a remote file, in the Unix extra field of Info-ZIP.
+//
+// The Name of the header is the base name of fi, which the caller is expected to replace with the path within the archive,
+// and the Method is left for the caller to choose.
+func ZipHeader(fi os.FileInfo) (*zip.FileHeader, error) {
+	hdr, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return nil, err
+	}
+	if fs, ok := fi.Sys().(*FileStat); ok {
+		hdr.Extra = appendZipExtraUnix(hdr.Extra, fs.UID, fs.GID)
+	}
+	return hdr, nil
+}
+
+// FileStatFromZipHeader returns the attributes of the file of hdr: its size, mode, modification time, and uid and gid,
+// if it has the Unix extra field of Info-ZIP.
+// As a zip file has no access time, it is the modification time.
+func FileStatFromZipHeader(hdr *zip.FileHeader) *FileStat {
+	mtime := hdr.Modified
+	if mtime.IsZero() {
+		mtime = hdr.ModTime() // of the MS-DOS date and time fields.
+	}
+
+	fs := &FileStat{
+		Size:  hdr.UncompressedSize64,
+		Mode:  fromFileMode(hdr.Mode()),
+		Mtime: uint32(mtime.Unix()),
+		Atime: uint32(mtime.Unix()),
+	}
+	fs.UID, fs.GID, _ = parseZipExtraUnix(hdr.Extra)
+	return fs
+}
+
+// appendZipExtraUnix appends the Unix extra field of Info-ZIP, with 32-bit ids, to extra.
+func appendZipExtraUnix(extra []byte, uid, gid uint32) []byte {
+	b := make([]byte, 4+11)
+	binary.LittleEndian.PutUint16(b[0:], zipExtraUnix)
+	binary.LittleEndian.PutUint16(b[2:], 11)
+	b[4] = 1 // version
+	b[5] = 4
+	binary.LittleEndian.PutUint32(b[6:], uid)
+	b[10] = 4
+	binary.LittleEndian.PutUint32(b[11:], gid)
+	return append(extra, b...)
+}
+
+// parseZipExtraUnix returns the uid and gid of the Unix extra field of Info-ZIP in extra, if there is one.
+func parseZipExtraUnix(extra []byte) (uid, gid uint32, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			return 0, 0, false
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		if id != zipExtraUnix || len(field) < 1 || field[0] != 1 {
+			continue
+		}
+
+		field = field[1:]
+		uid, field, ok = zipExtraUnixID(field)
+		if !ok {
+			return 0, 0, false
+		}
+		gid, _, ok = zipExtraUnixID(field)
+		if !ok {
+			return 0, 0, false
+		}
+		return uid, gid, true
+	}
+	return 0, 0, false
+}
+
+// zipExtraUnixID consumes an id, of the size given by its first byte, from b, keeping its low 32 bits.
+func zipExtraUnixID(b []byte) (id uint32, rest []byte, ok bool) {
+	if len(b) < 1 {
+		return 0, nil, false
+	}
+	n := int(b[0])
+	if len(b) < 1+n {
+		return 0, nil, false
+	}
+	for i := n - 1; i >= 0; i-- {
+		id = id<<8 | uint32(b[1+i])
+	}
+	return id, b[1+n:], true
+}
@@ -0,0 +1,84 @@
+package sftp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarHeader(t *testing.T) {
+	fs := &FileStat{
+		Size:  42,
+		Mode:  fromFileMode(0o640),
+		Mtime: 1600000000,
+		Atime: 1600000000,
+		UID:   1000,
+		GID:   100,
+	}
+
+	hdr, err := TarHeader(fileInfoFromStat(fs, "foo"), "")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", hdr.Name)
+	assert.Equal(t, int64(42), hdr.Size)
+	assert.Equal(t, int64(0o640), hdr.Mode)
+	assert.Equal(t, 1000, hdr.Uid)
+	assert.Equal(t, 100, hdr.Gid)
+
+	// through an archive, and back.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(hdr))
+	_, err = tw.Write(make([]byte, 42))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	hdr, err = tar.NewReader(&buf).Next()
+	require.NoError(t, err)
+	assert.Equal(t, fs, FileStatFromTarHeader(hdr))
+
+	link, err := TarHeader(fileInfoFromStat(&FileStat{Mode: fromFileMode(os.ModeSymlink | 0o777)}, "bar"), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, byte(tar.TypeSymlink), link.Typeflag)
+	assert.Equal(t, "foo", link.Linkname)
+}
+
+func TestZipHeader(t *testing.T) {
+	fs := &FileStat{
+		Size:  42,
+		Mode:  fromFileMode(0o640),
+		Mtime: 1600000000,
+		Atime: 1600000000,
+		UID:   1000,
+		GID:   100,
+	}
+
+	hdr, err := ZipHeader(fileInfoFromStat(fs, "foo"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", hdr.Name)
+	assert.Equal(t, uint64(42), hdr.UncompressedSize64)
+	assert.Equal(t, os.FileMode(0o640), hdr.Mode())
+
+	// through an archive, and back.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(hdr)
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 42))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	assert.Equal(t, fs, FileStatFromZipHeader(&zr.File[0].FileHeader))
+
+	// without the extra field, the ids are zero.
+	hdr = &zip.FileHeader{Name: "bar", Modified: fs.ModTime()}
+	hdr.SetMode(0o600)
+	assert.Equal(t, &FileStat{Mode: fromFileMode(0o600), Mtime: fs.Mtime, Atime: fs.Mtime}, FileStatFromZipHeader(hdr))
+}
@@ -6,6 +6,8 @@ package sftp
 import (
 	"os"
 	"time"
+
+	sshfx "github.com/pkg/sftp/internal/encoding/ssh/filexfer"
 )
 
 const (
@@ -54,6 +56,13 @@ type FileStat struct {
 	UID      uint32
 	GID      uint32
 	Extended []StatExtended
+
+	// the flags of the valid attributes, if known, as when they were received by the Client,
+	// and the raw bytes of the attributes unknown to version 3 of the protocol among them, if any,
+	// which run to the end of the attributes, and so include the extended attributes.
+	flags    uint32
+	hasFlags bool
+	unknown  []byte
 }
 
 // ModTime returns the Mtime SFTP file attribute converted to a time.Time
@@ -77,6 +86,25 @@ type StatExtended struct {
 	ExtData string
 }
 
+// FileInfoFromAttributes returns an os.FileInfo of the file name with a copy of the attributes attrs,
+// of which those given by flags are valid, such as attributes decoded from an SSH_FXP_NAME entry by other code.
+// As for the FileInfo returned by the Client, its Sys method returns the *FileStat,
+// which has the UID, GID, and access time, that os.FileInfo has no method for.
+//
+// Passed to Client.SetStat, or returned by the Handlers of a RequestServer,
+// the FileInfo sends only the attributes given by flags, and the extended attributes of attrs, if any.
+func FileInfoFromAttributes(name string, flags FileAttrFlags, attrs *FileStat) os.FileInfo {
+	stat := *attrs
+	stat.flags = flags.flags()
+	if len(stat.Extended) > 0 {
+		stat.flags |= sshFileXferAttrExtended
+	}
+	stat.hasFlags = true
+	stat.unknown = nil
+
+	return fileInfoFromStat(&stat, name)
+}
+
 func fileInfoFromStat(stat *FileStat, name string) os.FileInfo {
 	return &fileInfo{
 		name: name,
@@ -99,6 +127,18 @@ type FileInfoExtendedData interface {
 }
 
 func fileStatFromInfo(fi os.FileInfo) (uint32, *FileStat) {
+	// If the FileInfo carries the wire attributes, they are authoritative,
+	// and include the uid, gid, and atime that cannot be derived from the os.FileInfo methods.
+	if attrs, ok := fi.Sys().(*sshfx.Attributes); ok {
+		return fileStatFromAttributes(attrs)
+	}
+
+	// So are the attributes received by the Client, along with any it does not know, which are relayed unchanged.
+	if fs, ok := fi.Sys().(*FileStat); ok && fs.hasFlags {
+		fileStat := *fs
+		return fs.flags, &fileStat
+	}
+
 	mtime := fi.ModTime().Unix()
 	atime := mtime
 	var flags uint32 = sshFileXferAttrSize |
@@ -134,3 +174,51 @@ func fileStatFromInfo(fi os.FileInfo) (uint32, *FileStat) {
 
 	return flags, fileStat
 }
+
+// fileStatFromAttributes converts the wire attributes into the equivalent flags and FileStat.
+// Only the fields flagged as valid in attrs are copied.
+func fileStatFromAttributes(attrs *sshfx.Attributes) (uint32, *FileStat) {
+	var flags uint32
+	fileStat := new(FileStat)
+
+	if size, ok := attrs.GetSize(); ok {
+		flags |= sshFileXferAttrSize
+		fileStat.Size = size
+	}
+
+	if uid, gid, ok := attrs.GetUIDGID(); ok {
+		flags |= sshFileXferAttrUIDGID
+		fileStat.UID = uid
+		fileStat.GID = gid
+	}
+
+	if perms, ok := attrs.GetPermissions(); ok {
+		flags |= sshFileXferAttrPermissions
+		fileStat.Mode = uint32(perms)
+	}
+
+	if atime, mtime, ok := attrs.GetACModTime(); ok {
+		flags |= sshFileXferAttrACmodTime
+		fileStat.Atime = atime
+		fileStat.Mtime = mtime
+	}
+
+	if attrs.Flags&^sshFileXferAttrAll != 0 && attrs.Unknown != nil {
+		// the extended attributes are within the unknown bytes, which are relayed unchanged.
+		fileStat.flags = attrs.Flags
+		fileStat.unknown = attrs.Unknown
+		return attrs.Flags, fileStat
+	}
+
+	if attrs.Flags&sshfx.AttrExtended != 0 {
+		flags |= sshFileXferAttrExtended
+		for _, ext := range attrs.ExtendedAttributes {
+			fileStat.Extended = append(fileStat.Extended, StatExtended{
+				ExtType: ext.Type,
+				ExtData: ext.Data,
+			})
+		}
+	}
+
+	return flags, fileStat
+}
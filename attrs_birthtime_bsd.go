@@ -0,0 +1,13 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package sftp
+
+import (
+	"syscall"
+)
+
+func statBirthTime(statt *syscall.Stat_t) (sec, nsec int64, ok bool) {
+	sec, nsec = statt.Birthtimespec.Unix()
+	return sec, nsec, true
+}
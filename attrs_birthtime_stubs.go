@@ -0,0 +1,13 @@
+//go:build dragonfly || (!android && linux) || openbsd || solaris || aix || js || zos
+// +build dragonfly !android,linux openbsd solaris aix js zos
+
+package sftp
+
+import (
+	"syscall"
+)
+
+// statBirthTime reports that the creation time is not recorded in the syscall.Stat_t of this platform.
+func statBirthTime(statt *syscall.Stat_t) (sec, nsec int64, ok bool) {
+	return 0, 0, false
+}
@@ -1,5 +1,5 @@
-//go:build plan9 || windows || android
-// +build plan9 windows android
+//go:build plan9 || android
+// +build plan9 android
 
 package sftp
 
@@ -1,8 +1,255 @@
 package sftp
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sshfx "github.com/pkg/sftp/internal/encoding/ssh/filexfer"
 )
 
 // ensure that attrs implemenst os.FileInfo
 var _ os.FileInfo = new(fileInfo)
+
+// attributesFileInfo is an os.FileInfo as it might be built from an sshfx.NameEntry.
+type attributesFileInfo struct {
+	name  string
+	attrs *sshfx.Attributes
+}
+
+func (fi *attributesFileInfo) Name() string       { return fi.name }
+func (fi *attributesFileInfo) Size() int64        { return int64(fi.attrs.Size) }
+func (fi *attributesFileInfo) Mode() os.FileMode  { return toFileMode(uint32(fi.attrs.Permissions)) }
+func (fi *attributesFileInfo) ModTime() time.Time { return time.Unix(int64(fi.attrs.MTime), 0) }
+func (fi *attributesFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi *attributesFileInfo) Sys() interface{}   { return fi.attrs }
+
+func TestFileStatFromAttributes(t *testing.T) {
+	attrs := &sshfx.Attributes{
+		ExtendedAttributes: []sshfx.ExtendedAttribute{
+			{Type: "foo@example.com", Data: "bar"},
+		},
+	}
+	attrs.SetSize(42)
+	attrs.SetUIDGID(1000, 100)
+	attrs.SetPermissions(sshfx.ModeRegular | 0o640)
+	attrs.SetACModTime(1600000000, 1700000000)
+	attrs.Flags |= sshfx.AttrExtended
+
+	flags, fs := fileStatFromInfo(&attributesFileInfo{name: "foo", attrs: attrs})
+	assert.Equal(t, uint32(sshFileXferAttrAll), flags)
+	assert.Equal(t, &FileStat{
+		Size:  42,
+		Mode:  uint32(sshfx.ModeRegular | 0o640),
+		Atime: 1600000000,
+		Mtime: 1700000000,
+		UID:   1000,
+		GID:   100,
+		Extended: []StatExtended{
+			{ExtType: "foo@example.com", ExtData: "bar"},
+		},
+	}, fs)
+
+	// unset fields must not be reported as set
+	flags, fs = fileStatFromInfo(&attributesFileInfo{name: "foo", attrs: &sshfx.Attributes{}})
+	assert.Equal(t, uint32(0), flags)
+	assert.Equal(t, &FileStat{}, fs)
+}
+
+func TestFileStatWindowsAttributes(t *testing.T) {
+	fs := &FileStat{
+		Extended: []StatExtended{
+			{ExtType: "foo@example.com", ExtData: "bar"},
+		},
+	}
+
+	_, ok := fs.WindowsAttributes()
+	assert.False(t, ok)
+
+	fs.SetWindowsAttributes(WindowsAttrHidden | WindowsAttrArchive | 0x10) // FILE_ATTRIBUTE_DIRECTORY is not transferred.
+	attrs, ok := fs.WindowsAttributes()
+	assert.True(t, ok)
+	assert.Equal(t, WindowsAttrHidden|WindowsAttrArchive, attrs)
+
+	// setting the attributes again replaces them.
+	fs.SetWindowsAttributes(WindowsAttrSystem)
+	attrs, _ = fs.WindowsAttributes()
+	assert.Equal(t, WindowsAttrSystem, attrs)
+	assert.Len(t, fs.Extended, 2)
+
+	// the attributes survive a round trip through the wire format.
+	b := marshalFileStat(nil, sshFileXferAttrExtended, fs)
+	got, _, err := unmarshalFileStat(sshFileXferAttrExtended, b)
+	if assert.NoError(t, err) {
+		attrs, ok = got.WindowsAttributes()
+		assert.True(t, ok)
+		assert.Equal(t, WindowsAttrSystem, attrs)
+	}
+}
+
+func TestFileStatBirthTime(t *testing.T) {
+	fs := &FileStat{
+		Extended: []StatExtended{
+			{ExtType: "foo@example.com", ExtData: "bar"},
+		},
+	}
+
+	_, ok := fs.BirthTime()
+	assert.False(t, ok)
+
+	btime := time.Date(1969, time.July, 20, 20, 17, 40, 123456789, time.UTC)
+	fs.SetBirthTime(btime)
+	got, ok := fs.BirthTime()
+	assert.True(t, ok)
+	assert.True(t, btime.Equal(got), "got %v", got)
+
+	// setting the time again replaces it.
+	fs.SetBirthTime(btime.Add(time.Hour))
+	assert.Len(t, fs.Extended, 2)
+
+	// the time survives a round trip through the wire format.
+	b := marshalFileStat(nil, sshFileXferAttrExtended, fs)
+	decoded, _, err := unmarshalFileStat(sshFileXferAttrExtended, b)
+	if assert.NoError(t, err) {
+		got, ok = decoded.BirthTime()
+		assert.True(t, ok)
+		assert.True(t, btime.Add(time.Hour).Equal(got), "got %v", got)
+	}
+
+	// malformed data is not reported as a time.
+	fs = &FileStat{Extended: []StatExtended{{ExtType: BirthTimeExtension, ExtData: "short"}}}
+	_, ok = fs.BirthTime()
+	assert.False(t, ok)
+}
+
+// unknownAttrsHandler answers every stat with the FileInfo fi, and records the last setstat request.
+type unknownAttrsHandler struct {
+	fi os.FileInfo
+
+	mu      sync.Mutex
+	setstat *Request
+}
+
+func (h *unknownAttrsHandler) Filelist(r *Request) (ListerAt, error) {
+	return listerat{h.fi}, nil
+}
+
+func (h *unknownAttrsHandler) Filecmd(r *Request) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if r.Method == "Setstat" {
+		h.setstat = r
+	}
+	return nil
+}
+
+func TestClientSetStatUnknownAttributes(t *testing.T) {
+	// a field of a later version of the protocol, and an extended attribute after it.
+	unknown := marshalUint32(nil, 0xcafe)
+	unknown = marshalUint32(unknown, 1)
+	unknown = marshalString(unknown, "foo@example.com")
+	unknown = marshalString(unknown, "bar")
+
+	attrs := &sshfx.Attributes{
+		Flags:   sshfx.AttrSize | sshfx.AttrExtended | 0x00000040,
+		Size:    42,
+		Unknown: unknown,
+	}
+
+	mem := InMemHandler()
+	h := &unknownAttrsHandler{fi: &attributesFileInfo{name: "foo", attrs: attrs}}
+	p := clientRequestServerPairWithHandlers(t, Handlers{FileGet: mem.FileGet, FilePut: mem.FilePut, FileCmd: h, FileList: h})
+	defer p.Close()
+
+	fi, err := p.cli.Stat("/foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, fi.Size())
+
+	require.NoError(t, p.cli.SetStat("/bar", fi))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	require.NotNil(t, h.setstat)
+	assert.Equal(t, attrs.Flags, h.setstat.Flags)
+	assert.Equal(t, append(marshalUint64(nil, 42), unknown...), h.setstat.Attrs)
+	assert.EqualValues(t, 42, h.setstat.Attributes().Size)
+}
+
+func TestClientSetStat(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require.NoError(t, ioutil.WriteFile(src, []byte("hello"), 0o640))
+	require.NoError(t, ioutil.WriteFile(dst, nil, 0o600))
+	mtime := time.Unix(1700000000, 0)
+	require.NoError(t, os.Chtimes(src, mtime, mtime))
+
+	fi, err := client.Stat(src)
+	require.NoError(t, err)
+	require.NoError(t, client.SetStat(dst, fi))
+
+	got, err := client.Stat(dst)
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, got.Size())
+	assert.Equal(t, os.FileMode(0o640), got.Mode().Perm())
+	assert.Equal(t, mtime, got.ModTime())
+}
+
+func TestFileInfoFromAttributes(t *testing.T) {
+	attrs := &FileStat{
+		Size:  42,
+		Mode:  uint32(sshfx.ModeRegular | 0o640),
+		Atime: 1600000000,
+		Mtime: 1700000000,
+		UID:   1000,
+		GID:   100,
+	}
+
+	fi := FileInfoFromAttributes("foo", FileAttrFlags{Size: true, UidGid: true, Permissions: true}, attrs)
+	assert.Equal(t, "foo", fi.Name())
+	assert.EqualValues(t, 42, fi.Size())
+	assert.Equal(t, os.FileMode(0o640), fi.Mode())
+	assert.Equal(t, time.Unix(1700000000, 0), fi.ModTime())
+
+	fs, ok := fi.Sys().(*FileStat)
+	require.True(t, ok)
+	assert.EqualValues(t, 1000, fs.UID)
+	assert.EqualValues(t, 100, fs.GID)
+	assert.Equal(t, time.Unix(1600000000, 0), fs.AccessTime())
+
+	// only the valid attributes are sent.
+	flags, _ := fileStatFromInfo(fi)
+	assert.Equal(t, uint32(sshFileXferAttrSize|sshFileXferAttrUIDGID|sshFileXferAttrPermissions), flags)
+
+	// the attributes are copied.
+	attrs.Size = 0
+	assert.EqualValues(t, 42, fi.Size())
+}
+
+func TestClientSetStatFileInfoFromAttributes(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	name := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(name, []byte("hello"), 0o644))
+
+	fi := FileInfoFromAttributes("file", FileAttrFlags{Permissions: true}, &FileStat{Mode: 0o600})
+	require.NoError(t, client.SetStat(name, fi))
+
+	got, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, got.Size())
+	assert.Equal(t, os.FileMode(0o600), got.Mode().Perm())
+}
@@ -6,6 +6,7 @@ package sftp
 import (
 	"os"
 	"syscall"
+	"time"
 )
 
 func fileStatFromInfoOs(fi os.FileInfo, flags *uint32, fileStat *FileStat) {
@@ -13,5 +14,10 @@ func fileStatFromInfoOs(fi os.FileInfo, flags *uint32, fileStat *FileStat) {
 		*flags |= sshFileXferAttrUIDGID
 		fileStat.UID = statt.Uid
 		fileStat.GID = statt.Gid
+
+		if sec, nsec, ok := statBirthTime(statt); ok {
+			*flags |= sshFileXferAttrExtended
+			fileStat.SetBirthTime(time.Unix(sec, nsec))
+		}
 	}
 }
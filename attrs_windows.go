@@ -0,0 +1,15 @@
+package sftp
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func fileStatFromInfoOs(fi os.FileInfo, flags *uint32, fileStat *FileStat) {
+	if data, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		*flags |= sshFileXferAttrExtended
+		fileStat.SetWindowsAttributes(WindowsAttributes(data.FileAttributes))
+		fileStat.SetBirthTime(time.Unix(0, data.CreationTime.Nanoseconds()))
+	}
+}
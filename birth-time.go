@@ -0,0 +1,54 @@
+package sftp
+
+import (
+	"time"
+)
+
+// BirthTimeExtension is the name of the extended attribute carrying the creation time of a file.
+// Its data is the seconds since the Unix epoch, encoded as an int64 in a uint64,
+// followed by the nanoseconds within that second, encoded as a uint32.
+//
+// The Server sends it with the attributes of every file on platforms where the creation time is recorded,
+// which are Windows, macOS, FreeBSD, and NetBSD.
+// The creation time cannot be set, so it is ignored in SSH_FXP_SETSTAT and SSH_FXP_FSETSTAT.
+const BirthTimeExtension = "btime@pkg.sftp"
+
+// BirthTime returns the creation time of the file carried in the extended attributes, if any.
+func (fs *FileStat) BirthTime() (time.Time, bool) {
+	for _, ext := range fs.Extended {
+		if ext.ExtType != BirthTimeExtension {
+			continue
+		}
+
+		sec, b, err := unmarshalUint64Safe([]byte(ext.ExtData))
+		if err != nil {
+			return time.Time{}, false
+		}
+		nsec, _, err := unmarshalUint32Safe(b)
+		if err != nil || nsec >= uint32(time.Second) {
+			return time.Time{}, false
+		}
+		return time.Unix(int64(sec), int64(nsec)), true
+	}
+
+	return time.Time{}, false
+}
+
+// SetBirthTime sets the creation time of the file carried in the extended attributes,
+// replacing any already present.
+func (fs *FileStat) SetBirthTime(t time.Time) {
+	data := marshalUint64(nil, uint64(t.Unix()))
+	data = marshalUint32(data, uint32(t.Nanosecond()))
+
+	for i, ext := range fs.Extended {
+		if ext.ExtType == BirthTimeExtension {
+			fs.Extended[i].ExtData = string(data)
+			return
+		}
+	}
+
+	fs.Extended = append(fs.Extended, StatExtended{
+		ExtType: BirthTimeExtension,
+		ExtData: string(data),
+	})
+}
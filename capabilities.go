@@ -0,0 +1,101 @@
+package sftp
+
+// Capability describes a request of the SFTP protocol, and whether it is supported by this package.
+type Capability struct {
+	// Name is the name of the packet type, such as "SSH_FXP_OPEN",
+	// or for an extended request, the name of the extension, such as "statvfs@openssh.com".
+	Name string
+
+	// Type is the packet type of the request.
+	// All extended requests are sent as SSH_FXP_EXTENDED.
+	Type uint8
+
+	// Version is the SFTP protocol version required for the request.
+	Version int
+
+	// Extension and ExtensionVersion are the extension which the server must advertise
+	// before the request may be sent, and the version this package implements.
+	// They are empty for requests that are part of the protocol.
+	Extension, ExtensionVersion string
+
+	// Description summarizes the request.
+	Description string
+
+	// Client reports whether the request can be sent by the Client.
+	Client bool
+
+	// Server and RequestServer report whether the request is served by the Server and the RequestServer.
+	// The RequestServer may additionally require the Handlers to implement an optional interface,
+	// such as StatVFSFileCmder for "statvfs@openssh.com".
+	Server, RequestServer bool
+}
+
+var capabilities = []Capability{
+	{Name: "SSH_FXP_OPEN", Type: sshFxpOpen, Version: sftpProtocolVersion, Description: "open or create a file", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_CLOSE", Type: sshFxpClose, Version: sftpProtocolVersion, Description: "close a file or directory handle", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_READ", Type: sshFxpRead, Version: sftpProtocolVersion, Description: "read from a file handle", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_WRITE", Type: sshFxpWrite, Version: sftpProtocolVersion, Description: "write to a file handle", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_LSTAT", Type: sshFxpLstat, Version: sftpProtocolVersion, Description: "get the attributes of a path, without following symbolic links", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_FSTAT", Type: sshFxpFstat, Version: sftpProtocolVersion, Description: "get the attributes of a file handle", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_SETSTAT", Type: sshFxpSetstat, Version: sftpProtocolVersion, Description: "set the attributes of a path", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_FSETSTAT", Type: sshFxpFsetstat, Version: sftpProtocolVersion, Description: "set the attributes of a file handle", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_OPENDIR", Type: sshFxpOpendir, Version: sftpProtocolVersion, Description: "open a directory for reading", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_READDIR", Type: sshFxpReaddir, Version: sftpProtocolVersion, Description: "read entries from a directory handle", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_REMOVE", Type: sshFxpRemove, Version: sftpProtocolVersion, Description: "remove a file", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_MKDIR", Type: sshFxpMkdir, Version: sftpProtocolVersion, Description: "create a directory", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_RMDIR", Type: sshFxpRmdir, Version: sftpProtocolVersion, Description: "remove a directory", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_REALPATH", Type: sshFxpRealpath, Version: sftpProtocolVersion, Description: "canonicalize a path", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_STAT", Type: sshFxpStat, Version: sftpProtocolVersion, Description: "get the attributes of a path, following symbolic links", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_RENAME", Type: sshFxpRename, Version: sftpProtocolVersion, Description: "rename a file, failing if the target exists", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_READLINK", Type: sshFxpReadlink, Version: sftpProtocolVersion, Description: "read the target of a symbolic link", Client: true, Server: true, RequestServer: true},
+	{Name: "SSH_FXP_SYMLINK", Type: sshFxpSymlink, Version: sftpProtocolVersion, Description: "create a symbolic link", Client: true, Server: true, RequestServer: true},
+
+	{Name: "statvfs@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "statvfs@openssh.com", ExtensionVersion: "2", Description: "get filesystem statistics", Client: true, Server: true, RequestServer: true},
+	{Name: "posix-rename@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "posix-rename@openssh.com", ExtensionVersion: "1", Description: "rename a file, replacing the target if it exists", Client: true, Server: true, RequestServer: true},
+	{Name: "hardlink@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "hardlink@openssh.com", ExtensionVersion: "1", Description: "create a hard link", Client: true, Server: true, RequestServer: true},
+	{Name: "fsync@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "fsync@openssh.com", ExtensionVersion: "1", Description: "flush a file handle to stable storage", Client: true},
+	{Name: "limits@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "limits@openssh.com", ExtensionVersion: "1", Description: "get the limits the server places on requests", Server: true, RequestServer: true},
+	{Name: "expand-path@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "expand-path@openssh.com", ExtensionVersion: "1", Description: "expand a path starting with ~, and canonicalize it", Client: true, Server: true, RequestServer: true},
+	{Name: "copy-data@openssh.com", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "copy-data@openssh.com", ExtensionVersion: "1", Description: "copy data between file handles on the server", Client: true, Server: true, RequestServer: true},
+	{Name: "copy-file", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "copy-file", ExtensionVersion: "1", Description: "copy a file on the server", Client: true, Server: true, RequestServer: true},
+	{Name: "check-file", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "check-file", ExtensionVersion: "1", Description: "compute the digest of a range of a file, by name or handle", Client: true, Server: true, RequestServer: true},
+	{Name: "ping@pkg.sftp", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "ping@pkg.sftp", ExtensionVersion: "1", Description: "measure the round-trip time to the server", Client: true, Server: true, RequestServer: true},
+	{Name: "cancel@pkg.sftp", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "cancel@pkg.sftp", ExtensionVersion: "1", Description: "abandon a queued read or write", Client: true, Server: true, RequestServer: true},
+	{Name: "write-ack-batch@pkg.sftp", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "write-ack-batch@pkg.sftp", ExtensionVersion: "1", Description: "write without a status for each request, acknowledged in batches", Client: true, Server: true, RequestServer: true},
+	{Name: "generation@pkg.sftp", Type: sshFxpExtended, Version: sftpProtocolVersion, Extension: "generation@pkg.sftp", ExtensionVersion: "1", Description: "get or check the generation token of a directory, to detect concurrent modification", Client: true, Server: true, RequestServer: true},
+}
+
+// Capabilities returns the capability matrix of this package:
+// every SFTP request it knows about, and whether the Client, Server and RequestServer support it.
+// This allows generic tooling to describe what is supported, and to downgrade features gracefully.
+// The returned slice is a copy, and may be modified by the caller.
+func Capabilities() []Capability {
+	return append([]Capability(nil), capabilities...)
+}
+
+// LookupCapability returns the Capability with the given packet type or extension name.
+func LookupCapability(name string) (Capability, bool) {
+	for _, c := range capabilities {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Capability{}, false
+}
+
+// Supports reports whether the request with the given packet type or extension name,
+// as accepted by LookupCapability, may be sent to the connected server:
+// it must be supported by the Client, and any extension it requires must be advertised by the server.
+func (c *Client) Supports(name string) bool {
+	capability, ok := LookupCapability(name)
+	if !ok || !capability.Client {
+		return false
+	}
+
+	if capability.Extension != "" {
+		_, ok := c.HasExtension(capability.Extension)
+		return ok
+	}
+
+	return true
+}
@@ -0,0 +1,57 @@
+package sftp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilities(t *testing.T) {
+	served := make(map[string]bool)
+
+	for _, c := range Capabilities() {
+		if c.Extension == "" {
+			assert.Equal(t, c.Name, fxp(c.Type).String())
+			continue
+		}
+
+		assert.Equal(t, uint8(sshFxpExtended), c.Type, c.Name)
+		if c.Server {
+			served[c.Extension] = true
+		}
+	}
+
+	// the extensions served are exactly those advertised.
+	advertised := make(map[string]bool)
+	for _, ext := range supportedSFTPExtensions {
+		advertised[ext.Name] = true
+		c, ok := LookupCapability(ext.Name)
+		if assert.True(t, ok, ext.Name) {
+			assert.Equal(t, ext.Data, c.ExtensionVersion, ext.Name)
+		}
+	}
+	assert.Equal(t, advertised, served)
+
+	// the matrix returned is a copy.
+	Capabilities()[0].Client = false
+	c, ok := LookupCapability("SSH_FXP_OPEN")
+	require.True(t, ok)
+	assert.True(t, c.Client)
+
+	_, ok = LookupCapability("nonexistent@example.com")
+	assert.False(t, ok)
+}
+
+func TestClientSupports(t *testing.T) {
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	assert.True(t, client.Supports("SSH_FXP_SYMLINK"))
+	assert.True(t, client.Supports("posix-rename@openssh.com"))
+
+	// fsync@openssh.com is not served by this package.
+	assert.False(t, client.Supports("fsync@openssh.com"))
+	assert.False(t, client.Supports("nonexistent@example.com"))
+}
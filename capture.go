@@ -0,0 +1,207 @@
+package sftp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// captureMagic identifies a capture stream, and encodes its format version.
+const captureMagic = "SFTPCAP1"
+
+// captureMaxFrameLength bounds the frames accepted by a CaptureReader,
+// guarding against unbounded allocations from a corrupt capture.
+const captureMaxFrameLength = 16 * 1024 * 1024
+
+var errBadCaptureMagic = errors.New("sftp: not an SFTP capture stream")
+
+// CaptureDirection records which way a captured frame travelled,
+// relative to the side of the connection that recorded it.
+type CaptureDirection uint8
+
+// Capture directions.
+const (
+	CaptureSent     CaptureDirection = 0
+	CaptureReceived CaptureDirection = 1
+)
+
+func (d CaptureDirection) String() string {
+	switch d {
+	case CaptureSent:
+		return "sent"
+	case CaptureReceived:
+		return "received"
+	default:
+		return fmt.Sprintf("CaptureDirection(%d)", uint8(d))
+	}
+}
+
+// A CaptureWriter records raw SFTP frames, as they are seen above the SSH transport,
+// so that a problematic session can be captured and shared without decrypting network traffic.
+//
+// A capture stream begins with the 8-byte magic "SFTPCAP1",
+// and is followed by zero or more records, each consisting of:
+//
+//	int64  timestamp, in nanoseconds since the Unix epoch
+//	byte   direction, 0 for sent and 1 for received
+//	uint32 length
+//	byte   type
+//	byte[length - 1] data
+//
+// All integers are big-endian, and the length, type, and data are the SFTP frame exactly as it is on the wire.
+//
+// Captures contain everything transferred over the session, including file contents,
+// and should be handled accordingly.
+//
+// A CaptureWriter is safe for concurrent use, so that a single stream may be shared.
+// Errors writing to the underlying io.Writer do not interrupt the session being captured;
+// instead the first error is retained, and reported by Err.
+type CaptureWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewCaptureWriter writes the capture stream header to w,
+// and returns a CaptureWriter which records frames to it.
+func NewCaptureWriter(w io.Writer) (*CaptureWriter, error) {
+	if _, err := io.WriteString(w, captureMagic); err != nil {
+		return nil, err
+	}
+
+	return &CaptureWriter{
+		w: w,
+	}, nil
+}
+
+// WriteFrame records a single SFTP frame, which must include the leading uint32(length).
+func (cw *CaptureWriter) WriteFrame(dir CaptureDirection, t time.Time, frame []byte) error {
+	var hdr [9]byte
+	binary.BigEndian.PutUint64(hdr[:8], uint64(t.UnixNano()))
+	hdr[8] = byte(dir)
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	return cw.write(hdr[:], frame)
+}
+
+// writePacket records a frame from the packet type and body,
+// as returned from recvPacket.
+func (cw *CaptureWriter) writePacket(dir CaptureDirection, typ uint8, data []byte) {
+	var hdr [14]byte
+	binary.BigEndian.PutUint64(hdr[:8], uint64(time.Now().UnixNano()))
+	hdr[8] = byte(dir)
+	binary.BigEndian.PutUint32(hdr[9:13], uint32(1+len(data)))
+	hdr[13] = typ
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.write(hdr[:], data)
+}
+
+func (cw *CaptureWriter) write(hdr, data []byte) error {
+	if cw.err != nil {
+		return cw.err
+	}
+
+	if _, err := cw.w.Write(hdr); err != nil {
+		cw.err = err
+		return err
+	}
+
+	if _, err := cw.w.Write(data); err != nil {
+		cw.err = err
+		return err
+	}
+
+	return nil
+}
+
+// Err returns the first error encountered while writing to the underlying io.Writer, if any.
+func (cw *CaptureWriter) Err() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	return cw.err
+}
+
+// CaptureRecord is a single frame read from a capture stream.
+type CaptureRecord struct {
+	Time      time.Time
+	Direction CaptureDirection
+
+	// Frame is the SFTP frame as it was on the wire, including the leading uint32(length).
+	Frame []byte
+}
+
+// String renders the record as a timestamped DumpPacket.
+func (r *CaptureRecord) String() string {
+	return fmt.Sprintf("%s %s %s", r.Time.UTC().Format(time.RFC3339Nano), r.Direction, DumpPacket(r.Frame))
+}
+
+// A CaptureReader reads records from a capture stream written by a CaptureWriter.
+type CaptureReader struct {
+	r *bufio.Reader
+}
+
+// NewCaptureReader validates the capture stream header read from r,
+// and returns a CaptureReader for the records that follow it.
+func NewCaptureReader(r io.Reader) (*CaptureReader, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errBadCaptureMagic
+		}
+		return nil, err
+	}
+
+	if string(magic) != captureMagic {
+		return nil, errBadCaptureMagic
+	}
+
+	return &CaptureReader{
+		r: br,
+	}, nil
+}
+
+// Next returns the next record in the capture stream.
+// It returns io.EOF when there are no more records,
+// and io.ErrUnexpectedEOF if the stream ends partway through a record.
+func (cr *CaptureReader) Next() (*CaptureRecord, error) {
+	var hdr [13]byte
+	if _, err := io.ReadFull(cr.r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(hdr[9:])
+	if length == 0 {
+		return nil, errShortPacket
+	}
+	if length > captureMaxFrameLength {
+		return nil, errLongPacket
+	}
+
+	frame := make([]byte, 4+length)
+	copy(frame, hdr[9:])
+
+	if _, err := io.ReadFull(cr.r, frame[4:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return &CaptureRecord{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(hdr[:8]))),
+		Direction: CaptureDirection(hdr[8]),
+		Frame:     frame,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package sftp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readCapture(t *testing.T, r io.Reader) []*CaptureRecord {
+	t.Helper()
+
+	cr, err := NewCaptureReader(r)
+	require.NoError(t, err)
+
+	var recs []*CaptureRecord
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return recs
+		}
+		require.NoError(t, err)
+		recs = append(recs, rec)
+	}
+}
+
+func TestCaptureRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	cw, err := NewCaptureWriter(&buf)
+	require.NoError(t, err)
+
+	frame := dumpTestFrame(t, &sshFxpStatPacket{ID: 1, Path: "/foo"})
+	when := time.Unix(1234567890, 123456789)
+
+	require.NoError(t, cw.WriteFrame(CaptureSent, when, frame))
+	cw.writePacket(CaptureReceived, frame[4], frame[5:])
+	require.NoError(t, cw.Err())
+
+	recs := readCapture(t, bytes.NewReader(buf.Bytes()))
+	require.Len(t, recs, 2)
+
+	assert.True(t, when.Equal(recs[0].Time))
+	assert.Equal(t, CaptureSent, recs[0].Direction)
+	assert.Equal(t, frame, recs[0].Frame)
+
+	assert.Equal(t, CaptureReceived, recs[1].Direction)
+	assert.Equal(t, frame, recs[1].Frame)
+	assert.Contains(t, recs[1].String(), `received SSH_FXP_STAT (17)`)
+
+	// truncated record
+	cr, err := NewCaptureReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.NoError(t, err)
+	_, err = cr.Next()
+	require.NoError(t, err)
+	_, err = cr.Next()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = NewCaptureReader(bytes.NewReader([]byte("not a capture")))
+	assert.Equal(t, errBadCaptureMagic, err)
+}
+
+func TestCaptureSession(t *testing.T) {
+	var clientBuf, serverBuf bytes.Buffer
+	clientCapture, err := NewCaptureWriter(&clientBuf)
+	require.NoError(t, err)
+	serverCapture, err := NewCaptureWriter(&serverBuf)
+	require.NoError(t, err)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithServerCapture(serverCapture))
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Serve()
+	}()
+
+	client, err := NewClientPipe(cr, cw, WithCapture(clientCapture))
+	require.NoError(t, err)
+
+	_, err = client.Getwd()
+	require.NoError(t, err)
+
+	server.Close()
+	client.Close()
+	<-done
+
+	clientRecs := readCapture(t, &clientBuf)
+	serverRecs := readCapture(t, &serverBuf)
+
+	require.Len(t, clientRecs, 4)
+	require.Len(t, serverRecs, 4)
+
+	wantTypes := []uint8{sshFxpInit, sshFxpVersion, sshFxpRealpath, sshFxpName}
+	for i, typ := range wantTypes {
+		assert.Equal(t, typ, clientRecs[i].Frame[4])
+		assert.Equal(t, typ, serverRecs[i].Frame[4])
+
+		// each side should have seen exactly the same bytes, but in the opposite direction.
+		assert.Equal(t, clientRecs[i].Frame, serverRecs[i].Frame)
+		assert.NotEqual(t, clientRecs[i].Direction, serverRecs[i].Direction)
+	}
+
+	assert.Equal(t, CaptureSent, clientRecs[0].Direction)
+	assert.Equal(t, CaptureReceived, serverRecs[0].Direction)
+}
@@ -0,0 +1,331 @@
+package sftp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// checkFileMinBlockSize is the smallest block size of a check-file request, other than zero for the whole range.
+const checkFileMinBlockSize = 256
+
+var (
+	errCheckFileBlockSize = errors.New("sftp: check-file block size is less than 256")
+	errCheckFileTooLarge  = errors.New("sftp: check-file reply is too large, use a larger block size")
+)
+
+// checkFileHashes are the hash algorithms of the check-file extension, by their names in it.
+var checkFileHashes = map[string]struct {
+	new  func() hash.Hash
+	size int
+}{
+	"md5":    {md5.New, md5.Size},
+	"sha1":   {sha1.New, sha1.Size},
+	"sha224": {sha256.New224, sha256.Size224},
+	"sha256": {sha256.New, sha256.Size},
+	"sha384": {sha512.New384, sha512.Size384},
+	"sha512": {sha512.New, sha512.Size},
+	"crc32":  {func() hash.Hash { return crc32.NewIEEE() }, crc32.Size},
+}
+
+// FileHash is the digest of a range of a file, computed by the server, see Client.Hash.
+type FileHash struct {
+	// Algorithm is the hash algorithm used by the server, such as "sha256".
+	Algorithm string
+
+	// Digests are the digests of each block of the range, in order,
+	// or the single digest of the whole range, if the block size was zero.
+	Digests [][]byte
+}
+
+// Hash has the server compute the digest of length bytes of the file name, from offset,
+// or until the end of the file if length is zero,
+// with the first of the comma-separated hash algorithms algo that the server supports,
+// such as "sha256", or "sha256,sha1,md5".
+// If blockSize is not zero, a digest is computed for each block of blockSize bytes, which must be at least 256,
+// and otherwise a single digest of the whole range.
+//
+// The algorithms of the Server and RequestServer of this package are md5, sha1, sha224, sha256, sha384, sha512, and crc32.
+//
+// This allows a file to be verified after a transfer, or the blocks which differ to be found, without reading it back.
+// It implements the check-file-name SSH_FXP_EXTENDED feature, of the draft extensions of the protocol.
+func (c *Client) Hash(name, algo string, offset, length uint64, blockSize uint32) (*FileHash, error) {
+	return c.checkFile("check-file-name", name, algo, offset, length, blockSize)
+}
+
+// Hash has the server compute the digest of a range of the File, in the same way as Client.Hash.
+// The File must be open for reading.
+//
+// It implements the check-file-handle SSH_FXP_EXTENDED feature, of the draft extensions of the protocol.
+func (f *File) Hash(algo string, offset, length uint64, blockSize uint32) (*FileHash, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.handle == "" {
+		return nil, os.ErrClosed
+	}
+
+	return f.c.checkFile("check-file-handle", f.handle, algo, offset, length, blockSize)
+}
+
+func (c *Client) checkFile(ext, target, algo string, offset, length uint64, blockSize uint32) (*FileHash, error) {
+	id := c.nextID()
+	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpCheckFilePacket{
+		ID:         id,
+		Extension:  ext,
+		Target:     target,
+		Algorithms: algo,
+		Offset:     offset,
+		Length:     length,
+		BlockSize:  blockSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case sshFxpExtendedReply:
+		sid, data, err := unmarshalUint32Safe(data)
+		if err != nil {
+			return nil, err
+		}
+		if sid != id {
+			return nil, &unexpectedIDErr{id, sid}
+		}
+		return unmarshalFileHash(data)
+	case sshFxpStatus:
+		return nil, c.statusError(id, data)
+	default:
+		return nil, unimplementedPacketErr(typ)
+	}
+}
+
+// unmarshalFileHash decodes the reply to check-file: the name of the algorithm, and the digests, concatenated.
+// The digests of an algorithm of an unknown size are returned as a single digest.
+func unmarshalFileHash(data []byte) (*FileHash, error) {
+	algo, data, err := unmarshalStringSafe(data)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &FileHash{Algorithm: algo}
+
+	size := len(data)
+	if known, ok := checkFileHashes[algo]; ok {
+		size = known.size
+	}
+	if size == 0 || len(data)%size != 0 {
+		return nil, errShortPacket
+	}
+
+	for len(data) > 0 {
+		h.Digests = append(h.Digests, data[:size:size])
+		data = data[size:]
+	}
+	return h, nil
+}
+
+// checkFile computes the reply to the check-file request p, of the file read through r,
+// with digests of up to maxDigests bytes in all.
+func checkFile(r io.ReaderAt, p *sshFxpExtendedPacketCheckFile, maxDigests int) responsePacket {
+	var algo string
+	for _, name := range strings.Split(p.Algorithms, ",") {
+		if _, ok := checkFileHashes[name]; ok {
+			algo = name
+			break
+		}
+	}
+	if algo == "" {
+		return statusFromError(p.ID, ErrSSHFxOpUnsupported)
+	}
+	if p.BlockSize != 0 && p.BlockSize < checkFileMinBlockSize {
+		return statusFromError(p.ID, errCheckFileBlockSize)
+	}
+	if int64(p.Offset) < 0 || int64(p.Length) < 0 {
+		return statusFromError(p.ID, os.ErrInvalid)
+	}
+
+	length := int64(p.Length)
+	if length == 0 {
+		length = 1<<63 - 1 - int64(p.Offset)
+	}
+	sr := io.NewSectionReader(r, int64(p.Offset), length)
+
+	blockSize := int64(p.BlockSize)
+	if blockSize == 0 {
+		blockSize = length
+	}
+
+	resp := &sshFxpCheckFileResponse{
+		ID:        p.ID,
+		Algorithm: algo,
+	}
+
+	h := checkFileHashes[algo].new()
+	for {
+		h.Reset()
+		n, err := io.Copy(h, io.LimitReader(sr, blockSize))
+		if err != nil {
+			return statusFromError(p.ID, err)
+		}
+		if n == 0 && len(resp.Digests) > 0 {
+			// the range ended with the last block, or at the end of the file.
+			break
+		}
+
+		resp.Digests = h.Sum(resp.Digests)
+		if len(resp.Digests) > maxDigests {
+			return statusFromError(p.ID, errCheckFileTooLarge)
+		}
+		if n < blockSize {
+			break
+		}
+	}
+
+	return resp
+}
+
+// checkFileReaderAt returns the reader of the file of the check-file request p, and a function to close it.
+func (rs *RequestServer) checkFileReaderAt(ctx context.Context, p *sshFxpExtendedPacketCheckFile) (io.ReaderAt, func(), error) {
+	if p.ExtendedRequest == "check-file-handle" {
+		r, ok := rs.getRequest(p.Target)
+		if !ok {
+			return nil, nil, EBADF
+		}
+		if ra := r.getReaderAt(); ra != nil {
+			return ra, func() {}, nil
+		}
+		if rw := r.getWriterAtReaderAt(); rw != nil {
+			return rw, func() {}, nil
+		}
+		return nil, nil, EBADF
+	}
+
+	r := NewRequest("Get", cleanPathWithBase(rs.startDirectory, p.Target)).WithContext(ctx)
+	r.Flags = sshFxfRead
+
+	ra, err := rs.Handlers.FileGet.Fileread(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ra, func() {
+		if c, ok := ra.(io.Closer); ok {
+			c.Close()
+		}
+	}, nil
+}
+
+type sshFxpCheckFilePacket struct {
+	ID         uint32
+	Extension  string // check-file-name, or check-file-handle
+	Target     string // the name, or the handle
+	Algorithms string
+	Offset     uint64
+	Length     uint64
+	BlockSize  uint32
+}
+
+func (p *sshFxpCheckFilePacket) id() uint32 { return p.ID }
+
+func (p *sshFxpCheckFilePacket) MarshalBinary() ([]byte, error) {
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(p.Extension) +
+		4 + len(p.Target) +
+		4 + len(p.Algorithms) +
+		8 + 8 + 4 // uint64 + uint64 + uint32
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, p.Extension)
+	b = marshalString(b, p.Target)
+	b = marshalString(b, p.Algorithms)
+	b = marshalUint64(b, p.Offset)
+	b = marshalUint64(b, p.Length)
+	b = marshalUint32(b, p.BlockSize)
+
+	return b, nil
+}
+
+type sshFxpExtendedPacketCheckFile struct {
+	ID              uint32
+	ExtendedRequest string
+	Target          string // the name, for check-file-name, or the handle, for check-file-handle
+	Algorithms      string
+	Offset          uint64
+	Length          uint64
+	BlockSize       uint32
+}
+
+func (p *sshFxpExtendedPacketCheckFile) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketCheckFile) readonly() bool { return true }
+func (p *sshFxpExtendedPacketCheckFile) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Target, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Algorithms, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Offset, b, err = unmarshalUint64Safe(b); err != nil {
+		return err
+	} else if p.Length, b, err = unmarshalUint64Safe(b); err != nil {
+		return err
+	} else if p.BlockSize, _, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketCheckFile) respond(s *Server) responsePacket {
+	maxDigests := int(s.maxTxPacket)
+
+	if p.ExtendedRequest == "check-file-handle" {
+		f, ok := s.getHandle(p.Target)
+		if !ok {
+			return statusFromError(p.ID, EBADF)
+		}
+		return checkFile(f, p, maxDigests)
+	}
+
+	f, err := os.Open(s.toLocalPath(p.Target))
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+	defer f.Close()
+
+	return checkFile(f, p, maxDigests)
+}
+
+// sshFxpCheckFileResponse is the SSH_FXP_EXTENDED_REPLY to check-file-name and check-file-handle.
+type sshFxpCheckFileResponse struct {
+	ID        uint32
+	Algorithm string
+	Digests   []byte // concatenated
+}
+
+func (p *sshFxpCheckFileResponse) id() uint32 { return p.ID }
+
+func (p *sshFxpCheckFileResponse) MarshalBinary() ([]byte, error) {
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(p.Algorithm) +
+		len(p.Digests)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtendedReply)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, p.Algorithm)
+	b = append(b, p.Digests...)
+
+	return b, nil
+}
@@ -0,0 +1,88 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHash(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 100) // 1600 bytes
+
+	name := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, ioutil.WriteFile(name, content, 0o644))
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	_, ok := client.HasExtension("check-file")
+	assert.True(t, ok)
+
+	h, err := client.Hash(name, "sha256", 0, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", h.Algorithm)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, [][]byte{sum[:]}, h.Digests)
+
+	// the first algorithm supported is used, for the range, in blocks.
+	h, err = client.Hash(name, "whirlpool,md5", 100, 1000, 512)
+	require.NoError(t, err)
+	assert.Equal(t, "md5", h.Algorithm)
+	want := [][]byte{}
+	for _, block := range [][]byte{content[100:612], content[612:1100]} {
+		sum := md5.Sum(block)
+		want = append(want, sum[:])
+	}
+	assert.Equal(t, want, h.Digests)
+
+	_, err = client.Hash(name, "whirlpool", 0, 0, 0)
+	assert.ErrorIs(t, err, ErrSSHFxOpUnsupported)
+
+	_, err = client.Hash(name, "sha256", 0, 0, 100)
+	assert.Error(t, err)
+
+	f, err := client.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	h, err = f.Hash("sha256", 1024, 0, 256)
+	require.NoError(t, err)
+	want = [][]byte{}
+	for _, block := range [][]byte{content[1024:1280], content[1280:1536], content[1536:]} {
+		sum := sha256.Sum256(block)
+		want = append(want, sum[:])
+	}
+	assert.Equal(t, want, h.Digests)
+}
+
+func TestRequestHash(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte("hello"))
+
+	h, err := p.cli.Hash("/foo", "sha256", 0, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{sum[:]}, h.Digests)
+
+	f, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	h, err = f.Hash("sha256", 0, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{sum[:]}, h.Digests)
+
+	_, err = p.cli.Hash("/missing", "sha256", 0, 0, 0)
+	assert.Error(t, err)
+}
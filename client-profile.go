@@ -0,0 +1,101 @@
+package sftp
+
+import (
+	"errors"
+	"strconv"
+)
+
+// A ClientProfile selects the bundle of compatibility workarounds known to be needed by a server implementation,
+// so that they can be applied with one setting, see WithClientProfile.
+//
+// The workarounds of a profile may grow over time, as more deviations of its server are found.
+type ClientProfile int
+
+// The profiles of the servers the Client has workarounds for.
+const (
+	// ProfileDefault applies no workarounds, as the zero ClientCompat.
+	ProfileDefault ClientProfile = iota
+
+	// ProfileOpenSSH is for the sftp-server, or internal-sftp, of OpenSSH,
+	// whose behavior the defaults of the Client already follow, and so applies no workarounds.
+	ProfileOpenSSH
+
+	// ProfileWindowsOpenSSH is for the port of OpenSSH to Windows,
+	// whose file names are not case sensitive, and which fails a rename of a file to its own name.
+	ProfileWindowsOpenSSH
+
+	// ProfileProFTPD is for the mod_sftp module of ProFTPD,
+	// which rejects the empty path in SSH_FXP_REALPATH, fails a rename of a file to its own name,
+	// and may answer reads with less data than asked for before the end of a file.
+	ProfileProFTPD
+
+	// ProfileAzureBlobSFTP is for the SFTP endpoint of Azure Blob Storage,
+	// which does not take permissions on open, may answer reads with less data than asked for before the end of a file,
+	// and cannot rename across containers, which Rename then does by copying, see WithRenameFallbackCopy.
+	ProfileAzureBlobSFTP
+)
+
+var clientProfileNames = map[ClientProfile]string{
+	ProfileDefault:        "default",
+	ProfileOpenSSH:        "openssh",
+	ProfileWindowsOpenSSH: "windows-openssh",
+	ProfileProFTPD:        "proftpd",
+	ProfileAzureBlobSFTP:  "azure-blob-sftp",
+}
+
+func (p ClientProfile) String() string {
+	if name, ok := clientProfileNames[p]; ok {
+		return name
+	}
+	return "ClientProfile(" + strconv.Itoa(int(p)) + ")"
+}
+
+// Compat returns the compatibility workarounds of the profile.
+func (p ClientProfile) Compat() ClientCompat {
+	switch p {
+	case ProfileWindowsOpenSSH:
+		return ClientCompat{
+			RenameToSelf:    true,
+			CaseInsensitive: true,
+		}
+
+	case ProfileProFTPD:
+		return ClientCompat{
+			RealPathDot:  true,
+			RenameToSelf: true,
+			ShortReads:   true,
+		}
+
+	case ProfileAzureBlobSFTP:
+		return ClientCompat{
+			RenameToSelf:       true,
+			OpenAttrsBySetstat: true,
+			ShortReads:         true,
+		}
+	}
+
+	return ClientCompat{}
+}
+
+// renameFallbackCopy reports whether the profile renames by copying where the server cannot rename.
+func (p ClientProfile) renameFallbackCopy() bool {
+	return p == ProfileAzureBlobSFTP
+}
+
+// WithClientProfile applies the compatibility workarounds of the given profile to the Client,
+// in place of those of any WithClientCompat before it.
+// Options after it may still change the workarounds, such as a WithClientCompat to adjust the bundle.
+// An unknown profile is an error.
+func WithClientProfile(p ClientProfile) ClientOption {
+	return func(c *Client) error {
+		if _, ok := clientProfileNames[p]; !ok {
+			return errors.New("unknown client profile " + p.String())
+		}
+
+		c.compat = p.Compat()
+		if p.renameFallbackCopy() {
+			c.renameFallbackCopy = true
+		}
+		return nil
+	}
+}
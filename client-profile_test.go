@@ -0,0 +1,93 @@
+package sftp
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientProfile(t *testing.T) {
+	assert.Equal(t, "proftpd", ProfileProFTPD.String())
+	assert.Equal(t, "ClientProfile(42)", ClientProfile(42).String())
+	assert.Equal(t, ClientCompat{}, ProfileOpenSSH.Compat())
+
+	c := &Client{compat: ClientCompat{LongHandles: true}}
+	require.NoError(t, WithClientProfile(ProfileAzureBlobSFTP)(c))
+	assert.Equal(t, ProfileAzureBlobSFTP.Compat(), c.compat)
+	assert.True(t, c.renameFallbackCopy)
+
+	assert.Error(t, WithClientProfile(ClientProfile(42))(c))
+}
+
+func TestClientCompatShortReads(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileGet = shortReads{handlers.FileGet, 1000}
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	_, err := putTestFile(p.cli, "/file", string(data))
+	require.NoError(t, err)
+
+	require.NoError(t, WithClientProfile(ProfileProFTPD)(p.cli))
+
+	f, err := p.cli.Open("/file")
+	require.NoError(t, err)
+	defer f.Close()
+
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, data, buf.Bytes())
+
+	// unlike TestFileReadFull, ReadAt reads past the short reads.
+	b := make([]byte, len(data))
+	n, err := f.ReadAt(b, 0)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, b)
+}
+
+func TestClientCompatOpenAttrsBySetstat(t *testing.T) {
+	handlers := InMemHandler()
+	cmder := crossDeviceCmder{handlers.FileCmd, make(map[string]FileStat)}
+	handlers.FileCmd = cmder
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	p.cli.compat.OpenAttrsBySetstat = true
+
+	f, err := p.cli.CreateExclusive("/file", 0o640)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	attrs := cmder.setstat["/file"]
+	assert.Equal(t, os.FileMode(0o640), attrs.FileMode().Perm())
+
+	_, err = p.cli.CreateExclusive("/file", 0o640)
+	assert.True(t, os.IsExist(err), "CreateExclusive() of an existing file = %v", err)
+}
+
+func TestClientCompatCaseInsensitive(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	for _, name := range []string{"/dir/Foo.TXT", "/dir/bar.txt", "/dir/baz.dat"} {
+		require.NoError(t, p.cli.MkdirAll("/dir"))
+		_, err := putTestFile(p.cli, name, "")
+		require.NoError(t, err)
+	}
+
+	matches, err := p.cli.Glob("/dir/*.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dir/bar.txt"}, matches)
+
+	p.cli.compat.CaseInsensitive = true
+
+	matches, err = p.cli.Glob("/dir/*.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dir/Foo.TXT", "/dir/bar.txt"}, matches)
+}
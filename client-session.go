@@ -0,0 +1,174 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sessionStderrLimit is the number of bytes of the stderr of its SSH session kept by a Client created by NewClient.
+const sessionStderrLimit = 64 << 10
+
+// sessionExitTimeout bounds how long NewClient waits for the exit status of a session in which the SFTP session failed to start.
+const sessionExitTimeout = time.Second
+
+// SessionError is the error of NewClient, and of Wait, when the SSH session of a Client created by NewClient
+// ended with a failure, such as a server which only allows sftp through a forced command,
+// and otherwise prints the reason to stderr, and exits.
+type SessionError struct {
+	// Err is the error which ended the SFTP session, such as io.EOF.
+	Err error
+
+	// ExitStatus is the exit status of the SSH session, or -1 if it ended without one, such as by a signal.
+	ExitStatus int
+
+	// Signal is the name of the signal which ended the SSH session, such as "KILL", if any.
+	Signal string
+
+	// Stderr is the start of what the server wrote to the stderr of the SSH session.
+	Stderr string
+}
+
+func (e *SessionError) Error() string {
+	msg := "sftp: ssh session ended"
+	switch {
+	case e.Signal != "":
+		msg += " by signal " + e.Signal
+	case e.ExitStatus >= 0:
+		msg += " with exit status " + strconv.Itoa(e.ExitStatus)
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Unwrap returns the error which ended the SFTP session.
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// Stderr returns the start of what the server wrote to the stderr of the SSH session of the Client, so far,
+// up to 64 KiB, where servers often say why they refused, or ended, the session.
+// It is empty for a Client not created by NewClient.
+func (c *Client) Stderr() string {
+	if c.session == nil {
+		return ""
+	}
+	return c.session.stderr()
+}
+
+// requestSubsystem starts the named subsystem on the session channel ch.
+func requestSubsystem(ch ssh.Channel, name string) error {
+	ok, err := ch.SendRequest("subsystem", true, ssh.Marshal(struct{ Name string }{name}))
+	if err == nil && !ok {
+		err = errors.New("ssh: subsystem request failed")
+	}
+	return err
+}
+
+// sessionStdin is the stdin of a session channel, whose Close only closes the channel for writing,
+// so that the output of the server may still be read.
+type sessionStdin struct {
+	ssh.Channel
+}
+
+func (s sessionStdin) Close() error {
+	return s.CloseWrite()
+}
+
+// sessionStatus keeps the stderr, and the exit status, of the SSH session of a Client.
+type sessionStatus struct {
+	mu  sync.Mutex
+	buf []byte
+
+	// set once done is closed.
+	done       chan struct{}
+	exitStatus int // -1 if none was received
+	signal     string
+}
+
+func newSessionStatus() *sessionStatus {
+	return &sessionStatus{
+		done:       make(chan struct{}),
+		exitStatus: -1,
+	}
+}
+
+// Write keeps the start of the stderr of the session, and discards the rest.
+func (s *sessionStatus) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room := sessionStderrLimit - len(s.buf); room > 0 {
+		if len(b) > room {
+			s.buf = append(s.buf, b[:room]...)
+		} else {
+			s.buf = append(s.buf, b...)
+		}
+	}
+	return len(b), nil
+}
+
+func (s *sessionStatus) stderr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return string(s.buf)
+}
+
+// watch keeps the stderr of the session channel ch, and records how the session ends from its requests reqs,
+// until the channel is closed.
+func (s *sessionStatus) watch(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		io.Copy(s, ch.Stderr())
+	}()
+
+	for req := range reqs {
+		switch req.Type {
+		case "exit-status":
+			var msg struct{ Status uint32 }
+			if err := ssh.Unmarshal(req.Payload, &msg); err == nil {
+				s.exitStatus = int(msg.Status)
+			}
+		case "exit-signal":
+			var msg struct {
+				Signal     string
+				CoreDumped bool
+				Error      string
+				Lang       string
+			}
+			if err := ssh.Unmarshal(req.Payload, &msg); err == nil {
+				s.signal = msg.Signal
+			}
+		}
+		if req.WantReply {
+			req.Reply(false, nil)
+		}
+	}
+
+	<-copied
+	close(s.done)
+}
+
+// error returns err, the error which ended the SFTP session,
+// as a *SessionError if the session has ended with a non-zero exit status, or by a signal.
+func (s *sessionStatus) error(err error) error {
+	if s.signal == "" && s.exitStatus <= 0 {
+		return err
+	}
+
+	return &SessionError{
+		Err:        err,
+		ExitStatus: s.exitStatus,
+		Signal:     s.signal,
+		Stderr:     s.stderr(),
+	}
+}
@@ -0,0 +1,126 @@
+package sftp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSubsystemPair returns an ssh.Client connected to an in-process SSH server,
+// which calls handle with the channel of each session that requests a subsystem.
+func sshSubsystemPair(t *testing.T, handle func(ch ssh.Channel)) *ssh.Client {
+	return sshSubsystemPairWithRequests(t, handle, ssh.DiscardRequests)
+}
+
+// sshSubsystemPairWithRequests is sshSubsystemPair, where the global requests sent to the server are passed to reqs.
+func sshSubsystemPairWithRequests(t *testing.T, handle func(ch ssh.Channel), reqs func(<-chan *ssh.Request)) *ssh.Client {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		_, chans, globalReqs, err := ssh.NewServerConn(nc, basicServerConfig())
+		if err != nil {
+			return
+		}
+		go reqs(globalReqs)
+
+		for newChan := range chans {
+			if newChan.ChannelType() != "session" {
+				newChan.Reject(ssh.UnknownChannelType, "")
+				continue
+			}
+
+			ch, chReqs, err := newChan.Accept()
+			if err != nil {
+				continue
+			}
+
+			go func() {
+				for req := range chReqs {
+					ok := req.Type == "subsystem"
+					req.Reply(ok, nil)
+					if ok {
+						go handle(ch)
+					}
+				}
+			}()
+		}
+	}()
+
+	conn, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.Password("test")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// exitSession ends the session of ch with the exit status.
+func exitSession(ch ssh.Channel, status uint32) {
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	ch.Close()
+}
+
+func TestNewClientSessionRefused(t *testing.T) {
+	conn := sshSubsystemPair(t, func(ch ssh.Channel) {
+		ch.Stderr().Write([]byte("This service allows sftp connections only.\n"))
+		exitSession(ch, 1)
+	})
+
+	_, err := NewClient(conn)
+
+	var serr *SessionError
+	require.True(t, errors.As(err, &serr), "NewClient() = %v", err)
+	assert.Equal(t, 1, serr.ExitStatus)
+	assert.Equal(t, "This service allows sftp connections only.\n", serr.Stderr)
+	assert.Contains(t, err.Error(), "exit status 1: This service allows sftp connections only.")
+}
+
+func TestClientSessionWait(t *testing.T) {
+	conn := sshSubsystemPair(t, func(ch ssh.Channel) {
+		ch.Stderr().Write([]byte("starting\n"))
+
+		server, err := NewServer(ch)
+		if err != nil {
+			ch.Close()
+			return
+		}
+		server.Serve()
+		exitSession(ch, 3)
+	})
+
+	client, err := NewClient(conn)
+	require.NoError(t, err)
+
+	_, err = client.Getwd()
+	require.NoError(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Stderr() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "starting\n", client.Stderr())
+
+	client.Close()
+
+	err = client.Wait()
+	var serr *SessionError
+	require.True(t, errors.As(err, &serr), "Wait() = %v", err)
+	assert.Equal(t, 3, serr.ExitStatus)
+	assert.True(t, strings.HasPrefix(serr.Stderr, "starting"))
+}
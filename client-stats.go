@@ -0,0 +1,394 @@
+package sftp
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientStats are the running totals of the operations of a Client, since it was created.
+type ClientStats struct {
+	// Requests is the number of requests sent.
+	Requests int64
+
+	// Responses is the number of responses received.
+	Responses int64
+
+	// Errors is the number of responses with a status other than SSH_FX_OK or SSH_FX_EOF.
+	Errors int64
+
+	// BytesRead and BytesWritten are the number of bytes of file data received, and sent.
+	BytesRead, BytesWritten int64
+
+	// BytesExpected is the total of the expected sizes given to File.SetExpectedSize,
+	// against which BytesRead and BytesWritten may be compared to report the progress of the transfers.
+	BytesExpected int64
+
+	// InFlight is the number of requests awaiting a response, at the time of the call to Stats,
+	// and InFlightMax is the most there have been at once.
+	InFlight, InFlightMax int64
+
+	// Retransmits is the number of reads sent again for the rest of the data,
+	// after the server answered with less than was asked for, before the end of the file.
+	Retransmits int64
+
+	// Latency holds the latencies of the requests answered, from being sent to their response being received,
+	// by the name of their packet type, such as "SSH_FXP_READ", or of their extension, such as "statvfs@openssh.com".
+	Latency map[string]LatencyHistogram
+}
+
+// latencyBounds are the upper bounds of the buckets of a LatencyHistogram.
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// A LatencyHistogram counts latencies in buckets, as a Prometheus histogram does,
+// so that it can be exported as one without loss.
+type LatencyHistogram struct {
+	// Count is the number of latencies observed, and Sum is their total.
+	Count int64
+	Sum   time.Duration
+
+	// Bounds are the upper bounds of the buckets, in increasing order,
+	// and Buckets the cumulative counts of the latencies at most each bound.
+	// The latencies above the last bound are only in Count.
+	Bounds  []time.Duration
+	Buckets []int64
+}
+
+func (h *LatencyHistogram) observe(d time.Duration) {
+	h.Count++
+	h.Sum += d
+	for i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] }); i < len(h.Bounds); i++ {
+		h.Buckets[i]++
+	}
+}
+
+// A MetricsCollector receives the requests and responses of a Client as they happen, see WithMetrics,
+// such as to feed the counters and histograms of a metrics system.
+// Its methods are called from the goroutines of the Client, including the one reading the responses,
+// and so must be safe for concurrent use, and return quickly.
+type MetricsCollector interface {
+	// RequestSent is called as a request is sent,
+	// with the name of its packet type, or of its extension, as in ClientStats.Latency,
+	// and the number of bytes of file data it carries.
+	RequestSent(op string, bytes int)
+
+	// ResponseReceived is called as the response to a request is received, with the name of the request,
+	// the time since it was sent, the number of bytes of file data it carries,
+	// and whether it is a status other than SSH_FX_OK or SSH_FX_EOF.
+	// It is not called for requests that get no response, such as once the connection is lost.
+	ResponseReceived(op string, latency time.Duration, bytes int, failed bool)
+
+	// Retransmitted is called as a request is sent again, see ClientStats.Retransmits.
+	Retransmitted(op string)
+}
+
+// WithMetrics sets a MetricsCollector to receive the requests and responses of the Client,
+// in addition to the totals returned by Stats.
+func WithMetrics(collector MetricsCollector) ClientOption {
+	return func(c *Client) error {
+		c.stats.collector = collector
+		return nil
+	}
+}
+
+// clientStats accumulates the counts of the ClientStats, as packets are sent and received.
+// All counters are accessed atomically, and the requests awaiting a response and the latencies under the mutex.
+type clientStats struct {
+	requests      int64
+	responses     int64
+	errors        int64
+	bytesRead     int64
+	bytesWritten  int64
+	bytesExpected int64
+	inflightMax   int64
+	retransmits   int64
+
+	collector MetricsCollector // see WithMetrics
+	logger    requestLogger    // see WithLogger
+
+	mu      sync.Mutex
+	pending map[uint32]pendingRequest
+	latency map[string]*LatencyHistogram
+}
+
+// pendingRequest is a request awaiting its response, for the latency of which it records when it was sent.
+type pendingRequest struct {
+	op   string
+	sent time.Time
+
+	logged loggedRequest // only if logging, see WithLogger
+}
+
+// requestOp returns the name of the request p, as in ClientStats.Latency,
+// which is either the form the Client sends, or the form a server receives.
+func requestOp(p interface{}) string {
+	switch p := p.(type) {
+	case *sshFxInitPacket:
+		return fxp(sshFxpInit).String()
+	case *sshFxpOpenPacket:
+		return fxp(sshFxpOpen).String()
+	case *sshFxpClosePacket:
+		return fxp(sshFxpClose).String()
+	case *sshFxpReadPacket:
+		return fxp(sshFxpRead).String()
+	case *sshFxpWritePacket:
+		return fxp(sshFxpWrite).String()
+	case *sshFxpLstatPacket:
+		return fxp(sshFxpLstat).String()
+	case *sshFxpFstatPacket:
+		return fxp(sshFxpFstat).String()
+	case *sshFxpSetstatPacket:
+		return fxp(sshFxpSetstat).String()
+	case *sshFxpFsetstatPacket:
+		return fxp(sshFxpFsetstat).String()
+	case *sshFxpOpendirPacket:
+		return fxp(sshFxpOpendir).String()
+	case *sshFxpReaddirPacket:
+		return fxp(sshFxpReaddir).String()
+	case *sshFxpRemovePacket:
+		return fxp(sshFxpRemove).String()
+	case *sshFxpMkdirPacket:
+		return fxp(sshFxpMkdir).String()
+	case *sshFxpRmdirPacket:
+		return fxp(sshFxpRmdir).String()
+	case *sshFxpRealpathPacket:
+		return fxp(sshFxpRealpath).String()
+	case *sshFxpStatPacket:
+		return fxp(sshFxpStat).String()
+	case *sshFxpRenamePacket:
+		return fxp(sshFxpRename).String()
+	case *sshFxpReadlinkPacket:
+		return fxp(sshFxpReadlink).String()
+	case *sshFxpSymlinkPacket:
+		return fxp(sshFxpSymlink).String()
+	case *sshFxpPosixRenamePacket:
+		return "posix-rename@openssh.com"
+	case *sshFxpHardlinkPacket:
+		return "hardlink@openssh.com"
+	case *sshFxpStatvfsPacket:
+		return "statvfs@openssh.com"
+	case *sshFxpFsyncPacket:
+		return "fsync@openssh.com"
+	case *sshFxpWriteBatchPacket:
+		return writeBatchExtension
+	case *sshFxpExtendedRawPacket:
+		return p.ExtendedRequest
+	case *sshFxpExtendedPacket:
+		return p.ExtendedRequest
+	}
+	return fxp(sshFxpExtended).String()
+}
+
+func (s *clientStats) sent(p idmarshaler) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64(&s.requests, 1)
+
+	var bytes int
+	switch p := p.(type) {
+	case *sshFxpWritePacket:
+		bytes = len(p.Data)
+	case *sshFxpWriteBatchPacket:
+		bytes = len(p.Data)
+		if p.Flags&writeBatchAck == 0 {
+			// no response is sent, and so it has no latency.
+			atomic.AddInt64(&s.bytesWritten, int64(bytes))
+			if s.collector != nil {
+				s.collector.RequestSent(writeBatchExtension, bytes)
+			}
+			return
+		}
+	}
+	atomic.AddInt64(&s.bytesWritten, int64(bytes))
+
+	req := pendingRequest{op: requestOp(p), sent: time.Now()}
+	if s.logger != nil {
+		req.logged = describeRequest(p, req.op)
+		s.logger.logRequest(req.logged)
+	}
+
+	s.mu.Lock()
+	if s.pending == nil {
+		s.pending = make(map[uint32]pendingRequest)
+	}
+	s.pending[p.id()] = req
+	s.mu.Unlock()
+
+	if s.collector != nil {
+		s.collector.RequestSent(req.op, bytes)
+	}
+}
+
+// received accounts for a response packet, where data begins with the request id.
+func (s *clientStats) received(typ uint8, data []byte) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64(&s.responses, 1)
+
+	var bytes int
+	var failed bool
+	code := uint32(sshFxOk)
+	switch typ {
+	case sshFxpStatus:
+		if c, _, err := unmarshalUint32Safe(data[4:]); err == nil {
+			code = c
+		}
+		if code != sshFxOk && code != sshFxEOF {
+			atomic.AddInt64(&s.errors, 1)
+			failed = true
+		}
+	case sshFxpData:
+		if length, _, err := unmarshalUint32Safe(data[4:]); err == nil {
+			atomic.AddInt64(&s.bytesRead, int64(length))
+			bytes = int(length)
+		}
+	}
+
+	sid, _ := unmarshalUint32(data)
+
+	s.mu.Lock()
+	req, ok := s.pending[sid]
+	delete(s.pending, sid)
+	var latency time.Duration
+	if ok {
+		latency = time.Since(req.sent)
+		if s.latency == nil {
+			s.latency = make(map[string]*LatencyHistogram)
+		}
+		h := s.latency[req.op]
+		if h == nil {
+			h = &LatencyHistogram{
+				Bounds:  latencyBounds,
+				Buckets: make([]int64, len(latencyBounds)),
+			}
+			s.latency[req.op] = h
+		}
+		h.observe(latency)
+	}
+	s.mu.Unlock()
+
+	if ok && s.collector != nil {
+		s.collector.ResponseReceived(req.op, latency, bytes, failed)
+	}
+	if ok && s.logger != nil {
+		var msg string
+		if typ == sshFxpStatus && len(data) >= 8 {
+			msg, _, _ = unmarshalStringSafe(data[8:])
+		}
+		s.logger.logResponse(req.logged, latency, bytes, code, msg)
+	}
+}
+
+// abandoned forgets the request sid, which will get no response, or whose response will be dropped.
+func (s *clientStats) abandoned(sid uint32) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.pending, sid)
+	s.mu.Unlock()
+}
+
+// lost forgets all the requests awaiting a response, once the connection is lost.
+func (s *clientStats) lost() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.pending = nil
+	s.mu.Unlock()
+}
+
+// inflight records that n requests are awaiting a response.
+// It is called with the mutex of the clientConn held, and so the high-water mark cannot race with itself.
+func (s *clientStats) inflight(n int) {
+	if s == nil {
+		return
+	}
+
+	if int64(n) > atomic.LoadInt64(&s.inflightMax) {
+		atomic.StoreInt64(&s.inflightMax, int64(n))
+	}
+}
+
+// retransmitted accounts for the request p, which is sent again for the rest of the data.
+func (s *clientStats) retransmitted(p idmarshaler) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64(&s.retransmits, 1)
+	if s.collector != nil {
+		s.collector.Retransmitted(requestOp(p))
+	}
+}
+
+// Stats returns the running totals of the operations of the Client.
+// It is a snapshot, which is not changed by the later operations, and which encodes to JSON as it is served by PublishExpvar.
+func (c *Client) Stats() ClientStats {
+	c.clientConn.Lock()
+	inflight := len(c.inflight)
+	c.clientConn.Unlock()
+
+	stats := ClientStats{InFlight: int64(inflight)}
+	if s := c.stats; s != nil {
+		stats.Requests = atomic.LoadInt64(&s.requests)
+		stats.Responses = atomic.LoadInt64(&s.responses)
+		stats.Errors = atomic.LoadInt64(&s.errors)
+		stats.BytesRead = atomic.LoadInt64(&s.bytesRead)
+		stats.BytesWritten = atomic.LoadInt64(&s.bytesWritten)
+		stats.BytesExpected = atomic.LoadInt64(&s.bytesExpected)
+		stats.InFlightMax = atomic.LoadInt64(&s.inflightMax)
+		stats.Retransmits = atomic.LoadInt64(&s.retransmits)
+
+		s.mu.Lock()
+		if len(s.latency) > 0 {
+			stats.Latency = make(map[string]LatencyHistogram, len(s.latency))
+			for op, h := range s.latency {
+				hist := *h
+				hist.Buckets = append([]int64(nil), h.Buckets...)
+				stats.Latency[op] = hist
+			}
+		}
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// PublishExpvar publishes the Stats of the Client as the expvar variable name,
+// so that they are served at /debug/vars alongside the other variables of the process.
+// It is an error if a variable of that name has already been published,
+// as expvar provides no way to unpublish a variable.
+// The variable keeps the Client reachable, and reports its final totals once it has been closed.
+func (c *Client) PublishExpvar(name string) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("sftp: expvar %q already published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+	return nil
+}
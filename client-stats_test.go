@@ -0,0 +1,124 @@
+package sftp
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientStats(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	before := p.cli.Stats()
+
+	_, err := putTestFile(p.cli, "/foo", "hello world")
+	require.NoError(t, err)
+
+	f, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	require.NoError(t, f.Close())
+
+	_, err = p.cli.Stat("/missing")
+	require.Error(t, err)
+
+	stats := p.cli.Stats()
+	assert.Equal(t, int64(11), stats.BytesWritten-before.BytesWritten)
+	assert.Equal(t, int64(11), stats.BytesRead-before.BytesRead)
+	assert.Equal(t, int64(1), stats.Errors-before.Errors)
+	assert.Equal(t, stats.Requests, stats.Responses)
+	assert.Zero(t, stats.InFlight)
+	assert.GreaterOrEqual(t, stats.InFlightMax, int64(1))
+
+	stat := stats.Latency["SSH_FXP_STAT"]
+	assert.EqualValues(t, 1, stat.Count-before.Latency["SSH_FXP_STAT"].Count)
+	assert.Len(t, stat.Buckets, len(stat.Bounds))
+	assert.LessOrEqual(t, stat.Buckets[len(stat.Buckets)-1], stat.Count)
+
+	require.NoError(t, p.cli.PublishExpvar("sftp_test_client"))
+	assert.Error(t, p.cli.PublishExpvar("sftp_test_client"))
+
+	var published ClientStats
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("sftp_test_client").String()), &published))
+	assert.Equal(t, stats, published)
+}
+
+// testCollector records the calls of a MetricsCollector.
+type testCollector struct {
+	mu        sync.Mutex
+	sent      map[string]int
+	received  map[string]int
+	failed    int
+	bytesRead int
+}
+
+func (c *testCollector) RequestSent(op string, bytes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent[op]++
+}
+
+func (c *testCollector) ResponseReceived(op string, latency time.Duration, bytes int, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.received[op]++
+	c.bytesRead += bytes
+	if failed {
+		c.failed++
+	}
+}
+
+func (c *testCollector) Retransmitted(op string) {}
+
+func TestClientMetrics(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server := NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, InMemHandler())
+	go func() {
+		server.Serve()
+		server.Close()
+	}()
+
+	collector := &testCollector{
+		sent:     make(map[string]int),
+		received: make(map[string]int),
+	}
+	c, err := NewClientPipe(cr, cw, WithMetrics(collector))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = putTestFile(c, "/foo", "hello world")
+	require.NoError(t, err)
+
+	f, err := c.Open("/foo")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = c.Stat("/missing")
+	require.Error(t, err)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	assert.Equal(t, collector.sent, collector.received)
+	assert.Equal(t, 2, collector.sent["SSH_FXP_OPEN"])
+	assert.Equal(t, 1, collector.sent["SSH_FXP_STAT"])
+	assert.Equal(t, 1, collector.failed)
+	assert.Equal(t, 11, collector.bytesRead)
+}
@@ -10,6 +10,7 @@ import (
 	"math"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -17,6 +18,8 @@ import (
 
 	"github.com/kr/fs"
 	"golang.org/x/crypto/ssh"
+
+	sshfx "github.com/pkg/sftp/internal/encoding/ssh/filexfer"
 )
 
 var (
@@ -86,6 +89,53 @@ func MaxPacket(size int) ClientOption {
 	return MaxPacketChecked(size)
 }
 
+// WithReadChunkSize sets the size of each read request, measured in bytes,
+// independently of the maximum packet size, which still limits it.
+// Larger reads suit a link with a high bandwidth, where the server allows them,
+// while smaller reads lower the cost of each request that is lost, or delayed.
+//
+// The default is the maximum packet size.
+func WithReadChunkSize(size int) ClientOption {
+	return func(c *Client) error {
+		if size < 1 {
+			return errors.New("size must be greater or equal to 1")
+		}
+		c.readChunk = size
+		return nil
+	}
+}
+
+// WithWriteChunkSize sets the size of each write request, measured in bytes,
+// independently of the maximum packet size, which still limits it,
+// in the same way as WithReadChunkSize.
+//
+// The default is the maximum packet size.
+func WithWriteChunkSize(size int) ClientOption {
+	return func(c *Client) error {
+		if size < 1 {
+			return errors.New("size must be greater or equal to 1")
+		}
+		c.writeChunk = size
+		return nil
+	}
+}
+
+// readChunkSize returns the size of each read request.
+func (c *Client) readChunkSize() int {
+	if c.readChunk > 0 && c.readChunk < c.maxPacket {
+		return c.readChunk
+	}
+	return c.maxPacket
+}
+
+// writeChunkSize returns the size of each write request.
+func (c *Client) writeChunkSize() int {
+	if c.writeChunk > 0 && c.writeChunk < c.maxPacket {
+		return c.writeChunk
+	}
+	return c.maxPacket
+}
+
 // MaxConcurrentRequestsPerFile sets the maximum concurrent requests allowed for a single file.
 //
 // The default maximum concurrent requests is 64.
@@ -94,8 +144,116 @@ func MaxConcurrentRequestsPerFile(n int) ClientOption {
 		if n < 1 {
 			return errors.New("n must be greater or equal to 1")
 		}
-		c.maxConcurrentRequests = n
-		return nil
+		return c.SetMaxInflight(n)
+	}
+}
+
+// MaxInflight returns the maximum number of concurrent requests that the Client will have outstanding for a single file.
+func (c *Client) MaxInflight() int {
+	return int(atomic.LoadInt32(&c.maxConcurrentRequests))
+}
+
+// SetMaxInflight changes the maximum number of concurrent requests that the Client will have outstanding for a single file.
+// It is safe to call at any time, so that long-lived applications may adapt their concurrency to changing conditions,
+// for example, lowering it when the server starts to fail requests under load.
+//
+// Transfers started after the call use the new limit.
+// Transfers already in progress do not grow, but do shrink gradually,
+// as each of their workers finishes its current request.
+func (c *Client) SetMaxInflight(n int) error {
+	if n < 1 {
+		return errors.New("n must be greater or equal to 1")
+	}
+	if n > math.MaxInt32 {
+		n = math.MaxInt32
+	}
+	if c.inflightLimit != nil && n > cap(c.inflightLimit) {
+		n = cap(c.inflightLimit)
+	}
+
+	atomic.StoreInt32(&c.maxConcurrentRequests, int32(n))
+	return nil
+}
+
+// WithLimits returns a view of the Client, which shares its connection,
+// but has at most maxInflight requests in flight at once,
+// and reads or writes at most maxDataLen bytes of file data in each request.
+// This allows one connection to serve mixed workloads,
+// such as a background scan that must not starve interactive transfers.
+//
+// A limit less than one, or greater than that of the Client, is replaced with that of the Client,
+// see MaxInflight and MaxPacket, so that a view can only narrow the limits.
+// The limits of a view are independent of those of the Client, and of its other views,
+// which do not count the requests of the view against their own limits.
+//
+// Files opened through the view are held to its limits.
+// The view shares the connection, and so closing either the view, or the Client, ends the session for both.
+func (c *Client) WithLimits(maxInflight, maxDataLen int) *Client {
+	if maxInflight < 1 || maxInflight > c.MaxInflight() {
+		maxInflight = c.MaxInflight()
+	}
+	if maxDataLen < 1 || maxDataLen > c.maxPacket {
+		maxDataLen = c.maxPacket
+	}
+
+	return &Client{
+		clientConn: c.clientConn,
+
+		ext: c.ext,
+
+		maxPacket:             maxDataLen,
+		readChunk:             c.readChunk,
+		writeChunk:            c.writeChunk,
+		maxConcurrentRequests: int32(maxInflight),
+
+		inflightLimit: make(chan struct{}, maxInflight),
+
+		useConcurrentWrites:    c.useConcurrentWrites,
+		useFstat:               c.useFstat,
+		disableConcurrentReads: c.disableConcurrentReads,
+		fsyncOnClose:           c.fsyncOnClose,
+		verifyWrites:           c.verifyWrites,
+		writeAckBatch:          c.writeAckBatch,
+		decodeErrorMessages:    c.decodeErrorMessages,
+		renameFallbackCopy:     c.renameFallbackCopy,
+		streamingReadahead:     c.streamingReadahead,
+
+		convertPath: c.convertPath,
+
+		compat: c.compat,
+
+		advertisedVersion: c.advertisedVersion,
+		initExtensions:    c.initExtensions,
+	}
+}
+
+// inflightWorkers counts the running workers of a concurrent transfer,
+// so that they can retire when MaxInflight is lowered during the transfer.
+type inflightWorkers struct {
+	c       *Client
+	running int32
+}
+
+func (c *Client) newInflightWorkers(n int) *inflightWorkers {
+	return &inflightWorkers{
+		c:       c,
+		running: int32(n),
+	}
+}
+
+// retire is called by a worker after it finishes each request,
+// and reports whether the worker should exit, because there are more workers running than MaxInflight allows.
+// The last worker never retires, so that the remaining work is always drained.
+func (w *inflightWorkers) retire() bool {
+	for {
+		n := atomic.LoadInt32(&w.running)
+		if n <= 1 || int(n) <= w.c.MaxInflight() {
+			return false
+		}
+
+		if atomic.CompareAndSwapInt32(&w.running, n, n-1) {
+			return true
+		}
 	}
 }
 
@@ -114,6 +272,15 @@ func UseConcurrentWrites(value bool) ClientOption {
 	}
 }
 
+// WithCapture records every SFTP frame sent and received by the Client to the given CaptureWriter.
+// This is intended for debugging, see CaptureWriter for details of the format.
+func WithCapture(cw *CaptureWriter) ClientOption {
+	return func(c *Client) error {
+		c.capture = cw
+		return nil
+	}
+}
+
 // UseConcurrentReads allows the Client to perform concurrent Reads.
 //
 // Concurrent reads are generally safe to use and not using them will degrade
@@ -156,47 +323,225 @@ func UseFstat(value bool) ClientOption {
 	}
 }
 
+// UseFsyncOnClose sets whether File.Close of a file opened for writing
+// first asks the server to flush the file to stable storage, as with File.Sync.
+// An error from the flush is then returned by Close, even though the file is still closed,
+// so that a nil error from Close means the data written is durable on the server.
+//
+// The flush is skipped, without error, if the server does not support the fsync@openssh.com extension.
+func UseFsyncOnClose(value bool) ClientOption {
+	return func(c *Client) error {
+		c.fsyncOnClose = value
+		return nil
+	}
+}
+
+// UseWriteVerification sets whether File.ReadFrom, and File.ReadFromWithConcurrency,
+// checks the size of the file with FSTAT once all the data is written,
+// and File.Close checks it again with STAT once the file is closed.
+// If the file is smaller than the end of the data written, a *WriteSizeError is returned.
+//
+// This is cheap insurance against servers that silently drop trailing writes,
+// such as when a quota is exceeded, and only notice when the file is closed, if at all.
+// A file may legitimately be larger, for instance when it was not truncated when opened,
+// and so only a short file is reported.
+func UseWriteVerification(value bool) ClientOption {
+	return func(c *Client) error {
+		c.verifyWrites = value
+		return nil
+	}
+}
+
+// WithUnsolicitedPacketHandler makes the Client tolerate packets from the server that answer no outstanding request,
+// such as the unsolicited status or extended packets some servers send as keepalives.
+// Without it, such a packet is taken as a broken session, and the connection is closed.
+//
+// Each such packet is passed to fn, if not nil, with its type, and its content after the type,
+// which usually starts with a request id unknown to the Client.
+// The function is called from the goroutine that receives every packet, and so must not block,
+// or make requests of the Client.
+func WithUnsolicitedPacketHandler(fn func(typ uint8, data []byte)) ClientOption {
+	return func(c *Client) error {
+		c.tolerateUnsolicited = true
+		c.onUnsolicited = fn
+		return nil
+	}
+}
+
+// ConvertWindowsPaths converts the Windows path separator `\` into "/"
+// in every path given to the Client, before it is sent to the server.
+// This avoids confusing "no such file" errors when paths built with package filepath on Windows are used directly.
+//
+// If a path begins with a drive letter, such as "C:", the drive is passed to mapDrive,
+// and replaced with the prefix that it returns, for example "C:" might map to "/c".
+// If mapDrive is nil, drive letters are stripped, so that `C:\Users` becomes "/Users".
+//
+// Paths returned by the server are not converted.
+func ConvertWindowsPaths(mapDrive func(drive string) string) ClientOption {
+	return func(c *Client) error {
+		c.convertPath = func(p string) string {
+			return convertWindowsPath(p, mapDrive)
+		}
+		return nil
+	}
+}
+
+// convertWindowsPath converts the path p from Windows form into a slash-separated path.
+func convertWindowsPath(p string, mapDrive func(drive string) string) string {
+	p = strings.ReplaceAll(p, `\`, "/")
+
+	if len(p) >= 2 && p[1] == ':' && ('a' <= p[0] && p[0] <= 'z' || 'A' <= p[0] && p[0] <= 'Z') {
+		var prefix string
+		if mapDrive != nil {
+			prefix = mapDrive(p[:2])
+		}
+		p = prefix + p[2:]
+	}
+
+	return p
+}
+
+// ClientCompat groups workarounds for servers that deviate from, or differ in their interpretation of, the SFTP specification.
+// The zero value applies no workarounds.
+type ClientCompat struct {
+	// SymlinkSpecOrder sends the arguments of SSH_FXP_SYMLINK in the order given by the specification,
+	// linkpath and then targetpath.
+	// By default, the reversed order used by OpenSSH is sent, as that is what most servers expect.
+	SymlinkSpecOrder bool
+
+	// RealPathDot sends "." in place of an empty path in SSH_FXP_REALPATH,
+	// for servers that reject the empty path, rather than treating it as the current directory.
+	RealPathDot bool
+
+	// RenameToSelf makes a Rename where the old and new names are the same succeed without doing anything,
+	// provided that the file exists, as with rename(2).
+	// Some servers otherwise fail the request, because the new name already exists.
+	RenameToSelf bool
+
+	// ReadOKAsEOF treats an SSH_FX_OK status in response to SSH_FXP_READ as end of file,
+	// for servers that send it instead of SSH_FX_EOF on reads past the end of a file.
+	// By default, such a response is returned as an error.
+	ReadOKAsEOF bool
+
+	// LongHandles accepts handles longer than the 256 bytes allowed by the specification.
+	// By default, such a handle is refused, as it is sent in every request made with it,
+	// and may push those requests over the size limits of the server.
+	LongHandles bool
+
+	// OpenAttrsBySetstat sends no attributes in SSH_FXP_OPEN, as CreateExclusive otherwise does,
+	// and sets them with SSH_FXP_FSETSTAT on the new handle instead, ignoring its failure,
+	// for servers that reject attributes on open, and often do not support permissions at all.
+	OpenAttrsBySetstat bool
+
+	// ShortReads reads files one request at a time, rather than concurrently,
+	// for servers that answer SSH_FXP_READ with less data than asked for before the end of a file,
+	// which the concurrent reads would take to be the end of the file.
+	ShortReads bool
+
+	// CaseInsensitive matches the patterns of Glob without regard to case,
+	// for servers whose file names are not case sensitive.
+	CaseInsensitive bool
+}
+
+// WithClientCompat applies the given compatibility workarounds to the Client.
+func WithClientCompat(compat ClientCompat) ClientOption {
+	return func(c *Client) error {
+		c.compat = compat
+		return nil
+	}
+}
+
+// WithAdvertisedVersion makes the Client send the given protocol version in SSH_FXP_INIT,
+// rather than the version 3 it implements.
+// This is intended for testing how servers handle a version mismatch.
+// The server must still answer with version 3, as that is the only version the Client implements.
+func WithAdvertisedVersion(version uint32) ClientOption {
+	return func(c *Client) error {
+		c.advertisedVersion = version
+		return nil
+	}
+}
+
+// WithInitExtension makes the Client send the named extension pair in SSH_FXP_INIT,
+// such as to advertise its own vendor extensions, or to identify itself to the server.
+// It may be given more than once, and the pairs are sent in the order given.
+// The extensions which the server echoes back in SSH_FXP_VERSION are returned by EchoedExtensions.
+func WithInitExtension(name, data string) ClientOption {
+	return func(c *Client) error {
+		c.initExtensions = append(c.initExtensions, extensionPair{Name: name, Data: data})
+		return nil
+	}
+}
+
 // Client represents an SFTP session on a *ssh.ClientConn SSH connection.
 // Multiple Clients can be active on a single SSH connection, and a Client
 // may be called concurrently from multiple Goroutines.
 //
 // Client implements the github.com/kr/fs.FileSystem interface.
 type Client struct {
-	clientConn
+	*clientConn
 
 	ext map[string]string // Extensions (name -> data).
 
-	maxPacket             int // max packet size read or written.
-	maxConcurrentRequests int
-	nextid                uint32
+	maxPacket             int   // max packet size read or written.
+	readChunk             int   // if set, the size of each read, up to maxPacket, see WithReadChunkSize.
+	writeChunk            int   // if set, the size of each write, up to maxPacket, see WithWriteChunkSize.
+	maxConcurrentRequests int32 // accessed atomically, see MaxInflight.
+
+	inflightLimit chan struct{} // if set, holds a slot for each request in flight, see WithLimits.
 
 	// write concurrency is… error prone.
 	// Default behavior should be to not use it.
 	useConcurrentWrites    bool
 	useFstat               bool
 	disableConcurrentReads bool
+	fsyncOnClose           bool
+	verifyWrites           bool
+	writeAckBatch          int // bytes written between acknowledgements, see UseWriteAckBatching.
+	decodeErrorMessages    bool
+	renameFallbackCopy     bool
+	streamingReadahead     int // reads ahead of the writes of File.WriteTo to a stream, see WithStreamingReadahead.
+
+	convertPath func(string) string // if set, applied to every path sent to the server.
+
+	compat ClientCompat
+
+	advertisedVersion uint32          // if set, sent in SSH_FXP_INIT in place of the implemented version.
+	initExtensions    []extensionPair // sent in SSH_FXP_INIT, see WithInitExtension.
 }
 
 // NewClient creates a new SFTP client on conn, using zero or more option
 // functions.
+//
+// What the server writes to the stderr of the SSH session is kept, see Stderr,
+// and if the session fails, the error of NewClient, or of Wait, is a *SessionError with its exit status.
 func NewClient(conn *ssh.Client, opts ...ClientOption) (*Client, error) {
-	s, err := conn.NewSession()
+	ch, reqs, err := conn.OpenChannel("session", nil)
 	if err != nil {
 		return nil, err
 	}
-	if err := s.RequestSubsystem("sftp"); err != nil {
-		return nil, err
-	}
-	pw, err := s.StdinPipe()
-	if err != nil {
+
+	status := newSessionStatus()
+	go status.watch(ch, reqs)
+
+	if err := requestSubsystem(ch, "sftp"); err != nil {
+		ch.Close()
 		return nil, err
 	}
-	pr, err := s.StdoutPipe()
+
+	sftp, err := NewClientPipe(ch, sessionStdin{ch}, opts...)
 	if err != nil {
-		return nil, err
+		ch.Close()
+		select {
+		case <-status.done:
+			return nil, status.error(err)
+		case <-time.After(sessionExitTimeout):
+			return nil, err
+		}
 	}
 
-	return NewClientPipe(pr, pw, opts...)
+	sftp.session = status
+	return sftp, nil
 }
 
 // NewClientPipe creates a new SFTP client given a Reader and a WriteCloser.
@@ -204,13 +549,15 @@ func NewClient(conn *ssh.Client, opts ...ClientOption) (*Client, error) {
 // the system's ssh client program (e.g. via exec.Command).
 func NewClientPipe(rd io.Reader, wr io.WriteCloser, opts ...ClientOption) (*Client, error) {
 	sftp := &Client{
-		clientConn: clientConn{
+		clientConn: &clientConn{
 			conn: conn{
 				Reader:      rd,
 				WriteCloser: wr,
 			},
 			inflight: make(map[uint32]chan<- result),
+			slots:    make(map[uint32]chan struct{}),
 			closed:   make(chan struct{}),
+			stats:    new(clientStats),
 		},
 
 		ext: make(map[string]string),
@@ -245,6 +592,14 @@ func NewClientPipe(rd io.Reader, wr io.WriteCloser, opts ...ClientOption) (*Clie
 		}
 	}()
 
+	if sftp.keepalive > 0 {
+		sftp.clientConn.wg.Add(1)
+		go func() {
+			defer sftp.clientConn.wg.Done()
+			sftp.keepaliveLoop()
+		}()
+	}
+
 	return sftp, nil
 }
 
@@ -257,17 +612,80 @@ func NewClientPipe(rd io.Reader, wr io.WriteCloser, opts ...ClientOption) (*Clie
 // read/write at the same time. For those services you will need to use
 // `client.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_TRUNC)`.
 func (c *Client) Create(path string) (*File, error) {
-	return c.open(path, toPflags(os.O_RDWR|os.O_CREATE|os.O_TRUNC))
+	return c.CreateContext(context.Background(), path)
+}
+
+// CreateContext is Create, which returns the error of the context once it is done.
+func (c *Client) CreateContext(ctx context.Context, path string) (*File, error) {
+	return c.open(ctx, path, toPflags(os.O_RDWR|os.O_CREATE|os.O_TRUNC))
 }
 
 const sftpProtocolVersion = 3 // https://filezilla-project.org/specs/draft-ietf-secsh-filexfer-02.txt
 
 func (c *Client) sendInit() error {
+	version := uint32(sftpProtocolVersion) // https://filezilla-project.org/specs/draft-ietf-secsh-filexfer-02.txt
+	if c.advertisedVersion != 0 {
+		version = c.advertisedVersion
+	}
+
 	return c.clientConn.conn.sendPacket(&sshFxInitPacket{
-		Version: sftpProtocolVersion, // https://filezilla-project.org/specs/draft-ietf-secsh-filexfer-02.txt
+		Version:    version,
+		Extensions: c.initExtensions,
 	})
 }
 
+// sendPacket applies any path conversion to the packet, before sending it on the underlying clientConn.
+func (c *Client) sendPacket(ctx context.Context, ch chan result, p idmarshaler) (byte, []byte, error) {
+	if c.convertPath != nil {
+		for _, path := range packetPaths(p) {
+			*path = c.convertPath(*path)
+		}
+	}
+
+	if cap(ch) < 1 {
+		ch = make(chan result, 1)
+	}
+
+	c.dispatchRequest(ctx, ch, p)
+
+	var typ byte
+	var data []byte
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case s := <-ch:
+		typ, data, err = s.typ, s.data, s.err
+	}
+
+	if err != nil && err == ctx.Err() {
+		c.cancelRequest(p.id())
+	}
+	return typ, data, err
+}
+
+// cancelRequest asks the server to abandon the outstanding request id,
+// if the server supports the "cancel@pkg.sftp" extension.
+// The response to the cancellation is not waited for.
+func (c *Client) cancelRequest(id uint32) {
+	if _, ok := c.HasExtension("cancel@pkg.sftp"); !ok {
+		return
+	}
+
+	// The cancellation is not held to the limit on requests in flight,
+	// as the request it cancels already holds a slot.
+	c.clientConn.dispatchRequest(make(chan result, 1), &sshFxpCancelPacket{
+		ID:        c.nextID(),
+		RequestID: id,
+	})
+}
+
+// dispatchRequest sends the request p, whose response is to be delivered on ch,
+// within the limit on requests in flight of a Client returned by WithLimits.
+func (c *Client) dispatchRequest(ctx context.Context, ch chan<- result, p idmarshaler) {
+	c.clientConn.dispatchRequestLimited(ctx, ch, p, c.inflightLimit)
+}
+
 // returns the next value of c.nextid
 func (c *Client) nextID() uint32 {
 	return atomic.AddUint32(&c.nextid, 1)
@@ -292,10 +710,7 @@ func (c *Client) recvVersion() error {
 		return err
 	}
 
-	if version != sftpProtocolVersion {
-		return &unexpectedVersionErr{sftpProtocolVersion, version}
-	}
-
+	var exts []*sshfx.ExtensionPair
 	for len(data) > 0 {
 		var ext extensionPair
 		ext, data, err = unmarshalExtensionPair(data)
@@ -303,8 +718,12 @@ func (c *Client) recvVersion() error {
 			return err
 		}
 		c.ext[ext.Name] = ext.Data
+		exts = append(exts, &sshfx.ExtensionPair{Name: ext.Name, Data: ext.Data})
 	}
 
+	if version != sftpProtocolVersion {
+		return c.negotiateVersion(version, exts)
+	}
 	return nil
 }
 
@@ -317,6 +736,66 @@ func (c *Client) HasExtension(name string) (string, bool) {
 	return data, ok
 }
 
+// Extensions returns the extensions advertised by the server,
+// mapped to their extension data (typically a version number).
+// The returned map is a copy, and may be modified by the caller.
+func (c *Client) Extensions() map[string]string {
+	exts := make(map[string]string, len(c.ext))
+	for name, data := range c.ext {
+		exts[name] = data
+	}
+	return exts
+}
+
+// EchoedExtensions returns the extensions sent with WithInitExtension which the server also advertised,
+// mapped to the extension data of the server.
+// The returned map is a copy, and may be modified by the caller.
+func (c *Client) EchoedExtensions() map[string]string {
+	exts := make(map[string]string)
+	for _, ext := range c.initExtensions {
+		if data, ok := c.ext[ext.Name]; ok {
+			exts[ext.Name] = data
+		}
+	}
+	return exts
+}
+
+// Extended sends an SSH_FXP_EXTENDED request for the named extension,
+// followed by the request-specific data, which must already be encoded in the SFTP wire format.
+// This allows calling vendor extensions that this package does not implement.
+//
+// If the server answers with SSH_FXP_EXTENDED_REPLY, the reply-specific data following the request id is returned.
+// If it answers with SSH_FXP_STATUS, a nil slice is returned, along with the error, if the status is not SSH_FX_OK.
+//
+// Extended does not check that the server advertises the extension, see HasExtension.
+func (c *Client) Extended(ctx context.Context, name string, data []byte) ([]byte, error) {
+	id := c.nextID()
+	typ, reply, err := c.sendPacket(ctx, nil, &sshFxpExtendedRawPacket{
+		ID:              id,
+		ExtendedRequest: name,
+		Data:            data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case sshFxpStatus:
+		return nil, c.statusError(id, reply)
+	case sshFxpExtendedReply:
+		sid, reply, err := unmarshalUint32Safe(reply)
+		if err != nil {
+			return nil, err
+		}
+		if sid != id {
+			return nil, &unexpectedIDErr{id, sid}
+		}
+		return reply, nil
+	default:
+		return nil, unimplementedPacketErr(typ)
+	}
+}
+
 // Walk returns a new Walker rooted at root.
 func (c *Client) Walk(root string) *fs.Walker {
 	return fs.WalkFS(root, c)
@@ -324,6 +803,8 @@ func (c *Client) Walk(root string) *fs.Walker {
 
 // ReadDir reads the directory named by p
 // and returns a list of directory entries.
+// The entries are returned in the order the server sent them, and are not sorted,
+// callers wanting them ordered by name should sort them.
 func (c *Client) ReadDir(p string) ([]os.FileInfo, error) {
 	return c.ReadDirContext(context.Background(), p)
 }
@@ -332,30 +813,45 @@ func (c *Client) ReadDir(p string) ([]os.FileInfo, error) {
 // and returns a list of directory entries.
 // The passed context can be used to cancel the operation
 // returning all entries listed up to the cancellation.
+// As with ReadDir, the entries are returned in the order the server sent them.
 func (c *Client) ReadDirContext(ctx context.Context, p string) ([]os.FileInfo, error) {
+	var entries []os.FileInfo
+	err := c.ReadDirStream(ctx, p, func(fi os.FileInfo) error {
+		entries = append(entries, fi)
+		return nil
+	})
+	return entries, err
+}
+
+// ReadDirStream reads the directory named by p, and calls fn with each directory entry.
+// Entries are delivered in the order the server returns them, without being accumulated or sorted,
+// so that directories with millions of entries can be listed in bounded memory.
+// The "." and ".." entries are skipped.
+//
+// If fn returns an error, reading stops, and that error is returned.
+// The passed context can be used to cancel the operation.
+func (c *Client) ReadDirStream(ctx context.Context, p string, fn func(os.FileInfo) error) error {
 	handle, err := c.opendir(ctx, p)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer c.close(handle) // this has to defer earlier than the lock below
-	var entries []os.FileInfo
-	var done = false
-	for !done {
+
+	for {
 		id := c.nextID()
-		typ, data, err1 := c.sendPacket(ctx, nil, &sshFxpReaddirPacket{
+		typ, data, err := c.sendPacket(ctx, nil, &sshFxpReaddirPacket{
 			ID:     id,
 			Handle: handle,
 		})
-		if err1 != nil {
-			err = err1
-			done = true
-			break
+		if err != nil {
+			return err
 		}
+
 		switch typ {
 		case sshFxpName:
 			sid, data := unmarshalUint32(data)
 			if sid != id {
-				return nil, &unexpectedIDErr{id, sid}
+				return &unexpectedIDErr{id, sid}
 			}
 			count, data := unmarshalUint32(data)
 			for i := uint32(0); i < count; i++ {
@@ -363,27 +859,27 @@ func (c *Client) ReadDirContext(ctx context.Context, p string) ([]os.FileInfo, e
 				filename, data = unmarshalString(data)
 				_, data = unmarshalString(data) // discard longname
 				var attr *FileStat
-				attr, data, err = unmarshalAttrs(data)
+				attr, data, err = unmarshalReceivedAttrs(data, false)
 				if err != nil {
-					return nil, err
+					return err
 				}
 				if filename == "." || filename == ".." {
 					continue
 				}
-				entries = append(entries, fileInfoFromStat(attr, path.Base(filename)))
+				if err := fn(fileInfoFromStat(attr, path.Base(filename))); err != nil {
+					return err
+				}
 			}
 		case sshFxpStatus:
-			// TODO(dfc) scope warning!
-			err = normaliseError(unmarshalStatus(id, data))
-			done = true
+			err := c.statusError(id, data)
+			if err == io.EOF {
+				err = nil
+			}
+			return err
 		default:
-			return nil, unimplementedPacketErr(typ)
+			return unimplementedPacketErr(typ)
 		}
 	}
-	if err == io.EOF {
-		err = nil
-	}
-	return entries, err
 }
 
 func (c *Client) opendir(ctx context.Context, path string) (string, error) {
@@ -397,14 +893,9 @@ func (c *Client) opendir(ctx context.Context, path string) (string, error) {
 	}
 	switch typ {
 	case sshFxpHandle:
-		sid, data := unmarshalUint32(data)
-		if sid != id {
-			return "", &unexpectedIDErr{id, sid}
-		}
-		handle, _ := unmarshalString(data)
-		return handle, nil
+		return c.unmarshalHandle(id, data)
 	case sshFxpStatus:
-		return "", normaliseError(unmarshalStatus(id, data))
+		return "", c.statusError(id, data)
 	default:
 		return "", unimplementedPacketErr(typ)
 	}
@@ -413,7 +904,12 @@ func (c *Client) opendir(ctx context.Context, path string) (string, error) {
 // Stat returns a FileInfo structure describing the file specified by path 'p'.
 // If 'p' is a symbolic link, the returned FileInfo structure describes the referent file.
 func (c *Client) Stat(p string) (os.FileInfo, error) {
-	fs, err := c.stat(p)
+	return c.StatContext(context.Background(), p)
+}
+
+// StatContext is Stat, which returns the error of the context once it is done.
+func (c *Client) StatContext(ctx context.Context, p string) (os.FileInfo, error) {
+	fs, err := c.stat(ctx, p)
 	if err != nil {
 		return nil, err
 	}
@@ -423,8 +919,13 @@ func (c *Client) Stat(p string) (os.FileInfo, error) {
 // Lstat returns a FileInfo structure describing the file specified by path 'p'.
 // If 'p' is a symbolic link, the returned FileInfo structure describes the symbolic link.
 func (c *Client) Lstat(p string) (os.FileInfo, error) {
+	return c.LstatContext(context.Background(), p)
+}
+
+// LstatContext is Lstat, which returns the error of the context once it is done.
+func (c *Client) LstatContext(ctx context.Context, p string) (os.FileInfo, error) {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpLstatPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpLstatPacket{
 		ID:   id,
 		Path: p,
 	})
@@ -437,14 +938,79 @@ func (c *Client) Lstat(p string) (os.FileInfo, error) {
 		if sid != id {
 			return nil, &unexpectedIDErr{id, sid}
 		}
-		attr, _, err := unmarshalAttrs(data)
+		attr, _, err := unmarshalReceivedAttrs(data, true)
 		if err != nil {
 			// avoid returning a valid value from fileInfoFromStats if err != nil.
 			return nil, err
 		}
 		return fileInfoFromStat(attr, path.Base(p)), nil
 	case sshFxpStatus:
-		return nil, normaliseError(unmarshalStatus(id, data))
+		return nil, c.statusError(id, data)
+	default:
+		return nil, unimplementedPacketErr(typ)
+	}
+}
+
+// Exists reports whether the file specified by path 'p' exists, with a single SSH_FXP_STAT.
+// If 'p' is a symbolic link, it reports whether the referent file exists.
+//
+// A status of SSH_FX_NO_SUCH_FILE is reported as false, without an error,
+// so that callers need not inspect the error of Stat.
+// Any other failure, such as SSH_FX_PERMISSION_DENIED, is returned as an error.
+func (c *Client) Exists(p string) (bool, error) {
+	return c.ExistsContext(context.Background(), p)
+}
+
+// ExistsContext is Exists, which returns the error of the context once it is done.
+func (c *Client) ExistsContext(ctx context.Context, p string) (bool, error) {
+	fs, err := c.statExists(ctx, p)
+	return fs != nil, err
+}
+
+// IsDir reports whether the file specified by path 'p' exists, and is a directory,
+// with a single SSH_FXP_STAT, in the same way as Exists.
+func (c *Client) IsDir(p string) (bool, error) {
+	return c.IsDirContext(context.Background(), p)
+}
+
+// IsDirContext is IsDir, which returns the error of the context once it is done.
+func (c *Client) IsDirContext(ctx context.Context, p string) (bool, error) {
+	fs, err := c.statExists(ctx, p)
+	if fs == nil {
+		return false, err
+	}
+	return fs.FileMode().IsDir(), nil
+}
+
+// statExists returns the attributes of the file at path, or nil, without an error, if it does not exist.
+func (c *Client) statExists(ctx context.Context, path string) (*FileStat, error) {
+	id := c.nextID()
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpStatPacket{
+		ID:   id,
+		Path: path,
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case sshFxpAttrs:
+		sid, data := unmarshalUint32(data)
+		if sid != id {
+			return nil, &unexpectedIDErr{id, sid}
+		}
+		attr, _, err := unmarshalReceivedAttrs(data, true)
+		if err != nil {
+			return nil, err
+		}
+		return attr, nil
+	case sshFxpStatus:
+		// check the code before decoding the whole status, which is then only needed as an error.
+		if sid, rest := unmarshalUint32(data); sid == id && len(rest) >= 4 {
+			if code, _ := unmarshalUint32(rest); code == sshFxNoSuchFile {
+				return nil, nil
+			}
+		}
+		return nil, c.statusError(id, data)
 	default:
 		return nil, unimplementedPacketErr(typ)
 	}
@@ -452,8 +1018,13 @@ func (c *Client) Lstat(p string) (os.FileInfo, error) {
 
 // ReadLink reads the target of a symbolic link.
 func (c *Client) ReadLink(p string) (string, error) {
+	return c.ReadLinkContext(context.Background(), p)
+}
+
+// ReadLinkContext is ReadLink, which returns the error of the context once it is done.
+func (c *Client) ReadLinkContext(ctx context.Context, p string) (string, error) {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpReadlinkPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpReadlinkPacket{
 		ID:   id,
 		Path: p,
 	})
@@ -473,7 +1044,7 @@ func (c *Client) ReadLink(p string) (string, error) {
 		filename, _ := unmarshalString(data) // ignore dummy attributes
 		return filename, nil
 	case sshFxpStatus:
-		return "", normaliseError(unmarshalStatus(id, data))
+		return "", c.statusError(id, data)
 	default:
 		return "", unimplementedPacketErr(typ)
 	}
@@ -481,8 +1052,13 @@ func (c *Client) ReadLink(p string) (string, error) {
 
 // Link creates a hard link at 'newname', pointing at the same inode as 'oldname'
 func (c *Client) Link(oldname, newname string) error {
+	return c.LinkContext(context.Background(), oldname, newname)
+}
+
+// LinkContext is Link, which returns the error of the context once it is done.
+func (c *Client) LinkContext(ctx context.Context, oldname, newname string) error {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpHardlinkPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpHardlinkPacket{
 		ID:      id,
 		Oldpath: oldname,
 		Newpath: newname,
@@ -492,26 +1068,64 @@ func (c *Client) Link(oldname, newname string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
 }
 
+// Ping sends a no-op request to the server using the "ping@pkg.sftp" extension,
+// and returns the time taken for the server to respond.
+// This measures the round-trip time of the SFTP layer,
+// independently of any SSH-level keepalives.
+//
+// Servers that do not support the extension will return an error.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	id := c.nextID()
+	start := time.Now()
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpPingPacket{
+		ID: id,
+	})
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	switch typ {
+	case sshFxpStatus:
+		if err := c.statusError(id, data); err != nil {
+			return 0, err
+		}
+		return rtt, nil
+	default:
+		return 0, unimplementedPacketErr(typ)
+	}
+}
+
 // Symlink creates a symbolic link at 'newname', pointing at target 'oldname'
 func (c *Client) Symlink(oldname, newname string) error {
-	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpSymlinkPacket{
-		ID:         id,
+	return c.SymlinkContext(context.Background(), oldname, newname)
+}
+
+// SymlinkContext is Symlink, which returns the error of the context once it is done.
+func (c *Client) SymlinkContext(ctx context.Context, oldname, newname string) error {
+	pkt := &sshFxpSymlinkPacket{
+		ID:         c.nextID(),
 		Linkpath:   newname,
 		Targetpath: oldname,
-	})
+	}
+	if c.compat.SymlinkSpecOrder {
+		// sshFxpSymlinkPacket marshals in the OpenSSH order, so swap the fields to get the specification order.
+		pkt.Linkpath, pkt.Targetpath = pkt.Targetpath, pkt.Linkpath
+	}
+
+	id := pkt.ID
+	typ, data, err := c.sendPacket(ctx, nil, pkt)
 	if err != nil {
 		return err
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
@@ -530,16 +1144,16 @@ func (c *Client) fsetstat(handle string, flags uint32, attrs interface{}) error
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
 }
 
 // setstat is a convience wrapper to allow for changing of various parts of the file descriptor.
-func (c *Client) setstat(path string, flags uint32, attrs interface{}) error {
+func (c *Client) setstat(ctx context.Context, path string, flags uint32, attrs interface{}) error {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpSetstatPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpSetstatPacket{
 		ID:    id,
 		Path:  path,
 		Flags: flags,
@@ -550,7 +1164,7 @@ func (c *Client) setstat(path string, flags uint32, attrs interface{}) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
@@ -558,22 +1172,32 @@ func (c *Client) setstat(path string, flags uint32, attrs interface{}) error {
 
 // Chtimes changes the access and modification times of the named file.
 func (c *Client) Chtimes(path string, atime time.Time, mtime time.Time) error {
+	return c.ChtimesContext(context.Background(), path, atime, mtime)
+}
+
+// ChtimesContext is Chtimes, which returns the error of the context once it is done.
+func (c *Client) ChtimesContext(ctx context.Context, path string, atime time.Time, mtime time.Time) error {
 	type times struct {
 		Atime uint32
 		Mtime uint32
 	}
 	attrs := times{uint32(atime.Unix()), uint32(mtime.Unix())}
-	return c.setstat(path, sshFileXferAttrACmodTime, attrs)
+	return c.setstat(ctx, path, sshFileXferAttrACmodTime, attrs)
 }
 
 // Chown changes the user and group owners of the named file.
 func (c *Client) Chown(path string, uid, gid int) error {
+	return c.ChownContext(context.Background(), path, uid, gid)
+}
+
+// ChownContext is Chown, which returns the error of the context once it is done.
+func (c *Client) ChownContext(ctx context.Context, path string, uid, gid int) error {
 	type owner struct {
 		UID uint32
 		GID uint32
 	}
 	attrs := owner{uint32(uid), uint32(gid)}
-	return c.setstat(path, sshFileXferAttrUIDGID, attrs)
+	return c.setstat(ctx, path, sshFileXferAttrUIDGID, attrs)
 }
 
 // Chmod changes the permissions of the named file.
@@ -582,7 +1206,39 @@ func (c *Client) Chown(path string, uid, gid int) error {
 // possible in a portable way without causing a race condition. Callers
 // should mask off umask bits, if desired.
 func (c *Client) Chmod(path string, mode os.FileMode) error {
-	return c.setstat(path, sshFileXferAttrPermissions, toChmodPerm(mode))
+	return c.ChmodContext(context.Background(), path, mode)
+}
+
+// ChmodContext is Chmod, which returns the error of the context once it is done.
+func (c *Client) ChmodContext(ctx context.Context, path string, mode os.FileMode) error {
+	return c.setstat(ctx, path, sshFileXferAttrPermissions, toChmodPerm(mode))
+}
+
+// ChmodSymbolic changes the permissions of the named file,
+// according to a chmod(1) style symbolic mode, such as "u+rwx,g-w",
+// which is applied relative to the current permissions of the file.
+// An octal mode, such as "0755", is also accepted.
+//
+// The current permissions are retrieved, modified and set again within a single call,
+// but as SFTP provides no locking, a concurrent change by another client may be lost.
+// As with Chmod, no umask is applied.
+func (c *Client) ChmodSymbolic(path, mode string) error {
+	return c.ChmodSymbolicContext(context.Background(), path, mode)
+}
+
+// ChmodSymbolicContext is ChmodSymbolic, which returns the error of the context once it is done.
+func (c *Client) ChmodSymbolicContext(ctx context.Context, path, mode string) error {
+	fi, err := c.StatContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	perm, err := parseSymbolicMode(mode, fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	return c.ChmodContext(ctx, path, perm)
 }
 
 // Truncate sets the size of the named file. Although it may be safely assumed
@@ -590,7 +1246,12 @@ func (c *Client) Chmod(path string, mode os.FileMode) error {
 // the SFTP protocol does not specify what behavior the server should do when setting
 // size greater than the current size.
 func (c *Client) Truncate(path string, size int64) error {
-	return c.setstat(path, sshFileXferAttrSize, uint64(size))
+	return c.TruncateContext(context.Background(), path, size)
+}
+
+// TruncateContext is Truncate, which returns the error of the context once it is done.
+func (c *Client) TruncateContext(ctx context.Context, path string, size int64) error {
+	return c.setstat(ctx, path, sshFileXferAttrSize, uint64(size))
 }
 
 // SetExtendedData sets extended attributes of the named file. It uses the
@@ -601,51 +1262,112 @@ func (c *Client) Truncate(path string, size int64) error {
 // is a valid, registered domain name and "name" identifies the method. Server
 // implementations SHOULD ignore extended data fields that they do not understand.
 func (c *Client) SetExtendedData(path string, extended []StatExtended) error {
+	return c.SetExtendedDataContext(context.Background(), path, extended)
+}
+
+// SetExtendedDataContext is SetExtendedData, which returns the error of the context once it is done.
+func (c *Client) SetExtendedDataContext(ctx context.Context, path string, extended []StatExtended) error {
 	attrs := &FileStat{
 		Extended: extended,
 	}
-	return c.setstat(path, sshFileXferAttrExtended, attrs)
+	return c.setstat(ctx, path, sshFileXferAttrExtended, attrs)
+}
+
+// SetStat sets the attributes of the named file to those of fi, in a single SSH_FXP_SETSTAT.
+// If fi was returned by the Client, such as by Stat, exactly the attributes the server sent are set,
+// including any of later versions of the protocol, or of vendors, which are sent back unchanged.
+// Otherwise the size, permissions and times of fi are set, as for a FileInfo returned by the Handlers of a RequestServer,
+// along with its uid and gid, and extended attributes, if it has them.
+func (c *Client) SetStat(path string, fi os.FileInfo) error {
+	return c.SetStatContext(context.Background(), path, fi)
+}
+
+// SetStatContext is SetStat, which returns the error of the context once it is done.
+func (c *Client) SetStatContext(ctx context.Context, path string, fi os.FileInfo) error {
+	flags, fs := fileStatFromInfo(fi)
+	return c.setstat(ctx, path, flags, fs)
 }
 
 // Open opens the named file for reading. If successful, methods on the
 // returned file can be used for reading; the associated file descriptor
 // has mode O_RDONLY.
 func (c *Client) Open(path string) (*File, error) {
-	return c.open(path, toPflags(os.O_RDONLY))
+	return c.OpenContext(context.Background(), path)
+}
+
+// OpenContext is Open, which returns the error of the context once it is done.
+func (c *Client) OpenContext(ctx context.Context, path string) (*File, error) {
+	return c.open(ctx, path, toPflags(os.O_RDONLY))
 }
 
 // OpenFile is the generalized open call; most users will use Open or
 // Create instead. It opens the named file with specified flag (O_RDONLY
 // etc.). If successful, methods on the returned File can be used for I/O.
 func (c *Client) OpenFile(path string, f int) (*File, error) {
-	return c.open(path, toPflags(f))
+	return c.OpenFileContext(context.Background(), path, f)
 }
 
-func (c *Client) open(path string, pflags uint32) (*File, error) {
-	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpOpenPacket{
-		ID:     id,
+// OpenFileContext is OpenFile, which returns the error of the context once it is done.
+func (c *Client) OpenFileContext(ctx context.Context, path string, f int) (*File, error) {
+	return c.open(ctx, path, toPflags(f))
+}
+
+func (c *Client) open(ctx context.Context, path string, pflags uint32) (*File, error) {
+	return c.openPacket(ctx, &sshFxpOpenPacket{
 		Path:   path,
 		Pflags: pflags,
 	})
+}
+
+// openPacket sends the SSH_FXP_OPEN pkt, with a new request id, and returns the File opened.
+func (c *Client) openPacket(ctx context.Context, pkt *sshFxpOpenPacket) (*File, error) {
+	id := c.nextID()
+	pkt.ID = id
+	typ, data, err := c.sendPacket(ctx, nil, pkt)
 	if err != nil {
 		return nil, err
 	}
 	switch typ {
 	case sshFxpHandle:
-		sid, data := unmarshalUint32(data)
-		if sid != id {
-			return nil, &unexpectedIDErr{id, sid}
+		handle, err := c.unmarshalHandle(id, data)
+		if err != nil {
+			return nil, err
 		}
-		handle, _ := unmarshalString(data)
-		return &File{c: c, path: path, handle: handle}, nil
+		return &File{c: c, path: pkt.Path, handle: handle, writable: pkt.Pflags&sshFxfWrite != 0}, nil
 	case sshFxpStatus:
-		return nil, normaliseError(unmarshalStatus(id, data))
+		return nil, c.statusError(id, data)
 	default:
 		return nil, unimplementedPacketErr(typ)
 	}
 }
 
+// unmarshalHandle decodes the handle from the SSH_FXP_HANDLE response to the request id,
+// and checks that it is not empty, and no longer than the specification allows.
+// An overlong handle is closed, as it would otherwise be leaked.
+func (c *Client) unmarshalHandle(id uint32, data []byte) (string, error) {
+	sid, data, err := unmarshalUint32Safe(data)
+	if err != nil {
+		return "", err
+	}
+	if sid != id {
+		return "", &unexpectedIDErr{id, sid}
+	}
+
+	handle, _, err := unmarshalStringSafe(data)
+	if err != nil {
+		return "", err
+	}
+
+	if handle == "" || len(handle) > maxHandleLength && !c.compat.LongHandles {
+		if handle != "" {
+			_ = c.close(handle)
+		}
+		return "", &invalidHandleErr{length: len(handle)}
+	}
+
+	return handle, nil
+}
+
 // close closes a handle handle previously returned in the response
 // to SSH_FXP_OPEN or SSH_FXP_OPENDIR. The handle becomes invalid
 // immediately after this request has been sent.
@@ -660,15 +1382,15 @@ func (c *Client) close(handle string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
 }
 
-func (c *Client) stat(path string) (*FileStat, error) {
+func (c *Client) stat(ctx context.Context, path string) (*FileStat, error) {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpStatPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpStatPacket{
 		ID:   id,
 		Path: path,
 	})
@@ -681,10 +1403,10 @@ func (c *Client) stat(path string) (*FileStat, error) {
 		if sid != id {
 			return nil, &unexpectedIDErr{id, sid}
 		}
-		attr, _, err := unmarshalAttrs(data)
+		attr, _, err := unmarshalReceivedAttrs(data, true)
 		return attr, err
 	case sshFxpStatus:
-		return nil, normaliseError(unmarshalStatus(id, data))
+		return nil, c.statusError(id, data)
 	default:
 		return nil, unimplementedPacketErr(typ)
 	}
@@ -705,10 +1427,10 @@ func (c *Client) fstat(handle string) (*FileStat, error) {
 		if sid != id {
 			return nil, &unexpectedIDErr{id, sid}
 		}
-		attr, _, err := unmarshalAttrs(data)
+		attr, _, err := unmarshalReceivedAttrs(data, true)
 		return attr, err
 	case sshFxpStatus:
-		return nil, normaliseError(unmarshalStatus(id, data))
+		return nil, c.statusError(id, data)
 	default:
 		return nil, unimplementedPacketErr(typ)
 	}
@@ -719,9 +1441,14 @@ func (c *Client) fstat(handle string) (*FileStat, error) {
 // It implements the statvfs@openssh.com SSH_FXP_EXTENDED feature
 // from http://www.opensource.apple.com/source/OpenSSH/OpenSSH-175/openssh/PROTOCOL?txt.
 func (c *Client) StatVFS(path string) (*StatVFS, error) {
+	return c.StatVFSContext(context.Background(), path)
+}
+
+// StatVFSContext is StatVFS, which returns the error of the context once it is done.
+func (c *Client) StatVFSContext(ctx context.Context, path string) (*StatVFS, error) {
 	// send the StatVFS packet to the server
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpStatvfsPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpStatvfsPacket{
 		ID:   id,
 		Path: path,
 	})
@@ -742,7 +1469,7 @@ func (c *Client) StatVFS(path string) (*StatVFS, error) {
 
 	// the resquest failed
 	case sshFxpStatus:
-		return nil, normaliseError(unmarshalStatus(id, data))
+		return nil, c.statusError(id, data)
 
 	default:
 		return nil, unimplementedPacketErr(typ)
@@ -758,25 +1485,30 @@ func (c *Client) Join(elem ...string) string { return path.Join(elem...) }
 // file or directory with the specified path exists, or if the specified directory
 // is not empty.
 func (c *Client) Remove(path string) error {
-	err := c.removeFile(path)
+	return c.RemoveContext(context.Background(), path)
+}
+
+// RemoveContext is Remove, which returns the error of the context once it is done.
+func (c *Client) RemoveContext(ctx context.Context, path string) error {
+	err := c.removeFile(ctx, path)
 	// some servers, *cough* osx *cough*, return EPERM, not ENODIR.
 	// serv-u returns ssh_FX_FILE_IS_A_DIRECTORY
 	// EPERM is converted to os.ErrPermission so it is not a StatusError
 	if err, ok := err.(*StatusError); ok {
 		switch err.Code {
 		case sshFxFailure, sshFxFileIsADirectory:
-			return c.RemoveDirectory(path)
+			return c.RemoveDirectoryContext(ctx, path)
 		}
 	}
 	if os.IsPermission(err) {
-		return c.RemoveDirectory(path)
+		return c.RemoveDirectoryContext(ctx, path)
 	}
 	return err
 }
 
-func (c *Client) removeFile(path string) error {
+func (c *Client) removeFile(ctx context.Context, path string) error {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpRemovePacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpRemovePacket{
 		ID:       id,
 		Filename: path,
 	})
@@ -785,7 +1517,7 @@ func (c *Client) removeFile(path string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
@@ -793,8 +1525,13 @@ func (c *Client) removeFile(path string) error {
 
 // RemoveDirectory removes a directory path.
 func (c *Client) RemoveDirectory(path string) error {
+	return c.RemoveDirectoryContext(context.Background(), path)
+}
+
+// RemoveDirectoryContext is RemoveDirectory, which returns the error of the context once it is done.
+func (c *Client) RemoveDirectoryContext(ctx context.Context, path string) error {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpRmdirPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpRmdirPacket{
 		ID:   id,
 		Path: path,
 	})
@@ -803,16 +1540,27 @@ func (c *Client) RemoveDirectory(path string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
 }
 
 // Rename renames a file.
+// If the new name is on another filesystem of the server, see WithRenameFallbackCopy.
 func (c *Client) Rename(oldname, newname string) error {
+	return c.RenameContext(context.Background(), oldname, newname)
+}
+
+// RenameContext is Rename, which returns the error of the context once it is done.
+func (c *Client) RenameContext(ctx context.Context, oldname, newname string) error {
+	if c.compat.RenameToSelf && oldname == newname {
+		_, err := c.LstatContext(ctx, oldname)
+		return err
+	}
+
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpRenamePacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpRenamePacket{
 		ID:      id,
 		Oldpath: oldname,
 		Newpath: newname,
@@ -822,7 +1570,11 @@ func (c *Client) Rename(oldname, newname string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		err := c.statusError(id, data)
+		if err != nil && c.renameFallbackCopy && isCrossDeviceError(err) {
+			return c.renameByCopy(oldname, newname, err)
+		}
+		return err
 	default:
 		return unimplementedPacketErr(typ)
 	}
@@ -830,9 +1582,25 @@ func (c *Client) Rename(oldname, newname string) error {
 
 // PosixRename renames a file using the posix-rename@openssh.com extension
 // which will replace newname if it already exists.
+//
+// If the server does not advertise the extension, the request is not sent,
+// and the error is a *StatusError of SSH_FX_OP_UNSUPPORTED, matching ErrSSHFxOpUnsupported,
+// rather than falling back to Rename, which would not replace newname atomically.
 func (c *Client) PosixRename(oldname, newname string) error {
+	return c.PosixRenameContext(context.Background(), oldname, newname)
+}
+
+// PosixRenameContext is PosixRename, which returns the error of the context once it is done.
+func (c *Client) PosixRenameContext(ctx context.Context, oldname, newname string) error {
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); !ok {
+		return &StatusError{
+			Code: sshFxOPUnsupported,
+			msg:  "posix-rename@openssh.com is not supported by the server",
+		}
+	}
+
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpPosixRenamePacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpPosixRenamePacket{
 		ID:      id,
 		Oldpath: oldname,
 		Newpath: newname,
@@ -842,7 +1610,7 @@ func (c *Client) PosixRename(oldname, newname string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
@@ -853,14 +1621,91 @@ func (c *Client) PosixRename(oldname, newname string) error {
 // This is useful for converting path names containing ".." components,
 // or relative pathnames without a leading slash into absolute paths.
 func (c *Client) RealPath(path string) (string, error) {
+	return c.RealPathContext(context.Background(), path)
+}
+
+// RealPathContext is RealPath, which returns the error of the context once it is done.
+func (c *Client) RealPathContext(ctx context.Context, path string) (string, error) {
+	if c.compat.RealPathDot && path == "" {
+		path = "."
+	}
+
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpRealpathPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpRealpathPacket{
 		ID:   id,
 		Path: path,
 	})
 	if err != nil {
 		return "", err
 	}
+	return unmarshalRealPath(id, typ, data)
+}
+
+// RealPaths resolves each of the paths, in the same way as RealPath,
+// but with up to MaxInflight requests outstanding at once,
+// so that resolving many paths is not dominated by the round trip time.
+//
+// The resolved paths are returned in the same order as paths.
+// If any path fails to resolve, an *os.PathError is returned for the first such path,
+// alongside all the paths, with those which failed left empty.
+func (c *Client) RealPaths(paths []string) ([]string, error) {
+	resolved := make([]string, len(paths))
+	errs := make([]error, len(paths))
+
+	window := c.MaxInflight()
+	if window < 1 {
+		window = 1
+	}
+
+	ch := make(chan result, window)
+	pending := make(map[uint32]int, window) // request id -> index in paths
+
+	var next int
+	for next < len(paths) || len(pending) > 0 {
+		for next < len(paths) && len(pending) < window {
+			path := paths[next]
+			if c.compat.RealPathDot && path == "" {
+				path = "."
+			}
+			if c.convertPath != nil {
+				path = c.convertPath(path)
+			}
+
+			id := c.nextID()
+			pending[id] = next
+			c.dispatchRequest(context.Background(), ch, &sshFxpRealpathPacket{
+				ID:   id,
+				Path: path,
+			})
+			next++
+		}
+
+		// the channel has room for every outstanding response, so returning early cannot block the connection.
+		s := <-ch
+		if s.err != nil {
+			return nil, s.err
+		}
+
+		sid, _ := unmarshalUint32(s.data)
+		i, ok := pending[sid]
+		if !ok {
+			return nil, fmt.Errorf("sftp: realpath: unexpected response id %d", sid)
+		}
+		delete(pending, sid)
+
+		resolved[i], errs[i] = unmarshalRealPath(sid, s.typ, s.data)
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			return resolved, &os.PathError{Op: "realpath", Path: paths[i], Err: err}
+		}
+	}
+	return resolved, nil
+}
+
+// unmarshalRealPath returns the path in the response to the SSH_FXP_REALPATH request id.
+func unmarshalRealPath(id uint32, typ byte, data []byte) (string, error) {
 	switch typ {
 	case sshFxpName:
 		sid, data := unmarshalUint32(data)
@@ -883,15 +1728,25 @@ func (c *Client) RealPath(path string) (string, error) {
 // Getwd returns the current working directory of the server. Operations
 // involving relative paths will be based at this location.
 func (c *Client) Getwd() (string, error) {
-	return c.RealPath(".")
+	return c.GetwdContext(context.Background())
+}
+
+// GetwdContext is Getwd, which returns the error of the context once it is done.
+func (c *Client) GetwdContext(ctx context.Context) (string, error) {
+	return c.RealPathContext(ctx, ".")
 }
 
 // Mkdir creates the specified directory. An error will be returned if a file or
 // directory with the specified path already exists, or if the directory's
 // parent folder does not exist (the method cannot create complete paths).
 func (c *Client) Mkdir(path string) error {
+	return c.MkdirContext(context.Background(), path)
+}
+
+// MkdirContext is Mkdir, which returns the error of the context once it is done.
+func (c *Client) MkdirContext(ctx context.Context, path string) error {
 	id := c.nextID()
-	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpMkdirPacket{
+	typ, data, err := c.sendPacket(ctx, nil, &sshFxpMkdirPacket{
 		ID:   id,
 		Path: path,
 	})
@@ -900,7 +1755,7 @@ func (c *Client) Mkdir(path string) error {
 	}
 	switch typ {
 	case sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return c.statusError(id, data)
 	default:
 		return unimplementedPacketErr(typ)
 	}
@@ -911,9 +1766,14 @@ func (c *Client) Mkdir(path string) error {
 // If path is already a directory, MkdirAll does nothing and returns nil.
 // If, while making any directory, that path is found to already be a regular file, an error is returned.
 func (c *Client) MkdirAll(path string) error {
+	return c.MkdirAllContext(context.Background(), path)
+}
+
+// MkdirAllContext is MkdirAll, which returns the error of the context once it is done.
+func (c *Client) MkdirAllContext(ctx context.Context, path string) error {
 	// Most of this code mimics https://golang.org/src/os/path.go?s=514:561#L13
 	// Fast path: if we can tell whether path is a directory or file, stop with success or error.
-	dir, err := c.Stat(path)
+	dir, err := c.StatContext(ctx, path)
 	if err == nil {
 		if dir.IsDir() {
 			return nil
@@ -934,18 +1794,18 @@ func (c *Client) MkdirAll(path string) error {
 
 	if j > 1 {
 		// Create parent
-		err = c.MkdirAll(path[0 : j-1])
+		err = c.MkdirAllContext(ctx, path[0:j-1])
 		if err != nil {
 			return err
 		}
 	}
 
 	// Parent now exists; invoke Mkdir and use its result.
-	err = c.Mkdir(path)
+	err = c.MkdirContext(ctx, path)
 	if err != nil {
 		// Handle arguments like "foo/." by
 		// double-checking that directory doesn't exist.
-		dir, err1 := c.Lstat(path)
+		dir, err1 := c.LstatContext(ctx, path)
 		if err1 == nil && dir.IsDir() {
 			return nil
 		}
@@ -954,6 +1814,97 @@ func (c *Client) MkdirAll(path string) error {
 	return nil
 }
 
+// MkdirAllOptions configures MkdirAllWithOptions.
+type MkdirAllOptions struct {
+	// RemoveOnError removes the directories already created, in reverse order,
+	// if a later component of the path cannot be created.
+	// This is best-effort: directories that cannot be removed are left in place.
+	RemoveOnError bool
+}
+
+// MkdirAllError is returned by MkdirAllWithOptions, and identifies the component of the path that could not be created.
+type MkdirAllError struct {
+	// Path is the directory that could not be created, or verified to exist.
+	Path string
+
+	// Depth is the number of components in Path, so that "/a/b/c" has a depth of 3.
+	Depth int
+
+	// Created lists the directories that were created before the failure, and that still exist.
+	Created []string
+
+	// Err is the underlying error, such as os.ErrPermission, or an *os.PathError wrapping syscall.ENOTDIR.
+	Err error
+}
+
+func (e *MkdirAllError) Error() string {
+	return fmt.Sprintf("sftp: mkdir all %s (depth %d): %v", e.Path, e.Depth, e.Err)
+}
+
+func (e *MkdirAllError) Unwrap() error {
+	return e.Err
+}
+
+// MkdirAllWithOptions creates a directory named path, along with any necessary parents, like MkdirAll,
+// and returns the directories it created, in order.
+// If a component cannot be created, a *MkdirAllError is returned, which identifies that component,
+// so that callers can distinguish a missing parent from a permission error deeper in the path.
+func (c *Client) MkdirAllWithOptions(path string, opts MkdirAllOptions) ([]string, error) {
+	var created []string
+
+	fail := func(dir string, depth int, err error) ([]string, error) {
+		if opts.RemoveOnError {
+			for len(created) > 0 {
+				last := created[len(created)-1]
+				if c.RemoveDirectory(last) != nil {
+					break
+				}
+				created = created[:len(created)-1]
+			}
+		}
+
+		return created, &MkdirAllError{
+			Path:    dir,
+			Depth:   depth,
+			Created: created,
+			Err:     err,
+		}
+	}
+
+	var depth int
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && path[i] != '/' {
+			continue
+		}
+		if i == 0 || path[i-1] == '/' { // skip the root, and empty components.
+			continue
+		}
+
+		dir := path[:i]
+		depth++
+
+		fi, err := c.Stat(dir)
+		if err == nil {
+			if !fi.IsDir() {
+				return fail(dir, depth, &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR})
+			}
+			continue
+		}
+
+		if err := c.Mkdir(dir); err != nil {
+			// Handle components like "." by double-checking that the directory doesn't exist.
+			if fi, err1 := c.Lstat(dir); err1 == nil && fi.IsDir() {
+				continue
+			}
+			return fail(dir, depth, err)
+		}
+
+		created = append(created, dir)
+	}
+
+	return created, nil
+}
+
 // RemoveAll delete files recursively in the directory and Recursively delete subdirectories.
 // An error will be returned if no file or directory with the specified path exists
 func (c *Client) RemoveAll(path string) error {
@@ -995,16 +1946,31 @@ func (c *Client) RemoveAll(path string) error {
 
 // File represents a remote file.
 type File struct {
+	transferred int64 // accessed atomically, see Progress.
+	expected    int64 // accessed atomically, see SetExpectedSize.
+
 	c    *Client
 	path string
 
-	mu     sync.RWMutex
-	handle string
-	offset int64 // current offset within remote file
+	mu       sync.RWMutex
+	handle   string
+	offset   int64 // current offset within remote file
+	writable bool  // opened with SSH_FXF_WRITE
+
+	verifyEnd int64 // if not zero, the size the file must have on Close, see UseWriteVerification.
+
+	progressMu sync.Mutex
+	onProgress func(FileProgress) // see OnProgress
 }
 
 // Close closes the File, rendering it unusable for I/O. It returns an
 // error, if any.
+//
+// If the Client was created with UseFsyncOnClose, and the File was opened for writing,
+// the File is first flushed to stable storage on the server, and any error from that flush is returned.
+//
+// If the Client was created with UseWriteVerification, and ReadFrom has written to the File,
+// the size of the file is checked again once it is closed, and a *WriteSizeError returned if the file is short.
 func (f *File) Close() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -1019,10 +1985,34 @@ func (f *File) Close() error {
 	// By invalidating our local copy of the handle,
 	// we ensure that there cannot be any erroneous use-after-close requests sent after Close.
 
+	var syncErr error
+	if f.c.fsyncOnClose && f.writable {
+		if _, ok := f.c.HasExtension("fsync@openssh.com"); ok {
+			syncErr = f.sync()
+		}
+	}
+
 	handle := f.handle
 	f.handle = ""
 
-	return f.c.close(handle)
+	if err := f.c.close(handle); err != nil {
+		return err
+	}
+	if syncErr != nil {
+		return syncErr
+	}
+
+	if f.verifyEnd > 0 {
+		// Some servers only fail to write the trailing data when the handle is closed, such as on exceeding a quota.
+		fs, err := f.c.stat(context.Background(), f.path)
+		if err != nil {
+			return err
+		}
+		if int64(fs.Size) < f.verifyEnd {
+			return &WriteSizeError{Path: f.path, Size: int64(fs.Size), Want: f.verifyEnd}
+		}
+	}
+	return nil
 }
 
 // Name returns the name of the file as presented to Open or Create.
@@ -1050,22 +2040,27 @@ func (f *File) Read(b []byte) (int, error) {
 
 // readChunkAt attempts to read the whole entire length of the buffer from the file starting at the offset.
 // It will continue progressively reading into the buffer until it fills the whole buffer, or an error occurs.
-func (f *File) readChunkAt(ch chan result, b []byte, off int64) (n int, err error) {
+func (f *File) readChunkAt(ctx context.Context, ch chan result, b []byte, off int64) (n int, err error) {
 	for err == nil && n < len(b) {
-		id := f.c.nextID()
-		typ, data, err := f.c.sendPacket(context.Background(), ch, &sshFxpReadPacket{
-			ID:     id,
+		p := &sshFxpReadPacket{
+			ID:     f.c.nextID(),
 			Handle: f.handle,
 			Offset: uint64(off) + uint64(n),
 			Len:    uint32(len(b) - n),
-		})
+		}
+		if n > 0 {
+			f.c.stats.retransmitted(p)
+		}
+
+		id := p.ID
+		typ, data, err := f.c.sendPacket(ctx, ch, p)
 		if err != nil {
 			return n, err
 		}
 
 		switch typ {
 		case sshFxpStatus:
-			return n, normaliseError(unmarshalStatus(id, data))
+			return n, f.c.readStatus(id, data)
 
 		case sshFxpData:
 			sid, data := unmarshalUint32(data)
@@ -1074,7 +2069,9 @@ func (f *File) readChunkAt(ch chan result, b []byte, off int64) (n int, err erro
 			}
 
 			l, data := unmarshalUint32(data)
-			n += copy(b[n:], data[:l])
+			m := copy(b[n:], data[:l])
+			n += m
+			f.advance(m)
 
 		default:
 			return n, unimplementedPacketErr(typ)
@@ -1087,10 +2084,10 @@ func (f *File) readChunkAt(ch chan result, b []byte, off int64) (n int, err erro
 func (f *File) readAtSequential(b []byte, off int64) (read int, err error) {
 	for read < len(b) {
 		rb := b[read:]
-		if len(rb) > f.c.maxPacket {
-			rb = rb[:f.c.maxPacket]
+		if chunkSize := f.c.readChunkSize(); len(rb) > chunkSize {
+			rb = rb[:chunkSize]
 		}
-		n, err := f.readChunkAt(nil, rb, off+int64(read))
+		n, err := f.readChunkAt(context.Background(), nil, rb, off+int64(read))
 		if n < 0 {
 			panic("sftp.File: returned negative count from readChunkAt")
 		}
@@ -1121,25 +2118,25 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 		return 0, os.ErrClosed
 	}
 
-	if len(b) <= f.c.maxPacket {
+	if len(b) <= f.c.readChunkSize() {
 		// This should be able to be serviced with 1/2 requests.
 		// So, just do it directly.
-		return f.readChunkAt(nil, b, off)
+		return f.readChunkAt(context.Background(), nil, b, off)
 	}
 
-	if f.c.disableConcurrentReads {
+	if f.c.disableConcurrentReads || f.c.compat.ShortReads {
 		return f.readAtSequential(b, off)
 	}
 
-	// Split the read into multiple maxPacket-sized concurrent reads bounded by maxConcurrentRequests.
+	// Split the read into multiple chunk-sized concurrent reads bounded by maxConcurrentRequests.
 	// This allows writes with a suitably large buffer to transfer data at a much faster rate
 	// by overlapping round trip times.
 
 	cancel := make(chan struct{})
 
-	concurrency := len(b)/f.c.maxPacket + 1
-	if concurrency > f.c.maxConcurrentRequests || concurrency < 1 {
-		concurrency = f.c.maxConcurrentRequests
+	concurrency := len(b)/f.c.readChunkSize() + 1
+	if concurrency > f.c.MaxInflight() || concurrency < 1 {
+		concurrency = f.c.MaxInflight()
 	}
 
 	resPool := newResChanPool(concurrency)
@@ -1153,13 +2150,13 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 	}
 	workCh := make(chan work)
 
-	// Slice: cut up the Read into any number of buffers of length <= f.c.maxPacket, and at appropriate offsets.
+	// Slice: cut up the Read into any number of buffers of length <= the read chunk size, and at appropriate offsets.
 	go func() {
 		defer close(workCh)
 
 		b := b
 		offset := off
-		chunkSize := f.c.maxPacket
+		chunkSize := f.c.readChunkSize()
 
 		for len(b) > 0 {
 			rb := b
@@ -1170,7 +2167,7 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 			id := f.c.nextID()
 			res := resPool.Get()
 
-			f.c.dispatchRequest(res, &sshFxpReadPacket{
+			f.c.dispatchRequest(context.Background(), res, &sshFxpReadPacket{
 				ID:     id,
 				Handle: f.handle,
 				Offset: uint64(offset),
@@ -1195,6 +2192,7 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 	errCh := make(chan rErr)
 
 	var wg sync.WaitGroup
+	workers := f.c.newInflightWorkers(concurrency)
 	wg.Add(concurrency)
 	for i := 0; i < concurrency; i++ {
 		// Map_i: each worker gets work, and then performs the Read into its buffer from its respective offset.
@@ -1211,7 +2209,7 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 				if err == nil {
 					switch s.typ {
 					case sshFxpStatus:
-						err = normaliseError(unmarshalStatus(packet.id, s.data))
+						err = f.c.readStatus(packet.id, s.data)
 
 					case sshFxpData:
 						sid, data := unmarshalUint32(s.data)
@@ -1221,6 +2219,7 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 						} else {
 							l, data := unmarshalUint32(data)
 							n = copy(packet.b, data[:l])
+							f.advance(n)
 
 							// For normal disk files, it is guaranteed that this will read
 							// the specified number of bytes, or up to end of file.
@@ -1242,6 +2241,11 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 					// DO NOT return.
 					// We want to ensure that workCh is drained before wg.Wait returns.
 				}
+
+				if workers.retire() {
+					// MaxInflight was lowered, and enough workers remain to drain the work.
+					return
+				}
 			}
 		}()
 	}
@@ -1277,12 +2281,16 @@ func (f *File) readAt(b []byte, off int64) (int, error) {
 }
 
 // writeToSequential implements WriteTo, but works sequentially with no parallelism.
-func (f *File) writeToSequential(w io.Writer) (written int64, err error) {
-	b := make([]byte, f.c.maxPacket)
+func (f *File) writeToSequential(ctx context.Context, w io.Writer) (written int64, err error) {
+	b := make([]byte, f.c.readChunkSize())
 	ch := make(chan result, 1) // reusable channel
 
 	for {
-		n, err := f.readChunkAt(ch, b, f.offset)
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := f.readChunkAt(ctx, ch, b, f.offset)
 		if n < 0 {
 			panic("sftp.File: returned negative count from readChunkAt")
 		}
@@ -1319,12 +2327,28 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	return f.writeTo(context.Background(), w)
+}
+
+// WriteToContext is WriteTo, which stops once the context is done, and returns the error of the context.
+// The requests still in flight are abandoned, and cancelled if the server supports it.
+//
+// The number of bytes written to w is returned, and the offset of the file is left just past them,
+// so that a later WriteTo continues from there.
+func (f *File) WriteToContext(ctx context.Context, w io.Writer) (written int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.writeTo(ctx, w)
+}
+
+func (f *File) writeTo(ctx context.Context, w io.Writer) (written int64, err error) {
 	if f.handle == "" {
 		return 0, os.ErrClosed
 	}
 
-	if f.c.disableConcurrentReads {
-		return f.writeToSequential(w)
+	if f.c.disableConcurrentReads || f.c.compat.ShortReads {
+		return f.writeToSequential(ctx, w)
 	}
 
 	// For concurrency, we want to guess how many concurrent workers we should use.
@@ -1332,26 +2356,32 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 	if f.c.useFstat {
 		fileStat, err = f.c.fstat(f.handle)
 	} else {
-		fileStat, err = f.c.stat(f.path)
+		fileStat, err = f.c.stat(context.Background(), f.path)
 	}
 	if err != nil {
 		return 0, err
 	}
 
 	fileSize := fileStat.Size
-	if fileSize <= uint64(f.c.maxPacket) || !isRegular(fileStat.Mode) {
+	if fileSize <= uint64(f.c.readChunkSize()) || !isRegular(fileStat.Mode) {
 		// only regular files are guaranteed to return (full read) xor (partial read, next error)
-		return f.writeToSequential(w)
+		return f.writeToSequential(ctx, w)
 	}
 
-	concurrency64 := fileSize/uint64(f.c.maxPacket) + 1 // a bad guess, but better than no guess
-	if concurrency64 > uint64(f.c.maxConcurrentRequests) || concurrency64 < 1 {
-		concurrency64 = uint64(f.c.maxConcurrentRequests)
+	concurrency64 := fileSize/uint64(f.c.readChunkSize()) + 1 // a bad guess, but better than no guess
+	if concurrency64 > uint64(f.c.MaxInflight()) || concurrency64 < 1 {
+		concurrency64 = uint64(f.c.MaxInflight())
 	}
 	// Now that concurrency64 is saturated to an int value, we know this assignment cannot possibly overflow.
 	concurrency := int(concurrency64)
 
-	chunkSize := f.c.maxPacket
+	// window, if set, holds a slot for each chunk read, until it is written.
+	window := f.c.readaheadWindow(w)
+	if window != nil && concurrency > cap(window) {
+		concurrency = cap(window)
+	}
+
+	chunkSize := f.c.readChunkSize()
 	pool := newBufPool(concurrency, chunkSize)
 	resPool := newResChanPool(concurrency)
 
@@ -1392,6 +2422,14 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 
 		cur := writeCh
 		for {
+			if window != nil {
+				select {
+				case window <- struct{}{}:
+				case <-cancel:
+					return
+				}
+			}
+
 			id := f.c.nextID()
 			res := resPool.Get()
 
@@ -1405,7 +2443,7 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 				next: next,
 			}
 
-			f.c.dispatchRequest(res, &sshFxpReadPacket{
+			f.c.dispatchRequest(ctx, res, &sshFxpReadPacket{
 				ID:     id,
 				Handle: f.handle,
 				Offset: uint64(off),
@@ -1423,6 +2461,7 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 		}
 	}()
 
+	workers := f.c.newInflightWorkers(concurrency)
 	wg.Add(concurrency)
 	for i := 0; i < concurrency; i++ {
 		// Map_i: each worker gets readWork, and does the Read into a buffer at the given offset.
@@ -1433,14 +2472,21 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 				var b []byte
 				var n int
 
-				s := <-readWork.res
-				resPool.Put(readWork.res)
+				var s result
+				select {
+				case s = <-readWork.res:
+					resPool.Put(readWork.res)
+				case <-ctx.Done():
+					// the response may still arrive, so the channel is not reused.
+					f.c.cancelRequest(readWork.id)
+					s.err = ctx.Err()
+				}
 
 				err := s.err
 				if err == nil {
 					switch s.typ {
 					case sshFxpStatus:
-						err = normaliseError(unmarshalStatus(readWork.id, s.data))
+						err = f.c.readStatus(readWork.id, s.data)
 
 					case sshFxpData:
 						sid, data := unmarshalUint32(s.data)
@@ -1451,6 +2497,7 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 							l, data := unmarshalUint32(data)
 							b = pool.Get()[:l]
 							n = copy(b, data[:l])
+							f.advance(n)
 							b = b[:n]
 						}
 
@@ -1474,6 +2521,11 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 
 				// DO NOT return.
 				// We want to ensure that readCh is drained before wg.Wait returns.
+
+				if workers.retire() {
+					// MaxInflight was lowered, and enough workers remain to drain the work.
+					return
+				}
 			}
 		}()
 	}
@@ -1486,6 +2538,11 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 			return written, errors.New("sftp.File.WriteTo: unexpectedly closed channel")
 		}
 
+		if err := ctx.Err(); err != nil {
+			// the data read after the context was done is dropped, rather than written.
+			return written, err
+		}
+
 		// Because writes are serialized, this will always be the last successfully read byte.
 		f.offset = packet.off + int64(len(packet.b))
 
@@ -1507,6 +2564,10 @@ func (f *File) WriteTo(w io.Writer) (written int64, err error) {
 
 		pool.Put(packet.b)
 		cur = packet.next
+
+		if window != nil {
+			<-window
+		}
 	}
 }
 
@@ -1552,8 +2613,8 @@ func (f *File) Write(b []byte) (int, error) {
 	return n, err
 }
 
-func (f *File) writeChunkAt(ch chan result, b []byte, off int64) (int, error) {
-	typ, data, err := f.c.sendPacket(context.Background(), ch, &sshFxpWritePacket{
+func (f *File) writeChunkAt(ctx context.Context, ch chan result, b []byte, off int64) (int, error) {
+	typ, data, err := f.c.sendPacket(ctx, ch, &sshFxpWritePacket{
 		ID:     f.c.nextID(),
 		Handle: f.handle,
 		Offset: uint64(off),
@@ -1567,7 +2628,7 @@ func (f *File) writeChunkAt(ch chan result, b []byte, off int64) (int, error) {
 	switch typ {
 	case sshFxpStatus:
 		id, _ := unmarshalUint32(data)
-		err := normaliseError(unmarshalStatus(id, data))
+		err := f.c.statusError(id, data)
 		if err != nil {
 			return 0, err
 		}
@@ -1576,12 +2637,13 @@ func (f *File) writeChunkAt(ch chan result, b []byte, off int64) (int, error) {
 		return 0, unimplementedPacketErr(typ)
 	}
 
+	f.advance(len(b))
 	return len(b), nil
 }
 
 // writeAtConcurrent implements WriterAt, but works concurrently rather than sequentially.
 func (f *File) writeAtConcurrent(b []byte, off int64) (int, error) {
-	// Split the write into multiple maxPacket sized concurrent writes
+	// Split the write into multiple chunk-sized concurrent writes
 	// bounded by maxConcurrentRequests. This allows writes with a suitably
 	// large buffer to transfer data at a much faster rate due to
 	// overlapping round trip times.
@@ -1593,22 +2655,23 @@ func (f *File) writeAtConcurrent(b []byte, off int64) (int, error) {
 		res chan result
 
 		off int64
+		n   int
 	}
 	workCh := make(chan work)
 
-	concurrency := len(b)/f.c.maxPacket + 1
-	if concurrency > f.c.maxConcurrentRequests || concurrency < 1 {
-		concurrency = f.c.maxConcurrentRequests
+	concurrency := len(b)/f.c.writeChunkSize() + 1
+	if concurrency > f.c.MaxInflight() || concurrency < 1 {
+		concurrency = f.c.MaxInflight()
 	}
 
 	pool := newResChanPool(concurrency)
 
-	// Slice: cut up the Read into any number of buffers of length <= f.c.maxPacket, and at appropriate offsets.
+	// Slice: cut up the Read into any number of buffers of length <= the write chunk size, and at appropriate offsets.
 	go func() {
 		defer close(workCh)
 
 		var read int
-		chunkSize := f.c.maxPacket
+		chunkSize := f.c.writeChunkSize()
 
 		for read < len(b) {
 			wb := b[read:]
@@ -1620,7 +2683,7 @@ func (f *File) writeAtConcurrent(b []byte, off int64) (int, error) {
 			res := pool.Get()
 			off := off + int64(read)
 
-			f.c.dispatchRequest(res, &sshFxpWritePacket{
+			f.c.dispatchRequest(context.Background(), res, &sshFxpWritePacket{
 				ID:     id,
 				Handle: f.handle,
 				Offset: uint64(off),
@@ -1629,7 +2692,7 @@ func (f *File) writeAtConcurrent(b []byte, off int64) (int, error) {
 			})
 
 			select {
-			case workCh <- work{id, res, off}:
+			case workCh <- work{id, res, off, len(wb)}:
 			case <-cancel:
 				return
 			}
@@ -1645,6 +2708,7 @@ func (f *File) writeAtConcurrent(b []byte, off int64) (int, error) {
 	errCh := make(chan wErr)
 
 	var wg sync.WaitGroup
+	workers := f.c.newInflightWorkers(concurrency)
 	wg.Add(concurrency)
 	for i := 0; i < concurrency; i++ {
 		// Map_i: each worker gets work, and does the Write from each buffer to its respective offset.
@@ -1659,15 +2723,23 @@ func (f *File) writeAtConcurrent(b []byte, off int64) (int, error) {
 				if err == nil {
 					switch s.typ {
 					case sshFxpStatus:
-						err = normaliseError(unmarshalStatus(work.id, s.data))
+						err = f.c.statusError(work.id, s.data)
 					default:
 						err = unimplementedPacketErr(s.typ)
 					}
 				}
+				if err == nil {
+					f.advance(work.n)
+				}
 
 				if err != nil {
 					errCh <- wErr{work.off, err}
 				}
+
+				if workers.retire() {
+					// MaxInflight was lowered, and enough workers remain to drain the work.
+					return
+				}
 			}
 		}()
 	}
@@ -1718,9 +2790,9 @@ func (f *File) WriteAt(b []byte, off int64) (written int, err error) {
 // writeAt must be called while holding either the Read or Write mutex in File.
 // This code is concurrent safe with itself, but not with Close.
 func (f *File) writeAt(b []byte, off int64) (written int, err error) {
-	if len(b) <= f.c.maxPacket {
+	if len(b) <= f.c.writeChunkSize() {
 		// We can do this in one write.
-		return f.writeChunkAt(nil, b, off)
+		return f.writeChunkAt(context.Background(), nil, b, off)
 	}
 
 	if f.c.useConcurrentWrites {
@@ -1729,7 +2801,7 @@ func (f *File) writeAt(b []byte, off int64) (written int, err error) {
 
 	ch := make(chan result, 1) // reusable channel
 
-	chunkSize := f.c.maxPacket
+	chunkSize := f.c.writeChunkSize()
 
 	for written < len(b) {
 		wb := b[written:]
@@ -1737,7 +2809,7 @@ func (f *File) writeAt(b []byte, off int64) (written int, err error) {
 			wb = wb[:chunkSize]
 		}
 
-		n, err := f.writeChunkAt(ch, wb, off+int64(written))
+		n, err := f.writeChunkAt(context.Background(), ch, wb, off+int64(written))
 		if n > 0 {
 			written += n
 		}
@@ -1763,15 +2835,19 @@ func (f *File) ReadFromWithConcurrency(r io.Reader, concurrency int) (read int64
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	return f.readFromWithConcurrency(r, concurrency)
+	read, err = f.readFromWithConcurrency(context.Background(), r, concurrency)
+	if err == nil {
+		err = f.verifySize()
+	}
+	return read, err
 }
 
-func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64, err error) {
+func (f *File) readFromWithConcurrency(ctx context.Context, r io.Reader, concurrency int) (read int64, err error) {
 	if f.handle == "" {
 		return 0, os.ErrClosed
 	}
 
-	// Split the write into multiple maxPacket sized concurrent writes.
+	// Split the write into multiple chunk-sized concurrent writes.
 	// This allows writes with a suitably large reader
 	// to transfer data at a much faster rate due to overlapping round trip times.
 
@@ -1782,6 +2858,7 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 		res chan result
 
 		off int64
+		n   int
 	}
 	workCh := make(chan work)
 
@@ -1791,20 +2868,25 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 	}
 	errCh := make(chan rwErr)
 
-	if concurrency > f.c.maxConcurrentRequests || concurrency < 1 {
-		concurrency = f.c.maxConcurrentRequests
+	if concurrency > f.c.MaxInflight() || concurrency < 1 {
+		concurrency = f.c.MaxInflight()
 	}
 
 	pool := newResChanPool(concurrency)
 
-	// Slice: cut up the Read into any number of buffers of length <= f.c.maxPacket, and at appropriate offsets.
+	// Slice: cut up the Read into any number of buffers of length <= the write chunk size, and at appropriate offsets.
 	go func() {
 		defer close(workCh)
 
-		b := make([]byte, f.c.maxPacket)
+		b := make([]byte, f.c.writeChunkSize())
 		off := f.offset
 
 		for {
+			if err := ctx.Err(); err != nil {
+				errCh <- rwErr{off, err}
+				return
+			}
+
 			n, err := r.Read(b)
 
 			if n > 0 {
@@ -1813,7 +2895,7 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 				id := f.c.nextID()
 				res := pool.Get()
 
-				f.c.dispatchRequest(res, &sshFxpWritePacket{
+				f.c.dispatchRequest(ctx, res, &sshFxpWritePacket{
 					ID:     id,
 					Handle: f.handle,
 					Offset: uint64(off),
@@ -1822,7 +2904,7 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 				})
 
 				select {
-				case workCh <- work{id, res, off}:
+				case workCh <- work{id, res, off, n}:
 				case <-cancel:
 					return
 				}
@@ -1840,6 +2922,7 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 	}()
 
 	var wg sync.WaitGroup
+	workers := f.c.newInflightWorkers(concurrency)
 	wg.Add(concurrency)
 	for i := 0; i < concurrency; i++ {
 		// Map_i: each worker gets work, and does the Write from each buffer to its respective offset.
@@ -1847,18 +2930,28 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 			defer wg.Done()
 
 			for work := range workCh {
-				s := <-work.res
-				pool.Put(work.res)
+				var s result
+				select {
+				case s = <-work.res:
+					pool.Put(work.res)
+				case <-ctx.Done():
+					// the response may still arrive, so the channel is not reused.
+					f.c.cancelRequest(work.id)
+					s.err = ctx.Err()
+				}
 
 				err := s.err
 				if err == nil {
 					switch s.typ {
 					case sshFxpStatus:
-						err = normaliseError(unmarshalStatus(work.id, s.data))
+						err = f.c.statusError(work.id, s.data)
 					default:
 						err = unimplementedPacketErr(s.typ)
 					}
 				}
+				if err == nil {
+					f.advance(work.n)
+				}
 
 				if err != nil {
 					errCh <- rwErr{work.off, err}
@@ -1866,6 +2959,11 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 					// DO NOT return.
 					// We want to ensure that workCh is drained before wg.Wait returns.
 				}
+
+				if workers.retire() {
+					// MaxInflight was lowered, and enough workers remain to drain the work.
+					return
+				}
 			}
 		}()
 	}
@@ -1931,10 +3029,39 @@ func (f *File) readFromWithConcurrency(r io.Reader, concurrency int) (read int64
 // concurrent requests. Otherwise, reads/writes are performed sequentially.
 // ReadFromWithConcurrency can be used explicitly to guarantee concurrent
 // processing of the reader.
+//
+// If the Client was created with UseWriteVerification, the size of the file is checked once all the data is written,
+// and a *WriteSizeError returned if the file is short.
 func (f *File) ReadFrom(r io.Reader) (int64, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	read, err := f.readFrom(context.Background(), r)
+	if err == nil {
+		err = f.verifySize()
+	}
+	return read, err
+}
+
+// ReadFromContext is ReadFrom, which stops once the context is done, and returns the error of the context.
+// The requests still in flight are abandoned, and cancelled if the server supports it.
+//
+// The number of bytes read from r is returned, as with ReadFrom,
+// which may be more than were written, if the writes were concurrent.
+// The offset of the file is left at the end of the data known to be written,
+// from which the rest of the data can be written again.
+func (f *File) ReadFromContext(ctx context.Context, r io.Reader) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	read, err := f.readFrom(ctx, r)
+	if err == nil {
+		err = f.verifySize()
+	}
+	return read, err
+}
+
+func (f *File) readFrom(ctx context.Context, r io.Reader) (int64, error) {
 	if f.handle == "" {
 		return 0, os.ErrClosed
 	}
@@ -1960,31 +3087,41 @@ func (f *File) ReadFrom(r io.Reader) (int64, error) {
 
 		if remain < 0 {
 			// We can strongly assert that we want default max concurrency here.
-			return f.readFromWithConcurrency(r, f.c.maxConcurrentRequests)
+			return f.readFromWithConcurrency(ctx, r, f.c.MaxInflight())
 		}
 
-		if remain > int64(f.c.maxPacket) {
+		if remain > int64(f.c.writeChunkSize()) {
 			// Otherwise, only use concurrency, if it would be at least two packets.
 
 			// This is the best reasonable guess we can make.
-			concurrency64 := remain/int64(f.c.maxPacket) + 1
+			concurrency64 := remain/int64(f.c.writeChunkSize()) + 1
 
 			// We need to cap this value to an `int` size value to avoid overflow on 32-bit machines.
-			// So, we may as well pre-cap it to `f.c.maxConcurrentRequests`.
-			if concurrency64 > int64(f.c.maxConcurrentRequests) {
-				concurrency64 = int64(f.c.maxConcurrentRequests)
+			// So, we may as well pre-cap it to `f.c.MaxInflight()`.
+			if concurrency64 > int64(f.c.MaxInflight()) {
+				concurrency64 = int64(f.c.MaxInflight())
 			}
 
-			return f.readFromWithConcurrency(r, int(concurrency64))
+			return f.readFromWithConcurrency(ctx, r, int(concurrency64))
 		}
 	}
 
 	ch := make(chan result, 1) // reusable channel
 
-	b := make([]byte, f.c.maxPacket)
+	b := make([]byte, f.c.writeChunkSize())
+
+	var batched bool
+	if f.c.writeAckBatch > 0 {
+		_, batched = f.c.HasExtension(writeBatchExtension)
+	}
+	var unacked int
 
 	var read int64
 	for {
+		if err := ctx.Err(); err != nil {
+			return read, err
+		}
+
 		n, err := r.Read(b)
 		if n < 0 {
 			panic("sftp.File: reader returned negative count from Read")
@@ -1993,7 +3130,20 @@ func (f *File) ReadFrom(r io.Reader) (int64, error) {
 		if n > 0 {
 			read += int64(n)
 
-			m, err2 := f.writeChunkAt(ch, b[:n], f.offset)
+			var m int
+			var err2 error
+			if batched {
+				unacked += n
+				ack := unacked >= f.c.writeAckBatch
+				if err2 = f.writeBatched(ctx, ch, b[:n], f.offset, ack); err2 == nil {
+					m = n
+				}
+				if ack {
+					unacked = 0
+				}
+			} else {
+				m, err2 = f.writeChunkAt(ctx, ch, b[:n], f.offset)
+			}
 			f.offset += int64(m)
 
 			if err == nil {
@@ -2002,6 +3152,13 @@ func (f *File) ReadFrom(r io.Reader) (int64, error) {
 		}
 
 		if err != nil {
+			if unacked > 0 {
+				// acknowledge the last batch, so that any failure is reported.
+				if err2 := f.writeBatched(ctx, ch, nil, f.offset, true); err2 != nil && err == io.EOF {
+					err = err2
+				}
+			}
+
 			if err == io.EOF {
 				return read, nil // return nil explicitly.
 			}
@@ -2011,6 +3168,43 @@ func (f *File) ReadFrom(r io.Reader) (int64, error) {
 	}
 }
 
+// WriteSizeError is returned when UseWriteVerification finds a file smaller than the end of the data written to it.
+type WriteSizeError struct {
+	// Path is the name of the file, as given to Open or Create.
+	Path string
+
+	// Size is the size of the file reported by the server.
+	Size int64
+
+	// Want is the end of the data written, which is the least size the file should have.
+	Want int64
+}
+
+func (e *WriteSizeError) Error() string {
+	return fmt.Sprintf("sftp: %s has size %d after writing up to %d", e.Path, e.Size, e.Want)
+}
+
+// verifySize checks the size of the file against the end of the data written to it,
+// if the Client was created with UseWriteVerification, and records it to be checked again on Close.
+func (f *File) verifySize() error {
+	if !f.c.verifyWrites || f.offset == 0 {
+		return nil
+	}
+
+	fs, err := f.c.fstat(f.handle)
+	if err != nil {
+		return err
+	}
+	if int64(fs.Size) < f.offset {
+		return &WriteSizeError{Path: f.path, Size: int64(fs.Size), Want: f.offset}
+	}
+
+	if f.offset > f.verifyEnd {
+		f.verifyEnd = f.offset
+	}
+	return nil
+}
+
 // Seek implements io.Seeker by setting the client offset for the next Read or
 // Write. It returns the next offset read. Seeking before or after the end of
 // the file is undefined. Seeking relative to the end calls Stat.
@@ -2059,6 +3253,24 @@ func (f *File) Chown(uid, gid int) error {
 	})
 }
 
+// ChmodSymbolic changes the permissions of the current file,
+// according to a chmod(1) style symbolic mode.
+//
+// See Client.ChmodSymbolic for details.
+func (f *File) ChmodSymbolic(mode string) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	perm, err := parseSymbolicMode(mode, fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	return f.Chmod(perm)
+}
+
 // Chmod changes the permissions of the current file.
 //
 // See Client.Chmod for details.
@@ -2122,6 +3334,11 @@ func (f *File) Sync() error {
 		return os.ErrClosed
 	}
 
+	return f.sync()
+}
+
+// sync sends fsync@openssh.com for the handle of the File, which must be locked.
+func (f *File) sync() error {
 	id := f.c.nextID()
 	typ, data, err := f.c.sendPacket(context.Background(), nil, &sshFxpFsyncPacket{
 		ID:     id,
@@ -2132,7 +3349,7 @@ func (f *File) Sync() error {
 	case err != nil:
 		return err
 	case typ == sshFxpStatus:
-		return normaliseError(unmarshalStatus(id, data))
+		return f.c.statusError(id, data)
 	default:
 		return &unexpectedPacketErr{want: sshFxpStatus, got: typ}
 	}
@@ -2160,6 +3377,19 @@ func normaliseError(err error) error {
 	}
 }
 
+// readStatus converts the SSH_FXP_STATUS response to the SSH_FXP_READ request id into an error.
+// A read cannot succeed without data, so an SSH_FX_OK status is never returned as a nil error.
+func (c *Client) readStatus(id uint32, data []byte) error {
+	err := unmarshalStatus(id, data)
+	if status, ok := err.(*StatusError); ok && status.Code == sshFxOk {
+		if c.compat.ReadOKAsEOF {
+			return io.EOF
+		}
+		return err
+	}
+	return normaliseError(err)
+}
+
 // flags converts the flags passed to OpenFile into ssh flags.
 // Unsupported flags are ignored.
 func toPflags(f int) uint32 {
@@ -5,6 +5,7 @@ package sftp
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"errors"
 	"fmt"
@@ -938,6 +939,36 @@ func TestClientChmod(t *testing.T) {
 	require.EqualValues(t, 0500, stat.Mode())
 }
 
+func TestClientChmodSymbolic(t *testing.T) {
+	skipIfWindows(t) // No UNIX permissions.
+	sftp, cmd := testClient(t, READWRITE, NODELAY)
+	defer cmd.Wait()
+	defer sftp.Close()
+
+	f, err := ioutil.TempFile("", "sftptest-chmodsymbolic")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+
+	require.NoError(t, os.Chmod(f.Name(), 0664))
+
+	require.NoError(t, sftp.ChmodSymbolic(f.Name(), "u+x,g-w,o="))
+	stat, err := os.Stat(f.Name())
+	require.NoError(t, err)
+	assert.EqualValues(t, 0740, stat.Mode())
+
+	sf, err := sftp.Open(f.Name())
+	require.NoError(t, err)
+	require.NoError(t, sf.ChmodSymbolic("go=u-w"))
+	sf.Close()
+
+	stat, err = os.Stat(f.Name())
+	require.NoError(t, err)
+	assert.EqualValues(t, 0755, stat.Mode())
+
+	assert.Error(t, sftp.ChmodSymbolic(f.Name(), "u+q"))
+}
+
 func TestClientChmodReadonly(t *testing.T) {
 	skipIfWindows(t) // No UNIX permissions.
 	sftp, cmd := testClient(t, READONLY, NODELAY)
@@ -1350,7 +1381,7 @@ func TestClientWriteSequentialWriterErr(t *testing.T) {
 	defer sftpFile.Close()
 
 	w := &lastChunkErrSequentialWriter{}
-	written, err := sftpFile.writeToSequential(w)
+	written, err := sftpFile.writeToSequential(context.Background(), w)
 	assert.Error(t, err)
 	expected := int64(4)
 	if written != expected {
@@ -2,10 +2,13 @@ package sftp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/kr/fs"
 )
@@ -151,6 +154,68 @@ func TestUseFstatChecked(t *testing.T) {
 	testFstatOption(t, UseFstat(false), false)
 }
 
+func TestConvertWindowsPath(t *testing.T) {
+	upper := func(drive string) string { return "/" + drive[:1] }
+
+	tests := []struct {
+		path     string
+		mapDrive func(string) string
+		want     string
+	}{
+		{`foo\bar`, nil, "foo/bar"},
+		{"/already/clean", nil, "/already/clean"},
+		{`C:\Users\foo`, nil, "/Users/foo"},
+		{`c:\Users`, upper, "/c/Users"},
+		{`\\server\share`, nil, "//server/share"},
+		{"1:/not/a/drive", nil, "1:/not/a/drive"},
+	}
+
+	for _, tt := range tests {
+		if got := convertWindowsPath(tt.path, tt.mapDrive); got != tt.want {
+			t.Errorf("convertWindowsPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSetMaxInflight(t *testing.T) {
+	var c Client
+
+	if err := MaxConcurrentRequestsPerFile(8)(&c); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.MaxInflight(); got != 8 {
+		t.Errorf("MaxInflight() = %d, want 8", got)
+	}
+
+	if err := c.SetMaxInflight(0); err == nil {
+		t.Error("SetMaxInflight(0) succeeded, want error")
+	}
+
+	workers := c.newInflightWorkers(4)
+	if err := c.SetMaxInflight(2); err != nil {
+		t.Fatal(err)
+	}
+
+	var retired int
+	for i := 0; i < 4; i++ {
+		if workers.retire() {
+			retired++
+		}
+	}
+	if retired != 2 {
+		t.Errorf("retired %d workers, want 2", retired)
+	}
+
+	// the last worker must never retire.
+	if err := c.SetMaxInflight(1); err != nil {
+		t.Fatal(err)
+	}
+	workers = c.newInflightWorkers(1)
+	if workers.retire() {
+		t.Error("last worker retired")
+	}
+}
+
 type sink struct{}
 
 func (*sink) Close() error                { return nil }
@@ -198,3 +263,135 @@ func TestClientNoSid(t *testing.T) {
 		t.Fatal("expected ErrSSHFxConnectionLost, got", err)
 	}
 }
+
+func TestClientUnsolicitedPacket(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	// a server which sends keepalives with unknown ids before answering a STAT.
+	go func() {
+		defer sw.Close()
+
+		if _, _, err := recvPacket(sr, nil, 0); err != nil {
+			return
+		}
+		sendPacket(sw, &sshFxVersionPacket{Version: sftpProtocolVersion})
+
+		_, data, err := recvPacket(sr, nil, 0)
+		if err != nil {
+			return
+		}
+		id, _ := unmarshalUint32(data)
+
+		sendPacket(sw, &sshFxpStatusPacket{ID: 0xffffffff, StatusError: StatusError{Code: sshFxOk}})
+		sw.Write([]byte{0, 0, 0, 1, sshFxpExtendedReply}) // too short for an id
+		sendPacket(sw, &sshFxpStatResponse{ID: id, info: &fileInfo{name: "foo", stat: &FileStat{Size: 5}}})
+	}()
+
+	var unsolicited []uint8
+	c, err := NewClientPipe(cr, cw, WithUnsolicitedPacketHandler(func(typ uint8, data []byte) {
+		unsolicited = append(unsolicited, typ)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	fi, err := c.Stat("foo")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", fi.Size())
+	}
+
+	if want := []uint8{sshFxpStatus, sshFxpExtendedReply}; !bytes.Equal(unsolicited, want) {
+		t.Errorf("unsolicited packets = %v, want %v", unsolicited, want)
+	}
+}
+
+func TestClientInvalidHandle(t *testing.T) {
+	for _, tt := range []struct {
+		handle string
+		compat ClientCompat
+		valid  bool
+	}{
+		{handle: "", valid: false},
+		{handle: strings.Repeat("h", maxHandleLength), valid: true},
+		{handle: strings.Repeat("h", 4096), valid: false},
+		{handle: strings.Repeat("h", 4096), compat: ClientCompat{LongHandles: true}, valid: true},
+	} {
+		stream := new(bytes.Buffer)
+		sendPacket(stream, &sshFxVersionPacket{Version: sftpProtocolVersion})
+		sendPacket(stream, &sshFxpHandlePacket{ID: 1, Handle: tt.handle})
+
+		c, err := NewClientPipe(stream, &sink{}, WithClientCompat(tt.compat))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Open("/foo")
+		var invalid *invalidHandleErr
+		if got := !errors.As(err, &invalid); got != tt.valid {
+			t.Errorf("handle of %d bytes with %+v: got error %v", len(tt.handle), tt.compat, err)
+		}
+		c.Close()
+	}
+}
+
+func TestClientContextVariants(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	// a server which goes silent after the version.
+	go func() {
+		defer sw.Close()
+
+		if _, _, err := recvPacket(sr, nil, 0); err != nil {
+			return
+		}
+		sendPacket(sw, &sshFxVersionPacket{Version: sftpProtocolVersion})
+
+		for {
+			if _, _, err := recvPacket(sr, nil, 0); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := NewClientPipe(cr, cw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	calls := map[string]func(ctx context.Context) error{
+		"StatContext": func(ctx context.Context) error {
+			_, err := c.StatContext(ctx, "foo")
+			return err
+		},
+		"OpenContext": func(ctx context.Context) error {
+			_, err := c.OpenContext(ctx, "foo")
+			return err
+		},
+		"MkdirAllContext": func(ctx context.Context) error {
+			return c.MkdirAllContext(ctx, "foo/bar")
+		},
+		"RemoveContext": func(ctx context.Context) error {
+			return c.RemoveContext(ctx, "foo")
+		},
+		"RenameContext": func(ctx context.Context) error {
+			return c.RenameContext(ctx, "foo", "bar")
+		},
+	}
+
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := call(ctx)
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s() = %v, want %v", name, err, context.DeadlineExceeded)
+		}
+	}
+}
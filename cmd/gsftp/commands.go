@@ -0,0 +1,455 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// shell runs commands against a remote server, keeping track of the remote working directory.
+type shell struct {
+	c   *sftp.Client
+	cwd string
+	out io.Writer
+}
+
+func newShell(c *sftp.Client, out io.Writer) (*shell, error) {
+	cwd, err := c.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return &shell{c: c, cwd: cwd, out: out}, nil
+}
+
+type command struct {
+	usage string
+	help  string
+	run   func(sh *shell, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"cd":    {"cd path", "change the remote directory", (*shell).cd},
+		"chmod": {"chmod mode path", "change permissions, with an octal or symbolic mode such as u+x,go-w", (*shell).chmod},
+		"df":    {"df [path]", "show filesystem usage (statvfs@openssh.com)", (*shell).df},
+		"get":   {"get [-a] remote [local]", "download a file, -a resumes a partial download", (*shell).get},
+		"help":  {"help", "show this help", (*shell).help},
+		"lcd":   {"lcd path", "change the local directory", (*shell).lcd},
+		"ln":    {"ln -s target link", "create a symbolic link", (*shell).ln},
+		"ls":    {"ls [-l] [path]", "list a remote directory", (*shell).ls},
+		"mkdir": {"mkdir [-p] path", "create a remote directory, -p creates parents as needed", (*shell).mkdir},
+		"mv":    {"mv old new", "rename a remote file, replacing new if the server supports it", (*shell).mv},
+		"put":   {"put [-a] local [remote]", "upload a file, -a resumes a partial upload", (*shell).put},
+		"pwd":   {"pwd", "show the remote directory", (*shell).pwd},
+		"rm":    {"rm path", "remove a remote file", (*shell).rm},
+		"rmdir": {"rmdir path", "remove a remote directory", (*shell).rmdir},
+	}
+}
+
+func (sh *shell) run(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see help", args[0])
+	}
+	if err := cmd.run(sh, args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return fmt.Errorf("usage: %s", cmd.usage)
+		}
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
+
+// parse parses the flags in args for a command.
+func parse(args []string, setup func(fs *flag.FlagSet)) ([]string, error) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	if setup != nil {
+		setup(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// remote resolves p relative to the remote working directory.
+func (sh *shell) remote(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join(sh.cwd, p)
+}
+
+func (sh *shell) help(args []string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(sh.out, "%-26s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(sh.out, "%-26s %s\n", "quit", "end the session")
+	return nil
+}
+
+func (sh *shell) cd(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	dir, err := sh.c.RealPath(sh.remote(args[0]))
+	if err != nil {
+		return err
+	}
+
+	fi, err := sh.c.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+
+	sh.cwd = dir
+	return nil
+}
+
+func (sh *shell) pwd(args []string) error {
+	fmt.Fprintln(sh.out, sh.cwd)
+	return nil
+}
+
+func (sh *shell) lcd(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return os.Chdir(args[0])
+}
+
+func (sh *shell) ls(args []string) error {
+	var long bool
+	args, err := parse(args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&long, "l", false, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := sh.cwd
+	switch len(args) {
+	case 0:
+	case 1:
+		dir = sh.remote(args[0])
+	default:
+		return errUsage
+	}
+
+	fi, err := sh.c.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	entries := []os.FileInfo{fi}
+	if fi.IsDir() {
+		if entries, err = sh.c.ReadDir(dir); err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+
+	for _, fi := range entries {
+		if !long {
+			fmt.Fprintln(sh.out, fi.Name())
+			continue
+		}
+
+		var uid, gid uint32
+		if stat, ok := fi.Sys().(*sftp.FileStat); ok {
+			uid, gid = stat.UID, stat.GID
+		}
+		fmt.Fprintf(sh.out, "%s %6d %6d %12d %s %s\n",
+			fi.Mode(), uid, gid, fi.Size(), fi.ModTime().Format(time.Stamp), fi.Name())
+	}
+	return nil
+}
+
+func (sh *shell) mkdir(args []string) error {
+	var parents bool
+	args, err := parse(args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&parents, "p", false, "")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	if parents {
+		return sh.c.MkdirAll(sh.remote(args[0]))
+	}
+	return sh.c.Mkdir(sh.remote(args[0]))
+}
+
+func (sh *shell) rm(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return sh.c.Remove(sh.remote(args[0]))
+}
+
+func (sh *shell) rmdir(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return sh.c.RemoveDirectory(sh.remote(args[0]))
+}
+
+func (sh *shell) mv(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	oldname, newname := sh.remote(args[0]), sh.remote(args[1])
+	if sh.c.Supports("posix-rename@openssh.com") {
+		return sh.c.PosixRename(oldname, newname)
+	}
+	return sh.c.Rename(oldname, newname)
+}
+
+func (sh *shell) chmod(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	return sh.c.ChmodSymbolic(sh.remote(args[1]), args[0])
+}
+
+func (sh *shell) ln(args []string) error {
+	var symbolic bool
+	args, err := parse(args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&symbolic, "s", false, "")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	if symbolic {
+		// the target is stored as given, so that relative links stay relative.
+		return sh.c.Symlink(args[0], sh.remote(args[1]))
+	}
+	return sh.c.Link(sh.remote(args[0]), sh.remote(args[1]))
+}
+
+func (sh *shell) df(args []string) error {
+	dir := sh.cwd
+	switch len(args) {
+	case 0:
+	case 1:
+		dir = sh.remote(args[0])
+	default:
+		return errUsage
+	}
+
+	if !sh.c.Supports("statvfs@openssh.com") {
+		return errors.New("the server does not support statvfs@openssh.com")
+	}
+
+	st, err := sh.c.StatVFS(dir)
+	if err != nil {
+		return err
+	}
+
+	total, free := st.TotalSpace(), st.FreeSpace()
+	avail := st.Frsize * st.Bavail
+	fmt.Fprintf(sh.out, "%14s %14s %14s %14s\n", "Size", "Used", "Avail", "Inodes free")
+	fmt.Fprintf(sh.out, "%14d %14d %14d %14d\n", total, total-free, avail, st.Ffree)
+	return nil
+}
+
+func (sh *shell) get(args []string) error {
+	var resume bool
+	args, err := parse(args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&resume, "a", false, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	var remote, local string
+	switch len(args) {
+	case 1:
+		remote, local = sh.remote(args[0]), path.Base(args[0])
+	case 2:
+		remote, local = sh.remote(args[0]), args[1]
+	default:
+		return errUsage
+	}
+
+	src, err := sh.c.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	var offset int64
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE
+		if lfi, err := os.Stat(local); err == nil {
+			offset = lfi.Size()
+		}
+		if offset > fi.Size() {
+			return fmt.Errorf("%s: local file is larger than the remote file", local)
+		}
+	}
+
+	dst, err := os.OpenFile(local, flags, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+
+	p := newProgress(remote, offset, fi.Size())
+	_, err = src.WriteTo(io.MultiWriter(dst, p))
+	p.finish()
+
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (sh *shell) put(args []string) error {
+	var resume bool
+	args, err := parse(args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&resume, "a", false, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	var local, remote string
+	switch len(args) {
+	case 1:
+		local, remote = args[0], sh.remote(filepath.Base(args[0]))
+	case 2:
+		local, remote = args[0], sh.remote(args[1])
+	default:
+		return errUsage
+	}
+
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	var offset int64
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE
+		if rfi, err := sh.c.Stat(remote); err == nil {
+			offset = rfi.Size()
+		}
+		if offset > fi.Size() {
+			return fmt.Errorf("%s: remote file is larger than the local file", remote)
+		}
+	}
+
+	dst, err := sh.c.OpenFile(remote, flags)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+
+	p := newProgress(local, offset, fi.Size())
+	_, err = dst.ReadFrom(io.TeeReader(src, p))
+	p.finish()
+
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// progress reports the progress of a transfer on standard error.
+type progress struct {
+	name        string
+	done, total int64
+	last        time.Time
+}
+
+func newProgress(name string, done, total int64) *progress {
+	return &progress{name: name, done: done, total: total}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if now := time.Now(); now.Sub(p.last) >= 100*time.Millisecond {
+		p.last = now
+		p.print()
+	}
+	return len(b), nil
+}
+
+func (p *progress) print() {
+	if *quiet {
+		return
+	}
+
+	percent := int64(100)
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	fmt.Fprintf(os.Stderr, "\r%s %12d/%d bytes %3d%%", p.name, p.done, p.total, percent)
+}
+
+func (p *progress) finish() {
+	p.print()
+	if !*quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+}
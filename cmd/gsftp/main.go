@@ -0,0 +1,189 @@
+// gsftp is an interactive SFTP client, in the style of OpenSSH's sftp,
+// built on github.com/pkg/sftp. It doubles as documentation of the Client API.
+//
+// Usage:
+//
+//	gsftp [flags] [user@]host [command [args...]]
+//
+// With a command, gsftp runs that single command and exits.
+// Otherwise, commands are read one per line from the batch file given with -b,
+// or from standard input, until "quit" or the end of the input.
+// Run the "help" command for the list of commands.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/pkg/sftp"
+)
+
+var (
+	port     = flag.Int("P", 22, "ssh server port")
+	identity = flag.String("i", "", "private key file used for public key authentication")
+	batch    = flag.String("b", "", "read commands from the given file, \"-\" for standard input, and stop at the first error")
+	insecure = flag.Bool("insecure", false, "do not verify the server host key against ~/.ssh/known_hosts")
+	quiet    = flag.Bool("q", false, "do not show transfer progress")
+	packet   = flag.Int("s", 1<<15, "maximum packet size")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [user@]host [command [args...]]\n\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(flag.CommandLine.Output(), "\nThe password, if needed, is read from the GSFTP_PASSWORD environment variable.\n")
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gsftp: ")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	conn, err := dial(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn, sftp.MaxPacket(*packet))
+	if err != nil {
+		log.Fatalf("unable to start sftp subsystem: %v", err)
+	}
+	defer client.Close()
+
+	sh, err := newShell(client, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.NArg() > 1 {
+		if err := sh.run(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	in, stopOnError := io.Reader(os.Stdin), false
+	switch *batch {
+	case "":
+	case "-":
+		stopOnError = true
+	default:
+		f, err := os.Open(*batch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in, stopOnError = f, true
+	}
+
+	interactive := !stopOnError && isTerminal(os.Stdin)
+
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			fmt.Print("sftp> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" || args[0] == "bye" {
+			break
+		}
+
+		if err := sh.run(args); err != nil {
+			if stopOnError {
+				log.Fatal(err)
+			}
+			log.Print(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// dial connects to the ssh server given as [user@]host,
+// authenticating with the ssh agent, the -i identity file, and any password.
+func dial(dest string) (*ssh.Client, error) {
+	user, host := os.Getenv("USER"), dest
+	if i := strings.LastIndexByte(dest, '@'); i >= 0 {
+		user, host = dest[:i], dest[i+1:]
+	}
+
+	var auths []ssh.AuthMethod
+	if aconn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK")); err == nil {
+		auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(aconn).Signers))
+	}
+	if *identity != "" {
+		key, err := ioutil.ReadFile(*identity)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", *identity, err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if pass := os.Getenv("GSFTP_PASSWORD"); pass != "" {
+		auths = append(auths, ssh.Password(pass))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !*insecure {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		hostKeyCallback, err = knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read known hosts: %w", err)
+		}
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(*port))
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+var errUsage = errors.New("invalid arguments, see help")
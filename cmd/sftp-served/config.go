@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// Config is the configuration file of sftp-served, in JSON.
+type Config struct {
+	// Listen is the address to listen on, by default ":2022".
+	Listen string `json:"listen"`
+
+	// HostKeys are the files holding the private host keys of the server.
+	HostKeys []string `json:"host_keys"`
+
+	// LogFile is the file to which the log is appended, by default standard error.
+	LogFile string `json:"log_file"`
+
+	// CaptureDir, if set, is a directory in which every session is captured to a file, for debugging.
+	// Captures include the contents of all files transferred.
+	CaptureDir string `json:"capture_dir"`
+
+	// Subsystems are the names of the subsystems under which SFTP is served, by default only "sftp".
+	// Some clients request the subsystem under another name, such as "sftp-v2", or the name of a vendor.
+	Subsystems []string `json:"subsystems"`
+
+	// ExecCommands are the commands which, when run with an "exec" request, serve SFTP,
+	// as a replacement for OpenSSH's sftp-server, such as "/usr/lib/openssh/sftp-server".
+	// The arguments of the command are ignored.
+	// Clients configured with the path of the sftp-server to run, such as with "sftp -s /usr/lib/openssh/sftp-server",
+	// request it with exec, rather than as a subsystem.
+	ExecCommands []string `json:"exec_commands"`
+
+	Users []*User `json:"users"`
+}
+
+// User is an account allowed to log in.
+type User struct {
+	Name string `json:"name"`
+
+	// PasswordHash is the bcrypt hash of the password of the user, as printed by sftp-served -hash-password.
+	// If empty, password authentication is refused.
+	PasswordHash string `json:"password_hash"`
+
+	// AuthorizedKeys are public keys, in the authorized_keys format, which the user may log in with.
+	AuthorizedKeys []string `json:"authorized_keys"`
+
+	// AuthorizedKeysFile is a file of further public keys, in the authorized_keys format.
+	AuthorizedKeysFile string `json:"authorized_keys_file"`
+
+	// Root is the local directory served to the user as "/".
+	Root string `json:"root"`
+
+	// ReadOnly refuses every request which would modify the files of the user.
+	ReadOnly bool `json:"read_only"`
+
+	// Quota is the maximum number of bytes the files under Root may occupy, zero for no limit.
+	Quota int64 `json:"quota"`
+
+	keys map[string]bool // marshaled public keys
+}
+
+// loadConfig reads and validates the configuration file name.
+func loadConfig(name string) (*Config, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	cfg := new(Config)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := cfg.validate(filepath.Dir(name)); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return cfg, nil
+}
+
+// validate checks the configuration, and parses the authorized keys.
+// Relative file names are resolved against dir, the directory of the configuration file.
+func (cfg *Config) validate(dir string) error {
+	if cfg.Listen == "" {
+		cfg.Listen = ":2022"
+	}
+
+	if len(cfg.HostKeys) == 0 {
+		return errors.New("no host_keys")
+	}
+	for i, name := range cfg.HostKeys {
+		cfg.HostKeys[i] = relativeTo(dir, name)
+	}
+
+	if cfg.LogFile != "" {
+		cfg.LogFile = relativeTo(dir, cfg.LogFile)
+	}
+	if cfg.CaptureDir != "" {
+		cfg.CaptureDir = relativeTo(dir, cfg.CaptureDir)
+	}
+
+	if len(cfg.Subsystems) == 0 {
+		cfg.Subsystems = []string{"sftp"}
+	}
+	for _, name := range cfg.Subsystems {
+		if name == "" {
+			return errors.New("empty subsystem name")
+		}
+	}
+	for _, command := range cfg.ExecCommands {
+		if len(strings.Fields(command)) != 1 {
+			return fmt.Errorf("exec command %q: must be a single word, without arguments", command)
+		}
+	}
+
+	if len(cfg.Users) == 0 {
+		return errors.New("no users")
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range cfg.Users {
+		if u.Name == "" {
+			return errors.New("user without a name")
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("user %q: defined twice", u.Name)
+		}
+		seen[u.Name] = true
+
+		if err := u.validate(dir); err != nil {
+			return fmt.Errorf("user %q: %w", u.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (u *User) validate(dir string) error {
+	if u.Root == "" {
+		return errors.New("no root")
+	}
+	if u.Quota < 0 {
+		return errors.New("negative quota")
+	}
+
+	root, err := filepath.Abs(relativeTo(dir, u.Root))
+	if err != nil {
+		return err
+	}
+	if u.Root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+
+	if u.PasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return fmt.Errorf("password_hash: %w", err)
+		}
+	}
+
+	u.keys = make(map[string]bool)
+	for _, line := range u.AuthorizedKeys {
+		if err := u.addKeys([]byte(line)); err != nil {
+			return fmt.Errorf("authorized_keys: %w", err)
+		}
+	}
+	if u.AuthorizedKeysFile != "" {
+		name := relativeTo(dir, u.AuthorizedKeysFile)
+
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := u.addKeys(data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if u.PasswordHash == "" && len(u.keys) == 0 {
+		return errors.New("neither a password_hash nor authorized keys")
+	}
+
+	return nil
+}
+
+// addKeys adds the public keys in data, in the authorized_keys format.
+func (u *User) addKeys(data []byte) error {
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		u.keys[string(key.Marshal())] = true
+	}
+	return nil
+}
+
+func relativeTo(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// quota tracks the bytes occupied by the files of a user, shared by all sessions of that user.
+// Usage is counted at startup, and then maintained as files grow, shrink, and are removed.
+// It is approximate when several handles write to the same file, or the files are changed by other means.
+type quota struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+func newQuota(root string, limit int64) (*quota, error) {
+	q := &quota{limit: limit}
+
+	err := filepath.Walk(root, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			q.used += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// charge adds delta to the bytes used, failing if this would exceed the limit.
+// A negative delta always succeeds.
+func (q *quota) charge(delta int64) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if delta > 0 && q.used+delta > q.limit {
+		return errQuotaExceeded
+	}
+
+	q.used += delta
+	if q.used < 0 {
+		q.used = 0
+	}
+	return nil
+}
+
+// quotaFile is a file open for writing, which charges its growth to a quota.
+type quotaFile struct {
+	*os.File
+	q *quota
+
+	mu   sync.Mutex
+	size int64
+}
+
+func (f *quotaFile) WriteAt(b []byte, off int64) (int, error) {
+	f.mu.Lock()
+	if end := off + int64(len(b)); end > f.size {
+		if err := f.q.charge(end - f.size); err != nil {
+			f.mu.Unlock()
+			return 0, err
+		}
+		f.size = end
+	}
+	f.mu.Unlock()
+
+	return f.File.WriteAt(b, off)
+}
+
+// rootFS implements the sftp.Handlers for a user, serving the local directory root.
+//
+// Paths are confined to root, including through symbolic links,
+// but a concurrent local process replacing a directory with a symbolic link may race the checks.
+type rootFS struct {
+	root     string // absolute, and free of symbolic links
+	readOnly bool
+	quota    *quota // nil if unlimited
+}
+
+func (fs *rootFS) handlers() sftp.Handlers {
+	return sftp.Handlers{
+		FileGet:  fs,
+		FilePut:  fs,
+		FileCmd:  fs,
+		FileList: fs,
+	}
+}
+
+// resolve returns the local name of the request path p.
+// If follow is set, a symbolic link as the last component is followed, and must also stay within the root.
+func (fs *rootFS) resolve(op, p string, follow bool) (string, error) {
+	local := filepath.Join(fs.root, filepath.FromSlash(p))
+	if local == fs.root {
+		return local, nil
+	}
+
+	dir, base := filepath.Split(local)
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fs.pathError(op, p, err)
+	}
+	if !fs.within(dir) {
+		return "", &os.PathError{Op: op, Path: p, Err: sftp.ErrSSHFxPermissionDenied}
+	}
+	local = filepath.Join(dir, base)
+
+	if follow {
+		if target, err := filepath.EvalSymlinks(local); err == nil && !fs.within(target) {
+			return "", &os.PathError{Op: op, Path: p, Err: sftp.ErrSSHFxPermissionDenied}
+		}
+	}
+
+	return local, nil
+}
+
+func (fs *rootFS) within(name string) bool {
+	return name == fs.root || strings.HasPrefix(name, fs.root+string(filepath.Separator))
+}
+
+// pathError replaces the local name in err with the request path p, so that the root is not disclosed.
+func (fs *rootFS) pathError(op, p string, err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return &os.PathError{Op: op, Path: p, Err: pe.Err}
+	}
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		return &os.PathError{Op: op, Path: p, Err: le.Err}
+	}
+	return err
+}
+
+func (fs *rootFS) checkWritable(op, p string) error {
+	if fs.readOnly {
+		return &os.PathError{Op: op, Path: p, Err: sftp.ErrSSHFxPermissionDenied}
+	}
+	return nil
+}
+
+func (fs *rootFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	local, err := fs.resolve("open", r.Filepath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, fs.pathError("open", r.Filepath, err)
+	}
+	return f, nil
+}
+
+func (fs *rootFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return fs.OpenFile(r)
+}
+
+func (fs *rootFS) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	if err := fs.checkWritable("open", r.Filepath); err != nil {
+		return nil, err
+	}
+
+	local, err := fs.resolve("open", r.Filepath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pflags := r.Pflags()
+
+	flags := os.O_WRONLY
+	if pflags.Read {
+		flags = os.O_RDWR
+	}
+	if pflags.Append {
+		flags |= os.O_APPEND
+	}
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+
+	var size int64
+	if fi, err := os.Stat(local); err == nil {
+		size = fi.Size()
+	}
+
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(local, flags, 0o644)
+	if err != nil {
+		return nil, fs.pathError("open", r.Filepath, err)
+	}
+
+	if pflags.Trunc {
+		fs.quota.charge(-size)
+		size = 0
+	}
+
+	return &quotaFile{File: f, q: fs.quota, size: size}, nil
+}
+
+func (fs *rootFS) Filecmd(r *sftp.Request) error {
+	if err := fs.checkWritable(strings.ToLower(r.Method), r.Filepath); err != nil {
+		return err
+	}
+
+	switch r.Method {
+	case "Setstat":
+		return fs.setstat(r)
+
+	case "Rename":
+		// SFTP-v2: "It is an error if there already exists a file with the name specified by newpath."
+		return fs.rename(r, false)
+
+	case "Rmdir":
+		local, err := fs.resolve("rmdir", r.Filepath, false)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Lstat(local)
+		if err != nil {
+			return fs.pathError("rmdir", r.Filepath, err)
+		}
+		if !fi.IsDir() {
+			return &os.PathError{Op: "rmdir", Path: r.Filepath, Err: sftp.ErrSSHFxFailure}
+		}
+
+		return fs.pathError("rmdir", r.Filepath, os.Remove(local))
+
+	case "Remove":
+		local, err := fs.resolve("remove", r.Filepath, false)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Lstat(local)
+		if err != nil {
+			return fs.pathError("remove", r.Filepath, err)
+		}
+		if fi.IsDir() {
+			return &os.PathError{Op: "remove", Path: r.Filepath, Err: sftp.ErrSSHFxFailure}
+		}
+
+		if err := os.Remove(local); err != nil {
+			return fs.pathError("remove", r.Filepath, err)
+		}
+		if fi.Mode().IsRegular() {
+			fs.quota.charge(-fi.Size())
+		}
+		return nil
+
+	case "Mkdir":
+		local, err := fs.resolve("mkdir", r.Filepath, false)
+		if err != nil {
+			return err
+		}
+		return fs.pathError("mkdir", r.Filepath, os.Mkdir(local, 0o755))
+
+	case "Link":
+		oldname, err := fs.resolve("link", r.Filepath, false)
+		if err != nil {
+			return err
+		}
+		newname, err := fs.resolve("link", r.Target, false)
+		if err != nil {
+			return err
+		}
+		return fs.pathError("link", r.Target, os.Link(oldname, newname))
+
+	case "Symlink":
+		// NOTE: r.Filepath is the target, and r.Target is the linkpath.
+		// The target is stored as sent, and checked against the root whenever the link is followed.
+		linkname, err := fs.resolve("symlink", r.Target, false)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.FromSlash(r.Filepath)
+		if filepath.IsAbs(target) {
+			target = filepath.Join(fs.root, target)
+		}
+		return fs.pathError("symlink", r.Target, os.Symlink(target, linkname))
+	}
+
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *rootFS) PosixRename(r *sftp.Request) error {
+	if err := fs.checkWritable("rename", r.Filepath); err != nil {
+		return err
+	}
+	return fs.rename(r, true)
+}
+
+func (fs *rootFS) rename(r *sftp.Request, replace bool) error {
+	oldname, err := fs.resolve("rename", r.Filepath, false)
+	if err != nil {
+		return err
+	}
+	newname, err := fs.resolve("rename", r.Target, false)
+	if err != nil {
+		return err
+	}
+
+	var replaced int64
+	if fi, err := os.Lstat(newname); err == nil {
+		if !replace {
+			return &os.PathError{Op: "rename", Path: r.Target, Err: os.ErrExist}
+		}
+		if fi.Mode().IsRegular() {
+			replaced = fi.Size()
+		}
+	}
+
+	if err := os.Rename(oldname, newname); err != nil {
+		return fs.pathError("rename", r.Filepath, err)
+	}
+
+	fs.quota.charge(-replaced)
+	return nil
+}
+
+func (fs *rootFS) setstat(r *sftp.Request) error {
+	local, err := fs.resolve("setstat", r.Filepath, true)
+	if err != nil {
+		return err
+	}
+
+	attrFlags := r.AttrFlags()
+	attrs := r.Attributes()
+
+	if attrFlags.UidGid {
+		return &os.PathError{Op: "chown", Path: r.Filepath, Err: sftp.ErrSSHFxPermissionDenied}
+	}
+
+	if attrFlags.Size {
+		fi, err := os.Stat(local)
+		if err != nil {
+			return fs.pathError("truncate", r.Filepath, err)
+		}
+
+		delta := int64(attrs.Size) - fi.Size()
+		if err := fs.quota.charge(delta); err != nil {
+			return err
+		}
+
+		if err := os.Truncate(local, int64(attrs.Size)); err != nil {
+			fs.quota.charge(-delta)
+			return fs.pathError("truncate", r.Filepath, err)
+		}
+	}
+
+	if attrFlags.Permissions {
+		if err := os.Chmod(local, attrs.FileMode()&os.ModePerm); err != nil {
+			return fs.pathError("chmod", r.Filepath, err)
+		}
+	}
+
+	if attrFlags.Acmodtime {
+		if err := os.Chtimes(local, attrs.AccessTime(), attrs.ModTime()); err != nil {
+			return fs.pathError("chtimes", r.Filepath, err)
+		}
+	}
+
+	return nil
+}
+
+type listerat []os.FileInfo
+
+func (l listerat) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (fs *rootFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		local, err := fs.resolve("readdir", r.Filepath, true)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(local)
+		if err != nil {
+			return nil, fs.pathError("readdir", r.Filepath, err)
+		}
+		defer f.Close()
+
+		entries, err := f.Readdir(-1)
+		if err != nil {
+			return nil, fs.pathError("readdir", r.Filepath, err)
+		}
+		return listerat(entries), nil
+
+	case "Stat":
+		local, err := fs.resolve("stat", r.Filepath, true)
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := os.Stat(local)
+		if err != nil {
+			return nil, fs.pathError("stat", r.Filepath, err)
+		}
+		return listerat{fi}, nil
+	}
+
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *rootFS) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	local, err := fs.resolve("lstat", r.Filepath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Lstat(local)
+	if err != nil {
+		return nil, fs.pathError("lstat", r.Filepath, err)
+	}
+	return listerat{fi}, nil
+}
+
+func (fs *rootFS) Readlink(p string) (string, error) {
+	local, err := fs.resolve("readlink", p, false)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := os.Readlink(local)
+	if err != nil {
+		return "", fs.pathError("readlink", p, err)
+	}
+
+	// present links to absolute local names within the root as absolute request paths.
+	if filepath.IsAbs(target) && fs.within(target) {
+		target = "/" + filepath.ToSlash(strings.TrimPrefix(target[len(fs.root):], string(filepath.Separator)))
+	}
+	return target, nil
+}
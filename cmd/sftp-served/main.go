@@ -0,0 +1,311 @@
+// sftp-served is an SFTP server built on github.com/pkg/sftp,
+// serving each user a local directory as configured in a JSON file.
+// It is intended as a reference deployment of the RequestServer,
+// and as a fixture for testing other SFTP clients.
+//
+// Usage:
+//
+//	sftp-served -config sftp-served.json
+//	sftp-served -hash-password < password
+//
+// An example configuration, with relative names resolved against the directory of the file:
+//
+//	{
+//		"listen": ":2022",
+//		"host_keys": ["ssh_host_ed25519_key"],
+//		"log_file": "sftp-served.log",
+//		"capture_dir": "",
+//		"subsystems": ["sftp", "sftp-v2"],
+//		"exec_commands": ["/usr/lib/openssh/sftp-server", "internal-sftp"],
+//		"users": [
+//			{
+//				"name": "alice",
+//				"password_hash": "$2a$10$...",
+//				"authorized_keys": ["ssh-ed25519 AAAA... alice@laptop"],
+//				"root": "/srv/sftp/alice",
+//				"quota": 1073741824
+//			},
+//			{
+//				"name": "mirror",
+//				"authorized_keys_file": "mirror.pub",
+//				"root": "/srv/sftp/public",
+//				"read_only": true
+//			}
+//		]
+//	}
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pkg/sftp"
+)
+
+var (
+	configFile   = flag.String("config", "sftp-served.json", "configuration file")
+	checkConfig  = flag.Bool("check", false, "check the configuration file and exit")
+	hashPassword = flag.Bool("hash-password", false, "print the password_hash of the password read from standard input and exit")
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+	flag.Parse()
+
+	if *hashPassword {
+		if err := printHash(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *checkConfig {
+		return
+	}
+
+	if cfg.LogFile != "" {
+		f, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	}
+
+	srv, err := newServer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %v", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+func printHash(r io.Reader) error {
+	pass, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword(bytes.TrimRight([]byte(pass), "\r\n"), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(hash))
+	return nil
+}
+
+type server struct {
+	cfg    *Config
+	ssh    *ssh.ServerConfig
+	users  map[string]*User
+	quotas map[string]*quota
+}
+
+func newServer(cfg *Config) (*server, error) {
+	srv := &server{
+		cfg:    cfg,
+		users:  make(map[string]*User),
+		quotas: make(map[string]*quota),
+	}
+
+	for _, u := range cfg.Users {
+		srv.users[u.Name] = u
+
+		if u.Quota > 0 {
+			q, err := newQuota(u.Root, u.Quota)
+			if err != nil {
+				return nil, fmt.Errorf("user %q: %w", u.Name, err)
+			}
+			srv.quotas[u.Name] = q
+		}
+	}
+
+	srv.ssh = &ssh.ServerConfig{
+		PasswordCallback:  srv.checkPassword,
+		PublicKeyCallback: srv.checkPublicKey,
+	}
+
+	for _, name := range cfg.HostKeys {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		srv.ssh.AddHostKey(key)
+	}
+
+	return srv, nil
+}
+
+func (srv *server) checkPassword(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+	u := srv.users[c.User()]
+	if u == nil || u.PasswordHash == "" {
+		return nil, fmt.Errorf("password rejected for %q", c.User())
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), pass); err != nil {
+		return nil, fmt.Errorf("password rejected for %q", c.User())
+	}
+	return nil, nil
+}
+
+func (srv *server) checkPublicKey(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	u := srv.users[c.User()]
+	if u == nil || !u.keys[string(key.Marshal())] {
+		return nil, fmt.Errorf("public key rejected for %q", c.User())
+	}
+	return nil, nil
+}
+
+func (srv *server) serveConn(nConn net.Conn) {
+	defer nConn.Close()
+
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, srv.ssh)
+	if err != nil {
+		log.Printf("%v: handshake failed: %v", nConn.RemoteAddr(), err)
+		return
+	}
+	defer conn.Close()
+
+	u := srv.users[conn.User()]
+	log.Printf("%v: logged in as %q", conn.RemoteAddr(), u.Name)
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Printf("%v: could not accept channel: %v", conn.RemoteAddr(), err)
+			continue
+		}
+
+		go srv.serveSession(conn, u, channel, requests)
+	}
+}
+
+// serveSession waits for SFTP to be requested on the session channel, as one of the subsystems,
+// or of the exec commands, of the configuration, and then serves it.
+func (srv *server) serveSession(conn *ssh.ServerConn, u *User, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	var requested bool
+	for req := range requests {
+		ok := srv.requestsSFTP(req)
+		req.Reply(ok, nil)
+
+		if ok {
+			requested = true
+			go ssh.DiscardRequests(requests)
+			break
+		}
+	}
+	if !requested {
+		return
+	}
+
+	fs := &rootFS{
+		root:     u.Root,
+		readOnly: u.ReadOnly,
+		quota:    srv.quotas[u.Name],
+	}
+
+	addr, name := conn.RemoteAddr(), u.Name
+	options := []sftp.RequestServerOption{
+		sftp.WithRSSessionEndHook(func(s *sftp.SessionSummary) {
+			log.Printf("%v: session of %q ended (%v) after %v: %d requests, %d files opened, %d bytes read, %d bytes written, %d errors",
+				addr, name, s.Reason, s.End.Sub(s.Start).Round(time.Millisecond), s.Requests, s.FilesOpened, s.BytesRead, s.BytesWritten, s.Errors)
+		}),
+	}
+	if srv.cfg.CaptureDir != "" {
+		capture, err := srv.capture(name)
+		if err != nil {
+			log.Printf("%v: unable to capture session: %v", addr, err)
+			return
+		}
+		defer capture.Close()
+
+		cw, err := sftp.NewCaptureWriter(capture)
+		if err != nil {
+			log.Printf("%v: unable to capture session: %v", addr, err)
+			return
+		}
+		options = append(options, sftp.WithRSCapture(cw))
+	}
+
+	server := sftp.NewRequestServer(channel, fs.handlers(), options...)
+	if err := server.Serve(); err != nil && err != io.EOF {
+		log.Printf("%v: sftp session of %q failed: %v", addr, name, err)
+	}
+	server.Close()
+}
+
+// requestsSFTP reports whether req is a request of a session channel to start SFTP:
+// a "subsystem" request for one of the subsystems, or an "exec" request to run one of the exec commands.
+func (srv *server) requestsSFTP(req *ssh.Request) bool {
+	var payload struct {
+		Value string // the name of the subsystem, or the command
+	}
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		return false
+	}
+
+	switch req.Type {
+	case "subsystem":
+		return contains(srv.cfg.Subsystems, payload.Value)
+	case "exec":
+		fields := strings.Fields(payload.Value)
+		return len(fields) > 0 && contains(srv.cfg.ExecCommands, fields[0])
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// capture creates the file to which a session of the named user is captured.
+func (srv *server) capture(name string) (*os.File, error) {
+	return ioutil.TempFile(srv.cfg.CaptureDir, fmt.Sprintf("%s-%s-*.sftpcap", name, time.Now().Format("20060102T150405")))
+}
@@ -0,0 +1,252 @@
+package sftp
+
+import (
+	"fmt"
+	"log"
+)
+
+// sshFxMaxHandleLength is the maximum length of a handle, from section 6.2 of the SFTP v3 draft.
+const sshFxMaxHandleLength = 256
+
+// ConformanceError describes a response which does not conform to SFTP v3,
+// as detected by a server running in strict conformance mode.
+type ConformanceError struct {
+	// ID is the id of the request being answered.
+	ID uint32
+
+	// Request and Response are the packet types of the request and of the response.
+	Request, Response fxp
+
+	// Reason describes the violation.
+	Reason string
+}
+
+func (e *ConformanceError) Error() string {
+	return fmt.Sprintf("sftp: non-conformant %v in response to %v (id %d): %s", e.Response, e.Request, e.ID, e.Reason)
+}
+
+// WithStrictConformance validates every response sent by the Server against SFTP v3:
+// the response type must be one allowed for the request, status codes must be those defined by v3,
+// handles must be non-empty and at most 256 bytes long, and NAME responses must carry
+// exactly one entry for REALPATH and READLINK, and at least one for READDIR.
+//
+// Violations are reported to onViolation, and the response is sent unchanged.
+// If onViolation is nil, they are logged with the standard logger.
+// Tests may pass PanicOnConformanceError, to fail loudly.
+// This is intended as a debugging aid, and adds overhead to every response.
+func WithStrictConformance(onViolation func(*ConformanceError)) ServerOption {
+	return func(s *Server) error {
+		s.pktMgr.conformance = conformanceReporter(onViolation)
+		return nil
+	}
+}
+
+// WithRSStrictConformance validates every response sent by the RequestServer against SFTP v3,
+// in the same way as WithStrictConformance.
+// This helps Handlers authors catch non-conformant replies that some clients tolerate and others don't.
+func WithRSStrictConformance(onViolation func(*ConformanceError)) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pktMgr.conformance = conformanceReporter(onViolation)
+	}
+}
+
+// PanicOnConformanceError panics with the violation err.
+// It may be passed to WithStrictConformance and WithRSStrictConformance,
+// so that a non-conformant response fails a test loudly, instead of being logged.
+func PanicOnConformanceError(err *ConformanceError) {
+	panic(err)
+}
+
+func conformanceReporter(onViolation func(*ConformanceError)) func(*ConformanceError) {
+	if onViolation == nil {
+		return func(err *ConformanceError) {
+			log.Print(err)
+		}
+	}
+	return onViolation
+}
+
+// responseType returns the packet type of the response packet, or 0 if it is not one known to checkConformance.
+// Every response type the servers send must be listed here, see TestResponseType.
+func responseType(resp responsePacket) fxp {
+	switch resp.(type) {
+	case *sshFxpStatusPacket:
+		return sshFxpStatus
+	case *sshFxpHandlePacket:
+		return sshFxpHandle
+	case *sshFxpDataPacket:
+		return sshFxpData
+	case *sshFxpNamePacket:
+		return sshFxpName
+	case *sshFxpStatResponse:
+		return sshFxpAttrs
+	case *StatVFS, *sshFxpLimitsResponse, *sshFxpCheckFileResponse, *sshFxpGenerationResponse:
+		return sshFxpExtendedReply
+	case *sshFxVersionPacket:
+		return sshFxpVersion
+	}
+	return 0
+}
+
+// requestType returns the packet type of the request packet.
+func requestType(req requestPacket) fxp {
+	switch req.(type) {
+	case *sshFxInitPacket:
+		return sshFxpInit
+	case *sshFxpOpenPacket:
+		return sshFxpOpen
+	case *sshFxpClosePacket:
+		return sshFxpClose
+	case *sshFxpReadPacket:
+		return sshFxpRead
+	case *sshFxpWritePacket:
+		return sshFxpWrite
+	case *sshFxpLstatPacket:
+		return sshFxpLstat
+	case *sshFxpFstatPacket:
+		return sshFxpFstat
+	case *sshFxpSetstatPacket:
+		return sshFxpSetstat
+	case *sshFxpFsetstatPacket:
+		return sshFxpFsetstat
+	case *sshFxpOpendirPacket:
+		return sshFxpOpendir
+	case *sshFxpReaddirPacket:
+		return sshFxpReaddir
+	case *sshFxpRemovePacket:
+		return sshFxpRemove
+	case *sshFxpMkdirPacket:
+		return sshFxpMkdir
+	case *sshFxpRmdirPacket:
+		return sshFxpRmdir
+	case *sshFxpRealpathPacket:
+		return sshFxpRealpath
+	case *sshFxpStatPacket:
+		return sshFxpStat
+	case *sshFxpRenamePacket:
+		return sshFxpRename
+	case *sshFxpReadlinkPacket:
+		return sshFxpReadlink
+	case *sshFxpSymlinkPacket:
+		return sshFxpSymlink
+	case *sshFxpExtendedPacket:
+		return sshFxpExtended
+	}
+	return 0
+}
+
+// replyType returns the reply type expected, in addition to STATUS, for the request req, if any.
+func replyType(req requestPacket) fxp {
+	switch requestType(req) {
+	case sshFxpOpen, sshFxpOpendir:
+		return sshFxpHandle
+	case sshFxpRead:
+		return sshFxpData
+	case sshFxpReaddir, sshFxpRealpath, sshFxpReadlink:
+		return sshFxpName
+	case sshFxpStat, sshFxpLstat, sshFxpFstat:
+		return sshFxpAttrs
+	case sshFxpExtended:
+		return extendedReplyType(req)
+	}
+	return 0
+}
+
+// extendedReplyType returns the reply type expected, in addition to STATUS, for the extended request req.
+func extendedReplyType(req requestPacket) fxp {
+	if epkt, ok := req.(*sshFxpExtendedPacket); ok {
+		switch epkt.SpecificPacket.(type) {
+		case *sshFxpExtendedPacketExpandPath:
+			return sshFxpName
+		}
+	}
+	return sshFxpExtendedReply
+}
+
+// checkConformance returns a non-nil error if resp is not a valid SFTP v3 response to req.
+func checkConformance(req requestPacket, resp responsePacket) *ConformanceError {
+	e := &ConformanceError{
+		ID:       req.id(),
+		Request:  requestType(req),
+		Response: responseType(resp),
+	}
+
+	fail := func(format string, args ...interface{}) *ConformanceError {
+		e.Reason = fmt.Sprintf(format, args...)
+		return e
+	}
+
+	if e.Response == 0 {
+		return fail("unrecognised response %T", resp)
+	}
+
+	if e.Request != sshFxpInit && resp.id() != req.id() {
+		return fail("response id %d does not match", resp.id())
+	}
+
+	if e.Request == sshFxpInit {
+		if e.Response != sshFxpVersion {
+			return fail("request expects only SSH_FXP_VERSION")
+		}
+		return nil
+	}
+
+	want := replyType(req)
+
+	switch resp := resp.(type) {
+	case *sshFxpStatusPacket:
+		if resp.Code > sshFxOPUnsupported {
+			return fail("status code %d is not defined by SFTP v3", resp.Code)
+		}
+		if resp.Code == sshFxOk && want != 0 && want != sshFxpExtendedReply {
+			return fail("request expects %v or an error status", want)
+		}
+		return nil
+
+	case *sshFxpHandlePacket:
+		if want == sshFxpHandle {
+			if len(resp.Handle) == 0 || len(resp.Handle) > sshFxMaxHandleLength {
+				return fail("handle length %d is not within 1 and %d bytes", len(resp.Handle), sshFxMaxHandleLength)
+			}
+			return nil
+		}
+
+	case *sshFxpDataPacket:
+		if want == sshFxpData {
+			if int(resp.Length) != len(resp.Data) {
+				return fail("data length %d does not match %d bytes of data", resp.Length, len(resp.Data))
+			}
+			if max := req.(*sshFxpReadPacket).Len; resp.Length > max {
+				return fail("%d bytes returned for a read of %d bytes", resp.Length, max)
+			}
+			return nil
+		}
+
+	case *sshFxpNamePacket:
+		if want == sshFxpName {
+			n := len(resp.NameAttrs)
+			switch {
+			case e.Request == sshFxpReaddir && n == 0:
+				return fail("no entries returned; end of directory must be signaled with SSH_FX_EOF")
+			case e.Request != sshFxpReaddir && n != 1:
+				return fail("%d entries returned, exactly one expected", n)
+			}
+			for _, attr := range resp.NameAttrs {
+				if attr.Name == "" {
+					return fail("entry with an empty filename")
+				}
+			}
+			return nil
+		}
+
+	default:
+		if want != 0 && want == e.Response {
+			return nil
+		}
+	}
+
+	if want == 0 {
+		return fail("request expects only SSH_FXP_STATUS")
+	}
+	return fail("request expects %v or SSH_FXP_STATUS", want)
+}
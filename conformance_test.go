@@ -0,0 +1,327 @@
+package sftp
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConformance(t *testing.T) {
+	name := func(n int) *sshFxpNamePacket {
+		p := &sshFxpNamePacket{ID: 1}
+		for i := 0; i < n; i++ {
+			p.NameAttrs = append(p.NameAttrs, &sshFxpNameAttr{Name: "foo"})
+		}
+		return p
+	}
+	status := func(code uint32) *sshFxpStatusPacket {
+		return &sshFxpStatusPacket{ID: 1, StatusError: StatusError{Code: code}}
+	}
+
+	tests := []struct {
+		name   string
+		req    requestPacket
+		resp   responsePacket
+		reason string
+	}{
+		{
+			name: "read data",
+			req:  &sshFxpReadPacket{ID: 1, Len: 4},
+			resp: &sshFxpDataPacket{ID: 1, Length: 4, Data: []byte("data")},
+		},
+		{
+			name: "read eof",
+			req:  &sshFxpReadPacket{ID: 1, Len: 4},
+			resp: status(sshFxEOF),
+		},
+		{
+			name:   "read ok",
+			req:    &sshFxpReadPacket{ID: 1, Len: 4},
+			resp:   status(sshFxOk),
+			reason: "request expects SSH_FXP_DATA or an error status",
+		},
+		{
+			name:   "read overlong",
+			req:    &sshFxpReadPacket{ID: 1, Len: 2},
+			resp:   &sshFxpDataPacket{ID: 1, Length: 4, Data: []byte("data")},
+			reason: "4 bytes returned for a read of 2 bytes",
+		},
+		{
+			name:   "mismatched id",
+			req:    &sshFxpRemovePacket{ID: 1},
+			resp:   &sshFxpStatusPacket{ID: 2},
+			reason: "response id 2 does not match",
+		},
+		{
+			name:   "status code out of range",
+			req:    &sshFxpRemovePacket{ID: 1},
+			resp:   status(sshFxOPUnsupported + 1),
+			reason: "status code 9 is not defined by SFTP v3",
+		},
+		{
+			name:   "unexpected reply type",
+			req:    &sshFxpMkdirPacket{ID: 1},
+			resp:   &sshFxpHandlePacket{ID: 1, Handle: "1"},
+			reason: "request expects only SSH_FXP_STATUS",
+		},
+		{
+			name:   "attrs for open",
+			req:    &sshFxpOpenPacket{ID: 1},
+			resp:   &sshFxpStatResponse{ID: 1},
+			reason: "request expects SSH_FXP_HANDLE or SSH_FXP_STATUS",
+		},
+		{
+			name:   "empty handle",
+			req:    &sshFxpOpendirPacket{ID: 1},
+			resp:   &sshFxpHandlePacket{ID: 1},
+			reason: "handle length 0 is not within 1 and 256 bytes",
+		},
+		{
+			name:   "overlong handle",
+			req:    &sshFxpOpenPacket{ID: 1},
+			resp:   &sshFxpHandlePacket{ID: 1, Handle: strings.Repeat("h", 257)},
+			reason: "handle length 257 is not within 1 and 256 bytes",
+		},
+		{
+			name: "readdir",
+			req:  &sshFxpReaddirPacket{ID: 1},
+			resp: name(3),
+		},
+		{
+			name:   "empty readdir",
+			req:    &sshFxpReaddirPacket{ID: 1},
+			resp:   name(0),
+			reason: "no entries returned; end of directory must be signaled with SSH_FX_EOF",
+		},
+		{
+			name: "realpath",
+			req:  &sshFxpRealpathPacket{ID: 1},
+			resp: name(1),
+		},
+		{
+			name:   "realpath with two names",
+			req:    &sshFxpRealpathPacket{ID: 1},
+			resp:   name(2),
+			reason: "2 entries returned, exactly one expected",
+		},
+		{
+			name:   "empty filename",
+			req:    &sshFxpReadlinkPacket{ID: 1},
+			resp:   &sshFxpNamePacket{ID: 1, NameAttrs: []*sshFxpNameAttr{{}}},
+			reason: "entry with an empty filename",
+		},
+		{
+			name: "extended reply",
+			req:  &sshFxpExtendedPacket{ID: 1, SpecificPacket: &sshFxpExtendedPacketStatVFS{ID: 1}},
+			resp: &StatVFS{ID: 1},
+		},
+		{
+			name: "extended status",
+			req:  &sshFxpExtendedPacket{ID: 1},
+			resp: status(sshFxOk),
+		},
+		{
+			name: "expand-path",
+			req:  &sshFxpExtendedPacket{ID: 1, SpecificPacket: &sshFxpExtendedPacketExpandPath{ID: 1}},
+			resp: name(1),
+		},
+		{
+			name:   "expand-path ok",
+			req:    &sshFxpExtendedPacket{ID: 1, SpecificPacket: &sshFxpExtendedPacketExpandPath{ID: 1}},
+			resp:   status(sshFxOk),
+			reason: "request expects SSH_FXP_NAME or an error status",
+		},
+		{
+			name:   "expand-path extended reply",
+			req:    &sshFxpExtendedPacket{ID: 1, SpecificPacket: &sshFxpExtendedPacketExpandPath{ID: 1}},
+			resp:   &StatVFS{ID: 1},
+			reason: "request expects SSH_FXP_NAME or SSH_FXP_STATUS",
+		},
+	}
+
+	for _, tt := range tests {
+		err := checkConformance(tt.req, tt.resp)
+		if tt.reason == "" {
+			assert.Nil(t, err, tt.name)
+			continue
+		}
+		if assert.NotNil(t, err, tt.name) {
+			assert.Equal(t, tt.reason, err.Reason, tt.name)
+		}
+	}
+}
+
+func TestRequestStrictConformance(t *testing.T) {
+	var mu sync.Mutex
+	var violations []*ConformanceError
+
+	p := clientRequestServerPair(t, WithRSStrictConformance(func(err *ConformanceError) {
+		mu.Lock()
+		defer mu.Unlock()
+		violations = append(violations, err)
+	}))
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	_, err = getTestFile(p.cli, "/foo")
+	require.NoError(t, err)
+
+	require.NoError(t, p.cli.Mkdir("/dir"))
+	require.NoError(t, p.cli.Rename("/foo", "/dir/foo"))
+
+	_, err = p.cli.ReadDir("/dir")
+	require.NoError(t, err)
+
+	_, err = p.cli.RealPath("/dir/../dir/foo")
+	require.NoError(t, err)
+
+	_, err = p.cli.ExpandPath("/dir/foo")
+	require.NoError(t, err)
+
+	_, err = p.cli.Stat("/missing")
+	require.Error(t, err)
+
+	require.NoError(t, p.cli.Remove("/dir/foo"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Empty(t, violations)
+}
+
+func TestRequestResponseOrdering(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i / 7)
+	}
+
+	for _, ordering := range []ResponseOrdering{ResponseOrderStrict, ResponseOrderPerHandle, ResponseOrderFree} {
+		var mu sync.Mutex
+		var violations []*ConformanceError
+
+		p := clientRequestServerPair(t, WithRSResponseOrdering(ordering), WithRSStrictConformance(func(err *ConformanceError) {
+			mu.Lock()
+			defer mu.Unlock()
+			violations = append(violations, err)
+		}))
+
+		w, err := p.cli.Create("/foo")
+		require.NoError(t, err)
+		_, err = w.ReadFromWithConcurrency(bytes.NewReader(data), 16)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		r, err := p.cli.Open("/foo")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = r.WriteTo(&buf)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, data, buf.Bytes(), "ordering %d", ordering)
+
+		p.Close()
+
+		mu.Lock()
+		assert.Empty(t, violations)
+		mu.Unlock()
+	}
+}
+
+// TestResponseType checks that responseType knows every response the servers send,
+// as the type they are encoded as, so that strict conformance does not reject a new reply.
+func TestResponseType(t *testing.T) {
+	responses := []responsePacket{
+		&sshFxpStatusPacket{},
+		&sshFxpHandlePacket{},
+		&sshFxpDataPacket{Data: make([]byte, 0, dataHeaderLen)},
+		&sshFxpNamePacket{},
+		&sshFxpStatResponse{info: &fileInfo{stat: &FileStat{}}},
+		&StatVFS{},
+		&sshFxpLimitsResponse{},
+		&sshFxpCheckFileResponse{},
+		&sshFxpGenerationResponse{},
+		&sshFxVersionPacket{},
+	}
+
+	known := make(map[string]bool)
+	for _, resp := range responses {
+		name := reflect.TypeOf(resp).Elem().Name()
+		known[name] = true
+
+		b, err := resp.MarshalBinary()
+		require.NoError(t, err, name)
+		assert.Equal(t, fxp(b[4]), responseType(resp), name)
+	}
+
+	// the responses returned by the servers, such as from respond, must all be listed above.
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+
+	for _, file := range pkgs["sftp"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || !returnsResponsePacket(fn) {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				ret, ok := n.(*ast.ReturnStmt)
+				if !ok {
+					return true
+				}
+				for _, res := range ret.Results {
+					if name := compositeTypeName(res); name != "" && name != "noResponse" {
+						assert.True(t, known[name], "%s returns %s, unknown to responseType", fn.Name.Name, name)
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	cerr := checkConformance(&sshFxpRemovePacket{ID: 1}, &noResponse{ID: 1})
+	if assert.NotNil(t, cerr) {
+		assert.Equal(t, "unrecognised response *sftp.noResponse", cerr.Reason)
+	}
+}
+
+func returnsResponsePacket(fn *ast.FuncDecl) bool {
+	if fn.Type.Results == nil {
+		return false
+	}
+	for _, field := range fn.Type.Results.List {
+		if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == "responsePacket" {
+			return true
+		}
+	}
+	return false
+}
+
+// compositeTypeName returns the name of the type T of an expression &T{...}, if it is one.
+func compositeTypeName(expr ast.Expr) string {
+	unary, ok := expr.(*ast.UnaryExpr)
+	if !ok || unary.Op != token.AND {
+		return ""
+	}
+	lit, ok := unary.X.(*ast.CompositeLit)
+	if !ok {
+		return ""
+	}
+	ident, ok := lit.Type.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	return ident.Name
+}
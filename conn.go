@@ -1,11 +1,14 @@
 package sftp
 
 import (
+	"bytes"
 	"context"
 	"encoding"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // conn implements a bidirectional channel on which client and server
@@ -16,6 +19,9 @@ type conn struct {
 	// this is the same allocator used in packet manager
 	alloc      *allocator
 	sync.Mutex // used to serialise writes to sendPacket
+
+	capture *CaptureWriter // if set, records every frame sent and received
+	tracer  PacketTracer   // if set, is called with every packet sent and received
 }
 
 // the orderID is used in server mode if the allocator is enabled.
@@ -23,14 +29,42 @@ type conn struct {
 // It returns io.EOF if the connection is closed and
 // there are no more packets to read.
 func (c *conn) recvPacket(orderID uint32) (uint8, []byte, error) {
-	return recvPacket(c, c.alloc, orderID)
+	typ, data, err := recvPacket(c, c.alloc, orderID)
+	if err == nil && c.capture != nil {
+		c.capture.writePacket(CaptureReceived, typ, data)
+	}
+	if err == nil && c.tracer != nil {
+		c.traceReceived(typ, data)
+	}
+	return typ, data, err
 }
 
 func (c *conn) sendPacket(m encoding.BinaryMarshaler) error {
 	c.Lock()
 	defer c.Unlock()
 
-	return sendPacket(c, m)
+	if c.capture == nil && c.tracer == nil {
+		return sendPacket(c, m)
+	}
+
+	// The frame is recorded before it is written,
+	// otherwise the response could be recorded before the request.
+	var frame bytes.Buffer
+	if err := sendPacket(&frame, m); err != nil {
+		return err
+	}
+
+	if c.capture != nil {
+		c.capture.WriteFrame(CaptureSent, time.Now(), frame.Bytes())
+	}
+	if c.tracer != nil {
+		c.trace(CaptureSent, frame.Bytes(), m)
+	}
+
+	if _, err := c.Write(frame.Bytes()); err != nil {
+		return fmt.Errorf("failed to send packet: %w", err)
+	}
+	return nil
 }
 
 func (c *conn) Close() error {
@@ -43,18 +77,42 @@ type clientConn struct {
 	conn
 	wg sync.WaitGroup
 
-	sync.Mutex                          // protects inflight
+	sync.Mutex                          // protects inflight and slots
 	inflight   map[uint32]chan<- result // outstanding requests
+	slots      map[uint32]chan struct{} // the limits from which outstanding requests hold a slot
+	nextid     uint32                   // accessed atomically, shared by every view of the Client
 
 	closed chan struct{}
 	err    error
+
+	stats *clientStats // if set, counts the packets sent and received
+
+	rateLimits rateLimits // see WithReadRateLimit and WithWriteRateLimit
+
+	requestTimeout time.Duration          // see WithRequestTimeout
+	timers         map[uint32]*time.Timer // the timeouts of outstanding requests, protected by the mutex
+	abandoned      map[uint32]time.Time   // requests timed out, and when, whose responses are dropped, protected by the mutex
+
+	session   *sessionStatus // if set, the SSH session of the Client, see NewClient
+	keepalive time.Duration  // see WithKeepalive
+
+	tolerateUnsolicited bool                         // if set, packets for no outstanding request are passed to onUnsolicited
+	onUnsolicited       func(typ uint8, data []byte) // see WithUnsolicitedPacketHandler
 }
 
 // Wait blocks until the conn has shut down, and return the error
 // causing the shutdown. It can be called concurrently from multiple
 // goroutines.
+//
+// For a Client created by NewClient, it also waits for the SSH session to end,
+// and if it ended with a failure, such as a non-zero exit status, the error is a *SessionError,
+// which includes what the server wrote to stderr.
 func (c *clientConn) Wait() error {
 	<-c.closed
+	if c.session != nil {
+		<-c.session.done
+		return c.session.error(c.err)
+	}
 	return c.err
 }
 
@@ -76,34 +134,68 @@ func (c *clientConn) recv() error {
 		}
 		sid, _, err := unmarshalUint32Safe(data)
 		if err != nil {
+			if c.tolerateUnsolicited {
+				c.unsolicited(typ, data)
+				continue
+			}
 			return err
 		}
 
 		ch, ok := c.getChannel(sid)
 		if !ok {
+			if c.dropAbandoned(sid) {
+				continue
+			}
+			if c.tolerateUnsolicited {
+				c.unsolicited(typ, data)
+				continue
+			}
+
 			// This is an unexpected occurrence. Send the error
 			// back to all listeners so that they terminate
 			// gracefully.
 			return fmt.Errorf("sid not found: %d", sid)
 		}
 
+		c.stats.received(typ, data)
 		ch <- result{typ: typ, data: data}
 	}
 }
 
-func (c *clientConn) putChannel(ch chan<- result, sid uint32) bool {
+// unsolicited passes a packet that answers no outstanding request to the handler, if any.
+func (c *clientConn) unsolicited(typ uint8, data []byte) {
+	debug("unsolicited packet: %v", fxp(typ))
+	if c.onUnsolicited != nil {
+		c.onUnsolicited(typ, data)
+	}
+}
+
+func (c *clientConn) putChannel(ch chan<- result, sid uint32, limit chan struct{}) bool {
 	c.Lock()
 	defer c.Unlock()
 
 	select {
 	case <-c.closed:
 		// already closed with broadcastErr, return error on chan.
+		if limit != nil {
+			<-limit
+		}
 		ch <- result{err: ErrSSHFxConnectionLost}
 		return false
 	default:
 	}
 
 	c.inflight[sid] = ch
+	c.stats.inflight(len(c.inflight))
+	if limit != nil {
+		c.slots[sid] = limit
+	}
+	if c.requestTimeout > 0 {
+		if c.timers == nil {
+			c.timers = make(map[uint32]*time.Timer)
+		}
+		c.timers[sid] = time.AfterFunc(c.requestTimeout, func() { c.timeout(sid) })
+	}
 	return true
 }
 
@@ -114,6 +206,16 @@ func (c *clientConn) getChannel(sid uint32) (chan<- result, bool) {
 	ch, ok := c.inflight[sid]
 	delete(c.inflight, sid)
 
+	if limit, ok := c.slots[sid]; ok {
+		delete(c.slots, sid)
+		<-limit
+	}
+
+	if timer, ok := c.timers[sid]; ok {
+		delete(c.timers, sid)
+		timer.Stop()
+	}
+
 	return ch, ok
 }
 
@@ -134,7 +236,7 @@ func (c *clientConn) sendPacket(ctx context.Context, ch chan result, p idmarshal
 		ch = make(chan result, 1)
 	}
 
-	c.dispatchRequest(ch, p)
+	c.dispatchRequestLimited(ctx, ch, p, nil)
 
 	select {
 	case <-ctx.Done():
@@ -147,13 +249,46 @@ func (c *clientConn) sendPacket(ctx context.Context, ch chan result, p idmarshal
 // dispatchRequest should ideally only be called by race-detection tests outside of this file,
 // where you have to ensure two packets are in flight sequentially after each other.
 func (c *clientConn) dispatchRequest(ch chan<- result, p idmarshaler) {
+	c.dispatchRequestLimited(context.Background(), ch, p, nil)
+}
+
+// dispatchRequestLimited is dispatchRequest, where the request must first take a slot from limit, if not nil,
+// waiting for one to be free, and gives it back once its response has been received, or it has failed.
+// If ctx is done while waiting on the rate limits or for a slot, the request is not sent, and ctx.Err() is delivered on ch.
+func (c *clientConn) dispatchRequestLimited(ctx context.Context, ch chan<- result, p idmarshaler, limit chan struct{}) {
 	sid := p.id()
 
-	if !c.putChannel(ch, sid) {
+	if err := c.rateLimits.wait(ctx, p); err != nil {
+		ch <- result{err: err}
+		return
+	}
+
+	if limit != nil {
+		select {
+		case limit <- struct{}{}:
+		case <-c.closed:
+			ch <- result{err: ErrSSHFxConnectionLost}
+			return
+		case <-ctx.Done():
+			ch <- result{err: ctx.Err()}
+			return
+		}
+
+		if err := ctx.Err(); err != nil {
+			// done while the slot was being taken, give it back.
+			<-limit
+			ch <- result{err: err}
+			return
+		}
+	}
+
+	if !c.putChannel(ch, sid, limit) {
 		// already closed.
 		return
 	}
 
+	c.stats.sent(p)
+
 	if err := c.conn.sendPacket(p); err != nil {
 		if ch, ok := c.getChannel(sid); ok {
 			ch <- result{err: err}
@@ -166,6 +301,13 @@ func (c *clientConn) broadcastErr(err error) {
 	c.Lock()
 	defer c.Unlock()
 
+	select {
+	case <-c.closed:
+		// already torn down, such as by a keepalive, see lose.
+		return
+	default:
+	}
+
 	bcastRes := result{err: ErrSSHFxConnectionLost}
 	for sid, ch := range c.inflight {
 		ch <- bcastRes
@@ -176,12 +318,57 @@ func (c *clientConn) broadcastErr(err error) {
 		c.inflight[sid] = make(chan<- result, 1)
 	}
 
+	// the timed out requests will get no response, nor will the others time out.
+	for sid, timer := range c.timers {
+		timer.Stop()
+		delete(c.timers, sid)
+	}
+	c.abandoned = nil
+
+	c.stats.lost()
 	c.err = err
 	close(c.closed)
 }
 
 type serverConn struct {
 	conn
+
+	shutdown int32 // set atomically, once Close has been called
+
+	clientExt atomic.Value // map[string]string, the extensions sent by the client in SSH_FXP_INIT
+
+	batches writeBatches // the unreported failures of writes under write-ack-batch@pkg.sftp
+}
+
+// ClientExtensions returns the extension pairs the client sent in SSH_FXP_INIT, mapped to their data.
+// It returns nil before SSH_FXP_INIT has been received.
+// The returned map is a copy, and may be modified by the caller.
+func (s *serverConn) ClientExtensions() map[string]string {
+	ext, _ := s.clientExt.Load().(map[string]string)
+	if ext == nil {
+		return nil
+	}
+
+	exts := make(map[string]string, len(ext))
+	for name, data := range ext {
+		exts[name] = data
+	}
+	return exts
+}
+
+// recordInit records the extensions sent by the client in SSH_FXP_INIT.
+func (s *serverConn) recordInit(p *sshFxInitPacket) {
+	ext := make(map[string]string, len(p.Extensions))
+	for _, pair := range p.Extensions {
+		ext[pair.Name] = pair.Data
+	}
+	s.clientExt.Store(ext)
+}
+
+// Close closes the connection, ending the session.
+func (s *serverConn) Close() error {
+	atomic.StoreInt32(&s.shutdown, 1)
+	return s.conn.Close()
 }
 
 func (s *serverConn) sendError(id uint32, err error) error {
@@ -0,0 +1,36 @@
+package sftp
+
+import (
+	"context"
+	"io"
+)
+
+// CopyContext copies from src to dst, as io.Copy, until either the end of src is reached, an error occurs,
+// or the context is done, in which case the error of the context is returned, with the number of bytes copied so far.
+//
+// If src or dst is a *File, the copy is done by its WriteToContext or ReadFromContext,
+// so that the requests in flight are abandoned once the context is done.
+// Otherwise, the context is checked before each read from src.
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	if f, ok := src.(*File); ok {
+		return f.WriteToContext(ctx, dst)
+	}
+	if f, ok := dst.(*File); ok {
+		return f.ReadFromContext(ctx, src)
+	}
+	return io.Copy(dst, contextReader{ctx, src})
+}
+
+// contextReader is an io.Reader that fails with the error of its context once it is done.
+// It deliberately hides any io.WriterTo of r, so that io.Copy reads through it.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
@@ -0,0 +1,119 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelReader returns its data in chunks of up to size bytes, and cancels its context on the read after the first.
+type cancelReader struct {
+	r      io.Reader
+	size   int
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(b []byte) (int, error) {
+	if r.reads++; r.reads > 1 {
+		r.cancel()
+	}
+	if len(b) > r.size {
+		b = b[:r.size]
+	}
+	return r.r.Read(b)
+}
+
+// cancelWriter cancels its context after the first write to it.
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(b []byte) (int, error) {
+	defer w.cancel()
+	return w.Buffer.Write(b)
+}
+
+func TestFileReadFromContext(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &cancelReader{r: strings.NewReader("hello world"), size: 6, cancel: cancel}
+	n, err := f.ReadFromContext(ctx, r)
+	assert.True(t, errors.Is(err, context.Canceled), "err = %v", err)
+	assert.EqualValues(t, 11, n)
+
+	off, err := f.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, off)
+
+	// the rest can be written once more, from where it stopped.
+	n, err = f.ReadFromContext(context.Background(), strings.NewReader("world"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	got, err := p.testHandler().fetch("/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(got.content))
+}
+
+func TestFileWriteToContext(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4*p.cli.maxPacket/16)
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	f, err = p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &cancelWriter{cancel: cancel}
+	n, err := f.WriteToContext(ctx, w)
+	assert.True(t, errors.Is(err, context.Canceled), "err = %v", err)
+	assert.EqualValues(t, w.Len(), n)
+	assert.Less(t, w.Len(), len(data))
+
+	off, err := f.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, n, off)
+
+	// a later WriteTo continues from there.
+	_, err = CopyContext(context.Background(), &w.Buffer, f)
+	require.NoError(t, err)
+	assert.Equal(t, data, w.Bytes())
+}
+
+func TestCopyContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	r := &cancelReader{r: strings.NewReader("hello world"), size: 6, cancel: cancel}
+	n, err := CopyContext(ctx, &buf, r)
+	assert.True(t, errors.Is(err, context.Canceled), "err = %v", err)
+	assert.EqualValues(t, 11, n)
+	assert.Equal(t, "hello world", buf.String())
+}
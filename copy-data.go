@@ -0,0 +1,381 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// errCopyDataOverlap is returned for a copy-data@openssh.com request within a single file,
+// from a range to an overlapping range after it, which would copy data already overwritten.
+var errCopyDataOverlap = errors.New("sftp: copy-data to an overlapping range of the same file")
+
+// CopyFileRange has the server copy length bytes of src, from the offset srcOff, to dst, at the offset dstOff,
+// without the data passing through the Client, as a remote cp.
+// A length of zero copies until the end of src.
+// src must be open for reading, and dst for writing, and they may be the same File,
+// as long as the range copied to does not start within the range copied from.
+//
+// It implements the copy-data@openssh.com SSH_FXP_EXTENDED feature.
+func (c *Client) CopyFileRange(src *File, srcOff int64, dst *File, dstOff int64, length int64) error {
+	if srcOff < 0 || dstOff < 0 || length < 0 {
+		return os.ErrInvalid
+	}
+
+	src.mu.RLock()
+	srcHandle := src.handle
+	src.mu.RUnlock()
+
+	dst.mu.RLock()
+	dstHandle := dst.handle
+	dst.mu.RUnlock()
+
+	if srcHandle == "" || dstHandle == "" {
+		return os.ErrClosed
+	}
+
+	id := c.nextID()
+	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpCopyDataPacket{
+		ID:          id,
+		ReadHandle:  srcHandle,
+		ReadOffset:  uint64(srcOff),
+		ReadLength:  uint64(length),
+		WriteHandle: dstHandle,
+		WriteOffset: uint64(dstOff),
+	})
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case sshFxpStatus:
+		return c.statusError(id, data)
+	default:
+		return unimplementedPacketErr(typ)
+	}
+}
+
+// CopyFile has the server copy the file src to dst, without the data passing through the Client.
+// If dst exists, it is replaced if overwrite is true, and otherwise the copy fails.
+//
+// It implements the copy-file SSH_FXP_EXTENDED feature, of the draft extensions of the protocol.
+// Servers which only implement copy-data@openssh.com can copy files with CopyFileRange.
+func (c *Client) CopyFile(src, dst string, overwrite bool) error {
+	id := c.nextID()
+	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpCopyFilePacket{
+		ID:          id,
+		Source:      src,
+		Destination: dst,
+		Overwrite:   overwrite,
+	})
+	if err != nil {
+		return err
+	}
+	switch typ {
+	case sshFxpStatus:
+		return c.statusError(id, data)
+	default:
+		return unimplementedPacketErr(typ)
+	}
+}
+
+// copyRange copies length bytes from src, at srcOff, to dst, at dstOff, or until the end of src if length is zero.
+func copyRange(dst io.WriterAt, dstOff int64, src io.ReaderAt, srcOff, length int64) error {
+	r := io.Reader(io.NewSectionReader(src, srcOff, 1<<63-1-srcOff))
+	if length > 0 {
+		r = io.LimitReader(r, length)
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := dst.WriteAt(buf[:n], dstOff); err != nil {
+				return err
+			}
+			dstOff += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyData copies the data of the copy-data request p between the open files of the RequestServer,
+// with the CopyData of the FileCmder, if it has one, or else through the io.ReaderAt and io.WriterAt of the files.
+func (rs *RequestServer) copyData(p *sshFxpExtendedPacketCopyData) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	src, ok := rs.getRequest(p.ReadHandle)
+	if !ok {
+		return EBADF
+	}
+	dst, ok := rs.getRequest(p.WriteHandle)
+	if !ok {
+		return EBADF
+	}
+
+	if cmder, ok := rs.Handlers.FileCmd.(CopyDataFileCmder); ok {
+		return cmder.CopyData(src, int64(p.ReadOffset), int64(p.ReadLength), dst, int64(p.WriteOffset))
+	}
+	return copyRequestData(src, int64(p.ReadOffset), int64(p.ReadLength), dst, int64(p.WriteOffset))
+}
+
+// copyRequestData copies length bytes of src, at srcOffset, to dst, at dstOffset, or until the end of src if length is zero,
+// through the io.ReaderAt and io.WriterAt of the open files of the requests.
+func copyRequestData(src *Request, srcOffset, length int64, dst *Request, dstOffset int64) error {
+	r := src.getReaderAt()
+	if r == nil {
+		if rw := src.getWriterAtReaderAt(); rw != nil {
+			r = rw
+		}
+	}
+	w := dst.getWriterAt()
+	if w == nil {
+		if rw := dst.getWriterAtReaderAt(); rw != nil {
+			w = rw
+		}
+	}
+	if r == nil || w == nil {
+		return EBADF
+	}
+
+	return copyRange(w, dstOffset, r, srcOffset, length)
+}
+
+// copyFile copies the file of the copy-file request p, through the FileReader and FileWriter of the Handlers,
+// as for the requests to open the source, for reading, and to create the destination, for writing.
+func (rs *RequestServer) copyFile(ctx context.Context, p *sshFxpExtendedPacketCopyFile) error {
+	src := NewRequest("Get", cleanPathWithBase(rs.startDirectory, p.Source)).WithContext(ctx)
+	src.Flags = sshFxfRead
+
+	r, err := rs.Handlers.FileGet.Fileread(src)
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	dst := NewRequest("Put", cleanPathWithBase(rs.startDirectory, p.Destination)).WithContext(ctx)
+	dst.Flags = sshFxfWrite | sshFxfCreat | sshFxfTrunc
+	if !p.Overwrite {
+		dst.Flags |= sshFxfExcl
+	}
+
+	w, err := rs.Handlers.FilePut.Filewrite(dst)
+	if err != nil {
+		return err
+	}
+
+	err = copyRange(w, 0, r, 0, 0)
+	if c, ok := w.(io.Closer); ok {
+		if err1 := c.Close(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// copyDataOverlaps reports whether the copy-data p, within a single file, copies to a range starting within the range copied from.
+func copyDataOverlaps(p *sshFxpExtendedPacketCopyData) bool {
+	if p.ReadHandle != p.WriteHandle || p.WriteOffset < p.ReadOffset {
+		return false
+	}
+	return p.ReadLength == 0 || p.WriteOffset < p.ReadOffset+p.ReadLength
+}
+
+type sshFxpCopyDataPacket struct {
+	ID          uint32
+	ReadHandle  string
+	ReadOffset  uint64
+	ReadLength  uint64
+	WriteHandle string
+	WriteOffset uint64
+}
+
+func (p *sshFxpCopyDataPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpCopyDataPacket) MarshalBinary() ([]byte, error) {
+	const ext = "copy-data@openssh.com"
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext) +
+		4 + len(p.ReadHandle) +
+		8 + 8 + // uint64 + uint64
+		4 + len(p.WriteHandle) +
+		8 // uint64
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+	b = marshalString(b, p.ReadHandle)
+	b = marshalUint64(b, p.ReadOffset)
+	b = marshalUint64(b, p.ReadLength)
+	b = marshalString(b, p.WriteHandle)
+	b = marshalUint64(b, p.WriteOffset)
+
+	return b, nil
+}
+
+type sshFxpCopyFilePacket struct {
+	ID          uint32
+	Source      string
+	Destination string
+	Overwrite   bool
+}
+
+func (p *sshFxpCopyFilePacket) id() uint32 { return p.ID }
+
+func (p *sshFxpCopyFilePacket) MarshalBinary() ([]byte, error) {
+	const ext = "copy-file"
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext) +
+		4 + len(p.Source) +
+		4 + len(p.Destination) +
+		1 // bool
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+	b = marshalString(b, p.Source)
+	b = marshalString(b, p.Destination)
+	if p.Overwrite {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+
+	return b, nil
+}
+
+type sshFxpExtendedPacketCopyData struct {
+	ID              uint32
+	ExtendedRequest string
+	ReadHandle      string
+	ReadOffset      uint64
+	ReadLength      uint64
+	WriteHandle     string
+	WriteOffset     uint64
+}
+
+func (p *sshFxpExtendedPacketCopyData) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketCopyData) readonly() bool { return false }
+func (p *sshFxpExtendedPacketCopyData) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.ReadHandle, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.ReadOffset, b, err = unmarshalUint64Safe(b); err != nil {
+		return err
+	} else if p.ReadLength, b, err = unmarshalUint64Safe(b); err != nil {
+		return err
+	} else if p.WriteHandle, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.WriteOffset, _, err = unmarshalUint64Safe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// check returns the error of a copy-data request with offsets, or a length, beyond those of a file,
+// or within a single file, to an overlapping range.
+func (p *sshFxpExtendedPacketCopyData) check() error {
+	if int64(p.ReadOffset) < 0 || int64(p.ReadLength) < 0 || int64(p.WriteOffset) < 0 {
+		return syscall.EINVAL
+	}
+	if copyDataOverlaps(p) {
+		return errCopyDataOverlap
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketCopyData) respond(s *Server) responsePacket {
+	if err := p.check(); err != nil {
+		return statusFromError(p.ID, err)
+	}
+
+	src, ok := s.getHandle(p.ReadHandle)
+	if !ok {
+		return statusFromError(p.ID, EBADF)
+	}
+	dst, ok := s.getHandle(p.WriteHandle)
+	if !ok {
+		return statusFromError(p.ID, EBADF)
+	}
+
+	err := copyRange(dst, int64(p.WriteOffset), src, int64(p.ReadOffset), int64(p.ReadLength))
+	return statusFromError(p.ID, err)
+}
+
+type sshFxpExtendedPacketCopyFile struct {
+	ID              uint32
+	ExtendedRequest string
+	Source          string
+	Destination     string
+	Overwrite       bool
+}
+
+func (p *sshFxpExtendedPacketCopyFile) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketCopyFile) readonly() bool { return false }
+func (p *sshFxpExtendedPacketCopyFile) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Source, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Destination, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if len(b) < 1 {
+		return errShortPacket
+	}
+	p.Overwrite = b[0] != 0
+	return nil
+}
+
+// respond copies the file, with its permissions.
+func (p *sshFxpExtendedPacketCopyFile) respond(s *Server) responsePacket {
+	src, err := os.Open(s.toLocalPath(p.Source))
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !p.Overwrite {
+		flags |= os.O_EXCL
+	}
+
+	dst, err := os.OpenFile(s.toLocalPath(p.Destination), flags, fi.Mode().Perm())
+	if err != nil {
+		status := statusFromError(p.ID, err)
+		if os.IsExist(err) {
+			// the extension defines this code for an existing destination, whatever the version of the protocol.
+			status.Code = sshFxFileAlreadyExists
+		}
+		return status
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return statusFromError(p.ID, err)
+	}
+	return statusFromError(p.ID, dst.Close())
+}
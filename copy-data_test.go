@@ -0,0 +1,156 @@
+package sftp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCopyFileRange(t *testing.T) {
+	dir := t.TempDir()
+	srcName, dstName := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require.NoError(t, ioutil.WriteFile(srcName, []byte("0123456789"), 0o644))
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	src, err := client.Open(srcName)
+	require.NoError(t, err)
+	defer src.Close()
+
+	dst, err := client.OpenFile(dstName, os.O_RDWR|os.O_CREATE)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	require.NoError(t, client.CopyFileRange(src, 2, dst, 0, 4))
+	b, err := ioutil.ReadFile(dstName)
+	require.NoError(t, err)
+	assert.Equal(t, "2345", string(b))
+
+	// a length of zero copies to the end.
+	require.NoError(t, client.CopyFileRange(src, 5, dst, 4, 0))
+	b, err = ioutil.ReadFile(dstName)
+	require.NoError(t, err)
+	assert.Equal(t, "234556789", string(b))
+
+	// within the same file, to an earlier range.
+	require.NoError(t, client.CopyFileRange(dst, 4, dst, 0, 2))
+	b, err = ioutil.ReadFile(dstName)
+	require.NoError(t, err)
+	assert.Equal(t, "564556789", string(b))
+
+	// but not to a range which overlaps the end of the range copied from.
+	assert.Error(t, client.CopyFileRange(dst, 0, dst, 2, 4))
+	assert.Error(t, client.CopyFileRange(dst, 0, dst, 2, 0))
+
+	// the destination must be open for writing.
+	assert.Error(t, client.CopyFileRange(dst, 0, src, 0, 1))
+}
+
+func TestClientCopyFile(t *testing.T) {
+	skipIfWindows(t) // permissions
+
+	dir := t.TempDir()
+	srcName, dstName := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require.NoError(t, ioutil.WriteFile(srcName, []byte("contents"), 0o600))
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	require.NoError(t, client.CopyFile(srcName, dstName, false))
+
+	b, err := ioutil.ReadFile(dstName)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(b))
+
+	fi, err := os.Stat(dstName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	require.NoError(t, ioutil.WriteFile(srcName, []byte("new"), 0o600))
+
+	err = client.CopyFile(srcName, dstName, false)
+	assert.ErrorIs(t, err, ErrSSHFxFileAlreadyExists)
+
+	require.NoError(t, client.CopyFile(srcName, dstName, true))
+	b, err = ioutil.ReadFile(dstName)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(b))
+}
+
+type copyDataCmder struct {
+	FileCmder
+	calls int
+	paths []string
+}
+
+func (c *copyDataCmder) CopyData(src *Request, srcOffset, length int64, dst *Request, dstOffset int64) error {
+	c.calls++
+	c.paths = append(c.paths, src.Filepath, dst.Filepath)
+	return copyRange(dst.getWriterAt(), dstOffset, src.getReaderAt(), srcOffset, length)
+}
+
+func TestRequestCopyData(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/src", "0123456789")
+	require.NoError(t, err)
+
+	src, err := p.cli.Open("/src")
+	require.NoError(t, err)
+	defer src.Close()
+
+	dst, err := p.cli.Create("/dst")
+	require.NoError(t, err)
+	defer dst.Close()
+
+	require.NoError(t, p.cli.CopyFileRange(src, 2, dst, 0, 0))
+
+	f, err := p.testHandler().fetch("/dst")
+	require.NoError(t, err)
+	assert.Equal(t, "23456789", string(f.content))
+
+	require.NoError(t, p.cli.CopyFile("/src", "/copy", false))
+	f, err = p.testHandler().fetch("/copy")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(f.content))
+
+	assert.Error(t, p.cli.CopyFile("/dst", "/copy", false))
+	require.NoError(t, p.cli.CopyFile("/dst", "/copy", true))
+	f, err = p.testHandler().fetch("/copy")
+	require.NoError(t, err)
+	assert.Equal(t, "23456789", string(f.content))
+}
+
+func TestRequestCopyDataFileCmder(t *testing.T) {
+	handlers := InMemHandler()
+	cmder := &copyDataCmder{FileCmder: handlers.FileCmd}
+	handlers.FileCmd = cmder
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/src", "0123456789")
+	require.NoError(t, err)
+
+	src, err := p.cli.Open("/src")
+	require.NoError(t, err)
+	defer src.Close()
+
+	dst, err := p.cli.OpenFile("/dst", os.O_WRONLY|os.O_CREATE)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	require.NoError(t, p.cli.CopyFileRange(src, 0, dst, 0, 4))
+	assert.Equal(t, 1, cmder.calls)
+
+	f, err := p.testHandler().fetch("/dst")
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(f.content))
+}
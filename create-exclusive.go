@@ -0,0 +1,80 @@
+package sftp
+
+import (
+	"context"
+	"os"
+	"syscall"
+)
+
+// CreateExclusive creates the named file, for reading and writing, with the permissions perm, before the umask of the server,
+// failing if it already exists, as os.OpenFile with O_CREATE|O_EXCL.
+// It allows one of several clients racing to create the same file to claim it.
+//
+// If the file already exists, the error is an *os.PathError wrapping os.ErrExist, so that os.IsExist reports true,
+// whether the server sends SSH_FX_FILE_ALREADY_EXISTS, or, as servers of version 3 of the protocol do, a generic failure,
+// in which case the existence of the file is checked with Lstat.
+func (c *Client) CreateExclusive(name string, perm os.FileMode) (*File, error) {
+	attrs := &FileStat{Mode: toChmodPerm(perm)}
+
+	p := &sshFxpOpenPacket{
+		Path:   name,
+		Pflags: toPflags(os.O_RDWR | os.O_CREATE | os.O_EXCL),
+		Flags:  sshFileXferAttrPermissions,
+		Attrs:  attrs,
+	}
+	if c.compat.OpenAttrsBySetstat {
+		p.Flags, p.Attrs = 0, nil
+	}
+
+	f, err := c.openPacket(context.Background(), p)
+	if err != nil {
+		if c.existsAfter(name, err) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		return nil, err
+	}
+
+	if c.compat.OpenAttrsBySetstat {
+		_ = c.fsetstat(f.handle, sshFileXferAttrPermissions, attrs)
+	}
+	return f, nil
+}
+
+// EnsureDir creates the directory name, with the permissions perm, unless it already exists,
+// and so, unlike Mkdir, succeeds if another client creates it concurrently.
+// The parent of the directory must exist, see MkdirAll to create it.
+//
+// The permissions are only set if the directory is created by this call, with Chmod, and so are not subject to the umask of the server.
+// If name exists, but is not a directory, an *os.PathError wrapping syscall.ENOTDIR is returned.
+func (c *Client) EnsureDir(name string, perm os.FileMode) error {
+	err := c.Mkdir(name)
+	if err == nil {
+		return c.Chmod(name, perm)
+	}
+
+	fi, err1 := c.Stat(name)
+	if err1 != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// existsAfter reports whether err, from the exclusive creation of name, means that name already exists.
+func (c *Client) existsAfter(name string, err error) bool {
+	status, ok := err.(*StatusError)
+	if !ok {
+		return false
+	}
+
+	switch status.Code {
+	case sshFxFileAlreadyExists:
+		return true
+	case sshFxFailure:
+		_, err := c.Lstat(name)
+		return err == nil
+	}
+	return false
+}
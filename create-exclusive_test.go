@@ -0,0 +1,88 @@
+package sftp
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCreateExclusive(t *testing.T) {
+	skipIfWindows(t) // permissions
+	dir := t.TempDir()
+	name := filepath.Join(dir, "claimed")
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	f, err := client.CreateExclusive(name, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	_, err = client.CreateExclusive(name, 0o600)
+	assert.True(t, os.IsExist(err), err)
+	assert.True(t, errors.Is(err, os.ErrExist))
+
+	b, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(b))
+
+	_, err = client.CreateExclusive(filepath.Join(dir, "missing", "file"), 0o600)
+	assert.False(t, os.IsExist(err))
+	assert.True(t, os.IsNotExist(err), err)
+}
+
+func TestClientExistsAfter(t *testing.T) {
+	assert.False(t, (&Client{}).existsAfter("/foo", os.ErrNotExist))
+	assert.True(t, (&Client{}).existsAfter("/foo", &StatusError{Code: sshFxFileAlreadyExists}))
+	assert.False(t, (&Client{}).existsAfter("/foo", &StatusError{Code: sshFxPermissionDenied}))
+}
+
+func TestClientEnsureDir(t *testing.T) {
+	skipIfWindows(t) // permissions
+	dir := t.TempDir()
+	name := filepath.Join(dir, "shared")
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = client.EnsureDir(name, 0o750)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, os.FileMode(0o750), fi.Mode().Perm())
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0o644))
+
+	err = client.EnsureDir(file, 0o750)
+	assert.True(t, errors.Is(err, syscall.ENOTDIR), err)
+}
@@ -0,0 +1,64 @@
+package sftp
+
+import "fmt"
+
+// FileCreation describes the effect of an SSH_FXP_OPEN for writing on the file it opened,
+// so that audit records can tell new files apart from overwritten ones.
+type FileCreation int
+
+// Effects of opening a file for writing.
+const (
+	// FileCreated means the file did not exist, and was created empty.
+	FileCreated FileCreation = iota + 1
+
+	// FileTruncated means the file already existed, and was truncated to zero length.
+	FileTruncated
+)
+
+func (c FileCreation) String() string {
+	switch c {
+	case FileCreated:
+		return "created"
+	case FileTruncated:
+		return "truncated"
+	default:
+		return fmt.Sprintf("FileCreation(%d)", int(c))
+	}
+}
+
+// WithCreateHook sets a function to be called whenever an SSH_FXP_OPEN creates or truncates a file,
+// with the path as sent by the client.
+// The hook is called once the file has been opened, even if the client then closes it without writing to it,
+// which is how empty files are uploaded.
+//
+// Whether the file existed is checked just before it is opened,
+// so the hook may misreport a file created or removed concurrently by another process.
+func WithCreateHook(hook func(path string, how FileCreation)) ServerOption {
+	return func(s *Server) error {
+		s.createHook = hook
+		return nil
+	}
+}
+
+// WithRSCreateHook sets a function to be called whenever an SSH_FXP_OPEN creates or truncates a file,
+// in the same way as WithCreateHook.
+// Whether the file existed is checked by a "Stat" request to the FileList handler, before the file is opened.
+func WithRSCreateHook(hook func(path string, how FileCreation)) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.createHook = hook
+	}
+}
+
+// creation returns the effect of an open with the given flags on a file which existed, or not,
+// and whether it should be reported to a create hook.
+func creation(pflags uint32, existed bool) (FileCreation, bool) {
+	switch {
+	case pflags&sshFxfWrite == 0:
+		return 0, false
+	case !existed && pflags&sshFxfCreat != 0:
+		return FileCreated, true
+	case existed && pflags&sshFxfTrunc != 0:
+		return FileTruncated, true
+	}
+	return 0, false
+}
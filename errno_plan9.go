@@ -21,8 +21,16 @@ func translateErrno(errno syscall.ErrorString) uint32 {
 		return sshFxOk
 	case syscall.ENOENT:
 		return sshFxNoSuchFile
-	case syscall.EPERM:
+	case syscall.EPERM, syscall.EACCES:
 		return sshFxPermissionDenied
+	case syscall.EEXIST:
+		return sshFxFileAlreadyExists
+	case syscall.ENOTDIR:
+		return sshFxNotADirectory
+	case syscall.ENAMETOOLONG:
+		return sshFxInvalidFilename
+	case syscall.EISDIR:
+		return sshFxFileIsADirectory
 	}
 
 	return sshFxFailure
@@ -37,6 +45,11 @@ func translateSyscallError(err error) (uint32, bool) {
 		if errno, ok := e.Err.(syscall.ErrorString); ok {
 			return translateErrno(errno), true
 		}
+	case *os.LinkError:
+		// from a rename, or a link.
+		if errno, ok := e.Err.(syscall.ErrorString); ok {
+			return translateErrno(errno), true
+		}
 	}
 	return 0, false
 }
@@ -18,6 +18,9 @@ func wrapPathError(filepath string, err error) error {
 }
 
 // translateErrno translates a syscall error number to a SFTP error code.
+//
+// Where a later version of the protocol has a more precise code than SSH_FX_FAILURE, that code is used,
+// as clients of version 3 that do not know it still treat it as a failure, with the same message.
 func translateErrno(errno syscall.Errno) uint32 {
 	switch errno {
 	case 0:
@@ -26,9 +29,29 @@ func translateErrno(errno syscall.Errno) uint32 {
 		return sshFxNoSuchFile
 	case syscall.EACCES, syscall.EPERM:
 		return sshFxPermissionDenied
+	case syscall.ENOSYS, syscall.ENOTSUP, syscall.EXDEV:
+		// a rename across filesystems is an operation the server does not support,
+		// which the client can do itself, by copying.
+		return sshFxOPUnsupported
+	case syscall.EEXIST:
+		return sshFxFileAlreadyExists
+	case syscall.EROFS:
+		return sshFxWriteProtect
+	case syscall.ENOSPC:
+		return sshFxNoSpaceOnFilesystem
+	case syscall.EDQUOT:
+		return sshFxQuotaExceeded
+	case syscall.ENOTDIR:
+		return sshFxNotADirectory
+	case syscall.ENAMETOOLONG:
+		return sshFxInvalidFilename
+	case syscall.ELOOP:
+		return sshFxLinkLoop
+	case syscall.EISDIR:
+		return sshFxFileIsADirectory
 	}
 
-	return sshFxFailure
+	return translatePlatformErrno(errno)
 }
 
 func translateSyscallError(err error) (uint32, bool) {
@@ -40,6 +63,11 @@ func translateSyscallError(err error) (uint32, bool) {
 		if errno, ok := e.Err.(syscall.Errno); ok {
 			return translateErrno(errno), true
 		}
+	case *os.LinkError:
+		// from a rename, or a link.
+		if errno, ok := e.Err.(syscall.Errno); ok {
+			return translateErrno(errno), true
+		}
 	}
 	return 0, false
 }
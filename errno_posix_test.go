@@ -0,0 +1,110 @@
+//go:build !plan9
+// +build !plan9
+
+package sftp
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errnoTests = []struct {
+	err error
+	fx  fxerr
+}{
+	{err: syscall.ENOENT, fx: ErrSSHFxNoSuchFile},
+	{err: syscall.EACCES, fx: ErrSSHFxPermissionDenied},
+	{err: syscall.EXDEV, fx: ErrSSHFxOpUnsupported},
+	{err: syscall.ENOSYS, fx: ErrSSHFxOpUnsupported},
+	{err: syscall.EEXIST, fx: ErrSSHFxFileAlreadyExists},
+	{err: syscall.EROFS, fx: ErrSSHFxWriteProtect},
+	{err: syscall.ENOSPC, fx: ErrSSHFxNoSpaceOnFilesystem},
+	{err: syscall.EDQUOT, fx: ErrSSHFxQuotaExceeded},
+	{err: syscall.ENOTEMPTY, fx: ErrSSHFxDirNotEmpty},
+	{err: syscall.ENOTDIR, fx: ErrSSHFxNotADirectory},
+	{err: syscall.ENAMETOOLONG, fx: ErrSSHFxInvalidFilename},
+	{err: syscall.ELOOP, fx: ErrSSHFxLinkLoop},
+	{err: syscall.EISDIR, fx: ErrSSHFxFileIsADirectory},
+	{err: syscall.EIO, fx: ErrSSHFxFailure},
+	{err: &os.PathError{Op: "open", Path: "/foo", Err: syscall.ENOSPC}, fx: ErrSSHFxNoSpaceOnFilesystem},
+	{err: &os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.EXDEV}, fx: ErrSSHFxOpUnsupported},
+}
+
+func TestTranslateErrno(t *testing.T) {
+	for _, tt := range errnoTests {
+		status := statusFromError(1, tt.err)
+		code := status.Code
+		if status.extended != 0 {
+			code = status.extended
+		}
+		assert.Equal(t, tt.fx, fxerr(code), "%v", tt.err)
+		assert.Equal(t, v3StatusCode(uint32(tt.fx)), status.Code, "%v", tt.err)
+		assert.Equal(t, tt.err.Error(), status.msg)
+	}
+}
+
+// TestErrnoStrictConformance answers a request with each error through a Server in strict conformance mode.
+func TestErrnoStrictConformance(t *testing.T) {
+	failWith := func(next ServerHandler) ServerHandler {
+		return func(req *ServerRequest) error {
+			if i, err := strconv.Atoi(path.Base(req.Paths[0])); err == nil && req.Op == "SSH_FXP_STAT" {
+				return errnoTests[i].err
+			}
+			return next(req)
+		}
+	}
+
+	stat := func(options ...ServerOption) (codes []fxerr, violations []*ConformanceError) {
+		var mu sync.Mutex
+		options = append(options, WithServerMiddleware(failWith), WithStrictConformance(func(err *ConformanceError) {
+			mu.Lock()
+			defer mu.Unlock()
+			violations = append(violations, err)
+		}))
+		client, server := clientServerPair(t, options...)
+		defer client.Close()
+		defer server.Close()
+
+		for i := range errnoTests {
+			_, err := client.Stat("/errno/" + strconv.Itoa(i))
+			// the Client returns the os errors for SSH_FX_NO_SUCH_FILE and SSH_FX_PERMISSION_DENIED.
+			switch {
+			case os.IsNotExist(err):
+				codes = append(codes, ErrSSHFxNoSuchFile)
+			case os.IsPermission(err):
+				codes = append(codes, ErrSSHFxPermissionDenied)
+			default:
+				var status *StatusError
+				require.ErrorAs(t, err, &status)
+				codes = append(codes, status.FxCode())
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return codes, violations
+	}
+
+	codes, violations := stat()
+	assert.Empty(t, violations)
+	extended := 0
+	for i, tt := range errnoTests {
+		assert.Equal(t, fxerr(v3StatusCode(uint32(tt.fx))), codes[i], "%v", tt.err)
+		if uint32(tt.fx) > sshFxOPUnsupported {
+			extended++
+		}
+	}
+
+	// the codes of later versions of the protocol are sent only when asked for, and are then reported.
+	codes, violations = stat(WithExtendedStatusCodes())
+	assert.Len(t, violations, extended)
+	for i, tt := range errnoTests {
+		assert.Equal(t, tt.fx, codes[i], "%v", tt.err)
+	}
+}
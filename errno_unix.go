@@ -0,0 +1,16 @@
+//go:build !plan9 && !windows
+// +build !plan9,!windows
+
+package sftp
+
+import "syscall"
+
+// translatePlatformErrno translates a syscall error number that translateErrno does not know to a SFTP error code.
+func translatePlatformErrno(errno syscall.Errno) uint32 {
+	// on AIX, ENOTEMPTY is the same number as EEXIST, so it cannot be a case of the same switch.
+	if errno == syscall.ENOTEMPTY {
+		return sshFxDirNotEmpty
+	}
+
+	return sshFxFailure
+}
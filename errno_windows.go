@@ -0,0 +1,45 @@
+package sftp
+
+import "syscall"
+
+// Windows error codes that the syscall package does not define.
+const (
+	errorNotSameDevice       syscall.Errno = 17
+	errorWriteProtect        syscall.Errno = 19
+	errorHandleDiskFull      syscall.Errno = 39
+	errorNotSupported        syscall.Errno = 50
+	errorDiskFull            syscall.Errno = 112
+	errorInvalidName         syscall.Errno = 123
+	errorFilenameExcedRange  syscall.Errno = 206
+	errorDirectory           syscall.Errno = 267
+	errorCantResolveFilename syscall.Errno = 1921
+)
+
+// translatePlatformErrno translates a Windows error code to a SFTP error code,
+// as the errors of the os package on Windows are Windows error codes, rather than those translateErrno knows.
+func translatePlatformErrno(errno syscall.Errno) uint32 {
+	switch errno {
+	case syscall.ERROR_FILE_NOT_FOUND, syscall.ERROR_PATH_NOT_FOUND:
+		return sshFxNoSuchFile
+	case syscall.ERROR_ACCESS_DENIED, syscall.ERROR_PRIVILEGE_NOT_HELD:
+		return sshFxPermissionDenied
+	case errorNotSupported, errorNotSameDevice:
+		return sshFxOPUnsupported
+	case syscall.ERROR_FILE_EXISTS, syscall.ERROR_ALREADY_EXISTS:
+		return sshFxFileAlreadyExists
+	case errorWriteProtect:
+		return sshFxWriteProtect
+	case errorDiskFull, errorHandleDiskFull:
+		return sshFxNoSpaceOnFilesystem
+	case syscall.ERROR_DIR_NOT_EMPTY, syscall.ENOTEMPTY:
+		return sshFxDirNotEmpty
+	case errorDirectory:
+		return sshFxNotADirectory
+	case errorInvalidName, errorFilenameExcedRange:
+		return sshFxInvalidFilename
+	case errorCantResolveFilename:
+		return sshFxLinkLoop
+	}
+
+	return sshFxFailure
+}
@@ -0,0 +1,37 @@
+package sftp
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateWindowsErrno(t *testing.T) {
+	table := []struct {
+		err error
+		fx  fxerr
+	}{
+		{err: syscall.ERROR_PATH_NOT_FOUND, fx: ErrSSHFxNoSuchFile},
+		{err: syscall.ERROR_ACCESS_DENIED, fx: ErrSSHFxPermissionDenied},
+		{err: errorNotSameDevice, fx: ErrSSHFxOpUnsupported},
+		{err: syscall.ERROR_FILE_EXISTS, fx: ErrSSHFxFileAlreadyExists},
+		{err: errorWriteProtect, fx: ErrSSHFxWriteProtect},
+		{err: errorDiskFull, fx: ErrSSHFxNoSpaceOnFilesystem},
+		{err: syscall.ERROR_DIR_NOT_EMPTY, fx: ErrSSHFxDirNotEmpty},
+		{err: errorDirectory, fx: ErrSSHFxNotADirectory},
+		{err: errorFilenameExcedRange, fx: ErrSSHFxInvalidFilename},
+		{err: errorCantResolveFilename, fx: ErrSSHFxLinkLoop},
+		{err: &os.LinkError{Op: "rename", Old: `C:\a`, New: `D:\b`, Err: errorNotSameDevice}, fx: ErrSSHFxOpUnsupported},
+	}
+	for _, tt := range table {
+		status := statusFromError(1, tt.err)
+		code := status.Code
+		if status.extended != 0 {
+			code = status.extended
+		}
+		assert.Equal(t, tt.fx, fxerr(code), "%v", tt.err)
+		assert.Equal(t, v3StatusCode(uint32(tt.fx)), status.Code, "%v", tt.err)
+	}
+}
@@ -0,0 +1,73 @@
+package sftp
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrTooManyLinks is recognized by UseErrorMessageDecoding for a failure because a file has too many links,
+// for which there is no SFTP status code.
+var ErrTooManyLinks = errors.New("too many links")
+
+// statusMessages are the well-known texts of the messages of SSH_FX_FAILURE statuses,
+// in lower case, as sent by servers that pass on the error message of the system, such as strerror,
+// and the errors they are recognized as.
+// A text that contains another is listed before it.
+var statusMessages = []struct {
+	text string
+	err  error
+}{
+	{"no space left on device", ErrSSHFxNoSpaceOnFilesystem},
+	{"not enough space on the disk", ErrSSHFxNoSpaceOnFilesystem},
+	{"quota exceeded", ErrSSHFxQuotaExceeded},
+	{"file exists", ErrSSHFxFileAlreadyExists},
+	{"already exists", ErrSSHFxFileAlreadyExists},
+	{"directory not empty", ErrSSHFxDirNotEmpty},
+	{"directory is not empty", ErrSSHFxDirNotEmpty},
+	{"not a directory", ErrSSHFxNotADirectory},
+	{"is a directory", ErrSSHFxFileIsADirectory},
+	{"read-only file system", ErrSSHFxWriteProtect},
+	{"too many levels of symbolic links", ErrSSHFxLinkLoop},
+	{"too many links", ErrTooManyLinks},
+	{"file name too long", ErrSSHFxInvalidFilename},
+	{"cross-device link", ErrSSHFxOpUnsupported},
+}
+
+// UseErrorMessageDecoding sets whether the Client recognizes the well-known messages of generic failures,
+// such as "No space left on device", or "Too many links", from servers that only send SSH_FX_FAILURE,
+// with the message of the error on the server, where later versions of the protocol have a precise status code.
+//
+// A recognized failure is still returned as the *StatusError, with the code sent by the server,
+// but it wraps the error recognized, such as ErrSSHFxNoSpaceOnFilesystem, or ErrTooManyLinks,
+// so that errors.Is(err, ErrSSHFxNoSpaceOnFilesystem) is true whether the server sent the code, or the message.
+//
+// Messages are matched in any case, but only in English, and so this is a fallback, which can be wrong,
+// for instance where the name of a file contains one of the messages.
+func UseErrorMessageDecoding(value bool) ClientOption {
+	return func(c *Client) error {
+		c.decodeErrorMessages = value
+		return nil
+	}
+}
+
+// decodeStatusMessage returns the error recognized from the message of a SSH_FX_FAILURE status,
+// or nil if there is none.
+func decodeStatusMessage(msg string) error {
+	msg = strings.ToLower(msg)
+	for _, m := range statusMessages {
+		if strings.Contains(msg, m.text) {
+			return m.err
+		}
+	}
+	return nil
+}
+
+// statusError converts the SSH_FXP_STATUS response to the request id into an error, as normaliseError,
+// recognizing the message of a generic failure if the Client decodes error messages.
+func (c *Client) statusError(id uint32, data []byte) error {
+	err := normaliseError(unmarshalStatus(id, data))
+	if status, ok := err.(*StatusError); ok && status.Code == sshFxFailure && c.decodeErrorMessages {
+		status.decoded = decodeStatusMessage(status.msg)
+	}
+	return err
+}
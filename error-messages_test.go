@@ -0,0 +1,71 @@
+package sftp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingCmder struct {
+	err error
+}
+
+func (c failingCmder) Filecmd(*Request) error { return c.err }
+
+func TestDecodeStatusMessage(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want error
+	}{
+		{"mkdir /foo: no space left on device", ErrSSHFxNoSpaceOnFilesystem},
+		{"No space left on device", ErrSSHFxNoSpaceOnFilesystem},
+		{"Disk quota exceeded", ErrSSHFxQuotaExceeded},
+		{"Too many links", ErrTooManyLinks},
+		{"Too many levels of symbolic links", ErrSSHFxLinkLoop},
+		{"rmdir /foo: directory not empty", ErrSSHFxDirNotEmpty},
+		{"Not a directory", ErrSSHFxNotADirectory},
+		{"Is a directory", ErrSSHFxFileIsADirectory},
+		{"rename /a /b: invalid cross-device link", ErrSSHFxOpUnsupported},
+		{"Failure", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, decodeStatusMessage(tt.msg), tt.msg)
+	}
+}
+
+func TestClientErrorMessageDecoding(t *testing.T) {
+	handlers := InMemHandler()
+	cmder := &failingCmder{}
+	handlers.FileCmd = cmder
+	p := clientRequestServerPairWithHandlers(t, handlers, WithRSExtendedStatusCodes())
+	defer p.Close()
+
+	cmder.err = errors.New("mkdir /foo: No space left on device")
+
+	// not decoded by default.
+	err := p.cli.Mkdir("/foo")
+	var status *StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+	assert.False(t, errors.Is(err, ErrSSHFxNoSpaceOnFilesystem))
+
+	require.NoError(t, UseErrorMessageDecoding(true)(p.cli))
+
+	err = p.cli.Mkdir("/foo")
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+	assert.True(t, errors.Is(err, ErrSSHFxNoSpaceOnFilesystem))
+
+	cmder.err = errors.New("Too many links")
+	err = p.cli.Link("/a", "/b")
+	assert.True(t, errors.Is(err, ErrTooManyLinks))
+
+	// a precise status code is matched the same way, and its message is not decoded.
+	cmder.err = ErrSSHFxQuotaExceeded
+	err = p.cli.Mkdir("/foo")
+	assert.True(t, errors.Is(err, ErrSSHFxQuotaExceeded))
+	assert.False(t, errors.Is(err, ErrSSHFxFailure))
+}
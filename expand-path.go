@@ -0,0 +1,129 @@
+package sftp
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPath has the server expand a path starting with "~", for the home directory of the user,
+// or "~user", for the home directory of the named user, as OpenSSH does for the paths given to sftp,
+// and canonicalize it to an absolute path, as RealPath.
+// Other paths are canonicalized as by RealPath.
+//
+// It implements the expand-path@openssh.com SSH_FXP_EXTENDED feature.
+func (c *Client) ExpandPath(path string) (string, error) {
+	id := c.nextID()
+	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpExpandPathPacket{
+		ID:   id,
+		Path: path,
+	})
+	if err != nil {
+		return "", err
+	}
+	return unmarshalRealPath(id, typ, data)
+}
+
+// splitTildePath splits the path p, if it starts with "~", into the name of the user after the "~",
+// which is empty for the current user, and the rest of the path after the following "/", if any.
+func splitTildePath(p string) (name, rest string, ok bool) {
+	if !strings.HasPrefix(p, "~") {
+		return "", "", false
+	}
+
+	name = p[1:]
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name, rest = name[:i], name[i+1:]
+	}
+	return name, rest, true
+}
+
+// lookupHomeDir returns the home directory of the user name, or of the current user if name is empty.
+func lookupHomeDir(name string) (string, error) {
+	if name == "" {
+		return os.UserHomeDir()
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, ok := err.(user.UnknownUserError); ok {
+			return "", &os.PathError{Op: "expand-path", Path: "~" + name, Err: os.ErrNotExist}
+		}
+		return "", err
+	}
+	return u.HomeDir, nil
+}
+
+type sshFxpExpandPathPacket struct {
+	ID   uint32
+	Path string
+}
+
+func (p *sshFxpExpandPathPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpExpandPathPacket) MarshalBinary() ([]byte, error) {
+	const ext = "expand-path@openssh.com"
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext) +
+		4 + len(p.Path)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+	b = marshalString(b, p.Path)
+
+	return b, nil
+}
+
+type sshFxpExtendedPacketExpandPath struct {
+	ID              uint32
+	ExtendedRequest string
+	Path            string
+}
+
+func (p *sshFxpExtendedPacketExpandPath) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketExpandPath) readonly() bool { return true }
+func (p *sshFxpExtendedPacketExpandPath) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Path, _, err = unmarshalStringSafe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// respond expands the path with the home directories of the users of the system of the server,
+// and then canonicalizes it as SSH_FXP_REALPATH.
+func (p *sshFxpExtendedPacketExpandPath) respond(s *Server) responsePacket {
+	lp := s.toLocalPath(p.Path)
+	if name, rest, ok := splitTildePath(p.Path); ok {
+		home, err := lookupHomeDir(name)
+		if err != nil {
+			return statusFromError(p.ID, err)
+		}
+		lp = filepath.Join(home, filepath.FromSlash(rest))
+	}
+
+	f, err := filepath.Abs(lp)
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+	f = cleanPath(f)
+
+	return &sshFxpNamePacket{
+		ID: p.ID,
+		NameAttrs: []*sshFxpNameAttr{
+			{
+				Name:     f,
+				LongName: f,
+				Attrs:    emptyFileStat,
+			},
+		},
+	}
+}
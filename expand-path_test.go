@@ -0,0 +1,102 @@
+package sftp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitTildePath(t *testing.T) {
+	tests := []struct {
+		path, name, rest string
+		ok               bool
+	}{
+		{"~", "", "", true},
+		{"~/", "", "", true},
+		{"~/foo/bar", "", "foo/bar", true},
+		{"~bob", "bob", "", true},
+		{"~bob/foo", "bob", "foo", true},
+		{"/~/foo", "", "", false},
+		{"foo", "", "", false},
+	}
+	for _, tt := range tests {
+		name, rest, ok := splitTildePath(tt.path)
+		assert.Equal(t, tt.name, name, tt.path)
+		assert.Equal(t, tt.rest, rest, tt.path)
+		assert.Equal(t, tt.ok, ok, tt.path)
+	}
+}
+
+func TestClientExpandPath(t *testing.T) {
+	skipIfWindows(t) // the paths returned are converted from those of Windows
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory:", err)
+	}
+	home, err = filepath.Abs(home)
+	require.NoError(t, err)
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	data, ok := client.HasExtension("expand-path@openssh.com")
+	require.True(t, ok)
+	assert.Equal(t, "1", data)
+
+	p, err := client.ExpandPath("~")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.ToSlash(home), p)
+
+	p, err = client.ExpandPath("~/foo/../bar")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.ToSlash(filepath.Join(home, "bar")), p)
+
+	p, err = client.ExpandPath("/foo/../bar")
+	require.NoError(t, err)
+	assert.Equal(t, "/bar", p)
+
+	_, err = client.ExpandPath("~no-such-user-of-sftp-tests")
+	assert.True(t, os.IsNotExist(err), err)
+}
+
+type expandPathLister struct {
+	FileLister
+}
+
+func (expandPathLister) ExpandPath(p string) (string, error) {
+	return "/home/" + p, nil
+}
+
+func TestRequestServerExpandPath(t *testing.T) {
+	p := clientRequestServerPair(t, WithStartDirectory("/home/user"))
+	defer p.Close()
+
+	expanded, err := p.cli.ExpandPath("~")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user", expanded)
+
+	expanded, err = p.cli.ExpandPath("~/foo/../bar")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user/bar", expanded)
+
+	expanded, err = p.cli.ExpandPath("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user/bar", expanded)
+
+	_, err = p.cli.ExpandPath("~bob")
+	assert.ErrorIs(t, err, ErrSSHFxOpUnsupported)
+
+	handlers := InMemHandler()
+	handlers.FileList = expandPathLister{handlers.FileList}
+	p = clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	expanded, err = p.cli.ExpandPath("~bob")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/~bob", expanded)
+}
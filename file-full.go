@@ -0,0 +1,55 @@
+package sftp
+
+import (
+	"io"
+	"os"
+)
+
+// ReadFull reads exactly len(b) bytes from the File at the offset off, with the semantics of io.ReadFull:
+// it returns len(b) and a nil error, or io.EOF if no bytes could be read because off is at or beyond the end of the file,
+// or io.ErrUnexpectedEOF if the end of the file was reached after some, but not all, of the bytes,
+// or another error with the number of bytes read before it.
+//
+// Unlike ReadAt, a read the server answers with fewer bytes than asked for, as some servers do before the end of a file,
+// is not taken as the end of the file: the rest is read again, until the server reports the end of the file.
+// The file offset is not altered.
+func (f *File) ReadFull(b []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.handle == "" {
+		return 0, os.ErrClosed
+	}
+
+	n, err := f.readAt(b, off)
+	if n < len(b) && (err == nil || err == io.EOF) {
+		// the concurrent reads take a short read to be the end of the file,
+		// which only the server can tell, by answering with an EOF status.
+		var m int
+		m, err = f.readAtSequential(b[n:], off+int64(n))
+		n += m
+	}
+
+	switch {
+	case n == len(b):
+		return n, nil
+	case err == io.EOF && n > 0:
+		return n, io.ErrUnexpectedEOF
+	case err == nil:
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// WriteFull writes all of b to the File at the offset off.
+// It returns len(b) and a nil error, or the number of bytes written at off before the first error,
+// which is io.ErrShortWrite if the bytes were not all written without an error reported,
+// so that a nil error always means that all of b was written.
+// The file offset is not altered.
+func (f *File) WriteFull(b []byte, off int64) (int, error) {
+	n, err := f.WriteAt(b, off)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
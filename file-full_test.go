@@ -0,0 +1,89 @@
+package sftp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shortReads serves files of an InMemHandler, reading at most max bytes at a time, as some servers do.
+type shortReads struct {
+	FileReader
+	max int
+}
+
+func (h shortReads) Fileread(r *Request) (io.ReaderAt, error) {
+	ra, err := h.FileReader.Fileread(r)
+	if err != nil {
+		return nil, err
+	}
+	return shortReaderAt{ra, h.max}, nil
+}
+
+type shortReaderAt struct {
+	io.ReaderAt
+	max int
+}
+
+func (r shortReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if len(b) > r.max {
+		b = b[:r.max]
+	}
+	n, err := r.ReaderAt.ReadAt(b, off)
+	if n == len(b) && err == io.EOF {
+		err = nil // the next read finds the end.
+	}
+	return n, err
+}
+
+func TestFileReadFull(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileGet = shortReads{handlers.FileGet, 1000}
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = f.WriteFull(content, 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	f, err = p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	b := make([]byte, 100000)
+
+	// ReadAt takes the short reads to be the end of the file.
+	n, err := f.ReadAt(b, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Less(t, n, len(b))
+
+	n, err = f.ReadFull(b, 0)
+	require.NoError(t, err)
+	assert.Equal(t, len(b), n)
+	assert.Equal(t, content[:len(b)], b)
+
+	n, err = f.ReadFull(b, int64(len(content)-500))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, 500, n)
+	assert.Equal(t, content[len(content)-500:], b[:n])
+
+	n, err = f.ReadFull(b, int64(len(content)))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 0, n)
+
+	n, err = f.ReadFull(nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// writing to a file opened for reading fails.
+	n, err = f.WriteFull(content, 0)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+}
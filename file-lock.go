@@ -0,0 +1,65 @@
+package sftp
+
+import (
+	"errors"
+	"os"
+)
+
+// errFileLocked is returned by lockFile when another open file holds the lock.
+var errFileLocked = errors.New("file is locked")
+
+// WithFileLocking makes the Server take an advisory lock on each file it opens for writing, for as long as it is open,
+// so that two sessions uploading the same file cannot interleave their writes unnoticed.
+// The open of a file that another session, or process honoring the lock, has open for writing,
+// is refused with ErrSSHFxLockConflict, which clients see as SSH_FX_FAILURE, and the message "file is locked",
+// or as SSH_FX_LOCK_CONFLICT if WithExtendedStatusCodes is set.
+// A file opened with truncation is only truncated once it has been locked.
+//
+// The lock is flock on unix systems, and LockFileEx on Windows, of a byte far beyond the end of the file,
+// so that it does not stop reads and writes through other handles.
+// It is an error on platforms which have neither.
+func WithFileLocking() ServerOption {
+	return func(s *Server) error {
+		if !fileLockingSupported {
+			return errors.New("file locking is not supported on this platform")
+		}
+		s.lockFiles = true
+		return nil
+	}
+}
+
+// lockedFile is a file opened for writing by a Server with WithFileLocking, which it unlocks once closed.
+type lockedFile struct {
+	*os.File
+}
+
+func (f *lockedFile) Close() error {
+	_ = unlockFile(f.File)
+	return f.File.Close()
+}
+
+// lockOpened locks the file f, just opened for writing at path, truncating it once locked if trunc is set,
+// and returns the file to keep open, or closes it and returns an error if it cannot be locked.
+func lockOpened(f file, path string, trunc bool) (file, error) {
+	osf, ok := f.(*os.File)
+	if !ok {
+		return f, nil
+	}
+
+	if err := lockFile(osf); err != nil {
+		osf.Close()
+		if err == errFileLocked {
+			return nil, &os.PathError{Op: "open", Path: path, Err: ErrSSHFxLockConflict}
+		}
+		return nil, err
+	}
+
+	locked := &lockedFile{osf}
+	if trunc {
+		if err := osf.Truncate(0); err != nil {
+			locked.Close()
+			return nil, err
+		}
+	}
+	return locked, nil
+}
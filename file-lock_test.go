@@ -0,0 +1,77 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lockingClient(t *testing.T, opts ...ServerOption) *Client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, append([]ServerOption{WithFileLocking()}, opts...)...)
+	require.NoError(t, err)
+	go func() {
+		server.Serve()
+		server.Close()
+	}()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestServerFileLocking(t *testing.T) {
+	if !fileLockingSupported {
+		t.Skip("file locking is not supported on this platform")
+	}
+
+	dir, err := ioutil.TempDir("", "sftp-file-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.ToSlash(filepath.Join(dir, "upload"))
+
+	first := lockingClient(t)
+	second := lockingClient(t, WithStrictConformance(PanicOnConformanceError))
+	extended := lockingClient(t, WithExtendedStatusCodes())
+
+	f, err := first.Create(name)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("first"))
+	require.NoError(t, err)
+
+	// the upload of the second session is refused, without truncating the first,
+	// with a code of version 3, unless the later codes are sent.
+	_, err = second.Create(name)
+	var status *StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+	assert.Contains(t, status.msg, "file is locked")
+
+	_, err = extended.Create(name)
+	assert.True(t, errors.Is(err, ErrSSHFxLockConflict), "%v", err)
+
+	r, err := second.Open(name)
+	require.NoError(t, err, "reads are not locked out")
+	contents, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(contents))
+	require.NoError(t, r.Close())
+
+	require.NoError(t, f.Close())
+
+	require.NoError(t, second.PutString(name, "second", 0o644))
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "upload"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(contents))
+}
@@ -0,0 +1,29 @@
+package sftp
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+const fileLockingSupported = true
+
+// the byte locked, which is far beyond the end of any file, as the locks of LockFileEx are mandatory.
+const (
+	lockOffsetLow  = 0xffffffff
+	lockOffsetHigh = 0x7fffffff
+)
+
+func lockFile(f *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffsetLow, OffsetHigh: lockOffsetHigh}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errFileLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffsetLow, OffsetHigh: lockOffsetHigh}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, ol)
+}
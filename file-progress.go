@@ -0,0 +1,77 @@
+package sftp
+
+import (
+	"sync/atomic"
+)
+
+// FileProgress is the progress of the transfer of data through a File.
+type FileProgress struct {
+	// Path is the name of the file, as given to Open or Create.
+	Path string
+
+	// Transferred is the number of bytes of file data sent to, or received from, the server through the File.
+	Transferred int64
+
+	// Expected is the total number of bytes expected to be transferred, as given to SetExpectedSize,
+	// or zero if it is not known.
+	Expected int64
+}
+
+// Percent returns the percentage of the expected bytes that have been transferred, up to 100,
+// or -1 if the expected size is not known.
+func (p FileProgress) Percent() float64 {
+	if p.Expected <= 0 {
+		return -1
+	}
+	if p.Transferred >= p.Expected {
+		return 100
+	}
+	return float64(p.Transferred) * 100 / float64(p.Expected)
+}
+
+// SetExpectedSize records the total number of bytes expected to be transferred through the File,
+// so that its progress can be reported as a proportion,
+// such as when the data is copied with io.Copy from a reader whose size the File cannot see.
+// The expected sizes of the Files of a Client are also totalled in ClientStats.BytesExpected.
+func (f *File) SetExpectedSize(size int64) {
+	old := atomic.SwapInt64(&f.expected, size)
+	if s := f.c.stats; s != nil {
+		atomic.AddInt64(&s.bytesExpected, size-old)
+	}
+}
+
+// OnProgress sets a function to be called with the progress of the File, each time data is sent or received.
+// It replaces any function set earlier, and nil stops the calls.
+//
+// Reads and writes by the File are performed concurrently, but the calls to fn are not,
+// though they may come from any goroutine, and so fn should return quickly.
+func (f *File) OnProgress(fn func(FileProgress)) {
+	f.progressMu.Lock()
+	defer f.progressMu.Unlock()
+
+	f.onProgress = fn
+}
+
+// Progress returns the progress of the File so far.
+func (f *File) Progress() FileProgress {
+	return FileProgress{
+		Path:        f.path,
+		Transferred: atomic.LoadInt64(&f.transferred),
+		Expected:    atomic.LoadInt64(&f.expected),
+	}
+}
+
+// advance accounts for n bytes of data sent or received, and reports the progress.
+func (f *File) advance(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddInt64(&f.transferred, int64(n))
+
+	f.progressMu.Lock()
+	defer f.progressMu.Unlock()
+
+	if f.onProgress != nil {
+		f.onProgress(f.Progress())
+	}
+}
@@ -0,0 +1,181 @@
+package sftp
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// filenamePolicyExtension is the name of the extension that advertises the FilenamePolicy of a server.
+const filenamePolicyExtension = "filename-policy@pkg.sftp"
+
+var errFilenameInvalidUTF8 = errors.New("filename is not valid UTF-8")
+
+// FilenameForm is the Unicode normalization form that a FilenamePolicy applies to the names of new files.
+type FilenameForm int
+
+// Normalization forms of a FilenamePolicy.
+const (
+	// FilenameAsIs keeps names as sent by the client.
+	FilenameAsIs FilenameForm = iota
+
+	// FilenameNFC composes names, as most Linux and Windows clients send them.
+	FilenameNFC
+
+	// FilenameNFD decomposes names, as macOS has traditionally stored them.
+	FilenameNFD
+)
+
+func (f FilenameForm) String() string {
+	switch f {
+	case FilenameNFC:
+		return "nfc"
+	case FilenameNFD:
+		return "nfd"
+	default:
+		return ""
+	}
+}
+
+// FilenamePolicy defines the checks applied to the name of every file created by a client,
+// whether by SSH_FXP_OPEN with SSH_FXF_CREAT, SSH_FXP_MKDIR, SSH_FXP_SYMLINK, a hard link, a copy,
+// or as the new name of a rename, so that names which look the same are also the same bytes.
+//
+// Only the last element of the path is checked, and normalized,
+// so that existing directories are still found by the bytes of their names.
+// Other requests, such as SSH_FXP_STAT, are passed on as they are.
+//
+// The policy is advertised in SSH_FXP_VERSION with the filename-policy@pkg.sftp extension,
+// see Client.FilenamePolicy.
+type FilenamePolicy struct {
+	// RejectInvalidUTF8 refuses names which are not valid UTF-8 with SSH_FX_FAILURE.
+	RejectInvalidUTF8 bool
+
+	// Form is the normalization form names are converted to, by Normalize.
+	// It is only applied, and advertised, along with Normalize.
+	Form FilenameForm
+
+	// Normalize is called with the name of each new file, which it returns in Form,
+	// such as with the String method of norm.NFC or norm.NFD from golang.org/x/text/unicode/norm.
+	// This package does not carry the Unicode normalization tables, so that servers which do not normalize names do not pay for them.
+	Normalize func(string) string
+}
+
+// WithFilenamePolicy applies the given FilenamePolicy to the files created through the Server.
+func WithFilenamePolicy(policy FilenamePolicy) ServerOption {
+	return func(s *Server) error {
+		s.filenamePolicy = &policy
+		s.advert.extra = append(s.advert.extra, policy.extension())
+		return nil
+	}
+}
+
+// WithRSFilenamePolicy applies the given FilenamePolicy to the files created through the RequestServer.
+func WithRSFilenamePolicy(policy FilenamePolicy) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.filenamePolicy = &policy
+		rs.advert.extra = append(rs.advert.extra, policy.extension())
+	}
+}
+
+// extension returns the extension pair advertising the policy,
+// whose data is the comma-separated list of "utf8", if invalid names are rejected, and the form, if any.
+func (p *FilenamePolicy) extension() sshExtensionPair {
+	var rules []string
+	if p.RejectInvalidUTF8 {
+		rules = append(rules, "utf8")
+	}
+	if form := p.Form.String(); form != "" && p.Normalize != nil {
+		rules = append(rules, form)
+	}
+	return sshExtensionPair{Name: filenamePolicyExtension, Data: strings.Join(rules, ",")}
+}
+
+// parseFilenamePolicy returns the FilenamePolicy of the data of the filename-policy@pkg.sftp extension,
+// which has no Normalize, as it is only a description of the policy of the server.
+// Unknown rules are ignored.
+func parseFilenamePolicy(data string) FilenamePolicy {
+	var p FilenamePolicy
+	for _, rule := range strings.Split(data, ",") {
+		switch rule {
+		case "utf8":
+			p.RejectInvalidUTF8 = true
+		case "nfc":
+			p.Form = FilenameNFC
+		case "nfd":
+			p.Form = FilenameNFD
+		}
+	}
+	return p
+}
+
+// FilenamePolicy returns the FilenamePolicy advertised by the server, if any,
+// so that a client can create names in the form the server keeps them.
+func (c *Client) FilenamePolicy() (FilenamePolicy, bool) {
+	data, ok := c.HasExtension(filenamePolicyExtension)
+	if !ok {
+		return FilenamePolicy{}, false
+	}
+	return parseFilenamePolicy(data), true
+}
+
+// check returns the name, the last element of the path p, in the form of the policy,
+// or an error if it is refused.
+func (p *FilenamePolicy) check(name string) (string, error) {
+	dir, base := path.Split(name)
+
+	if p.RejectInvalidUTF8 && !utf8.ValidString(base) {
+		return "", errFilenameInvalidUTF8
+	}
+
+	if p.Form != FilenameAsIs && p.Normalize != nil {
+		base = p.Normalize(base)
+	}
+
+	return dir + base, nil
+}
+
+// apply checks the path of each file the request packet pkt creates, replacing them with their normalized forms.
+func (p *FilenamePolicy) apply(pkt requestPacket) error {
+	if epkt, ok := pkt.(*sshFxpExtendedPacket); ok {
+		if epkt.SpecificPacket == nil {
+			return nil
+		}
+		pkt = epkt.SpecificPacket
+	}
+
+	for _, path := range createdPaths(pkt) {
+		clean, err := p.check(*path)
+		if err != nil {
+			return err
+		}
+		*path = clean
+	}
+
+	return nil
+}
+
+// createdPaths returns pointers to the path of each file that the request packet pkt creates.
+func createdPaths(pkt interface{}) []*string {
+	switch pkt := pkt.(type) {
+	case *sshFxpOpenPacket:
+		if pkt.Pflags&sshFxfCreat != 0 {
+			return []*string{&pkt.Path}
+		}
+	case *sshFxpMkdirPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpSymlinkPacket:
+		return []*string{&pkt.Linkpath}
+	case *sshFxpRenamePacket:
+		return []*string{&pkt.Newpath}
+	case *sshFxpExtendedPacketPosixRename:
+		return []*string{&pkt.Newpath}
+	case *sshFxpExtendedPacketHardlink:
+		return []*string{&pkt.Newpath}
+	case *sshFxpExtendedPacketCopyFile:
+		return []*string{&pkt.Destination}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package sftp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	cafeNFC = "caf\u00e9"
+	cafeNFD = "cafe\u0301"
+)
+
+// Normalizations which only know of the one name of the tests.
+var (
+	cafeToNFC = strings.NewReplacer(cafeNFD, cafeNFC).Replace
+	cafeToNFD = strings.NewReplacer(cafeNFC, cafeNFD).Replace
+)
+
+func TestFilenamePolicyApply(t *testing.T) {
+	policy := &FilenamePolicy{RejectInvalidUTF8: true, Form: FilenameNFC, Normalize: cafeToNFC}
+
+	// only the new name of a rename is normalized, and only its last element.
+	rename := &sshFxpRenamePacket{Oldpath: "/" + cafeNFD, Newpath: "/" + cafeNFD + "/" + cafeNFD}
+	require.NoError(t, policy.apply(rename))
+	assert.Equal(t, "/"+cafeNFD, rename.Oldpath)
+	assert.Equal(t, "/"+cafeNFD+"/"+cafeNFC, rename.Newpath)
+
+	// an open which does not create is passed on as it is.
+	open := &sshFxpOpenPacket{Path: "/\xff", Pflags: sshFxfRead}
+	require.NoError(t, policy.apply(open))
+
+	open.Pflags |= sshFxfCreat
+	assert.Equal(t, errFilenameInvalidUTF8, policy.apply(open))
+
+	nfd := &FilenamePolicy{Form: FilenameNFD, Normalize: cafeToNFD}
+	mkdir := &sshFxpMkdirPacket{Path: cafeNFC}
+	require.NoError(t, nfd.apply(mkdir))
+	assert.Equal(t, cafeNFD, mkdir.Path)
+
+	// without Normalize, the Form is neither applied, nor advertised.
+	nfd.Normalize = nil
+	mkdir.Path = cafeNFC
+	require.NoError(t, nfd.apply(mkdir))
+	assert.Equal(t, cafeNFC, mkdir.Path)
+	assert.Equal(t, "", nfd.extension().Data)
+}
+
+func TestRequestServerFilenamePolicy(t *testing.T) {
+	p := clientRequestServerPair(t, WithRSFilenamePolicy(FilenamePolicy{RejectInvalidUTF8: true, Form: FilenameNFC, Normalize: cafeToNFC}))
+	defer p.Close()
+
+	policy, ok := p.cli.FilenamePolicy()
+	require.True(t, ok)
+	assert.Equal(t, FilenamePolicy{RejectInvalidUTF8: true, Form: FilenameNFC}, policy)
+
+	f, err := p.cli.Create("/" + cafeNFD)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = p.cli.Stat("/" + cafeNFC)
+	assert.NoError(t, err)
+
+	err = p.cli.Mkdir("/\xff")
+	assert.Error(t, err)
+	_, err = p.cli.Stat("/\xff")
+	assert.Error(t, err)
+}
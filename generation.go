@@ -0,0 +1,194 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+)
+
+// generationExtension is the name of the extension for the generation tokens of directories.
+const generationExtension = "generation@pkg.sftp"
+
+// ErrGenerationChanged is the error of CheckGeneration, and ReadDirSnapshot,
+// when a directory has changed since its generation token was taken.
+// It is sent by the server as a SSH_FX_FAILURE with this message, and recognized by the Client, see errors.Is.
+var ErrGenerationChanged = errors.New("generation changed")
+
+// Generation returns the generation token of the directory p, an opaque string which the server changes
+// whenever an entry of the directory is added, removed, or renamed, so that a long walk can detect
+// concurrent modification, see CheckGeneration.
+//
+// The Server of this package derives the token from the modification time of the directory,
+// and so it is best-effort: a change within the resolution of the time of the filesystem may go unnoticed,
+// and a change to the content of a file in the directory is not a change of the directory.
+//
+// It implements the generation@pkg.sftp SSH_FXP_EXTENDED feature.
+func (c *Client) Generation(p string) (string, error) {
+	return c.generation(p, "")
+}
+
+// CheckGeneration returns an error that matches ErrGenerationChanged, see errors.Is,
+// if the generation token of the directory p is no longer token, as returned by Generation.
+func (c *Client) CheckGeneration(p, token string) error {
+	_, err := c.generation(p, token)
+	return err
+}
+
+// ReadDirSnapshot reads the directory p as ReadDir, and returns its entries with the generation token they are of.
+// If the directory changes while it is read, it returns an error that matches ErrGenerationChanged,
+// and the caller may try again.
+func (c *Client) ReadDirSnapshot(p string) ([]os.FileInfo, string, error) {
+	token, err := c.Generation(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries, err := c.ReadDir(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := c.CheckGeneration(p, token); err != nil {
+		return nil, "", err
+	}
+	return entries, token, nil
+}
+
+func (c *Client) generation(p, token string) (string, error) {
+	id := c.nextID()
+	typ, data, err := c.sendPacket(context.Background(), nil, &sshFxpGenerationPacket{
+		ID:    id,
+		Path:  p,
+		Token: token,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch typ {
+	case sshFxpExtendedReply:
+		sid, data, err := unmarshalUint32Safe(data)
+		if err != nil {
+			return "", err
+		}
+		if sid != id {
+			return "", &unexpectedIDErr{id, sid}
+		}
+		token, _, err := unmarshalStringSafe(data)
+		return token, err
+	case sshFxpStatus:
+		err := c.statusError(id, data)
+		if status, ok := err.(*StatusError); ok && status.Code == sshFxFailure && status.msg == ErrGenerationChanged.Error() {
+			status.decoded = ErrGenerationChanged
+		}
+		return "", err
+	default:
+		return "", unimplementedPacketErr(typ)
+	}
+}
+
+// localGeneration returns the generation token of the local directory of fi, of its modification time and size.
+func localGeneration(fi os.FileInfo) string {
+	return strconv.FormatInt(fi.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(fi.Size(), 16)
+}
+
+// generationResponse is the response to the generation request p, of the current token of its directory.
+func generationResponse(p *sshFxpExtendedPacketGeneration, token string, err error) responsePacket {
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+	if p.Token != "" && p.Token != token {
+		return statusFromError(p.ID, ErrGenerationChanged)
+	}
+	return &sshFxpGenerationResponse{
+		ID:    p.ID,
+		Token: token,
+	}
+}
+
+// generation returns the generation token of the directory p,
+// with the Generation of the FileLister, if it has one, or fails as unsupported.
+func (rs *RequestServer) generation(ctx context.Context, p string) (string, error) {
+	lister, ok := rs.Handlers.FileList.(GenerationFileLister)
+	if !ok {
+		return "", ErrSSHFxOpUnsupported
+	}
+	return lister.Generation(NewRequest("Generation", cleanPathWithBase(rs.startDirectory, p)).WithContext(ctx))
+}
+
+type sshFxpGenerationPacket struct {
+	ID    uint32
+	Path  string
+	Token string
+}
+
+func (p *sshFxpGenerationPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpGenerationPacket) MarshalBinary() ([]byte, error) {
+	const ext = generationExtension
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext) +
+		4 + len(p.Path) +
+		4 + len(p.Token)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+	b = marshalString(b, p.Path)
+	b = marshalString(b, p.Token)
+
+	return b, nil
+}
+
+type sshFxpExtendedPacketGeneration struct {
+	ID              uint32
+	ExtendedRequest string
+	Path            string
+	Token           string // the token to check, or empty to only get the current one
+}
+
+func (p *sshFxpExtendedPacketGeneration) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketGeneration) readonly() bool { return true }
+func (p *sshFxpExtendedPacketGeneration) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Path, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Token, _, err = unmarshalStringSafe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketGeneration) respond(s *Server) responsePacket {
+	fi, err := os.Stat(s.toLocalPath(p.Path))
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+	return generationResponse(p, localGeneration(fi), nil)
+}
+
+// sshFxpGenerationResponse is the SSH_FXP_EXTENDED_REPLY to generation@pkg.sftp.
+type sshFxpGenerationResponse struct {
+	ID    uint32
+	Token string
+}
+
+func (p *sshFxpGenerationResponse) id() uint32 { return p.ID }
+
+func (p *sshFxpGenerationResponse) MarshalBinary() ([]byte, error) {
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(p.Token)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtendedReply)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, p.Token)
+
+	return b, nil
+}
@@ -0,0 +1,70 @@
+package sftp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGeneration(t *testing.T) {
+	dir := t.TempDir()
+
+	client, server := clientServerPair(t, WithStrictConformance(PanicOnConformanceError))
+	defer client.Close()
+	defer server.Close()
+
+	_, ok := client.HasExtension("generation@pkg.sftp")
+	assert.True(t, ok)
+
+	token, err := client.Generation(dir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.NoError(t, client.CheckGeneration(dir, token))
+
+	entries, snapshot, err := client.ReadDirSnapshot(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Equal(t, token, snapshot)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0o644))
+
+	err = client.CheckGeneration(dir, token)
+	assert.ErrorIs(t, err, ErrGenerationChanged)
+
+	_, err = client.Generation(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+type generationLister struct {
+	FileLister
+	tokens map[string]string
+}
+
+func (l generationLister) Generation(r *Request) (string, error) {
+	return l.tokens[r.Filepath], nil
+}
+
+func TestRequestServerGeneration(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	// the InMemHandler has no generation tokens.
+	_, err := p.cli.Generation("/")
+	assert.ErrorIs(t, err, ErrSSHFxOpUnsupported)
+
+	handlers := InMemHandler()
+	handlers.FileList = generationLister{handlers.FileList, map[string]string{"/dir": "1"}}
+
+	p = clientRequestServerPairWithHandlers(t, handlers, WithRSStrictConformance(PanicOnConformanceError))
+	defer p.Close()
+
+	token, err := p.cli.Generation("dir")
+	require.NoError(t, err)
+	assert.Equal(t, "1", token)
+	assert.NoError(t, p.cli.CheckGeneration("dir", "1"))
+	assert.ErrorIs(t, p.cli.CheckGeneration("dir", "0"), ErrGenerationChanged)
+}
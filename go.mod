@@ -6,5 +6,5 @@ require (
 	github.com/kr/fs v0.1.0
 	github.com/stretchr/testify v1.8.0
 	golang.org/x/crypto v0.31.0
-	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/sys v0.28.0
 )
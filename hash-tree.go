@@ -0,0 +1,182 @@
+package sftp
+
+import (
+	"context"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+)
+
+// TreeHashes maps the slash-separated path of each regular file, relative to the root of a tree,
+// to the digest of its content.
+type TreeHashes map[string][]byte
+
+// Paths returns the paths of the files, in sorted order.
+func (h TreeHashes) Paths() []string {
+	paths := make([]string, 0, len(h))
+	for p := range h {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// WriteTo writes the digests to w, one line per file in the order of Paths,
+// as the hex digest, two spaces, and the path, in the same format as sha256sum and the like,
+// so that the output can be compared with that of the same tool run over a local tree.
+func (h TreeHashes) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, p := range h.Paths() {
+		n, err := fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(h[p]), p)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// hashTreeConcurrencyDefault is the number of files hashed at once by HashTree, unless a concurrency is given.
+const hashTreeConcurrencyDefault = 8
+
+// HashTree walks the remote directory root, and returns the digest of every regular file under it,
+// with the hash function algo, such as crypto.SHA256, which must be linked into the binary.
+// Symbolic links are not followed, and other special files are skipped.
+//
+// The digests are computed by reading the content of the files,
+// with up to concurrency files read at the same time, by default 8.
+//
+// HashTree stops at the first error.
+// The context is checked between directories and files.
+func (c *Client) HashTree(ctx context.Context, root string, algo crypto.Hash, concurrency int) (TreeHashes, error) {
+	if !algo.Available() {
+		return nil, fmt.Errorf("sftp: hash function %v is not available", algo)
+	}
+	if concurrency < 1 {
+		concurrency = hashTreeConcurrencyDefault
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ht := &hashTree{
+		ctx:    ctx,
+		cancel: cancel,
+		c:      c,
+		root:   root,
+		algo:   algo,
+		files:  make(chan string),
+		hashes: make(TreeHashes),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ht.work()
+		}()
+	}
+
+	err := ht.dir(".")
+	close(ht.files)
+	wg.Wait()
+
+	if ferr := ht.firstErr(); ferr != nil {
+		err = ferr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ht.hashes, nil
+}
+
+type hashTree struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	c      *Client
+	root   string
+	algo   crypto.Hash
+	files  chan string // paths of the files to hash, relative to root
+
+	mu     sync.Mutex
+	err    error
+	hashes TreeHashes
+}
+
+// dir queues the regular files of the directory rel, and those below it.
+func (ht *hashTree) dir(rel string) error {
+	if err := ht.ctx.Err(); err != nil {
+		return err
+	}
+
+	infos, err := ht.c.ReadDirContext(ht.ctx, path.Join(ht.root, rel))
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range infos {
+		name := path.Join(rel, fi.Name())
+
+		switch {
+		case fi.IsDir():
+			if err := ht.dir(name); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			select {
+			case ht.files <- name:
+			case <-ht.ctx.Done():
+				return ht.ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+func (ht *hashTree) work() {
+	for rel := range ht.files {
+		if ht.ctx.Err() != nil {
+			continue // drain the queue
+		}
+
+		sum, err := ht.hash(rel)
+
+		ht.mu.Lock()
+		if err != nil {
+			if ht.err == nil {
+				ht.err = err
+				ht.cancel()
+			}
+		} else {
+			ht.hashes[rel] = sum
+		}
+		ht.mu.Unlock()
+	}
+}
+
+// hash returns the digest of the content of the file rel.
+func (ht *hashTree) hash(rel string) ([]byte, error) {
+	f, err := ht.c.Open(path.Join(ht.root, rel))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := ht.algo.New()
+	if _, err := f.WriteTo(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (ht *hashTree) firstErr() error {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	return ht.err
+}
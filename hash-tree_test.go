@@ -0,0 +1,61 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHashTree(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":         "a",
+		"big.bin":       strings.Repeat("0123456789", 10000),
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+		"sub/empty":     "",
+	}
+	writeTree(t, dir, files)
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(dir, "link")))
+
+	hashes, err := client.HashTree(context.Background(), dir, crypto.SHA256, 2)
+	require.NoError(t, err)
+
+	var want bytes.Buffer
+	assert.Len(t, hashes, len(files))
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		assert.Equal(t, sum[:], hashes[name], name)
+	}
+	for _, name := range []string{"a.txt", "big.bin", "sub/b.txt", "sub/deep/c.go", "sub/empty"} {
+		sum := sha256.Sum256([]byte(files[name]))
+		want.WriteString(hex.EncodeToString(sum[:]) + "  " + name + "\n")
+	}
+
+	var got bytes.Buffer
+	_, err = hashes.WriteTo(&got)
+	require.NoError(t, err)
+	assert.Equal(t, want.String(), got.String())
+
+	_, err = client.HashTree(context.Background(), filepath.Join(dir, "missing"), crypto.SHA256, 0)
+	assert.True(t, os.IsNotExist(err), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.HashTree(ctx, dir, crypto.SHA256, 0)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,176 @@
+package sshfx
+
+// ACE types.
+const (
+	ACEAccessAllowed = 0x00000000 // ACE4_ACCESS_ALLOWED_ACE_TYPE
+	ACEAccessDenied  = 0x00000001 // ACE4_ACCESS_DENIED_ACE_TYPE
+	ACESystemAudit   = 0x00000002 // ACE4_SYSTEM_AUDIT_ACE_TYPE
+	ACESystemAlarm   = 0x00000003 // ACE4_SYSTEM_ALARM_ACE_TYPE
+)
+
+// ACE flags.
+const (
+	ACEFlagFileInherit        = 0x00000001 // ACE4_FILE_INHERIT_ACE
+	ACEFlagDirectoryInherit   = 0x00000002 // ACE4_DIRECTORY_INHERIT_ACE
+	ACEFlagNoPropagateInherit = 0x00000004 // ACE4_NO_PROPAGATE_INHERIT_ACE
+	ACEFlagInheritOnly        = 0x00000008 // ACE4_INHERIT_ONLY_ACE
+	ACEFlagSuccessfulAccess   = 0x00000010 // ACE4_SUCCESSFUL_ACCESS_ACE_FLAG
+	ACEFlagFailedAccess       = 0x00000020 // ACE4_FAILED_ACCESS_ACE_FLAG
+	ACEFlagIdentifierGroup    = 0x00000040 // ACE4_IDENTIFIER_GROUP
+)
+
+// ACE access masks.
+const (
+	ACEMaskReadData        = 0x00000001 // ACE4_READ_DATA
+	ACEMaskListDirectory   = 0x00000001 // ACE4_LIST_DIRECTORY
+	ACEMaskWriteData       = 0x00000002 // ACE4_WRITE_DATA
+	ACEMaskAddFile         = 0x00000002 // ACE4_ADD_FILE
+	ACEMaskAppendData      = 0x00000004 // ACE4_APPEND_DATA
+	ACEMaskAddSubdirectory = 0x00000004 // ACE4_ADD_SUBDIRECTORY
+	ACEMaskReadNamedAttrs  = 0x00000008 // ACE4_READ_NAMED_ATTRS
+	ACEMaskWriteNamedAttrs = 0x00000010 // ACE4_WRITE_NAMED_ATTRS
+	ACEMaskExecute         = 0x00000020 // ACE4_EXECUTE
+	ACEMaskDeleteChild     = 0x00000040 // ACE4_DELETE_CHILD
+	ACEMaskReadAttributes  = 0x00000080 // ACE4_READ_ATTRIBUTES
+	ACEMaskWriteAttributes = 0x00000100 // ACE4_WRITE_ATTRIBUTES
+	ACEMaskDelete          = 0x00010000 // ACE4_DELETE
+	ACEMaskReadACL         = 0x00020000 // ACE4_READ_ACL
+	ACEMaskWriteACL        = 0x00040000 // ACE4_WRITE_ACL
+	ACEMaskWriteOwner      = 0x00080000 // ACE4_WRITE_OWNER
+	ACEMaskSynchronize     = 0x00100000 // ACE4_SYNCHRONIZE
+)
+
+// ACL flags, of version 6 of the protocol.
+const (
+	ACLControlIncluded     = 0x00000001 // SFX_ACL_CONTROL_INCLUDED
+	ACLControlPresent      = 0x00000002 // SFX_ACL_CONTROL_PRESENT
+	ACLControlInherited    = 0x00000004 // SFX_ACL_CONTROL_INHERITED
+	ACLAuditAlarmIncluded  = 0x00000010 // SFX_ACL_AUDIT_ALARM_INCLUDED
+	ACLAuditAlarmInherited = 0x00000020 // SFX_ACL_AUDIT_ALARM_INHERITED
+)
+
+// ACE defines an access control entry of an ACL.
+//
+// Defined in: https://tools.ietf.org/html/draft-ietf-secsh-filexfer-13#section-7.8
+type ACE struct {
+	Type  uint32
+	Flags uint32
+	Mask  uint32
+
+	// Who is the principal the entry applies to, such as "user@domain", or one of the special names, such as "OWNER@".
+	Who string
+}
+
+// Len returns the number of bytes e would marshal into.
+func (e *ACE) Len() int {
+	return 4 + 4 + 4 + 4 + len(e.Who)
+}
+
+// MarshalInto marshals e onto the end of the given Buffer.
+func (e *ACE) MarshalInto(buf *Buffer) {
+	buf.AppendUint32(e.Type)
+	buf.AppendUint32(e.Flags)
+	buf.AppendUint32(e.Mask)
+	buf.AppendString(e.Who)
+}
+
+// UnmarshalFrom unmarshals an ACE from the given Buffer into e.
+func (e *ACE) UnmarshalFrom(buf *Buffer) (err error) {
+	*e = ACE{
+		Type:  buf.ConsumeUint32(),
+		Flags: buf.ConsumeUint32(),
+		Mask:  buf.ConsumeUint32(),
+		Who:   buf.ConsumeString(),
+	}
+
+	return buf.Err
+}
+
+// ACL defines the access control list of the attributes of versions 4 to 6 of the protocol.
+// The Flags are only sent in version 6.
+//
+// Defined in: https://tools.ietf.org/html/draft-ietf-secsh-filexfer-13#section-7.8
+type ACL struct {
+	Flags   uint32
+	Entries []ACE
+}
+
+// len returns the number of bytes acl would marshal into, in the encoding of the given version.
+func (acl *ACL) len(version uint32) int {
+	length := 4
+
+	if version >= 6 {
+		length += 4
+	}
+
+	for i := range acl.Entries {
+		length += acl.Entries[i].Len()
+	}
+
+	return length
+}
+
+// marshalInto marshals acl onto the end of the given Buffer, in the encoding of the given version.
+func (acl *ACL) marshalInto(buf *Buffer, version uint32) {
+	if version >= 6 {
+		buf.AppendUint32(acl.Flags)
+	}
+
+	buf.AppendUint32(uint32(len(acl.Entries)))
+
+	for i := range acl.Entries {
+		acl.Entries[i].MarshalInto(buf)
+	}
+}
+
+// unmarshalFrom unmarshals an ACL from the given Buffer into acl, in the encoding of the given version.
+func (acl *ACL) unmarshalFrom(buf *Buffer, version uint32) (err error) {
+	*acl = ACL{}
+
+	if version >= 6 {
+		acl.Flags = buf.ConsumeUint32()
+	}
+
+	count := buf.ConsumeCount()
+	if buf.Err != nil {
+		return buf.Err
+	}
+
+	// each entry is at least 16 bytes, which bounds the allocation by the data actually received.
+	if count > buf.Len()/16 {
+		return ErrShortPacket
+	}
+
+	acl.Entries = make([]ACE, count)
+	for i := range acl.Entries {
+		if err := acl.Entries[i].UnmarshalFrom(buf); err != nil {
+			return err
+		}
+	}
+
+	return buf.Err
+}
+
+// GetACL decodes the ACL field, in the encoding of a.Version,
+// and returns it, and a bool that is true if and only if the value is valid/defined.
+func (a *VersionedAttributes) GetACL() (acl ACL, ok bool, err error) {
+	if !a.has(AttrV4ACL) {
+		return acl, false, nil
+	}
+
+	if err := acl.unmarshalFrom(NewBuffer(a.ACL), a.Version); err != nil {
+		return ACL{}, false, err
+	}
+
+	return acl, true, nil
+}
+
+// SetACL is a convenience function that encodes acl into the ACL field, in the encoding of a.Version,
+// which must be set first, and marks the field as valid/defined in Flags.
+func (a *VersionedAttributes) SetACL(acl ACL) {
+	buf := NewBuffer(make([]byte, 0, acl.len(a.Version)))
+	acl.marshalInto(buf, a.Version)
+
+	a.Flags |= AttrV4ACL
+	a.ACL = buf.Bytes()
+}
@@ -0,0 +1,109 @@
+package sshfx
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	acl := ACL{
+		Flags: ACLControlIncluded | ACLControlPresent,
+		Entries: []ACE{
+			{
+				Type:  ACEAccessAllowed,
+				Flags: ACEFlagFileInherit,
+				Mask:  ACEMaskReadData | ACEMaskWriteData,
+				Who:   "OWNER@",
+			},
+			{
+				Type:  ACEAccessDenied,
+				Flags: ACEFlagIdentifierGroup,
+				Mask:  ACEMaskExecute,
+				Who:   "staff",
+			},
+		},
+	}
+
+	type test struct {
+		version uint32
+		header  []byte
+		flags   uint32
+	}
+
+	tests := []test{
+		{
+			version: 4,
+			header: []byte{
+				0x00, 0x00, 0x00, 2,
+			},
+		},
+		{
+			version: 6,
+			header: []byte{
+				0x00, 0x00, 0x00, 0x03,
+				0x00, 0x00, 0x00, 2,
+			},
+			flags: acl.Flags,
+		},
+	}
+
+	entries := []byte{
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x03,
+		0x00, 0x00, 0x00, 6, 'O', 'W', 'N', 'E', 'R', '@',
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x40,
+		0x00, 0x00, 0x00, 0x20,
+		0x00, 0x00, 0x00, 5, 's', 't', 'a', 'f', 'f',
+	}
+
+	for _, tt := range tests {
+		attr := &VersionedAttributes{Version: tt.version}
+
+		if _, ok, _ := attr.GetACL(); ok {
+			t.Fatalf("version %d: GetACL() of empty attributes reported a valid ACL", tt.version)
+		}
+
+		attr.SetACL(acl)
+
+		want := append(append([]byte{}, tt.header...), entries...)
+		if !bytes.Equal(attr.ACL, want) {
+			t.Fatalf("version %d: SetACL() = %X, but wanted %X", tt.version, attr.ACL, want)
+		}
+
+		data, err := attr.MarshalBinary()
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		got := VersionedAttributes{Version: tt.version}
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		gotACL, ok, err := got.GetACL()
+		if err != nil || !ok {
+			t.Fatalf("version %d: GetACL() = %t, %v", tt.version, ok, err)
+		}
+
+		wantACL := acl
+		wantACL.Flags = tt.flags
+
+		if !reflect.DeepEqual(gotACL, wantACL) {
+			t.Errorf("version %d: GetACL() = %#v, but expected %#v", tt.version, gotACL, wantACL)
+		}
+	}
+
+	// a count beyond the data is refused, rather than allocated.
+	attr := &VersionedAttributes{
+		Version: 4,
+		Flags:   AttrV4ACL,
+		ACL:     []byte{0xFF, 0xFF, 0xFF, 0xFF},
+	}
+
+	if _, _, err := attr.GetACL(); err != ErrShortPacket {
+		t.Errorf("GetACL() of a long count = %v, but expected %v", err, ErrShortPacket)
+	}
+}
@@ -8,6 +8,8 @@ const (
 	AttrACModTime               // SSH_FILEXFER_ACMODTIME
 
 	AttrExtended = 1 << 31 // SSH_FILEXFER_ATTR_EXTENDED
+
+	attrKnown = AttrSize | AttrUIDGID | AttrPermissions | AttrACModTime | AttrExtended
 )
 
 // Attributes defines the file attributes type defined in draft-ietf-secsh-filexfer-02
@@ -32,6 +34,17 @@ type Attributes struct {
 
 	// AttrExtended
 	ExtendedAttributes []ExtendedAttribute
+
+	// Unknown holds the raw bytes following the ACModTime fields,
+	// if Flags has bits set other than those above, such as from a later version of the protocol, or a vendor.
+	// As the layout of such fields is unknown, the bytes run to the end of the data,
+	// and include the extended attributes, which are then not decoded.
+	// If not nil, they are marshaled again as they are, in place of the extended attributes,
+	// so that attributes are relayed without loss.
+	//
+	// As the bytes run to the end of the data, they are only kept where attributes are the last field of a packet.
+	// The attributes of a NameEntry are decoded as if the unknown flags were not set.
+	Unknown []byte
 }
 
 // GetSize returns the Size field and a bool that is true if and only if the value is valid/defined.
@@ -104,6 +117,10 @@ func (a *Attributes) Len() int {
 		length += 4 + 4
 	}
 
+	if a.Flags&^attrKnown != 0 && a.Unknown != nil {
+		return length + len(a.Unknown)
+	}
+
 	if a.Flags&AttrExtended != 0 {
 		length += 4
 
@@ -137,6 +154,11 @@ func (a *Attributes) MarshalInto(buf *Buffer) {
 		buf.AppendUint32(a.MTime)
 	}
 
+	if a.Flags&^attrKnown != 0 && a.Unknown != nil {
+		buf.b = append(buf.b, a.Unknown...)
+		return
+	}
+
 	if a.Flags&AttrExtended != 0 {
 		buf.AppendUint32(uint32(len(a.ExtendedAttributes)))
 
@@ -159,13 +181,19 @@ func (a *Attributes) MarshalBinary() ([]byte, error) {
 func (a *Attributes) UnmarshalFrom(buf *Buffer) (err error) {
 	flags := buf.ConsumeUint32()
 
-	return a.XXX_UnmarshalByFlags(flags, buf)
+	return a.unmarshalByFlags(flags, buf, true)
 }
 
 // XXX_UnmarshalByFlags uses the pre-existing a.Flags field to determine which fields to decode.
 // DO NOT USE THIS: it is an anti-corruption function to implement existing internal usage in pkg/sftp.
 // This function is not a part of any compatibility promise.
 func (a *Attributes) XXX_UnmarshalByFlags(flags uint32, buf *Buffer) (err error) {
+	return a.unmarshalByFlags(flags, buf, true)
+}
+
+// unmarshalByFlags decodes the fields given by flags,
+// keeping any bytes of unknown fields in a.Unknown, if keepUnknown is set, or otherwise ignoring the unknown flags.
+func (a *Attributes) unmarshalByFlags(flags uint32, buf *Buffer, keepUnknown bool) (err error) {
 	a.Flags = flags
 
 	// Short-circuit dummy attributes.
@@ -191,6 +219,14 @@ func (a *Attributes) XXX_UnmarshalByFlags(flags uint32, buf *Buffer) (err error)
 		a.MTime = buf.ConsumeUint32()
 	}
 
+	if a.Flags&^attrKnown != 0 && keepUnknown {
+		// copy the bytes, as the buffer may be reused, into a non-nil slice, even if empty.
+		rest := buf.Bytes()
+		a.Unknown = append(make([]byte, 0, len(rest)), rest...)
+		buf.off = len(buf.b)
+		return buf.Err
+	}
+
 	if a.Flags&AttrExtended != 0 {
 		count := buf.ConsumeCount()
 
@@ -287,7 +323,9 @@ func (e *NameEntry) UnmarshalFrom(buf *Buffer) (err error) {
 		Longname: buf.ConsumeString(),
 	}
 
-	return e.Attrs.UnmarshalFrom(buf)
+	// further entries may follow, so the attributes cannot keep the bytes of unknown fields.
+	flags := buf.ConsumeUint32()
+	return e.Attrs.unmarshalByFlags(flags, buf, false)
 }
 
 // UnmarshalBinary decodes the binary encoding of NameEntry into e.
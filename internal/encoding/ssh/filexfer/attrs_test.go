@@ -175,6 +175,54 @@ func TestAttributes(t *testing.T) {
 	}
 }
 
+func TestAttributesUnknownFlags(t *testing.T) {
+	const size uint64 = 0x123456789ABCDEF0
+
+	encoded := []byte{
+		0x80, 0x00, 0x00, 0x11,
+		0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xDE, 0xF0,
+		// the field of the unknown flag 0x10, and then the extended attributes.
+		0x00, 0x00, 0x00, 0x02, 'x', 'y',
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o',
+		0x00, 0x00, 0x00, 0x03, 'b', 'a', 'r',
+	}
+
+	var attr Attributes
+	if err := attr.UnmarshalBinary(encoded); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if attr.Flags != 0x80000011 {
+		t.Errorf("UnmarshalBinary(): Flags was %x, but wanted %x", attr.Flags, 0x80000011)
+	}
+
+	if attr.Size != size {
+		t.Errorf("UnmarshalBinary(): Size was %x, but wanted %x", attr.Size, size)
+	}
+
+	if want := encoded[12:]; !bytes.Equal(attr.Unknown, want) {
+		t.Errorf("UnmarshalBinary(): Unknown was %X, but wanted %X", attr.Unknown, want)
+	}
+
+	if attr.ExtendedAttributes != nil {
+		t.Errorf("UnmarshalBinary(): ExtendedAttributes was %#v, but wanted nil", attr.ExtendedAttributes)
+	}
+
+	if attr.Len() != len(encoded) {
+		t.Errorf("Len() = %d, but wanted %d", attr.Len(), len(encoded))
+	}
+
+	buf, err := attr.MarshalBinary()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !bytes.Equal(buf, encoded) {
+		t.Fatalf("MarshalBinary() = %X, but wanted %X", buf, encoded)
+	}
+}
+
 func TestNameEntry(t *testing.T) {
 	const (
 		filename          = "foo"
@@ -0,0 +1,136 @@
+package sshfx
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	extensionVersions      = "versions"
+	extensionVersionSelect = "version-select"
+)
+
+// ExtensionVersions returns the "versions" ExtensionPair, suitable to append into a VersionPacket,
+// which lists the versions of the protocol the server supports, and can be selected with a VersionSelectExtendedPacket.
+//
+// Defined in: https://tools.ietf.org/html/draft-ietf-secsh-filexfer-13#section-5.5
+func ExtensionVersions(versions ...uint32) *ExtensionPair {
+	list := make([]string, len(versions))
+	for i, v := range versions {
+		list[i] = strconv.FormatUint(uint64(v), 10)
+	}
+
+	return &ExtensionPair{
+		Name: extensionVersions,
+		Data: strings.Join(list, ","),
+	}
+}
+
+// ParseVersions returns the versions listed in the data of a "versions" ExtensionPair.
+// Entries that are not a plain version number, such as vendor specific versions, are skipped.
+func ParseVersions(data string) []uint32 {
+	var versions []uint32
+
+	for _, field := range strings.Split(data, ",") {
+		v, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, uint32(v))
+	}
+
+	return versions
+}
+
+// NegotiateVersion returns the version of the protocol to use with a server that answered with the given VersionPacket,
+// from those the client supports, and whether it has to be selected with a VersionSelectExtendedPacket.
+//
+// The version of the VersionPacket is used if the client supports it.
+// Otherwise the highest version in both the "versions" extension of the server, if any, and supported is selected.
+// If there is none, ok is false.
+func NegotiateVersion(p *VersionPacket, supported ...uint32) (version uint32, sel bool, ok bool) {
+	for _, v := range supported {
+		if v == p.Version {
+			version, ok = v, true
+		}
+	}
+
+	for _, ext := range p.Extensions {
+		if ext.Name != extensionVersions {
+			continue
+		}
+
+		for _, offered := range ParseVersions(ext.Data) {
+			for _, v := range supported {
+				if v == offered && (!ok || v > version) {
+					version, ok = v, true
+				}
+			}
+		}
+	}
+
+	return version, ok && version != p.Version, ok
+}
+
+// RegisterExtensionVersionSelect registers the "version-select" extended packet with the encoding/ssh/filexfer package.
+func RegisterExtensionVersionSelect() {
+	RegisterExtendedPacketType(extensionVersionSelect, func() ExtendedData {
+		return new(VersionSelectExtendedPacket)
+	})
+}
+
+// VersionSelectExtendedPacket defines the version-select extended packet,
+// which must be the first request sent after the SSH_FXP_VERSION packet,
+// and on success switches both sides to the given version, from the "versions" extension of the server.
+//
+// Defined in: https://tools.ietf.org/html/draft-ietf-secsh-filexfer-13#section-5.5
+type VersionSelectExtendedPacket struct {
+	Version string
+}
+
+// Type returns the SSH_FXP_EXTENDED packet type.
+func (ep *VersionSelectExtendedPacket) Type() PacketType {
+	return PacketTypeExtended
+}
+
+// MarshalPacket returns ep as a two-part binary encoding of the full extended packet.
+func (ep *VersionSelectExtendedPacket) MarshalPacket(reqid uint32, b []byte) (header, payload []byte, err error) {
+	p := &ExtendedPacket{
+		ExtendedRequest: extensionVersionSelect,
+
+		Data: ep,
+	}
+	return p.MarshalPacket(reqid, b)
+}
+
+// MarshalInto encodes ep into the binary encoding of the version-select extended packet-specific data.
+func (ep *VersionSelectExtendedPacket) MarshalInto(buf *Buffer) {
+	buf.AppendString(ep.Version)
+}
+
+// MarshalBinary encodes ep into the binary encoding of the version-select extended packet-specific data.
+//
+// NOTE: This _only_ encodes the packet-specific data, it does not encode the full extended packet.
+func (ep *VersionSelectExtendedPacket) MarshalBinary() ([]byte, error) {
+	// string(version-from-list)
+	size := 4 + len(ep.Version)
+
+	buf := NewBuffer(make([]byte, 0, size))
+	ep.MarshalInto(buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalFrom decodes the version-select extended packet-specific data from buf.
+func (ep *VersionSelectExtendedPacket) UnmarshalFrom(buf *Buffer) (err error) {
+	*ep = VersionSelectExtendedPacket{
+		Version: buf.ConsumeString(),
+	}
+
+	return buf.Err
+}
+
+// UnmarshalBinary decodes the version-select extended packet-specific data into ep.
+func (ep *VersionSelectExtendedPacket) UnmarshalBinary(data []byte) (err error) {
+	return ep.UnmarshalFrom(NewBuffer(data))
+}
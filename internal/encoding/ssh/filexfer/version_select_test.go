@@ -0,0 +1,130 @@
+package sshfx
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var _ PacketMarshaller = &VersionSelectExtendedPacket{}
+
+func init() {
+	RegisterExtensionVersionSelect()
+}
+
+func TestVersionSelectExtendedPacket(t *testing.T) {
+	const (
+		id      = 42
+		version = "6"
+	)
+
+	ep := &VersionSelectExtendedPacket{
+		Version: version,
+	}
+
+	data, err := ComposePacket(ep.MarshalPacket(id, nil))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	want := []byte{
+		0x00, 0x00, 0x00, 28,
+		200,
+		0x00, 0x00, 0x00, 42,
+		0x00, 0x00, 0x00, 14, 'v', 'e', 'r', 's', 'i', 'o', 'n', '-', 's', 'e', 'l', 'e', 'c', 't',
+		0x00, 0x00, 0x00, 1, '6',
+	}
+
+	if !bytes.Equal(data, want) {
+		t.Fatalf("MarshalPacket() = %X, but wanted %X", data, want)
+	}
+
+	var p ExtendedPacket
+
+	// UnmarshalPacketBody assumes the (length, type, request-id) have already been consumed.
+	if err := p.UnmarshalPacketBody(NewBuffer(data[9:])); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if p.ExtendedRequest != extensionVersionSelect {
+		t.Errorf("UnmarshalPacketBody(): ExtendedRequest was %q, but expected %q", p.ExtendedRequest, extensionVersionSelect)
+	}
+
+	ep, ok := p.Data.(*VersionSelectExtendedPacket)
+	if !ok {
+		t.Fatalf("UnmarshaledPacketBody(): Data was type %T, but expected *VersionSelectExtendedPacket", p.Data)
+	}
+
+	if ep.Version != version {
+		t.Errorf("UnmarshalPacketBody(): Version was %q, but expected %q", ep.Version, version)
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	ext := ExtensionVersions(3, 4, 6)
+	if ext.Data != "3,4,6" {
+		t.Fatalf("ExtensionVersions(3, 4, 6).Data = %q, but expected %q", ext.Data, "3,4,6")
+	}
+
+	got := ParseVersions("3, 4,6e,6")
+	if want := []uint32{3, 4, 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseVersions() = %v, but expected %v", got, want)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	type test struct {
+		name      string
+		packet    *VersionPacket
+		supported []uint32
+		version   uint32
+		sel       bool
+		ok        bool
+	}
+
+	tests := []test{
+		{
+			name:      "same",
+			packet:    &VersionPacket{Version: 3},
+			supported: []uint32{3},
+			version:   3,
+			ok:        true,
+		},
+		{
+			name: "select higher",
+			packet: &VersionPacket{
+				Version:    3,
+				Extensions: []*ExtensionPair{ExtensionVersions(3, 4, 5, 6)},
+			},
+			supported: []uint32{3, 4, 5},
+			version:   5,
+			sel:       true,
+			ok:        true,
+		},
+		{
+			name: "select lower",
+			packet: &VersionPacket{
+				Version:    6,
+				Extensions: []*ExtensionPair{ExtensionVersions(3, 6)},
+			},
+			supported: []uint32{3, 4},
+			version:   3,
+			sel:       true,
+			ok:        true,
+		},
+		{
+			name:      "none",
+			packet:    &VersionPacket{Version: 6},
+			supported: []uint32{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, sel, ok := NegotiateVersion(tt.packet, tt.supported...)
+			if version != tt.version || sel != tt.sel || ok != tt.ok {
+				t.Errorf("NegotiateVersion() = %d, %t, %t, but expected %d, %t, %t", version, sel, ok, tt.version, tt.sel, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package sshfx
+
+import (
+	"time"
+)
+
+// Attributes related flags of versions 4 to 6 of the protocol.
+//
+// These differ from those of version 3 from the second bit on,
+// and so are only meaningful in VersionedAttributes.
+const (
+	AttrV4Size           = 0x00000001 // SSH_FILEXFER_ATTR_SIZE
+	AttrV4Permissions    = 0x00000004 // SSH_FILEXFER_ATTR_PERMISSIONS
+	AttrV4AccessTime     = 0x00000008 // SSH_FILEXFER_ATTR_ACCESSTIME
+	AttrV4CreateTime     = 0x00000010 // SSH_FILEXFER_ATTR_CREATETIME
+	AttrV4ModifyTime     = 0x00000020 // SSH_FILEXFER_ATTR_MODIFYTIME
+	AttrV4ACL            = 0x00000040 // SSH_FILEXFER_ATTR_ACL
+	AttrV4OwnerGroup     = 0x00000080 // SSH_FILEXFER_ATTR_OWNERGROUP
+	AttrV4SubsecondTimes = 0x00000100 // SSH_FILEXFER_ATTR_SUBSECOND_TIMES
+
+	AttrV5Bits = 0x00000200 // SSH_FILEXFER_ATTR_BITS
+
+	AttrV6AllocationSize   = 0x00000400 // SSH_FILEXFER_ATTR_ALLOCATION_SIZE
+	AttrV6TextHint         = 0x00000800 // SSH_FILEXFER_ATTR_TEXT_HINT
+	AttrV6MimeType         = 0x00001000 // SSH_FILEXFER_ATTR_MIME_TYPE
+	AttrV6LinkCount        = 0x00002000 // SSH_FILEXFER_ATTR_LINK_COUNT
+	AttrV6UntranslatedName = 0x00004000 // SSH_FILEXFER_ATTR_UNTRANSLATED_NAME
+	AttrV6CTime            = 0x00008000 // SSH_FILEXFER_ATTR_CTIME
+
+	AttrV4Extended = 0x80000000 // SSH_FILEXFER_ATTR_EXTENDED
+
+	attrV4Known = AttrV4Size | AttrV4Permissions | AttrV4AccessTime | AttrV4CreateTime | AttrV4ModifyTime |
+		AttrV4ACL | AttrV4OwnerGroup | AttrV4SubsecondTimes | AttrV4Extended
+	attrV5Known = attrV4Known | AttrV5Bits
+	attrV6Known = attrV5Known | AttrV6AllocationSize | AttrV6TextHint | AttrV6MimeType | AttrV6LinkCount |
+		AttrV6UntranslatedName | AttrV6CTime
+)
+
+// File types of the type field of the attributes of versions 4 to 6 of the protocol.
+const (
+	FileTypeRegular     = 1 // SSH_FILEXFER_TYPE_REGULAR
+	FileTypeDirectory   = 2 // SSH_FILEXFER_TYPE_DIRECTORY
+	FileTypeSymlink     = 3 // SSH_FILEXFER_TYPE_SYMLINK
+	FileTypeSpecial     = 4 // SSH_FILEXFER_TYPE_SPECIAL
+	FileTypeUnknown     = 5 // SSH_FILEXFER_TYPE_UNKNOWN
+	FileTypeSocket      = 6 // SSH_FILEXFER_TYPE_SOCKET (version 5 and later)
+	FileTypeCharDevice  = 7 // SSH_FILEXFER_TYPE_CHAR_DEVICE (version 5 and later)
+	FileTypeBlockDevice = 8 // SSH_FILEXFER_TYPE_BLOCK_DEVICE (version 5 and later)
+	FileTypeFIFO        = 9 // SSH_FILEXFER_TYPE_FIFO (version 5 and later)
+)
+
+// VersionedTime is a time of the attributes of versions 4 to 6 of the protocol,
+// in seconds since the epoch, with the nanoseconds that are sent if AttrV4SubsecondTimes is set.
+type VersionedTime struct {
+	Seconds     int64
+	Nanoseconds uint32
+}
+
+// Time returns t as a time.Time.
+func (t VersionedTime) Time() time.Time {
+	return time.Unix(t.Seconds, int64(t.Nanoseconds))
+}
+
+// VersionedTimeOf returns the VersionedTime of the time.Time t.
+func VersionedTimeOf(t time.Time) VersionedTime {
+	return VersionedTime{
+		Seconds:     t.Unix(),
+		Nanoseconds: uint32(t.Nanosecond()),
+	}
+}
+
+// VersionedAttributes defines the file attributes type of versions 4 to 6 of the protocol,
+// which have a file type, 64-bit times with optional nanoseconds, a create time, owner and group names in place of ids, and ACLs.
+//
+// The fields sent depend on the version, which must be set in Version before the attributes are marshaled or unmarshaled.
+// Flags and fields of a later version than Version are not marshaled.
+//
+// Defined in: https://tools.ietf.org/html/draft-ietf-secsh-filexfer-04#section-5
+// and https://tools.ietf.org/html/draft-ietf-secsh-filexfer-05#section-5
+// and https://tools.ietf.org/html/draft-ietf-secsh-filexfer-13#section-7
+type VersionedAttributes struct {
+	// Version is the version of the protocol the attributes are encoded with: 4, 5 or 6.
+	Version uint32
+
+	Flags uint32
+
+	// Type is always present.
+	Type uint8
+
+	// AttrV4Size
+	Size uint64
+
+	// AttrV6AllocationSize
+	AllocationSize uint64
+
+	// AttrV4OwnerGroup
+	Owner string
+	Group string
+
+	// AttrV4Permissions
+	Permissions FileMode
+
+	// AttrV4AccessTime, AttrV4CreateTime, AttrV4ModifyTime and AttrV6CTime,
+	// with the nanoseconds if AttrV4SubsecondTimes.
+	ATime      VersionedTime
+	CreateTime VersionedTime
+	MTime      VersionedTime
+	CTime      VersionedTime
+
+	// AttrV4ACL holds the encoded ACL, see draft-ietf-secsh-filexfer-13 section 7.8.
+	ACL []byte
+
+	// AttrV5Bits, and in version 6, the mask of the bits that are valid.
+	AttribBits      uint32
+	AttribBitsValid uint32
+
+	// AttrV6TextHint
+	TextHint uint8
+
+	// AttrV6MimeType
+	MimeType string
+
+	// AttrV6LinkCount
+	LinkCount uint32
+
+	// AttrV6UntranslatedName
+	UntranslatedName string
+
+	// AttrV4Extended
+	ExtendedAttributes []ExtendedAttribute
+}
+
+// knownFlags returns the flags defined by the version of a.
+func (a *VersionedAttributes) knownFlags() uint32 {
+	switch {
+	case a.Version >= 6:
+		return attrV6Known
+	case a.Version == 5:
+		return attrV5Known
+	}
+	return attrV4Known
+}
+
+// has reports whether the field of flag is present in the encoding of a.
+func (a *VersionedAttributes) has(flag uint32) bool {
+	return a.Flags&a.knownFlags()&flag != 0
+}
+
+// Len returns the number of bytes a would marshal into.
+func (a *VersionedAttributes) Len() int {
+	length := 4 + 1
+
+	if a.has(AttrV4Size) {
+		length += 8
+	}
+
+	if a.has(AttrV6AllocationSize) {
+		length += 8
+	}
+
+	if a.has(AttrV4OwnerGroup) {
+		length += 4 + len(a.Owner) + 4 + len(a.Group)
+	}
+
+	if a.has(AttrV4Permissions) {
+		length += 4
+	}
+
+	timeLen := 8
+	if a.has(AttrV4SubsecondTimes) {
+		timeLen += 4
+	}
+
+	for _, flag := range []uint32{AttrV4AccessTime, AttrV4CreateTime, AttrV4ModifyTime, AttrV6CTime} {
+		if a.has(flag) {
+			length += timeLen
+		}
+	}
+
+	if a.has(AttrV4ACL) {
+		length += 4 + len(a.ACL)
+	}
+
+	if a.has(AttrV5Bits) {
+		length += 4
+		if a.Version >= 6 {
+			length += 4
+		}
+	}
+
+	if a.has(AttrV6TextHint) {
+		length++
+	}
+
+	if a.has(AttrV6MimeType) {
+		length += 4 + len(a.MimeType)
+	}
+
+	if a.has(AttrV6LinkCount) {
+		length += 4
+	}
+
+	if a.has(AttrV6UntranslatedName) {
+		length += 4 + len(a.UntranslatedName)
+	}
+
+	if a.has(AttrV4Extended) {
+		length += 4
+
+		for _, ext := range a.ExtendedAttributes {
+			length += ext.Len()
+		}
+	}
+
+	return length
+}
+
+// MarshalInto marshals a onto the end of the given Buffer, in the encoding of a.Version.
+func (a *VersionedAttributes) MarshalInto(buf *Buffer) {
+	buf.AppendUint32(a.Flags & a.knownFlags())
+	buf.AppendUint8(a.Type)
+
+	if a.has(AttrV4Size) {
+		buf.AppendUint64(a.Size)
+	}
+
+	if a.has(AttrV6AllocationSize) {
+		buf.AppendUint64(a.AllocationSize)
+	}
+
+	if a.has(AttrV4OwnerGroup) {
+		buf.AppendString(a.Owner)
+		buf.AppendString(a.Group)
+	}
+
+	if a.has(AttrV4Permissions) {
+		buf.AppendUint32(uint32(a.Permissions))
+	}
+
+	a.marshalTime(buf, AttrV4AccessTime, a.ATime)
+	a.marshalTime(buf, AttrV4CreateTime, a.CreateTime)
+	a.marshalTime(buf, AttrV4ModifyTime, a.MTime)
+	a.marshalTime(buf, AttrV6CTime, a.CTime)
+
+	if a.has(AttrV4ACL) {
+		buf.AppendByteSlice(a.ACL)
+	}
+
+	if a.has(AttrV5Bits) {
+		buf.AppendUint32(a.AttribBits)
+		if a.Version >= 6 {
+			buf.AppendUint32(a.AttribBitsValid)
+		}
+	}
+
+	if a.has(AttrV6TextHint) {
+		buf.AppendUint8(a.TextHint)
+	}
+
+	if a.has(AttrV6MimeType) {
+		buf.AppendString(a.MimeType)
+	}
+
+	if a.has(AttrV6LinkCount) {
+		buf.AppendUint32(a.LinkCount)
+	}
+
+	if a.has(AttrV6UntranslatedName) {
+		buf.AppendString(a.UntranslatedName)
+	}
+
+	if a.has(AttrV4Extended) {
+		buf.AppendUint32(uint32(len(a.ExtendedAttributes)))
+
+		for _, ext := range a.ExtendedAttributes {
+			ext.MarshalInto(buf)
+		}
+	}
+}
+
+func (a *VersionedAttributes) marshalTime(buf *Buffer, flag uint32, t VersionedTime) {
+	if !a.has(flag) {
+		return
+	}
+
+	buf.AppendInt64(t.Seconds)
+	if a.has(AttrV4SubsecondTimes) {
+		buf.AppendUint32(t.Nanoseconds)
+	}
+}
+
+// MarshalBinary returns a as the binary encoding of a.
+func (a *VersionedAttributes) MarshalBinary() ([]byte, error) {
+	buf := NewBuffer(make([]byte, 0, a.Len()))
+	a.MarshalInto(buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalFrom unmarshals a VersionedAttributes from the given Buffer into a,
+// in the encoding of a.Version, which is kept.
+//
+// Unlike Attributes, flags unknown to the version are an error,
+// as the fields that follow them cannot be located.
+//
+// NOTE: The values of fields not covered in the a.Flags are explicitly undefined.
+func (a *VersionedAttributes) UnmarshalFrom(buf *Buffer) (err error) {
+	*a = VersionedAttributes{
+		Version: a.Version,
+		Flags:   buf.ConsumeUint32(),
+		Type:    buf.ConsumeUint8(),
+	}
+
+	if buf.Err != nil {
+		return buf.Err
+	}
+
+	if a.Flags&^a.knownFlags() != 0 {
+		return StatusBadMessage
+	}
+
+	if a.has(AttrV4Size) {
+		a.Size = buf.ConsumeUint64()
+	}
+
+	if a.has(AttrV6AllocationSize) {
+		a.AllocationSize = buf.ConsumeUint64()
+	}
+
+	if a.has(AttrV4OwnerGroup) {
+		a.Owner = buf.ConsumeString()
+		a.Group = buf.ConsumeString()
+	}
+
+	if a.has(AttrV4Permissions) {
+		a.Permissions = FileMode(buf.ConsumeUint32())
+	}
+
+	a.ATime = a.unmarshalTime(buf, AttrV4AccessTime)
+	a.CreateTime = a.unmarshalTime(buf, AttrV4CreateTime)
+	a.MTime = a.unmarshalTime(buf, AttrV4ModifyTime)
+	a.CTime = a.unmarshalTime(buf, AttrV6CTime)
+
+	if a.has(AttrV4ACL) {
+		a.ACL = buf.ConsumeByteSliceCopy(nil)
+	}
+
+	if a.has(AttrV5Bits) {
+		a.AttribBits = buf.ConsumeUint32()
+		if a.Version >= 6 {
+			a.AttribBitsValid = buf.ConsumeUint32()
+		}
+	}
+
+	if a.has(AttrV6TextHint) {
+		a.TextHint = buf.ConsumeUint8()
+	}
+
+	if a.has(AttrV6MimeType) {
+		a.MimeType = buf.ConsumeString()
+	}
+
+	if a.has(AttrV6LinkCount) {
+		a.LinkCount = buf.ConsumeUint32()
+	}
+
+	if a.has(AttrV6UntranslatedName) {
+		a.UntranslatedName = buf.ConsumeString()
+	}
+
+	if a.has(AttrV4Extended) {
+		count := buf.ConsumeCount()
+
+		a.ExtendedAttributes = make([]ExtendedAttribute, count)
+		for i := range a.ExtendedAttributes {
+			a.ExtendedAttributes[i].UnmarshalFrom(buf)
+		}
+	}
+
+	return buf.Err
+}
+
+func (a *VersionedAttributes) unmarshalTime(buf *Buffer, flag uint32) (t VersionedTime) {
+	if !a.has(flag) {
+		return t
+	}
+
+	t.Seconds = buf.ConsumeInt64()
+	if a.has(AttrV4SubsecondTimes) {
+		t.Nanoseconds = buf.ConsumeUint32()
+	}
+	return t
+}
+
+// UnmarshalBinary decodes the binary encoding of VersionedAttributes into a, in the encoding of a.Version.
+func (a *VersionedAttributes) UnmarshalBinary(data []byte) error {
+	return a.UnmarshalFrom(NewBuffer(data))
+}
+
+// Attributes returns the version 3 Attributes of the size, permissions, access and modify times, and extended attributes of a.
+// The times are truncated to whole seconds, and the owner and group, which are names rather than ids, are not kept.
+func (a *VersionedAttributes) Attributes() Attributes {
+	var attrs Attributes
+
+	if a.has(AttrV4Size) {
+		attrs.SetSize(a.Size)
+	}
+
+	if a.has(AttrV4Permissions) {
+		attrs.SetPermissions(a.Permissions)
+	}
+
+	if a.has(AttrV4AccessTime) && a.has(AttrV4ModifyTime) {
+		attrs.SetACModTime(uint32(a.ATime.Seconds), uint32(a.MTime.Seconds))
+	}
+
+	if a.has(AttrV4Extended) {
+		attrs.Flags |= AttrExtended
+		attrs.ExtendedAttributes = a.ExtendedAttributes
+	}
+
+	return attrs
+}
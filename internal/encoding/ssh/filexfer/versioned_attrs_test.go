@@ -0,0 +1,161 @@
+package sshfx
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVersionedAttributesV4(t *testing.T) {
+	attr := &VersionedAttributes{
+		Version:     4,
+		Flags:       AttrV4Size | AttrV4OwnerGroup | AttrV4Permissions | AttrV4ModifyTime | AttrV4SubsecondTimes | AttrV6LinkCount,
+		Type:        FileTypeRegular,
+		Size:        0x0102,
+		Owner:       "foo",
+		Group:       "bar",
+		Permissions: 0x81A4,
+		MTime:       VersionedTime{Seconds: 0x2A, Nanoseconds: 0x10},
+		LinkCount:   2, // not defined in version 4
+	}
+
+	want := []byte{
+		0x00, 0x00, 0x01, 0xA5,
+		FileTypeRegular,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02,
+		0x00, 0x00, 0x00, 3, 'f', 'o', 'o',
+		0x00, 0x00, 0x00, 3, 'b', 'a', 'r',
+		0x00, 0x00, 0x81, 0xA4,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2A,
+		0x00, 0x00, 0x00, 0x10,
+	}
+
+	data, err := attr.MarshalBinary()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !bytes.Equal(data, want) {
+		t.Fatalf("MarshalBinary() = %X, but wanted %X", data, want)
+	}
+
+	if attr.Len() != len(want) {
+		t.Errorf("Len() = %d, but expected %d", attr.Len(), len(want))
+	}
+
+	got := VersionedAttributes{Version: 4}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	attr.Flags &^= AttrV6LinkCount
+	attr.LinkCount = 0
+
+	if !reflect.DeepEqual(&got, attr) {
+		t.Errorf("UnmarshalBinary() = %#v, but expected %#v", got, attr)
+	}
+}
+
+func TestVersionedAttributesV6(t *testing.T) {
+	mtime := time.Date(2021, time.March, 1, 12, 0, 0, 500, time.UTC)
+
+	attr := &VersionedAttributes{
+		Version: 6,
+		Flags: AttrV4Size | AttrV6AllocationSize | AttrV4Permissions | AttrV4AccessTime | AttrV4CreateTime | AttrV4ModifyTime |
+			AttrV6CTime | AttrV4ACL | AttrV5Bits | AttrV6TextHint | AttrV6MimeType | AttrV6LinkCount | AttrV6UntranslatedName |
+			AttrV4Extended,
+		Type:             FileTypeDirectory,
+		Size:             1 << 40,
+		AllocationSize:   1<<40 + 4096,
+		Permissions:      0x41ED,
+		ATime:            VersionedTime{Seconds: -1},
+		CreateTime:       VersionedTime{Seconds: 1},
+		MTime:            VersionedTimeOf(mtime),
+		CTime:            VersionedTime{Seconds: 2},
+		ACL:              []byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00},
+		AttribBits:       0x04,
+		AttribBitsValid:  0x0F,
+		TextHint:         0x02,
+		MimeType:         "inode/directory",
+		LinkCount:        3,
+		UntranslatedName: "dir",
+		ExtendedAttributes: []ExtendedAttribute{
+			{Type: "foo", Data: "bar"},
+		},
+	}
+
+	data, err := attr.MarshalBinary()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if attr.Len() != len(data) {
+		t.Errorf("Len() = %d, but marshaled %d bytes", attr.Len(), len(data))
+	}
+
+	got := VersionedAttributes{Version: 6}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// without AttrV4SubsecondTimes, the nanoseconds are not sent.
+	want := *attr
+	want.MTime.Nanoseconds = 0
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalBinary() = %#v, but expected %#v", got, want)
+	}
+
+	if !got.MTime.Time().Equal(mtime.Truncate(time.Second)) {
+		t.Errorf("MTime.Time() = %v, but expected %v", got.MTime.Time(), mtime.Truncate(time.Second))
+	}
+
+	// version 5 has attrib-bits without the valid mask, and none of the fields of version 6.
+	v5 := *attr
+	v5.Version = 5
+
+	data, err = v5.MarshalBinary()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	got = VersionedAttributes{Version: 5}
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if got.Flags != attr.Flags&attrV5Known || got.AttribBits != attr.AttribBits || got.AttribBitsValid != 0 || got.LinkCount != 0 {
+		t.Errorf("UnmarshalBinary() of version 5 = %#v", got)
+	}
+
+	// flags of version 6 are not valid in version 4.
+	got = VersionedAttributes{Version: 4}
+	if err := got.UnmarshalBinary(append([]byte{0x00, 0x00, 0x20, 0x00, FileTypeRegular}, 0x00, 0x00, 0x00, 0x01)); err != StatusBadMessage {
+		t.Errorf("UnmarshalBinary() of unknown flags = %v, but expected %v", err, StatusBadMessage)
+	}
+}
+
+func TestVersionedAttributesAttributes(t *testing.T) {
+	attr := &VersionedAttributes{
+		Version:     6,
+		Flags:       AttrV4Size | AttrV4Permissions | AttrV4AccessTime | AttrV4ModifyTime | AttrV4OwnerGroup,
+		Size:        42,
+		Permissions: 0x81A4,
+		ATime:       VersionedTime{Seconds: 10, Nanoseconds: 5},
+		MTime:       VersionedTime{Seconds: 20},
+		Owner:       "foo",
+	}
+
+	want := Attributes{
+		Flags:       AttrSize | AttrPermissions | AttrACModTime,
+		Size:        42,
+		Permissions: 0x81A4,
+		ATime:       10,
+		MTime:       20,
+	}
+
+	if got := attr.Attributes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Attributes() = %#v, but expected %#v", got, want)
+	}
+}
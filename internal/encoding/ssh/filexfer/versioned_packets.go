@@ -0,0 +1,81 @@
+package sshfx
+
+// VersionedSetstatPacket defines the SSH_FXP_SETSTAT packet of versions 4 to 6 of the protocol,
+// which carries VersionedAttributes, and so can set the owner and group by name, the create time, or the ACL.
+//
+// The version must be set in Attrs.Version before the packet is marshaled or unmarshaled.
+type VersionedSetstatPacket struct {
+	Path  string
+	Attrs VersionedAttributes
+}
+
+// Type returns the SSH_FXP_xy value associated with this packet type.
+func (p *VersionedSetstatPacket) Type() PacketType {
+	return PacketTypeSetstat
+}
+
+// MarshalPacket returns p as a two-part binary encoding of p.
+func (p *VersionedSetstatPacket) MarshalPacket(reqid uint32, b []byte) (header, payload []byte, err error) {
+	buf := NewBuffer(b)
+	if buf.Cap() < 9 {
+		size := 4 + len(p.Path) + p.Attrs.Len() // string(path) + ATTRS(attrs)
+		buf = NewMarshalBuffer(size)
+	}
+
+	buf.StartPacket(PacketTypeSetstat, reqid)
+	buf.AppendString(p.Path)
+
+	p.Attrs.MarshalInto(buf)
+
+	return buf.Packet(payload)
+}
+
+// UnmarshalPacketBody unmarshals the packet body from the given Buffer, in the encoding of p.Attrs.Version.
+// It is assumed that the uint32(request-id) has already been consumed.
+func (p *VersionedSetstatPacket) UnmarshalPacketBody(buf *Buffer) (err error) {
+	*p = VersionedSetstatPacket{
+		Path:  buf.ConsumeString(),
+		Attrs: VersionedAttributes{Version: p.Attrs.Version},
+	}
+
+	return p.Attrs.UnmarshalFrom(buf)
+}
+
+// VersionedFSetstatPacket defines the SSH_FXP_FSETSTAT packet of versions 4 to 6 of the protocol,
+// in the same way as VersionedSetstatPacket.
+type VersionedFSetstatPacket struct {
+	Handle string
+	Attrs  VersionedAttributes
+}
+
+// Type returns the SSH_FXP_xy value associated with this packet type.
+func (p *VersionedFSetstatPacket) Type() PacketType {
+	return PacketTypeFSetstat
+}
+
+// MarshalPacket returns p as a two-part binary encoding of p.
+func (p *VersionedFSetstatPacket) MarshalPacket(reqid uint32, b []byte) (header, payload []byte, err error) {
+	buf := NewBuffer(b)
+	if buf.Cap() < 9 {
+		size := 4 + len(p.Handle) + p.Attrs.Len() // string(handle) + ATTRS(attrs)
+		buf = NewMarshalBuffer(size)
+	}
+
+	buf.StartPacket(PacketTypeFSetstat, reqid)
+	buf.AppendString(p.Handle)
+
+	p.Attrs.MarshalInto(buf)
+
+	return buf.Packet(payload)
+}
+
+// UnmarshalPacketBody unmarshals the packet body from the given Buffer, in the encoding of p.Attrs.Version.
+// It is assumed that the uint32(request-id) has already been consumed.
+func (p *VersionedFSetstatPacket) UnmarshalPacketBody(buf *Buffer) (err error) {
+	*p = VersionedFSetstatPacket{
+		Handle: buf.ConsumeString(),
+		Attrs:  VersionedAttributes{Version: p.Attrs.Version},
+	}
+
+	return p.Attrs.UnmarshalFrom(buf)
+}
@@ -0,0 +1,56 @@
+package sshfx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionedFSetstatPacket(t *testing.T) {
+	const (
+		id     = 42
+		handle = "somehandle"
+	)
+
+	p := &VersionedFSetstatPacket{
+		Handle: handle,
+		Attrs: VersionedAttributes{
+			Version: 6,
+		},
+	}
+	p.Attrs.SetACL(ACL{Entries: []ACE{{Type: ACEAccessAllowed, Mask: ACEMaskReadACL, Who: "EVERYONE@"}}})
+
+	data, err := ComposePacket(p.MarshalPacket(id, nil))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if data[4] != uint8(PacketTypeFSetstat) {
+		t.Fatalf("MarshalPacket() type = %d, but expected %d", data[4], PacketTypeFSetstat)
+	}
+
+	// UnmarshalPacketBody assumes the (length, type, request-id) have already been consumed.
+	got := VersionedFSetstatPacket{Attrs: VersionedAttributes{Version: 6}}
+	if err := got.UnmarshalPacketBody(NewBuffer(data[9:])); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !reflect.DeepEqual(&got, p) {
+		t.Errorf("UnmarshalPacketBody() = %#v, but expected %#v", got, p)
+	}
+
+	sp := &VersionedSetstatPacket{Path: "/foo", Attrs: p.Attrs}
+
+	data, err = ComposePacket(sp.MarshalPacket(id, nil))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	gotSp := VersionedSetstatPacket{Attrs: VersionedAttributes{Version: 6}}
+	if err := gotSp.UnmarshalPacketBody(NewBuffer(data[9:])); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !reflect.DeepEqual(&gotSp, sp) {
+		t.Errorf("UnmarshalPacketBody() = %#v, but expected %#v", gotSp, sp)
+	}
+}
@@ -0,0 +1,72 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrKeepaliveTimeout is the error of Wait, once WithKeepalive has torn down a connection
+// on which the server did not answer a keepalive in time.
+var ErrKeepaliveTimeout = errors.New("sftp: keepalive timed out, connection lost")
+
+// WithKeepalive probes a Client which has received no response for the interval d with a cheap request,
+// SSH_FXP_REALPATH of ".", and tears the connection down if no response at all arrives within a further d,
+// so that a connection which died silently, such as through a NAT or a firewall, fails at once,
+// rather than on the next call, which would hang.
+//
+// Once torn down, outstanding and later requests fail with ErrSSHFxConnectionLost, and Wait returns ErrKeepaliveTimeout.
+// As servers may answer requests in order, d should be longer than the longest request expected,
+// such as a server-side copy.
+// A d of zero or less, the default, sends no keepalives.
+func WithKeepalive(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.keepalive = d
+		return nil
+	}
+}
+
+// keepaliveLoop probes the server every keepalive interval in which no response was received, until the Client is closed.
+func (c *Client) keepaliveLoop() {
+	ticker := time.NewTicker(c.keepalive)
+	defer ticker.Stop()
+
+	last := atomic.LoadInt64(&c.stats.responses)
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if n := atomic.LoadInt64(&c.stats.responses); n != last {
+			// the connection has been in use, and so is alive.
+			last = n
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.keepalive)
+		_, err := c.RealPathContext(ctx, ".")
+		cancel()
+
+		n := atomic.LoadInt64(&c.stats.responses)
+		if (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRequestTimeout)) && n == last {
+			c.lose(ErrKeepaliveTimeout)
+			return
+		}
+		last = n
+	}
+}
+
+// lose tears down the connection with err, as if it had been lost,
+// closing the reader as well as the writer, so that a receive blocked on a dead connection returns.
+func (c *clientConn) lose(err error) {
+	c.broadcastErr(err)
+
+	c.conn.Close()
+	if r, ok := c.conn.Reader.(io.Closer); ok {
+		r.Close()
+	}
+}
@@ -0,0 +1,79 @@
+package sftp
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// keepaliveTestServer answers INIT, and then answers each REALPATH if answer is set, and nothing otherwise.
+func keepaliveTestServer(t *testing.T, answer bool, opts ...ClientOption) *Client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	go func() {
+		defer sw.Close()
+
+		if _, _, err := recvPacket(sr, nil, 0); err != nil {
+			return
+		}
+		sendPacket(sw, &sshFxVersionPacket{Version: sftpProtocolVersion})
+
+		for {
+			_, data, err := recvPacket(sr, nil, 0)
+			if err != nil {
+				return
+			}
+			if answer {
+				id, _ := unmarshalUint32(data)
+				sendPacket(sw, &sshFxpNamePacket{ID: id, NameAttrs: []*sshFxpNameAttr{{Name: "/", LongName: "/", Attrs: emptyFileStat}}})
+			}
+		}
+	}()
+
+	c, err := NewClientPipe(cr, cw, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientKeepaliveTimeout(t *testing.T) {
+	c := keepaliveTestServer(t, false, WithKeepalive(20*time.Millisecond))
+	defer c.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != ErrKeepaliveTimeout {
+			t.Errorf("Wait() = %v, want %v", err, ErrKeepaliveTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not torn down")
+	}
+
+	if _, err := c.Stat("foo"); err != ErrSSHFxConnectionLost {
+		t.Errorf("Stat() = %v, want %v", err, ErrSSHFxConnectionLost)
+	}
+}
+
+func TestClientKeepaliveAnswered(t *testing.T) {
+	c := keepaliveTestServer(t, true, WithKeepalive(10*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Wait() = %v, want the connection kept", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if n := c.Stats().Requests; n < 2 {
+		t.Errorf("Requests = %d, want keepalives sent", n)
+	}
+
+	c.Close()
+}
@@ -1,7 +1,9 @@
 package sftp
 
 import (
+	"context"
 	"path"
+	"sort"
 	"strings"
 )
 
@@ -41,6 +43,16 @@ func Split(p string) (dir, file string) {
 // The only possible returned error is ErrBadPattern, when pattern
 // is malformed.
 func (c *Client) Glob(pattern string) (matches []string, err error) {
+	return c.GlobContext(context.Background(), pattern)
+}
+
+// GlobContext is Glob, which stops with the error of the context once it is done,
+// checking it before each directory is read.
+func (c *Client) GlobContext(ctx context.Context, pattern string) (matches []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if !hasMeta(pattern) {
 		file, err := c.Lstat(pattern)
 		if err != nil {
@@ -55,7 +67,7 @@ func (c *Client) Glob(pattern string) (matches []string, err error) {
 	dir = cleanGlobPath(dir)
 
 	if !hasMeta(dir) {
-		return c.glob(dir, file, nil)
+		return c.glob(ctx, dir, file, nil)
 	}
 
 	// Prevent infinite recursion. See issue 15879.
@@ -64,12 +76,12 @@ func (c *Client) Glob(pattern string) (matches []string, err error) {
 	}
 
 	var m []string
-	m, err = c.Glob(dir)
+	m, err = c.GlobContext(ctx, dir)
 	if err != nil {
 		return
 	}
 	for _, d := range m {
-		matches, err = c.glob(d, file, matches)
+		matches, err = c.glob(ctx, d, file, matches)
 		if err != nil {
 			return
 		}
@@ -93,8 +105,12 @@ func cleanGlobPath(path string) string {
 // and appends them to matches. If the directory cannot be
 // opened, it returns the existing matches. New matches are
 // added in lexicographical order.
-func (c *Client) glob(dir, pattern string, matches []string) (m []string, e error) {
+// Only the error of the context, once it is done, is returned as such.
+func (c *Client) glob(ctx context.Context, dir, pattern string, matches []string) (m []string, e error) {
 	m = matches
+	if err := ctx.Err(); err != nil {
+		return m, err
+	}
 	fi, err := c.Stat(dir)
 	if err != nil {
 		return
@@ -102,14 +118,23 @@ func (c *Client) glob(dir, pattern string, matches []string) (m []string, e erro
 	if !fi.IsDir() {
 		return
 	}
-	names, err := c.ReadDir(dir)
+	names, err := c.ReadDirContext(ctx, dir)
 	if err != nil {
-		return
+		return m, ctx.Err()
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Name() < names[j].Name() })
+
+	if c.compat.CaseInsensitive {
+		pattern = strings.ToLower(pattern)
 	}
-	//sort.Strings(names)
 
 	for _, n := range names {
-		matched, err := Match(pattern, n.Name())
+		name := n.Name()
+		if c.compat.CaseInsensitive {
+			name = strings.ToLower(name)
+		}
+
+		matched, err := Match(pattern, name)
 		if err != nil {
 			return m, err
 		}
@@ -0,0 +1,42 @@
+package sftp
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGlobContext(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"b/2.log": "",
+		"b/1.log": "",
+		"a/3.log": "",
+		"a/1.txt": "",
+		"c/4.log": "",
+	})
+
+	matches, err := client.GlobContext(context.Background(), filepath.Join(dir, "[ab]", "*.log"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a", "3.log"),
+		filepath.Join(dir, "b", "1.log"),
+		filepath.Join(dir, "b", "2.log"),
+	}, matches)
+
+	_, err = client.GlobContext(context.Background(), filepath.Join(dir, "[", "*"))
+	assert.Equal(t, ErrBadPattern, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.GlobContext(ctx, filepath.Join(dir, "*", "*.log"))
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,66 @@
+package sftp
+
+// WithMaxFileSize limits the size of the files the Server writes to max bytes.
+// A write that would extend a file beyond max, or a SETSTAT or FSETSTAT of a larger size,
+// is refused with ErrSSHFxQuotaExceeded, without writing any of its data.
+// Clients see SSH_FX_FAILURE, and the message "quota exceeded", unless WithExtendedStatusCodes is set.
+// A max of zero or less means no limit.
+//
+// Only the size a request would give the file is checked,
+// the limit does not apply to files that are already larger, unless they are written beyond max.
+func WithMaxFileSize(max int64) ServerOption {
+	return func(s *Server) error {
+		s.maxFileSize = max
+		return nil
+	}
+}
+
+// WithRSMaxFileSize limits the size of the files written through the Handlers to max bytes,
+// in the same way as WithMaxFileSize,
+// so that the limit holds for any backend, without each FileWriter having to enforce it.
+func WithRSMaxFileSize(max int64) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.maxFileSize = max
+	}
+}
+
+// checkFileSize returns ErrSSHFxQuotaExceeded if the request p would make a file larger than max.
+func checkFileSize(p requestPacket, max int64) error {
+	if epkt, ok := p.(*sshFxpExtendedPacket); ok {
+		p = epkt.SpecificPacket
+	}
+
+	var off, n uint64
+	switch p := p.(type) {
+	case *sshFxpWritePacket:
+		off, n = p.Offset, uint64(len(p.Data))
+	case *sshFxpExtendedPacketWriteBatch:
+		off, n = p.Offset, uint64(len(p.Data))
+	case *sshFxpSetstatPacket:
+		if p.Flags&sshFileXferAttrSize == 0 {
+			return nil
+		}
+		fs, err := p.unmarshalFileStat(p.Flags)
+		if err != nil {
+			return nil // left to the request itself to fail
+		}
+		off = fs.Size
+	case *sshFxpFsetstatPacket:
+		if p.Flags&sshFileXferAttrSize == 0 {
+			return nil
+		}
+		fs, err := p.unmarshalFileStat(p.Flags)
+		if err != nil {
+			return nil
+		}
+		off = fs.Size
+	default:
+		return nil
+	}
+
+	// compared without adding, as the end of a write could overflow.
+	if n > uint64(max) || off > uint64(max)-n {
+		return ErrSSHFxQuotaExceeded
+	}
+	return nil
+}
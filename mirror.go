@@ -0,0 +1,520 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MirrorDirection is the direction in which Mirror copies.
+type MirrorDirection int
+
+// Mirror directions.
+const (
+	// MirrorUpload makes a remote directory a mirror of a local directory.
+	MirrorUpload MirrorDirection = iota
+
+	// MirrorDownload makes a local directory a mirror of a remote directory.
+	MirrorDownload
+)
+
+// MirrorOptions configures Mirror.
+type MirrorOptions struct {
+	// Direction is the direction to copy in, by default MirrorUpload.
+	Direction MirrorDirection
+
+	// DeleteExtraneous removes files and directories from the destination which are not in the source.
+	// It also allows a file to replace a directory, or a directory a file.
+	DeleteExtraneous bool
+
+	// Exclude lists patterns, in the syntax of path.Match, of the files and directories to leave alone,
+	// neither copying them, nor deleting them from the destination.
+	// A pattern containing a slash is matched against the slash-separated path relative to the mirrored directory,
+	// and any other pattern against the base name, so that "*.tmp" excludes temporary files at any depth.
+	Exclude []string
+
+	// DryRun only reports the actions that would be taken, without modifying the destination.
+	DryRun bool
+
+	// OnAction, if not nil, is called with each action, before it is taken.
+	OnAction func(MirrorAction)
+}
+
+// MirrorOp is the kind of a MirrorAction.
+type MirrorOp int
+
+// Mirror operations.
+const (
+	MirrorCopy   MirrorOp = iota // copy a file that is missing, or differs, at the destination
+	MirrorMkdir                  // create a directory at the destination
+	MirrorDelete                 // remove an extraneous file or directory, with its contents, from the destination
+)
+
+func (op MirrorOp) String() string {
+	switch op {
+	case MirrorCopy:
+		return "copy"
+	case MirrorMkdir:
+		return "mkdir"
+	case MirrorDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("MirrorOp(%d)", int(op))
+	}
+}
+
+// MirrorAction is an action taken, or planned, by Mirror.
+type MirrorAction struct {
+	Op MirrorOp
+
+	// Path is the slash-separated path relative to the mirrored directories, "." for the directories themselves.
+	Path string
+
+	// Size is the number of bytes to copy, for MirrorCopy.
+	Size int64
+}
+
+func (a MirrorAction) String() string {
+	if a.Op == MirrorCopy {
+		return fmt.Sprintf("%v %s (%d bytes)", a.Op, a.Path, a.Size)
+	}
+	return fmt.Sprintf("%v %s", a.Op, a.Path)
+}
+
+// MirrorResult summarizes the actions taken, or planned, by Mirror.
+type MirrorResult struct {
+	// Actions lists every action, in the order they were taken.
+	Actions []MirrorAction
+
+	// Copied, Created, and Deleted count the files copied, the directories created,
+	// and the files and directories deleted.
+	Copied, Created, Deleted int
+
+	// Unchanged counts the files already identical at the destination.
+	Unchanged int
+
+	// Skipped counts the source entries which are neither files nor directories, such as symbolic links.
+	Skipped int
+
+	// Bytes is the number of bytes copied.
+	Bytes int64
+}
+
+// Mirror makes the directory dst a mirror of the directory src,
+// copying from local to remote, or from remote to local, depending on opts.Direction.
+// A nil opts is the same as the zero MirrorOptions.
+//
+// A file is copied if it is missing at the destination, or if its size or modification time differs.
+// Copied files are given the permissions and modification time of their source,
+// so that mirroring again copies only the files which have since changed.
+// Symbolic links, and other special files, are skipped.
+//
+// Mirror stops at the first error, returning the result so far alongside it.
+// The context is checked between files.
+func (c *Client) Mirror(ctx context.Context, src, dst string, opts *MirrorOptions) (*MirrorResult, error) {
+	if opts == nil {
+		opts = new(MirrorOptions)
+	}
+
+	for _, pattern := range opts.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("sftp: mirror: exclude %q: %w", pattern, err)
+		}
+	}
+
+	m := &mirror{
+		ctx:    ctx,
+		opts:   opts,
+		result: new(MirrorResult),
+	}
+
+	local, remote := localMirrorFS{}, remoteMirrorFS{ctx: ctx, c: c}
+	switch opts.Direction {
+	case MirrorUpload:
+		m.src, m.dst = local, remote
+	case MirrorDownload:
+		m.src, m.dst = remote, local
+	default:
+		return nil, fmt.Errorf("sftp: mirror: invalid direction %d", opts.Direction)
+	}
+	m.srcRoot, m.dstRoot = src, dst
+
+	if err := m.run(); err != nil {
+		return m.result, err
+	}
+	return m.result, nil
+}
+
+type mirror struct {
+	ctx    context.Context
+	opts   *MirrorOptions
+	result *MirrorResult
+
+	src, dst         mirrorFS
+	srcRoot, dstRoot string
+}
+
+func (m *mirror) run() error {
+	fi, err := m.src.lstat(m.srcRoot)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "mirror", Path: m.srcRoot, Err: errors.New("not a directory")}
+	}
+
+	dfi, err := m.dst.lstat(m.dstRoot)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if err := m.act(MirrorAction{Op: MirrorMkdir, Path: "."}, func() error {
+			return m.dst.mkdirAll(m.dstRoot)
+		}); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !dfi.IsDir():
+		return &os.PathError{Op: "mirror", Path: m.dstRoot, Err: errors.New("not a directory")}
+	}
+
+	return m.dir(".")
+}
+
+// act records the action, and unless this is a dry run, takes it by calling fn.
+func (m *mirror) act(a MirrorAction, fn func() error) error {
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+
+	if m.opts.OnAction != nil {
+		m.opts.OnAction(a)
+	}
+
+	if !m.opts.DryRun {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	m.result.Actions = append(m.result.Actions, a)
+	switch a.Op {
+	case MirrorCopy:
+		m.result.Copied++
+		m.result.Bytes += a.Size
+	case MirrorMkdir:
+		m.result.Created++
+	case MirrorDelete:
+		m.result.Deleted++
+	}
+	return nil
+}
+
+func (m *mirror) excluded(rel string) bool {
+	for _, pattern := range m.opts.Exclude {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dir mirrors the directory rel, relative to the roots.
+func (m *mirror) dir(rel string) error {
+	srcEntries, err := m.src.readDir(m.src.join(m.srcRoot, rel))
+	if err != nil {
+		return err
+	}
+	sort.Slice(srcEntries, func(i, j int) bool { return srcEntries[i].Name() < srcEntries[j].Name() })
+
+	// in a dry run, the destination directory might not have been created.
+	dstEntries, err := m.dst.readDir(m.dst.join(m.dstRoot, rel))
+	if err != nil && !(m.opts.DryRun && errors.Is(err, os.ErrNotExist)) {
+		return err
+	}
+
+	existing := make(map[string]os.FileInfo, len(dstEntries))
+	for _, fi := range dstEntries {
+		if err := checkEntryName(m.dst.join(m.dstRoot, rel), fi.Name()); err != nil {
+			return err
+		}
+		existing[fi.Name()] = fi
+	}
+
+	seen := make(map[string]bool, len(srcEntries))
+	for _, fi := range srcEntries {
+		name := fi.Name()
+		if err := checkEntryName(m.src.join(m.srcRoot, rel), name); err != nil {
+			return err
+		}
+		seen[name] = true
+
+		entry := path.Join(rel, name)
+		if m.excluded(entry) {
+			continue
+		}
+
+		if err := m.entry(entry, fi, existing[name]); err != nil {
+			return err
+		}
+	}
+
+	if !m.opts.DeleteExtraneous {
+		return nil
+	}
+
+	sort.Slice(dstEntries, func(i, j int) bool { return dstEntries[i].Name() < dstEntries[j].Name() })
+	for _, fi := range dstEntries {
+		entry := path.Join(rel, fi.Name())
+		if seen[fi.Name()] || m.excluded(entry) {
+			continue
+		}
+
+		if err := m.delete(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// entry mirrors the source entry rel, described by fi, to the destination, described by dfi if it exists.
+func (m *mirror) entry(rel string, fi, dfi os.FileInfo) error {
+	if !fi.IsDir() && !fi.Mode().IsRegular() {
+		m.result.Skipped++
+		return nil
+	}
+
+	if dfi != nil && fi.IsDir() != dfi.IsDir() {
+		if !m.opts.DeleteExtraneous {
+			return &os.PathError{Op: "mirror", Path: m.dst.join(m.dstRoot, rel), Err: errors.New("type differs from the source")}
+		}
+		if err := m.delete(rel); err != nil {
+			return err
+		}
+		dfi = nil
+	}
+
+	if fi.IsDir() {
+		if dfi == nil {
+			if err := m.act(MirrorAction{Op: MirrorMkdir, Path: rel}, func() error {
+				return m.dst.mkdir(m.dst.join(m.dstRoot, rel))
+			}); err != nil {
+				return err
+			}
+		}
+		return m.dir(rel)
+	}
+
+	if dfi != nil && dfi.Size() == fi.Size() && dfi.ModTime().Unix() == fi.ModTime().Unix() {
+		m.result.Unchanged++
+		return nil
+	}
+
+	return m.act(MirrorAction{Op: MirrorCopy, Path: rel, Size: fi.Size()}, func() error {
+		return m.copy(rel, fi)
+	})
+}
+
+func (m *mirror) delete(rel string) error {
+	return m.act(MirrorAction{Op: MirrorDelete, Path: rel}, func() error {
+		return m.dst.removeAll(m.dst.join(m.dstRoot, rel))
+	})
+}
+
+func (m *mirror) copy(rel string, fi os.FileInfo) error {
+	return copyMirrorFile(m.src, m.dst, m.src.join(m.srcRoot, rel), m.dst.join(m.dstRoot, rel), fi)
+}
+
+// copyMirrorFile copies the file srcName, described by fi, to dstName,
+// and gives it the permissions and modification time of the source.
+func copyMirrorFile(src, dst mirrorFS, srcName, dstName string, fi os.FileInfo) error {
+	r, err := src.open(srcName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dst.create(dstName)
+	if err != nil {
+		return err
+	}
+
+	// ReadFrom is called directly, as io.Copy would prefer the WriteTo of a local file,
+	// which hides its size from File.ReadFrom, and so stops it from writing concurrently.
+	if rf, ok := w.(io.ReaderFrom); ok {
+		_, err = rf.ReadFrom(r)
+	} else {
+		_, err = io.Copy(w, r)
+	}
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if err := dst.chmod(dstName, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return dst.chtimes(dstName, fi.ModTime())
+}
+
+// mirrorFS is one side of a mirror, either local or remote.
+// checkEntryName returns an error if name, as listed in the directory dir, is not that of an entry of dir,
+// such as "..", or a name with a path separator, which a hostile server could list to reach outside of the tree.
+// It is checked before the name is joined to any path.
+func checkEntryName(dir, name string) error {
+	switch {
+	case name == "", name == ".", name == "..",
+		strings.Contains(name, "/"),
+		runtime.GOOS == "windows" && strings.Contains(name, `\`):
+		return &os.PathError{Op: "readdir", Path: dir, Err: fmt.Errorf("invalid entry name %q", name)}
+	}
+	return nil
+}
+
+type mirrorFS interface {
+	join(dir, rel string) string
+	lstat(name string) (os.FileInfo, error)
+	stat(name string) (os.FileInfo, error)
+	readDir(name string) ([]os.FileInfo, error)
+	open(name string) (io.ReadCloser, error)
+	create(name string) (io.WriteCloser, error)
+	mkdir(name string) error
+	mkdirAll(name string) error
+	removeAll(name string) error
+	chmod(name string, mode os.FileMode) error
+	chtimes(name string, mtime time.Time) error
+	readLink(name string) (string, error)
+	symlink(target, name string) error
+}
+
+type localMirrorFS struct{}
+
+func (localMirrorFS) join(dir, rel string) string {
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
+
+func (localMirrorFS) lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (localMirrorFS) stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localMirrorFS) readDir(name string) ([]os.FileInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdir(-1)
+}
+
+func (localMirrorFS) open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (localMirrorFS) create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func (localMirrorFS) mkdir(name string) error {
+	return os.Mkdir(name, 0o755)
+}
+
+func (localMirrorFS) mkdirAll(name string) error {
+	return os.MkdirAll(name, 0o755)
+}
+
+func (localMirrorFS) removeAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (localMirrorFS) chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (localMirrorFS) chtimes(name string, mtime time.Time) error {
+	return os.Chtimes(name, mtime, mtime)
+}
+
+func (localMirrorFS) readLink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (localMirrorFS) symlink(target, name string) error {
+	return os.Symlink(target, name)
+}
+
+type remoteMirrorFS struct {
+	ctx context.Context
+	c   *Client
+}
+
+func (remoteMirrorFS) join(dir, rel string) string {
+	return path.Join(dir, rel)
+}
+
+func (fs remoteMirrorFS) lstat(name string) (os.FileInfo, error) {
+	return fs.c.Lstat(name)
+}
+
+func (fs remoteMirrorFS) stat(name string) (os.FileInfo, error) {
+	return fs.c.Stat(name)
+}
+
+func (fs remoteMirrorFS) readDir(name string) ([]os.FileInfo, error) {
+	return fs.c.ReadDirContext(fs.ctx, name)
+}
+
+func (fs remoteMirrorFS) open(name string) (io.ReadCloser, error) {
+	return fs.c.Open(name)
+}
+
+func (fs remoteMirrorFS) create(name string) (io.WriteCloser, error) {
+	return fs.c.Create(name)
+}
+
+func (fs remoteMirrorFS) mkdir(name string) error {
+	return fs.c.Mkdir(name)
+}
+
+func (fs remoteMirrorFS) mkdirAll(name string) error {
+	return fs.c.MkdirAll(name)
+}
+
+func (fs remoteMirrorFS) removeAll(name string) error {
+	return fs.c.RemoveAll(name)
+}
+
+func (fs remoteMirrorFS) chmod(name string, mode os.FileMode) error {
+	return fs.c.Chmod(name, mode)
+}
+
+func (fs remoteMirrorFS) chtimes(name string, mtime time.Time) error {
+	return fs.c.Chtimes(name, mtime, mtime)
+}
+
+func (fs remoteMirrorFS) readLink(name string) (string, error) {
+	return fs.c.ReadLink(name)
+}
+
+func (fs remoteMirrorFS) symlink(target, name string) error {
+	return fs.c.Symlink(target, name)
+}
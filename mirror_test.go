@@ -0,0 +1,134 @@
+package sftp
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, ioutil.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestClientMirror(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	local, remote := t.TempDir(), filepath.Join(t.TempDir(), "mirror")
+
+	writeTree(t, local, map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+		"skip.tmp":      "temporary",
+	})
+
+	opts := &MirrorOptions{Exclude: []string{"*.tmp"}}
+
+	res, err := client.Mirror(ctx, local, remote, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Copied)
+	assert.Equal(t, 3, res.Created) // the root, sub, and sub/deep
+	assert.Equal(t, int64(6), res.Bytes)
+	assert.Equal(t, map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+	}, readTree(t, remote))
+
+	// a second mirror finds nothing to do.
+	res, err = client.Mirror(ctx, local, remote, opts)
+	require.NoError(t, err)
+	assert.Empty(t, res.Actions)
+	assert.Equal(t, 3, res.Unchanged)
+
+	require.NoError(t, os.Remove(filepath.Join(local, "a.txt")))
+	writeTree(t, local, map[string]string{"sub/b.txt": "changed"})
+	writeTree(t, remote, map[string]string{"extra/x": "x", "keep.tmp": "excluded"})
+
+	opts.DeleteExtraneous = true
+	opts.DryRun = true
+
+	var planned []MirrorAction
+	opts.OnAction = func(a MirrorAction) {
+		planned = append(planned, a)
+	}
+
+	res, err = client.Mirror(ctx, local, remote, opts)
+	require.NoError(t, err)
+	expected := []MirrorAction{
+		{Op: MirrorCopy, Path: "sub/b.txt", Size: 7},
+		{Op: MirrorDelete, Path: "a.txt"},
+		{Op: MirrorDelete, Path: "extra"},
+	}
+	assert.Equal(t, expected, res.Actions)
+	assert.Equal(t, expected, planned)
+	assert.Equal(t, "bb", readTree(t, remote)["sub/b.txt"])
+
+	opts.DryRun = false
+	opts.OnAction = nil
+
+	res, err = client.Mirror(ctx, local, remote, opts)
+	require.NoError(t, err)
+	assert.Equal(t, expected, res.Actions)
+	assert.Equal(t, map[string]string{
+		"sub/b.txt":     "changed",
+		"sub/deep/c.go": "ccc",
+		"keep.tmp":      "excluded",
+	}, readTree(t, remote))
+
+	// and back again.
+	downloaded := t.TempDir()
+	res, err = client.Mirror(ctx, remote, downloaded, &MirrorOptions{Direction: MirrorDownload})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Copied)
+	assert.Equal(t, readTree(t, remote), readTree(t, downloaded))
+}
+
+func TestClientMirrorHostileListing(t *testing.T) {
+	p := hostileTreePair(t)
+	defer p.Close()
+
+	ctx := context.Background()
+
+	_, err := p.cli.Mirror(ctx, "/tree", t.TempDir(), &MirrorOptions{Direction: MirrorDownload})
+	assert.Error(t, err)
+
+	// the listing of the destination is not trusted either.
+	_, err = p.cli.Mirror(ctx, t.TempDir(), "/tree", &MirrorOptions{DeleteExtraneous: true})
+	assert.Error(t, err)
+
+	_, err = p.cli.Stat("/tree/ok.txt")
+	assert.NoError(t, err)
+	_, err = p.cli.Stat("/tree")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,62 @@
+package sftp
+
+// OpenRequest describes an SSH_FXP_OPEN to an open hook, which may change it before the file is opened.
+type OpenRequest struct {
+	// Flags are the flags the file is opened with, such as whether it is to be created, or truncated.
+	Flags FileOpenFlags
+
+	// AttrFlags tells which of Attrs were sent by the client, and are to be applied.
+	// The Server only applies the permissions, and only when the file is created.
+	AttrFlags FileAttrFlags
+
+	// Attrs are the attributes for a file that is created.
+	Attrs FileStat
+}
+
+// WithOpenHook sets a function to be called with every SSH_FXP_OPEN, before the file is opened,
+// with the path on the local filesystem, and the request, which the hook may change,
+// such as to clear Flags.Excl, or to restrict the permissions of files created.
+// If the hook returns an error, such as ErrSSHFxPermissionDenied, the open is refused with that error,
+// so that it is a single point to apply a policy for the creation of files.
+//
+// A hook may not open for writing a file that a read-only Server opens for reading.
+func WithOpenHook(hook func(path string, req *OpenRequest) error) ServerOption {
+	return func(s *Server) error {
+		s.openHook = hook
+		return nil
+	}
+}
+
+// WithRSOpenHook sets a function to be called with every SSH_FXP_OPEN, before it is passed to the Handlers,
+// in the same way as WithOpenHook.
+// The path is the cleaned path, as it will be given to the Handlers in Request.Filepath.
+func WithRSOpenHook(hook func(path string, req *OpenRequest) error) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.openHook = hook
+	}
+}
+
+// applyOpenHook passes the open p, of the file at path, through hook, and rewrites p with any changes it makes.
+func applyOpenHook(hook func(path string, req *OpenRequest) error, path string, p *sshFxpOpenPacket) error {
+	fs, err := p.unmarshalFileStat(p.Flags)
+	if err != nil {
+		return err
+	}
+
+	req := &OpenRequest{
+		Flags:     newFileOpenFlags(p.Pflags),
+		AttrFlags: newFileAttrFlags(p.Flags),
+		Attrs:     *fs,
+	}
+	if err := hook(path, req); err != nil {
+		return err
+	}
+
+	p.Pflags = req.Flags.pflags()
+	p.Flags = req.AttrFlags.flags()
+	if len(req.Attrs.Extended) > 0 {
+		p.Flags |= sshFileXferAttrExtended
+	}
+	p.Attrs = marshalFileStat(nil, p.Flags, &req.Attrs)
+	return nil
+}
@@ -0,0 +1,347 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	sshfx "github.com/pkg/sftp/internal/encoding/ssh/filexfer"
+)
+
+// dumpHexHead is the maximum number of payload bytes rendered in hex by DumpPacket.
+const dumpHexHead = 32
+
+// DumpPacket renders a single SFTP packet into a human-readable multi-line description,
+// suitable for logging and debugging tools.
+//
+// The packet must be given as it appears on the wire,
+// including the leading uint32(length) and byte(type).
+//
+// The dump lists the packet type, request id, each decoded field,
+// a breakdown of any file attributes, and a hex dump of the head of any opaque payload.
+// Malformed or truncated packets are rendered as far as they can be decoded,
+// followed by a line describing the error.
+func DumpPacket(frame []byte) string {
+	if len(frame) < 4 {
+		return fmt.Sprintf("malformed packet: %v (%d bytes)\n", errShortPacket, len(frame))
+	}
+
+	length := binary.BigEndian.Uint32(frame)
+	data := frame[4:]
+	if uint64(length) != uint64(len(data)) {
+		return fmt.Sprintf("malformed packet: length field %d does not match %d bytes of data\n", length, len(data))
+	}
+	if length == 0 {
+		return fmt.Sprintf("malformed packet: %v (0 bytes)\n", errShortPacket)
+	}
+
+	return dumpPacket(data[0], data[1:])
+}
+
+// dumpPacket renders the packet of type typ with the body data,
+// which is everything following the byte(type).
+func dumpPacket(typ uint8, data []byte) string {
+	d := &packetDumper{b: data}
+
+	fmt.Fprintf(&d.out, "%s (%d), length %d\n", fxp(typ), typ, 1+len(data))
+
+	switch typ {
+	case sshFxpInit, sshFxpVersion:
+		d.u32("version")
+		for i := 0; d.err == nil && len(d.b) > 0; i++ {
+			d.line(1, "extension[%d]:", i)
+			d.strAt(2, "name")
+			d.strAt(2, "data")
+		}
+
+	case sshFxpOpen:
+		d.u32("id")
+		d.str("filename")
+		d.pflags()
+		d.attrs(1, "attrs")
+
+	case sshFxpClose, sshFxpReaddir, sshFxpFstat, sshFxpHandle:
+		d.u32("id")
+		d.str("handle")
+
+	case sshFxpRead:
+		d.u32("id")
+		d.str("handle")
+		d.u64("offset")
+		d.u32("len")
+
+	case sshFxpWrite:
+		d.u32("id")
+		d.str("handle")
+		d.u64("offset")
+		d.data()
+
+	case sshFxpLstat, sshFxpStat, sshFxpOpendir, sshFxpRemove, sshFxpRmdir, sshFxpRealpath, sshFxpReadlink:
+		d.u32("id")
+		d.str("path")
+
+	case sshFxpMkdir, sshFxpSetstat:
+		d.u32("id")
+		d.str("path")
+		d.attrs(1, "attrs")
+
+	case sshFxpFsetstat:
+		d.u32("id")
+		d.str("handle")
+		d.attrs(1, "attrs")
+
+	case sshFxpRename:
+		d.u32("id")
+		d.str("oldpath")
+		d.str("newpath")
+
+	case sshFxpSymlink:
+		// This is the OpenSSH argument order, see the note on sshFxpSymlinkPacket.
+		d.u32("id")
+		d.str("targetpath")
+		d.str("linkpath")
+
+	case sshFxpStatus:
+		d.u32("id")
+		d.status()
+
+	case sshFxpData:
+		d.u32("id")
+		d.data()
+
+	case sshFxpName:
+		d.u32("id")
+		count := d.u32("count")
+		for i := uint32(0); d.err == nil && i < count; i++ {
+			d.line(1, "name[%d]:", i)
+			d.strAt(2, "filename")
+			d.strAt(2, "longname")
+			d.attrs(2, "attrs")
+		}
+
+	case sshFxpAttrs:
+		d.u32("id")
+		d.attrs(1, "attrs")
+
+	case sshFxpExtended:
+		d.u32("id")
+		d.str("extended-request")
+		d.payload(1)
+
+	default:
+		if len(d.b) >= 4 {
+			d.u32("id")
+		}
+		d.payload(1)
+	}
+
+	if d.err == nil && len(d.b) > 0 {
+		d.line(1, "trailing data:")
+		d.payload(2)
+	}
+
+	if d.err != nil {
+		d.line(1, "error: %v", d.err)
+	}
+
+	return d.out.String()
+}
+
+// packetDumper consumes fields from b, writing a description of each to out.
+// Once an error is encountered, all further fields are skipped.
+type packetDumper struct {
+	out strings.Builder
+	b   []byte
+	err error
+}
+
+func (d *packetDumper) line(indent int, format string, args ...interface{}) {
+	d.out.WriteString(strings.Repeat("  ", indent))
+	fmt.Fprintf(&d.out, format, args...)
+	d.out.WriteByte('\n')
+}
+
+func (d *packetDumper) u32(name string) uint32 {
+	if d.err != nil {
+		return 0
+	}
+
+	var v uint32
+	v, d.b, d.err = unmarshalUint32Safe(d.b)
+	if d.err == nil {
+		d.line(1, "%s: %d", name, v)
+	}
+	return v
+}
+
+func (d *packetDumper) u64(name string) {
+	if d.err != nil {
+		return
+	}
+
+	var v uint64
+	v, d.b, d.err = unmarshalUint64Safe(d.b)
+	if d.err == nil {
+		d.line(1, "%s: %d", name, v)
+	}
+}
+
+func (d *packetDumper) str(name string) {
+	d.strAt(1, name)
+}
+
+func (d *packetDumper) strAt(indent int, name string) {
+	if d.err != nil {
+		return
+	}
+
+	var v string
+	v, d.b, d.err = unmarshalStringSafe(d.b)
+	if d.err == nil {
+		d.line(indent, "%s: %q", name, v)
+	}
+}
+
+func (d *packetDumper) pflags() {
+	if d.err != nil {
+		return
+	}
+
+	var v uint32
+	v, d.b, d.err = unmarshalUint32Safe(d.b)
+	if d.err != nil {
+		return
+	}
+
+	var names []string
+	for _, f := range []struct {
+		bit  uint32
+		name string
+	}{
+		{sshFxfRead, "READ"},
+		{sshFxfWrite, "WRITE"},
+		{sshFxfAppend, "APPEND"},
+		{sshFxfCreat, "CREAT"},
+		{sshFxfTrunc, "TRUNC"},
+		{sshFxfExcl, "EXCL"},
+	} {
+		if v&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+
+	d.line(1, "pflags: 0x%08x (%s)", v, strings.Join(names, "|"))
+}
+
+func (d *packetDumper) status() {
+	if d.err != nil {
+		return
+	}
+
+	var code uint32
+	code, d.b, d.err = unmarshalUint32Safe(d.b)
+	if d.err != nil {
+		return
+	}
+	d.line(1, "code: %d (%v)", code, sshfx.Status(code))
+
+	d.str("message")
+	if d.err == nil && len(d.b) > 0 {
+		d.str("language")
+	}
+}
+
+func (d *packetDumper) data() {
+	if d.err != nil {
+		return
+	}
+
+	var n uint32
+	n, d.b, d.err = unmarshalUint32Safe(d.b)
+	if d.err != nil {
+		return
+	}
+	if uint64(n) > uint64(len(d.b)) {
+		d.err = errShortPacket
+		return
+	}
+
+	d.line(1, "data: %d bytes", n)
+
+	data := d.b[:n]
+	d.b = d.b[n:]
+
+	d.hex(2, data)
+}
+
+// payload consumes and renders the remainder of the packet as opaque data.
+func (d *packetDumper) payload(indent int) {
+	if d.err != nil {
+		return
+	}
+
+	data := d.b
+	d.b = nil
+
+	if len(data) == 0 {
+		return
+	}
+
+	d.line(indent, "payload: %d bytes", len(data))
+	d.hex(indent+1, data)
+}
+
+func (d *packetDumper) hex(indent int, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	if len(data) > dumpHexHead {
+		d.line(indent, "% x ...", data[:dumpHexHead])
+		return
+	}
+
+	d.line(indent, "% x", data)
+}
+
+func (d *packetDumper) attrs(indent int, name string) {
+	if d.err != nil {
+		return
+	}
+
+	var flags uint32
+	flags, d.b, d.err = unmarshalUint32Safe(d.b)
+	if d.err != nil {
+		return
+	}
+
+	var fs *FileStat
+	fs, d.b, d.err = unmarshalFileStat(flags, d.b)
+	if d.err != nil {
+		return
+	}
+
+	d.line(indent, "%s: flags 0x%08x", name, flags)
+	indent++
+
+	if flags&sshFileXferAttrSize != 0 {
+		d.line(indent, "size: %d", fs.Size)
+	}
+	if flags&sshFileXferAttrUIDGID != 0 {
+		d.line(indent, "uid: %d", fs.UID)
+		d.line(indent, "gid: %d", fs.GID)
+	}
+	if flags&sshFileXferAttrPermissions != 0 {
+		d.line(indent, "permissions: 0%o (%v)", fs.Mode, fs.FileMode())
+	}
+	if flags&sshFileXferAttrACmodTime != 0 {
+		d.line(indent, "atime: %d (%s)", fs.Atime, fs.AccessTime().UTC().Format(time.RFC3339))
+		d.line(indent, "mtime: %d (%s)", fs.Mtime, fs.ModTime().UTC().Format(time.RFC3339))
+	}
+	if flags&sshFileXferAttrExtended != 0 {
+		for _, ext := range fs.Extended {
+			d.line(indent, "extended: %q = %q", ext.ExtType, ext.ExtData)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package sftp
+
+import (
+	"bytes"
+	"encoding"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func dumpTestFrame(t *testing.T, m encoding.BinaryMarshaler) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := sendPacket(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDumpPacket(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  encoding.BinaryMarshaler
+		want []string
+	}{
+		{
+			name: "open",
+			pkt: &sshFxpOpenPacket{
+				ID:     42,
+				Path:   "/foo/bar",
+				Pflags: sshFxfWrite | sshFxfCreat | sshFxfTrunc,
+				Flags:  sshFileXferAttrPermissions,
+				Attrs:  &FileStat{Mode: 0o644},
+			},
+			want: []string{
+				"SSH_FXP_OPEN (3)",
+				"  id: 42",
+				`  filename: "/foo/bar"`,
+				"  pflags: 0x0000001a (WRITE|CREAT|TRUNC)",
+				"  attrs: flags 0x00000004",
+				"    permissions: 0644 (-rw-r--r--)",
+			},
+		},
+		{
+			name: "read",
+			pkt:  &sshFxpReadPacket{ID: 1, Handle: "h", Offset: 4096, Len: 32768},
+			want: []string{
+				"SSH_FXP_READ (5)",
+				`  handle: "h"`,
+				"  offset: 4096",
+				"  len: 32768",
+			},
+		},
+		{
+			name: "write",
+			pkt:  &sshFxpWritePacket{ID: 2, Handle: "h", Length: 3, Data: []byte("abc")},
+			want: []string{
+				"SSH_FXP_WRITE (6)",
+				"  data: 3 bytes",
+				"    61 62 63",
+			},
+		},
+		{
+			name: "status",
+			pkt:  statusFromError(7, ErrSSHFxNoSuchFile),
+			want: []string{
+				"SSH_FXP_STATUS (101)",
+				"  id: 7",
+				"  code: 2 (SSH_FX_NO_SUCH_FILE)",
+				`  message: "no such file"`,
+			},
+		},
+		{
+			name: "name",
+			pkt: &sshFxpNamePacket{
+				ID: 3,
+				NameAttrs: []*sshFxpNameAttr{
+					{Name: "a", LongName: "-rw-r--r-- a", Attrs: emptyFileStat},
+				},
+			},
+			want: []string{
+				"SSH_FXP_NAME (104)",
+				"  count: 1",
+				"  name[0]:",
+				`    filename: "a"`,
+				`    longname: "-rw-r--r-- a"`,
+				"    attrs: flags 0x00000000",
+			},
+		},
+		{
+			name: "data head",
+			pkt:  &sshFxpDataPacket{ID: 4, Length: 64, Data: make([]byte, 64, 64+dataHeaderLen)},
+			want: []string{
+				"SSH_FXP_DATA (103)",
+				"  data: 64 bytes",
+				" ...",
+			},
+		},
+		{
+			name: "extended",
+			pkt:  &sshFxpStatvfsPacket{ID: 5, Path: "/"},
+			want: []string{
+				"SSH_FXP_EXTENDED (200)",
+				`  extended-request: "statvfs@openssh.com"`,
+				"  payload: 5 bytes",
+				"    00 00 00 01 2f",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DumpPacket(dumpTestFrame(t, tt.pkt))
+			for _, want := range tt.want {
+				assert.Contains(t, got, want)
+			}
+			assert.NotContains(t, got, "error:")
+		})
+	}
+}
+
+func TestDumpPacketMalformed(t *testing.T) {
+	frame := dumpTestFrame(t, &sshFxpRenamePacket{ID: 1, Oldpath: "/a", Newpath: "/b"})
+
+	got := DumpPacket(frame[:3])
+	assert.True(t, strings.HasPrefix(got, "malformed packet"), got)
+
+	got = DumpPacket(frame[:len(frame)-1])
+	assert.True(t, strings.HasPrefix(got, "malformed packet"), got)
+
+	// fix up the length field so that the packet is truncated but consistent.
+	short := append([]byte(nil), frame[:len(frame)-1]...)
+	short[3]--
+	got = DumpPacket(short)
+	assert.Contains(t, got, `oldpath: "/a"`)
+	assert.Contains(t, got, "error: packet too short")
+}
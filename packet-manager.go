@@ -20,6 +20,29 @@ type packetManager struct {
 	packetCount uint32
 	// it is not nil if the allocator is enabled
 	alloc *allocator
+
+	// reads and writes queued for a worker, but not yet started,
+	// mapped to whether they have been cancelled.
+	queuedMu sync.Mutex
+	queued   map[uint32]bool
+
+	// it is not nil if strict conformance checking is enabled
+	conformance func(*ConformanceError)
+
+	// it is not nil if a session end hook is set
+	stats *sessionStats
+
+	// the order in which responses may be sent
+	ordering ResponseOrdering
+
+	// the sizes of the pools of workers, and of their queues
+	pools WorkerPools
+
+	// it is not nil if a logger is set
+	log *serverRequestLog
+
+	// whether status codes of later versions of the protocol are sent
+	extendedCodes bool
 }
 
 type packetSender interface {
@@ -35,6 +58,7 @@ func newPktMgr(sender packetSender) *packetManager {
 		outgoing:  make([]orderedPacket, 0, SftpServerWorkerCount),
 		sender:    sender,
 		working:   &sync.WaitGroup{},
+		queued:    make(map[uint32]bool),
 	}
 	go s.controller()
 	return s
@@ -92,6 +116,9 @@ func (o orderedPackets) Sort() {
 // // packet registry
 // register incoming packets to be handled
 func (s *packetManager) incomingPacket(pkt orderedRequest) {
+	if s.log != nil {
+		s.log.request(pkt.requestPacket)
+	}
 	s.working.Add(1)
 	s.requests <- pkt
 }
@@ -102,6 +129,20 @@ func (s *packetManager) readyPacket(pkt orderedResponse) {
 	s.working.Done()
 }
 
+// readyResponse passes the response resp to the request req on for sending.
+func (s *packetManager) readyResponse(req requestPacket, resp responsePacket, orderID uint32) {
+	if status, ok := resp.(*sshFxpStatusPacket); ok && s.extendedCodes && status.extended != 0 {
+		status.Code = status.extended
+	}
+	if s.stats != nil {
+		s.stats.record(req, resp)
+	}
+	if s.log != nil {
+		s.log.response(req.id(), resp)
+	}
+	s.readyPacket(s.newOrderedResponse(resp, orderID))
+}
+
 // shut down packetManager controller
 func (s *packetManager) close() {
 	// pause until current packets are processed
@@ -109,40 +150,91 @@ func (s *packetManager) close() {
 	close(s.fini)
 }
 
+// queue records that the read or write with the given id is waiting for a worker.
+func (s *packetManager) queue(id uint32) {
+	s.queuedMu.Lock()
+	defer s.queuedMu.Unlock()
+
+	s.queued[id] = false
+}
+
+// cancel marks the queued read or write with the given id as cancelled.
+// Requests that have already been started, or that are unknown, are not affected.
+func (s *packetManager) cancel(id uint32) {
+	s.queuedMu.Lock()
+	defer s.queuedMu.Unlock()
+
+	if _, ok := s.queued[id]; ok {
+		s.queued[id] = true
+	}
+}
+
+// start is called by a worker before it handles a request,
+// and reports whether the request has been cancelled, and should not be performed.
+func (s *packetManager) start(pkt requestPacket) (cancelled bool) {
+	switch pkt.(type) {
+	case *sshFxpReadPacket, *sshFxpWritePacket:
+	default:
+		return false
+	}
+
+	s.queuedMu.Lock()
+	defer s.queuedMu.Unlock()
+
+	cancelled = s.queued[pkt.id()]
+	delete(s.queued, pkt.id())
+	return cancelled
+}
+
 // Passed a worker function, returns a channel for incoming packets.
 // Keep process packet responses in the order they are received while
 // maximizing throughput of file transfers.
 func (s *packetManager) workerChan(runWorker func(chan orderedRequest),
 ) chan orderedRequest {
+	pools := s.pools.withDefaults()
+
 	// multiple workers for faster read/writes
-	rwChan := make(chan orderedRequest, SftpServerWorkerCount)
-	for i := 0; i < SftpServerWorkerCount; i++ {
+	rwChan := make(chan orderedRequest, pools.DataQueue)
+	for i := 0; i < pools.DataWorkers; i++ {
 		runWorker(rwChan)
 	}
 
-	// single worker to enforce sequential processing of everything else
-	cmdChan := make(chan orderedRequest)
-	runWorker(cmdChan)
+	// by default, a single worker to enforce sequential processing of everything else,
+	// otherwise a channel for each worker, so that the requests on a handle stay in sequence.
+	cmdChans := make([]chan orderedRequest, pools.MetadataWorkers)
+	for i := range cmdChans {
+		cmdChans[i] = make(chan orderedRequest, pools.MetadataQueue)
+		runWorker(cmdChans[i])
+	}
 
 	pktChan := make(chan orderedRequest, SftpServerWorkerCount)
 	go func() {
 		for pkt := range pktChan {
-			switch pkt.requestPacket.(type) {
+			switch p := pkt.requestPacket.(type) {
 			case *sshFxpReadPacket, *sshFxpWritePacket:
+				s.queue(pkt.id())
 				s.incomingPacket(pkt)
 				rwChan <- pkt
 				continue
+			case *sshFxpExtendedPacket:
+				// record the cancellation immediately, rather than waiting for the sequential worker,
+				// otherwise the request would usually have been started by the time it is seen.
+				if cpkt, ok := p.SpecificPacket.(*sshFxpExtendedPacketCancel); ok {
+					s.cancel(cpkt.RequestID)
+				}
 			case *sshFxpClosePacket:
 				// wait for reads/writes to finish when file is closed
 				// incomingPacket() call must occur after this
 				s.working.Wait()
 			}
 			s.incomingPacket(pkt)
-			// all non-RW use sequential cmdChan
-			cmdChan <- pkt
+			// all non-RW use the metadata workers
+			cmdChans[metadataWorker(pkt, len(cmdChans))] <- pkt
 		}
 		close(rwChan)
-		close(cmdChan)
+		for _, cmdChan := range cmdChans {
+			close(cmdChan)
+		}
 		s.close()
 	}()
 
@@ -170,6 +262,11 @@ func (s *packetManager) controller() {
 
 // send as many packets as are ready
 func (s *packetManager) maybeSendPackets() {
+	if s.ordering != ResponseOrderStrict {
+		s.maybeSendUnordered()
+		return
+	}
+
 	for {
 		if len(s.outgoing) == 0 || len(s.incoming) == 0 {
 			debug("break! -- outgoing: %v; incoming: %v",
@@ -181,12 +278,7 @@ func (s *packetManager) maybeSendPackets() {
 		// debug("incoming: %v", ids(s.incoming))
 		// debug("outgoing: %v", ids(s.outgoing))
 		if in.orderID() == out.orderID() {
-			debug("Sending packet: %v", out.id())
-			s.sender.sendPacket(out.(encoding.BinaryMarshaler))
-			if s.alloc != nil {
-				// mark for reuse the slices allocated for this request
-				s.alloc.ReleasePages(in.orderID())
-			}
+			s.send(in, out)
 			// pop off heads
 			copy(s.incoming, s.incoming[1:])            // shift left
 			s.incoming[len(s.incoming)-1] = nil         // clear last
@@ -200,6 +292,79 @@ func (s *packetManager) maybeSendPackets() {
 	}
 }
 
+// maybeSendUnordered sends every ready packet that the ordering allows to overtake the earlier requests.
+func (s *packetManager) maybeSendUnordered() {
+	for i := 0; i < len(s.outgoing); {
+		out := s.outgoing[i]
+
+		j := 0
+		for j < len(s.incoming) && s.incoming[j].orderID() != out.orderID() {
+			j++
+		}
+		if j == len(s.incoming) || !s.mayOvertake(j) {
+			// the request is not yet registered, or it must wait for an earlier one.
+			i++
+			continue
+		}
+
+		s.send(s.incoming[j], out)
+		s.incoming = append(s.incoming[:j], s.incoming[j+1:]...)
+		s.outgoing = append(s.outgoing[:i], s.outgoing[i+1:]...)
+	}
+}
+
+// mayOvertake reports whether the response to the request incoming[j] may be sent
+// before those of the earlier requests still waiting for theirs.
+func (s *packetManager) mayOvertake(j int) bool {
+	if s.ordering == ResponseOrderFree {
+		return true
+	}
+
+	handle, ok := requestHandle(s.incoming[j])
+	if !ok {
+		return true
+	}
+	for _, in := range s.incoming[:j] {
+		if h, ok := requestHandle(in); ok && h == handle {
+			return false
+		}
+	}
+	return true
+}
+
+// send sends the response out to the request in, unless it is not to be answered.
+func (s *packetManager) send(in, out orderedPacket) {
+	if resp, ok := out.(orderedResponse); ok && isNoResponse(resp.responsePacket) {
+		debug("Not sending response: %v", out.id())
+	} else {
+		debug("Sending packet: %v", out.id())
+		if s.conformance != nil {
+			s.checkConformance(in, out)
+		}
+		s.sender.sendPacket(out.(encoding.BinaryMarshaler))
+	}
+	if s.alloc != nil {
+		// mark for reuse the slices allocated for this request
+		s.alloc.ReleasePages(in.orderID())
+	}
+}
+
+// checkConformance reports the response out to the conformance hook, if it does not conform to SFTP v3.
+func (s *packetManager) checkConformance(in, out orderedPacket) {
+	req, ok := in.(orderedRequest)
+	if !ok {
+		return
+	}
+	resp, ok := out.(orderedResponse)
+	if !ok {
+		return
+	}
+
+	if err := checkConformance(req.requestPacket, resp.responsePacket); err != nil {
+		s.conformance(err)
+	}
+}
+
 // func oids(o []orderedPacket) []uint32 {
 // 	res := make([]uint32, 0, len(o))
 // 	for _, v := range o {
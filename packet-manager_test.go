@@ -113,6 +113,70 @@ func TestPacketManager(t *testing.T) {
 	s.close()
 }
 
+func TestPacketManagerOrdering(t *testing.T) {
+	requests := []requestPacket{
+		&sshFxpReadPacket{ID: 1, Handle: "a"},
+		&sshFxpReadPacket{ID: 2, Handle: "b"},
+		&sshFxpWritePacket{ID: 3, Handle: "a"},
+		&sshFxpStatPacket{ID: 4, Path: "/foo"},
+	}
+
+	for _, tt := range []struct {
+		ordering ResponseOrdering
+		want     []uint32
+	}{
+		{ResponseOrderStrict, []uint32{1, 2, 3, 4}},
+		{ResponseOrderPerHandle, []uint32{4, 2, 1, 3}},
+		{ResponseOrderFree, []uint32{4, 3, 2, 1}},
+	} {
+		sender := &_testSender{make(chan encoding.BinaryMarshaler, len(requests))}
+		s := &packetManager{sender: sender, ordering: tt.ordering}
+
+		for i, req := range requests {
+			s.incoming = append(s.incoming, orderedRequest{req, uint32(i + 1)})
+		}
+
+		// the responses are ready in the reverse order of the requests.
+		for i := len(requests) - 1; i >= 0; i-- {
+			resp := statusFromError(requests[i].id(), nil)
+			s.outgoing = append(s.outgoing, orderedResponse{resp, uint32(i + 1)})
+			s.outgoing.Sort()
+			s.maybeSendPackets()
+		}
+
+		var got []uint32
+		for len(sender.sent) > 0 {
+			got = append(got, (<-sender.sent).(orderedResponse).id())
+		}
+		assert.Equal(t, tt.want, got, "ordering %d", tt.ordering)
+		assert.Empty(t, s.incoming)
+		assert.Empty(t, s.outgoing)
+	}
+}
+
+func TestPacketManagerCancel(t *testing.T) {
+	s := newPktMgr(newTestSender())
+	defer s.close()
+
+	s.queue(1)
+	s.queue(2)
+
+	s.cancel(2)
+	s.cancel(3) // unknown requests are ignored
+
+	assert.False(t, s.start(&sshFxpReadPacket{ID: 1}))
+	assert.True(t, s.start(&sshFxpWritePacket{ID: 2}))
+
+	// once started, a request can no longer be cancelled.
+	s.cancel(1)
+	assert.False(t, s.start(&sshFxpReadPacket{ID: 1}))
+
+	// only reads and writes are cancellable.
+	assert.False(t, s.start(&sshFxpStatPacket{ID: 3}))
+
+	assert.Empty(t, s.queued)
+}
+
 func (p sshFxpRemovePacket) String() string {
 	return fmt.Sprintf("RmPkt:%d", p.ID)
 }
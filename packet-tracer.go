@@ -0,0 +1,97 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// A PacketTrace describes an SFTP packet, as it was sent or received, for a PacketTracer.
+type PacketTrace struct {
+	Time      time.Time
+	Direction CaptureDirection
+
+	// Type is the packet type, such as SSH_FXP_OPEN, and RequestID is its request id,
+	// which is zero for the SSH_FXP_INIT and SSH_FXP_VERSION, which have none.
+	Type      uint8
+	RequestID uint32
+
+	// Frame is the packet as it was on the wire, including the leading uint32(length).
+	// It is only valid for the duration of the call to the PacketTracer, and must be copied to be kept.
+	Frame []byte
+
+	// Packet is the packet, as it was before it was marshalled, for a packet sent,
+	// and nil for a packet received, whose Frame can be decoded with DumpPacket.
+	Packet interface{}
+}
+
+// String renders the trace as a timestamped DumpPacket, as CaptureRecord does.
+func (t *PacketTrace) String() string {
+	return fmt.Sprintf("%s %s %s", t.Time.UTC().Format(time.RFC3339Nano), t.Direction, DumpPacket(t.Frame))
+}
+
+// A PacketTracer is called with every SFTP packet sent and received by a Client or server,
+// such as to record wire traces to replay in tests, or to debug the quirks of a server.
+// It is called concurrently, from the goroutines sending and receiving, and so should return quickly.
+//
+// Unlike a CaptureWriter, which writes a stream in a fixed format, a PacketTracer may do anything with the packets.
+type PacketTracer interface {
+	TracePacket(t *PacketTrace)
+}
+
+// The PacketTracerFunc type is an adapter to allow the use of ordinary functions as a PacketTracer.
+type PacketTracerFunc func(t *PacketTrace)
+
+// TracePacket calls f(t).
+func (f PacketTracerFunc) TracePacket(t *PacketTrace) {
+	f(t)
+}
+
+// WithPacketTracer calls the PacketTracer with every SFTP packet sent and received by the Client.
+func WithPacketTracer(tracer PacketTracer) ClientOption {
+	return func(c *Client) error {
+		c.tracer = tracer
+		return nil
+	}
+}
+
+// WithServerPacketTracer calls the PacketTracer with every SFTP packet sent and received by the Server.
+func WithServerPacketTracer(tracer PacketTracer) ServerOption {
+	return func(s *Server) error {
+		s.conn.tracer = tracer
+		return nil
+	}
+}
+
+// WithRSPacketTracer calls the PacketTracer with every SFTP packet sent and received by the RequestServer.
+func WithRSPacketTracer(tracer PacketTracer) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.conn.tracer = tracer
+	}
+}
+
+// trace passes the frame to the tracer, with the packet p it was marshalled from, if it was sent.
+func (c *conn) trace(dir CaptureDirection, frame []byte, p interface{}) {
+	t := &PacketTrace{
+		Time:      time.Now(),
+		Direction: dir,
+		Frame:     frame,
+		Packet:    p,
+	}
+	if len(frame) > 4 {
+		t.Type = frame[4]
+	}
+	if len(frame) >= 9 && t.Type != sshFxpInit && t.Type != sshFxpVersion {
+		t.RequestID = binary.BigEndian.Uint32(frame[5:])
+	}
+	c.tracer.TracePacket(t)
+}
+
+// traceReceived passes the packet received, of the type typ and the data, to the tracer, as a frame.
+func (c *conn) traceReceived(typ uint8, data []byte) {
+	frame := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(1+len(data)))
+	frame[4] = typ
+	copy(frame[5:], data)
+	c.trace(CaptureReceived, frame, nil)
+}
@@ -0,0 +1,77 @@
+package sftp
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPacketTracer struct {
+	mu     sync.Mutex
+	traces []PacketTrace
+}
+
+func (tr *testPacketTracer) TracePacket(t *PacketTrace) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	t2 := *t
+	t2.Frame = append([]byte(nil), t.Frame...)
+	tr.traces = append(tr.traces, t2)
+}
+
+func TestPacketTracer(t *testing.T) {
+	var clientTraces, serverTraces testPacketTracer
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	rs := NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, InMemHandler(), WithRSPacketTracer(&serverTraces))
+	go func() {
+		rs.Serve()
+		rs.Close()
+	}()
+
+	client, err := NewClientPipe(cr, cw, WithPacketTracer(&clientTraces))
+	require.NoError(t, err)
+
+	_, err = client.Stat("/missing")
+	require.Error(t, err)
+	require.NoError(t, client.Close())
+
+	clientTraces.mu.Lock()
+	defer clientTraces.mu.Unlock()
+	traces := clientTraces.traces
+	require.Len(t, traces, 4)
+
+	assert.Equal(t, CaptureSent, traces[0].Direction)
+	assert.Equal(t, uint8(sshFxpInit), traces[0].Type)
+	assert.Equal(t, uint32(0), traces[0].RequestID)
+	assert.Equal(t, CaptureReceived, traces[1].Direction)
+	assert.Equal(t, uint8(sshFxpVersion), traces[1].Type)
+	assert.Nil(t, traces[1].Packet)
+
+	stat, ok := traces[2].Packet.(*sshFxpStatPacket)
+	require.True(t, ok, "%T", traces[2].Packet)
+	assert.Equal(t, "/missing", stat.Path)
+	assert.Equal(t, stat.ID, traces[2].RequestID)
+	assert.Contains(t, traces[2].String(), "sent SSH_FXP_STAT")
+
+	assert.Equal(t, CaptureReceived, traces[3].Direction)
+	assert.Equal(t, uint8(sshFxpStatus), traces[3].Type)
+	assert.Equal(t, stat.ID, traces[3].RequestID)
+
+	// the server sees the same frames, the other way around.
+	serverTraces.mu.Lock()
+	defer serverTraces.mu.Unlock()
+	require.Len(t, serverTraces.traces, 4)
+	for i, st := range serverTraces.traces {
+		assert.NotEqual(t, traces[i].Direction, st.Direction)
+		assert.Equal(t, traces[i].Frame, st.Frame)
+	}
+}
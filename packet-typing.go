@@ -50,6 +50,69 @@ func (p *sshFxpOpenPacket) getPath() string     { return p.Path }
 func (p *sshFxpExtendedPacketPosixRename) getPath() string { return p.Oldpath }
 func (p *sshFxpExtendedPacketHardlink) getPath() string    { return p.Oldpath }
 
+// packetPaths returns pointers to every path field in the packet pkt,
+// including the second path of two-path requests like rename, so they may be inspected or rewritten.
+// It covers both the client and server forms of the extended packets.
+func packetPaths(pkt interface{}) []*string {
+	switch pkt := pkt.(type) {
+	case *sshFxpRenamePacket:
+		return []*string{&pkt.Oldpath, &pkt.Newpath}
+	case *sshFxpSymlinkPacket:
+		return []*string{&pkt.Targetpath, &pkt.Linkpath}
+	case *sshFxpPosixRenamePacket:
+		return []*string{&pkt.Oldpath, &pkt.Newpath}
+	case *sshFxpExtendedPacketPosixRename:
+		return []*string{&pkt.Oldpath, &pkt.Newpath}
+	case *sshFxpHardlinkPacket:
+		return []*string{&pkt.Oldpath, &pkt.Newpath}
+	case *sshFxpExtendedPacketHardlink:
+		return []*string{&pkt.Oldpath, &pkt.Newpath}
+	case *sshFxpStatvfsPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpExtendedPacketStatVFS:
+		return []*string{&pkt.Path}
+	case *sshFxpCopyFilePacket:
+		return []*string{&pkt.Source, &pkt.Destination}
+	case *sshFxpExtendedPacketCopyFile:
+		return []*string{&pkt.Source, &pkt.Destination}
+	case *sshFxpExtendedPacketExpandPath:
+		return []*string{&pkt.Path}
+	case *sshFxpExtendedPacketGeneration:
+		return []*string{&pkt.Path}
+	case *sshFxpCheckFilePacket:
+		if pkt.Extension == "check-file-name" {
+			return []*string{&pkt.Target}
+		}
+	case *sshFxpExtendedPacketCheckFile:
+		if pkt.ExtendedRequest == "check-file-name" {
+			return []*string{&pkt.Target}
+		}
+
+	case *sshFxpLstatPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpStatPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpRmdirPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpReadlinkPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpRealpathPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpMkdirPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpSetstatPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpRemovePacket:
+		return []*string{&pkt.Filename}
+	case *sshFxpOpendirPacket:
+		return []*string{&pkt.Path}
+	case *sshFxpOpenPacket:
+		return []*string{&pkt.Path}
+	}
+
+	return nil
+}
+
 // getHandle
 func (p *sshFxpFstatPacket) getHandle() string    { return p.Handle }
 func (p *sshFxpFsetstatPacket) getHandle() string { return p.Handle }
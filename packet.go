@@ -15,6 +15,12 @@ var (
 	errLongPacket            = errors.New("packet too long")
 	errShortPacket           = errors.New("packet too short")
 	errUnknownExtendedPacket = errors.New("unknown extended packet")
+
+	// returned when a client uses a directory handle as a file handle, or vice versa.
+	errHandleIsDir  = errors.New("is a directory")
+	errHandleNotDir = errors.New("not a directory")
+
+	errRequestCancelled = errors.New("request cancelled")
 )
 
 const (
@@ -76,6 +82,11 @@ func marshalFileStat(b []byte, flags uint32, fileStat *FileStat) []byte {
 		b = marshalUint32(b, fileStat.Mtime)
 	}
 
+	if flags&^sshFileXferAttrAll != 0 && fileStat.unknown != nil {
+		// the attributes unknown to version 3 of the protocol, and the extended attributes, as they were received.
+		return append(b, fileStat.unknown...)
+	}
+
 	if flags&sshFileXferAttrExtended != 0 {
 		b = marshalUint32(b, uint32(len(fileStat.Extended)))
 
@@ -182,6 +193,50 @@ func unmarshalAttrs(b []byte) (*FileStat, []byte, error) {
 	return unmarshalFileStat(flags, b)
 }
 
+// unmarshalReceivedAttrs unmarshals the attributes of a response to the Client, recording their flags in the FileStat.
+// If the attributes are the last field of the response, any attributes unknown to version 3 of the protocol are kept,
+// see unmarshalLastFileStat. Otherwise, as the length of those attributes is unknown, their flags are ignored.
+func unmarshalReceivedAttrs(b []byte, last bool) (*FileStat, []byte, error) {
+	flags, b, err := unmarshalUint32Safe(b)
+	if err != nil {
+		return nil, b, err
+	}
+
+	if last {
+		fs, err := unmarshalLastFileStat(flags, b)
+		return fs, nil, err
+	}
+
+	fs, b, err := unmarshalFileStat(flags, b)
+	if err != nil {
+		return nil, b, err
+	}
+	fs.flags, fs.hasFlags = flags&sshFileXferAttrAll, true
+	return fs, b, nil
+}
+
+// unmarshalLastFileStat unmarshals attributes which are the last field of a packet, recording their flags in the FileStat.
+// The bytes of any attributes unknown to version 3 of the protocol, and of the extended attributes after them,
+// are kept as they are, to be sent on unchanged, rather than being misread as the extended attributes.
+func unmarshalLastFileStat(flags uint32, b []byte) (*FileStat, error) {
+	if flags&^sshFileXferAttrAll == 0 {
+		fs, _, err := unmarshalFileStat(flags, b)
+		if err != nil {
+			return nil, err
+		}
+		fs.flags, fs.hasFlags = flags, true
+		return fs, nil
+	}
+
+	fs, b, err := unmarshalFileStat(flags&^sshFileXferAttrExtended, b)
+	if err != nil {
+		return nil, err
+	}
+	fs.flags, fs.hasFlags = flags, true
+	fs.unknown = append(make([]byte, 0, len(b)), b...)
+	return fs, nil
+}
+
 func unmarshalFileStat(flags uint32, b []byte) (*FileStat, []byte, error) {
 	var fs FileStat
 	var err error
@@ -636,6 +691,70 @@ func (p *sshFxpHardlinkPacket) MarshalBinary() ([]byte, error) {
 	return b, nil
 }
 
+type sshFxpPingPacket struct {
+	ID uint32
+}
+
+func (p *sshFxpPingPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpPingPacket) MarshalBinary() ([]byte, error) {
+	const ext = "ping@pkg.sftp"
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+
+	return b, nil
+}
+
+type sshFxpCancelPacket struct {
+	ID        uint32
+	RequestID uint32
+}
+
+func (p *sshFxpCancelPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpCancelPacket) MarshalBinary() ([]byte, error) {
+	const ext = "cancel@pkg.sftp"
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext) +
+		4 // uint32(request-id)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+	b = marshalUint32(b, p.RequestID)
+
+	return b, nil
+}
+
+// sshFxpExtendedRawPacket is an extended request for any extension, with opaque request-specific data.
+type sshFxpExtendedRawPacket struct {
+	ID              uint32
+	ExtendedRequest string
+	Data            []byte
+}
+
+func (p *sshFxpExtendedRawPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpExtendedRawPacket) MarshalBinary() ([]byte, error) {
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(p.ExtendedRequest) +
+		len(p.Data)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, p.ExtendedRequest)
+	b = append(b, p.Data...)
+
+	return b, nil
+}
+
 type sshFxpReadlinkPacket struct {
 	ID   uint32
 	Path string
@@ -670,9 +789,15 @@ type sshFxpNameAttr struct {
 	Name     string
 	LongName string
 	Attrs    []interface{}
+
+	raw []byte // if set, the entry already marshaled
 }
 
 func (p *sshFxpNameAttr) MarshalBinary() ([]byte, error) {
+	if p.raw != nil {
+		return p.raw, nil
+	}
+
 	var b []byte
 	b = marshalString(b, p.Name)
 	b = marshalString(b, p.LongName)
@@ -774,8 +899,7 @@ func (p *sshFxpOpenPacket) unmarshalFileStat(flags uint32) (*FileStat, error) {
 	case *FileStat:
 		return attrs, nil
 	case []byte:
-		fs, _, err := unmarshalFileStat(flags, attrs)
-		return fs, err
+		return unmarshalLastFileStat(flags, attrs)
 	default:
 		return nil, fmt.Errorf("invalid type in unmarshalFileStat: %T", attrs)
 	}
@@ -1074,8 +1198,7 @@ func (p *sshFxpSetstatPacket) unmarshalFileStat(flags uint32) (*FileStat, error)
 	case *FileStat:
 		return attrs, nil
 	case []byte:
-		fs, _, err := unmarshalFileStat(flags, attrs)
-		return fs, err
+		return unmarshalLastFileStat(flags, attrs)
 	default:
 		return nil, fmt.Errorf("invalid type in unmarshalFileStat: %T", attrs)
 	}
@@ -1099,8 +1222,7 @@ func (p *sshFxpFsetstatPacket) unmarshalFileStat(flags uint32) (*FileStat, error
 	case *FileStat:
 		return attrs, nil
 	case []byte:
-		fs, _, err := unmarshalFileStat(flags, attrs)
-		return fs, err
+		return unmarshalLastFileStat(flags, attrs)
 	default:
 		return nil, fmt.Errorf("invalid type in unmarshalFileStat: %T", attrs)
 	}
@@ -1126,6 +1248,10 @@ func (p *sshFxpHandlePacket) MarshalBinary() ([]byte, error) {
 type sshFxpStatusPacket struct {
 	ID uint32
 	StatusError
+
+	// the code of a later version of the protocol translated from a syscall error, if any.
+	// It is sent in place of Code only if extended status codes are enabled.
+	extended uint32
 }
 
 func (p *sshFxpStatusPacket) MarshalBinary() ([]byte, error) {
@@ -1316,6 +1442,26 @@ func (p *sshFxpExtendedPacket) UnmarshalBinary(b []byte) error {
 		p.SpecificPacket = &sshFxpExtendedPacketPosixRename{}
 	case "hardlink@openssh.com":
 		p.SpecificPacket = &sshFxpExtendedPacketHardlink{}
+	case "limits@openssh.com":
+		p.SpecificPacket = &sshFxpExtendedPacketLimits{}
+	case "expand-path@openssh.com":
+		p.SpecificPacket = &sshFxpExtendedPacketExpandPath{}
+	case "copy-data@openssh.com":
+		p.SpecificPacket = &sshFxpExtendedPacketCopyData{}
+	case "copy-file":
+		p.SpecificPacket = &sshFxpExtendedPacketCopyFile{}
+	case "check-file-name", "check-file-handle":
+		p.SpecificPacket = &sshFxpExtendedPacketCheckFile{}
+	case "ping@pkg.sftp":
+		p.SpecificPacket = &sshFxpExtendedPacketPing{}
+	case "cancel@pkg.sftp":
+		p.SpecificPacket = &sshFxpExtendedPacketCancel{}
+	case writeBatchExtension:
+		p.SpecificPacket = &sshFxpExtendedPacketWriteBatch{}
+	case generationExtension:
+		p.SpecificPacket = &sshFxpExtendedPacketGeneration{}
+	case versionSelectExtension:
+		p.SpecificPacket = &sshFxpExtendedPacketVersionSelect{}
 	default:
 		return fmt.Errorf("packet type %v: %w", p.SpecificPacket, errUnknownExtendedPacket)
 	}
@@ -1399,3 +1545,116 @@ func (p *sshFxpExtendedPacketHardlink) respond(s *Server) responsePacket {
 	err := os.Link(s.toLocalPath(p.Oldpath), s.toLocalPath(p.Newpath))
 	return statusFromError(p.ID, err)
 }
+
+// sshFxpExtendedPacketLimits asks the server for the limits it places on requests.
+type sshFxpExtendedPacketLimits struct {
+	ID              uint32
+	ExtendedRequest string
+}
+
+func (p *sshFxpExtendedPacketLimits) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketLimits) readonly() bool { return true }
+func (p *sshFxpExtendedPacketLimits) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, _, err = unmarshalStringSafe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketLimits) respond(s *Server) responsePacket {
+	return newLimitsResponse(p.ID, s.maxTxPacket)
+}
+
+// sshFxpLimitsResponse is the SSH_FXP_EXTENDED_REPLY to limits@openssh.com.
+// A limit of zero means there is no limit.
+type sshFxpLimitsResponse struct {
+	ID              uint32
+	MaxPacketLength uint64 // of any packet the server receives
+	MaxReadLength   uint64 // of the data of a READ
+	MaxWriteLength  uint64 // of the data of a WRITE
+	MaxOpenHandles  uint64
+}
+
+// newLimitsResponse returns the limits of a server which sends up to maxTxPacket bytes of data in response to a READ.
+// Packets of up to maxMsgLength bytes are received, and so a WRITE may carry that much data,
+// less room for the rest of the packet, as with OpenSSH.
+// The number of open handles is not limited.
+func newLimitsResponse(id uint32, maxTxPacket uint32) *sshFxpLimitsResponse {
+	return &sshFxpLimitsResponse{
+		ID:              id,
+		MaxPacketLength: maxMsgLength,
+		MaxReadLength:   uint64(maxTxPacket),
+		MaxWriteLength:  maxMsgLength - 1024,
+	}
+}
+
+func (p *sshFxpLimitsResponse) id() uint32 { return p.ID }
+
+func (p *sshFxpLimitsResponse) MarshalBinary() ([]byte, error) {
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4*8
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtendedReply)
+	b = marshalUint32(b, p.ID)
+	b = marshalUint64(b, p.MaxPacketLength)
+	b = marshalUint64(b, p.MaxReadLength)
+	b = marshalUint64(b, p.MaxWriteLength)
+	b = marshalUint64(b, p.MaxOpenHandles)
+
+	return b, nil
+}
+
+// sshFxpExtendedPacketPing is a no-op request, that is answered immediately with SSH_FX_OK.
+// It allows clients to measure the round-trip time of the SFTP layer.
+type sshFxpExtendedPacketPing struct {
+	ID              uint32
+	ExtendedRequest string
+}
+
+func (p *sshFxpExtendedPacketPing) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketPing) readonly() bool { return true }
+func (p *sshFxpExtendedPacketPing) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, _, err = unmarshalStringSafe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketPing) respond(s *Server) responsePacket {
+	return statusFromError(p.ID, nil)
+}
+
+// sshFxpExtendedPacketCancel requests that the server abandon the outstanding request RequestID.
+// A read or write that has not yet been started is answered with SSH_FX_FAILURE, without being performed.
+// The cancel request itself is always answered with SSH_FX_OK.
+type sshFxpExtendedPacketCancel struct {
+	ID              uint32
+	ExtendedRequest string
+	RequestID       uint32
+}
+
+func (p *sshFxpExtendedPacketCancel) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketCancel) readonly() bool { return true }
+func (p *sshFxpExtendedPacketCancel) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.RequestID, _, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketCancel) respond(s *Server) responsePacket {
+	// The cancellation itself is recorded by the packetManager, as soon as the request is received.
+	return statusFromError(p.ID, nil)
+}
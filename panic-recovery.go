@@ -0,0 +1,80 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime"
+)
+
+// errPanicRecovered answers a request whose handling panicked.
+var errPanicRecovered = errors.New("internal server error")
+
+// PanicPolicy configures the recovery of panics raised by the Handlers of a RequestServer, see WithRSPanicRecovery.
+type PanicPolicy struct {
+	// Logf, if not nil, is called to report each panic recovered, with the request, the value of the panic, and its stack.
+	// By default, the panic is reported with log.Printf.
+	Logf func(format string, args ...interface{})
+
+	// MaxPanics is the number of panics recovered in a session, after which a further panic is not recovered,
+	// and so crashes the process, as it would without recovery, for a backend that is broken, rather than failing one call.
+	// Zero means no limit.
+	MaxPanics int
+}
+
+// WithRSPanicRecovery recovers from panics raised by the Handlers, or the RequestServer itself, while handling a request.
+// The request is answered with SSH_FX_FAILURE, and the panic is reported through the PanicPolicy,
+// so that one faulty call fails that request alone, rather than the whole connection, or the process serving it.
+//
+// A panic may leave the state of the Handlers inconsistent, such as a file handle that was opened but not returned.
+// The Handlers should release what they hold in a deferred function, to be safe from this.
+func WithRSPanicRecovery(policy PanicPolicy) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.panicPolicy = &policy
+	}
+}
+
+// handlePacketRecover handles the request p, recovering from a panic, if the PanicPolicy allows it.
+func (rs *RequestServer) handlePacketRecover(ctx context.Context, p requestPacket, orderID uint32) (rpkt responsePacket) {
+	if rs.panicPolicy == nil {
+		return rs.handlePacket(ctx, p, orderID)
+	}
+
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		rs.mu.Lock()
+		rs.panics++
+		crash := rs.panicPolicy.MaxPanics > 0 && rs.panics > rs.panicPolicy.MaxPanics
+		rs.mu.Unlock()
+
+		if crash {
+			panic(v)
+		}
+
+		logf := rs.panicPolicy.Logf
+		if logf == nil {
+			logf = log.Printf
+		}
+
+		if pp, ok := p.(hasPath); ok {
+			logf("sftp: recovered panic handling request %d for %q: %v\n%s", p.id(), pp.getPath(), v, panicStack())
+		} else {
+			logf("sftp: recovered panic handling request %d: %v\n%s", p.id(), v, panicStack())
+		}
+
+		rpkt = statusFromError(p.id(), errPanicRecovered)
+	}()
+
+	return rs.handlePacket(ctx, p, orderID)
+}
+
+// panicStack returns the stack of the goroutine that panicked, as runtime/debug.Stack does,
+// which cannot be imported in this package, as it declares a debug function.
+func panicStack() []byte {
+	buf := make([]byte, 64<<10)
+	return buf[:runtime.Stack(buf, false)]
+}
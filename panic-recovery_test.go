@@ -0,0 +1,81 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// panickingCmder panics on Mkdir.
+type panickingCmder struct {
+	FileCmder
+}
+
+func (c panickingCmder) Filecmd(r *Request) error {
+	if r.Method == "Mkdir" {
+		panic("mkdir is broken")
+	}
+	return c.FileCmder.Filecmd(r)
+}
+
+func TestRequestPanicRecovery(t *testing.T) {
+	var mu sync.Mutex
+	var logs []string
+
+	handlers := InMemHandler()
+	handlers.FileCmd = panickingCmder{handlers.FileCmd}
+	p := clientRequestServerPairWithHandlers(t, handlers, WithRSPanicRecovery(PanicPolicy{
+		Logf: func(format string, args ...interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}))
+	defer p.Close()
+
+	err := p.cli.Mkdir("/dir")
+	assert.ErrorIs(t, err, ErrSSHFxFailure)
+
+	// the session goes on.
+	_, err = putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+	_, err = p.cli.Stat("/foo")
+	require.NoError(t, err)
+	_, err = p.cli.Stat("/dir")
+	assert.True(t, os.IsNotExist(err))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, logs, 1)
+	assert.Contains(t, logs[0], `"/dir"`)
+	assert.Contains(t, logs[0], "mkdir is broken")
+	assert.Contains(t, logs[0], "panickingCmder")
+}
+
+func TestRequestPanicRecoveryMaxPanics(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	rs := NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{r, w}, Handlers{FileCmd: panickingCmder{}}, WithRSPanicRecovery(PanicPolicy{
+		Logf:      func(format string, args ...interface{}) {},
+		MaxPanics: 1,
+	}))
+
+	pkt := &sshFxpMkdirPacket{ID: 1, Path: "/dir"}
+
+	rpkt := rs.handlePacketRecover(context.Background(), pkt, 0)
+	assert.Equal(t, statusFromError(1, errPanicRecovered), rpkt)
+
+	assert.PanicsWithValue(t, "mkdir is broken", func() {
+		rs.handlePacketRecover(context.Background(), pkt, 0)
+	})
+}
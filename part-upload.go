@@ -0,0 +1,214 @@
+package sftp
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The suffixes commonly appended to the name of a file while it is uploaded,
+// so that a partial upload is not mistaken for the complete file.
+const (
+	// PartSuffix is the suffix used by many command line tools, and by default by UploadWithPart.
+	PartSuffix = ".part"
+
+	// FilepartSuffix is the suffix used by WinSCP.
+	FilepartSuffix = ".filepart"
+)
+
+// PartUploadOptions configures UploadWithPart.
+type PartUploadOptions struct {
+	// Suffix is appended to the remote name to form the name of the temporary file, by default PartSuffix.
+	Suffix string
+
+	// Resume continues an existing temporary file, from a previous upload that was interrupted,
+	// rather than starting over.
+	// The data already in the temporary file is assumed to match the start of the source, and is not checked.
+	// A temporary file larger than the source, where the size of the source can be known, is started over.
+	Resume bool
+}
+
+// PartPath returns the name of the temporary file for the remote file remotePath, with the given suffix,
+// which is PartSuffix if empty.
+func PartPath(remotePath, suffix string) string {
+	if suffix == "" {
+		suffix = PartSuffix
+	}
+	return remotePath + suffix
+}
+
+// UploadWithPart uploads the content of src to remotePath, by first writing it to a temporary file,
+// named with a suffix such as ".part", or ".filepart" as with WinSCP, which is renamed to remotePath once it is complete.
+// A nil opts is the same as the zero PartUploadOptions.
+//
+// Where the server supports posix-rename@openssh.com, the rename replaces any existing remotePath in one step.
+// Otherwise, an existing remotePath is removed first.
+//
+// If the upload fails, the temporary file is left in place, to be resumed with PartUploadOptions.Resume.
+// When resuming, the part of src already uploaded is skipped, by seeking if src is an io.Seeker,
+// or by reading and discarding it otherwise.
+//
+// It returns the number of bytes written to the temporary file, which does not include those of a resumed upload.
+// The context is checked before the upload, and before the rename.
+func (c *Client) UploadWithPart(ctx context.Context, src io.Reader, remotePath string, opts *PartUploadOptions) (int64, error) {
+	if opts == nil {
+		opts = new(PartUploadOptions)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	part := PartPath(remotePath, opts.Suffix)
+
+	var offset int64
+	if opts.Resume {
+		var err error
+		if offset, err = c.resumePart(part, src); err != nil {
+			return 0, err
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := c.OpenFile(part, flags)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	n, err := f.ReadFrom(src)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return n, err
+	}
+
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+		return n, c.PosixRename(part, remotePath)
+	}
+
+	if err := c.Remove(remotePath); err != nil && !os.IsNotExist(err) {
+		return n, err
+	}
+	return n, c.Rename(part, remotePath)
+}
+
+// resumePart returns the offset at which to continue the upload of src to the existing temporary file part,
+// having skipped that much of src, or zero if there is nothing to resume.
+func (c *Client) resumePart(part string, src io.Reader) (int64, error) {
+	fi, err := c.Stat(part)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	offset := fi.Size()
+	if offset == 0 {
+		return 0, nil
+	}
+
+	if s, ok := src.(io.Seeker); ok {
+		size, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if size < offset {
+			offset = 0 // the source has shrunk, start over
+		}
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return offset, nil
+	}
+
+	// the source cannot be read again, so if it turns out shorter than the part, the upload must fail.
+	if _, err := io.CopyN(ioutil.Discard, src, offset); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return offset, nil
+}
+
+// CleanupTemp removes the temporary files left in the remote directory dir, and those below it, by uploads that did not complete,
+// which are the regular files named with PartSuffix or FilepartSuffix, last modified more than olderThan ago.
+// Newer files are kept, as they may belong to uploads still in progress, or to be resumed.
+// The modification times are those of the server, and are compared with the clock of the client.
+//
+// Symbolic links are not followed.
+// It returns the paths of the files removed, in the order they were removed, which is that of their names.
+// A file removed concurrently by another client is skipped.
+// It stops at the first other error, returning the files removed before it.
+// The context is checked before each directory is read.
+func (c *Client) CleanupTemp(ctx context.Context, dir string, olderThan time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	var removed []string
+	err := c.cleanupTemp(ctx, dir, cutoff, &removed)
+	return removed, err
+}
+
+func (c *Client) cleanupTemp(ctx context.Context, dir string, cutoff time.Time, removed *[]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	infos, err := c.ReadDirContext(ctx, dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	for _, fi := range infos {
+		name := path.Join(dir, fi.Name())
+
+		switch {
+		case fi.IsDir():
+			if err := c.cleanupTemp(ctx, name, cutoff, removed); err != nil {
+				return err
+			}
+
+		case fi.Mode().IsRegular() && isTempName(fi.Name()) && fi.ModTime().Before(cutoff):
+			if err := c.Remove(name); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			*removed = append(*removed, name)
+		}
+	}
+	return nil
+}
+
+// isTempName reports whether name is that of a temporary file of an upload, as named by PartPath.
+func isTempName(name string) bool {
+	for _, suffix := range []string{PartSuffix, FilepartSuffix} {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientUploadWithPart(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+	content := strings.Repeat("0123456789", 1000)
+
+	require.NoError(t, ioutil.WriteFile(name, []byte("old"), 0o644))
+
+	n, err := client.UploadWithPart(ctx, strings.NewReader(content), name, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+
+	got, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(got))
+	_, err = os.Stat(name + PartSuffix)
+	assert.True(t, os.IsNotExist(err), "the part is renamed")
+
+	for _, seekable := range []bool{true, false} {
+		// an interrupted upload, with a third of the file in place.
+		part := name + FilepartSuffix
+		require.NoError(t, ioutil.WriteFile(part, []byte(content[:3000]), 0o644))
+
+		var src = bytes.NewReader([]byte(content))
+		opts := &PartUploadOptions{Suffix: FilepartSuffix, Resume: true}
+		if seekable {
+			n, err = client.UploadWithPart(ctx, src, name, opts)
+		} else {
+			n, err = client.UploadWithPart(ctx, struct{ io.Reader }{src}, name, opts)
+		}
+		require.NoError(t, err)
+		assert.EqualValues(t, len(content)-3000, n)
+
+		got, err = ioutil.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(got))
+	}
+
+	// a part larger than a seekable source is started over.
+	part := name + PartSuffix
+	require.NoError(t, ioutil.WriteFile(part, make([]byte, 20000), 0o644))
+	n, err = client.UploadWithPart(ctx, strings.NewReader("short"), name, &PartUploadOptions{Resume: true})
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, n)
+
+	got, err = ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(got))
+}
+
+func TestClientCleanupTemp(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+
+	files := map[string]bool{ // name: stale
+		"a.part":         true,
+		"b.filepart":     true,
+		"c.part":         false, // recent
+		"d.txt":          false,
+		".part":          false, // only a suffix
+		"sub/e.part":     true,
+		"sub/f.filepart": false, // recent
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "g.part"), 0o755)) // not a regular file
+
+	for name, stale := range files {
+		local := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(local, nil, 0o644))
+		if stale || name == "d.txt" || name == ".part" {
+			require.NoError(t, os.Chtimes(local, old, old))
+		}
+	}
+
+	removed, err := client.CleanupTemp(ctx, dir, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		path.Join(dir, "a.part"),
+		path.Join(dir, "b.filepart"),
+		path.Join(dir, "sub/e.part"),
+	}, removed)
+
+	for name, stale := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.Equal(t, stale, os.IsNotExist(err), name)
+	}
+	_, err = os.Stat(filepath.Join(dir, "g.part"))
+	assert.NoError(t, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.CleanupTemp(cancelled, dir, 0)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,101 @@
+package sftp
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errPathTooLong       = errors.New("path too long")
+	errPathTooDeep       = errors.New("path has too many components")
+	errPathForbiddenByte = errors.New("path contains a forbidden byte")
+)
+
+// PathPolicy defines the validation applied to every path received from a client,
+// before the request is dispatched to the filesystem or to the Handlers.
+// This saves each backend from having to defend itself against hostile paths.
+//
+// Once a PathPolicy is in effect, paths containing a NUL byte are always rejected.
+// Rejected requests are answered with SSH_FX_FAILURE, and a message describing the violation.
+type PathPolicy struct {
+	// MaxLength is the maximum length of a path in bytes.
+	// Zero means no limit.
+	MaxLength int
+
+	// MaxDepth is the maximum number of components in a path,
+	// ignoring empty components, such as those from repeated or trailing slashes.
+	// Zero means no limit.
+	MaxDepth int
+
+	// ForbiddenBytes lists the bytes, in addition to NUL, which may not appear in a path.
+	ForbiddenBytes string
+
+	// Normalize, if not nil, is called with each path that passes validation,
+	// and the result is used in place of the original path.
+	// This may be used to apply Unicode normalization.
+	Normalize func(string) string
+}
+
+// WithPathPolicy validates every path received by the Server against the given PathPolicy.
+func WithPathPolicy(policy PathPolicy) ServerOption {
+	return func(s *Server) error {
+		s.pathPolicy = &policy
+		return nil
+	}
+}
+
+// WithRSPathPolicy validates every path received by the RequestServer against the given PathPolicy.
+func WithRSPathPolicy(policy PathPolicy) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pathPolicy = &policy
+	}
+}
+
+func (p *PathPolicy) check(path string) (string, error) {
+	if p.MaxLength > 0 && len(path) > p.MaxLength {
+		return "", errPathTooLong
+	}
+
+	if strings.IndexByte(path, 0) >= 0 || strings.ContainsAny(path, p.ForbiddenBytes) {
+		return "", errPathForbiddenByte
+	}
+
+	if p.MaxDepth > 0 {
+		var depth int
+		for _, elem := range strings.Split(path, "/") {
+			if elem != "" {
+				depth++
+			}
+		}
+
+		if depth > p.MaxDepth {
+			return "", errPathTooDeep
+		}
+	}
+
+	if p.Normalize != nil {
+		path = p.Normalize(path)
+	}
+
+	return path, nil
+}
+
+// apply checks every path in the request packet pkt, replacing them with their normalized forms.
+func (p *PathPolicy) apply(pkt requestPacket) error {
+	if epkt, ok := pkt.(*sshFxpExtendedPacket); ok {
+		if epkt.SpecificPacket == nil {
+			return nil
+		}
+		pkt = epkt.SpecificPacket
+	}
+
+	for _, path := range packetPaths(pkt) {
+		clean, err := p.check(*path)
+		if err != nil {
+			return err
+		}
+		*path = clean
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package sftp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPolicyCheck(t *testing.T) {
+	policy := &PathPolicy{
+		MaxLength:      16,
+		MaxDepth:       3,
+		ForbiddenBytes: "\\",
+		Normalize:      strings.ToLower,
+	}
+
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{path: "/Foo/Bar", want: "/foo/bar"},
+		{path: "/a//b/c/", want: "/a//b/c/"},
+		{path: "/a/b/c/d", err: errPathTooDeep},
+		{path: "/0123456789abcdef", err: errPathTooLong},
+		{path: "/foo\x00", err: errPathForbiddenByte},
+		{path: `C:\foo`, err: errPathForbiddenByte},
+	}
+
+	for _, tt := range tests {
+		got, err := policy.check(tt.path)
+		assert.Equal(t, tt.err, err, "%q", tt.path)
+		assert.Equal(t, tt.want, got, "%q", tt.path)
+	}
+
+	// NUL is rejected even by an otherwise empty policy.
+	_, err := new(PathPolicy).check("foo\x00bar")
+	assert.Equal(t, errPathForbiddenByte, err)
+}
+
+func TestPathPolicyApply(t *testing.T) {
+	policy := &PathPolicy{
+		MaxDepth:  2,
+		Normalize: strings.ToLower,
+	}
+
+	rename := &sshFxpRenamePacket{Oldpath: "/A", Newpath: "/B"}
+	require.NoError(t, policy.apply(rename))
+	assert.Equal(t, "/a", rename.Oldpath)
+	assert.Equal(t, "/b", rename.Newpath)
+
+	// the second path of a request must also be checked.
+	symlink := &sshFxpSymlinkPacket{Targetpath: "/a", Linkpath: "/a/b/c"}
+	assert.Equal(t, errPathTooDeep, policy.apply(symlink))
+
+	ext := &sshFxpExtendedPacket{SpecificPacket: &sshFxpExtendedPacketStatVFS{Path: "/X"}}
+	require.NoError(t, policy.apply(ext))
+	assert.Equal(t, "/x", ext.SpecificPacket.(*sshFxpExtendedPacketStatVFS).Path)
+
+	// packets without paths are left alone.
+	assert.NoError(t, policy.apply(&sshFxpReadPacket{Handle: "/a/b/c"}))
+}
+
+func TestRequestPathPolicy(t *testing.T) {
+	p := clientRequestServerPair(t, WithRSPathPolicy(PathPolicy{
+		MaxLength: 32,
+	}))
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	_, err = p.cli.Stat("/foo")
+	assert.NoError(t, err)
+
+	_, err = p.cli.Stat("/foo\x00")
+	assert.Equal(t, &StatusError{Code: sshFxFailure, msg: errPathForbiddenByte.Error()}, err)
+
+	err = p.cli.Rename("/foo", "/"+strings.Repeat("x", 32))
+	assert.Equal(t, &StatusError{Code: sshFxFailure, msg: errPathTooLong.Error()}, err)
+}
@@ -0,0 +1,98 @@
+package sftp
+
+import (
+	"context"
+)
+
+// A RateLimiter limits the rate at which data is transferred, counted in bytes,
+// such as a *rate.Limiter of golang.org/x/time/rate.
+//
+// If the RateLimiter also has a method Burst() int, as a *rate.Limiter does,
+// a wait for more than the burst is split into waits of at most the burst.
+type RateLimiter interface {
+	// WaitN blocks until n bytes may be transferred, or the context is done.
+	WaitN(ctx context.Context, n int) error
+}
+
+// rateLimits are the limits of the data read and written by the requests of a Client, or Server.
+type rateLimits struct {
+	read, write RateLimiter
+}
+
+// wait blocks until the limiter of the data of the READ or WRITE request p allows it to be sent, or handled.
+// Other requests are not limited.
+func (l *rateLimits) wait(ctx context.Context, p interface{}) error {
+	if epkt, ok := p.(*sshFxpExtendedPacket); ok {
+		p = epkt.SpecificPacket
+	}
+
+	switch p := p.(type) {
+	case *sshFxpReadPacket:
+		return waitN(ctx, l.read, int(p.Len))
+	case *sshFxpWritePacket:
+		return waitN(ctx, l.write, len(p.Data))
+	case *sshFxpWriteBatchPacket:
+		return waitN(ctx, l.write, len(p.Data))
+	case *sshFxpExtendedPacketWriteBatch:
+		return waitN(ctx, l.write, len(p.Data))
+	}
+	return nil
+}
+
+func waitN(ctx context.Context, l RateLimiter, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	// a *rate.Limiter fails at once to wait for more than its burst.
+	if b, ok := l.(interface{ Burst() int }); ok {
+		if burst := b.Burst(); burst > 0 {
+			for n > burst {
+				if err := l.WaitN(ctx, burst); err != nil {
+					return err
+				}
+				n -= burst
+			}
+		}
+	}
+
+	return l.WaitN(ctx, n)
+}
+
+// WithReadRateLimit limits the rate of the data the Client reads, across all the READ requests it sends,
+// including those sent concurrently by File.WriteTo, or by other goroutines.
+// Each READ waits for the limiter, for the length it requests, before it is sent.
+func WithReadRateLimit(l RateLimiter) ClientOption {
+	return func(c *Client) error {
+		c.rateLimits.read = l
+		return nil
+	}
+}
+
+// WithWriteRateLimit limits the rate of the data the Client writes, across all the WRITE requests it sends,
+// including those sent concurrently by File.ReadFrom, or by other goroutines.
+// Each WRITE waits for the limiter, for the length of its data, before it is sent.
+func WithWriteRateLimit(l RateLimiter) ClientOption {
+	return func(c *Client) error {
+		c.rateLimits.write = l
+		return nil
+	}
+}
+
+// WithServerRateLimit limits the rate of the data the Server reads from files, for READ requests,
+// and writes to files, for WRITE requests, across all the requests of the session.
+// Each request waits for its limiter, if not nil, before it is handled.
+func WithServerRateLimit(read, write RateLimiter) ServerOption {
+	return func(s *Server) error {
+		s.rateLimits = rateLimits{read: read, write: write}
+		return nil
+	}
+}
+
+// WithRSRateLimit limits the rate of the data read and written through the Handlers,
+// in the same way as WithServerRateLimit.
+func WithRSRateLimit(read, write RateLimiter) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.rateLimits = rateLimits{read: read, write: write}
+	}
+}
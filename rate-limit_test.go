@@ -0,0 +1,157 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingLimiter records the waits for it, and fails them with err, if set.
+type countingLimiter struct {
+	mu    sync.Mutex
+	total int
+	max   int
+	burst int
+	err   error
+}
+
+func (l *countingLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return l.err
+	}
+	if l.burst > 0 && n > l.burst {
+		return errors.New("n exceeds burst")
+	}
+	l.total += n
+	if n > l.max {
+		l.max = n
+	}
+	return nil
+}
+
+func (l *countingLimiter) Burst() int { return l.burst }
+
+// blockingLimiter holds every wait until its context is done.
+type blockingLimiter struct{}
+
+func (blockingLimiter) WaitN(ctx context.Context, n int) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestClientRateLimitCancel(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	require.NoError(t, WithWriteRateLimit(blockingLimiter{})(p.cli))
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	for _, concurrent := range []bool{false, true} {
+		p.cli.useConcurrentWrites = concurrent
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = f.ReadFromContext(ctx, bytes.NewReader(bytes.Repeat([]byte("x"), 100000)))
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err, "concurrent: %v", concurrent)
+	}
+}
+
+func TestWaitNBurst(t *testing.T) {
+	l := &countingLimiter{burst: 1000}
+	require.NoError(t, waitN(context.Background(), l, 2500))
+	assert.Equal(t, 2500, l.total)
+	assert.Equal(t, 1000, l.max)
+
+	require.NoError(t, waitN(context.Background(), nil, 2500))
+}
+
+func TestClientRateLimit(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	read, write := new(countingLimiter), new(countingLimiter)
+	require.NoError(t, WithReadRateLimit(read)(p.cli))
+	require.NoError(t, WithWriteRateLimit(write)(p.cli))
+	p.cli.useConcurrentWrites = true
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = f.ReadFrom(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, len(content), write.total)
+	assert.Equal(t, 0, read.total)
+
+	f, err = p.cli.Open("/foo")
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, content, got)
+	assert.GreaterOrEqual(t, read.total, len(content)) // reads ask for whole chunks
+
+	// the writes sent without waiting for an acknowledgement are limited too.
+	write.total = 0
+	p.cli.useConcurrentWrites = false
+	p.cli.writeAckBatch = 1 << 16
+	f, err = p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = f.ReadFrom(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, len(content), write.total)
+
+	// a limiter that fails fails the request.
+	write.err = errors.New("limited")
+	f, err = p.cli.Create("/bar")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("data"))
+	assert.Equal(t, write.err, err)
+	f.Close()
+}
+
+func TestRequestServerRateLimit(t *testing.T) {
+	read, write := new(countingLimiter), new(countingLimiter)
+	p := clientRequestServerPair(t, WithRSRateLimit(read, write))
+	defer p.Close()
+
+	content := bytes.Repeat([]byte("x"), 100000)
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = f.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, len(content), write.total)
+
+	f, err = p.cli.Open("/foo")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.GreaterOrEqual(t, read.total, len(content))
+
+	write.err = errors.New("limited")
+	f, err = p.cli.Create("/bar")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("data"))
+	var status *StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+	f.Close()
+}
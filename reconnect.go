@@ -0,0 +1,340 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// reconnectMaxAttemptsDefault is the number of reconnects for an operation, unless ReconnectOptions.MaxAttempts is given.
+const reconnectMaxAttemptsDefault = 3
+
+// ReconnectOptions configures a ReconnectingClient.
+type ReconnectOptions struct {
+	// MaxAttempts is the number of times a new connection is dialled for an operation, after its connection was lost,
+	// before the operation fails, by default 3.
+	MaxAttempts int
+
+	// Backoff is the delay before the first dial of a new connection for an operation, which doubles for each following dial.
+	// By default, the first dial is immediate, and the following ones are after 100ms, 200ms, and so on.
+	Backoff time.Duration
+
+	// OnReconnect, if not nil, is called with each new connection, once dialled.
+	OnReconnect func(c *Client)
+}
+
+func (o *ReconnectOptions) maxAttempts() int {
+	if o == nil || o.MaxAttempts <= 0 {
+		return reconnectMaxAttemptsDefault
+	}
+	return o.MaxAttempts
+}
+
+// backoff returns the delay before the given dial of a new connection, counting from 1.
+func (o *ReconnectOptions) backoff(attempt int) time.Duration {
+	if o != nil && o.Backoff > 0 {
+		return o.Backoff << uint(attempt-1)
+	}
+	if attempt == 1 {
+		return 0
+	}
+	return 100 * time.Millisecond << uint(attempt-2)
+}
+
+// isConnectionLost reports whether err is the error of a request whose connection to the server was lost.
+func isConnectionLost(err error) bool {
+	return errors.Is(err, ErrSSHFxConnectionLost) || errors.Is(err, ErrSSHFxNoConnection)
+}
+
+// A ReconnectingClient runs operations on a Client, which it replaces with a new one, from its dial function,
+// whenever an operation fails because the connection was lost, and then retries the operation.
+// It is safe for concurrent use.
+//
+// An operation whose connection is lost may have been done by the server, with its response lost,
+// and so the operations given to Do should be idempotent, such as Stat, or Chmod,
+// or be prepared to find that they were already done, such as a Rename that fails as the file is gone.
+//
+// Files opened with OpenFile are reopened on the new connection, by their path and offset,
+// so that sequential transfers continue where they stopped, see ReconnectingFile.
+type ReconnectingClient struct {
+	dial func(ctx context.Context) (*Client, error)
+	opts *ReconnectOptions
+
+	mu     sync.Mutex
+	c      *Client
+	closed bool
+}
+
+// NewReconnectingClient returns a ReconnectingClient on a first Client from dial.
+// A nil opts is the same as the zero ReconnectOptions.
+//
+// The dial function is responsible for the SSH connection of each Client,
+// which it may close once the SFTP session ends, such as with go func() { c.Wait(); conn.Close() }().
+func NewReconnectingClient(ctx context.Context, dial func(ctx context.Context) (*Client, error), opts *ReconnectOptions) (*ReconnectingClient, error) {
+	c, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReconnectingClient{
+		dial: dial,
+		opts: opts,
+		c:    c,
+	}, nil
+}
+
+// Client returns the current Client of rc, which is replaced once its connection is lost.
+func (rc *ReconnectingClient) Client() *Client {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.c
+}
+
+// Close closes the current Client of rc, after which operations fail with os.ErrClosed.
+func (rc *ReconnectingClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return os.ErrClosed
+	}
+	rc.closed = true
+
+	return rc.c.Close()
+}
+
+// Do calls fn with the current Client of rc, and, if it fails because the connection was lost,
+// with a new Client, up to ReconnectOptions.MaxAttempts times.
+// The context bounds the waits and dials for new connections, and is not passed on to fn.
+func (rc *ReconnectingClient) Do(ctx context.Context, fn func(c *Client) error) error {
+	c, err := rc.current()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(c)
+		if !isConnectionLost(err) || attempt > rc.opts.maxAttempts() {
+			return err
+		}
+
+		if c, err = rc.reconnect(ctx, c, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+func (rc *ReconnectingClient) current() (*Client, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return nil, os.ErrClosed
+	}
+	return rc.c, nil
+}
+
+// reconnect replaces lost, the Client whose connection was lost, with a new one, for the given attempt of an operation,
+// unless it has already been replaced by another operation, whose new Client is then returned.
+func (rc *ReconnectingClient) reconnect(ctx context.Context, lost *Client, attempt int) (*Client, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return nil, os.ErrClosed
+	}
+	if rc.c != lost {
+		return rc.c, nil
+	}
+
+	if d := rc.opts.backoff(attempt); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	c, err := rc.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the reader of a dead connection may never return, and so it is closed as well.
+	go func() {
+		lost.lose(ErrSSHFxConnectionLost)
+		lost.Close()
+	}()
+
+	rc.c = c
+	if rc.opts != nil && rc.opts.OnReconnect != nil {
+		rc.opts.OnReconnect(c)
+	}
+	return c, nil
+}
+
+// OpenFile opens the named file with the flags flag, as Client.OpenFile, on the current Client of rc,
+// as a ReconnectingFile.
+func (rc *ReconnectingClient) OpenFile(path string, flag int) (*ReconnectingFile, error) {
+	rf := &ReconnectingFile{
+		rc:   rc,
+		path: path,
+		flag: flag,
+	}
+
+	err := rc.Do(context.Background(), func(c *Client) error {
+		f, err := c.OpenFile(path, flag)
+		rf.f = f
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// a reopen must neither truncate the data written so far, nor fail as the file now exists.
+	rf.flag &^= os.O_TRUNC | os.O_EXCL
+	return rf, nil
+}
+
+// Open opens the named file for reading, as Client.Open, as a ReconnectingFile.
+func (rc *ReconnectingClient) Open(path string) (*ReconnectingFile, error) {
+	return rc.OpenFile(path, os.O_RDONLY)
+}
+
+// Create creates, or truncates, the named file, as Client.Create, as a ReconnectingFile.
+func (rc *ReconnectingClient) Create(path string) (*ReconnectingFile, error) {
+	return rc.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// A ReconnectingFile is a File of a ReconnectingClient, which is reopened, by its path, on the new Client,
+// whenever its connection is lost, and then continues from its offset.
+// It is intended for sequential transfers, such as with io.Copy, and is not safe for concurrent use.
+//
+// The data written after the last write acknowledged by the server may be written again,
+// and a file changed by another client in the meantime is not detected.
+type ReconnectingFile struct {
+	rc   *ReconnectingClient
+	path string
+	flag int
+
+	f      *File
+	offset int64
+}
+
+// do calls fn with the File, reopening it on a new Client if the connection was lost,
+// in the same way as ReconnectingClient.Do.
+func (rf *ReconnectingFile) do(fn func(f *File) error) error {
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(rf.f)
+		if !isConnectionLost(err) || attempt > rf.rc.opts.maxAttempts() {
+			return err
+		}
+
+		if err := rf.reopen(attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// reopen opens the file again on a new Client, at the offset reached.
+func (rf *ReconnectingFile) reopen(attempt int) error {
+	c, err := rf.rc.reconnect(context.Background(), rf.f.c, attempt)
+	if err != nil {
+		return err
+	}
+
+	f, err := c.OpenFile(rf.path, rf.flag)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(rf.offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.f = f
+	return nil
+}
+
+// Name returns the name of the file, as given to OpenFile.
+func (rf *ReconnectingFile) Name() string {
+	return rf.path
+}
+
+// Read reads from the file, as File.Read.
+func (rf *ReconnectingFile) Read(b []byte) (int, error) {
+	var n int
+	err := rf.do(func(f *File) error {
+		var err error
+		n, err = f.Read(b)
+		rf.offset += int64(n)
+		if n > 0 && isConnectionLost(err) {
+			// return what was read, and reopen on the next call.
+			return nil
+		}
+		return err
+	})
+	return n, err
+}
+
+// Write writes to the file, as File.Write, writing the rest of b again on a new Client if the connection is lost.
+func (rf *ReconnectingFile) Write(b []byte) (int, error) {
+	var written int
+	err := rf.do(func(f *File) error {
+		n, err := f.Write(b[written:])
+		written += n
+		rf.offset += int64(n)
+		return err
+	})
+	return written, err
+}
+
+// Seek sets the offset of the next Read or Write, as File.Seek.
+func (rf *ReconnectingFile) Seek(offset int64, whence int) (int64, error) {
+	err := rf.do(func(f *File) error {
+		var err error
+		offset, err = f.Seek(offset, whence)
+		if err == nil {
+			rf.offset = offset
+			whence = io.SeekStart // a retry must not apply a relative offset twice.
+		}
+		return err
+	})
+	return rf.offset, err
+}
+
+// Stat returns the FileInfo of the file, as File.Stat.
+func (rf *ReconnectingFile) Stat() (os.FileInfo, error) {
+	var fi os.FileInfo
+	err := rf.do(func(f *File) error {
+		var err error
+		fi, err = f.Stat()
+		return err
+	})
+	return fi, err
+}
+
+// Close closes the file.
+// If the connection has been lost, the handle is gone with it, and there is nothing to close.
+func (rf *ReconnectingFile) Close() error {
+	if rf.f == nil {
+		return os.ErrClosed
+	}
+
+	err := rf.f.Close()
+	rf.f = nil
+	if isConnectionLost(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package sftp
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reconnectTestServer dials Clients of RequestServers over pipes, all on the same in-memory files,
+// and can break the connection of the latest one, as a network would, without the server noticing.
+type reconnectTestServer struct {
+	handlers Handlers
+
+	mu    sync.Mutex
+	pipes []*io.PipeReader // the ends the Clients read from.
+	dials int
+}
+
+// reconnectTestFiles hides the TransferError of the in-memory files,
+// which would fail them for good once the server of a broken connection finds out.
+type reconnectTestFiles struct {
+	FileReader
+	OpenFileWriter
+}
+
+func (h reconnectTestFiles) Fileread(r *Request) (io.ReaderAt, error) {
+	f, err := h.FileReader.Fileread(r)
+	return struct{ io.ReaderAt }{f}, err
+}
+
+func (h reconnectTestFiles) OpenFile(r *Request) (WriterAtReaderAt, error) {
+	f, err := h.OpenFileWriter.OpenFile(r)
+	return struct{ WriterAtReaderAt }{f}, err
+}
+
+func (s *reconnectTestServer) dial(ctx context.Context) (*Client, error) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	rs := NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, s.handlers)
+	go func() {
+		rs.Serve()
+		rs.Close()
+	}()
+
+	s.mu.Lock()
+	s.pipes = append(s.pipes, cr)
+	s.dials++
+	s.mu.Unlock()
+
+	return NewClientPipe(cr, cw)
+}
+
+// breakConn breaks the connection of c, and waits for c to find out.
+func (s *reconnectTestServer) breakConn(t *testing.T, c *Client) {
+	s.mu.Lock()
+	r := s.pipes[len(s.pipes)-1]
+	s.mu.Unlock()
+
+	r.Close()
+	c.Wait()
+}
+
+func TestReconnectingClient(t *testing.T) {
+	handlers := InMemHandler()
+	files := reconnectTestFiles{handlers.FileGet, handlers.FilePut.(OpenFileWriter)}
+	handlers.FileGet, handlers.FilePut = files, files
+	s := &reconnectTestServer{handlers: handlers}
+
+	var reconnects int
+	rc, err := NewReconnectingClient(context.Background(), s.dial, &ReconnectOptions{
+		OnReconnect: func(*Client) { reconnects++ },
+	})
+	require.NoError(t, err)
+	defer rc.Close()
+
+	f, err := rc.Create("/foo")
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte("hello "))
+	require.NoError(t, err)
+
+	s.breakConn(t, rc.Client())
+
+	_, err = f.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, 1, reconnects)
+
+	// the reopen must not have truncated the file.
+	f, err = rc.Open("/foo")
+	require.NoError(t, err)
+
+	b := make([]byte, 6)
+	_, err = io.ReadFull(f, b)
+	require.NoError(t, err)
+
+	s.breakConn(t, rc.Client())
+
+	rest, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(b)+string(rest))
+	require.NoError(t, f.Close())
+	assert.Equal(t, 2, reconnects)
+
+	s.breakConn(t, rc.Client())
+
+	err = rc.Do(context.Background(), func(c *Client) error {
+		_, err := c.Stat("/foo")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, s.dials)
+
+	require.NoError(t, rc.Close())
+	_, err = rc.Open("/foo")
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
@@ -0,0 +1,116 @@
+package sftp
+
+import (
+	"os"
+	"strings"
+)
+
+// WithRenameFallbackCopy sets whether Client.Rename falls back to copying the file, and removing the original,
+// when the server refuses the rename because the new name is on another filesystem,
+// as mv does, while the server only exposes the failure of rename(2).
+//
+// The copy keeps the permissions, the access and modification times, and, if the server allows it, the owner of the file.
+// Only regular files and symbolic links are copied: the rename of a directory across filesystems still fails.
+// As with a rename, the copy fails if newname already exists.
+//
+// The copy is not atomic: if it fails, the partial copy is removed, and the original is kept,
+// but if the removal of the original fails, both are left, and the error of the removal is returned.
+func WithRenameFallbackCopy(value bool) ClientOption {
+	return func(c *Client) error {
+		c.renameFallbackCopy = value
+		return nil
+	}
+}
+
+// isCrossDeviceError reports whether err is the failure of a rename because the names are on different filesystems,
+// which servers send either as SSH_FX_OP_UNSUPPORTED, or as a generic failure with the message of EXDEV.
+func isCrossDeviceError(err error) bool {
+	status, ok := err.(*StatusError)
+	if !ok {
+		return false
+	}
+
+	switch status.Code {
+	case sshFxOPUnsupported:
+		return true
+	case sshFxFailure:
+		msg := strings.ToLower(status.msg)
+		return strings.Contains(msg, "cross-device") || strings.Contains(msg, "not same device")
+	}
+	return false
+}
+
+// renameByCopy copies oldname to newname, with its attributes, and then removes oldname.
+// It returns renameErr, the error of the rename, if oldname cannot be copied this way.
+func (c *Client) renameByCopy(oldname, newname string, renameErr error) error {
+	fi, err := c.Lstat(oldname)
+	if err != nil {
+		return renameErr
+	}
+
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := c.ReadLink(oldname)
+		if err != nil {
+			return err
+		}
+		if err := c.Symlink(target, newname); err != nil {
+			return err
+		}
+
+	case fi.Mode().IsRegular():
+		if err := c.copyFileAttrs(oldname, newname, fi); err != nil {
+			return err
+		}
+
+	default:
+		return renameErr
+	}
+
+	return c.Remove(oldname)
+}
+
+// copyFileAttrs copies the contents of the regular file oldname, described by fi, to the new file newname,
+// and gives it the permissions, times, and owner of oldname.
+// If it fails after newname is created, newname is removed.
+func (c *Client) copyFileAttrs(oldname, newname string, fi os.FileInfo) error {
+	src, err := c.Open(oldname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := c.OpenFile(newname, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+
+	if err := c.copyFileContents(src, dst, newname, fi); err != nil {
+		c.Remove(newname)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) copyFileContents(src, dst *File, newname string, fi os.FileInfo) error {
+	if _, err := dst.ReadFrom(src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := c.Chmod(newname, fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	atime := fi.ModTime()
+	if fs, ok := fi.Sys().(*FileStat); ok {
+		atime = fs.AccessTime()
+
+		// only a privileged user may give away a file, and so the owner is kept where the server allows it.
+		c.Chown(newname, int(fs.UID), int(fs.GID))
+	}
+	return c.Chtimes(newname, atime, fi.ModTime())
+}
@@ -0,0 +1,93 @@
+package sftp
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crossDeviceCmder fails every rename, as a server does across filesystems,
+// and records the permissions and times set, which the InMemHandler does not keep.
+type crossDeviceCmder struct {
+	FileCmder
+	setstat map[string]FileStat
+}
+
+func (c crossDeviceCmder) Filecmd(r *Request) error {
+	switch r.Method {
+	case "Rename":
+		return errors.New("rename: invalid cross-device link")
+	case "Setstat":
+		attrs := c.setstat[r.Filepath]
+		if r.AttrFlags().Permissions {
+			attrs.Mode = r.Attributes().Mode
+		}
+		if r.AttrFlags().Acmodtime {
+			attrs.Atime, attrs.Mtime = r.Attributes().Atime, r.Attributes().Mtime
+		}
+		c.setstat[r.Filepath] = attrs
+	}
+	return c.FileCmder.Filecmd(r)
+}
+
+func TestClientRenameFallbackCopy(t *testing.T) {
+	handlers := InMemHandler()
+	cmder := crossDeviceCmder{handlers.FileCmd, make(map[string]FileStat)}
+	handlers.FileCmd = cmder
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	f, err := p.cli.Create("/old")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("contents"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	old, err := p.cli.Lstat("/old")
+	require.NoError(t, err)
+
+	// the failure of the server is returned by default.
+	err = p.cli.Rename("/old", "/new")
+	assert.Error(t, err)
+	_, err = p.cli.Lstat("/new")
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, WithRenameFallbackCopy(true)(p.cli))
+
+	require.NoError(t, p.cli.Rename("/old", "/new"))
+
+	_, err = p.cli.Lstat("/old")
+	assert.True(t, os.IsNotExist(err))
+
+	attrs := cmder.setstat["/new"]
+	assert.Equal(t, old.Mode().Perm(), attrs.FileMode().Perm())
+	assert.Equal(t, old.ModTime().Unix(), attrs.ModTime().Unix())
+
+	file, err := p.testHandler().fetch("/new")
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(file.content))
+
+	// as a rename, the copy does not replace an existing file.
+	f, err = p.cli.Create("/old")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	assert.Error(t, p.cli.Rename("/old", "/new"))
+	_, err = p.cli.Lstat("/old")
+	assert.NoError(t, err)
+
+	file, err = p.testHandler().fetch("/new")
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(file.content))
+}
+
+func TestIsCrossDeviceError(t *testing.T) {
+	assert.True(t, isCrossDeviceError(&StatusError{Code: sshFxOPUnsupported}))
+	assert.True(t, isCrossDeviceError(&StatusError{Code: sshFxFailure, msg: "Invalid cross-device link"}))
+	assert.False(t, isCrossDeviceError(&StatusError{Code: sshFxFailure, msg: "Failure"}))
+	assert.False(t, isCrossDeviceError(&StatusError{Code: sshFxPermissionDenied}))
+	assert.False(t, isCrossDeviceError(os.ErrNotExist))
+}
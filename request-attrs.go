@@ -21,6 +21,30 @@ func newFileOpenFlags(flags uint32) FileOpenFlags {
 	}
 }
 
+// pflags converts the flags back to SFTP Open packet pflag values.
+func (f FileOpenFlags) pflags() uint32 {
+	var flags uint32
+	if f.Read {
+		flags |= sshFxfRead
+	}
+	if f.Write {
+		flags |= sshFxfWrite
+	}
+	if f.Append {
+		flags |= sshFxfAppend
+	}
+	if f.Creat {
+		flags |= sshFxfCreat
+	}
+	if f.Trunc {
+		flags |= sshFxfTrunc
+	}
+	if f.Excl {
+		flags |= sshFxfExcl
+	}
+	return flags
+}
+
 // Pflags converts the bitmap/uint32 from SFTP Open packet pflag values,
 // into a FileOpenFlags struct with booleans set for flags set in bitmap.
 func (r *Request) Pflags() FileOpenFlags {
@@ -43,6 +67,24 @@ func newFileAttrFlags(flags uint32) FileAttrFlags {
 	}
 }
 
+// flags converts the flags back to SFTP file attribute flags.
+func (f FileAttrFlags) flags() uint32 {
+	var flags uint32
+	if f.Size {
+		flags |= sshFileXferAttrSize
+	}
+	if f.UidGid {
+		flags |= sshFileXferAttrUIDGID
+	}
+	if f.Permissions {
+		flags |= sshFileXferAttrPermissions
+	}
+	if f.Acmodtime {
+		flags |= sshFileXferAttrACmodTime
+	}
+	return flags
+}
+
 // AttrFlags returns a FileAttrFlags boolean struct based on the
 // bitmap/uint32 file attribute flags from the SFTP packaet.
 func (r *Request) AttrFlags() FileAttrFlags {
@@ -52,6 +94,6 @@ func (r *Request) AttrFlags() FileAttrFlags {
 // Attributes parses file attributes byte blob and return them in a
 // FileStat object.
 func (r *Request) Attributes() *FileStat {
-	fs, _, _ := unmarshalFileStat(r.Flags, r.Attrs)
+	fs, _ := unmarshalLastFileStat(r.Flags, r.Attrs)
 	return fs
 }
@@ -0,0 +1,383 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// Decorators wrap a set of Handlers, returning Handlers which apply some behavior to every request,
+// before passing it on to those wrapped.
+// They may be chained, such as:
+//
+//	handlers = LoggingHandlers(ReadOnlyHandlers(PrefixHandlers(handlers, "/srv/sftp")), log.Printf)
+//
+// The decorated Handlers implement the same optional interfaces as the wrapped Handlers do,
+// such as OpenFileWriter, PosixRenameFileCmder, StatVFSFileCmder, CopyDataFileCmder,
+// ExpandPathFileLister, or GenerationFileLister, and pass on their WorkerPoolsHinter,
+// or else fall back to the behavior the RequestServer applies when they are not implemented.
+// Methods which are not given a Request, such as RealPath and Readlink,
+// are passed through the decorator with a Request of the same Method.
+
+// handlerDecorator wraps the Handlers next, passing every Request through around on its way to them.
+type handlerDecorator struct {
+	next Handlers
+
+	// around is called with each Request for the wrapped Handlers, and the call which forwards it.
+	around func(r *Request, call func(*Request) error) error
+
+	// unmapPath, if not nil, is applied to the paths returned by RealPath.
+	unmapPath func(p string) (string, error)
+}
+
+// WorkerPools passes on the WorkerPools declared by the wrapped Handlers, if any, see WorkerPoolsHinter.
+func (d *handlerDecorator) WorkerPools() WorkerPools {
+	return hintedWorkerPools(d.next)
+}
+
+func decorate(h Handlers, d *handlerDecorator) Handlers {
+	d.next = h
+
+	var decorated Handlers
+	if h.FileGet != nil {
+		decorated.FileGet = decoratedReader{d}
+	}
+	if h.FilePut != nil {
+		if _, ok := h.FilePut.(OpenFileWriter); ok {
+			decorated.FilePut = decoratedOpenFileWriter{decoratedWriter{d}}
+		} else {
+			decorated.FilePut = decoratedWriter{d}
+		}
+	}
+	if h.FileCmd != nil {
+		decorated.FileCmd = decoratedCmder{d}
+	}
+	if h.FileList != nil {
+		// Without a RealPath method, the RequestServer resolves paths against its start directory,
+		// which the decorator cannot know, so it is only implemented when the wrapped FileLister does.
+		// The same goes for ExpandPath, which falls back to the start directory for "~".
+		_, expands := h.FileList.(ExpandPathFileLister)
+		switch h.FileList.(type) {
+		case RealPathFileLister, legacyRealPathFileLister:
+			if expands {
+				decorated.FileList = decoratedRealPathExpandPathLister{decoratedRealPathLister{decoratedLister{d}}}
+			} else {
+				decorated.FileList = decoratedRealPathLister{decoratedLister{d}}
+			}
+		default:
+			if expands {
+				decorated.FileList = decoratedExpandPathLister{decoratedLister{d}}
+			} else {
+				decorated.FileList = decoratedLister{d}
+			}
+		}
+	}
+	return decorated
+}
+
+type decoratedReader struct{ *handlerDecorator }
+
+func (d decoratedReader) Fileread(r *Request) (rd io.ReaderAt, err error) {
+	err = d.around(r, func(r *Request) error {
+		rd, err = d.next.FileGet.Fileread(r)
+		return err
+	})
+	return rd, err
+}
+
+type decoratedWriter struct{ *handlerDecorator }
+
+func (d decoratedWriter) Filewrite(r *Request) (wr io.WriterAt, err error) {
+	err = d.around(r, func(r *Request) error {
+		wr, err = d.next.FilePut.Filewrite(r)
+		return err
+	})
+	return wr, err
+}
+
+type decoratedOpenFileWriter struct{ decoratedWriter }
+
+func (d decoratedOpenFileWriter) OpenFile(r *Request) (rw WriterAtReaderAt, err error) {
+	err = d.around(r, func(r *Request) error {
+		rw, err = d.next.FilePut.(OpenFileWriter).OpenFile(r)
+		return err
+	})
+	return rw, err
+}
+
+type decoratedCmder struct{ *handlerDecorator }
+
+func (d decoratedCmder) Filecmd(r *Request) error {
+	return d.around(r, d.next.FileCmd.Filecmd)
+}
+
+func (d decoratedCmder) PosixRename(r *Request) error {
+	if posixRenamer, ok := d.next.FileCmd.(PosixRenameFileCmder); ok {
+		return d.around(r, posixRenamer.PosixRename)
+	}
+
+	// PosixRenameFileCmder not implemented handle this request as a Rename
+	r.Method = "Rename"
+	return d.around(r, d.next.FileCmd.Filecmd)
+}
+
+func (d decoratedCmder) StatVFS(r *Request) (stat *StatVFS, err error) {
+	statVFSCmdr, ok := d.next.FileCmd.(StatVFSFileCmder)
+	if !ok {
+		return nil, ErrSSHFxOpUnsupported
+	}
+
+	err = d.around(r, func(r *Request) error {
+		stat, err = statVFSCmdr.StatVFS(r)
+		return err
+	})
+	return stat, err
+}
+
+// CopyData passes src and dst on to the CopyData of the wrapped FileCmder, as a Request of Method "CopyData",
+// whose Filepath is that of src and whose Target is that of dst,
+// or else copies the data through the open files, as the RequestServer does.
+func (d decoratedCmder) CopyData(src *Request, srcOffset, length int64, dst *Request, dstOffset int64) error {
+	r := &Request{Method: "CopyData", Filepath: src.Filepath, Target: dst.Filepath}
+	return d.around(r, func(r *Request) error {
+		cmder, ok := d.next.FileCmd.(CopyDataFileCmder)
+		if !ok {
+			return copyRequestData(src, srcOffset, length, dst, dstOffset)
+		}
+
+		src, dst := src.copy(), dst.copy()
+		src.Filepath, dst.Filepath = r.Filepath, r.Target
+		return cmder.CopyData(src, srcOffset, length, dst, dstOffset)
+	})
+}
+
+type decoratedLister struct{ *handlerDecorator }
+
+func (d decoratedLister) Filelist(r *Request) (la ListerAt, err error) {
+	err = d.around(r, func(r *Request) error {
+		la, err = d.next.FileList.Filelist(r)
+		return err
+	})
+	return la, err
+}
+
+func (d decoratedLister) Lstat(r *Request) (la ListerAt, err error) {
+	lstatFileLister, ok := d.next.FileList.(LstatFileLister)
+	if !ok {
+		// LstatFileLister not implemented handle this request as a Stat
+		r.Method = "Stat"
+		return d.Filelist(r)
+	}
+
+	err = d.around(r, func(r *Request) error {
+		la, err = lstatFileLister.Lstat(r)
+		return err
+	})
+	return la, err
+}
+
+func (d decoratedLister) Readlink(p string) (target string, err error) {
+	err = d.around(&Request{Method: "Readlink", Filepath: p}, func(r *Request) error {
+		if readlinkFileLister, ok := d.next.FileList.(ReadlinkFileLister); ok {
+			target, err = readlinkFileLister.Readlink(r.Filepath)
+			return err
+		}
+
+		// As the RequestServer does without a ReadlinkFileLister,
+		// the target is the name of the entry listed for the link.
+		lister, err := d.next.FileList.Filelist(r)
+		if err != nil {
+			return err
+		}
+		finfo := make([]os.FileInfo, 1)
+		n, err := lister.ListAt(finfo, 0)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			return &os.PathError{Op: "readlink", Path: p, Err: syscall.ENOENT}
+		}
+		target = finfo[0].Name()
+		return nil
+	})
+	return target, err
+}
+
+func (d decoratedLister) Generation(r *Request) (token string, err error) {
+	generationLister, ok := d.next.FileList.(GenerationFileLister)
+	if !ok {
+		return "", ErrSSHFxOpUnsupported
+	}
+
+	err = d.around(r, func(r *Request) error {
+		token, err = generationLister.Generation(r)
+		return err
+	})
+	return token, err
+}
+
+func (d decoratedLister) LookupUserName(uid string) string {
+	if idLookup, ok := d.next.FileList.(NameLookupFileLister); ok {
+		return idLookup.LookupUserName(uid)
+	}
+	return uid
+}
+
+func (d decoratedLister) LookupGroupName(gid string) string {
+	if idLookup, ok := d.next.FileList.(NameLookupFileLister); ok {
+		return idLookup.LookupGroupName(gid)
+	}
+	return gid
+}
+
+type decoratedRealPathLister struct{ decoratedLister }
+
+func (d decoratedRealPathLister) RealPath(p string) (realPath string, err error) {
+	err = d.around(&Request{Method: "RealPath", Filepath: p}, func(r *Request) error {
+		switch pather := d.next.FileList.(type) {
+		case RealPathFileLister:
+			realPath, err = pather.RealPath(r.Filepath)
+		case legacyRealPathFileLister:
+			realPath = pather.RealPath(r.Filepath)
+		}
+		return err
+	})
+	if err != nil || d.unmapPath == nil {
+		return realPath, err
+	}
+	return d.unmapPath(realPath)
+}
+
+func (d decoratedLister) expandPath(p string) (expanded string, err error) {
+	err = d.around(&Request{Method: "ExpandPath", Filepath: p}, func(r *Request) error {
+		expanded, err = d.next.FileList.(ExpandPathFileLister).ExpandPath(r.Filepath)
+		return err
+	})
+	if err != nil || d.unmapPath == nil {
+		return expanded, err
+	}
+	return d.unmapPath(expanded)
+}
+
+type decoratedExpandPathLister struct{ decoratedLister }
+
+func (d decoratedExpandPathLister) ExpandPath(p string) (string, error) {
+	return d.expandPath(p)
+}
+
+type decoratedRealPathExpandPathLister struct{ decoratedRealPathLister }
+
+func (d decoratedRealPathExpandPathLister) ExpandPath(p string) (string, error) {
+	return d.expandPath(p)
+}
+
+// LoggingHandlers returns Handlers which log every request made of h, and its outcome, through logf,
+// which may be log.Printf.
+func LoggingHandlers(h Handlers, logf func(format string, args ...interface{})) Handlers {
+	return decorate(h, &handlerDecorator{
+		around: func(r *Request, call func(*Request) error) error {
+			err := call(r)
+
+			outcome := "ok"
+			if err != nil {
+				outcome = err.Error()
+			}
+
+			if r.Target != "" {
+				logf("sftp: %s %q %q: %s", r.Method, r.Filepath, r.Target, outcome)
+			} else {
+				logf("sftp: %s %q: %s", r.Method, r.Filepath, outcome)
+			}
+			return err
+		},
+	})
+}
+
+// ReadOnlyHandlers returns Handlers which refuse every request to modify the filesystem of h,
+// with SSH_FX_PERMISSION_DENIED, before it reaches h.
+// This covers opening a file for writing, Setstat, Rename, PosixRename, Remove, Mkdir, Rmdir, Link, Symlink, and CopyData.
+func ReadOnlyHandlers(h Handlers) Handlers {
+	return decorate(h, &handlerDecorator{
+		around: func(r *Request, call func(*Request) error) error {
+			switch r.Method {
+			case "Put", "Open", "Setstat", "Rename", "PosixRename", "Remove", "Mkdir", "Rmdir", "Link", "Symlink", "CopyData":
+				return ErrSSHFxPermissionDenied
+			}
+			return call(r)
+		},
+	})
+}
+
+// PrefixHandlers returns Handlers which pass every request on to h with prefix joined to the front of its paths,
+// so that the client sees the tree under prefix in h as its root.
+// Paths are cleaned before the prefix is added, so that ".." cannot climb above it,
+// and the prefix is removed from the paths returned by RealPath, and from those of *os.PathError and *os.LinkError.
+//
+// The target of a Symlink is stored as given, see Request.
+// A RealPath which resolves to outside of prefix fails with SSH_FX_PERMISSION_DENIED.
+// So does an ExpandPath, whose paths starting with "~" are passed on as given, to be expanded by h,
+// as the home directories are those of h, and which therefore must lie under prefix.
+func PrefixHandlers(h Handlers, prefix string) Handlers {
+	prefix = cleanPath(prefix)
+
+	mapPath := func(p string) string {
+		return path.Join(prefix, cleanPath(p))
+	}
+
+	unmapPath := func(p string) (string, bool) {
+		if prefix == "/" {
+			return p, true
+		}
+		if p == prefix {
+			return "/", true
+		}
+		if strings.HasPrefix(p, prefix+"/") {
+			return p[len(prefix):], true
+		}
+		return p, false
+	}
+
+	return decorate(h, &handlerDecorator{
+		around: func(r *Request, call func(*Request) error) error {
+			mapped := r.copy()
+			switch {
+			case r.Method == "Symlink":
+			case r.Method == "ExpandPath" && strings.HasPrefix(r.Filepath, "~"):
+				// the home directories are those of h.
+			default:
+				mapped.Filepath = mapPath(r.Filepath)
+			}
+			switch r.Method {
+			case "Rename", "PosixRename", "Link", "Symlink", "CopyData":
+				mapped.Target = mapPath(r.Target)
+			}
+
+			err := call(mapped)
+
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				if p, ok := unmapPath(pathErr.Path); ok {
+					return &os.PathError{Op: pathErr.Op, Path: p, Err: pathErr.Err}
+				}
+			}
+
+			var linkErr *os.LinkError
+			if errors.As(err, &linkErr) {
+				oldname, _ := unmapPath(linkErr.Old)
+				newname, _ := unmapPath(linkErr.New)
+				return &os.LinkError{Op: linkErr.Op, Old: oldname, New: newname, Err: linkErr.Err}
+			}
+
+			return err
+		},
+		unmapPath: func(p string) (string, error) {
+			if p, ok := unmapPath(path.Clean(p)); ok {
+				return p, nil
+			}
+			return "", ErrSSHFxPermissionDenied
+		},
+	})
+}
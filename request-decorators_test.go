@@ -0,0 +1,232 @@
+package sftp
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixHandlers(t *testing.T) {
+	handlers := InMemHandler()
+
+	outer := clientRequestServerPairWithHandlers(t, handlers)
+	defer outer.Close()
+	require.NoError(t, outer.cli.Mkdir("/jail"))
+	_, err := putTestFile(outer.cli, "/secret", "outside")
+	require.NoError(t, err)
+
+	p := clientRequestServerPairWithHandlers(t, PrefixHandlers(handlers, "/jail"))
+	defer p.Close()
+
+	_, err = putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+	_, err = putTestFile(p.cli, "../../escape", "hello")
+	require.NoError(t, err)
+
+	fi, err := outer.cli.Stat("/jail/foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+	_, err = outer.cli.Stat("/jail/escape")
+	require.NoError(t, err)
+
+	_, err = p.cli.Stat("/secret")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, p.cli.Rename("/foo", "/bar"))
+	require.NoError(t, p.cli.PosixRename("/bar", "/baz"))
+	_, err = outer.cli.Stat("/jail/baz")
+	require.NoError(t, err)
+
+	entries, err := p.cli.ReadDir("/")
+	require.NoError(t, err)
+	var names []string
+	for _, fi := range entries {
+		names = append(names, fi.Name())
+	}
+	assert.ElementsMatch(t, []string{"baz", "escape"}, names)
+}
+
+func TestReadOnlyHandlers(t *testing.T) {
+	handlers := InMemHandler()
+
+	outer := clientRequestServerPairWithHandlers(t, handlers)
+	defer outer.Close()
+	_, err := putTestFile(outer.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	p := clientRequestServerPairWithHandlers(t, ReadOnlyHandlers(handlers))
+	defer p.Close()
+
+	f, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = p.cli.Create("/bar")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	_, err = p.cli.OpenFile("/foo", os.O_RDWR)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.ErrorIs(t, p.cli.Mkdir("/dir"), os.ErrPermission)
+	assert.ErrorIs(t, p.cli.Remove("/foo"), os.ErrPermission)
+	assert.ErrorIs(t, p.cli.Rename("/foo", "/bar"), os.ErrPermission)
+	assert.ErrorIs(t, p.cli.PosixRename("/foo", "/bar"), os.ErrPermission)
+	assert.ErrorIs(t, p.cli.Chmod("/foo", 0o600), os.ErrPermission)
+	assert.ErrorIs(t, p.cli.Symlink("/foo", "/link"), os.ErrPermission)
+
+	_, err = p.cli.Stat("/foo")
+	assert.NoError(t, err)
+}
+
+func TestLoggingHandlers(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	logf := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	p := clientRequestServerPairWithHandlers(t, LoggingHandlers(InMemHandler(), logf))
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+	require.NoError(t, p.cli.Rename("/foo", "/bar"))
+	_, err = p.cli.Lstat("/missing")
+	require.Error(t, err)
+	_, err = p.cli.StatVFS("/")
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, lines, `sftp: Open "/foo": ok`)
+	assert.Contains(t, lines, `sftp: Rename "/foo" "/bar": ok`)
+	assert.Contains(t, lines, `sftp: Lstat "/missing": file does not exist`)
+	assert.Contains(t, lines, `sftp: StatVFS "/": ok`)
+}
+
+func TestDecoratedCopyData(t *testing.T) {
+	handlers := InMemHandler()
+	cmder := &copyDataCmder{FileCmder: handlers.FileCmd}
+	handlers.FileCmd = cmder
+
+	outer := clientRequestServerPairWithHandlers(t, handlers)
+	defer outer.Close()
+	require.NoError(t, outer.cli.Mkdir("/jail"))
+
+	copyData := func(p *csPair) {
+		_, err := putTestFile(p.cli, "/src", "0123456789")
+		require.NoError(t, err)
+
+		src, err := p.cli.Open("/src")
+		require.NoError(t, err)
+		defer src.Close()
+
+		dst, err := p.cli.OpenFile("/dst", os.O_WRONLY|os.O_CREATE)
+		require.NoError(t, err)
+		defer dst.Close()
+
+		require.NoError(t, p.cli.CopyFileRange(src, 2, dst, 0, 4))
+	}
+
+	// the CopyData of the wrapped FileCmder is called, with the paths as it sees them.
+	p := clientRequestServerPairWithHandlers(t, PrefixHandlers(handlers, "/jail"))
+	defer p.Close()
+	copyData(p)
+	assert.Equal(t, 1, cmder.calls)
+	assert.Equal(t, []string{"/jail/src", "/jail/dst"}, cmder.paths)
+
+	f, err := handlers.FileGet.(*root).fetch("/jail/dst")
+	require.NoError(t, err)
+	assert.Equal(t, "2345", string(f.content))
+
+	// without one, the data is copied through the open files.
+	inner := InMemHandler()
+	q := clientRequestServerPairWithHandlers(t, LoggingHandlers(inner, func(string, ...interface{}) {}))
+	defer q.Close()
+	copyData(q)
+
+	f, err = inner.FileGet.(*root).fetch("/dst")
+	require.NoError(t, err)
+	assert.Equal(t, "2345", string(f.content))
+}
+
+// homeExpandLister expands "~" to /jail/home, and "~user" to /home/user.
+type homeExpandLister struct {
+	FileLister
+}
+
+func (homeExpandLister) ExpandPath(p string) (string, error) {
+	switch {
+	case p == "~":
+		return "/jail/home", nil
+	case strings.HasPrefix(p, "~"):
+		return "/home/" + p[1:], nil
+	}
+	return path.Clean(p), nil
+}
+
+func TestDecoratedExpandPath(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileList = homeExpandLister{handlers.FileList}
+
+	p := clientRequestServerPairWithHandlers(t, PrefixHandlers(handlers, "/jail"))
+	defer p.Close()
+
+	expanded, err := p.cli.ExpandPath("~")
+	require.NoError(t, err)
+	assert.Equal(t, "/home", expanded)
+
+	expanded, err = p.cli.ExpandPath("/foo/../bar")
+	require.NoError(t, err)
+	assert.Equal(t, "/bar", expanded)
+
+	_, err = p.cli.ExpandPath("~bob")
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	// without an ExpandPath, the RequestServer expands "~" to its start directory.
+	q := clientRequestServerPairWithHandlers(t, LoggingHandlers(InMemHandler(), func(string, ...interface{}) {}), WithStartDirectory("/home/user"))
+	defer q.Close()
+
+	expanded, err = q.cli.ExpandPath("~/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user/foo", expanded)
+}
+
+func TestDecoratedGeneration(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileList = generationLister{handlers.FileList, map[string]string{"/jail/dir": "1"}}
+
+	p := clientRequestServerPairWithHandlers(t, PrefixHandlers(handlers, "/jail"))
+	defer p.Close()
+
+	token, err := p.cli.Generation("/dir")
+	require.NoError(t, err)
+	assert.Equal(t, "1", token)
+	assert.ErrorIs(t, p.cli.CheckGeneration("/dir", "0"), ErrGenerationChanged)
+
+	q := clientRequestServerPairWithHandlers(t, ReadOnlyHandlers(InMemHandler()))
+	defer q.Close()
+
+	_, err = q.cli.Generation("/")
+	assert.ErrorIs(t, err, ErrSSHFxOpUnsupported)
+}
+
+func TestDecoratedWorkerPools(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileList = slowStatLister{FileLister: handlers.FileList}
+
+	decorated := LoggingHandlers(ReadOnlyHandlers(handlers), func(string, ...interface{}) {})
+	assert.Equal(t, WorkerPools{MetadataWorkers: 2}, hintedWorkerPools(decorated))
+
+	p := clientRequestServerPairWithHandlers(t, decorated)
+	defer p.Close()
+	assert.Equal(t, 2, p.svr.pktMgr.pools.MetadataWorkers)
+
+	assert.Equal(t, WorkerPools{}, hintedWorkerPools(ReadOnlyHandlers(InMemHandler())))
+}
@@ -15,6 +15,20 @@ const (
 	ErrSSHFxNoConnection     = fxerr(sshFxNoConnection)
 	ErrSSHFxConnectionLost   = fxerr(sshFxConnectionLost)
 	ErrSSHFxOpUnsupported    = fxerr(sshFxOPUnsupported)
+
+	// The codes of later versions of the protocol, such as SSH_FX_QUOTA_EXCEEDED.
+	// The Server and RequestServer send them with the closest code of version 3, and the error message,
+	// unless WithExtendedStatusCodes or WithRSExtendedStatusCodes is set.
+	ErrSSHFxFileAlreadyExists   = fxerr(sshFxFileAlreadyExists)
+	ErrSSHFxWriteProtect        = fxerr(sshFxWriteProtect)
+	ErrSSHFxNoSpaceOnFilesystem = fxerr(sshFxNoSpaceOnFilesystem)
+	ErrSSHFxQuotaExceeded       = fxerr(sshFxQuotaExceeded)
+	ErrSSHFxDirNotEmpty         = fxerr(sshFxDirNotEmpty)
+	ErrSSHFxNotADirectory       = fxerr(sshFxNotADirectory)
+	ErrSSHFxInvalidFilename     = fxerr(sshFxInvalidFilename)
+	ErrSSHFxLinkLoop            = fxerr(sshFxLinkLoop)
+	ErrSSHFxFileIsADirectory    = fxerr(sshFxFileIsADirectory)
+	ErrSSHFxLockConflict        = fxerr(sshFxLockConflict)
 )
 
 // Deprecated error types, these are aliases for the new ones, please use the new ones directly
@@ -48,6 +62,26 @@ func (e fxerr) Error() string {
 		return "connection lost"
 	case ErrSSHFxOpUnsupported:
 		return "operation unsupported"
+	case ErrSSHFxFileAlreadyExists:
+		return "file already exists"
+	case ErrSSHFxWriteProtect:
+		return "write protected"
+	case ErrSSHFxNoSpaceOnFilesystem:
+		return "no space on filesystem"
+	case ErrSSHFxQuotaExceeded:
+		return "quota exceeded"
+	case ErrSSHFxDirNotEmpty:
+		return "directory not empty"
+	case ErrSSHFxNotADirectory:
+		return "not a directory"
+	case ErrSSHFxInvalidFilename:
+		return "invalid filename"
+	case ErrSSHFxLinkLoop:
+		return "too many symbolic links"
+	case ErrSSHFxFileIsADirectory:
+		return "file is a directory"
+	case ErrSSHFxLockConflict:
+		return "file is locked"
 	default:
 		return "failure"
 	}
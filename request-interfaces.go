@@ -71,6 +71,17 @@ type StatVFSFileCmder interface {
 	StatVFS(*Request) (*StatVFS, error)
 }
 
+// CopyDataFileCmder is a FileCmder that implements the CopyData method.
+// If this interface is implemented, copy-data@openssh.com requests will call it
+// with the requests of the open files to copy from and to,
+// to copy length bytes from src, at srcOffset, to dst, at dstOffset, or until the end of src if length is zero,
+// otherwise the data is copied through the io.ReaderAt and io.WriterAt of the open files.
+// The ranges have already been checked not to overlap, if src and dst are the same request.
+type CopyDataFileCmder interface {
+	FileCmder
+	CopyData(src *Request, srcOffset, length int64, dst *Request, dstOffset int64) error
+}
+
 // FileLister should return an object that fulfils the ListerAt interface
 // Note in cases of an error, the error text will be sent to the client.
 // Called for Methods: List, Stat, Readlink
@@ -109,6 +120,26 @@ type RealPathFileLister interface {
 	RealPath(string) (string, error)
 }
 
+// ExpandPathFileLister is a FileLister that implements the ExpandPath method.
+// If this interface is implemented, expand-path@openssh.com requests will call it
+// with the path sent by the client, which may start with "~", or "~user",
+// otherwise "~" is expanded to the start directory of the RequestServer, "~user" is refused,
+// and the path is then canonicalized in the same way as for Realpath.
+// You have to return an absolute POSIX path.
+type ExpandPathFileLister interface {
+	FileLister
+	ExpandPath(string) (string, error)
+}
+
+// GenerationFileLister is a FileLister that implements the Generation method.
+// If this interface is implemented, generation@pkg.sftp requests will call it
+// for the generation token of the directory of the Request, which must change whenever an entry is added, removed, or renamed,
+// otherwise the requests fail as unsupported.
+type GenerationFileLister interface {
+	FileLister
+	Generation(*Request) (string, error)
+}
+
 // ReadlinkFileLister is a FileLister that implements the Readlink method.
 // By implementing the Readlink method, it is possible to return any arbitrary valid path relative or absolute.
 // This allows giving a better response than via the default FileLister (which is limited to os.FileInfo, whose Name method should only return the base name of a file)
@@ -151,6 +182,18 @@ type ListerAt interface {
 	ListAt([]os.FileInfo, int64) (int, error)
 }
 
+// ListerIterator is an optional interface that the ListerAt returned for a "List" request can implement,
+// to stream the entries of a directory, rather than list them by offset.
+// This allows a backend to serve huge directories without holding all their entries in memory.
+//
+// When implemented, ListAt is not called.
+// Instead, NextEntry is called for each entry in turn, and each response to SSH_FXP_READDIR
+// is filled with as many entries as fit within the maximum packet size, see WithRSMaxTxPacket.
+type ListerIterator interface {
+	// NextEntry returns the next entry of the directory, or io.EOF once there are no more.
+	NextEntry() (os.FileInfo, error)
+}
+
 // TransferError is an optional interface that readerAt and writerAt
 // can implement to be notified about the error causing Serve() to exit
 // with the request still open
@@ -0,0 +1,111 @@
+package sftp
+
+import (
+	"sync"
+	"time"
+)
+
+// loggedRequest describes a request for a requestLogger.
+// It holds the length of the file data of a write, but never the data itself.
+type loggedRequest struct {
+	id     uint32
+	op     string
+	path   string
+	handle string
+	bytes  int
+}
+
+// requestLogger logs the requests of a Client, or of a server, and their responses, see WithLogger.
+// Its methods are called concurrently.
+type requestLogger interface {
+	logRequest(req loggedRequest)
+
+	// logResponse logs the response to req, received or sent latency after the request,
+	// with the length of its file data, if any, and its status, which is SSH_FX_OK for a response other than a status.
+	logResponse(req loggedRequest, latency time.Duration, bytes int, code uint32, msg string)
+}
+
+// describeRequest returns the description of the request p, of the name op, to log,
+// which is either the form the Client sends, or the form a server receives.
+func describeRequest(p interface{}, op string) loggedRequest {
+	req := loggedRequest{op: op}
+
+	if p, ok := p.(interface{ id() uint32 }); ok {
+		req.id = p.id()
+	}
+
+	if epkt, ok := p.(*sshFxpExtendedPacket); ok && epkt.SpecificPacket != nil {
+		p = epkt.SpecificPacket
+	}
+
+	if paths := packetPaths(p); len(paths) > 0 {
+		req.path = *paths[0]
+	} else if p, ok := p.(interface{ getPath() string }); ok {
+		req.path = p.getPath()
+	}
+	if p, ok := p.(interface{ getHandle() string }); ok {
+		req.handle = p.getHandle()
+	}
+
+	switch p := p.(type) {
+	case *sshFxpWritePacket:
+		req.bytes = len(p.Data)
+	case *sshFxpWriteBatchPacket:
+		req.bytes = len(p.Data)
+	}
+
+	return req
+}
+
+// serverRequestLog keeps the requests a server has received, and not yet answered, for logging.
+type serverRequestLog struct {
+	logger requestLogger
+
+	mu       sync.Mutex
+	received map[uint32]pendingRequest
+}
+
+func newServerRequestLog(logger requestLogger) *serverRequestLog {
+	return &serverRequestLog{
+		logger:   logger,
+		received: make(map[uint32]pendingRequest),
+	}
+}
+
+// request logs the request p, as it is received.
+func (l *serverRequestLog) request(p requestPacket) {
+	op := requestOp(p)
+	req := pendingRequest{
+		op:     op,
+		sent:   time.Now(),
+		logged: describeRequest(p, op),
+	}
+	l.logger.logRequest(req.logged)
+
+	l.mu.Lock()
+	l.received[p.id()] = req
+	l.mu.Unlock()
+}
+
+// response logs the response resp to the request of the id, as it is sent.
+func (l *serverRequestLog) response(id uint32, resp responsePacket) {
+	l.mu.Lock()
+	req, ok := l.received[id]
+	delete(l.received, id)
+	l.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	var bytes int
+	code, msg := uint32(sshFxOk), ""
+	switch resp := resp.(type) {
+	case *sshFxpStatusPacket:
+		code, msg = resp.StatusError.Code, resp.StatusError.msg
+	case *sshFxpDataPacket:
+		bytes = int(resp.Length)
+	}
+
+	l.logger.logResponse(req.logged, time.Since(req.sent), bytes, code, msg)
+}
@@ -29,6 +29,16 @@ type RequestServer struct {
 
 	startDirectory string
 	maxTxPacket    uint32
+	pathPolicy     *PathPolicy
+	filenamePolicy *FilenamePolicy
+	advert         advertisement
+	createHook     func(path string, how FileCreation)
+	openHook       func(path string, req *OpenRequest) error
+	symlinkHook    func(link, target string) (string, error)
+	maxFileSize    int64
+	rateLimits     rateLimits
+	panicPolicy    *PanicPolicy
+	panics         int // recovered so far, see PanicPolicy.MaxPanics
 
 	mu           sync.RWMutex
 	handleCount  int
@@ -74,6 +84,14 @@ func WithRSMaxTxPacket(size uint32) RequestServerOption {
 	}
 }
 
+// WithRSCapture records every SFTP frame sent and received by the RequestServer to the given CaptureWriter.
+// This is intended for debugging, see CaptureWriter for details of the format.
+func WithRSCapture(cw *CaptureWriter) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.conn.capture = cw
+	}
+}
+
 // NewRequestServer creates/allocates/returns new RequestServer.
 // Normally there will be one server per user-session.
 func NewRequestServer(rwc io.ReadWriteCloser, h Handlers, options ...RequestServerOption) *RequestServer {
@@ -141,7 +159,7 @@ func (rs *RequestServer) closeRequest(handle string) error {
 }
 
 // Close the read/write/closer to trigger exiting the main server loop
-func (rs *RequestServer) Close() error { return rs.conn.Close() }
+func (rs *RequestServer) Close() error { return rs.serverConn.Close() }
 
 func (rs *RequestServer) serveLoop(pktChan chan<- orderedRequest) error {
 	defer close(pktChan) // shuts down sftpServerWorkers
@@ -170,19 +188,40 @@ func (rs *RequestServer) serveLoop(pktChan chan<- orderedRequest) error {
 			}
 		}
 
+		if init, ok := pkt.(*sshFxInitPacket); ok {
+			if err := rs.advert.checkInit(init); err != nil {
+				rs.refuseInit(err)
+				return err
+			}
+		}
+
 		pktChan <- rs.pktMgr.newOrderedRequest(pkt)
 	}
 }
 
 // Serve requests for user session
 func (rs *RequestServer) Serve() error {
+	return rs.ServeContext(context.Background())
+}
+
+// ServeContext is Serve, with the contexts of the requests derived from ctx,
+// so that the Handlers can find values of the session in the Context of each Request,
+// such as the SessionInfo of the connection, see ContextWithSession.
+//
+// The contexts of the requests are cancelled once ctx is done,
+// but the RequestServer carries on serving until the streams stop, or it is closed.
+func (rs *RequestServer) ServeContext(ctx context.Context) error {
 	defer func() {
 		if rs.pktMgr.alloc != nil {
 			rs.pktMgr.alloc.Free()
 		}
 	}()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	if rs.pktMgr.stats != nil {
+		rs.pktMgr.stats.begin()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -195,12 +234,17 @@ func (rs *RequestServer) Serve() error {
 			}
 		}()
 	}
+	rs.pktMgr.pools = rs.pktMgr.pools.or(hintedWorkerPools(rs.Handlers))
 	pktChan := rs.pktMgr.workerChan(runWorker)
 
 	err := rs.serveLoop(pktChan)
 
 	wg.Wait() // wait for all workers to exit
 
+	if rs.pktMgr.stats != nil {
+		defer rs.pktMgr.stats.end(rs.serverConn, err)
+	}
+
 	rs.mu.Lock()
 	defer rs.mu.Unlock()
 
@@ -223,108 +267,228 @@ func (rs *RequestServer) packetWorker(ctx context.Context, pktChan chan orderedR
 	for pkt := range pktChan {
 		orderID := pkt.orderID()
 		if epkt, ok := pkt.requestPacket.(*sshFxpExtendedPacket); ok {
-			if epkt.SpecificPacket != nil {
+			if epkt.SpecificPacket != nil && !rs.advert.disabled(epkt.ExtendedRequest) {
 				pkt.requestPacket = epkt.SpecificPacket
 			}
 		}
 
-		var rpkt responsePacket
-		switch pkt := pkt.requestPacket.(type) {
-		case *sshFxInitPacket:
-			rpkt = &sshFxVersionPacket{Version: sftpProtocolVersion, Extensions: sftpExtensions}
-		case *sshFxpClosePacket:
-			handle := pkt.getHandle()
-			rpkt = statusFromError(pkt.ID, rs.closeRequest(handle))
-		case *sshFxpRealpathPacket:
-			var realPath string
-			var err error
-
-			switch pather := rs.Handlers.FileList.(type) {
-			case RealPathFileLister:
-				realPath, err = pather.RealPath(pkt.getPath())
-			case legacyRealPathFileLister:
-				realPath = pather.RealPath(pkt.getPath())
-			default:
-				realPath = cleanPathWithBase(rs.startDirectory, pkt.getPath())
-			}
-			if err != nil {
-				rpkt = statusFromError(pkt.ID, err)
-			} else {
-				rpkt = cleanPacketPath(pkt, realPath)
+		if rs.pktMgr.start(pkt.requestPacket) {
+			rs.pktMgr.readyResponse(pkt.requestPacket, statusFromError(pkt.id(), errRequestCancelled), orderID)
+			continue
+		}
+
+		if rs.pathPolicy != nil {
+			if err := rs.pathPolicy.apply(pkt.requestPacket); err != nil {
+				rs.pktMgr.readyResponse(pkt.requestPacket, statusFromError(pkt.id(), err), orderID)
+				continue
 			}
-		case *sshFxpOpendirPacket:
-			request := requestFromPacket(ctx, pkt, rs.startDirectory)
-			handle := rs.nextRequest(request)
-			rpkt = request.opendir(rs.Handlers, pkt)
-			if _, ok := rpkt.(*sshFxpHandlePacket); !ok {
-				// if we return an error we have to remove the handle from the active ones
-				rs.closeRequest(handle)
+		}
+
+		if rs.filenamePolicy != nil {
+			if err := rs.filenamePolicy.apply(pkt.requestPacket); err != nil {
+				rs.pktMgr.readyResponse(pkt.requestPacket, statusFromError(pkt.id(), err), orderID)
+				continue
 			}
-		case *sshFxpOpenPacket:
-			request := requestFromPacket(ctx, pkt, rs.startDirectory)
-			handle := rs.nextRequest(request)
-			rpkt = request.open(rs.Handlers, pkt)
-			if _, ok := rpkt.(*sshFxpHandlePacket); !ok {
-				// if we return an error we have to remove the handle from the active ones
-				rs.closeRequest(handle)
+		}
+
+		if rs.maxFileSize > 0 {
+			if err := checkFileSize(pkt.requestPacket, rs.maxFileSize); err != nil {
+				rs.pktMgr.readyResponse(pkt.requestPacket, rs.batches.refuse(pkt.requestPacket, err), orderID)
+				continue
 			}
-		case *sshFxpFstatPacket:
-			handle := pkt.getHandle()
-			request, ok := rs.getRequest(handle)
-			if !ok {
-				rpkt = statusFromError(pkt.ID, EBADF)
-			} else {
-				request = &Request{
-					Method:   "Stat",
-					Filepath: cleanPathWithBase(rs.startDirectory, request.Filepath),
-				}
-				rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
+		}
+
+		if err := rs.rateLimits.wait(ctx, pkt.requestPacket); err != nil {
+			rs.pktMgr.readyResponse(pkt.requestPacket, rs.batches.refuse(pkt.requestPacket, err), orderID)
+			continue
+		}
+
+		rpkt := rs.handlePacketRecover(ctx, pkt.requestPacket, orderID)
+		rs.pktMgr.readyResponse(pkt.requestPacket, rpkt, orderID)
+	}
+	return nil
+}
+
+// handlePacket handles the request p, which the checks of packetWorker have let through, and returns its response.
+func (rs *RequestServer) handlePacket(ctx context.Context, p requestPacket, orderID uint32) responsePacket {
+	if pkt, ok := p.(*sshFxpSymlinkPacket); ok && rs.symlinkHook != nil {
+		if err := applySymlinkHook(rs.symlinkHook, cleanPathWithBase(rs.startDirectory, pkt.Linkpath), pkt); err != nil {
+			return statusFromError(pkt.ID, err)
+		}
+	}
+
+	var rpkt responsePacket
+	switch pkt := p.(type) {
+	case *sshFxInitPacket:
+		rs.recordInit(pkt)
+		rpkt = rs.advert.versionPacket()
+	case *sshFxpClosePacket:
+		handle := pkt.getHandle()
+		rpkt = rs.batches.settle(handle, statusFromError(pkt.ID, rs.closeRequest(handle)))
+	case *sshFxpRealpathPacket:
+		realPath, err := rs.realPath(pkt.getPath())
+		if err != nil {
+			rpkt = statusFromError(pkt.ID, err)
+		} else {
+			rpkt = cleanPacketPath(pkt, realPath)
+		}
+	case *sshFxpOpendirPacket:
+		request := requestFromPacket(ctx, pkt, rs.startDirectory)
+		handle := rs.nextRequest(request)
+		rpkt = request.opendir(rs.Handlers, pkt)
+		if _, ok := rpkt.(*sshFxpHandlePacket); !ok {
+			// if we return an error we have to remove the handle from the active ones
+			rs.closeRequest(handle)
+		}
+	case *sshFxpOpenPacket:
+		if rs.openHook != nil {
+			if err := applyOpenHook(rs.openHook, cleanPathWithBase(rs.startDirectory, pkt.getPath()), pkt); err != nil {
+				rpkt = statusFromError(pkt.ID, err)
+				break
 			}
-		case *sshFxpFsetstatPacket:
-			handle := pkt.getHandle()
-			request, ok := rs.getRequest(handle)
-			if !ok {
-				rpkt = statusFromError(pkt.ID, EBADF)
-			} else {
-				request = &Request{
-					Method:   "Setstat",
-					Filepath: cleanPathWithBase(rs.startDirectory, request.Filepath),
-				}
-				rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
+		}
+
+		request := requestFromPacket(ctx, pkt, rs.startDirectory)
+		handle := rs.nextRequest(request)
+
+		var existed bool
+		if rs.createHook != nil {
+			stat := &Request{Method: "Stat", Filepath: request.Filepath}
+			_, existed = filestat(rs.Handlers.FileList, stat, pkt).(*sshFxpStatResponse)
+		}
+
+		rpkt = request.open(rs.Handlers, pkt)
+		if _, ok := rpkt.(*sshFxpHandlePacket); !ok {
+			// if we return an error we have to remove the handle from the active ones
+			rs.closeRequest(handle)
+		} else if rs.createHook != nil {
+			if how, ok := creation(pkt.Pflags, existed); ok {
+				rs.createHook(request.Filepath, how)
 			}
-		case *sshFxpExtendedPacketPosixRename:
-			request := &Request{
-				Method:   "PosixRename",
-				Filepath: cleanPathWithBase(rs.startDirectory, pkt.Oldpath),
-				Target:   cleanPathWithBase(rs.startDirectory, pkt.Newpath),
+		}
+	case *sshFxpFstatPacket:
+		handle := pkt.getHandle()
+		request, ok := rs.getRequest(handle)
+		if !ok {
+			rpkt = statusFromError(pkt.ID, EBADF)
+		} else {
+			request = &Request{
+				Method:   "Stat",
+				Filepath: cleanPathWithBase(rs.startDirectory, request.Filepath),
 			}
 			rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
-		case *sshFxpExtendedPacketStatVFS:
-			request := &Request{
-				Method:   "StatVFS",
-				Filepath: cleanPathWithBase(rs.startDirectory, pkt.Path),
+		}
+	case *sshFxpFsetstatPacket:
+		handle := pkt.getHandle()
+		request, ok := rs.getRequest(handle)
+		if !ok {
+			rpkt = statusFromError(pkt.ID, EBADF)
+		} else {
+			request = &Request{
+				Method:   "Setstat",
+				Filepath: cleanPathWithBase(rs.startDirectory, request.Filepath),
 			}
 			rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
-		case hasHandle:
-			handle := pkt.getHandle()
-			request, ok := rs.getRequest(handle)
-			if !ok {
-				rpkt = statusFromError(pkt.id(), EBADF)
-			} else {
-				rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
+		}
+	case *sshFxpExtendedPacketPosixRename:
+		request := &Request{
+			Method:   "PosixRename",
+			Filepath: cleanPathWithBase(rs.startDirectory, pkt.Oldpath),
+			Target:   cleanPathWithBase(rs.startDirectory, pkt.Newpath),
+		}
+		rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
+	case *sshFxpExtendedPacketLimits:
+		rpkt = newLimitsResponse(pkt.ID, rs.maxTxPacket)
+	case *sshFxpExtendedPacketCopyData:
+		rpkt = statusFromError(pkt.ID, rs.copyData(pkt))
+	case *sshFxpExtendedPacketCopyFile:
+		rpkt = statusFromError(pkt.ID, rs.copyFile(ctx, pkt))
+	case *sshFxpExtendedPacketCheckFile:
+		r, closeFile, err := rs.checkFileReaderAt(ctx, pkt)
+		if err != nil {
+			rpkt = statusFromError(pkt.ID, err)
+		} else {
+			rpkt = checkFile(r, pkt, int(rs.maxTxPacket))
+			closeFile()
+		}
+	case *sshFxpExtendedPacketExpandPath:
+		expanded, err := rs.expandPath(pkt.Path)
+		if err != nil {
+			rpkt = statusFromError(pkt.ID, err)
+		} else {
+			rpkt = cleanPacketPath(&sshFxpRealpathPacket{ID: pkt.ID}, expanded)
+		}
+	case *sshFxpExtendedPacketGeneration:
+		token, err := rs.generation(ctx, pkt.Path)
+		rpkt = generationResponse(pkt, token, err)
+	case *sshFxpExtendedPacketPing:
+		rpkt = statusFromError(pkt.ID, nil)
+	case *sshFxpExtendedPacketVersionSelect:
+		rpkt = statusFromError(pkt.ID, selectVersion(pkt.Version))
+	case *sshFxpExtendedPacketCancel:
+		// The cancellation itself is recorded by the packetManager, as soon as the request is received.
+		rpkt = statusFromError(pkt.ID, nil)
+	case *sshFxpExtendedPacketWriteBatch:
+		// Only a status may be kept for the acknowledgement,
+		// so handles opened only for reading are refused here, rather than by the FileReader.
+		status := statusFromError(pkt.ID, EBADF)
+		if request, ok := rs.getRequest(pkt.Handle); ok && request.Method != "Get" {
+			if resp, ok := request.call(rs.Handlers, pkt.writePacket(), nil, orderID, rs.maxTxPacket).(*sshFxpStatusPacket); ok {
+				status = resp
 			}
-		case hasPath:
-			request := requestFromPacket(ctx, pkt, rs.startDirectory)
+		}
+		rpkt = rs.batches.complete(pkt, status)
+	case *sshFxpExtendedPacketStatVFS:
+		request := &Request{
+			Method:   "StatVFS",
+			Filepath: cleanPathWithBase(rs.startDirectory, pkt.Path),
+		}
+		rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
+	case hasHandle:
+		handle := pkt.getHandle()
+		request, ok := rs.getRequest(handle)
+		if !ok {
+			rpkt = statusFromError(pkt.id(), EBADF)
+		} else {
 			rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
-			request.close()
-		default:
-			rpkt = statusFromError(pkt.id(), ErrSSHFxOpUnsupported)
 		}
+	case hasPath:
+		request := requestFromPacket(ctx, pkt, rs.startDirectory)
+		rpkt = request.call(rs.Handlers, pkt, rs.pktMgr.alloc, orderID, rs.maxTxPacket)
+		request.close()
+	default:
+		rpkt = statusFromError(pkt.id(), ErrSSHFxOpUnsupported)
+	}
+
+	return rpkt
+}
 
-		rs.pktMgr.readyPacket(
-			rs.pktMgr.newOrderedResponse(rpkt, orderID))
+// realPath canonicalizes p, with the RealPath of the FileLister, if it has one.
+func (rs *RequestServer) realPath(p string) (string, error) {
+	switch pather := rs.Handlers.FileList.(type) {
+	case RealPathFileLister:
+		return pather.RealPath(p)
+	case legacyRealPathFileLister:
+		return pather.RealPath(p), nil
 	}
-	return nil
+	return cleanPathWithBase(rs.startDirectory, p), nil
+}
+
+// expandPath expands p, with the ExpandPath of the FileLister, if it has one.
+// Otherwise, "~" stands for the start directory, as the home directory of the user,
+// and the expanded path is canonicalized by realPath.
+func (rs *RequestServer) expandPath(p string) (string, error) {
+	if expander, ok := rs.Handlers.FileList.(ExpandPathFileLister); ok {
+		return expander.ExpandPath(p)
+	}
+
+	if name, rest, ok := splitTildePath(p); ok {
+		if name != "" {
+			return "", ErrSSHFxOpUnsupported
+		}
+		p = path.Join(rs.startDirectory, rest)
+	}
+	return rs.realPath(p)
 }
 
 // clean and return name packet for file
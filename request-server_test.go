@@ -1,14 +1,19 @@
 package sftp
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"os"
 	"path"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -407,6 +412,17 @@ func TestRequestRename(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte("goodbye"), content)
 
+	// without the extension advertised, PosixRename does not fall back to a plain rename.
+	ext := p.cli.ext
+	p.cli.ext = map[string]string{}
+	err = p.cli.PosixRename("/bar", "/baz")
+	assert.ErrorIs(t, err, ErrSSHFxOpUnsupported)
+	p.cli.ext = ext
+
+	content, err = getTestFile(p.cli, "/baz")
+	require.NoError(t, err)
+	require.Equal(t, []byte("goodbye"), content)
+
 	// posix-rename@openssh.com extension allows overwriting existing files.
 	err = p.cli.PosixRename("/bar", "/baz")
 	require.NoError(t, err)
@@ -525,6 +541,35 @@ func TestRequestStatFail(t *testing.T) {
 	checkRequestServerAllocator(t, p)
 }
 
+func TestRequestExists(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+	require.NoError(t, p.cli.Mkdir("/dir"))
+	require.NoError(t, p.cli.Symlink("/missing", "/dangling"))
+
+	for _, tt := range []struct {
+		path   string
+		exists bool
+		isDir  bool
+	}{
+		{"/foo", true, false},
+		{"/dir", true, true},
+		{"/missing", false, false},
+		{"/dangling", false, false},
+	} {
+		exists, err := p.cli.Exists(tt.path)
+		require.NoError(t, err, tt.path)
+		assert.Equal(t, tt.exists, exists, tt.path)
+
+		isDir, err := p.cli.IsDir(tt.path)
+		require.NoError(t, err, tt.path)
+		assert.Equal(t, tt.isDir, isDir, tt.path)
+	}
+	checkRequestServerAllocator(t, p)
+}
+
 func TestRequestLstat(t *testing.T) {
 	p := clientRequestServerPair(t)
 	defer p.Close()
@@ -798,6 +843,365 @@ func TestRequestReaddir(t *testing.T) {
 	checkRequestServerAllocator(t, p)
 }
 
+func TestRequestHandleTypeMismatch(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	f, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	dh, err := p.cli.opendir(context.Background(), "/")
+	require.NoError(t, err)
+	defer p.cli.close(dh)
+
+	expectHandleMisuse(t, p.cli, &sshFxpReaddirPacket{ID: p.cli.nextID(), Handle: f.handle}, errHandleNotDir)
+	expectHandleMisuse(t, p.cli, &sshFxpReadPacket{ID: p.cli.nextID(), Handle: dh, Len: 1024}, errHandleIsDir)
+	expectHandleMisuse(t, p.cli, &sshFxpWritePacket{ID: p.cli.nextID(), Handle: dh, Length: 1, Data: []byte("x")}, errHandleIsDir)
+}
+
+func TestRequestPing(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	_, err := p.cli.Ping(context.Background())
+	require.NoError(t, err)
+	checkRequestServerAllocator(t, p)
+}
+
+func TestRequestConvertWindowsPaths(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	require.NoError(t, ConvertWindowsPaths(nil)(p.cli))
+
+	require.NoError(t, p.cli.Mkdir(`C:\foo`))
+	_, err := putTestFile(p.cli, `\foo\bar`, "hello")
+	require.NoError(t, err)
+
+	require.NoError(t, p.cli.Rename(`\foo\bar`, `D:\foo\baz`))
+
+	fi, err := p.cli.Stat("/foo/baz")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+}
+
+func TestRequestSpecEdgeCases(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+	require.NoError(t, p.cli.Mkdir("/dir"))
+
+	// REALPATH of the empty path is the current directory.
+	rpath, err := p.cli.RealPath("")
+	require.NoError(t, err)
+	assert.Equal(t, "/", rpath)
+
+	// a trailing slash requires a directory.
+	_, err = p.cli.Stat("/foo/")
+	assert.Equal(t, &StatusError{Code: sshFxFailure, msg: "stat /foo: not a directory"}, err)
+	_, err = p.cli.Lstat("/foo/")
+	assert.Error(t, err)
+	fi, err := p.cli.Stat("/dir/")
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+
+	// renaming onto itself succeeds, as long as the file exists.
+	assert.NoError(t, p.cli.Rename("/foo", "/foo"))
+	assert.Equal(t, os.ErrNotExist, p.cli.Rename("/bar", "/bar"))
+
+	content, err := getTestFile(p.cli, "/foo")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), content)
+}
+
+func TestRequestClientCompat(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	require.NoError(t, WithClientCompat(ClientCompat{
+		SymlinkSpecOrder: true,
+		RealPathDot:      true,
+		RenameToSelf:     true,
+	})(p.cli))
+
+	rpath, err := p.cli.RealPath("")
+	require.NoError(t, err)
+	assert.Equal(t, "/", rpath)
+
+	// This server expects the OpenSSH order,
+	// so the specification order creates the link the other way around.
+	require.NoError(t, p.cli.Symlink("/target", "/link"))
+	target, err := p.cli.ReadLink("/target")
+	require.NoError(t, err)
+	assert.Equal(t, "/link", target)
+
+	assert.Equal(t, os.ErrNotExist, p.cli.Rename("/bar", "/bar"))
+}
+
+// okAtEOFReader serves the same content for every file,
+// answering reads past the end with SSH_FX_OK instead of SSH_FX_EOF, as some servers do.
+type okAtEOFReader []byte
+
+func (r okAtEOFReader) Fileread(*Request) (io.ReaderAt, error) { return r, nil }
+
+func (r okAtEOFReader) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(r)) {
+		return 0, ErrSSHFxOk
+	}
+	return copy(b, r[off:]), nil
+}
+
+func TestRequestReadOKAsEOF(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileGet = okAtEOFReader("hello")
+
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	f, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = ioutil.ReadAll(f)
+	assert.Equal(t, &StatusError{Code: sshFxOk, msg: "OK"}, err)
+
+	require.NoError(t, WithClientCompat(ClientCompat{ReadOKAsEOF: true})(p.cli))
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", buf.String())
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+}
+
+// setstatRecorder records the attributes of the last SSH_FXP_SETSTAT request.
+type setstatRecorder struct {
+	FileCmder
+	last *FileStat
+}
+
+func (s *setstatRecorder) Filecmd(r *Request) error {
+	if r.Method == "Setstat" {
+		s.last = r.Attributes()
+	}
+	return s.FileCmder.Filecmd(r)
+}
+
+func TestRequestWindowsAttributes(t *testing.T) {
+	handlers := InMemHandler()
+	recorder := &setstatRecorder{FileCmder: handlers.FileCmd}
+	handlers.FileCmd = recorder
+
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	require.NoError(t, p.cli.SetWindowsAttributes("/foo", WindowsAttrHidden|WindowsAttrSystem))
+	require.NotNil(t, recorder.last)
+
+	attrs, ok := recorder.last.WindowsAttributes()
+	assert.True(t, ok)
+	assert.Equal(t, WindowsAttrHidden|WindowsAttrSystem, attrs)
+}
+
+func TestRequestSessionEndHook(t *testing.T) {
+	summaries := make(chan *SessionSummary, 1)
+
+	p := clientRequestServerPair(t, WithRSSessionEndHook(func(summary *SessionSummary) {
+		summaries <- summary
+	}))
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	_, err = getTestFile(p.cli, "/foo")
+	require.NoError(t, err)
+
+	_, err = p.cli.ReadDir("/")
+	require.NoError(t, err)
+
+	_, err = p.cli.Stat("/missing")
+	require.Error(t, err)
+
+	require.NoError(t, p.cli.Close())
+	<-p.svrResult
+
+	summary := <-summaries
+	assert.Equal(t, SessionEndEOF, summary.Reason)
+	assert.Equal(t, int64(2), summary.FilesOpened)
+	assert.Equal(t, int64(5), summary.BytesRead)
+	assert.Equal(t, int64(5), summary.BytesWritten)
+	assert.Equal(t, int64(1), summary.Errors)
+	assert.False(t, summary.End.Before(summary.Start))
+}
+
+// mkdirDenier refuses to create the directory at a single path.
+type mkdirDenier struct {
+	FileCmder
+	path string
+}
+
+func (d *mkdirDenier) Filecmd(r *Request) error {
+	if r.Method == "Mkdir" && r.Filepath == d.path {
+		return ErrSSHFxPermissionDenied
+	}
+	return d.FileCmder.Filecmd(r)
+}
+
+func TestRequestMkdirAllWithOptions(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileCmd = &mkdirDenier{FileCmder: handlers.FileCmd, path: "/a/b/c"}
+
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	created, err := p.cli.MkdirAllWithOptions("/x/y/", MkdirAllOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/x", "/x/y"}, created)
+
+	created, err = p.cli.MkdirAllWithOptions("/x/y/z", MkdirAllOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/x/y/z"}, created)
+
+	require.NoError(t, p.cli.Mkdir("/a"))
+
+	// permission denied at depth 3, leaving the directory created at depth 2 in place.
+	created, err = p.cli.MkdirAllWithOptions("/a/b/c/d", MkdirAllOptions{})
+	var merr *MkdirAllError
+	require.True(t, errors.As(err, &merr), err)
+	assert.Equal(t, "/a/b/c", merr.Path)
+	assert.Equal(t, 3, merr.Depth)
+	assert.Equal(t, []string{"/a/b"}, merr.Created)
+	assert.Equal(t, merr.Created, created)
+	assert.True(t, errors.Is(err, os.ErrPermission), err)
+
+	require.NoError(t, p.cli.RemoveDirectory("/a/b"))
+
+	// with cleanup, the directory created at depth 2 is removed again.
+	created, err = p.cli.MkdirAllWithOptions("/a/b/c/d", MkdirAllOptions{RemoveOnError: true})
+	require.True(t, errors.As(err, &merr), err)
+	assert.Empty(t, created)
+	assert.Empty(t, merr.Created)
+
+	_, err = p.cli.Stat("/a/b")
+	assert.True(t, errors.Is(err, os.ErrNotExist), err)
+
+	// a file in the way.
+	_, err = putTestFile(p.cli, "/file", "hello")
+	require.NoError(t, err)
+
+	_, err = p.cli.MkdirAllWithOptions("/file/dir", MkdirAllOptions{})
+	require.True(t, errors.As(err, &merr), err)
+	assert.Equal(t, "/file", merr.Path)
+	assert.Equal(t, 1, merr.Depth)
+}
+
+func TestRequestReadDirStream(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	require.NoError(t, p.cli.Mkdir("/dir"))
+	for i := 0; i < 5; i++ {
+		_, err := putTestFile(p.cli, fmt.Sprintf("/dir/%d", i), "hello")
+		require.NoError(t, err)
+	}
+
+	var names []string
+	err := p.cli.ReadDirStream(context.Background(), "/dir", func(fi os.FileInfo) error {
+		names = append(names, fi.Name())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"0", "1", "2", "3", "4"}, names)
+
+	// an error from the callback stops the listing.
+	errStop := errors.New("stop")
+	var n int
+	err = p.cli.ReadDirStream(context.Background(), "/dir", func(fi os.FileInfo) error {
+		n++
+		return errStop
+	})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, 1, n)
+
+	err = p.cli.ReadDirStream(context.Background(), "/missing", func(fi os.FileInfo) error {
+		return nil
+	})
+	assert.True(t, errors.Is(err, os.ErrNotExist), err)
+}
+
+func TestRequestWithoutExtension(t *testing.T) {
+	p := clientRequestServerPair(t, WithoutRSExtension("posix-rename@openssh.com"))
+	defer p.Close()
+
+	_, ok := p.cli.HasExtension("posix-rename@openssh.com")
+	assert.False(t, ok)
+	_, ok = p.cli.HasExtension("statvfs@openssh.com")
+	assert.True(t, ok)
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	// PosixRename does not send a request the server does not advertise.
+	err = p.cli.PosixRename("/foo", "/bar")
+	assert.ErrorIs(t, err, ErrSSHFxOpUnsupported)
+
+	// the extension is not served either, even if the client sends it regardless.
+	data := marshalString(marshalString(nil, "/foo"), "/bar")
+	_, err = p.cli.Extended(context.Background(), "posix-rename@openssh.com", data)
+	assert.Equal(t, &StatusError{Code: sshFxOPUnsupported, msg: ErrSSHFxOpUnsupported.Error()}, err)
+}
+
+func TestRequestSetMaxInflight(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	_, err := putTestFile(p.cli, "/foo", string(content))
+	require.NoError(t, err)
+
+	f, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// lower the limit partway through the transfer.
+	var buf bytes.Buffer
+	w := writerFunc(func(b []byte) (int, error) {
+		require.NoError(t, p.cli.SetMaxInflight(1))
+		return buf.Write(b)
+	})
+
+	_, err = f.WriteTo(w)
+	require.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+	assert.Equal(t, 1, p.cli.MaxInflight())
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
 type testListerAtCloser struct {
 	isClosed bool
 }
@@ -1019,6 +1423,137 @@ func TestLegacyRealPathFileLister(t *testing.T) {
 	assert.Equal(t, "/relpath", realPath)
 }
 
+func TestRequestRealPaths(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	p.cli.SetMaxInflight(4) // fewer than the paths, so that the window has to slide.
+
+	var paths, want []string
+	for i := 0; i < 20; i++ {
+		paths = append(paths, fmt.Sprintf("dir/../file%d", i))
+		want = append(want, fmt.Sprintf("/file%d", i))
+	}
+
+	resolved, err := p.cli.RealPaths(paths)
+	require.NoError(t, err)
+	assert.Equal(t, want, resolved)
+
+	resolved, err = p.cli.RealPaths(nil)
+	require.NoError(t, err)
+	assert.Empty(t, resolved)
+}
+
+// entryIterator streams n synthetic directory entries through ListerIterator.
+type entryIterator struct {
+	n, next int
+}
+
+func (it *entryIterator) ListAt([]os.FileInfo, int64) (int, error) {
+	return 0, errors.New("ListAt called on a ListerIterator")
+}
+
+func (it *entryIterator) NextEntry() (os.FileInfo, error) {
+	if it.next >= it.n {
+		return nil, io.EOF
+	}
+	it.next++
+	return &memFile{name: fmt.Sprintf("entry-with-a-long-name-to-fill-the-packet-%05d", it.next)}, nil
+}
+
+// iteratingLister lists every directory as n synthetic entries.
+type iteratingLister struct {
+	FileLister
+	n int
+}
+
+func (l *iteratingLister) Filelist(r *Request) (ListerAt, error) {
+	if r.Method == "List" {
+		return &entryIterator{n: l.n}, nil
+	}
+	return l.FileLister.Filelist(r)
+}
+
+func TestRequestListerIterator(t *testing.T) {
+	handlers := InMemHandler()
+	handlers.FileList = &iteratingLister{FileLister: handlers.FileList, n: 3000}
+
+	var buf bytes.Buffer
+	capture, err := NewCaptureWriter(&buf)
+	require.NoError(t, err)
+
+	p := clientRequestServerPairWithHandlers(t, handlers, WithRSCapture(capture))
+	defer p.Close()
+
+	entries, err := p.cli.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 3000)
+	for i, fi := range entries {
+		assert.Equal(t, fmt.Sprintf("entry-with-a-long-name-to-fill-the-packet-%05d", i+1), fi.Name())
+	}
+
+	var sizes []int
+	for _, rec := range readCapture(t, &buf) {
+		if rec.Direction == CaptureSent && rec.Frame[4] == sshFxpName {
+			sizes = append(sizes, len(rec.Frame)-13) // length, type, id, and count
+		}
+	}
+	require.Less(t, len(sizes), 3000/int(MaxFilelist))
+
+	// every response but the last is filled up to, but not beyond, the maximum packet size.
+	for _, size := range sizes[:len(sizes)-1] {
+		assert.LessOrEqual(t, size, 32768)
+		assert.Greater(t, size, 32768-512)
+	}
+}
+
+type fileCreation struct {
+	path string
+	how  FileCreation
+}
+
+func TestRequestZeroByteUpload(t *testing.T) {
+	var created []fileCreation
+	p := clientRequestServerPair(t, WithRSCreateHook(func(path string, how FileCreation) {
+		created = append(created, fileCreation{path, how})
+	}))
+	defer p.Close()
+
+	// OPEN and CLOSE, without any WRITE, creates an empty file.
+	f, err := p.cli.Create("/empty")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fi, err := p.cli.Stat("/empty")
+	require.NoError(t, err)
+	assert.Zero(t, fi.Size())
+
+	_, err = putTestFile(p.cli, "/full", "hello")
+	require.NoError(t, err)
+
+	f, err = p.cli.Create("/full")
+	require.NoError(t, err)
+	n, err := f.Write(nil) // a zero-byte WRITE is accepted.
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.NoError(t, f.Close())
+
+	fi, err = p.cli.Stat("/full")
+	require.NoError(t, err)
+	assert.Zero(t, fi.Size())
+
+	// opening an existing file without truncating it is neither.
+	f, err = p.cli.OpenFile("/full", os.O_WRONLY)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []fileCreation{
+		{"/empty", FileCreated},
+		{"/full", FileCreated},
+		{"/full", FileTruncated},
+	}, created)
+}
+
 func TestCleanPath(t *testing.T) {
 	assert.Equal(t, "/", cleanPath("/"))
 	assert.Equal(t, "/", cleanPath("."))
@@ -1045,3 +1580,409 @@ func TestCleanPath(t *testing.T) {
 		cleanPath(bslash+"a"+bslash+bslash+"b"+bslash+bslash+"c"+bslash))
 	assert.Equal(t, "/C:/a", cleanPath("C:"+bslash+"a"))
 }
+
+func TestRequestFsyncOnClose(t *testing.T) {
+	// The RequestServer does not implement fsync@openssh.com,
+	// so advertising it makes the flush fail, which Close must report.
+	p := clientRequestServerPair(t, WithRSExtension("fsync@openssh.com", "1"))
+	defer p.Close()
+
+	w, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	require.NoError(t, w.Close(), "fsync is not sent by default")
+
+	p.cli.fsyncOnClose = true
+
+	r, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	require.NoError(t, r.Close(), "fsync is not sent for a file opened read-only")
+
+	w, err = p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	var statusErr *StatusError
+	require.ErrorAs(t, w.Close(), &statusErr)
+	assert.Equal(t, uint32(sshFxOPUnsupported), statusErr.Code)
+	assert.ErrorIs(t, w.Close(), os.ErrClosed, "the file is closed despite the error")
+
+	// the flush is skipped for a server that does not advertise the extension.
+	q := clientRequestServerPair(t)
+	defer q.Close()
+	q.cli.fsyncOnClose = true
+
+	w, err = q.cli.Create("/foo")
+	require.NoError(t, err)
+	assert.NoError(t, w.Close())
+}
+
+// blockingStatLister holds every Stat request until release is closed.
+type blockingStatLister struct {
+	FileLister
+	release chan struct{}
+}
+
+func (l *blockingStatLister) Filelist(r *Request) (ListerAt, error) {
+	if r.Method == "Stat" {
+		<-l.release
+	}
+	return l.FileLister.Filelist(r)
+}
+
+func TestRequestClientWithLimits(t *testing.T) {
+	handlers := InMemHandler()
+	lister := &blockingStatLister{FileLister: handlers.FileList, release: make(chan struct{})}
+	handlers.FileList = lister
+
+	var buf bytes.Buffer
+	capture, err := NewCaptureWriter(&buf)
+	require.NoError(t, err)
+
+	p := clientRequestServerPairWithHandlers(t, handlers, WithRSCapture(capture))
+	defer p.Close()
+
+	view := p.cli.WithLimits(2, 1024)
+	assert.Equal(t, 2, view.MaxInflight())
+	require.NoError(t, view.SetMaxInflight(8))
+	assert.Equal(t, 2, view.MaxInflight(), "a view cannot exceed its limit")
+	assert.Equal(t, p.cli.MaxInflight(), p.cli.WithLimits(0, 0).MaxInflight())
+
+	w, err := view.Create("/foo")
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 5000))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := view.Stat("/foo")
+			assert.NoError(t, err)
+		}()
+	}
+
+	// the view holds back all but two of the requests, while the server holds those.
+	require.Eventually(t, func() bool { return p.cli.Stats().InFlight == 2 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int64(2), p.cli.Stats().InFlight)
+
+	close(lister.release)
+	wg.Wait()
+
+	var written int
+	for _, rec := range readCapture(t, &buf) {
+		if rec.Direction == CaptureReceived && rec.Frame[4] == sshFxpWrite {
+			var pkt sshFxpWritePacket
+			require.NoError(t, pkt.UnmarshalBinary(rec.Frame[5:]))
+			assert.LessOrEqual(t, len(pkt.Data), 1024)
+			written += len(pkt.Data)
+		}
+	}
+	assert.Equal(t, 5000, written)
+}
+
+func TestRequestClientWithLimitsCancel(t *testing.T) {
+	handlers := InMemHandler()
+	lister := &blockingStatLister{FileLister: handlers.FileList, release: make(chan struct{})}
+	handlers.FileList = lister
+
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	require.NoError(t, err)
+
+	view := p.cli.WithLimits(1, 0)
+
+	held := make(chan error, 1)
+	go func() {
+		_, err := view.Stat("/foo")
+		held <- err
+	}()
+	require.Eventually(t, func() bool { return len(view.inflightLimit) == 1 }, time.Second, time.Millisecond)
+
+	// a request waiting for the slot of the view gives up once its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = view.StatContext(ctx, "/foo")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(lister.release)
+	assert.NoError(t, <-held)
+
+	// and did not keep a slot.
+	assert.Len(t, view.inflightLimit, 0)
+	_, err = view.Stat("/foo")
+	assert.NoError(t, err)
+}
+
+func TestRequestWriteAckBatching(t *testing.T) {
+	var buf bytes.Buffer
+	capture, err := NewCaptureWriter(&buf)
+	require.NoError(t, err)
+
+	p := clientRequestServerPair(t, WithRSCapture(capture))
+	defer p.Close()
+	p.cli.maxPacket = 1000
+	p.cli.writeAckBatch = 4000
+
+	content := bytes.Repeat([]byte("0123456789"), 1050)
+
+	w, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	n, err := w.ReadFrom(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	require.NoError(t, w.Close())
+
+	f, err := p.testHandler().fetch("/foo")
+	require.NoError(t, err)
+	assert.Equal(t, content, f.content)
+
+	var batched, answered int
+	for _, rec := range readCapture(t, &buf) {
+		switch {
+		case rec.Direction == CaptureReceived && rec.Frame[4] == sshFxpExtended:
+			batched++
+		case rec.Direction == CaptureSent && rec.Frame[4] == sshFxpStatus:
+			answered++
+		}
+	}
+	assert.Equal(t, 12, batched, "11 writes and the final acknowledgement")
+	assert.Equal(t, 2+1+1, answered, "2 batches, the final acknowledgement, and the close")
+
+	// a failed write is reported when its batch is acknowledged.
+	r, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	_, err = r.ReadFrom(bytes.NewReader(content[:2500]))
+	assert.Error(t, err)
+	assert.NoError(t, r.Close())
+}
+
+// quotaWriter drops, without error, whatever is written to the file past quota,
+// either as it is written, or when the file is closed.
+type quotaWriter struct {
+	*memFile
+	quota   int64
+	atClose bool
+}
+
+func (w *quotaWriter) WriteAt(b []byte, off int64) (int, error) {
+	if !w.atClose && off+int64(len(b)) > w.quota {
+		if off < w.quota {
+			w.memFile.WriteAt(b[:w.quota-off], off)
+		}
+		return len(b), nil
+	}
+	return w.memFile.WriteAt(b, off)
+}
+
+func (w *quotaWriter) Close() error {
+	if w.atClose {
+		return w.memFile.Truncate(w.quota)
+	}
+	return nil
+}
+
+type quotaFileWriter struct {
+	FileWriter
+	atClose bool
+}
+
+func (h quotaFileWriter) Filewrite(r *Request) (io.WriterAt, error) {
+	wr, err := h.FileWriter.Filewrite(r)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaWriter{memFile: wr.(*memFile), quota: 10, atClose: h.atClose}, nil
+}
+
+func TestRequestWriteVerification(t *testing.T) {
+	for _, atClose := range []bool{false, true} {
+		handlers := InMemHandler()
+		handlers.FilePut = quotaFileWriter{FileWriter: handlers.FilePut, atClose: atClose}
+
+		p := clientRequestServerPairWithHandlers(t, handlers)
+
+		// without verification, the loss goes unnoticed.
+		w, err := p.cli.Create("/foo")
+		require.NoError(t, err)
+		_, err = w.ReadFrom(bytes.NewReader(make([]byte, 20)))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		p.cli.verifyWrites = true
+
+		// data that fits is fine.
+		w, err = p.cli.Create("/foo")
+		require.NoError(t, err)
+		_, err = w.ReadFrom(bytes.NewReader(make([]byte, 10)))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		w, err = p.cli.Create("/foo")
+		require.NoError(t, err)
+		n, err := w.ReadFrom(bytes.NewReader(make([]byte, 20)))
+		assert.EqualValues(t, 20, n)
+
+		var sizeErr *WriteSizeError
+		if !atClose {
+			require.ErrorAs(t, err, &sizeErr, "ReadFrom checks the size")
+		} else {
+			require.NoError(t, err, "the data is only lost on close")
+			require.ErrorAs(t, w.Close(), &sizeErr, "Close checks the size again")
+		}
+		assert.Equal(t, &WriteSizeError{Path: "/foo", Size: 10, Want: 20}, sizeErr)
+
+		p.Close()
+	}
+}
+
+func TestRequestOpenHook(t *testing.T) {
+	var opened []string
+	p := clientRequestServerPair(t, WithRSOpenHook(func(path string, req *OpenRequest) error {
+		opened = append(opened, path)
+		if path == "/forbidden" {
+			return ErrSSHFxPermissionDenied
+		}
+		req.Flags.Excl = false
+		return nil
+	}))
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		f, err := p.cli.OpenFile("foo", os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	_, err := p.cli.Create("/forbidden")
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	_, err = p.testHandler().fetch("/forbidden")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"/foo", "/foo", "/forbidden"}, opened)
+}
+
+func TestRequestMaxFileSize(t *testing.T) {
+	p := clientRequestServerPair(t, WithRSMaxFileSize(10), WithRSExtendedStatusCodes())
+	defer p.Close()
+
+	isQuotaExceeded := func(err error) bool {
+		var status *StatusError
+		return errors.As(err, &status) && status.FxCode() == ErrSSHFxQuotaExceeded
+	}
+
+	w, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 10))
+	require.NoError(t, err)
+	_, err = w.Write([]byte{0})
+	assert.True(t, isQuotaExceeded(err), err)
+	_, err = w.WriteAt([]byte{0}, math.MaxInt64)
+	assert.True(t, isQuotaExceeded(err), err)
+	require.NoError(t, w.Close())
+
+	assert.NoError(t, p.cli.Truncate("/foo", 5))
+	assert.True(t, isQuotaExceeded(p.cli.Truncate("/foo", 11)))
+
+	// batched writes are refused in the same way, and reported by the acknowledgement.
+	p.cli.writeAckBatch = 4
+	w, err = p.cli.Create("/bar")
+	require.NoError(t, err)
+	_, err = w.ReadFrom(bytes.NewReader(make([]byte, 12)))
+	assert.True(t, isQuotaExceeded(err), err)
+	w.Close()
+
+	f, err := p.testHandler().fetch("/foo")
+	require.NoError(t, err)
+	assert.Equal(t, 5, len(f.content))
+}
+
+func TestRequestChunkSize(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	require.NoError(t, WithReadChunkSize(2500)(p.cli))
+	require.NoError(t, WithWriteChunkSize(1000)(p.cli))
+	assert.Error(t, WithReadChunkSize(0)(p.cli))
+
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+
+	before := p.cli.Stats().Requests
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, p.cli.Stats().Requests-before, "writes of 1000 bytes")
+
+	before = p.cli.Stats().Requests
+	b := make([]byte, len(data))
+	_, err = f.ReadAt(b, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, p.cli.Stats().Requests-before, "reads of 2500 bytes")
+	assert.Equal(t, data, b)
+
+	// the chunks are still limited by the maximum packet size.
+	require.NoError(t, WithWriteChunkSize(1<<20)(p.cli))
+	assert.Equal(t, p.cli.maxPacket, p.cli.writeChunkSize())
+
+	require.NoError(t, f.Close())
+}
+
+func TestRequestFileProgress(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	data := make([]byte, 100000)
+
+	w, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	assert.EqualValues(t, -1, w.Progress().Percent(), "unknown without an expected size")
+
+	w.SetExpectedSize(int64(len(data)))
+	var reports []FileProgress
+	w.OnProgress(func(p FileProgress) {
+		reports = append(reports, p)
+	})
+
+	// io.Copy hides the size of the source from the File.
+	_, err = io.Copy(w, struct{ io.Reader }{bytes.NewReader(data)})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.NotEmpty(t, reports)
+	for i := 1; i < len(reports); i++ {
+		assert.Greater(t, reports[i].Transferred, reports[i-1].Transferred)
+	}
+	last := reports[len(reports)-1]
+	assert.Equal(t, FileProgress{Path: "/foo", Transferred: int64(len(data)), Expected: int64(len(data))}, last)
+	assert.EqualValues(t, 100, last.Percent())
+
+	r, err := p.cli.Open("/foo")
+	require.NoError(t, err)
+	r.SetExpectedSize(int64(len(data)))
+	_, err = r.WriteTo(ioutil.Discard)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.EqualValues(t, len(data), r.Progress().Transferred)
+
+	assert.EqualValues(t, 2*len(data), p.cli.Stats().BytesExpected)
+}
+
+func TestRequestLimits(t *testing.T) {
+	p := clientRequestServerPair(t, WithRSMaxTxPacket(1<<16))
+	defer p.Close()
+
+	reply, err := p.cli.Extended(context.Background(), "limits@openssh.com", nil)
+	require.NoError(t, err)
+	assert.Equal(t, newLimitsResponse(0, 1<<16).MaxReadLength, binary.BigEndian.Uint64(reply[8:]))
+}
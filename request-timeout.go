@@ -0,0 +1,99 @@
+package sftp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ErrRequestTimeout is the error of a request that received no response within the timeout given by WithRequestTimeout.
+// os.IsTimeout reports true for it.
+var ErrRequestTimeout error = requestTimeoutError{}
+
+type requestTimeoutError struct{}
+
+func (requestTimeoutError) Error() string { return "sftp: request timed out" }
+func (requestTimeoutError) Timeout() bool { return true }
+
+// WithRequestTimeout fails every request sent by the Client, and by the Clients returned by its WithLimits,
+// that does not receive a response within d, with ErrRequestTimeout,
+// rather than waiting for ever on a server that stalls in the middle of a session.
+// This bounds the methods which take no context as well, and each of the requests of a concurrent transfer.
+//
+// A response that arrives after its request has timed out is dropped, however late it is.
+// The connection is kept, as the server may only be slow, and so a timeout may leave the state of a file uncertain,
+// such as whether a write was done.
+// A d of zero or less, the default, waits for ever.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.requestTimeout = d
+		return nil
+	}
+}
+
+// abandonedExpiry is how many times the request timeout a timed out request is remembered,
+// so that a server which never answers does not grow the Client for ever.
+const abandonedExpiry = 10
+
+// lateResponseWindow is how many of the last requests sent may still be answered once forgotten, see dropAbandoned.
+const lateResponseWindow = 1 << 16
+
+// timeout fails the request sid, if it is still waiting for its response, with ErrRequestTimeout.
+func (c *clientConn) timeout(sid uint32) {
+	c.Lock()
+	ch, ok := c.inflight[sid]
+	if ok {
+		delete(c.inflight, sid)
+		delete(c.timers, sid)
+
+		if limit, ok := c.slots[sid]; ok {
+			delete(c.slots, sid)
+			<-limit
+		}
+
+		c.abandon(sid, time.Now())
+	}
+	c.Unlock()
+
+	if ok {
+		c.stats.abandoned(sid)
+		ch <- result{err: ErrRequestTimeout}
+	}
+}
+
+// abandon remembers the request sid, timed out at now, and forgets those that timed out too long ago.
+// The connection is locked.
+func (c *clientConn) abandon(sid uint32, now time.Time) {
+	select {
+	case <-c.closed:
+		return // no response will come, see broadcastErr.
+	default:
+	}
+
+	expired := now.Add(-abandonedExpiry * c.requestTimeout)
+	for id, at := range c.abandoned {
+		if at.Before(expired) {
+			delete(c.abandoned, id)
+		}
+	}
+
+	if c.abandoned == nil {
+		c.abandoned = make(map[uint32]time.Time)
+	}
+	c.abandoned[sid] = now
+}
+
+// dropAbandoned reports whether sid is a request that has timed out, whose late response is then dropped.
+// Once the request is forgotten, see abandonedExpiry, a response to any of the last lateResponseWindow requests
+// is dropped in the same way, rather than be taken for a broken server, and end the connection.
+func (c *clientConn) dropAbandoned(sid uint32) bool {
+	c.Lock()
+	_, ok := c.abandoned[sid]
+	delete(c.abandoned, sid)
+	c.Unlock()
+
+	if !ok && c.requestTimeout > 0 && atomic.LoadUint32(&c.nextid)-sid < lateResponseWindow {
+		debug("dropping a late response to request %d", sid)
+		ok = true
+	}
+	return ok
+}
@@ -0,0 +1,186 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClientRequestTimeout(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	// a server which stalls on the first STAT, and only answers it after the second.
+	go func() {
+		defer sw.Close()
+
+		if _, _, err := recvPacket(sr, nil, 0); err != nil {
+			return
+		}
+		sendPacket(sw, &sshFxVersionPacket{Version: sftpProtocolVersion})
+
+		var ids []uint32
+		for i := 0; i < 2; i++ {
+			_, data, err := recvPacket(sr, nil, 0)
+			if err != nil {
+				return
+			}
+			id, _ := unmarshalUint32(data)
+			ids = append(ids, id)
+		}
+
+		for _, id := range ids {
+			sendPacket(sw, &sshFxpStatResponse{ID: id, info: &fileInfo{name: "foo", stat: &FileStat{Size: 5}}})
+		}
+	}()
+
+	c, err := NewClientPipe(cr, cw, WithRequestTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Stat("foo")
+	if !errors.Is(err, ErrRequestTimeout) || !os.IsTimeout(err) {
+		t.Fatalf("Stat() = %v, want ErrRequestTimeout", err)
+	}
+
+	// the late response to the first STAT is dropped, and the session goes on.
+	fi, err := c.Stat("foo")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", fi.Size())
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if len(c.timers) != 0 || len(c.abandoned) != 0 {
+		t.Errorf("timers = %d, abandoned = %d, want none left", len(c.timers), len(c.abandoned))
+	}
+}
+
+func TestClientRequestTimeoutForgets(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	// a server which never answers anything but the INIT.
+	go func() {
+		defer sw.Close()
+
+		if _, _, err := recvPacket(sr, nil, 0); err != nil {
+			return
+		}
+		sendPacket(sw, &sshFxVersionPacket{Version: sftpProtocolVersion})
+
+		for {
+			if _, _, err := recvPacket(sr, nil, 0); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := NewClientPipe(cr, cw, WithRequestTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// the requests timed out long ago are forgotten.
+	now := time.Now()
+	c.Lock()
+	c.abandon(1, now.Add(-abandonedExpiry*time.Second-time.Millisecond))
+	c.abandon(2, now.Add(-time.Second))
+	c.abandon(3, now)
+	if _, ok := c.abandoned[1]; ok || len(c.abandoned) != 2 {
+		t.Errorf("abandoned = %v, want 2 and 3", c.abandoned)
+	}
+	c.Unlock()
+
+	// and all of them, with the timeouts still pending, once the connection is lost.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Stat("foo")
+		done <- err
+	}()
+	for {
+		c.Lock()
+		n := len(c.timers)
+		c.Unlock()
+		if n != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cr.Close()
+	if err := <-done; !errors.Is(err, ErrSSHFxConnectionLost) {
+		t.Errorf("Stat() = %v, want ErrSSHFxConnectionLost", err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if len(c.timers) != 0 || len(c.abandoned) != 0 {
+		t.Errorf("timers = %d, abandoned = %d, want none left", len(c.timers), len(c.abandoned))
+	}
+}
+
+func TestClientRequestTimeoutLateResponse(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	// a server which only answers the first STAT once told, and then the second.
+	answer := make(chan struct{})
+	go func() {
+		defer sw.Close()
+
+		if _, _, err := recvPacket(sr, nil, 0); err != nil {
+			return
+		}
+		sendPacket(sw, &sshFxVersionPacket{Version: sftpProtocolVersion})
+
+		_, data, err := recvPacket(sr, nil, 0)
+		if err != nil {
+			return
+		}
+		id, _ := unmarshalUint32(data)
+
+		<-answer
+		sendPacket(sw, &sshFxpStatResponse{ID: id, info: &fileInfo{name: "foo", stat: &FileStat{Size: 1}}})
+
+		_, data, err = recvPacket(sr, nil, 0)
+		if err != nil {
+			return
+		}
+		id, _ = unmarshalUint32(data)
+		sendPacket(sw, &sshFxpStatResponse{ID: id, info: &fileInfo{name: "foo", stat: &FileStat{Size: 5}}})
+	}()
+
+	c, err := NewClientPipe(cr, cw, WithRequestTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Stat("foo")
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Fatalf("Stat() = %v, want ErrRequestTimeout", err)
+	}
+
+	// the request is forgotten before its response arrives, which is still dropped.
+	c.Lock()
+	c.abandoned = nil
+	c.Unlock()
+	close(answer)
+
+	fi, err := c.Stat("foo")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", fi.Size())
+	}
+}
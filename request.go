@@ -23,6 +23,7 @@ type state struct {
 	writerAtReaderAt WriterAtReaderAt
 	listerAt         ListerAt
 	lsoffset         int64
+	lsPending        os.FileInfo // the entry from a ListerIterator which did not fit in the last response
 }
 
 // copy returns a shallow copy the state.
@@ -38,6 +39,7 @@ func (s *state) copy() state {
 		writerAtReaderAt: s.writerAtReaderAt,
 		listerAt:         s.listerAt,
 		lsoffset:         s.lsoffset,
+		lsPending:        s.lsPending,
 	}
 }
 
@@ -106,6 +108,24 @@ func (s *state) lsInc(offset int64) {
 	s.lsoffset += offset
 }
 
+// Takes the entry carried over from the last response, if any
+func (s *state) lsTakePending() os.FileInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fi := s.lsPending
+	s.lsPending = nil
+	return fi
+}
+
+// Carries an entry over to the next response
+func (s *state) lsSetPending(fi os.FileInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lsPending = fi
+}
+
 // manage file read/write state
 func (s *state) setListerAt(la ListerAt) {
 	s.mu.Lock()
@@ -301,6 +321,19 @@ func (r *Request) transferError(err error) {
 
 // called from worker to handle packet/request
 func (r *Request) call(handlers Handlers, pkt requestPacket, alloc *allocator, orderID uint32, maxTxPacket uint32) responsePacket {
+	// Some clients probe the handle type by mixing up READ and READDIR,
+	// so make sure the handle is being used for the right kind of operation.
+	switch pkt.(type) {
+	case *sshFxpReadPacket, *sshFxpWritePacket:
+		if r.Method == "List" {
+			return statusFromError(pkt.id(), errHandleIsDir)
+		}
+	case *sshFxpReaddirPacket:
+		if r.Method != "List" {
+			return statusFromError(pkt.id(), errHandleNotDir)
+		}
+	}
+
 	switch r.Method {
 	case "Get":
 		return fileget(handlers.FileGet, r, pkt, alloc, orderID, maxTxPacket)
@@ -308,10 +341,15 @@ func (r *Request) call(handlers Handlers, pkt requestPacket, alloc *allocator, o
 		return fileput(handlers.FilePut, r, pkt, alloc, orderID, maxTxPacket)
 	case "Open":
 		return fileputget(handlers.FilePut, r, pkt, alloc, orderID, maxTxPacket)
-	case "Setstat", "Rename", "Rmdir", "Mkdir", "Link", "Symlink", "Remove", "PosixRename", "StatVFS":
+	case "Rename":
+		if r.Filepath == r.Target {
+			return renameToSelf(handlers.FileList, r, pkt)
+		}
+		return filecmd(handlers.FileCmd, r, pkt)
+	case "Setstat", "Rmdir", "Mkdir", "Link", "Symlink", "Remove", "PosixRename", "StatVFS":
 		return filecmd(handlers.FileCmd, r, pkt)
 	case "List":
-		return filelist(handlers.FileList, r, pkt)
+		return filelist(handlers.FileList, r, pkt, maxTxPacket)
 	case "Stat", "Lstat":
 		return filestat(handlers.FileList, r, pkt)
 	case "Readlink":
@@ -509,12 +547,16 @@ func filecmd(h FileCmder, r *Request, pkt requestPacket) responsePacket {
 }
 
 // wrap FileLister handler
-func filelist(h FileLister, r *Request, pkt requestPacket) responsePacket {
+func filelist(h FileLister, r *Request, pkt requestPacket, maxTxPacket uint32) responsePacket {
 	lister := r.getListerAt()
 	if lister == nil {
 		return statusFromError(pkt.id(), errors.New("unexpected dir packet"))
 	}
 
+	if iter, ok := lister.(ListerIterator); ok && r.Method == "List" {
+		return filelistIter(h, iter, r, pkt, maxTxPacket)
+	}
+
 	offset := r.lsNext()
 	finfo := make([]os.FileInfo, MaxFilelist)
 	n, err := lister.ListAt(finfo, offset)
@@ -553,10 +595,80 @@ func filelist(h FileLister, r *Request, pkt requestPacket) responsePacket {
 	}
 }
 
+// filelistIter answers SSH_FXP_READDIR from a ListerIterator,
+// with as many entries as fit within maxTxPacket bytes, and always at least one.
+// Each entry is marshaled as it is read, and the first which does not fit is kept for the next response.
+func filelistIter(h FileLister, iter ListerIterator, r *Request, pkt requestPacket, maxTxPacket uint32) responsePacket {
+	// If the type conversion fails, we get untyped `nil`,
+	// which is handled by not looking up any names.
+	idLookup, _ := h.(NameLookupFileLister)
+
+	var nameAttrs []*sshFxpNameAttr
+	var size int
+
+	for {
+		fi := r.lsTakePending()
+		if fi == nil {
+			var err error
+			if fi, err = iter.NextEntry(); err != nil {
+				if err == io.EOF && len(nameAttrs) > 0 {
+					break
+				}
+				return statusFromError(pkt.id(), err)
+			}
+		}
+
+		na := &sshFxpNameAttr{
+			Name:     fi.Name(),
+			LongName: runLs(idLookup, fi),
+			Attrs:    []interface{}{fi},
+		}
+		na.raw, _ = na.MarshalBinary()
+
+		if len(nameAttrs) > 0 && size+len(na.raw) > int(maxTxPacket) {
+			r.lsSetPending(fi)
+			break
+		}
+
+		nameAttrs = append(nameAttrs, na)
+		size += len(na.raw)
+	}
+
+	return &sshFxpNamePacket{
+		ID:        pkt.id(),
+		NameAttrs: nameAttrs,
+	}
+}
+
+// renameToSelf handles a rename where the old and new paths are the same.
+// As with rename(2), this succeeds without doing anything, provided that the file exists.
+func renameToSelf(h FileLister, r *Request, pkt requestPacket) responsePacket {
+	stat := &Request{
+		Method:   "Lstat",
+		Filepath: r.Filepath,
+	}
+
+	if status, ok := filestat(h, stat, pkt).(*sshFxpStatusPacket); ok {
+		return status
+	}
+
+	return statusFromError(pkt.id(), nil)
+}
+
 func filestat(h FileLister, r *Request, pkt requestPacket) responsePacket {
 	var lister ListerAt
 	var err error
 
+	// As with stat(2), a trailing slash requires the path to resolve to a directory,
+	// which means that any symlink must be followed.
+	var mustBeDir bool
+	if p, ok := pkt.(hasPath); ok && r.Method != "Readlink" {
+		mustBeDir = len(p.getPath()) > 1 && strings.HasSuffix(p.getPath(), "/")
+		if mustBeDir {
+			r.Method = "Stat"
+		}
+	}
+
 	if r.Method == "Lstat" {
 		if lstatFileLister, ok := h.(LstatFileLister); ok {
 			lister, err = lstatFileLister.Lstat(r)
@@ -588,6 +700,14 @@ func filestat(h FileLister, r *Request, pkt requestPacket) responsePacket {
 			}
 			return statusFromError(pkt.id(), err)
 		}
+		if mustBeDir && !finfo[0].IsDir() {
+			err = &os.PathError{
+				Op:   "stat",
+				Path: r.Filepath,
+				Err:  syscall.ENOTDIR,
+			}
+			return statusFromError(pkt.id(), err)
+		}
 		return &sshFxpStatResponse{
 			ID:   pkt.id(),
 			info: finfo[0],
@@ -0,0 +1,54 @@
+package sftp
+
+// ResponseOrdering is the order in which a server sends its responses,
+// relative to the order in which it received the requests.
+//
+// Reads and writes are performed concurrently, so their responses are ready in no particular order.
+// Most clients match responses to requests by their id, and accept them in any order,
+// but some rely on the responses arriving in the order of the requests.
+type ResponseOrdering int
+
+// The orderings of responses.
+const (
+	// ResponseOrderStrict sends every response in the order the requests were received.
+	// This is the default, and is safe for every client,
+	// but a slow request holds back the responses to all the later ones.
+	ResponseOrderStrict ResponseOrdering = iota
+
+	// ResponseOrderPerHandle sends the responses to requests on the same handle in the order they were received,
+	// but otherwise sends each response as soon as it is ready.
+	ResponseOrderPerHandle
+
+	// ResponseOrderFree sends each response as soon as it is ready,
+	// for the highest throughput with clients that match responses by their id.
+	ResponseOrderFree
+)
+
+// WithResponseOrdering sets the order in which the Server sends its responses, see ResponseOrdering.
+func WithResponseOrdering(ordering ResponseOrdering) ServerOption {
+	return func(s *Server) error {
+		s.pktMgr.ordering = ordering
+		return nil
+	}
+}
+
+// WithRSResponseOrdering sets the order in which the RequestServer sends its responses, see ResponseOrdering.
+func WithRSResponseOrdering(ordering ResponseOrdering) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pktMgr.ordering = ordering
+	}
+}
+
+// requestHandle returns the handle the request p operates on, if any.
+func requestHandle(p orderedPacket) (string, bool) {
+	if req, ok := p.(orderedRequest); ok {
+		p := req.requestPacket
+		if epkt, ok := p.(*sshFxpExtendedPacket); ok && epkt.SpecificPacket != nil {
+			p = epkt.SpecificPacket
+		}
+		if hpkt, ok := p.(hasHandle); ok {
+			return hpkt.getHandle(), true
+		}
+	}
+	return "", false
+}
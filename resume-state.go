@@ -0,0 +1,188 @@
+package sftp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ResumeStateSuffix is appended to the name of a local file to form the name of its resume state sidecar.
+const ResumeStateSuffix = ".sftp-resume"
+
+// resumeStateVersion is the current version of the resume state format.
+const resumeStateVersion = 1
+
+var errResumeStateVersion = errors.New("sftp: unsupported resume state version")
+
+// ResumeState records the progress of an interrupted upload or download,
+// so that the transfer can be resumed after a process restart, or on a different machine.
+//
+// It is stored as JSON in a sidecar file next to the local file, see ResumeStatePath:
+//
+//	{
+//	  "version": 1,
+//	  "direction": "upload",
+//	  "local_path": "/home/user/big.iso",
+//	  "remote_path": "/incoming/big.iso",
+//	  "source_size": 4700000000,
+//	  "source_mtime": "2021-07-01T12:00:00Z",
+//	  "chunk_size": 1048576,
+//	  "offset": 3145728,
+//	  "chunk_hashes": ["9f86d0…", "60303a…", "fd61a0…"],
+//	  "updated": "2021-07-01T12:05:00Z"
+//	}
+//
+// The source size and modification time identify the file being transferred:
+// if they no longer match, the source has changed, and the transfer must be restarted.
+// Each complete chunk of ChunkSize bytes is recorded with its hex-encoded SHA-256 hash,
+// so that the data already transferred can be verified before it is trusted.
+type ResumeState struct {
+	Version    int    `json:"version"`
+	Direction  string `json:"direction"` // "upload" or "download"
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+
+	SourceSize    int64     `json:"source_size"`
+	SourceModTime time.Time `json:"source_mtime"`
+
+	ChunkSize   int64    `json:"chunk_size"`
+	Offset      int64    `json:"offset"`
+	ChunkHashes []string `json:"chunk_hashes"`
+
+	Updated time.Time `json:"updated"`
+}
+
+// NewResumeState returns a new ResumeState for a transfer of the source described by fi,
+// which will be recorded in chunks of chunkSize bytes.
+func NewResumeState(direction, localPath, remotePath string, fi os.FileInfo, chunkSize int64) *ResumeState {
+	return &ResumeState{
+		Version:       resumeStateVersion,
+		Direction:     direction,
+		LocalPath:     localPath,
+		RemotePath:    remotePath,
+		SourceSize:    fi.Size(),
+		SourceModTime: fi.ModTime().UTC().Truncate(time.Second),
+		ChunkSize:     chunkSize,
+	}
+}
+
+// ResumeStatePath returns the name of the resume state sidecar for the local file localPath.
+func ResumeStatePath(localPath string) string {
+	return localPath + ResumeStateSuffix
+}
+
+// LoadResumeState reads the resume state stored in the file name.
+func LoadResumeState(name string) (*ResumeState, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(ResumeState)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("sftp: invalid resume state %s: %w", name, err)
+	}
+
+	if s.Version != resumeStateVersion {
+		return nil, fmt.Errorf("%w: %d", errResumeStateVersion, s.Version)
+	}
+
+	return s, nil
+}
+
+// Save atomically writes the resume state to the file name,
+// by writing to a temporary file in the same directory, and then renaming it into place.
+func (s *ResumeState) Save(name string) error {
+	s.Updated = time.Now().UTC()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// Matches reports whether fi still describes the source that the state was recorded for.
+func (s *ResumeState) Matches(fi os.FileInfo) bool {
+	return fi.Size() == s.SourceSize && fi.ModTime().UTC().Truncate(time.Second).Equal(s.SourceModTime)
+}
+
+// AddChunk records the next complete chunk of the transfer, and advances Offset past it.
+func (s *ResumeState) AddChunk(data []byte) {
+	sum := sha256.Sum256(data)
+	s.ChunkHashes = append(s.ChunkHashes, hex.EncodeToString(sum[:]))
+	s.Offset += int64(len(data))
+}
+
+// VerifyChunk reports whether data matches the recorded hash of chunk i.
+func (s *ResumeState) VerifyChunk(i int, data []byte) bool {
+	if i < 0 || i >= len(s.ChunkHashes) {
+		return false
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) == s.ChunkHashes[i]
+}
+
+// CleanResumeStates removes every resume state sidecar in dir that has not been updated within maxAge,
+// and returns the names of the files that were removed.
+// Sidecars that cannot be parsed are treated as stale.
+func CleanResumeStates(dir string, maxAge time.Duration) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+
+	var removed []string
+	for _, fi := range entries {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ResumeStateSuffix) {
+			continue
+		}
+
+		name := filepath.Join(dir, fi.Name())
+
+		s, err := LoadResumeState(name)
+		if err == nil && s.Updated.After(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,93 @@
+package sftp
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "src")
+	require.NoError(t, ioutil.WriteFile(src, []byte("hello world"), 0o644))
+	fi, err := os.Stat(src)
+	require.NoError(t, err)
+
+	s := NewResumeState("upload", src, "/remote/src", fi, 4)
+	s.AddChunk([]byte("hell"))
+	s.AddChunk([]byte("o wo"))
+
+	name := ResumeStatePath(src)
+	require.NoError(t, s.Save(name))
+
+	got, err := LoadResumeState(name)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(8), got.Offset)
+	assert.Equal(t, "/remote/src", got.RemotePath)
+	assert.True(t, got.Matches(fi))
+	assert.True(t, got.VerifyChunk(1, []byte("o wo")))
+	assert.False(t, got.VerifyChunk(1, []byte("o wx")))
+	assert.False(t, got.VerifyChunk(2, nil))
+
+	// the source changing invalidates the state.
+	require.NoError(t, ioutil.WriteFile(src, []byte("hello world!"), 0o644))
+	fi, err = os.Stat(src)
+	require.NoError(t, err)
+	assert.False(t, got.Matches(fi))
+
+	// no temporary files may be left behind.
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestResumeStateVersion(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "x"+ResumeStateSuffix)
+	require.NoError(t, ioutil.WriteFile(name, []byte(`{"version":99}`), 0o644))
+
+	_, err := LoadResumeState(name)
+	assert.True(t, errors.Is(err, errResumeStateVersion), err)
+}
+
+func TestCleanResumeStates(t *testing.T) {
+	dir := t.TempDir()
+
+	fresh := &ResumeState{Version: resumeStateVersion}
+	require.NoError(t, fresh.Save(filepath.Join(dir, "fresh"+ResumeStateSuffix)))
+
+	// Save always records the current time, so write the stale state directly.
+	stale, err := json.Marshal(&ResumeState{
+		Version: resumeStateVersion,
+		Updated: time.Now().Add(-48 * time.Hour),
+	})
+	require.NoError(t, err)
+	staleName := filepath.Join(dir, "stale"+ResumeStateSuffix)
+	require.NoError(t, ioutil.WriteFile(staleName, stale, 0o644))
+
+	corrupt := filepath.Join(dir, "corrupt"+ResumeStateSuffix)
+	require.NoError(t, ioutil.WriteFile(corrupt, []byte("{"), 0o644))
+
+	other := filepath.Join(dir, "other")
+	require.NoError(t, ioutil.WriteFile(other, []byte("{"), 0o644))
+
+	removed, err := CleanResumeStates(dir, time.Hour)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{staleName, corrupt}, removed)
+
+	// with no allowed age, everything is stale.
+	removed, err = CleanResumeStates(dir, 0)
+	require.NoError(t, err)
+	assert.Len(t, removed, 1)
+
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,180 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// resumeVerifySizeDefault is the number of bytes compared before a transfer is resumed, unless ResumeOptions.VerifySize is given.
+const resumeVerifySizeDefault = 64 << 10
+
+// ResumeOptions configures ResumeUpload and ResumeDownload.
+type ResumeOptions struct {
+	// VerifySize is the number of bytes before the offset to resume from that are compared between the source and the target,
+	// before the transfer is resumed, by default 64 KiB.
+	// If they differ, the target is not a partial copy of the source, and the transfer is started over.
+	// A negative VerifySize resumes without comparing.
+	VerifySize int64
+}
+
+func (o *ResumeOptions) verifySize() int64 {
+	if o == nil || o.VerifySize == 0 {
+		return resumeVerifySizeDefault
+	}
+	if o.VerifySize < 0 {
+		return 0
+	}
+	return o.VerifySize
+}
+
+// ResumeUpload uploads the local file localPath to remotePath, continuing from the end of an existing remotePath,
+// left by an earlier upload that was interrupted, rather than starting over.
+// A nil opts is the same as the zero ResumeOptions.
+//
+// The end of the data already uploaded is read back, and compared with the local file, see ResumeOptions.VerifySize.
+// If it differs, or if remotePath is larger than the local file, remotePath is truncated, and the upload starts over.
+//
+// It returns the number of bytes uploaded, which does not include those already uploaded,
+// and is zero if remotePath was already complete.
+// The context is checked before the upload, and before the end of remotePath is compared,
+// but not while the data is uploaded.
+func (c *Client) ResumeUpload(ctx context.Context, localPath, remotePath string, opts *ResumeOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	sfi, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := c.OpenFile(remotePath, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	dfi, err := dst.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := resumeOffset(ctx, src, dst, sfi.Size(), dfi.Size(), opts.verifySize())
+	if err != nil {
+		return 0, err
+	}
+	if offset < dfi.Size() {
+		if err := dst.Truncate(offset); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := dst.ReadFrom(io.NewSectionReader(src, offset, sfi.Size()-offset))
+	if err != nil {
+		return n, err
+	}
+	return n, dst.Close()
+}
+
+// ResumeDownload downloads the remote file remotePath to localPath, continuing from the end of an existing localPath,
+// left by an earlier download that was interrupted, rather than starting over,
+// in the same way as ResumeUpload.
+//
+// It returns the number of bytes downloaded, which does not include those already downloaded,
+// and is zero if localPath was already complete.
+func (c *Client) ResumeDownload(ctx context.Context, remotePath, localPath string, opts *ResumeOptions) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	src, err := c.Open(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	sfi, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := os.OpenFile(localPath, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	dfi, err := dst.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := resumeOffset(ctx, src, dst, sfi.Size(), dfi.Size(), opts.verifySize())
+	if err != nil {
+		return 0, err
+	}
+	if offset < dfi.Size() {
+		if err := dst.Truncate(offset); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := src.WriteTo(dst)
+	if err != nil {
+		return n, err
+	}
+	return n, dst.Close()
+}
+
+// resumeOffset returns the offset from which to resume the transfer of src, of srcSize bytes, to dst, of dstSize bytes,
+// which is zero if dst is larger than src, or if the verify bytes before the end of dst differ from those of src.
+func resumeOffset(ctx context.Context, src, dst io.ReaderAt, srcSize, dstSize, verify int64) (int64, error) {
+	if dstSize > srcSize {
+		return 0, nil
+	}
+
+	offset := dstSize
+	if verify > offset {
+		verify = offset
+	}
+	if verify == 0 {
+		return offset, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	want := make([]byte, verify)
+	if _, err := io.ReadFull(io.NewSectionReader(src, offset-verify, verify), want); err != nil {
+		return 0, err
+	}
+	got := make([]byte, verify)
+	if _, err := io.ReadFull(io.NewSectionReader(dst, offset-verify, verify), got); err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(want, got) {
+		return 0, nil
+	}
+	return offset, nil
+}
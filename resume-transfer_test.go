@@ -0,0 +1,132 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientResumeUpload(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+	local := filepath.Join(t.TempDir(), "local")
+	require.NoError(t, ioutil.WriteFile(local, content, 0o644))
+
+	putRemote := func(data []byte) {
+		f, err := p.cli.Create("/remote")
+		require.NoError(t, err)
+		_, err = f.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	getRemote := func() []byte {
+		f, err := p.testHandler().fetch("/remote")
+		require.NoError(t, err)
+		return f.content
+	}
+
+	// nothing to resume.
+	n, err := p.cli.ResumeUpload(ctx, local, "/remote", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+	assert.Equal(t, content, getRemote())
+
+	// already complete.
+	n, err = p.cli.ResumeUpload(ctx, local, "/remote", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+
+	// interrupted.
+	putRemote(content[:100000])
+	n, err = p.cli.ResumeUpload(ctx, local, "/remote", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content)-100000, n)
+	assert.Equal(t, content, getRemote())
+
+	// not a partial copy.
+	other := append([]byte(nil), content[:100000]...)
+	other[99999] ^= 0xff
+	putRemote(other)
+	n, err = p.cli.ResumeUpload(ctx, local, "/remote", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+	assert.Equal(t, content, getRemote())
+
+	// a difference before the bytes compared is not noticed.
+	other[99999] ^= 0xff
+	other[0] ^= 0xff
+	putRemote(other)
+	n, err = p.cli.ResumeUpload(ctx, local, "/remote", &ResumeOptions{VerifySize: 1000})
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content)-100000, n)
+	assert.Equal(t, other, getRemote()[:100000])
+
+	// larger than the source.
+	putRemote(append(content, "more"...))
+	n, err = p.cli.ResumeUpload(ctx, local, "/remote", nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+	assert.Equal(t, content, getRemote())
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = p.cli.ResumeUpload(ctx, local, "/remote", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestClientResumeDownload(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+	f, err := p.cli.Create("/remote")
+	require.NoError(t, err)
+	_, err = f.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	local := filepath.Join(t.TempDir(), "local")
+	getLocal := func() []byte {
+		b, err := ioutil.ReadFile(local)
+		require.NoError(t, err)
+		return b
+	}
+
+	// interrupted.
+	require.NoError(t, ioutil.WriteFile(local, content[:70000], 0o644))
+	n, err := p.cli.ResumeDownload(ctx, "/remote", local, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content)-70000, n)
+	assert.Equal(t, content, getLocal())
+
+	// already complete.
+	n, err = p.cli.ResumeDownload(ctx, "/remote", local, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+
+	// not a partial copy.
+	require.NoError(t, ioutil.WriteFile(local, bytes.Repeat([]byte("x"), 70000), 0o644))
+	n, err = p.cli.ResumeDownload(ctx, "/remote", local, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+	assert.Equal(t, content, getLocal())
+
+	// nothing to resume.
+	require.NoError(t, os.Remove(local))
+	n, err = p.cli.ResumeDownload(ctx, "/remote", local, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+	assert.Equal(t, content, getLocal())
+}
@@ -0,0 +1,174 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+)
+
+// errNoReply answers a request that a middleware let succeed without passing it on, when its success needs a reply.
+var errNoReply = errors.New("sftp: request answered without a reply")
+
+// A ServerRequest is a request to the Server, as it passes through the middleware of the Server, see Server.Use.
+type ServerRequest struct {
+	// ID is the request id, which is unique among the requests in flight of the connection.
+	ID uint32
+
+	// Op is the name of the packet type of the request, such as "SSH_FXP_OPEN",
+	// or of its extension, such as "posix-rename@openssh.com".
+	Op string
+
+	// Paths are the paths of the request, such as the old and the new path of a rename.
+	// A middleware may change them, before passing the request on to the next handler,
+	// while the other fields only describe the request.
+	Paths []string
+
+	// Handle is the handle of a request on an open file or directory, such as a read or a close.
+	Handle string
+
+	// Offset and Length are those of the data of a read or a write.
+	Offset uint64
+	Length uint32
+
+	ctx   context.Context
+	pkt   orderedRequest
+	resp  responsePacket // of the Server, once the request has been passed through to it.
+	err   error          // of resp, as returned to the middleware.
+	fatal error          // that ends the worker, rather than answering the request.
+}
+
+// Context returns the context of the request, which is that given to Server.ServeContext,
+// and so may carry the SessionInfo of the connection, see SessionFromContext.
+func (req *ServerRequest) Context() context.Context {
+	return req.ctx
+}
+
+// A ServerHandler answers a ServerRequest, returning the error the request is answered with,
+// or nil if it succeeded.
+type ServerHandler func(req *ServerRequest) error
+
+// A ServerMiddleware wraps the next ServerHandler, so that it can observe, change, delay, or refuse each request,
+// and see how it was answered once next returns.
+type ServerMiddleware func(next ServerHandler) ServerHandler
+
+// Use adds the middleware mw to the Server, within those added before,
+// such that the first one added is the outermost, and sees each request first.
+// It is not safe to call Use once Serve has been called.
+//
+// The middleware sees every request but the SSH_FXP_INIT, before the checks of the Server,
+// such as ReadOnly and WithPathPolicy, and so also those the Server refuses.
+// A middleware refuses a request by returning an error without calling next,
+// and the request is then answered with the status of the error, as it is whenever the error is not the one next returned.
+// Otherwise the request is answered as next answered it.
+//
+// A middleware that returns nil instead of the error of next, or without calling next, has the request answered with SSH_FX_OK,
+// but only if it is one answered by a status on success, such as SSH_FXP_MKDIR.
+// The success of the others, such as SSH_FXP_OPEN, SSH_FXP_READ, SSH_FXP_STAT or SSH_FXP_READDIR,
+// carries a reply that only the Server gives, so they are answered as next answered them,
+// or, if next was not called, with SSH_FX_FAILURE.
+//
+// Middleware may be used for what would otherwise need a change to the Server,
+// such as audit logging, rate limiting, or a policy on the paths of each user.
+func (svr *Server) Use(mw ...ServerMiddleware) {
+	svr.middleware = append(svr.middleware, mw...)
+
+	svr.handler = svr.serveRequest
+	for i := len(svr.middleware) - 1; i >= 0; i-- {
+		svr.handler = svr.middleware[i](svr.handler)
+	}
+}
+
+// WithServerMiddleware adds the middleware mw to the Server, as Server.Use does.
+func WithServerMiddleware(mw ...ServerMiddleware) ServerOption {
+	return func(s *Server) error {
+		s.Use(mw...)
+		return nil
+	}
+}
+
+// serveMiddleware returns the response to the request p, as answered through the middleware.
+// The error is not that of the response, but one that ends the worker.
+func (svr *Server) serveMiddleware(ctx context.Context, p orderedRequest) (responsePacket, error) {
+	if _, ok := p.requestPacket.(*sshFxInitPacket); ok {
+		return svr.checkAndRespond(ctx, p)
+	}
+
+	req := newServerRequest(ctx, p)
+	err := svr.handler(req)
+	if req.fatal != nil {
+		return nil, req.fatal
+	}
+
+	if req.resp != nil && err == req.err {
+		return req.resp, nil
+	}
+
+	// refused, or answered otherwise, by a middleware.
+	if err == nil {
+		if want := replyType(p.requestPacket); want != 0 && want != sshFxpExtendedReply {
+			// there is no reply to succeed with, see Use.
+			if req.resp != nil {
+				return req.resp, nil
+			}
+			return statusFromError(p.id(), errNoReply), nil
+		}
+		return statusFromError(p.id(), nil), nil
+	}
+	return svr.batches.refuse(p.requestPacket, err), nil
+}
+
+// serveRequest is the innermost ServerHandler, which answers the request with the Server itself.
+func (svr *Server) serveRequest(req *ServerRequest) error {
+	for i, path := range packetPaths(specificPacket(req.pkt.requestPacket)) {
+		if i < len(req.Paths) {
+			*path = req.Paths[i]
+		}
+	}
+
+	req.resp, req.fatal = svr.checkAndRespond(req.ctx, req.pkt)
+	if req.fatal != nil {
+		return req.fatal
+	}
+
+	req.err = nil
+	if status, ok := req.resp.(*sshFxpStatusPacket); ok && status.StatusError.Code != sshFxOk {
+		err := status.StatusError
+		req.err = &err
+	}
+	return req.err
+}
+
+func newServerRequest(ctx context.Context, p orderedRequest) *ServerRequest {
+	req := &ServerRequest{
+		ID:  p.id(),
+		Op:  requestOp(p.requestPacket),
+		ctx: ctx,
+		pkt: p,
+	}
+
+	pkt := specificPacket(p.requestPacket)
+	for _, path := range packetPaths(pkt) {
+		req.Paths = append(req.Paths, *path)
+	}
+	if pkt, ok := pkt.(interface{ getHandle() string }); ok {
+		req.Handle = pkt.getHandle()
+	}
+
+	switch pkt := pkt.(type) {
+	case *sshFxpReadPacket:
+		req.Offset, req.Length = pkt.Offset, pkt.Len
+	case *sshFxpWritePacket:
+		req.Offset, req.Length = pkt.Offset, uint32(len(pkt.Data))
+	case *sshFxpExtendedPacketWriteBatch:
+		req.Offset, req.Length = pkt.Offset, uint32(len(pkt.Data))
+	}
+
+	return req
+}
+
+// specificPacket returns the packet of the extended request of p, if it is one, or else p itself.
+func specificPacket(p requestPacket) interface{} {
+	if epkt, ok := p.(*sshFxpExtendedPacket); ok && epkt.SpecificPacket != nil {
+		return epkt.SpecificPacket
+	}
+	return p
+}
@@ -0,0 +1,151 @@
+package sftp
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clientServerPairWithMiddleware(t *testing.T, mw ...ServerMiddleware) *Client {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithServerMiddleware(mw...))
+	require.NoError(t, err)
+	go func() {
+		server.Serve()
+		server.Close()
+	}()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestServerMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftp-middleware")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	root := filepath.ToSlash(dir)
+
+	var mu sync.Mutex
+	var audit []string
+
+	// the outermost middleware, which sees the paths before chroot changes them.
+	auditor := func(next ServerHandler) ServerHandler {
+		return func(req *ServerRequest) error {
+			entry := req.Op
+			if len(req.Paths) > 0 {
+				entry += " " + req.Paths[0]
+			}
+
+			err := next(req)
+			if err != nil {
+				entry += " failed"
+			}
+
+			mu.Lock()
+			audit = append(audit, entry)
+			mu.Unlock()
+			return err
+		}
+	}
+
+	// chroots every path into dir, and refuses removals.
+	chroot := func(next ServerHandler) ServerHandler {
+		return func(req *ServerRequest) error {
+			if req.Op == "SSH_FXP_REMOVE" || req.Op == "SSH_FXP_RMDIR" {
+				return os.ErrPermission
+			}
+			for i, p := range req.Paths {
+				req.Paths[i] = path.Join(root, p)
+			}
+			return next(req)
+		}
+	}
+
+	client := clientServerPairWithMiddleware(t, auditor, chroot)
+
+	require.NoError(t, client.PutString("/file", "hello", 0o600))
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(contents))
+
+	_, err = client.Stat("/missing")
+	assert.True(t, os.IsNotExist(err), "%v", err)
+
+	err = client.Remove("/file")
+	assert.True(t, os.IsPermission(err), "%v", err)
+	_, err = os.Stat(filepath.Join(dir, "file"))
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"SSH_FXP_OPEN /file", "SSH_FXP_WRITE", "SSH_FXP_CLOSE",
+		"SSH_FXP_STAT /missing failed",
+		"SSH_FXP_REMOVE /file failed", "SSH_FXP_RMDIR /file failed", // as Remove tries both.
+	}, audit)
+}
+
+func TestServerMiddlewareReplacesResponse(t *testing.T) {
+	// drops the error of a Mkdir of a directory that already exists, answering it with SSH_FX_OK,
+	// and tries to drop those of a Stat, which cannot succeed without the attributes.
+	client := clientServerPairWithMiddleware(t, func(next ServerHandler) ServerHandler {
+		return func(req *ServerRequest) error {
+			err := next(req)
+			if (req.Op == "SSH_FXP_MKDIR" || req.Op == "SSH_FXP_STAT") && err != nil {
+				return nil
+			}
+			return err
+		}
+	})
+
+	dir, err := ioutil.TempDir("", "sftp-middleware")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, client.Mkdir(filepath.ToSlash(dir)), "already exists, but the error is dropped")
+
+	_, err = client.Stat(filepath.ToSlash(filepath.Join(dir, "missing")))
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
+
+func TestServerMiddlewareShortCircuit(t *testing.T) {
+	// answers every request itself, without passing any on to the Server.
+	client := clientServerPairWithMiddleware(t, func(next ServerHandler) ServerHandler {
+		return func(req *ServerRequest) error {
+			return nil
+		}
+	})
+
+	dir, err := ioutil.TempDir("", "sftp-middleware")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.ToSlash(filepath.Join(dir, "file"))
+
+	// an OPEN needs a handle to succeed, which only the Server gives.
+	_, err = client.Open(name)
+	var status *StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+
+	_, err = client.Stat(name)
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+
+	// while a MKDIR succeeds with SSH_FX_OK alone.
+	assert.NoError(t, client.Mkdir(name))
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
@@ -0,0 +1,349 @@
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A ServerRoot is a local directory that the Server serves as one of its top-level directories, see WithServerRoots.
+type ServerRoot struct {
+	// Name is the name of the top-level directory, such as "data" for "/data".
+	Name string
+
+	// Path is the local directory served under Name.
+	Path string
+
+	// ReadOnly refuses the requests to modify the files under Name, as the ReadOnly option does for the whole Server.
+	ReadOnly bool
+}
+
+// WithServerRoots has the Server serve only the local directories of roots, each as a top-level directory,
+// such as "/data" for /srv/data, and "/logs" for /var/log, read-only,
+// so that a small deployment can expose a few directories without writing the Handlers of a RequestServer.
+//
+// The directory "/" lists the roots, and cannot be modified, nor can any other path outside of the roots.
+// Relative paths are relative to "/", rather than to the working directory of the Server,
+// and SSH_FXP_REALPATH, and expand-path@openssh.com, in which "~" also stands for "/",
+// return the path as the client sees it, without following symbolic links.
+//
+// The absolute targets of symbolic links are translated in the same way as the other paths,
+// and a READLINK of a link to an absolute target outside of the roots is refused with permission denied,
+// rather than reveal the path on the host.
+// A SYMLINK with a relative target that leaves the root of the link is refused with permission denied.
+// The links already in the roots are followed wherever they point, as they are by the Server without roots.
+//
+// A request which modifies a path of a read-only root is refused with permission denied,
+// even when its other paths are in roots which are not read-only, such as a rename between them.
+// The source of a copy, and the target of a symbolic link, are only read.
+func WithServerRoots(roots ...ServerRoot) ServerOption {
+	return func(s *Server) error {
+		r := &serverRoots{
+			modTime: time.Now(),
+		}
+
+		for _, root := range roots {
+			if root.Name == "" || root.Name == "." || root.Name == ".." || strings.ContainsAny(root.Name, `/\`) {
+				return fmt.Errorf("sftp: invalid root name %q", root.Name)
+			}
+			if _, ok := r.lookup(root.Name); ok {
+				return fmt.Errorf("sftp: duplicate root name %q", root.Name)
+			}
+
+			local, err := filepath.Abs(root.Path)
+			if err != nil {
+				return err
+			}
+			root.Path = local
+
+			r.roots = append(r.roots, root)
+		}
+		sort.Slice(r.roots, func(i, j int) bool { return r.roots[i].Name < r.roots[j].Name })
+
+		if len(r.roots) == 0 {
+			return errors.New("sftp: no roots to serve")
+		}
+
+		s.roots = r
+		return nil
+	}
+}
+
+// serverRoots are the ServerRoots of a Server, sorted by name.
+type serverRoots struct {
+	roots   []ServerRoot
+	modTime time.Time // of "/"
+}
+
+func (r *serverRoots) lookup(name string) (ServerRoot, bool) {
+	for _, root := range r.roots {
+		if root.Name == name {
+			return root, true
+		}
+	}
+	return ServerRoot{}, false
+}
+
+// localPath returns the root of the cleaned absolute path p, as the client sees it, and the local path it stands for.
+// The path "/", and paths outside of the roots, are not local.
+func (r *serverRoots) localPath(p string) (ServerRoot, string, error) {
+	if p == "/" {
+		return ServerRoot{}, "", syscall.EPERM
+	}
+
+	name := rootName(p)
+	root, ok := r.lookup(name)
+	if !ok {
+		return ServerRoot{}, "", &os.PathError{Op: "lstat", Path: p, Err: syscall.ENOENT}
+	}
+	return root, filepath.Join(root.Path, filepath.FromSlash(p[1+len(name):])), nil
+}
+
+// rootName returns the name of the root of the cleaned absolute path p, as the client sees it, which is "" for "/".
+func rootName(p string) string {
+	name := p[1:]
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// clientPath returns the path, as the client sees it, of the local path, and the root it lies in.
+func (r *serverRoots) clientPath(local string) (ServerRoot, string, bool) {
+	local = filepath.Clean(local)
+	for _, root := range r.roots {
+		rel, err := filepath.Rel(root.Path, local)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return root, path.Join("/", root.Name, filepath.ToSlash(rel)), true
+	}
+	return ServerRoot{}, "", false
+}
+
+// readOnly reports whether the local path lies in a read-only root.
+func (r *serverRoots) readOnly(local string) bool {
+	for _, root := range r.roots {
+		rel, err := filepath.Rel(root.Path, filepath.Clean(local))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if root.ReadOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// packetLocalPath returns the local path as a path of a request packet, which the Server resolves to the same local path.
+func packetLocalPath(local string) string {
+	p := filepath.ToSlash(local)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // such as "/C:/srv/data", see toLocalPath.
+	}
+	return p
+}
+
+// isReadPath reports whether name is a path that the request packet pkt only reads, even though the request modifies others.
+func isReadPath(pkt interface{}, name *string) bool {
+	switch pkt := pkt.(type) {
+	case *sshFxpExtendedPacketCopyFile:
+		return name == &pkt.Source
+	case *sshFxpSymlinkPacket:
+		return name == &pkt.Targetpath
+	}
+	return false
+}
+
+// applyRoots answers the request packet pkt if it is about "/", or is refused by the roots of the Server,
+// and otherwise replaces its paths with the local paths they stand for, returning nil.
+func (s *Server) applyRoots(pkt requestPacket, readonly bool) responsePacket {
+	p := specificPacket(pkt)
+
+	switch p := p.(type) {
+	case *sshFxpRealpathPacket:
+		return cleanPacketPath(p, cleanPath(p.Path))
+
+	case *sshFxpExtendedPacketExpandPath:
+		expanded := p.Path
+		if name, rest, ok := splitTildePath(p.Path); ok {
+			if name != "" {
+				return statusFromError(p.ID, ErrSSHFxOpUnsupported)
+			}
+			expanded = path.Join("/", rest)
+		}
+		return cleanPacketPath(&sshFxpRealpathPacket{ID: p.ID}, cleanPath(expanded))
+
+	case *sshFxpStatPacket:
+		if cleanPath(p.Path) == "/" {
+			return &sshFxpStatResponse{ID: p.ID, info: s.roots.rootInfo()}
+		}
+
+	case *sshFxpLstatPacket:
+		if cleanPath(p.Path) == "/" {
+			return &sshFxpStatResponse{ID: p.ID, info: s.roots.rootInfo()}
+		}
+
+	case *sshFxpOpendirPacket:
+		if cleanPath(p.Path) == "/" {
+			return &sshFxpHandlePacket{ID: p.ID, Handle: s.nextHandle(&serverRootsDir{roots: s.roots})}
+		}
+
+	case *sshFxpReadlinkPacket:
+		return s.readlinkRoots(p)
+	}
+
+	if h, ok := p.(interface{ getHandle() string }); ok && !readonly {
+		if f, ok := s.getHandle(h.getHandle()); ok {
+			if _, isRoot := f.(*serverRootsDir); isRoot || s.roots.readOnly(f.Name()) {
+				return s.batches.refuse(pkt, syscall.EPERM)
+			}
+		}
+	}
+
+	if sym, ok := p.(*sshFxpSymlinkPacket); ok && !strings.HasPrefix(sym.Targetpath, "/") {
+		// a relative target is not translated, and so must stay in the root of the link.
+		link := cleanPath(sym.Linkpath)
+		if rootName(path.Join(path.Dir(link), sym.Targetpath)) != rootName(link) {
+			return statusFromError(sym.ID, syscall.EPERM)
+		}
+	}
+
+	for _, name := range packetPaths(p) {
+		if sym, ok := p.(*sshFxpSymlinkPacket); ok && name == &sym.Targetpath && !strings.HasPrefix(*name, "/") {
+			continue
+		}
+
+		clean := cleanPath(*name)
+		root, local, err := s.roots.localPath(clean)
+		switch {
+		case err == nil && root.ReadOnly && !readonly && !isReadPath(p, name):
+			err = syscall.EPERM
+		case os.IsNotExist(err) && !readonly && path.Dir(clean) == "/":
+			err = syscall.EPERM // "/" cannot be modified.
+		}
+		if err != nil {
+			return statusFromError(pkt.id(), err)
+		}
+		*name = packetLocalPath(local)
+	}
+
+	return nil
+}
+
+// readlinkRoots answers the READLINK p, with an absolute target translated to the path the client sees.
+func (s *Server) readlinkRoots(p *sshFxpReadlinkPacket) responsePacket {
+	_, local, err := s.roots.localPath(cleanPath(p.Path))
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+
+	target, err := os.Readlink(local)
+	if err != nil {
+		return statusFromError(p.ID, err)
+	}
+
+	if filepath.IsAbs(target) {
+		_, clientPath, ok := s.roots.clientPath(target)
+		if !ok {
+			return statusFromError(p.ID, ErrSSHFxPermissionDenied)
+		}
+		target = clientPath
+	}
+
+	return &sshFxpNamePacket{
+		ID: p.ID,
+		NameAttrs: []*sshFxpNameAttr{
+			{
+				Name:     target,
+				LongName: target,
+				Attrs:    emptyFileStat,
+			},
+		},
+	}
+}
+
+// rootInfo returns the FileInfo of "/".
+func (r *serverRoots) rootInfo() os.FileInfo {
+	return &serverRootInfo{name: "/", modTime: r.modTime}
+}
+
+type serverRootInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (fi *serverRootInfo) Name() string       { return fi.name }
+func (fi *serverRootInfo) Size() int64        { return 0 }
+func (fi *serverRootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (fi *serverRootInfo) ModTime() time.Time { return fi.modTime }
+func (fi *serverRootInfo) IsDir() bool        { return true }
+func (fi *serverRootInfo) Sys() interface{}   { return nil }
+
+// namedInfo is the FileInfo of a root, under the name it is served as.
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *namedInfo) Name() string { return fi.name }
+
+// serverRootsDir is the open directory "/", which lists the roots.
+type serverRootsDir struct {
+	roots  *serverRoots
+	listed int
+}
+
+func (f *serverRootsDir) Readdir(n int) ([]os.FileInfo, error) {
+	roots := f.roots.roots[f.listed:]
+	if n > 0 && len(roots) > n {
+		roots = roots[:n]
+	}
+	f.listed += len(roots)
+	if len(roots) == 0 {
+		return nil, io.EOF
+	}
+
+	var infos []os.FileInfo
+	for _, root := range roots {
+		fi, err := os.Stat(root.Path)
+		if err != nil {
+			continue // a root which is missing is not listed.
+		}
+		infos = append(infos, &namedInfo{FileInfo: fi, name: root.Name})
+	}
+	return infos, nil
+}
+
+func (f *serverRootsDir) Stat() (os.FileInfo, error) {
+	return f.roots.rootInfo(), nil
+}
+func (f *serverRootsDir) ReadAt(b []byte, off int64) (int, error) {
+	return 0, os.ErrPermission
+}
+func (f *serverRootsDir) WriteAt(b []byte, off int64) (int, error) {
+	return 0, os.ErrPermission
+}
+func (f *serverRootsDir) Name() string {
+	return "/"
+}
+func (f *serverRootsDir) Truncate(int64) error {
+	return os.ErrPermission
+}
+func (f *serverRootsDir) Chmod(mode fs.FileMode) error {
+	return os.ErrPermission
+}
+func (f *serverRootsDir) Chown(uid, gid int) error {
+	return os.ErrPermission
+}
+func (f *serverRootsDir) Close() error {
+	return nil
+}
@@ -0,0 +1,107 @@
+package sftp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRoots(t *testing.T) {
+	skipIfWindows(t)
+
+	data, logs := t.TempDir(), t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(logs, "app.log"), []byte("started"), 0o644))
+
+	client, server := clientServerPair(t, WithServerRoots(
+		ServerRoot{Name: "data", Path: data},
+		ServerRoot{Name: "logs", Path: logs, ReadOnly: true},
+	))
+	defer client.Close()
+	defer server.Close()
+
+	// "/" lists the roots.
+	fi, err := client.Stat("/")
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+
+	entries, err := client.ReadDir("/")
+	require.NoError(t, err)
+	var names []string
+	for _, fi := range entries {
+		names = append(names, fi.Name())
+		assert.True(t, fi.IsDir())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"data", "logs"}, names)
+
+	p, err := client.RealPath("data/../logs")
+	require.NoError(t, err)
+	assert.Equal(t, "/logs", p)
+	p, err = client.ExpandPath("~/data")
+	require.NoError(t, err)
+	assert.Equal(t, "/data", p)
+
+	// the roots are served from their local directories.
+	w, err := client.Create("/data/new")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	got, err := ioutil.ReadFile(filepath.Join(data, "new"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	r, err := client.Open("/logs/app.log")
+	require.NoError(t, err)
+	got, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "started", string(got))
+
+	// nothing under a read-only root may be modified, even through a handle.
+	assert.ErrorIs(t, r.Chmod(0o600), os.ErrPermission)
+	require.NoError(t, r.Close())
+	_, err = client.Create("/logs/new")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.ErrorIs(t, client.Remove("/logs/app.log"), os.ErrPermission)
+	assert.ErrorIs(t, client.Rename("/logs/app.log", "/data/app.log"), os.ErrPermission)
+	assert.ErrorIs(t, client.Rename("/data/new", "/logs/new"), os.ErrPermission)
+
+	// nor "/", and there is nothing outside of the roots.
+	assert.ErrorIs(t, client.Mkdir("/other"), os.ErrPermission)
+	_, err = client.Stat("/other/file")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// absolute targets of links are translated, and relative targets cannot leave the root of the link.
+	require.NoError(t, client.Symlink("/logs/app.log", "/data/link"))
+	target, err := os.Readlink(filepath.Join(data, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(logs, "app.log"), target)
+	target, err = client.ReadLink("/data/link")
+	require.NoError(t, err)
+	assert.Equal(t, "/logs/app.log", target)
+
+	assert.ErrorIs(t, client.Symlink("../logs/app.log", "/data/rel"), os.ErrPermission)
+	require.NoError(t, client.Symlink("new", "/data/rel"))
+
+	require.NoError(t, os.Symlink("/", filepath.Join(data, "host")))
+	_, err = client.ReadLink("/data/host")
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
+
+func TestServerRootsOption(t *testing.T) {
+	for _, roots := range [][]ServerRoot{
+		nil,
+		{{Name: "", Path: "/"}},
+		{{Name: "..", Path: "/"}},
+		{{Name: "a/b", Path: "/"}},
+		{{Name: "a", Path: "/"}, {Name: "a", Path: "/tmp"}},
+	} {
+		_, err := NewServer(nil, WithServerRoots(roots...))
+		assert.Error(t, err, "%v", roots)
+	}
+}
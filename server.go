@@ -3,6 +3,7 @@ package sftp
 // sftp server counterpart
 
 import (
+	"context"
 	"encoding"
 	"errors"
 	"fmt"
@@ -40,15 +41,29 @@ type file interface {
 // as specified at https://filezilla-project.org/specs/draft-ietf-secsh-filexfer-02.txt
 type Server struct {
 	*serverConn
-	debugStream   io.Writer
-	readOnly      bool
-	pktMgr        *packetManager
-	openFiles     map[string]file
-	openFilesLock sync.RWMutex
-	handleCount   int
-	workDir       string
-	winRoot       bool
-	maxTxPacket   uint32
+	debugStream    io.Writer
+	readOnly       bool
+	pktMgr         *packetManager
+	openFiles      map[string]file
+	openFilesLock  sync.RWMutex
+	handleCount    int
+	workDir        string
+	winRoot        bool
+	maxTxPacket    uint32
+	pathPolicy     *PathPolicy
+	filenamePolicy *FilenamePolicy
+	advert         advertisement
+	createHook     func(path string, how FileCreation)
+	openHook       func(path string, req *OpenRequest) error
+	maxFileSize    int64
+	rateLimits     rateLimits
+	symlinkRoot    string
+	symlinkHook    func(link, target string) (string, error)
+	lockFiles      bool
+	roots          *serverRoots
+	setACL         func(path string, acl ACL) error
+	middleware     []ServerMiddleware
+	handler        ServerHandler // of the middleware, see Use
 }
 
 func (svr *Server) nextHandle(f file) string {
@@ -78,6 +93,13 @@ func (svr *Server) getHandle(handle string) (file, bool) {
 	return f, ok
 }
 
+// isDirHandle reports whether the open file f is a directory.
+// It is only consulted after an operation on f has already failed.
+func isDirHandle(f file) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.IsDir()
+}
+
 type serverRespondablePacket interface {
 	encoding.BinaryUnmarshaler
 	id() uint32
@@ -117,6 +139,7 @@ func NewServer(rwc io.ReadWriteCloser, options ...ServerOption) (*Server, error)
 type ServerOption func(*Server) error
 
 // WithDebug enables Server debugging output to the supplied io.Writer.
+// To log every request, and its response, see WithServerLogger.
 func WithDebug(w io.Writer) ServerOption {
 	return func(s *Server) error {
 		s.debugStream = w
@@ -181,50 +204,102 @@ func WithMaxTxPacket(size uint32) ServerOption {
 	}
 }
 
+// WithServerCapture records every SFTP frame sent and received by the Server to the given CaptureWriter.
+// This is intended for debugging, see CaptureWriter for details of the format.
+func WithServerCapture(cw *CaptureWriter) ServerOption {
+	return func(s *Server) error {
+		s.conn.capture = cw
+		return nil
+	}
+}
+
 type rxPacket struct {
 	pktType  fxp
 	pktBytes []byte
 }
 
 // Up to N parallel servers
-func (svr *Server) sftpServerWorker(pktChan chan orderedRequest) error {
+func (svr *Server) sftpServerWorker(ctx context.Context, pktChan chan orderedRequest) error {
 	for pkt := range pktChan {
-		// readonly checks
-		readonly := true
-		switch pkt := pkt.requestPacket.(type) {
-		case notReadOnly:
-			readonly = false
-		case *sshFxpOpenPacket:
-			readonly = pkt.readonly()
-		case *sshFxpExtendedPacket:
-			readonly = pkt.readonly()
-		}
-
-		// If server is operating read-only and a write operation is requested,
-		// return permission denied
-		if !readonly && svr.readOnly {
-			svr.pktMgr.readyPacket(
-				svr.pktMgr.newOrderedResponse(statusFromError(pkt.id(), syscall.EPERM), pkt.orderID()),
-			)
+		if svr.pktMgr.start(pkt.requestPacket) {
+			svr.pktMgr.readyResponse(pkt.requestPacket, statusFromError(pkt.id(), errRequestCancelled), pkt.orderID())
 			continue
 		}
 
-		if err := handlePacket(svr, pkt); err != nil {
+		var rpkt responsePacket
+		var err error
+		if svr.handler != nil {
+			rpkt, err = svr.serveMiddleware(ctx, pkt)
+		} else {
+			rpkt, err = svr.checkAndRespond(ctx, pkt)
+		}
+		if err != nil {
 			return err
 		}
+
+		svr.pktMgr.readyResponse(pkt.requestPacket, rpkt, pkt.orderID())
 	}
 	return nil
 }
 
-func handlePacket(s *Server, p orderedRequest) error {
+// checkAndRespond returns the response to the request p, after checking it against the restrictions of the Server,
+// which refuse it, such as ReadOnly and WithPathPolicy, and translating its paths to those of WithServerRoots.
+func (svr *Server) checkAndRespond(ctx context.Context, pkt orderedRequest) (responsePacket, error) {
+	// readonly checks
+	readonly := true
+	switch pkt := pkt.requestPacket.(type) {
+	case notReadOnly:
+		readonly = false
+	case *sshFxpOpenPacket:
+		readonly = pkt.readonly()
+	case *sshFxpExtendedPacket:
+		readonly = pkt.readonly()
+	}
+
+	// If server is operating read-only and a write operation is requested,
+	// return permission denied
+	if !readonly && svr.readOnly {
+		return svr.batches.refuse(pkt.requestPacket, syscall.EPERM), nil
+	}
+
+	if svr.pathPolicy != nil {
+		if err := svr.pathPolicy.apply(pkt.requestPacket); err != nil {
+			return statusFromError(pkt.id(), err), nil
+		}
+	}
+
+	if svr.filenamePolicy != nil {
+		if err := svr.filenamePolicy.apply(pkt.requestPacket); err != nil {
+			return statusFromError(pkt.id(), err), nil
+		}
+	}
+
+	if svr.roots != nil {
+		if rpkt := svr.applyRoots(pkt.requestPacket, readonly); rpkt != nil {
+			return rpkt, nil
+		}
+	}
+
+	if svr.maxFileSize > 0 {
+		if err := checkFileSize(pkt.requestPacket, svr.maxFileSize); err != nil {
+			return svr.batches.refuse(pkt.requestPacket, err), nil
+		}
+	}
+
+	if err := svr.rateLimits.wait(ctx, pkt.requestPacket); err != nil {
+		return svr.batches.refuse(pkt.requestPacket, err), nil
+	}
+
+	return handlePacket(svr, pkt)
+}
+
+func handlePacket(s *Server, p orderedRequest) (responsePacket, error) {
 	var rpkt responsePacket
 	orderID := p.orderID()
 	switch p := p.requestPacket.(type) {
 	case *sshFxInitPacket:
-		rpkt = &sshFxVersionPacket{
-			Version:    sftpProtocolVersion,
-			Extensions: sftpExtensions,
-		}
+		s.recordInit(p)
+		rpkt = s.advert.versionPacket()
 	case *sshFxpStatPacket:
 		// stat the requested file
 		info, err := os.Stat(s.toLocalPath(p.Path))
@@ -273,12 +348,25 @@ func handlePacket(s *Server, p orderedRequest) error {
 		err := os.Rename(s.toLocalPath(p.Oldpath), s.toLocalPath(p.Newpath))
 		rpkt = statusFromError(p.ID, err)
 	case *sshFxpSymlinkPacket:
-		err := os.Symlink(s.toLocalPath(p.Targetpath), s.toLocalPath(p.Linkpath))
+		var err error
+		if s.symlinkHook != nil {
+			err = applySymlinkHook(s.symlinkHook, s.toLocalPath(p.Linkpath), p)
+		}
+		var target string
+		if err == nil {
+			target, err = s.symlinkTarget(p.Targetpath)
+		}
+		if err == nil {
+			err = os.Symlink(target, s.toLocalPath(p.Linkpath))
+		}
 		rpkt = statusFromError(p.ID, err)
 	case *sshFxpClosePacket:
-		rpkt = statusFromError(p.ID, s.closeHandle(p.Handle))
+		rpkt = s.batches.settle(p.Handle, statusFromError(p.ID, s.closeHandle(p.Handle)))
 	case *sshFxpReadlinkPacket:
 		f, err := os.Readlink(s.toLocalPath(p.Path))
+		if err == nil {
+			f, err = s.readlinkTarget(f)
+		}
 		rpkt = &sshFxpNamePacket{
 			ID: p.ID,
 			NameAttrs: []*sshFxpNameAttr{
@@ -333,6 +421,11 @@ func handlePacket(s *Server, p orderedRequest) error {
 			n, _err := f.ReadAt(data, int64(p.Offset))
 			if _err != nil && (_err != io.EOF || n == 0) {
 				err = _err
+
+				// Some clients probe the handle type by sending a READ to a directory handle.
+				if isDirHandle(f) {
+					err = errHandleIsDir
+				}
 			}
 			rpkt = &sshFxpDataPacket{
 				ID:     p.ID,
@@ -353,7 +446,7 @@ func handlePacket(s *Server, p orderedRequest) error {
 		}
 		rpkt = statusFromError(p.ID, err)
 	case *sshFxpExtendedPacket:
-		if p.SpecificPacket == nil {
+		if p.SpecificPacket == nil || s.advert.disabled(p.ExtendedRequest) {
 			rpkt = statusFromError(p.ID, ErrSSHFxOpUnsupported)
 		} else {
 			rpkt = p.respond(s)
@@ -361,27 +454,40 @@ func handlePacket(s *Server, p orderedRequest) error {
 	case serverRespondablePacket:
 		rpkt = p.respond(s)
 	default:
-		return fmt.Errorf("unexpected packet type %T", p)
+		return nil, fmt.Errorf("unexpected packet type %T", p)
 	}
 
-	s.pktMgr.readyPacket(s.pktMgr.newOrderedResponse(rpkt, orderID))
-	return nil
+	return rpkt, nil
 }
 
 // Serve serves SFTP connections until the streams stop or the SFTP subsystem
 // is stopped. It returns nil if the server exits cleanly.
 func (svr *Server) Serve() error {
+	return svr.ServeContext(context.Background())
+}
+
+// ServeContext is Serve, which passes ctx on to the handling of each request,
+// such as to the ServerRequest of the middleware, see Use.
+// It may carry the SessionInfo of the connection, see ContextWithSession.
+//
+// Once ctx is done, requests which wait, such as for a rate limit, fail with its error,
+// but the Server carries on serving until the streams stop, or it is closed.
+func (svr *Server) ServeContext(ctx context.Context) error {
 	defer func() {
 		if svr.pktMgr.alloc != nil {
 			svr.pktMgr.alloc.Free()
 		}
 	}()
+	if svr.pktMgr.stats != nil {
+		svr.pktMgr.stats.begin()
+	}
+
 	var wg sync.WaitGroup
 	runWorker := func(ch chan orderedRequest) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := svr.sftpServerWorker(ch); err != nil {
+			if err := svr.sftpServerWorker(ctx, ch); err != nil {
 				svr.conn.Close() // shuts down recvPacket
 			}
 		}()
@@ -419,12 +525,23 @@ func (svr *Server) Serve() error {
 			}
 		}
 
+		if init, ok := pkt.(*sshFxInitPacket); ok {
+			if err = svr.advert.checkInit(init); err != nil {
+				svr.refuseInit(err)
+				break
+			}
+		}
+
 		pktChan <- svr.pktMgr.newOrderedRequest(pkt)
 	}
 
 	close(pktChan) // shuts down sftpServerWorkers
 	wg.Wait()      // wait for all workers to exit
 
+	if svr.pktMgr.stats != nil {
+		defer svr.pktMgr.stats.end(svr.serverConn, err)
+	}
+
 	// close any still-open files
 	for handle, file := range svr.openFiles {
 		fmt.Fprintf(svr.debugStream, "sftp server file with handle %q left open: %v\n", handle, file.Name())
@@ -479,6 +596,15 @@ func (p *sshFxpOpenPacket) hasPflags(flags ...uint32) bool {
 }
 
 func (p *sshFxpOpenPacket) respond(svr *Server) responsePacket {
+	if svr.openHook != nil {
+		if err := applyOpenHook(svr.openHook, svr.toLocalPath(p.Path), p); err != nil {
+			return statusFromError(p.ID, err)
+		}
+		if svr.readOnly && !p.readonly() {
+			return statusFromError(p.ID, syscall.EPERM)
+		}
+	}
+
 	var osFlags int
 	if p.hasPflags(sshFxfRead, sshFxfWrite) {
 		osFlags |= os.O_RDWR
@@ -497,7 +623,9 @@ func (p *sshFxpOpenPacket) respond(svr *Server) responsePacket {
 	if p.hasPflags(sshFxfCreat) {
 		osFlags |= os.O_CREATE
 	}
-	if p.hasPflags(sshFxfTrunc) {
+	// A locked file is only truncated once the lock is held, see lockOpened.
+	lock := svr.lockFiles && !p.readonly()
+	if p.hasPflags(sshFxfTrunc) && !lock {
 		osFlags |= os.O_TRUNC
 	}
 	if p.hasPflags(sshFxfExcl) {
@@ -515,11 +643,28 @@ func (p *sshFxpOpenPacket) respond(svr *Server) responsePacket {
 		mode = fs.FileMode() & os.ModePerm
 	}
 
-	f, err := svr.openfile(svr.toLocalPath(p.Path), osFlags, mode)
+	localPath := svr.toLocalPath(p.Path)
+
+	var existed bool
+	if svr.createHook != nil {
+		_, err := os.Lstat(localPath)
+		existed = err == nil
+	}
+
+	f, err := svr.openfile(localPath, osFlags, mode)
+	if err == nil && lock {
+		f, err = lockOpened(f, localPath, p.hasPflags(sshFxfTrunc))
+	}
 	if err != nil {
 		return statusFromError(p.ID, err)
 	}
 
+	if svr.createHook != nil {
+		if how, ok := creation(p.Pflags, existed); ok {
+			svr.createHook(p.Path, how)
+		}
+	}
+
 	handle := svr.nextHandle(f)
 	return &sshFxpHandlePacket{ID: p.ID, Handle: handle}
 }
@@ -532,6 +677,10 @@ func (p *sshFxpReaddirPacket) respond(svr *Server) responsePacket {
 
 	dirents, err := f.Readdir(128)
 	if err != nil {
+		// Some clients probe the handle type by sending a READDIR to a file handle.
+		if err != io.EOF && !isDirHandle(f) {
+			err = errHandleNotDir
+		}
 		return statusFromError(p.ID, err)
 	}
 
@@ -567,6 +716,14 @@ func (p *sshFxpSetstatPacket) respond(svr *Server) responsePacket {
 	if err == nil && (p.Flags&sshFileXferAttrACmodTime) != 0 {
 		err = os.Chtimes(path, fs.AccessTime(), fs.ModTime())
 	}
+	if err == nil && (p.Flags&sshFileXferAttrExtended) != 0 {
+		if attrs, ok := fs.WindowsAttributes(); ok {
+			err = setWindowsAttributes(path, attrs)
+		}
+		if err == nil {
+			err = svr.applyACL(path, fs)
+		}
+	}
 
 	return statusFromError(p.ID, err)
 }
@@ -605,6 +762,14 @@ func (p *sshFxpFsetstatPacket) respond(svr *Server) responsePacket {
 			err = os.Chtimes(path, fs.AccessTime(), fs.ModTime())
 		}
 	}
+	if err == nil && (p.Flags&sshFileXferAttrExtended) != 0 {
+		if attrs, ok := fs.WindowsAttributes(); ok {
+			err = setWindowsAttributes(path, attrs)
+		}
+		if err == nil {
+			err = svr.applyACL(path, fs)
+		}
+	}
 
 	return statusFromError(p.ID, err)
 }
@@ -638,7 +803,14 @@ func statusFromError(id uint32, err error) *sshFxpStatusPacket {
 		return ret
 	}
 	if code, ok := translateSyscallError(err); ok {
-		ret.StatusError.Code = code
+		ret.StatusError.Code = v3StatusCode(code)
+		if code != ret.StatusError.Code {
+			ret.extended = code
+		}
+		return ret
+	}
+	if errors.Is(err, os.ErrPermission) {
+		ret.StatusError.Code = sshFxPermissionDenied
 		return ret
 	}
 
@@ -649,7 +821,10 @@ func statusFromError(id uint32, err error) *sshFxpStatusPacket {
 
 	var e fxerr
 	if errors.As(err, &e) {
-		ret.StatusError.Code = uint32(e)
+		ret.StatusError.Code = v3StatusCode(uint32(e))
+		if uint32(e) != ret.StatusError.Code {
+			ret.extended = uint32(e)
+		}
 		return ret
 	}
 
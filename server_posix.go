@@ -19,3 +19,8 @@ func (s *Server) lstat(name string) (os.FileInfo, error) {
 func (s *Server) stat(name string) (os.FileInfo, error) {
 	return os.Stat(name)
 }
+
+func setWindowsAttributes(path string, attrs WindowsAttributes) error {
+	// Windows file attributes have no equivalent here, so they are ignored.
+	return nil
+}
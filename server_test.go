@@ -3,11 +3,15 @@ package sftp
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -16,10 +20,9 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func clientServerPair(t *testing.T) (*Client, *Server) {
+func clientServerPair(t *testing.T, options ...ServerOption) (*Client, *Server) {
 	cr, sw := io.Pipe()
 	sr, cw := io.Pipe()
-	var options []ServerOption
 	if *testAllocator {
 		options = append(options, WithAllocator())
 	}
@@ -96,6 +99,338 @@ func TestInvalidExtendedPacket(t *testing.T) {
 	checkServerAllocator(t, server)
 }
 
+// expectHandleMisuse sends pkt on the client, and checks that it fails with a SSH_FX_FAILURE carrying want.
+func expectHandleMisuse(t *testing.T, client *Client, pkt idmarshaler, want error) {
+	t.Helper()
+
+	typ, data, err := client.clientConn.sendPacket(context.Background(), nil, pkt)
+	require.NoError(t, err)
+	require.Equal(t, uint8(sshFxpStatus), typ)
+
+	err = unmarshalStatus(pkt.id(), data)
+	assert.Equal(t, &StatusError{Code: sshFxFailure, msg: want.Error()}, err)
+}
+
+func TestServerHandleTypeMismatch(t *testing.T) {
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("hello"), 0o644))
+
+	f, err := client.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	dh, err := client.opendir(context.Background(), dir)
+	require.NoError(t, err)
+	defer client.close(dh)
+
+	expectHandleMisuse(t, client, &sshFxpReaddirPacket{ID: client.nextID(), Handle: f.handle}, errHandleNotDir)
+	expectHandleMisuse(t, client, &sshFxpReadPacket{ID: client.nextID(), Handle: dh, Len: 1024}, errHandleIsDir)
+}
+
+func TestServerPing(t *testing.T) {
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	_, ok := client.HasExtension("ping@pkg.sftp")
+	assert.True(t, ok)
+
+	rtt, err := client.Ping(context.Background())
+	require.NoError(t, err)
+	assert.True(t, rtt > 0)
+}
+
+func TestServerExtended(t *testing.T) {
+	skipIfWindows(t) // statvfs@openssh.com is not supported.
+	skipIfPlan9(t)
+
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	exts := client.Extensions()
+	assert.Equal(t, "2", exts["statvfs@openssh.com"])
+
+	// the returned map is a copy.
+	exts["statvfs@openssh.com"] = "99"
+	data, _ := client.HasExtension("statvfs@openssh.com")
+	assert.Equal(t, "2", data)
+
+	reply, err := client.Extended(context.Background(), "statvfs@openssh.com", marshalString(nil, "/"))
+	require.NoError(t, err)
+	assert.Len(t, reply, 11*8)
+
+	reply, err = client.Extended(context.Background(), "ping@pkg.sftp", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	_, err = client.Extended(context.Background(), "nonexistent@example.com", nil)
+	assert.Equal(t, sshFxOPUnsupported, int(err.(*StatusError).Code))
+}
+
+func TestServerAdvertisedVersion(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithServerAdvertisedVersion(4), WithoutExtension("versions"))
+	require.NoError(t, err)
+	go server.Serve()
+	defer server.Close()
+
+	_, err = NewClientPipe(cr, cw)
+	var verr *unexpectedVersionErr
+	require.True(t, errors.As(err, &verr), err)
+	assert.Equal(t, uint32(4), verr.got)
+}
+
+func TestClientAdvertisedVersion(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw})
+	require.NoError(t, err)
+	go server.Serve()
+
+	var buf bytes.Buffer
+	capture, err := NewCaptureWriter(&buf)
+	require.NoError(t, err)
+
+	client, err := NewClientPipe(cr, cw, WithAdvertisedVersion(2), WithCapture(capture))
+	require.NoError(t, err)
+
+	server.Close()
+	client.Close()
+
+	recs := readCapture(t, &buf)
+	require.NotEmpty(t, recs)
+
+	// length, type, and then the version.
+	init := recs[0].Frame
+	assert.Equal(t, uint8(sshFxpInit), init[4])
+	version, _ := unmarshalUint32(init[5:])
+	assert.Equal(t, uint32(2), version)
+}
+
+func TestServerVersionMismatch(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	var requested uint32
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithVersionMismatch(VersionMismatchReject, func(version uint32) {
+		requested = version
+	}))
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	_, err = NewClientPipe(cr, cw, WithAdvertisedVersion(6))
+	var perr *unexpectedPacketErr
+	require.True(t, errors.As(err, &perr), err)
+	assert.Equal(t, uint8(sshFxpStatus), perr.got)
+
+	err = <-served
+	var verr *VersionMismatchError
+	require.True(t, errors.As(err, &verr), err)
+	assert.Equal(t, uint32(6), verr.Version)
+	assert.Equal(t, uint32(6), requested)
+}
+
+func TestServerZeroByteUpload(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	var created []fileCreation
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithCreateHook(func(path string, how FileCreation) {
+		created = append(created, fileCreation{path, how})
+	}))
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	name := filepath.ToSlash(filepath.Join(t.TempDir(), "empty"))
+
+	for i := 0; i < 2; i++ {
+		f, err := client.Create(name)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	fi, err := os.Stat(filepath.FromSlash(name))
+	require.NoError(t, err)
+	assert.Zero(t, fi.Size())
+
+	assert.Equal(t, []fileCreation{
+		{name, FileCreated},
+		{name, FileTruncated},
+	}, created)
+}
+
+func TestServerOpenHook(t *testing.T) {
+	skipIfWindows(t)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	var opened []string
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithOpenHook(func(path string, req *OpenRequest) error {
+		opened = append(opened, path)
+		if strings.HasSuffix(path, "forbidden") {
+			return ErrSSHFxPermissionDenied
+		}
+		req.Flags.Excl = false
+		if req.Flags.Creat {
+			req.AttrFlags.Permissions = true
+			req.Attrs.Mode = 0o600
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+
+	for i := 0; i < 2; i++ {
+		// the second open would fail with O_EXCL, but the hook clears it.
+		f, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	_, err = client.Create(filepath.Join(dir, "forbidden"))
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	_, err = os.Stat(filepath.Join(dir, "forbidden"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, []string{name, name, filepath.Join(dir, "forbidden")}, opened)
+}
+
+func TestClientInitExtension(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithExtension("client-id@example.com", "1"))
+	require.NoError(t, err)
+	go server.Serve()
+
+	assert.Nil(t, server.ClientExtensions())
+
+	client, err := NewClientPipe(cr, cw,
+		WithInitExtension("client-id@example.com", "test-client"),
+		WithInitExtension("unknown@example.com", "2"),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"client-id@example.com": "test-client",
+		"unknown@example.com":   "2",
+	}, server.ClientExtensions())
+
+	assert.Equal(t, map[string]string{
+		"client-id@example.com": "1",
+	}, client.EchoedExtensions())
+
+	// the added extension is advertised alongside those implemented.
+	_, ok := client.HasExtension("posix-rename@openssh.com")
+	assert.True(t, ok)
+
+	server.Close()
+	client.Close()
+}
+
+func TestServerSessionEndHook(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	summaries := make(chan *SessionSummary, 1)
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithSessionEndHook(func(summary *SessionSummary) {
+		summaries <- summary
+	}))
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Stat("/nonexistent-sftp-test-path")
+	require.Error(t, err)
+
+	require.NoError(t, server.Close())
+	cw.Close()
+	<-served
+
+	summary := <-summaries
+	assert.Equal(t, SessionEndShutdown, summary.Reason)
+	assert.Equal(t, int64(2), summary.Requests) // including SSH_FXP_INIT
+	assert.Equal(t, int64(1), summary.Errors)
+}
+
+func TestServerCancel(t *testing.T) {
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	_, ok := client.HasExtension("cancel@pkg.sftp")
+	assert.True(t, ok)
+
+	// cancelling a request that is not outstanding is not an error.
+	id := client.nextID()
+	typ, data, err := client.clientConn.sendPacket(context.Background(), nil, &sshFxpCancelPacket{ID: id, RequestID: 12345})
+	require.NoError(t, err)
+	require.Equal(t, uint8(sshFxpStatus), typ)
+	assert.NoError(t, normaliseError(unmarshalStatus(id, data)))
+
+	assert.Empty(t, server.pktMgr.queued)
+}
+
 // test that server handles concurrent requests correctly
 func TestConcurrentRequests(t *testing.T) {
 	skipIfWindows(t)
@@ -187,12 +522,12 @@ func TestOpenStatRace(t *testing.T) {
 	ch := make(chan result, 3)
 	id1 := client.nextID()
 	id2 := client.nextID()
-	client.dispatchRequest(ch, &sshFxpOpenPacket{
+	client.dispatchRequest(context.Background(), ch, &sshFxpOpenPacket{
 		ID:     id1,
 		Path:   tmppath,
 		Pflags: pflags,
 	})
-	client.dispatchRequest(ch, &sshFxpLstatPacket{
+	client.dispatchRequest(context.Background(), ch, &sshFxpLstatPacket{
 		ID:   id2,
 		Path: tmppath,
 	})
@@ -333,3 +668,169 @@ func TestServerWithBrokenClient(t *testing.T) {
 		srv.Close()
 	}
 }
+
+func TestServerWriteAckBatching(t *testing.T) {
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+	client.writeAckBatch = 1 << 16
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "foo")
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	w, err := client.Create(name)
+	require.NoError(t, err)
+	_, err = w.ReadFrom(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	got, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// a failure that has not been acknowledged is reported by Close.
+	r, err := client.Open(name)
+	require.NoError(t, err)
+	r.mu.Lock()
+	require.NoError(t, r.writeBatched(context.Background(), nil, []byte("x"), 0, false))
+	r.mu.Unlock()
+	assert.Error(t, r.Close())
+}
+
+func TestServerMaxFileSize(t *testing.T) {
+	skipIfWindows(t)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithMaxFileSize(10), WithStrictConformance(PanicOnConformanceError))
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	name := filepath.Join(t.TempDir(), "file")
+
+	f, err := client.Create(name)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, 10), 0)
+	require.NoError(t, err)
+
+	// a client of version 3 sees a failure, with the message.
+	_, err = f.WriteAt([]byte{0}, 10)
+	var status *StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+	assert.Equal(t, "quota exceeded", status.msg)
+
+	err = f.Truncate(11)
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxFailure, status.FxCode())
+	require.NoError(t, f.Close())
+
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, fi.Size())
+}
+
+func TestServerGranularStatus(t *testing.T) {
+	skipIfWindows(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink("loop2", filepath.Join(dir, "loop1")))
+	require.NoError(t, os.Symlink("loop1", filepath.Join(dir, "loop2")))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "full", "sub"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0o644))
+
+	tests := []struct {
+		name string
+		op   func(*Client) error
+		want fxerr
+	}{
+		{"link loop", func(c *Client) error { _, err := c.Stat(filepath.Join(dir, "loop1")); return err }, ErrSSHFxLinkLoop},
+		{"name too long", func(c *Client) error { _, err := c.Create(filepath.Join(dir, strings.Repeat("x", 300))); return err }, ErrSSHFxInvalidFilename},
+		{"not a directory", func(c *Client) error { _, err := c.ReadDir(filepath.Join(dir, "file")); return err }, ErrSSHFxNotADirectory},
+		{"dir not empty", func(c *Client) error { return c.RemoveDirectory(filepath.Join(dir, "full")) }, ErrSSHFxDirNotEmpty},
+		{"already exists", func(c *Client) error { return c.Mkdir(filepath.Join(dir, "full")) }, ErrSSHFxFileAlreadyExists},
+	}
+
+	t.Run("v3", func(t *testing.T) {
+		client, server := clientServerPair(t)
+		defer client.Close()
+		defer server.Close()
+
+		for _, tt := range tests {
+			var status *StatusError
+			require.ErrorAs(t, tt.op(client), &status, tt.name)
+			assert.Equal(t, ErrSSHFxFailure, status.FxCode(), tt.name)
+			assert.NotEmpty(t, status.msg, tt.name)
+		}
+	})
+
+	t.Run("extended", func(t *testing.T) {
+		client, server := clientServerPair(t, WithExtendedStatusCodes())
+		defer client.Close()
+		defer server.Close()
+
+		for _, tt := range tests {
+			var status *StatusError
+			require.ErrorAs(t, tt.op(client), &status, tt.name)
+			assert.Equal(t, tt.want, status.FxCode(), tt.name)
+		}
+	})
+}
+
+func TestServerLimits(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithMaxTxPacket(1<<16))
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	data, ok := client.HasExtension("limits@openssh.com")
+	require.True(t, ok)
+	assert.Equal(t, "1", data)
+
+	reply, err := client.Extended(context.Background(), "limits@openssh.com", nil)
+	require.NoError(t, err)
+	require.Len(t, reply, 4*8)
+
+	maxPacket, reply := unmarshalUint64(reply)
+	maxRead, reply := unmarshalUint64(reply)
+	maxWrite, reply := unmarshalUint64(reply)
+	maxHandles, _ := unmarshalUint64(reply)
+	assert.EqualValues(t, maxMsgLength, maxPacket)
+	assert.EqualValues(t, 1<<16, maxRead)
+	assert.EqualValues(t, maxMsgLength-1024, maxWrite)
+	assert.EqualValues(t, 0, maxHandles)
+
+	// a write of the advertised length is accepted.
+	f, err := client.Create(filepath.Join(t.TempDir(), "file"))
+	require.NoError(t, err)
+	defer f.Close()
+	typ, data2, err := client.sendPacket(context.Background(), nil, &sshFxpWritePacket{
+		ID:     client.nextID(),
+		Handle: f.handle,
+		Length: uint32(maxWrite),
+		Data:   make([]byte, maxWrite),
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint8(sshFxpStatus), typ)
+	assert.NoError(t, normaliseError(unmarshalStatus(binary.BigEndian.Uint32(data2), data2)))
+}
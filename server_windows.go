@@ -191,3 +191,17 @@ func (s *Server) stat(name string) (os.FileInfo, error) {
 	}
 	return os.Stat(name)
 }
+
+func setWindowsAttributes(path string, attrs WindowsAttributes) error {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	cur, err := windows.GetFileAttributes(p)
+	if err != nil {
+		return err
+	}
+
+	return windows.SetFileAttributes(p, cur&^uint32(windowsAttrMask)|uint32(attrs&windowsAttrMask))
+}
@@ -0,0 +1,51 @@
+package sftp
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SessionInfo describes the connection of an SFTP session, for a server which serves several users,
+// so that each request can be handled on behalf of the user of its session,
+// without a map from the connection to the user kept aside.
+//
+// It is passed to the requests in a context, see ContextWithSession,
+// given to RequestServer.ServeContext or Server.ServeContext,
+// and found with SessionFromContext in the Context of a Request, or of a ServerRequest.
+type SessionInfo struct {
+	// User is the name the client authenticated as.
+	User string
+
+	// RemoteAddr and LocalAddr are the addresses of the client, and of the server.
+	RemoteAddr, LocalAddr net.Addr
+
+	// Conn is the metadata of the SSH connection, if the session is served over one,
+	// from which such as its session id, and the version of the client, can be had.
+	Conn ssh.ConnMetadata
+}
+
+// NewSessionInfo returns the SessionInfo of a session served over the SSH connection of the metadata conn,
+// such as an *ssh.ServerConn.
+func NewSessionInfo(conn ssh.ConnMetadata) *SessionInfo {
+	return &SessionInfo{
+		User:       conn.User(),
+		RemoteAddr: conn.RemoteAddr(),
+		LocalAddr:  conn.LocalAddr(),
+		Conn:       conn,
+	}
+}
+
+type sessionKey struct{}
+
+// ContextWithSession returns a copy of ctx which carries the SessionInfo info.
+func ContextWithSession(ctx context.Context, info *SessionInfo) context.Context {
+	return context.WithValue(ctx, sessionKey{}, info)
+}
+
+// SessionFromContext returns the SessionInfo carried by ctx, if any.
+func SessionFromContext(ctx context.Context) (*SessionInfo, bool) {
+	info, ok := ctx.Value(sessionKey{}).(*SessionInfo)
+	return info, ok && info != nil
+}
@@ -0,0 +1,118 @@
+package sftp
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConnMetadata struct{ user string }
+
+func (m testConnMetadata) User() string          { return m.user }
+func (m testConnMetadata) SessionID() []byte     { return []byte("session") }
+func (m testConnMetadata) ClientVersion() []byte { return []byte("SSH-2.0-test") }
+func (m testConnMetadata) ServerVersion() []byte { return []byte("SSH-2.0-test") }
+func (m testConnMetadata) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22222}
+}
+func (m testConnMetadata) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 22}
+}
+
+// sessionCmder records the user of the session of each request.
+type sessionCmder struct {
+	FileCmder
+
+	mu    sync.Mutex
+	users []string
+}
+
+func (c *sessionCmder) Filecmd(r *Request) error {
+	if info, ok := SessionFromContext(r.Context()); ok {
+		c.mu.Lock()
+		c.users = append(c.users, info.User)
+		c.mu.Unlock()
+	}
+	return c.FileCmder.Filecmd(r)
+}
+
+func TestRequestServerServeContext(t *testing.T) {
+	info := NewSessionInfo(testConnMetadata{user: "alice"})
+	assert.Equal(t, "alice", info.User)
+	assert.Equal(t, "192.0.2.1:22222", info.RemoteAddr.String())
+
+	handlers := InMemHandler()
+	cmder := &sessionCmder{FileCmder: handlers.FileCmd}
+	handlers.FileCmd = cmder
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	rs := NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, handlers)
+	go func() {
+		rs.ServeContext(ContextWithSession(context.Background(), info))
+		rs.Close()
+	}()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+
+	require.NoError(t, client.Mkdir("/dir"))
+
+	cmder.mu.Lock()
+	defer cmder.mu.Unlock()
+	assert.Equal(t, []string{"alice"}, cmder.users)
+}
+
+func TestServerServeContext(t *testing.T) {
+	var mu sync.Mutex
+	var users []string
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithServerMiddleware(func(next ServerHandler) ServerHandler {
+		return func(req *ServerRequest) error {
+			if info, ok := SessionFromContext(req.Context()); ok {
+				mu.Lock()
+				users = append(users, info.User)
+				mu.Unlock()
+			}
+			return next(req)
+		}
+	}))
+	require.NoError(t, err)
+	go func() {
+		server.ServeContext(ContextWithSession(context.Background(), NewSessionInfo(testConnMetadata{user: "bob"})))
+		server.Close()
+	}()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Stat("/")
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"bob"}, users)
+}
+
+func TestSessionFromContext(t *testing.T) {
+	_, ok := SessionFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = SessionFromContext(ContextWithSession(context.Background(), nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,145 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// SessionEndReason describes why an SFTP session ended.
+type SessionEndReason int
+
+// Reasons for the end of a session.
+const (
+	// SessionEndEOF means the client closed the connection cleanly, in between requests.
+	SessionEndEOF SessionEndReason = iota
+
+	// SessionEndError means the connection failed, or the client sent an invalid packet.
+	SessionEndError
+
+	// SessionEndShutdown means the server was closed with Close.
+	SessionEndShutdown
+)
+
+func (r SessionEndReason) String() string {
+	switch r {
+	case SessionEndEOF:
+		return "eof"
+	case SessionEndError:
+		return "error"
+	case SessionEndShutdown:
+		return "shutdown"
+	default:
+		return "unknown"
+	}
+}
+
+// SessionSummary summarizes an SFTP session, for accounting once it has ended.
+type SessionSummary struct {
+	// Start and End are the times at which Serve was called, and returned.
+	Start, End time.Time
+
+	// Requests is the number of requests answered.
+	Requests int64
+
+	// FilesOpened is the number of files opened successfully, not counting directories.
+	FilesOpened int64
+
+	// BytesRead and BytesWritten are the number of bytes read from, and written to, files.
+	BytesRead, BytesWritten int64
+
+	// Errors is the number of requests which failed.
+	// The end of a file or directory, SSH_FX_EOF, is not counted as a failure.
+	Errors int64
+
+	// Reason is why the session ended.
+	Reason SessionEndReason
+
+	// Err is the error which ended the session, as returned by Serve.
+	Err error
+}
+
+// WithSessionEndHook sets a function to be called when Serve returns,
+// with a summary of the session, so that one accounting record can be emitted per session.
+func WithSessionEndHook(hook func(*SessionSummary)) ServerOption {
+	return func(s *Server) error {
+		s.pktMgr.stats = &sessionStats{hook: hook}
+		return nil
+	}
+}
+
+// WithRSSessionEndHook sets a function to be called when Serve returns,
+// with a summary of the session, in the same way as WithSessionEndHook.
+func WithRSSessionEndHook(hook func(*SessionSummary)) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pktMgr.stats = &sessionStats{hook: hook}
+	}
+}
+
+// sessionStats accumulates the counts of a SessionSummary, as requests are answered by concurrent workers.
+type sessionStats struct {
+	requests     int64
+	filesOpened  int64
+	bytesRead    int64
+	bytesWritten int64
+	errors       int64
+
+	start time.Time
+	hook  func(*SessionSummary)
+}
+
+func (st *sessionStats) begin() {
+	st.start = time.Now()
+}
+
+// record accounts for the response resp to the request req.
+func (st *sessionStats) record(req requestPacket, resp responsePacket) {
+	atomic.AddInt64(&st.requests, 1)
+
+	switch resp := resp.(type) {
+	case *sshFxpStatusPacket:
+		switch resp.Code {
+		case sshFxOk:
+			if req, ok := req.(*sshFxpWritePacket); ok {
+				atomic.AddInt64(&st.bytesWritten, int64(len(req.Data)))
+			}
+		case sshFxEOF:
+		default:
+			atomic.AddInt64(&st.errors, 1)
+		}
+
+	case *sshFxpHandlePacket:
+		if _, ok := req.(*sshFxpOpenPacket); ok {
+			atomic.AddInt64(&st.filesOpened, 1)
+		}
+
+	case *sshFxpDataPacket:
+		atomic.AddInt64(&st.bytesRead, int64(resp.Length))
+	}
+}
+
+// end calls the hook with the summary of the session on the connection conn, which ended with err.
+func (st *sessionStats) end(conn *serverConn, err error) {
+	summary := &SessionSummary{
+		Start:        st.start,
+		End:          time.Now(),
+		Requests:     atomic.LoadInt64(&st.requests),
+		FilesOpened:  atomic.LoadInt64(&st.filesOpened),
+		BytesRead:    atomic.LoadInt64(&st.bytesRead),
+		BytesWritten: atomic.LoadInt64(&st.bytesWritten),
+		Errors:       atomic.LoadInt64(&st.errors),
+		Err:          err,
+	}
+
+	switch {
+	case atomic.LoadInt32(&conn.shutdown) != 0:
+		summary.Reason = SessionEndShutdown
+	case err == nil || errors.Is(err, io.EOF):
+		summary.Reason = SessionEndEOF
+	default:
+		summary.Reason = SessionEndError
+	}
+
+	st.hook(summary)
+}
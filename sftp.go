@@ -89,6 +89,15 @@ var (
 		{"hardlink@openssh.com", "1"},
 		{"posix-rename@openssh.com", "1"},
 		{"statvfs@openssh.com", "2"},
+		{"limits@openssh.com", "1"},
+		{"expand-path@openssh.com", "1"},
+		{"copy-data@openssh.com", "1"},
+		{"copy-file", "1"},
+		{"check-file", "1"},
+		{"ping@pkg.sftp", "1"},
+		{"cancel@pkg.sftp", "1"},
+		{"write-ack-batch@pkg.sftp", "1"},
+		{"generation@pkg.sftp", "1"},
 	}
 	sftpExtensions = supportedSFTPExtensions
 )
@@ -209,6 +218,18 @@ func unexpectedCount(want, got uint32) error {
 	return fmt.Errorf("sftp: unexpected count: want %d, got %d", want, got)
 }
 
+// maxHandleLength is the maximum length of a handle, as set by the specification.
+const maxHandleLength = 256
+
+type invalidHandleErr struct{ length int }
+
+func (e *invalidHandleErr) Error() string {
+	if e.length == 0 {
+		return "sftp: invalid handle: server returned an empty handle"
+	}
+	return fmt.Sprintf("sftp: invalid handle: server returned a handle of %d bytes, the limit is %d", e.length, maxHandleLength)
+}
+
 type unexpectedVersionErr struct{ want, got uint32 }
 
 func (u *unexpectedVersionErr) Error() string {
@@ -220,6 +241,8 @@ func (u *unexpectedVersionErr) Error() string {
 type StatusError struct {
 	Code      uint32
 	msg, lang string
+
+	decoded error // recognized from msg, see UseErrorMessageDecoding
 }
 
 func (s *StatusError) Error() string {
@@ -231,6 +254,18 @@ func (s *StatusError) FxCode() fxerr {
 	return fxerr(s.Code)
 }
 
+// Is reports whether target is the error code of the status, such as ErrSSHFxQuotaExceeded,
+// so that errors.Is can be used as well as FxCode.
+func (s *StatusError) Is(target error) bool {
+	code, ok := target.(fxerr)
+	return ok && code == s.FxCode()
+}
+
+// Unwrap returns the error recognized from the message of a generic failure, see UseErrorMessageDecoding.
+func (s *StatusError) Unwrap() error {
+	return s.decoded
+}
+
 func getSupportedExtensionByName(extensionName string) (sshExtensionPair, error) {
 	for _, supportedExtension := range supportedSFTPExtensions {
 		if supportedExtension.Name == extensionName {
@@ -0,0 +1,104 @@
+package sftpbench
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var errWriterClosed = errors.New("sftpbench: write to closed link")
+
+type delayedWrite struct {
+	due time.Time
+	b   []byte
+}
+
+// delayedWriter passes each write on to the underlying writer once delay has passed since it was made,
+// in order, without waiting for those before it to be passed on, so that it adds latency, but keeps the throughput.
+type delayedWriter struct {
+	w     io.WriteCloser
+	delay time.Duration
+
+	mu     sync.Mutex
+	ch     chan delayedWrite
+	closed bool
+
+	errMu sync.Mutex // not mu, which a Write holds while it waits for room in ch
+	err   error      // of the underlying writer, once a write has failed
+
+	done chan struct{}
+}
+
+func newDelayedWriter(w io.WriteCloser, delay time.Duration) io.WriteCloser {
+	if delay <= 0 {
+		return w
+	}
+
+	dw := &delayedWriter{
+		w:     w,
+		delay: delay,
+		ch:    make(chan delayedWrite, 1024),
+		done:  make(chan struct{}),
+	}
+	go dw.run()
+	return dw
+}
+
+func (dw *delayedWriter) run() {
+	defer close(dw.done)
+	defer dw.w.Close()
+
+	for write := range dw.ch {
+		time.Sleep(time.Until(write.due))
+
+		if _, err := dw.w.Write(write.b); err != nil {
+			dw.errMu.Lock()
+			dw.err = err
+			dw.errMu.Unlock()
+
+			for range dw.ch {
+				// drain, until closed
+			}
+			return
+		}
+	}
+}
+
+func (dw *delayedWriter) Write(b []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	if dw.closed {
+		return 0, errWriterClosed
+	}
+	if err := dw.writeErr(); err != nil {
+		return 0, err
+	}
+
+	dw.ch <- delayedWrite{
+		due: time.Now().Add(dw.delay),
+		b:   append([]byte(nil), b...),
+	}
+	return len(b), nil
+}
+
+func (dw *delayedWriter) writeErr() error {
+	dw.errMu.Lock()
+	defer dw.errMu.Unlock()
+
+	return dw.err
+}
+
+// Close closes the underlying writer, once the writes made before are passed on.
+func (dw *delayedWriter) Close() error {
+	dw.mu.Lock()
+	if !dw.closed {
+		dw.closed = true
+		close(dw.ch)
+	}
+	dw.mu.Unlock()
+
+	<-dw.done
+	return nil
+}
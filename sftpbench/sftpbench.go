@@ -0,0 +1,255 @@
+// Package sftpbench runs standard transfer benchmarks of the sftp Client,
+// against an in-process RequestServer serving files from memory, over a link with a simulated round trip time.
+//
+// Each Scenario reports the throughput of its transfer, in MB/s, so that the sequential and concurrent paths of the Client
+// can be compared, regressions in them caught, and the number of requests in flight sized for a given latency,
+// from a benchmark of any package:
+//
+//	func BenchmarkTransfers(b *testing.B) {
+//		sftpbench.Run(b, sftpbench.DefaultScenarios())
+//	}
+//
+// The server serves from memory, and so measures the Client, and the protocol, rather than a filesystem.
+package sftpbench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// Direction is the direction of the transfer of a Scenario.
+type Direction int
+
+// The directions of transfers.
+const (
+	Download Direction = iota
+	Upload
+)
+
+func (d Direction) String() string {
+	if d == Upload {
+		return "upload"
+	}
+	return "download"
+}
+
+// Method is the way the Client transfers the data of a Scenario.
+type Method int
+
+// The methods of transfer.
+const (
+	// Sequential reads or writes the file with File.Read or File.Write, one buffer at a time,
+	// so that each request waits for the one before it.
+	Sequential Method = iota
+
+	// Concurrent downloads with File.WriteTo, and uploads with File.ReadFrom, with concurrent writes enabled,
+	// which keep up to MaxInflight requests in flight.
+	Concurrent
+)
+
+func (m Method) String() string {
+	if m == Concurrent {
+		return "concurrent"
+	}
+	return "sequential"
+}
+
+// sequentialBufferSize is the size of each File.Read or File.Write of the Sequential method.
+const sequentialBufferSize = 32 << 10
+
+// A Scenario is a single transfer of a file.
+type Scenario struct {
+	Direction Direction
+	Method    Method
+
+	// Size is the size of the file transferred, in bytes.
+	Size int64
+
+	// RTT is the simulated round trip time of the link to the server, half of which delays each packet.
+	RTT time.Duration
+
+	// MaxInflight is the number of requests the Client keeps in flight for a file, see sftp.MaxConcurrentRequestsPerFile.
+	// Zero keeps the default of the Client.
+	MaxInflight int
+}
+
+// String returns the name of the benchmark of s, such as "download/concurrent/4MiB/rtt=10ms/inflight=64".
+func (s Scenario) String() string {
+	name := fmt.Sprintf("%v/%v/%s/rtt=%v", s.Direction, s.Method, formatSize(s.Size), s.RTT)
+	if s.MaxInflight > 0 {
+		name += fmt.Sprintf("/inflight=%d", s.MaxInflight)
+	}
+	return name
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// Scenarios returns the scenarios of each direction and method, transferring size bytes, at each of the rtts.
+// The Concurrent scenarios are repeated for each of inflights.
+func Scenarios(size int64, rtts []time.Duration, inflights []int) []Scenario {
+	if len(inflights) == 0 {
+		inflights = []int{0}
+	}
+
+	var scenarios []Scenario
+	for _, dir := range []Direction{Download, Upload} {
+		for _, rtt := range rtts {
+			scenarios = append(scenarios, Scenario{Direction: dir, Method: Sequential, Size: size, RTT: rtt})
+			for _, n := range inflights {
+				scenarios = append(scenarios, Scenario{Direction: dir, Method: Concurrent, Size: size, RTT: rtt, MaxInflight: n})
+			}
+		}
+	}
+	return scenarios
+}
+
+// DefaultScenarios returns the standard scenarios, transferring 4 MiB, with no latency, and with round trips of 10ms and 50ms,
+// and for the Concurrent method, with 16 and 64 requests in flight.
+func DefaultScenarios() []Scenario {
+	return Scenarios(4<<20, []time.Duration{0, 10 * time.Millisecond, 50 * time.Millisecond}, []int{16, 64})
+}
+
+// Run runs each of the scenarios as a sub-benchmark of b, named by Scenario.String,
+// with the Client configured by opts, in addition to the options of the Scenario.
+func Run(b *testing.B, scenarios []Scenario, opts ...sftp.ClientOption) {
+	for _, s := range scenarios {
+		s := s
+		b.Run(s.String(), func(b *testing.B) {
+			RunScenario(b, s, opts...)
+		})
+	}
+}
+
+// RunScenario runs the Scenario s as the benchmark b, transferring the file b.N times,
+// with the Client configured by opts, in addition to the options of the Scenario.
+// The throughput is reported with b.SetBytes, as MB/s.
+func RunScenario(b *testing.B, s Scenario, opts ...sftp.ClientOption) {
+	b.Helper()
+
+	if s.Method == Concurrent {
+		opts = append(opts, sftp.UseConcurrentWrites(true))
+	} else {
+		opts = append(opts, sftp.UseConcurrentReads(false))
+	}
+	if s.MaxInflight > 0 {
+		opts = append(opts, sftp.MaxConcurrentRequestsPerFile(s.MaxInflight))
+	}
+
+	client, closeServer, err := NewPair(s.RTT, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	defer closeServer() // first, as the Client waits for the server to hang up
+
+	data := make([]byte, s.Size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	if s.Direction == Download {
+		if err := upload(client, "/file", data, Concurrent); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.SetBytes(s.Size)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var err error
+		if s.Direction == Download {
+			err = download(client, "/file", s.Size, s.Method)
+		} else {
+			err = upload(client, "/file", data, s.Method)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func upload(client *sftp.Client, name string, data []byte, m Method) error {
+	f, err := client.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if m == Concurrent {
+		_, err = f.ReadFrom(bytes.NewReader(data))
+	} else {
+		// hide the WriterTo of the reader, so that io.CopyBuffer writes a buffer at a time.
+		_, err = io.CopyBuffer(f, struct{ io.Reader }{bytes.NewReader(data)}, make([]byte, sequentialBufferSize))
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func download(client *sftp.Client, name string, size int64, m Method) error {
+	f, err := client.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var n int64
+	if m == Concurrent {
+		n, err = f.WriteTo(ioutil.Discard)
+	} else {
+		n, err = io.CopyBuffer(struct{ io.Writer }{ioutil.Discard}, struct{ io.Reader }{f}, make([]byte, sequentialBufferSize))
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("sftpbench: downloaded %d bytes, want %d", n, size)
+	}
+	return nil
+}
+
+// NewPair returns a Client, configured by opts, connected to a new RequestServer serving files from memory,
+// over a link that delays each packet by half of rtt, in each direction,
+// and a function to close the server.
+//
+// The link only adds latency, not a limit of bandwidth, and so a Client that keeps enough requests in flight
+// is as fast as without latency.
+func NewPair(rtt time.Duration, opts ...sftp.ClientOption) (*sftp.Client, func() error, error) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server := sftp.NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, newDelayedWriter(sw, rtt/2)}, sftp.InMemHandler())
+	go server.Serve()
+
+	closeServer := func() error {
+		// unblocks the link to the client, if the client no longer reads.
+		cr.Close()
+		return server.Close()
+	}
+
+	client, err := sftp.NewClientPipe(cr, newDelayedWriter(cw, rtt/2), opts...)
+	if err != nil {
+		closeServer()
+		return nil, nil, err
+	}
+	return client, closeServer, nil
+}
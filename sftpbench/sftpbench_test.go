@@ -0,0 +1,69 @@
+package sftpbench
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios := Scenarios(4<<20, []time.Duration{0, 10 * time.Millisecond}, []int{16, 64})
+	assert.Len(t, scenarios, 2*2*3)
+	assert.Equal(t, "download/sequential/4MiB/rtt=0s", scenarios[0].String())
+	assert.Equal(t, "download/concurrent/4MiB/rtt=0s/inflight=16", scenarios[1].String())
+	assert.Equal(t, "upload/concurrent/4MiB/rtt=10ms/inflight=64", scenarios[len(scenarios)-1].String())
+}
+
+func TestDelayedWriter(t *testing.T) {
+	r, w := io.Pipe()
+	dw := newDelayedWriter(w, 20*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_, err := dw.Write([]byte{byte(i)})
+		require.NoError(t, err)
+	}
+	// the writes are not delayed, only their delivery.
+	assert.Less(t, int64(time.Since(start)), int64(20*time.Millisecond))
+
+	go dw.Close()
+
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, b)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(20*time.Millisecond))
+	// delivered together, rather than each after the one before.
+	assert.Less(t, int64(time.Since(start)), int64(150*time.Millisecond))
+}
+
+func TestTransfers(t *testing.T) {
+	client, closeServer, err := NewPair(2 * time.Millisecond)
+	require.NoError(t, err)
+	defer client.Close()
+	defer closeServer()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+
+	for _, m := range []Method{Sequential, Concurrent} {
+		require.NoError(t, upload(client, "/file", data, m), m)
+		require.NoError(t, download(client, "/file", int64(len(data)), m), m)
+
+		f, err := client.Open("/file")
+		require.NoError(t, err)
+		got, err := ioutil.ReadAll(f)
+		require.NoError(t, err)
+		f.Close()
+		assert.Equal(t, data, got)
+	}
+
+	assert.Error(t, download(client, "/file", int64(len(data))+1, Concurrent))
+}
+
+func BenchmarkDefaultScenarios(b *testing.B) {
+	Run(b, DefaultScenarios())
+}
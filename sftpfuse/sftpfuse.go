@@ -0,0 +1,351 @@
+// Package sftpfuse adapts the sftp Client to the callbacks of FUSE filesystems, such as those of sshfs,
+// without depending on any particular FUSE library.
+//
+// The callbacks of FUSE differ from the API of the Client in three ways, which FS takes care of:
+//
+//   - Reads and writes are stateless, at an offset, and may be issued concurrently on the same handle.
+//     A Handle reads and writes at an offset, without a file offset, and reads as much as was asked for,
+//     short only at the end of the file, as the kernel expects.
+//   - The kernel asks for the attributes of paths far more often than they change.
+//     FS caches them for a while, see Options.AttrTTL, and invalidates them on every change made through it,
+//     calling Options.OnInvalidate so that the cache of the kernel can be invalidated as well.
+//   - Each open of a file by a process is a separate FUSE open.
+//     FS shares the open files of the server between the opens of the same path, with the same flags,
+//     so that a file opened many times holds a single handle on the server.
+//
+// Changes made on the server by others are only seen once the attributes cached expire.
+package sftpfuse
+
+import (
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// attrTTLDefault is how long attributes are cached, unless Options.AttrTTL is given.
+const attrTTLDefault = time.Second
+
+// Options configures an FS.
+type Options struct {
+	// AttrTTL is how long the attributes of a path are cached, by default one second.
+	// A negative AttrTTL disables the cache.
+	AttrTTL time.Duration
+
+	// OnInvalidate, if not nil, is called with each path whose attributes are invalidated,
+	// because of a change made through the FS, such as a write, a rename, or a removal.
+	// It is called without any lock held, and so may call back into the FUSE library.
+	OnInvalidate func(name string)
+}
+
+// FS serves the files of the server of a Client to the callbacks of a FUSE filesystem.
+// All its methods are safe for concurrent use.
+type FS struct {
+	c    *sftp.Client
+	opts Options
+
+	mu      sync.Mutex
+	attrs   map[string]attrEntry
+	handles map[handleKey]*Handle
+}
+
+type attrEntry struct {
+	fi      os.FileInfo
+	expires time.Time
+}
+
+type handleKey struct {
+	name  string
+	flags int
+}
+
+// New returns an FS serving the files of the server of c.
+// A nil opts is the same as the zero Options.
+func New(c *sftp.Client, opts *Options) *FS {
+	fs := &FS{
+		c:       c,
+		attrs:   make(map[string]attrEntry),
+		handles: make(map[handleKey]*Handle),
+	}
+	if opts != nil {
+		fs.opts = *opts
+	}
+	if fs.opts.AttrTTL == 0 {
+		fs.opts.AttrTTL = attrTTLDefault
+	}
+	return fs
+}
+
+// Getattr returns the attributes of name, without following a symbolic link, as lstat,
+// from the cache, if they have not expired.
+func (fs *FS) Getattr(name string) (os.FileInfo, error) {
+	name = path.Clean(name)
+
+	fs.mu.Lock()
+	e, ok := fs.attrs[name]
+	fs.mu.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.fi, nil
+	}
+
+	fi, err := fs.c.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	fs.cache(name, fi)
+	return fi, nil
+}
+
+// cache caches the attributes fi of name.
+func (fs *FS) cache(name string, fi os.FileInfo) {
+	if fs.opts.AttrTTL < 0 {
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.attrs[name] = attrEntry{fi: fi, expires: time.Now().Add(fs.opts.AttrTTL)}
+}
+
+// Invalidate drops the cached attributes of each of the names,
+// and calls Options.OnInvalidate for each of them.
+// It is called by the FS for the paths it changes, and may be called for changes made otherwise.
+func (fs *FS) Invalidate(names ...string) {
+	cleaned := make([]string, len(names))
+
+	fs.mu.Lock()
+	for i, name := range names {
+		cleaned[i] = path.Clean(name)
+		delete(fs.attrs, cleaned[i])
+	}
+	fs.mu.Unlock()
+
+	if fs.opts.OnInvalidate != nil {
+		for _, name := range cleaned {
+			fs.opts.OnInvalidate(name)
+		}
+	}
+}
+
+// invalidateEntry invalidates name, and its parent directory, whose modification time changes with its entries.
+func (fs *FS) invalidateEntry(name string) {
+	name = path.Clean(name)
+	fs.Invalidate(name, path.Dir(name))
+}
+
+// Readdir returns the entries of the directory name, and caches their attributes.
+func (fs *FS) Readdir(name string) ([]os.FileInfo, error) {
+	name = path.Clean(name)
+
+	entries, err := fs.c.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range entries {
+		fs.cache(path.Join(name, fi.Name()), fi)
+	}
+	return entries, nil
+}
+
+// Readlink returns the target of the symbolic link name.
+func (fs *FS) Readlink(name string) (string, error) {
+	return fs.c.ReadLink(name)
+}
+
+// Mkdir creates the directory name, with the permissions perm.
+func (fs *FS) Mkdir(name string, perm os.FileMode) error {
+	defer fs.invalidateEntry(name)
+
+	if err := fs.c.Mkdir(name); err != nil {
+		return err
+	}
+	return fs.c.Chmod(name, perm)
+}
+
+// Unlink removes the file name.
+func (fs *FS) Unlink(name string) error {
+	defer fs.invalidateEntry(name)
+	return fs.c.Remove(name)
+}
+
+// Rmdir removes the empty directory name.
+func (fs *FS) Rmdir(name string) error {
+	defer fs.invalidateEntry(name)
+	return fs.c.RemoveDirectory(name)
+}
+
+// Rename renames oldname to newname, replacing newname if it exists, as rename(2),
+// if the server supports posix-rename@openssh.com, and otherwise failing if newname exists.
+func (fs *FS) Rename(oldname, newname string) error {
+	defer fs.invalidateEntry(oldname)
+	defer fs.invalidateEntry(newname)
+
+	if _, ok := fs.c.HasExtension("posix-rename@openssh.com"); ok {
+		return fs.c.PosixRename(oldname, newname)
+	}
+	return fs.c.Rename(oldname, newname)
+}
+
+// Symlink creates the symbolic link name, to target.
+func (fs *FS) Symlink(target, name string) error {
+	defer fs.invalidateEntry(name)
+	return fs.c.Symlink(target, name)
+}
+
+// Link creates the hard link newname, to oldname.
+func (fs *FS) Link(oldname, newname string) error {
+	defer fs.invalidateEntry(newname)
+	defer fs.Invalidate(oldname) // its number of links
+	return fs.c.Link(oldname, newname)
+}
+
+// Truncate changes the size of the file name.
+func (fs *FS) Truncate(name string, size int64) error {
+	defer fs.Invalidate(name)
+	return fs.c.Truncate(name, size)
+}
+
+// Chmod changes the permissions of name.
+func (fs *FS) Chmod(name string, mode os.FileMode) error {
+	defer fs.Invalidate(name)
+	return fs.c.Chmod(name, mode)
+}
+
+// Chown changes the owner and group of name.
+func (fs *FS) Chown(name string, uid, gid int) error {
+	defer fs.Invalidate(name)
+	return fs.c.Chown(name, uid, gid)
+}
+
+// Chtimes changes the access and modification times of name.
+func (fs *FS) Chtimes(name string, atime, mtime time.Time) error {
+	defer fs.Invalidate(name)
+	return fs.c.Chtimes(name, atime, mtime)
+}
+
+// Open opens the file name with the flags of os.OpenFile, such as os.O_RDONLY, or os.O_RDWR|os.O_CREATE.
+// The File on the server is shared with the other Handles open on name with the same flags,
+// unless the flags include os.O_TRUNC, or os.O_EXCL, whose effect is that of each open.
+// Each Handle must be released with Release.
+func (fs *FS) Open(name string, flags int) (*Handle, error) {
+	name = path.Clean(name)
+	key := handleKey{name: name, flags: flags}
+	shared := flags&(os.O_TRUNC|os.O_EXCL) == 0
+
+	if shared {
+		fs.mu.Lock()
+		if h, ok := fs.handles[key]; ok {
+			h.refs++
+			fs.mu.Unlock()
+			return h, nil
+		}
+		fs.mu.Unlock()
+	}
+
+	f, err := fs.c.OpenFile(name, flags)
+	if err != nil {
+		return nil, err
+	}
+	if flags&(os.O_CREATE|os.O_TRUNC) != 0 {
+		fs.invalidateEntry(name)
+	}
+
+	h := &Handle{fs: fs, key: key, f: f, refs: 1}
+	if !shared {
+		return h, nil
+	}
+
+	fs.mu.Lock()
+	if other, ok := fs.handles[key]; ok {
+		// opened concurrently: share the one registered first.
+		other.refs++
+		fs.mu.Unlock()
+
+		f.Close()
+		return other, nil
+	}
+	fs.handles[key] = h
+	h.shared = true
+	fs.mu.Unlock()
+
+	return h, nil
+}
+
+// Create creates the file name, with the permissions perm, failing if it exists, as open with O_CREAT|O_EXCL,
+// and opens it for reading and writing.
+func (fs *FS) Create(name string, perm os.FileMode) (*Handle, error) {
+	name = path.Clean(name)
+
+	f, err := fs.c.CreateExclusive(name, perm)
+	if err != nil {
+		return nil, err
+	}
+	fs.invalidateEntry(name)
+
+	return &Handle{fs: fs, key: handleKey{name: name, flags: os.O_RDWR | os.O_CREATE | os.O_EXCL}, f: f, refs: 1}, nil
+}
+
+// A Handle is an open file of an FS.
+// Its reads and writes are at an offset, and may be made concurrently.
+type Handle struct {
+	fs  *FS
+	key handleKey
+	f   *sftp.File
+
+	// guarded by fs.mu
+	refs   int
+	shared bool
+}
+
+// Name returns the name of the file open.
+func (h *Handle) Name() string {
+	return h.key.name
+}
+
+// ReadAt reads len(b) bytes of the file, from the offset off,
+// and returns fewer only at the end of the file, with a nil error, as FUSE expects of a read.
+func (h *Handle) ReadAt(b []byte, off int64) (int, error) {
+	n, err := h.f.ReadFull(b, off)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+// WriteAt writes all of b to the file, at the offset off,
+// and invalidates the attributes of the file, whose size and modification time change.
+func (h *Handle) WriteAt(b []byte, off int64) (int, error) {
+	defer h.fs.Invalidate(h.key.name)
+	return h.f.WriteFull(b, off)
+}
+
+// Getattr returns the attributes of the open file, as fstat, which are not cached.
+func (h *Handle) Getattr() (os.FileInfo, error) {
+	return h.f.Stat()
+}
+
+// Fsync flushes the file to stable storage on the server, if it supports fsync@openssh.com.
+func (h *Handle) Fsync() error {
+	return h.f.Sync()
+}
+
+// Release releases the Handle, and closes the file on the server once all the Handles sharing it are released.
+func (h *Handle) Release() error {
+	h.fs.mu.Lock()
+	h.refs--
+	last := h.refs == 0
+	if last && h.shared {
+		delete(h.fs.handles, h.key)
+	}
+	h.fs.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return h.f.Close()
+}
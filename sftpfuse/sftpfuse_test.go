@@ -0,0 +1,155 @@
+package sftpfuse
+
+import (
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkg/sftp"
+)
+
+// newClient returns a Client of a RequestServer serving files from memory.
+func newClient(t *testing.T) *sftp.Client {
+	t.Helper()
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server := sftp.NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, sftp.InMemHandler())
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(cr, cw)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		server.Close() // first, as the Client waits for the server to hang up
+		client.Close()
+	})
+	return client
+}
+
+type invalidations struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (inv *invalidations) record(name string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.names = append(inv.names, name)
+}
+
+func (inv *invalidations) take() []string {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	names := inv.names
+	inv.names = nil
+	return names
+}
+
+func TestAttrCache(t *testing.T) {
+	client := newClient(t)
+
+	var inv invalidations
+	fs := New(client, &Options{AttrTTL: time.Hour, OnInvalidate: inv.record})
+
+	h, err := fs.Create("/dir/../file", 0o644)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/file", "/"}, inv.take())
+
+	fi, err := fs.Getattr("/file")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, fi.Size())
+
+	// a change made otherwise is not seen until invalidated.
+	f, err := client.OpenFile("/file", os.O_WRONLY)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("hidden"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fi, err = fs.Getattr("/file")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, fi.Size())
+
+	// but a change made through the FS is.
+	_, err = h.WriteAt([]byte("hello, world"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/file"}, inv.take())
+
+	fi, err = fs.Getattr("/file")
+	require.NoError(t, err)
+	assert.EqualValues(t, 12, fi.Size())
+	require.NoError(t, h.Release())
+
+	require.NoError(t, fs.Rename("/file", "/renamed"))
+	assert.ElementsMatch(t, []string{"/file", "/", "/renamed", "/"}, inv.take())
+
+	_, err = fs.Getattr("/file")
+	assert.True(t, os.IsNotExist(err), err)
+}
+
+func TestHandleReadAt(t *testing.T) {
+	client := newClient(t)
+	fs := New(client, nil)
+
+	h, err := fs.Create("/file", 0o644)
+	require.NoError(t, err)
+	_, err = h.WriteAt([]byte("0123456789"), 0)
+	require.NoError(t, err)
+
+	// short only at the end of the file, without an error.
+	b := make([]byte, 8)
+	n, err := h.ReadAt(b, 6)
+	require.NoError(t, err)
+	assert.Equal(t, "6789", string(b[:n]))
+
+	n, err = h.ReadAt(b, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	require.NoError(t, h.Release())
+}
+
+func TestHandleSharing(t *testing.T) {
+	client := newClient(t)
+	fs := New(client, nil)
+
+	h, err := fs.Create("/file", 0o644)
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+
+	h1, err := fs.Open("/file", os.O_RDONLY)
+	require.NoError(t, err)
+	h2, err := fs.Open("/file", os.O_RDONLY)
+	require.NoError(t, err)
+	assert.Same(t, h1, h2)
+
+	h3, err := fs.Open("/file", os.O_RDWR)
+	require.NoError(t, err)
+	assert.NotSame(t, h1, h3)
+	require.NoError(t, h3.Release())
+
+	require.NoError(t, h1.Release())
+	_, err = h2.Getattr()
+	assert.NoError(t, err, "still open, for the second open")
+
+	require.NoError(t, h2.Release())
+	_, err = h2.Getattr()
+	assert.Error(t, err)
+
+	h4, err := fs.Open("/file", os.O_RDONLY)
+	require.NoError(t, err)
+	assert.NotSame(t, h1, h4)
+	require.NoError(t, h4.Release())
+}
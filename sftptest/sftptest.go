@@ -0,0 +1,225 @@
+// Package sftptest provides an in-process sftp Client connected to a server, for the integration tests of
+// packages built on the sftp package, so that they test against exactly the behavior of the library,
+// rather than a mock of it:
+//
+//	func TestUpload(t *testing.T) {
+//		p := sftptest.NewPair(t)
+//
+//		if err := upload(p.Client, "/dir/file"); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+//
+// By default the server is a RequestServer serving files from memory, see WithHandlers and WithServer for others.
+// The connection between the two can be made to fail, see Pair.Break and Pair.Stall.
+package sftptest
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// An Option configures the Pair of NewPair.
+type Option func(*config)
+
+type config struct {
+	handlers *sftp.Handlers
+	server   bool
+	svrOpts  []sftp.ServerOption
+	rsOpts   []sftp.RequestServerOption
+	cliOpts  []sftp.ClientOption
+}
+
+// WithHandlers serves the requests of the Client with the given Handlers, in place of the files in memory of sftp.InMemHandler.
+func WithHandlers(h sftp.Handlers) Option {
+	return func(c *config) {
+		c.handlers = &h
+		c.server = false
+	}
+}
+
+// WithRequestServerOptions configures the RequestServer with the given options.
+func WithRequestServerOptions(opts ...sftp.RequestServerOption) Option {
+	return func(c *config) {
+		c.rsOpts = append(c.rsOpts, opts...)
+	}
+}
+
+// WithServer serves the requests of the Client with a Server, on the local filesystem,
+// configured with the given options, in place of a RequestServer.
+func WithServer(opts ...sftp.ServerOption) Option {
+	return func(c *config) {
+		c.server = true
+		c.svrOpts = append(c.svrOpts, opts...)
+	}
+}
+
+// WithClientOptions configures the Client with the given options.
+func WithClientOptions(opts ...sftp.ClientOption) Option {
+	return func(c *config) {
+		c.cliOpts = append(c.cliOpts, opts...)
+	}
+}
+
+// A Pair is a Client connected to a server over in-memory pipes.
+type Pair struct {
+	Client *sftp.Client
+
+	cr *io.PipeReader // of the responses to the Client
+	fr *faultReader
+
+	serveErr  error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPair returns a Client connected to a new server, configured by opts.
+// The Pair is closed in the cleanup of t, and it fails t if it cannot be set up.
+func NewPair(t testing.TB, opts ...Option) *Pair {
+	t.Helper()
+
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	rwc := struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}
+
+	var serve, closeServer func() error
+	if cfg.server {
+		svr, err := sftp.NewServer(rwc, cfg.svrOpts...)
+		if err != nil {
+			t.Fatal("sftptest: new server:", err)
+		}
+		serve, closeServer = svr.Serve, svr.Close
+	} else {
+		h := sftp.InMemHandler()
+		if cfg.handlers != nil {
+			h = *cfg.handlers
+		}
+		rs := sftp.NewRequestServer(rwc, h, cfg.rsOpts...)
+		serve, closeServer = rs.Serve, rs.Close
+	}
+
+	p := &Pair{
+		cr:   cr,
+		fr:   newFaultReader(cr),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.done)
+
+		err := serve()
+		closeServer() // as a RequestServer does not hang up on its own.
+		if err != io.EOF {
+			p.serveErr = err
+		}
+	}()
+
+	client, err := sftp.NewClientPipe(p.fr, cw, cfg.cliOpts...)
+	if err != nil {
+		cw.Close()
+		cr.Close()
+		<-p.done
+		t.Fatal("sftptest: new client:", err)
+	}
+	p.Client = client
+
+	t.Cleanup(func() {
+		p.Close()
+	})
+
+	return p
+}
+
+// Break breaks the connection from the side of the Client, as a lost network connection would.
+// Requests in flight, and any made after, fail with sftp.ErrSSHFxConnectionLost,
+// while the server only sees the connection end once the Pair is closed.
+func (p *Pair) Break() {
+	p.fr.breakLink()
+	p.cr.CloseWithError(io.ErrClosedPipe)
+}
+
+// Stall holds back the responses of the server from the Client, until Resume,
+// so that requests time out, or can be cancelled, while the server carries on.
+func (p *Pair) Stall() {
+	p.fr.setStalled(true)
+}
+
+// Resume passes the responses held back since Stall on to the Client, in order.
+func (p *Pair) Resume() {
+	p.fr.setStalled(false)
+}
+
+// Close closes the Client, and waits for the server to finish.
+// It returns the error the server ended with, if it did not end with the connection, and is called in the cleanup of the test.
+func (p *Pair) Close() error {
+	p.closeOnce.Do(func() {
+		p.fr.setStalled(false)
+		if p.Client != nil {
+			p.Client.Close()
+		}
+		<-p.done
+	})
+	return p.serveErr
+}
+
+var errBroken = errors.New("sftptest: connection broken")
+
+// faultReader reads the responses to the Client, holding them back while stalled.
+type faultReader struct {
+	r io.Reader
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	stalled bool
+	broken  bool
+}
+
+func newFaultReader(r io.Reader) *faultReader {
+	fr := &faultReader{r: r}
+	fr.cond = sync.NewCond(&fr.mu)
+	return fr
+}
+
+func (fr *faultReader) setStalled(stalled bool) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.stalled = stalled
+	fr.cond.Broadcast()
+}
+
+func (fr *faultReader) breakLink() {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	fr.broken = true
+	fr.cond.Broadcast()
+}
+
+// Read reads before waiting, so that a response that arrives while stalled is held, even if the read began before.
+func (fr *faultReader) Read(b []byte) (int, error) {
+	n, err := fr.r.Read(b)
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	for fr.stalled && !fr.broken {
+		fr.cond.Wait()
+	}
+	if fr.broken {
+		return 0, errBroken
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package sftptest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+func TestPair(t *testing.T) {
+	p := NewPair(t)
+
+	f, err := p.Client.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := p.Client.Stat("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", fi.Size())
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestPairWithServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPair(t, WithServer(sftp.ReadOnly()))
+
+	fi, err := p.Client.Stat(filepath.ToSlash(filepath.Join(dir, "file")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", fi.Size())
+	}
+
+	if err := p.Client.Remove(filepath.ToSlash(filepath.Join(dir, "file"))); err == nil {
+		t.Error("Remove() succeeded on a read-only server")
+	}
+}
+
+func TestPairBreak(t *testing.T) {
+	p := NewPair(t)
+
+	if _, err := p.Client.Getwd(); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Break()
+
+	if _, err := p.Client.Stat("/"); !errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		t.Errorf("Stat() after Break = %v, want %v", err, sftp.ErrSSHFxConnectionLost)
+	}
+}
+
+func TestPairStall(t *testing.T) {
+	p := NewPair(t, WithClientOptions(sftp.WithRequestTimeout(50*time.Millisecond)))
+
+	p.Stall()
+	if _, err := p.Client.Stat("/"); err == nil {
+		t.Fatal("Stat() succeeded while stalled")
+	}
+
+	p.Resume()
+	if _, err := p.Client.Stat("/"); err != nil {
+		t.Errorf("Stat() after Resume = %v", err)
+	}
+}
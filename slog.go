@@ -0,0 +1,93 @@
+//go:build go1.21
+// +build go1.21
+
+package sftp
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// slogRequestLogger logs requests and their responses to an slog.Logger.
+type slogRequestLogger struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+func (l slogRequestLogger) attrs(req loggedRequest) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("op", req.op),
+		slog.Uint64("id", uint64(req.id)),
+	}
+	if req.path != "" {
+		attrs = append(attrs, slog.String("path", req.path))
+	}
+	if req.handle != "" {
+		attrs = append(attrs, slog.String("handle", req.handle))
+	}
+	return attrs
+}
+
+func (l slogRequestLogger) logRequest(req loggedRequest) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, l.level) {
+		return
+	}
+
+	attrs := l.attrs(req)
+	if req.bytes > 0 {
+		attrs = append(attrs, slog.Int("bytes", req.bytes))
+	}
+	l.logger.LogAttrs(ctx, l.level, "sftp request", attrs...)
+}
+
+func (l slogRequestLogger) logResponse(req loggedRequest, latency time.Duration, bytes int, code uint32, msg string) {
+	level := l.level
+	if code != sshFxOk && code != sshFxEOF {
+		level += slog.LevelInfo - slog.LevelDebug
+	}
+
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := append(l.attrs(req),
+		slog.Duration("latency", latency),
+		slog.String("status", fx(code).String()),
+	)
+	if msg != "" {
+		attrs = append(attrs, slog.String("message", msg))
+	}
+	if bytes > 0 {
+		attrs = append(attrs, slog.Int("bytes", bytes))
+	}
+	l.logger.LogAttrs(ctx, level, "sftp response", attrs...)
+}
+
+// WithLogger logs each request of the Client, and its response, to logger, at the given level,
+// with its type, id, path or handle, and for the response, its latency and status.
+// A response with a status other than SSH_FX_OK or SSH_FX_EOF is logged one level up, such as at Info for Debug.
+// The file data of reads and writes is never logged, only its length.
+func WithLogger(logger *slog.Logger, level slog.Level) ClientOption {
+	return func(c *Client) error {
+		c.stats.logger = slogRequestLogger{logger, level}
+		return nil
+	}
+}
+
+// WithServerLogger logs each request to the Server, and its response, to logger, in the same way as WithLogger.
+func WithServerLogger(logger *slog.Logger, level slog.Level) ServerOption {
+	return func(s *Server) error {
+		s.pktMgr.log = newServerRequestLog(slogRequestLogger{logger, level})
+		return nil
+	}
+}
+
+// WithRSLogger logs each request to the RequestServer, and its response, to logger, in the same way as WithLogger.
+func WithRSLogger(logger *slog.Logger, level slog.Level) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pktMgr.log = newServerRequestLog(slogRequestLogger{logger, level})
+	}
+}
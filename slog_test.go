@@ -0,0 +1,106 @@
+//go:build go1.21
+// +build go1.21
+
+package sftp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records decodes the records logged as JSON.
+func (b *syncBuffer) records(t *testing.T) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b.buf.Bytes()))
+	for {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err == io.EOF {
+			return records
+		} else {
+			require.NoError(t, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var clientLog, serverLog syncBuffer
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server := NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, InMemHandler(), WithRSLogger(slog.New(slog.NewJSONHandler(&serverLog, nil)), slog.LevelDebug))
+	go func() {
+		server.Serve()
+		server.Close()
+	}()
+
+	logger := slog.New(slog.NewJSONHandler(&clientLog, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, err := NewClientPipe(cr, cw, WithLogger(logger, slog.LevelDebug))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = putTestFile(c, "/foo", "secret data")
+	require.NoError(t, err)
+
+	_, err = c.Stat("/missing")
+	require.Error(t, err)
+
+	for name, log := range map[string]*syncBuffer{"client": &clientLog, "server": &serverLog} {
+		records := log.records(t)
+
+		var writes, failures int
+		for _, rec := range records {
+			assert.NotContains(t, rec, "data", name)
+
+			switch {
+			case rec["msg"] == "sftp request" && rec["op"] == "SSH_FXP_WRITE":
+				writes++
+				assert.EqualValues(t, 11, rec["bytes"], name)
+				assert.NotEmpty(t, rec["handle"], name)
+
+			case rec["msg"] == "sftp response" && rec["status"] == "SSH_FX_NO_SUCH_FILE":
+				failures++
+				assert.Equal(t, "INFO", rec["level"], name)
+				assert.Equal(t, "SSH_FXP_STAT", rec["op"], name)
+				assert.Equal(t, "/missing", rec["path"], name)
+				assert.Contains(t, rec, "latency", name)
+			}
+		}
+		assert.NotContains(t, log.buf.String(), "secret", name)
+		assert.Equal(t, 1, failures, name)
+
+		if name == "client" {
+			assert.Equal(t, 1, writes, name)
+		} else {
+			// the server logs at Debug, below the level of its handler, and so only the failure, one level up.
+			assert.Zero(t, writes, name)
+			assert.Len(t, records, 1, name)
+		}
+	}
+}
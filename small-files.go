@@ -0,0 +1,90 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrFileTooLarge is returned by GetString for a file larger than the limit it is given.
+var ErrFileTooLarge = errors.New("sftp: file larger than the limit")
+
+// PutString creates or truncates the file path, with the permissions perm, before the umask of the server, if it is created,
+// and writes s to it, as os.WriteFile does.
+//
+// It is meant for small files, such as configuration or marker files, and costs only the round trips of the OPEN,
+// the WRITE, for an s that fits in one packet, and the CLOSE, with none to Stat the file,
+// whose error is also returned, as a server may only report a failure to store the file on close.
+func (c *Client) PutString(path, s string, perm os.FileMode) error {
+	attrs := &FileStat{Mode: toChmodPerm(perm)}
+
+	p := &sshFxpOpenPacket{
+		Path:   path,
+		Pflags: toPflags(os.O_WRONLY | os.O_CREATE | os.O_TRUNC),
+		Flags:  sshFileXferAttrPermissions,
+		Attrs:  attrs,
+	}
+	if c.compat.OpenAttrsBySetstat {
+		p.Flags, p.Attrs = 0, nil
+	}
+
+	f, err := c.openPacket(context.Background(), p)
+	if err != nil {
+		return err
+	}
+
+	if c.compat.OpenAttrsBySetstat {
+		_ = c.fsetstat(f.handle, sshFileXferAttrPermissions, attrs)
+	}
+
+	if len(s) > 0 {
+		if _, err := f.writeAt([]byte(s), 0); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+// GetString returns the contents of the file path, as os.ReadFile does, which must be at most max bytes long.
+// A max of zero or less means no limit.
+//
+// Like PutString, it is meant for small files, and costs only the round trips of the OPEN, the READs,
+// which for a file that fits in one packet are that of its data, and that of the end of the file, and the CLOSE.
+// For a larger file an *os.PathError wrapping ErrFileTooLarge is returned, once more than max bytes have been read.
+func (c *Client) GetString(path string, max int64) (string, error) {
+	f, err := c.open(context.Background(), path, toPflags(os.O_RDONLY))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	buf := make([]byte, c.readChunkSize())
+
+	var off int64
+	for {
+		b := buf
+		if max > 0 && int64(len(b)) > max-off+1 {
+			b = b[:max-off+1] // one byte more than the limit, to tell whether the file is larger.
+		}
+
+		n, err := f.readChunkAt(context.Background(), nil, b, off)
+		sb.Write(b[:n])
+		off += int64(n)
+
+		if max > 0 && off > max {
+			return "", &os.PathError{Op: "read", Path: path, Err: ErrFileTooLarge}
+		}
+
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
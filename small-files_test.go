@@ -0,0 +1,61 @@
+package sftp
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPutGetString(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	before := p.cli.Stats().Requests
+	require.NoError(t, p.cli.PutString("/marker", "ready", 0o600))
+	assert.EqualValues(t, 3, p.cli.Stats().Requests-before, "OPEN, WRITE and CLOSE")
+
+	f, err := p.testHandler().fetch("/marker")
+	require.NoError(t, err)
+	assert.Equal(t, "ready", string(f.content))
+
+	before = p.cli.Stats().Requests
+	s, err := p.cli.GetString("/marker", 5)
+	require.NoError(t, err)
+	assert.Equal(t, "ready", s)
+	assert.EqualValues(t, 4, p.cli.Stats().Requests-before, "OPEN, READ, READ of the end of the file and CLOSE")
+
+	// truncated by a shorter string.
+	require.NoError(t, p.cli.PutString("/marker", "ok", 0o600))
+	s, err = p.cli.GetString("/marker", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", s)
+
+	require.NoError(t, p.cli.PutString("/empty", "", 0o600))
+	s, err = p.cli.GetString("/empty", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "", s)
+
+	_, err = p.cli.GetString("/missing", 0)
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
+
+func TestClientGetStringLimit(t *testing.T) {
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	p.cli.maxPacket = 4 // force several reads and writes.
+
+	contents := strings.Repeat("0123456789", 5)
+	require.NoError(t, p.cli.PutString("/config", contents, 0o644))
+
+	s, err := p.cli.GetString("/config", int64(len(contents)))
+	require.NoError(t, err)
+	assert.Equal(t, contents, s)
+
+	_, err = p.cli.GetString("/config", int64(len(contents))-1)
+	assert.True(t, errors.Is(err, ErrFileTooLarge), "%v", err)
+}
@@ -0,0 +1,167 @@
+package sftp
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// An SSHWatchdog watches the health of an SSH connection, on behalf of the Clients of its SFTP sessions,
+// and once it finds the connection lost, tears them all down at once, so that they fail fast,
+// and the application can reconnect, such as with a ReconnectingClient.
+//
+// It probes the connection with keepalive@openssh.com global requests,
+// which any server answers, if only with a failure, and also notices the connection being closed.
+// It is safe for concurrent use.
+type SSHWatchdog struct {
+	conn     *ssh.Client
+	interval time.Duration
+
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+	err     error
+
+	done chan struct{} // closed once the connection is lost
+	stop chan struct{} // closed by Stop
+	once sync.Once
+}
+
+// NewSSHWatchdog starts watching conn, sending a keepalive every interval,
+// and taking the connection to be lost if no reply arrives within a further interval,
+// in which case the connection is closed, and Err returns ErrKeepaliveTimeout.
+// An interval of zero or less sends no keepalives, and only notices the connection being closed.
+func NewSSHWatchdog(conn *ssh.Client, interval time.Duration) *SSHWatchdog {
+	w := &SSHWatchdog{
+		conn:     conn,
+		interval: interval,
+		clients:  make(map[*Client]struct{}),
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+
+	go func() {
+		err := conn.Wait()
+		if err == nil {
+			err = ErrSSHFxConnectionLost
+		}
+		w.lost(err)
+	}()
+
+	if interval > 0 {
+		go w.keepaliveLoop()
+	}
+
+	return w
+}
+
+// NewClient creates a Client on the connection of the watchdog, as NewClient does, which is torn down with it.
+// If the connection has already been lost, it returns the error of Err.
+func (w *SSHWatchdog) NewClient(opts ...ClientOption) (*Client, error) {
+	c, err := NewClient(w.conn, opts...)
+	if err != nil {
+		if werr := w.Err(); werr != nil {
+			return nil, werr
+		}
+		return nil, err
+	}
+
+	w.mu.Lock()
+	if w.err != nil {
+		err := w.err
+		w.mu.Unlock()
+		c.lose(err)
+		c.Close()
+		return nil, err
+	}
+	w.clients[c] = struct{}{}
+	w.mu.Unlock()
+
+	go func() {
+		<-c.closed
+
+		w.mu.Lock()
+		delete(w.clients, c)
+		w.mu.Unlock()
+	}()
+
+	return c, nil
+}
+
+// Done returns a channel that is closed once the connection has been lost.
+func (w *SSHWatchdog) Done() <-chan struct{} {
+	return w.done
+}
+
+// Err returns nil while the connection is alive, and the reason it was lost afterwards.
+func (w *SSHWatchdog) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Stop stops sending keepalives, leaving the connection and its Clients as they are.
+// The watchdog still notices the connection being closed.
+func (w *SSHWatchdog) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// keepaliveLoop sends a keepalive every interval, until the connection is lost, or the watchdog is stopped.
+func (w *SSHWatchdog) keepaliveLoop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			// a failure is still a reply, and so proves the connection alive.
+			_, _, err := w.conn.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		timer := time.NewTimer(w.interval)
+		select {
+		case err := <-replied:
+			timer.Stop()
+			if err != nil {
+				w.lost(ErrSSHFxConnectionLost)
+				return
+			}
+		case <-timer.C:
+			w.lost(ErrKeepaliveTimeout)
+			return
+		case <-w.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// lost records err as the reason the connection was lost, unless it already was,
+// closes it, and tears down all its Clients.
+func (w *SSHWatchdog) lost(err error) {
+	w.mu.Lock()
+	if w.err != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.err = err
+	clients := w.clients
+	w.clients = make(map[*Client]struct{})
+	close(w.done)
+	w.mu.Unlock()
+
+	w.conn.Close()
+	for c := range clients {
+		c.lose(err)
+	}
+}
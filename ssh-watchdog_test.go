@@ -0,0 +1,100 @@
+package sftp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSFTP serves SFTP on the channel of a session.
+func serveSFTP(ch ssh.Channel) {
+	s, err := NewServer(ch)
+	if err != nil {
+		ch.Close()
+		return
+	}
+	s.Serve()
+	ch.Close()
+}
+
+func TestSSHWatchdogKeepaliveTimeout(t *testing.T) {
+	stall := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	conn := sshSubsystemPairWithRequests(t, serveSFTP, func(reqs <-chan *ssh.Request) {
+		for req := range reqs {
+			select {
+			case <-stall:
+				// the server no longer reads from the connection, as if it had gone silent.
+				<-release
+			default:
+			}
+			req.Reply(false, nil)
+		}
+	})
+
+	w := NewSSHWatchdog(conn, 50*time.Millisecond)
+	defer w.Stop()
+
+	var clients []*Client
+	for i := 0; i < 2; i++ {
+		c, err := w.NewClient()
+		require.NoError(t, err)
+		defer c.Close()
+		clients = append(clients, c)
+	}
+
+	// the keepalives are answered.
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, w.Err())
+	_, err := clients[0].Getwd()
+	require.NoError(t, err)
+
+	close(stall)
+
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection loss not detected")
+	}
+	assert.Equal(t, ErrKeepaliveTimeout, w.Err())
+
+	for _, c := range clients {
+		assert.Equal(t, ErrKeepaliveTimeout, c.Wait())
+
+		_, err := c.Stat("/")
+		assert.True(t, errors.Is(err, ErrSSHFxConnectionLost), "Stat() = %v", err)
+	}
+
+	_, err = w.NewClient()
+	assert.Equal(t, ErrKeepaliveTimeout, err)
+}
+
+func TestSSHWatchdogClosed(t *testing.T) {
+	conn := sshSubsystemPair(t, serveSFTP)
+
+	w := NewSSHWatchdog(conn, 0)
+
+	c, err := w.NewClient()
+	require.NoError(t, err)
+	defer c.Close()
+
+	conn.Close()
+
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection close not detected")
+	}
+	assert.Error(t, w.Err())
+
+	// the Client may have found out on its own first.
+	assert.Error(t, c.Wait())
+	_, err = c.Stat("/")
+	assert.True(t, errors.Is(err, ErrSSHFxConnectionLost), "Stat() = %v", err)
+}
@@ -0,0 +1,36 @@
+package sftp
+
+// WithExtendedStatusCodes sends the Server's clients the status codes of later versions of the protocol,
+// such as SSH_FX_FILE_ALREADY_EXISTS or SSH_FX_NO_SPACE_ON_FILESYSTEM, for the syscall errors they describe.
+//
+// The Server negotiates version 3 of the protocol, so by default these errors are sent
+// with the closest code defined by version 3, and the error message.
+// Enable this only if the clients are known to understand the later codes.
+func WithExtendedStatusCodes() ServerOption {
+	return func(s *Server) error {
+		s.pktMgr.extendedCodes = true
+		return nil
+	}
+}
+
+// WithRSExtendedStatusCodes sends the RequestServer's clients the status codes of later versions of the protocol,
+// in the same way as WithExtendedStatusCodes.
+func WithRSExtendedStatusCodes() RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pktMgr.extendedCodes = true
+	}
+}
+
+// v3StatusCode returns the code defined by version 3 of the protocol closest to a code of later versions.
+func v3StatusCode(code uint32) uint32 {
+	switch code {
+	case sshFxWriteProtect:
+		return sshFxPermissionDenied
+	case sshFxNoSuchPath:
+		return sshFxNoSuchFile
+	}
+	if code > sshFxOPUnsupported {
+		return sshFxFailure
+	}
+	return code
+}
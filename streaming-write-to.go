@@ -0,0 +1,45 @@
+package sftp
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+// WithStreamingReadahead bounds the data File.WriteTo reads ahead of its writes to chunks reads,
+// when it writes to a pipe, or a socket, such as a net.Conn, or an *os.File of a pipe, socket, or terminal,
+// rather than up to MaxInflight reads, as for other writers.
+//
+// Each chunk is written as soon as those before it have been, and the next read is only sent once a chunk has been written,
+// so that the reads slow down to the pace of a sink slower than the network,
+// and the data buffered, and so the latency of the stream, stays within chunks reads, rather than growing with MaxInflight.
+// A chunks of zero or less keeps the default.
+func WithStreamingReadahead(chunks int) ClientOption {
+	return func(c *Client) error {
+		c.streamingReadahead = chunks
+		return nil
+	}
+}
+
+// isStreamWriter reports whether w writes to a stream which cannot be seeked: a socket, a pipe, or a terminal.
+func isStreamWriter(w io.Writer) bool {
+	switch w := w.(type) {
+	case net.Conn:
+		return true
+	case *os.File:
+		fi, err := w.Stat()
+		if err != nil {
+			return false
+		}
+		return fi.Mode()&(os.ModeNamedPipe|os.ModeSocket|os.ModeCharDevice) != 0
+	}
+	return false
+}
+
+// readaheadWindow returns the semaphore bounding the reads of File.WriteTo ahead of its writes to w, if any.
+func (c *Client) readaheadWindow(w io.Writer) chan struct{} {
+	if c.streamingReadahead <= 0 || !isStreamWriter(w) {
+		return nil
+	}
+	return make(chan struct{}, c.streamingReadahead)
+}
@@ -0,0 +1,132 @@
+package sftp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readTracker serves files of an InMemHandler, recording the end of the furthest read.
+type readTracker struct {
+	FileReader
+
+	mu  sync.Mutex
+	end int64
+}
+
+func (h *readTracker) Fileread(r *Request) (io.ReaderAt, error) {
+	ra, err := h.FileReader.Fileread(r)
+	if err != nil {
+		return nil, err
+	}
+	return trackedReaderAt{ra, h}, nil
+}
+
+func (h *readTracker) readEnd() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.end
+}
+
+type trackedReaderAt struct {
+	io.ReaderAt
+	h *readTracker
+}
+
+func (r trackedReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	r.h.mu.Lock()
+	if end := off + int64(len(b)); end > r.h.end {
+		r.h.end = end
+	}
+	r.h.mu.Unlock()
+
+	return r.ReaderAt.ReadAt(b, off)
+}
+
+// slowConn is a net.Conn which only writes, slowly, and records how far reads were ahead of each write.
+type slowConn struct {
+	net.Conn
+
+	buf     bytes.Buffer
+	tracker *readTracker
+	ahead   int64 // the most bytes read, but not yet written
+}
+
+func (c *slowConn) Write(b []byte) (int, error) {
+	if ahead := c.tracker.readEnd() - int64(c.buf.Len()); ahead > c.ahead {
+		c.ahead = ahead
+	}
+	time.Sleep(time.Millisecond)
+	return c.buf.Write(b)
+}
+
+func TestFileWriteToStreamingReadahead(t *testing.T) {
+	const chunk = 4096
+	const window = 2
+
+	handlers := InMemHandler()
+	tracker := &readTracker{FileReader: handlers.FileGet}
+	handlers.FileGet = tracker
+	p := clientRequestServerPairWithHandlers(t, handlers)
+	defer p.Close()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256*1024/16)
+
+	f, err := p.cli.Create("/foo")
+	require.NoError(t, err)
+	_, err = f.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	for _, opt := range []ClientOption{
+		WithReadChunkSize(chunk),
+		MaxConcurrentRequestsPerFile(64),
+		WithStreamingReadahead(window),
+	} {
+		require.NoError(t, opt(p.cli))
+	}
+
+	f, err = p.cli.Open("/foo")
+	require.NoError(t, err)
+	defer f.Close()
+
+	conn := &slowConn{tracker: tracker}
+	n, err := f.WriteTo(conn)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), n)
+	assert.Equal(t, content, conn.buf.Bytes())
+
+	// the chunk written, and those read ahead of it.
+	assert.LessOrEqual(t, conn.ahead, int64(window*chunk))
+}
+
+func TestIsStreamWriter(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	assert.True(t, isStreamWriter(w))
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	assert.True(t, isStreamWriter(c1))
+
+	f, err := ioutil.TempFile(t.TempDir(), "file")
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.False(t, isStreamWriter(f))
+	assert.False(t, isStreamWriter(new(bytes.Buffer)))
+}
@@ -0,0 +1,141 @@
+package sftp
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseSymbolicMode applies the chmod(1) style mode to the current file mode cur,
+// and returns the resulting permissions, including the setuid, setgid and sticky bits.
+//
+// The mode may be an octal number, such as "0755",
+// or a comma-separated list of symbolic clauses, such as "u+rwx,g-w,o=",
+// each consisting of zero or more of the users "ugoa", followed by one or more actions.
+// Each action is one of the operators "+-=", followed by either permissions from "rwxXst",
+// or a single user from "ugo", whose current permissions are copied.
+// A clause without users applies to all users, as umask is not taken into account.
+func parseSymbolicMode(mode string, cur os.FileMode) (os.FileMode, error) {
+	invalid := func() (os.FileMode, error) {
+		return 0, fmt.Errorf("sftp: invalid symbolic mode %q", mode)
+	}
+
+	if mode == "" {
+		return invalid()
+	}
+
+	if strings.Trim(mode, "01234567") == "" {
+		perm, err := strconv.ParseUint(mode, 8, 12)
+		if err != nil {
+			return invalid()
+		}
+		return toFileMode(uint32(perm)), nil
+	}
+
+	const (
+		userShift  = 6
+		groupShift = 3
+		otherShift = 0
+
+		special = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	)
+
+	isDir := cur.IsDir()
+	cur &= os.ModePerm | special
+
+	for _, clause := range strings.Split(mode, ",") {
+		var who os.FileMode // the rwx bits for all of the selected users.
+		var whoSpecial os.FileMode
+
+		i := 0
+	users:
+		for ; i < len(clause); i++ {
+			switch clause[i] {
+			case 'u':
+				who |= 0700
+				whoSpecial |= os.ModeSetuid
+			case 'g':
+				who |= 0070
+				whoSpecial |= os.ModeSetgid
+			case 'o':
+				who |= 0007
+				whoSpecial |= os.ModeSticky
+			case 'a':
+				who |= 0777
+				whoSpecial |= special
+			default:
+				break users
+			}
+		}
+
+		if who == 0 {
+			who = 0777
+			whoSpecial = special
+		}
+
+		if i == len(clause) {
+			return invalid()
+		}
+
+		for i < len(clause) {
+			op := clause[i]
+			if op != '+' && op != '-' && op != '=' {
+				return invalid()
+			}
+			i++
+
+			var bits os.FileMode // the rwx bits of a single user, to be replicated across the selected users.
+			var bitsSpecial os.FileMode
+
+			if i < len(clause) && strings.IndexByte("ugo", clause[i]) >= 0 {
+				switch clause[i] {
+				case 'u':
+					bits = cur >> userShift & 7
+				case 'g':
+					bits = cur >> groupShift & 7
+				case 'o':
+					bits = cur >> otherShift & 7
+				}
+				i++
+
+			} else {
+			perms:
+				for ; i < len(clause); i++ {
+					switch clause[i] {
+					case 'r':
+						bits |= 4
+					case 'w':
+						bits |= 2
+					case 'x':
+						bits |= 1
+					case 'X':
+						if isDir || cur&0111 != 0 {
+							bits |= 1
+						}
+					case 's':
+						bitsSpecial |= os.ModeSetuid | os.ModeSetgid
+					case 't':
+						bitsSpecial |= os.ModeSticky
+					default:
+						break perms
+					}
+				}
+			}
+
+			change := (bits<<userShift|bits<<groupShift|bits<<otherShift)&who | bitsSpecial&whoSpecial
+
+			switch op {
+			case '+':
+				cur |= change
+			case '-':
+				cur &^= change
+			case '=':
+				cur &^= who | whoSpecial
+				cur |= change
+			}
+		}
+	}
+
+	return cur, nil
+}
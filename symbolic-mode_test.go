@@ -0,0 +1,45 @@
+package sftp
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSymbolicMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		cur  os.FileMode
+		want os.FileMode
+	}{
+		{mode: "u+x", cur: 0644, want: 0744},
+		{mode: "u+rwx,g-w", cur: 0664, want: 0744},
+		{mode: "go=", cur: 0755, want: 0700},
+		{mode: "a-w", cur: 0666, want: 0444},
+		{mode: "+x", cur: 0600, want: 0711},
+		{mode: "o=u", cur: 0750, want: 0757},
+		{mode: "g=u-w", cur: 0700, want: 0750},
+		{mode: "a+X", cur: 0600, want: 0600},
+		{mode: "a+X", cur: 0700, want: 0711},
+		{mode: "a+X", cur: os.ModeDir | 0600, want: 0711},
+		{mode: "u+s,g+s", cur: 0755, want: os.ModeSetuid | os.ModeSetgid | 0755},
+		{mode: "o+s", cur: 0755, want: 0755},
+		{mode: "+t", cur: 0777, want: os.ModeSticky | 0777},
+		{mode: "u=rw", cur: os.ModeSetuid | 0755, want: 0655},
+		{mode: "0640", cur: 0777, want: 0640},
+		{mode: "4755", cur: 0, want: os.ModeSetuid | 0755},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSymbolicMode(tt.mode, tt.cur)
+		if assert.NoError(t, err, tt.mode) {
+			assert.Equal(t, tt.want, got, "%q: %v != %v", tt.mode, tt.want, got)
+		}
+	}
+
+	for _, mode := range []string{"", "u", "u+r,", "u+q", "z+r", "g=uw", "77777"} {
+		_, err := parseSymbolicMode(mode, 0644)
+		assert.Error(t, err, mode)
+	}
+}
@@ -0,0 +1,84 @@
+package sftp
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WithSymlinkHook sets a function to be called with every SSH_FXP_SYMLINK, before the link is created,
+// with the path of the link on the local filesystem, and the target as sent by the client.
+// The link is created to the target the hook returns, which it may rewrite,
+// and if the hook returns an error, such as ErrSSHFxPermissionDenied, the symlink is refused with that error.
+//
+// As a link may point anywhere, and be followed by later requests, it is the main way out of the directory a client is confined to,
+// see SymlinkPolicy for the usual checks.
+// The target the hook returns is still translated by WithSymlinkRoot, if it is set.
+func WithSymlinkHook(hook func(link, target string) (string, error)) ServerOption {
+	return func(s *Server) error {
+		s.symlinkHook = hook
+		return nil
+	}
+}
+
+// WithRSSymlinkHook sets a function to be called with every SSH_FXP_SYMLINK, before it is passed to the Handlers,
+// in the same way as WithSymlinkHook.
+// The link is the cleaned path, as it will be given to the Handlers in Request.Target.
+func WithRSSymlinkHook(hook func(link, target string) (string, error)) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.symlinkHook = hook
+	}
+}
+
+// applySymlinkHook passes the symlink p, of the link at link, through hook, and rewrites the target of p with the one it returns.
+func applySymlinkHook(hook func(link, target string) (string, error), link string, p *sshFxpSymlinkPacket) error {
+	target, err := hook(link, p.Targetpath)
+	if err != nil {
+		return err
+	}
+	p.Targetpath = target
+	return nil
+}
+
+// SymlinkPolicy is a policy for the targets of the symbolic links clients create,
+// whose Check method is meant to be set with WithSymlinkHook or WithRSSymlinkHook.
+type SymlinkPolicy struct {
+	// Root, if set, is the directory the targets must resolve within,
+	// from the directory of the link for a relative target, in the form of the paths given to the hook,
+	// which for a Server is a path of the local filesystem.
+	Root string
+
+	// DenyAbsolute refuses absolute targets, so that links can be moved along with the tree they are in.
+	DenyAbsolute bool
+}
+
+// Check returns target if it is allowed by the policy for a link at link, and otherwise ErrSSHFxPermissionDenied.
+//
+// The target is only resolved lexically, without following any links along it,
+// which are themselves checked when they are created.
+func (p SymlinkPolicy) Check(link, target string) (string, error) {
+	link, target = filepath.ToSlash(link), filepath.ToSlash(target)
+
+	resolved := target
+	if path.IsAbs(target) {
+		if p.DenyAbsolute {
+			return "", ErrSSHFxPermissionDenied
+		}
+	} else {
+		resolved = path.Join(path.Dir(link), target)
+	}
+
+	if p.Root != "" && !pathWithin(filepath.ToSlash(p.Root), resolved) {
+		return "", ErrSSHFxPermissionDenied
+	}
+	return target, nil
+}
+
+// pathWithin reports whether the slash separated path p is root, or within it.
+func pathWithin(root, p string) bool {
+	root, p = path.Clean(root), path.Clean(p)
+	if root == "/" {
+		return path.IsAbs(p)
+	}
+	return p == root || strings.HasPrefix(p, root+"/")
+}
@@ -0,0 +1,102 @@
+package sftp
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlinkPolicyCheck(t *testing.T) {
+	tests := []struct {
+		policy SymlinkPolicy
+		link   string
+		target string
+		ok     bool
+	}{
+		{policy: SymlinkPolicy{}, link: "/srv/a/link", target: "/etc/passwd", ok: true},
+		{policy: SymlinkPolicy{DenyAbsolute: true}, link: "/srv/a/link", target: "/srv/a/file"},
+		{policy: SymlinkPolicy{DenyAbsolute: true}, link: "/srv/a/link", target: "file", ok: true},
+		{policy: SymlinkPolicy{Root: "/srv"}, link: "/srv/a/link", target: "../b/file", ok: true},
+		{policy: SymlinkPolicy{Root: "/srv"}, link: "/srv/a/link", target: "../../etc/passwd"},
+		{policy: SymlinkPolicy{Root: "/srv"}, link: "/srv/a/link", target: "/srv/b", ok: true},
+		{policy: SymlinkPolicy{Root: "/srv"}, link: "/srv/a/link", target: "/srv2/b"},
+		{policy: SymlinkPolicy{Root: "/srv"}, link: "/srv/link", target: "..", ok: false},
+		{policy: SymlinkPolicy{Root: "/srv"}, link: "/srv/link", target: ".", ok: true},
+		{policy: SymlinkPolicy{Root: "/"}, link: "/link", target: "../../x", ok: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.policy.Check(tt.link, tt.target)
+		if tt.ok {
+			assert.NoError(t, err, "%+v %q -> %q", tt.policy, tt.link, tt.target)
+			assert.Equal(t, tt.target, got)
+		} else {
+			assert.Equal(t, ErrSSHFxPermissionDenied, err, "%+v %q -> %q", tt.policy, tt.link, tt.target)
+		}
+	}
+}
+
+func TestRequestServerSymlinkHook(t *testing.T) {
+	policy := SymlinkPolicy{Root: "/home", DenyAbsolute: true}
+	p := clientRequestServerPair(t, WithRSSymlinkHook(func(link, target string) (string, error) {
+		if target == "rewrite" {
+			return "rewritten", nil
+		}
+		return policy.Check(link, target)
+	}))
+	defer p.Close()
+
+	require.NoError(t, p.cli.MkdirAll("/home/user"))
+	_, err := putTestFile(p.cli, "/home/user/file", "data")
+	require.NoError(t, err)
+
+	require.NoError(t, p.cli.Symlink("file", "/home/user/link"))
+	target, err := p.cli.ReadLink("/home/user/link")
+	require.NoError(t, err)
+	assert.Equal(t, "file", target)
+
+	err = p.cli.Symlink("../../etc", "/home/user/escape")
+	assert.True(t, os.IsPermission(err), "%v", err)
+	err = p.cli.Symlink("/home/user/file", "/home/user/absolute")
+	assert.True(t, os.IsPermission(err), "%v", err)
+
+	require.NoError(t, p.cli.Symlink("rewrite", "/home/user/rewritten"))
+	target, err = p.cli.ReadLink("/home/user/rewritten")
+	require.NoError(t, err)
+	assert.Equal(t, "rewritten", target)
+}
+
+func TestServerSymlinkHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sftp-symlink-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithSymlinkHook(SymlinkPolicy{Root: dir}.Check))
+	require.NoError(t, err)
+	go func() {
+		server.Serve()
+		server.Close()
+	}()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+
+	link := filepath.ToSlash(filepath.Join(dir, "link"))
+	require.NoError(t, client.Symlink("target", link))
+
+	err = client.Symlink("../outside", filepath.ToSlash(filepath.Join(dir, "escape")))
+	assert.True(t, os.IsPermission(err), "%v", err)
+	_, err = os.Lstat(filepath.Join(dir, "escape"))
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
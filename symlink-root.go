@@ -0,0 +1,59 @@
+package sftp
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WithSymlinkRoot translates the absolute targets of symbolic links between the filesystem of the Server,
+// and the view of a client to whom root is served as "/", such as behind a chroot, or a bind mount.
+//
+// A READLINK of a link to an absolute target within root returns the target relative to root,
+// so that "/srv/data/a/b" is returned as "/a/b" for a root of "/srv/data",
+// and a READLINK of a link to an absolute target outside of root is refused with permission denied,
+// rather than reveal the path on the host.
+// A SYMLINK with an absolute target creates a link to the target within root, so that "/a/b" becomes "/srv/data/a/b",
+// and as ".." of "/" is "/", the target cannot climb out of root, so that "/../etc" becomes "/srv/data/etc".
+// Relative targets are not translated.
+//
+// The root must be an absolute path of the local filesystem.
+func WithSymlinkRoot(root string) ServerOption {
+	return func(s *Server) error {
+		if !filepath.IsAbs(root) {
+			return errors.New("symlink root must be an absolute path")
+		}
+		s.symlinkRoot = filepath.Clean(root)
+		return nil
+	}
+}
+
+// symlinkTarget returns the local target of a symbolic link to the target sent by a client.
+// An absolute target is cleaned as a path below "/" before it is placed within the root,
+// so that its ".." elements cannot climb out of the root.
+func (s *Server) symlinkTarget(target string) (string, error) {
+	if s.symlinkRoot == "" || !path.IsAbs(target) {
+		return s.toLocalPath(target), nil
+	}
+
+	local := filepath.Join(s.symlinkRoot, filepath.FromSlash(path.Clean("/"+target)))
+	sep := string(filepath.Separator)
+	if local != s.symlinkRoot && !strings.HasPrefix(local, strings.TrimSuffix(s.symlinkRoot, sep)+sep) {
+		return "", ErrSSHFxPermissionDenied
+	}
+	return local, nil
+}
+
+// readlinkTarget returns the target of a symbolic link to the local target, as sent to a client.
+func (s *Server) readlinkTarget(target string) (string, error) {
+	if s.symlinkRoot == "" || !filepath.IsAbs(target) {
+		return target, nil
+	}
+
+	rel, err := filepath.Rel(s.symlinkRoot, filepath.Clean(target))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrSSHFxPermissionDenied
+	}
+	return path.Join("/", filepath.ToSlash(rel)), nil
+}
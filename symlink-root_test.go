@@ -0,0 +1,77 @@
+package sftp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerSymlinkRoot(t *testing.T) {
+	skipIfWindows(t) // symbolic links
+
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithSymlinkRoot(root))
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := NewClientPipe(cr, cw)
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	// an absolute target is created within the root.
+	require.NoError(t, client.Symlink("/a/b", filepath.Join(root, "abs")))
+	target, err := os.Readlink(filepath.Join(root, "abs"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "a", "b"), target)
+
+	// the ".." elements of an absolute target cannot climb out of the root.
+	require.NoError(t, client.Symlink("/../../etc/passwd", filepath.Join(root, "dotdot")))
+	target, err = os.Readlink(filepath.Join(root, "dotdot"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "etc", "passwd"), target)
+
+	require.NoError(t, client.Symlink("/a/../../..", filepath.Join(root, "up")))
+	target, err = os.Readlink(filepath.Join(root, "up"))
+	require.NoError(t, err)
+	assert.Equal(t, root, target)
+
+	// and read back as seen from the root.
+	target, err = client.ReadLink(filepath.Join(root, "abs"))
+	require.NoError(t, err)
+	assert.Equal(t, "/a/b", target)
+
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "top")))
+	target, err = client.ReadLink(filepath.Join(root, "top"))
+	require.NoError(t, err)
+	assert.Equal(t, "/", target)
+
+	// relative targets are left as they are.
+	require.NoError(t, os.Symlink("../c", filepath.Join(root, "rel")))
+	target, err = client.ReadLink(filepath.Join(root, "rel"))
+	require.NoError(t, err)
+	assert.Equal(t, "../c", target)
+
+	// targets outside of the root are not revealed.
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "outside")))
+	_, err = client.ReadLink(filepath.Join(root, "outside"))
+	assert.True(t, os.IsPermission(err), err)
+
+	_, err = NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithSymlinkRoot("relative"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,296 @@
+package sftp
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// TarOptions configures TarTo.
+type TarOptions struct {
+	// Gzip compresses the archive with gzip, as for a .tar.gz file.
+	Gzip bool
+
+	// Prefix, if not empty, is the directory within the archive to hold the entries, such as the base name of dir.
+	// The directory itself is then included in the archive.
+	// Otherwise, the entries are at the top of the archive, and the directory itself is not included.
+	Prefix string
+
+	// Prefetch is the number of files read ahead of the one being written to the archive, by default 16.
+	// Only files no larger than the Client's maximum packet size are read ahead, each in a single request,
+	// larger files are read as they are written, with WriteTo.
+	Prefetch int
+}
+
+// tarPrefetchDefault is the number of files read ahead by TarTo, unless TarOptions.Prefetch is given.
+const tarPrefetchDefault = 16
+
+// TarTo walks the remote directory dir, and writes a tar archive of its contents to w.
+// A nil opts is the same as the zero TarOptions.
+//
+// The archive holds the directories, regular files, and symbolic links under dir,
+// with their permissions, modification times, and uid and gid, in the order of their names.
+// Other special files are skipped.
+// The size of each file is taken from its attributes as listed,
+// so a file that grows while it is archived is cut short, and one that shrinks is an error.
+//
+// As the round trips to open and read a small file are dominated by the latency to the server,
+// small files are read ahead, concurrently, while the earlier files are written to the archive.
+//
+// TarTo stops at the first error, in which case the archive is incomplete.
+// The context is checked between files.
+func (c *Client) TarTo(ctx context.Context, dir string, w io.Writer, opts *TarOptions) error {
+	if opts == nil {
+		opts = new(TarOptions)
+	}
+
+	prefetch := opts.Prefetch
+	if prefetch < 1 {
+		prefetch = tarPrefetchDefault
+	}
+
+	root, err := c.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !root.IsDir() {
+		return &os.PathError{Op: "tar", Path: dir, Err: errors.New("not a directory")}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := &tarWalker{
+		ctx:     ctx,
+		c:       c,
+		root:    dir,
+		prefix:  strings.Trim(opts.Prefix, "/"),
+		entries: make(chan *tarEntry, prefetch),
+	}
+	go t.walk(root)
+
+	var gw *gzip.Writer
+	if opts.Gzip {
+		gw = gzip.NewWriter(w)
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+
+	for e := range t.entries {
+		if err := t.write(tw, e); err != nil {
+			return err
+		}
+	}
+	if t.err != nil {
+		return t.err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gw != nil {
+		return gw.Close()
+	}
+	return nil
+}
+
+// tarEntry is an entry of the archive, which may be read ahead.
+type tarEntry struct {
+	rel  string // slash-separated path relative to the root, "." for the root itself
+	fi   os.FileInfo
+	link string // target of a symbolic link
+
+	done chan struct{} // closed once the fields below are set
+	data []byte        // the content, if read ahead
+	err  error
+}
+
+type tarWalker struct {
+	ctx     context.Context
+	c       *Client
+	root    string
+	prefix  string
+	entries chan *tarEntry // in the order they are to be archived, closed once the walk is over
+	err     error          // the error that ended the walk, if any, valid once entries is closed
+}
+
+func (t *tarWalker) name(rel string) string {
+	return path.Join(t.prefix, rel)
+}
+
+// send queues an entry to be archived.
+func (t *tarWalker) send(e *tarEntry) error {
+	select {
+	case t.entries <- e:
+		return nil
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	}
+}
+
+func (t *tarWalker) walk(root os.FileInfo) {
+	defer close(t.entries)
+
+	if t.prefix != "" {
+		done := make(chan struct{})
+		close(done)
+		if t.err = t.send(&tarEntry{rel: ".", fi: root, done: done}); t.err != nil {
+			return
+		}
+	}
+
+	t.err = t.dir(".")
+}
+
+// dir queues the entries of the directory rel, and those below it.
+func (t *tarWalker) dir(rel string) error {
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	infos, err := t.c.ReadDirContext(t.ctx, path.Join(t.root, rel))
+	if err != nil {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	for _, fi := range infos {
+		e := &tarEntry{
+			rel:  path.Join(rel, fi.Name()),
+			fi:   fi,
+			done: make(chan struct{}),
+		}
+
+		switch {
+		case fi.Mode().IsRegular() && fi.Size() <= int64(t.c.maxPacket):
+			go t.prefetch(e)
+		case fi.Mode()&os.ModeSymlink != 0:
+			e.link, e.err = t.c.ReadLink(path.Join(t.root, e.rel))
+			close(e.done)
+		case fi.IsDir(), fi.Mode().IsRegular():
+			close(e.done)
+		default:
+			continue
+		}
+
+		if err := t.send(e); err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if err := t.dir(e.rel); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prefetch reads the content of the small file e.
+func (t *tarWalker) prefetch(e *tarEntry) {
+	defer close(e.done)
+
+	f, err := t.c.Open(path.Join(t.root, e.rel))
+	if err != nil {
+		e.err = err
+		return
+	}
+	defer f.Close()
+
+	// read one byte more than expected, to read the whole file in a single request, even if it has grown.
+	b := make([]byte, e.fi.Size()+1)
+	n, err := f.ReadAt(b, 0)
+	if err != nil && err != io.EOF {
+		e.err = err
+		return
+	}
+	e.data = b[:n]
+}
+
+// write writes the entry e to the archive.
+func (t *tarWalker) write(tw *tar.Writer, e *tarEntry) error {
+	select {
+	case <-e.done:
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	}
+	if e.err != nil {
+		return e.err
+	}
+
+	hdr, err := TarHeader(e.fi, e.link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = t.name(e.rel)
+	if e.fi.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !e.fi.Mode().IsRegular() {
+		return nil
+	}
+
+	if e.data != nil {
+		if int64(len(e.data)) > hdr.Size {
+			e.data = e.data[:hdr.Size]
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+		return t.checkSize(e, int64(len(e.data)))
+	}
+
+	f, err := t.c.Open(path.Join(t.root, e.rel))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lw := &tarFileWriter{w: tw, remain: hdr.Size}
+	if _, err := f.WriteTo(lw); err != nil && !errors.Is(err, errTarFileFull) {
+		return err
+	}
+	return t.checkSize(e, hdr.Size-lw.remain)
+}
+
+func (t *tarWalker) checkSize(e *tarEntry, n int64) error {
+	if n < e.fi.Size() {
+		return fmt.Errorf("sftp: tar: %s: file shrank from %d to %d bytes while archiving", path.Join(t.root, e.rel), e.fi.Size(), n)
+	}
+	return nil
+}
+
+// errTarFileFull stops File.WriteTo once the size in the header of a file has been written.
+var errTarFileFull = errors.New("tar entry full")
+
+// tarFileWriter writes up to remain bytes to w, and then fails with errTarFileFull.
+type tarFileWriter struct {
+	w      io.Writer
+	remain int64
+}
+
+func (w *tarFileWriter) Write(b []byte) (int, error) {
+	full := false
+	if int64(len(b)) > w.remain {
+		b, full = b[:w.remain], true
+	}
+
+	n, err := w.w.Write(b)
+	w.remain -= int64(n)
+	if err == nil && full {
+		err = errTarFileFull
+	}
+	return n, err
+}
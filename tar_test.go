@@ -0,0 +1,97 @@
+package sftp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientTarTo(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	big := strings.Repeat("0123456789", 10000) // larger than a packet, so not read ahead
+	writeTree(t, dir, map[string]string{
+		"a.txt":         "a",
+		"big.bin":       big,
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+		"sub/empty":     "",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(dir, "a.txt"), 0o600))
+	mtime := time.Unix(1600000000, 0)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "sub", "b.txt"), mtime, mtime))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(dir, "link")))
+
+	readArchive := func(r io.Reader) (names []string, hdrs map[string]*tar.Header, files map[string]string) {
+		hdrs, files = make(map[string]*tar.Header), make(map[string]string)
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return names, hdrs, files
+			}
+			require.NoError(t, err)
+
+			names = append(names, hdr.Name)
+			hdrs[hdr.Name] = hdr
+			if hdr.Typeflag == tar.TypeReg {
+				data, err := ioutil.ReadAll(tr)
+				require.NoError(t, err)
+				files[hdr.Name] = string(data)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, client.TarTo(ctx, dir, &buf, &TarOptions{Prefetch: 1}))
+
+	names, hdrs, files := readArchive(&buf)
+	assert.Equal(t, []string{"a.txt", "big.bin", "link", "sub/", "sub/b.txt", "sub/deep/", "sub/deep/c.go", "sub/empty"}, names)
+	assert.Equal(t, map[string]string{
+		"a.txt":         "a",
+		"big.bin":       big,
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+		"sub/empty":     "",
+	}, files)
+
+	assert.EqualValues(t, 0o600, hdrs["a.txt"].Mode&0o777)
+	assert.Equal(t, mtime, hdrs["sub/b.txt"].ModTime)
+	assert.Equal(t, byte(tar.TypeSymlink), hdrs["link"].Typeflag)
+	assert.Equal(t, "a.txt", hdrs["link"].Linkname)
+	assert.Equal(t, byte(tar.TypeDir), hdrs["sub/"].Typeflag)
+	assert.Equal(t, os.Getuid(), hdrs["a.txt"].Uid)
+
+	// compressed, under a prefix.
+	buf.Reset()
+	require.NoError(t, client.TarTo(ctx, filepath.Join(dir, "sub"), &buf, &TarOptions{Gzip: true, Prefix: "sub/"}))
+
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	names, _, _ = readArchive(zr)
+	assert.Equal(t, []string{"sub/", "sub/b.txt", "sub/deep/", "sub/deep/c.go", "sub/empty"}, names)
+
+	err = client.TarTo(ctx, filepath.Join(dir, "a.txt"), ioutil.Discard, nil)
+	assert.Error(t, err, "not a directory")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, client.TarTo(cancelled, dir, ioutil.Discard, nil), context.Canceled)
+}
@@ -0,0 +1,86 @@
+package sftp
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+var errModTimeNotStored = errors.New("sftp: the server did not store the modification time")
+
+// timeGranularities are the granularities reported by TimeGranularity, from finest to coarsest.
+// The SFTP v3 attributes carry whole seconds, so no finer granularity can be observed.
+var timeGranularities = []time.Duration{
+	time.Second,
+	2 * time.Second, // FAT
+	time.Minute,
+	time.Hour,
+	24 * time.Hour, // the access time of FAT
+}
+
+// timeProbe is the modification time set on the probe file,
+// chosen not to be a multiple of any of the timeGranularities.
+var timeProbe = time.Date(2001, time.February, 3, 4, 5, 7, 0, time.UTC)
+
+// TimeGranularity reports the granularity of the modification times stored by the server in the directory dir,
+// so that tools comparing modification times can choose a suitable tolerance,
+// rather than assuming the 1 second of most filesystems, or the 2 seconds of FAT.
+//
+// It creates a probe file in dir, sets its modification time, reads it back, and removes the file again.
+// The result is the smallest of 1 second, 2 seconds, 1 minute, 1 hour, and 24 hours that accounts for the rounding observed.
+// If the modification time read back is further off than that, the server is taken not to store modification times,
+// and an error is returned.
+func (c *Client) TimeGranularity(dir string) (time.Duration, error) {
+	name := path.Join(dir, ".sftp-time-probe-"+strconv.FormatUint(rand.Uint64(), 36))
+
+	f, err := c.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return 0, err
+	}
+	f.Close()
+	defer c.Remove(name)
+
+	if err := c.Chtimes(name, timeProbe, timeProbe); err != nil {
+		return 0, err
+	}
+
+	fi, err := c.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+
+	g, ok := timeGranularity(timeProbe, fi.ModTime())
+	if !ok {
+		return 0, errModTimeNotStored
+	}
+	return g, nil
+}
+
+// timeGranularity returns the granularity which accounts for set being stored as got,
+// or false if none of the timeGranularities does.
+func timeGranularity(set, got time.Time) (time.Duration, bool) {
+	diff := got.Sub(set)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	for _, g := range timeGranularities {
+		if diff < g {
+			return g, true
+		}
+	}
+	return 0, false
+}
+
+// ModTimesEqual reports whether the modification times a and b are the same,
+// when stored with the given granularity, as returned by TimeGranularity.
+func ModTimesEqual(a, b time.Time, granularity time.Duration) bool {
+	diff := a.Sub(b)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff < granularity
+}
@@ -0,0 +1,66 @@
+package sftp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeGranularity(t *testing.T) {
+	set := timeProbe
+
+	for _, tt := range []struct {
+		got  time.Time
+		want time.Duration
+	}{
+		{set, time.Second},
+		{set.Add(-time.Second), 2 * time.Second},
+		{set.Add(time.Second), 2 * time.Second},
+		{set.Truncate(time.Minute), time.Minute},
+		{set.Truncate(time.Hour), time.Hour},
+		{set.Truncate(24 * time.Hour), 24 * time.Hour},
+	} {
+		g, ok := timeGranularity(set, tt.got)
+		assert.True(t, ok, tt.got)
+		assert.Equal(t, tt.want, g, tt.got)
+	}
+
+	_, ok := timeGranularity(set, time.Now())
+	assert.False(t, ok)
+}
+
+func TestModTimesEqual(t *testing.T) {
+	a := timeProbe
+	assert.True(t, ModTimesEqual(a, a, time.Second))
+	assert.True(t, ModTimesEqual(a, a.Add(500*time.Millisecond), time.Second))
+	assert.False(t, ModTimesEqual(a, a.Add(time.Second), time.Second))
+	assert.True(t, ModTimesEqual(a.Add(time.Second), a, 2*time.Second))
+}
+
+func TestClientTimeGranularity(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	g, err := client.TimeGranularity(dir)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, g)
+
+	// the probe file is removed.
+	entries, err := client.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRequestTimeGranularityNotStored(t *testing.T) {
+	// the in-memory handler ignores modification times.
+	p := clientRequestServerPair(t)
+	defer p.Close()
+
+	_, err := p.cli.TimeGranularity("/")
+	assert.Equal(t, errModTimeNotStored, err)
+}
@@ -0,0 +1,299 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+// A TransferOption configures the transfer of a directory tree, by DownloadDir or UploadDir.
+type TransferOption func(*transferOptions)
+
+type transferOptions struct {
+	concurrency    int
+	followSymlinks bool
+}
+
+// transferConcurrencyDefault is the number of files transferred at once, unless WithTransferConcurrency is given.
+const transferConcurrencyDefault = 4
+
+// WithTransferConcurrency sets the number of files transferred at the same time, by default 4.
+// Each file is itself transferred with concurrent requests, up to the Client's MaxInflight.
+func WithTransferConcurrency(n int) TransferOption {
+	return func(o *transferOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithFollowSymlinks sets whether a symbolic link to a regular file is transferred as the file it points to.
+// By default, symbolic links are recreated at the destination, with the same target.
+// Symbolic links to directories are always recreated, rather than followed, so that a loop cannot make a transfer endless.
+func WithFollowSymlinks(follow bool) TransferOption {
+	return func(o *transferOptions) {
+		o.followSymlinks = follow
+	}
+}
+
+// DirTransferFailure is the failure to transfer one file, or directory, of a tree.
+type DirTransferFailure struct {
+	// Path is the slash-separated path relative to the transferred directory.
+	Path string
+
+	Err error
+}
+
+// DirTransferError lists the files of a directory tree which failed to transfer, while the others were transferred.
+type DirTransferError struct {
+	Failures []DirTransferFailure
+}
+
+func (e *DirTransferError) Error() string {
+	first := e.Failures[0]
+	if len(e.Failures) == 1 {
+		return fmt.Sprintf("sftp: transfer of %s failed: %v", first.Path, first.Err)
+	}
+	return fmt.Sprintf("sftp: transfer of %d files failed, first %s: %v", len(e.Failures), first.Path, first.Err)
+}
+
+// Unwrap returns the errors of the failures, so that errors.Is and errors.As look through them.
+func (e *DirTransferError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// DownloadDir downloads the remote directory remote, and everything below it, to the local directory local,
+// which is created if it does not exist.
+//
+// Files are downloaded concurrently, see WithTransferConcurrency, and are given the permissions and modification times
+// of the remote files, as are the directories.
+// Symbolic links are recreated, unless followed, see WithFollowSymlinks.
+// Other special files are skipped.
+// Existing files are replaced.
+//
+// The failure of a file, or of reading a directory, does not stop the download of the others.
+// If any failed, the error is a *DirTransferError listing them.
+// If the context is done, the download stops, and the error of the context is returned.
+func (c *Client) DownloadDir(ctx context.Context, remote, local string, opts ...TransferOption) error {
+	t := newDirTransfer(ctx, opts)
+	t.src, t.dst = remoteMirrorFS{ctx: ctx, c: c}, localMirrorFS{}
+	t.srcRoot, t.dstRoot = remote, local
+	return t.run()
+}
+
+// UploadDir uploads the local directory local, and everything below it, to the remote directory remote,
+// which is created if it does not exist, in the same way as DownloadDir.
+//
+// Files are uploaded concurrently, and each is written with concurrent requests, as with File.ReadFrom.
+// The failure of a file does not stop the upload of the others.
+// If any failed, the error is a *DirTransferError listing them.
+func (c *Client) UploadDir(ctx context.Context, local, remote string, opts ...TransferOption) error {
+	t := newDirTransfer(ctx, opts)
+	t.src, t.dst = localMirrorFS{}, remoteMirrorFS{ctx: ctx, c: c}
+	t.srcRoot, t.dstRoot = local, remote
+	return t.run()
+}
+
+// dirTransfer copies a directory tree from one mirrorFS to another.
+type dirTransfer struct {
+	ctx  context.Context
+	opts transferOptions
+
+	src, dst         mirrorFS
+	srcRoot, dstRoot string
+
+	files chan transferFile
+
+	mu       sync.Mutex
+	failures []DirTransferFailure
+
+	dirs []transferFile // directories created, in the order they were walked
+}
+
+type transferFile struct {
+	rel string
+	fi  os.FileInfo
+}
+
+func newDirTransfer(ctx context.Context, opts []TransferOption) *dirTransfer {
+	t := &dirTransfer{
+		ctx: ctx,
+		opts: transferOptions{
+			concurrency: transferConcurrencyDefault,
+		},
+	}
+	for _, opt := range opts {
+		opt(&t.opts)
+	}
+	if t.opts.concurrency < 1 {
+		t.opts.concurrency = transferConcurrencyDefault
+	}
+	return t
+}
+
+func (t *dirTransfer) run() error {
+	fi, err := t.src.stat(t.srcRoot)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "transfer", Path: t.srcRoot, Err: errors.New("not a directory")}
+	}
+
+	if err := t.dst.mkdirAll(t.dstRoot); err != nil {
+		return err
+	}
+	t.dirs = append(t.dirs, transferFile{".", fi})
+
+	t.files = make(chan transferFile)
+
+	var wg sync.WaitGroup
+	for i := 0; i < t.opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range t.files {
+				if err := t.copy(f); err != nil {
+					t.fail(f.rel, err)
+				}
+			}
+		}()
+	}
+
+	t.dir(".")
+	close(t.files)
+	wg.Wait()
+
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	// the permissions and modification times of directories are set last, as filling them in changes them,
+	// and the permissions might not allow it, and deepest first, for the same reason.
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		d := t.dirs[i]
+		name := t.dst.join(t.dstRoot, d.rel)
+		if err := t.dst.chmod(name, d.fi.Mode().Perm()); err != nil {
+			t.fail(d.rel, err)
+			continue
+		}
+		if err := t.dst.chtimes(name, d.fi.ModTime()); err != nil {
+			t.fail(d.rel, err)
+		}
+	}
+
+	if len(t.failures) > 0 {
+		sort.Slice(t.failures, func(i, j int) bool { return t.failures[i].Path < t.failures[j].Path })
+		return &DirTransferError{Failures: t.failures}
+	}
+	return nil
+}
+
+// copy copies the regular file f.
+func (t *dirTransfer) copy(f transferFile) error {
+	dstName := t.dst.join(t.dstRoot, f.rel)
+
+	// a symbolic link at the destination is replaced, rather than written through.
+	if dfi, err := t.dst.lstat(dstName); err == nil && dfi.Mode()&os.ModeSymlink != 0 {
+		if err := t.dst.removeAll(dstName); err != nil {
+			return err
+		}
+	}
+
+	return copyMirrorFile(t.src, t.dst, t.src.join(t.srcRoot, f.rel), dstName, f.fi)
+}
+
+func (t *dirTransfer) fail(rel string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures = append(t.failures, DirTransferFailure{Path: rel, Err: err})
+}
+
+// dir transfers the entries of the directory rel, and queues its files to the workers.
+// It returns false once the context is done.
+func (t *dirTransfer) dir(rel string) bool {
+	if t.ctx.Err() != nil {
+		return false
+	}
+
+	entries, err := t.src.readDir(t.src.join(t.srcRoot, rel))
+	if err != nil {
+		if t.ctx.Err() != nil {
+			return false
+		}
+		t.fail(rel, err)
+		return true
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, fi := range entries {
+		if err := checkEntryName(t.src.join(t.srcRoot, rel), fi.Name()); err != nil {
+			t.fail(rel, err)
+			continue
+		}
+		if !t.entry(path.Join(rel, fi.Name()), fi) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *dirTransfer) entry(rel string, fi os.FileInfo) bool {
+	srcName, dstName := t.src.join(t.srcRoot, rel), t.dst.join(t.dstRoot, rel)
+
+	if fi.Mode()&os.ModeSymlink != 0 && t.opts.followSymlinks {
+		if target, err := t.src.stat(srcName); err == nil && target.Mode().IsRegular() {
+			fi = target
+		}
+	}
+
+	switch {
+	case fi.Mode().IsRegular():
+		select {
+		case t.files <- transferFile{rel, fi}:
+			return true
+		case <-t.ctx.Done():
+			return false
+		}
+
+	case fi.IsDir():
+		if err := t.dst.mkdir(dstName); err != nil {
+			if dfi, serr := t.dst.lstat(dstName); serr != nil || !dfi.IsDir() {
+				t.fail(rel, err)
+				return true
+			}
+		}
+		t.dirs = append(t.dirs, transferFile{rel, fi})
+		return t.dir(rel)
+
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := t.src.readLink(srcName)
+		if err == nil {
+			err = t.dst.symlink(target, dstName)
+			if err != nil && t.replaceLink(dstName) {
+				err = t.dst.symlink(target, dstName)
+			}
+		}
+		if err != nil {
+			t.fail(rel, err)
+		}
+	}
+	return true
+}
+
+// replaceLink removes an existing file or symbolic link at name, so that a symbolic link can take its place,
+// and reports whether it did.
+func (t *dirTransfer) replaceLink(name string) bool {
+	fi, err := t.dst.lstat(name)
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	return t.dst.removeAll(name) == nil
+}
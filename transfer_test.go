@@ -0,0 +1,218 @@
+package sftp
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDownloadDir(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	remote, local := t.TempDir(), filepath.Join(t.TempDir(), "download")
+
+	files := map[string]string{
+		"a.txt":         "a",
+		"big.bin":       strings.Repeat("0123456789", 10000),
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+		"sub/empty":     "",
+	}
+	writeTree(t, remote, files)
+	require.NoError(t, os.Chmod(filepath.Join(remote, "a.txt"), 0o600))
+	require.NoError(t, os.Chmod(filepath.Join(remote, "sub", "deep"), 0o700))
+	mtime := time.Unix(1600000000, 0)
+	require.NoError(t, os.Chtimes(filepath.Join(remote, "sub", "b.txt"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(remote, "sub"), mtime, mtime))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(remote, "link")))
+
+	require.NoError(t, client.DownloadDir(ctx, remote, local, WithTransferConcurrency(2)))
+
+	got := readTree(t, local)
+	assert.Equal(t, "a", got["link"], "read through the link")
+	delete(got, "link")
+	assert.Equal(t, files, got)
+
+	fi, err := os.Stat(filepath.Join(local, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	fi, err = os.Stat(filepath.Join(local, "sub", "deep"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), fi.Mode().Perm())
+
+	for _, name := range []string{"sub/b.txt", "sub"} {
+		fi, err = os.Stat(filepath.Join(local, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		assert.Equal(t, mtime.Unix(), fi.ModTime().Unix(), name)
+	}
+
+	target, err := os.Readlink(filepath.Join(local, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt", target)
+
+	// followed, the link is downloaded as a file, replacing the link.
+	require.NoError(t, client.DownloadDir(ctx, remote, local, WithFollowSymlinks(true)))
+	fi, err = os.Lstat(filepath.Join(local, "link"))
+	require.NoError(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+
+	// a file which cannot be written does not stop the others.
+	require.NoError(t, os.RemoveAll(filepath.Join(local, "sub")))
+	require.NoError(t, os.Remove(filepath.Join(local, "a.txt")))
+	require.NoError(t, os.MkdirAll(filepath.Join(local, "a.txt", "in", "the", "way"), 0o755))
+
+	err = client.DownloadDir(ctx, remote, local)
+	var terr *DirTransferError
+	require.ErrorAs(t, err, &terr)
+	require.Len(t, terr.Failures, 1)
+	assert.Equal(t, "a.txt", terr.Failures[0].Path)
+
+	data, err := ioutil.ReadFile(filepath.Join(local, "sub", "deep", "c.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "ccc", string(data))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, client.DownloadDir(ctx, remote, local))
+}
+
+func TestClientUploadDir(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	local, remote := t.TempDir(), filepath.Join(t.TempDir(), "upload")
+
+	files := map[string]string{
+		"a.txt":         "a",
+		"big.bin":       strings.Repeat("0123456789", 10000),
+		"sub/b.txt":     "bb",
+		"sub/deep/c.go": "ccc",
+		"sub/empty":     "",
+	}
+	writeTree(t, local, files)
+	require.NoError(t, os.Chmod(filepath.Join(local, "a.txt"), 0o600))
+	mtime := time.Unix(1600000000, 0)
+	require.NoError(t, os.Chtimes(filepath.Join(local, "sub", "b.txt"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(local, "sub"), mtime, mtime))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(local, "link")))
+
+	require.NoError(t, client.UploadDir(ctx, local, remote))
+
+	got := readTree(t, remote)
+	delete(got, "link")
+	assert.Equal(t, files, got)
+
+	fi, err := os.Stat(filepath.Join(remote, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	for _, name := range []string{"sub/b.txt", "sub"} {
+		fi, err = os.Stat(filepath.Join(remote, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		assert.Equal(t, mtime.Unix(), fi.ModTime().Unix(), name)
+	}
+
+	target, err := os.Readlink(filepath.Join(remote, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "a.txt", target)
+
+	// files which cannot be written do not stop the others.
+	require.NoError(t, os.RemoveAll(filepath.Join(remote, "sub")))
+	for _, name := range []string{"a.txt", "big.bin"} {
+		require.NoError(t, os.Remove(filepath.Join(remote, name)))
+		require.NoError(t, os.MkdirAll(filepath.Join(remote, name, "in", "the", "way"), 0o755))
+	}
+
+	err = client.UploadDir(ctx, local, remote, WithTransferConcurrency(1))
+	var terr *DirTransferError
+	require.ErrorAs(t, err, &terr)
+	require.Len(t, terr.Failures, 2)
+	assert.Equal(t, "a.txt", terr.Failures[0].Path)
+	assert.Equal(t, "big.bin", terr.Failures[1].Path)
+
+	data, err := ioutil.ReadFile(filepath.Join(remote, "sub", "deep", "c.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "ccc", string(data))
+}
+
+// renamedFileInfo is an os.FileInfo listed under another name.
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi renamedFileInfo) Name() string { return fi.name }
+
+// hostileLister lists the directory "/tree/sub" a second time in "/tree", under a name the client sees as "..".
+type hostileLister struct {
+	FileLister
+}
+
+func (l hostileLister) Filelist(r *Request) (ListerAt, error) {
+	lister, err := l.FileLister.Filelist(r)
+	if err != nil || r.Method != "List" || r.Filepath != "/tree" {
+		return lister, err
+	}
+
+	entries := make([]os.FileInfo, 8)
+	n, err := lister.ListAt(entries, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	entries = entries[:n]
+	for _, fi := range entries {
+		if fi.Name() == "sub" {
+			entries = append(entries, renamedFileInfo{fi, "x/.."})
+		}
+	}
+	return listerat(entries), nil
+}
+
+// hostileTreePair returns a client of a server which lists a hostile name in "/tree",
+// which holds the file "ok.txt", and the directory "sub".
+func hostileTreePair(t *testing.T) *csPair {
+	handlers := InMemHandler()
+	handlers.FileList = hostileLister{handlers.FileList}
+	p := clientRequestServerPairWithHandlers(t, handlers)
+
+	require.NoError(t, p.cli.MkdirAll("/tree/sub"))
+	_, err := putTestFile(p.cli, "/tree/ok.txt", "ok")
+	require.NoError(t, err)
+	return p
+}
+
+func TestClientDownloadDirHostileListing(t *testing.T) {
+	p := hostileTreePair(t)
+	defer p.Close()
+
+	parent := t.TempDir()
+	local := filepath.Join(parent, "download")
+
+	err := p.cli.DownloadDir(context.Background(), "/tree", local)
+	var terr *DirTransferError
+	require.ErrorAs(t, err, &terr)
+	require.Len(t, terr.Failures, 1)
+	assert.Equal(t, ".", terr.Failures[0].Path)
+
+	// the other entries are downloaded, and nothing is written outside of the tree.
+	assert.Equal(t, map[string]string{"ok.txt": "ok"}, readTree(t, local))
+	entries, err := ioutil.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
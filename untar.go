@@ -0,0 +1,313 @@
+package sftp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UntarOptions configures Untar.
+type UntarOptions struct {
+	// Gzip decompresses the archive with gzip, as for a .tar.gz file.
+	Gzip bool
+
+	// Concurrency is the number of small files uploaded at the same time, by default 8.
+	Concurrency int
+}
+
+const (
+	// untarConcurrencyDefault is the number of files uploaded at once by Untar, unless UntarOptions.Concurrency is given.
+	untarConcurrencyDefault = 8
+
+	// untarBufferSize is the largest file Untar buffers in memory, to upload while it reads on through the archive.
+	untarBufferSize = 1 << 20
+)
+
+// Untar reads a tar archive from r, and extracts it under the remote directory destDir,
+// which is created if it does not exist.
+// A nil opts is the same as the zero UntarOptions.
+//
+// Directories, regular files, symbolic links, and hard links are extracted, with their permissions and modification times.
+// Other special files are skipped.
+// Existing files are replaced.
+//
+// Since the archive must be read in order, small files are buffered in memory,
+// and uploaded concurrently, while Untar reads on through the archive.
+// Each file is written with concurrent requests, as with File.ReadFromWithConcurrency.
+//
+// An entry whose name would place it outside of destDir, or at or below a symbolic link extracted from the archive,
+// is refused with an error, so that a malicious archive cannot write elsewhere on the server.
+//
+// Untar stops at the first error, leaving whatever was already extracted.
+// The context is checked between entries.
+func (c *Client) Untar(ctx context.Context, r io.Reader, destDir string, opts *UntarOptions) error {
+	if opts == nil {
+		opts = new(UntarOptions)
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = untarConcurrencyDefault
+	}
+
+	if opts.Gzip {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if err := c.MkdirAll(destDir); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	u := &untar{
+		ctx:      ctx,
+		cancel:   cancel,
+		c:        c,
+		dest:     destDir,
+		slots:    make(chan struct{}, concurrency),
+		dirs:     map[string]bool{".": true},
+		links:    make(map[string]bool),
+		inflight: make(map[string]bool),
+	}
+
+	err := u.run(tar.NewReader(r))
+	u.wg.Wait()
+
+	if err == nil {
+		err = u.firstErr()
+	}
+	if err != nil {
+		return err
+	}
+
+	// the modification times of directories are set last, as extracting their contents changes them.
+	for i := len(u.dirTimes) - 1; i >= 0; i-- {
+		dt := u.dirTimes[i]
+		if err := c.Chtimes(dt.name, dt.mtime, dt.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type untar struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	c      *Client
+	dest   string
+
+	slots chan struct{} // a slot for each upload in progress
+	wg    sync.WaitGroup
+
+	mu       sync.Mutex
+	err      error
+	inflight map[string]bool // names being uploaded
+
+	dirs     map[string]bool // directories known to exist, relative to dest
+	links    map[string]bool // symbolic links extracted, relative to dest
+	dirTimes []untarDirTime
+}
+
+type untarDirTime struct {
+	name  string
+	mtime time.Time
+}
+
+func (u *untar) run(tr *tar.Reader) error {
+	for {
+		if err := u.ctx.Err(); err != nil {
+			if ferr := u.firstErr(); ferr != nil {
+				return ferr
+			}
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := u.entry(tr, hdr); err != nil {
+			return err
+		}
+	}
+}
+
+// rel returns the slash-separated path of the entry name relative to the destination,
+// or an error if it would be outside it, or be, or be below, a symbolic link extracted before.
+func (u *untar) rel(name string) (string, error) {
+	rel := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", &os.PathError{Op: "untar", Path: name, Err: errors.New("path is outside of the destination")}
+	}
+
+	// the entry itself is refused too, as creating, or changing the mode of, a file over a link would follow it.
+	if u.links[rel] {
+		return "", &os.PathError{Op: "untar", Path: name, Err: errors.New("path is a symbolic link")}
+	}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if u.links[dir] {
+			return "", &os.PathError{Op: "untar", Path: name, Err: errors.New("path is below a symbolic link")}
+		}
+	}
+	return rel, nil
+}
+
+func (u *untar) entry(tr *tar.Reader, hdr *tar.Header) error {
+	rel, err := u.rel(hdr.Name)
+	if err != nil {
+		return err
+	}
+	name := path.Join(u.dest, rel)
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if !u.dirs[rel] {
+			if err := u.mkdirAll(rel); err != nil {
+				return err
+			}
+		}
+		if err := u.c.Chmod(name, hdr.FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+		u.dirTimes = append(u.dirTimes, untarDirTime{name, hdr.ModTime})
+		return nil
+
+	case tar.TypeReg:
+	case tar.TypeSymlink, tar.TypeLink:
+	default:
+		return nil
+	}
+
+	if err := u.mkdirAll(path.Dir(rel)); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	busy := u.inflight[rel]
+	u.mu.Unlock()
+	if busy || hdr.Typeflag == tar.TypeLink {
+		// a later entry for the same name replaces the earlier one,
+		// and a hard link needs its target in place, so wait for the uploads to finish.
+		u.wg.Wait()
+		if err := u.firstErr(); err != nil {
+			return err
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		u.c.Remove(name) // replace any existing file
+		if err := u.c.Symlink(hdr.Linkname, name); err != nil {
+			return err
+		}
+		u.links[rel] = true
+		return nil
+
+	case tar.TypeLink:
+		target, err := u.rel(hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		u.c.Remove(name)
+		return u.c.Link(path.Join(u.dest, target), name)
+	}
+
+	if hdr.Size > untarBufferSize {
+		return u.upload(name, hdr, tr)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(tr, hdr.Size))
+	if err != nil {
+		return err
+	}
+
+	select {
+	case u.slots <- struct{}{}:
+	case <-u.ctx.Done():
+		return u.ctx.Err()
+	}
+
+	u.mu.Lock()
+	u.inflight[rel] = true
+	u.mu.Unlock()
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		defer func() { <-u.slots }()
+
+		err := u.upload(name, hdr, bytes.NewReader(b))
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		delete(u.inflight, rel)
+		if err != nil && u.err == nil {
+			u.err = err
+			u.cancel()
+		}
+	}()
+	return nil
+}
+
+// mkdirAll creates the directory rel, relative to the destination, and its parents, unless they are known to exist.
+func (u *untar) mkdirAll(rel string) error {
+	if u.dirs[rel] {
+		return nil
+	}
+	if err := u.c.MkdirAll(path.Join(u.dest, rel)); err != nil {
+		return err
+	}
+	for dir := rel; dir != "."; dir = path.Dir(dir) {
+		u.dirs[dir] = true
+	}
+	return nil
+}
+
+// upload writes the content of the file hdr, read from r, to name.
+func (u *untar) upload(name string, hdr *tar.Header, r io.Reader) error {
+	f, err := u.c.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.ReadFromWithConcurrency(r, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := u.c.Chmod(name, hdr.FileInfo().Mode().Perm()); err != nil {
+		return err
+	}
+	return u.c.Chtimes(name, hdr.ModTime, hdr.ModTime)
+}
+
+func (u *untar) firstErr() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.err
+}
@@ -0,0 +1,153 @@
+package sftp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type untarTestEntry struct {
+	hdr  tar.Header
+	data string
+}
+
+func writeTestTar(t *testing.T, entries []untarTestEntry) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.data))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(e.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func TestClientUntar(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	ctx := context.Background()
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	mtime := time.Unix(1600000000, 0)
+	big := strings.Repeat("0123456789", untarBufferSize/10+1) // too large to buffer
+
+	archive := writeTestTar(t, []untarTestEntry{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "sub/", Mode: 0o750, ModTime: mtime}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "sub/a.txt", Mode: 0o600, ModTime: mtime}, data: "a"},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./big.bin", Mode: 0o644, ModTime: mtime}, data: big},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "implicit/dir/b.txt", Mode: 0o644, ModTime: mtime}, data: "bb"},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dup.txt", Mode: 0o644, ModTime: mtime}, data: "first"},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dup.txt", Mode: 0o644, ModTime: mtime}, data: "second"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "sub/a.txt", ModTime: mtime}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "hard", Linkname: "sub/a.txt", ModTime: mtime}},
+	})
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write(archive.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	require.NoError(t, client.Untar(ctx, &compressed, dest, &UntarOptions{Gzip: true, Concurrency: 2}))
+
+	assert.Equal(t, map[string]string{
+		"sub/a.txt":          "a",
+		"big.bin":            big,
+		"implicit/dir/b.txt": "bb",
+		"dup.txt":            "second",
+		"hard":               "a",
+		"link":               "a",
+	}, readTree(t, dest))
+
+	fi, err := os.Stat(filepath.Join(dest, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o750), fi.Mode().Perm())
+	assert.Equal(t, mtime, fi.ModTime(), "directory times are set after their contents")
+
+	fi, err = os.Stat(filepath.Join(dest, "sub", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	assert.Equal(t, mtime, fi.ModTime())
+
+	target, err := os.Readlink(filepath.Join(dest, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "sub/a.txt", target)
+
+	for _, entries := range [][]untarTestEntry{
+		{{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "../escape.txt", Mode: 0o644}, data: "x"}},
+		{{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "/abs.txt", Mode: 0o644}, data: "x"}},
+		{
+			{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "out", Linkname: t.TempDir()}},
+			{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "out/x.txt", Mode: 0o644}, data: "x"},
+		},
+	} {
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := client.Untar(ctx, writeTestTar(t, entries), dest, nil)
+		var pathErr *os.PathError
+		require.ErrorAs(t, err, &pathErr)
+		assert.Equal(t, "untar", pathErr.Op)
+	}
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(dest), "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = client.Untar(ctx, bytes.NewReader([]byte("not a tar archive, but long enough to read a header from it........")), dest, nil)
+	assert.Error(t, err)
+}
+
+func TestClientUntarOverSymlink(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	outside := t.TempDir()
+	target := filepath.Join(outside, "target")
+	require.NoError(t, ioutil.WriteFile(target, []byte("original"), 0o644))
+
+	for _, entries := range [][]untarTestEntry{
+		{
+			{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "evil", Linkname: target}},
+			{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "evil", Mode: 0o600}, data: "attacker data"},
+		},
+		{
+			{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "evil", Linkname: outside}},
+			{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "evil/", Mode: 0o777}},
+		},
+	} {
+		dest := filepath.Join(t.TempDir(), "dest")
+		err := client.Untar(context.Background(), writeTestTar(t, entries), dest, nil)
+		var pathErr *os.PathError
+		require.ErrorAs(t, err, &pathErr)
+		assert.Equal(t, "untar", pathErr.Op)
+	}
+
+	contents, err := ioutil.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(contents))
+
+	for _, name := range []string{target, outside} {
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.NotEqual(t, os.FileMode(0o600), fi.Mode().Perm(), name)
+		assert.NotEqual(t, os.FileMode(0o777), fi.Mode().Perm(), name)
+	}
+}
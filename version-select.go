@@ -0,0 +1,116 @@
+package sftp
+
+import (
+	"fmt"
+	"strconv"
+
+	sshfx "github.com/pkg/sftp/internal/encoding/ssh/filexfer"
+)
+
+// A server whose SSH_FXP_VERSION gives another version than the one requested by the client
+// may list the versions it also supports in the "versions" extension,
+// and the client then selects one of them with a "version-select" request, before any other request.
+// Both the Client and the servers of this package only implement version 3 of the protocol,
+// so that is the only version they select, or accept being selected.
+//
+// Defined in: https://tools.ietf.org/html/draft-ietf-secsh-filexfer-13#section-5.5
+
+const (
+	versionsExtension      = "versions"
+	versionSelectExtension = "version-select"
+)
+
+// negotiateVersion agrees on version 3 of the protocol with a server that answered SSH_FXP_INIT with version,
+// and the extensions exts, selecting it with a version-select request if the server offers it in its "versions" extension.
+func (c *Client) negotiateVersion(version uint32, exts []*sshfx.ExtensionPair) error {
+	selected, sel, ok := sshfx.NegotiateVersion(&sshfx.VersionPacket{
+		Version:    version,
+		Extensions: exts,
+	}, sftpProtocolVersion)
+	if !ok {
+		return &unexpectedVersionErr{sftpProtocolVersion, version}
+	}
+	if !sel {
+		return nil
+	}
+
+	// This is the first request, so it is sent and answered before the responses are received in the background.
+	id := c.nextID()
+	if err := c.clientConn.conn.sendPacket(&sshFxpVersionSelectPacket{
+		ID:      id,
+		Version: strconv.FormatUint(uint64(selected), 10),
+	}); err != nil {
+		return err
+	}
+
+	typ, data, err := c.recvPacket(0)
+	if err != nil {
+		return err
+	}
+	if typ != sshFxpStatus {
+		return &unexpectedPacketErr{sshFxpStatus, typ}
+	}
+	return normaliseError(unmarshalStatus(id, data))
+}
+
+// versionsExtensionPair returns the "versions" extension advertised by a server
+// which gives another version than 3 in its SSH_FXP_VERSION, so that clients can still select version 3.
+func versionsExtensionPair() sshExtensionPair {
+	ext := sshfx.ExtensionVersions(sftpProtocolVersion)
+	return sshExtensionPair{Name: ext.Name, Data: ext.Data}
+}
+
+// selectVersion returns the error a version-select request for version is answered with,
+// which is nil only for version 3.
+func selectVersion(version string) error {
+	if version != strconv.Itoa(sftpProtocolVersion) {
+		return fmt.Errorf("sftp: protocol version %q cannot be selected, only version %d is supported: %w", version, sftpProtocolVersion, ErrSSHFxOpUnsupported)
+	}
+	return nil
+}
+
+type sshFxpVersionSelectPacket struct {
+	ID      uint32
+	Version string
+}
+
+func (p *sshFxpVersionSelectPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpVersionSelectPacket) MarshalBinary() ([]byte, error) {
+	const ext = versionSelectExtension
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(ext) +
+		4 + len(p.Version)
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, ext)
+	b = marshalString(b, p.Version)
+
+	return b, nil
+}
+
+type sshFxpExtendedPacketVersionSelect struct {
+	ID              uint32
+	ExtendedRequest string
+	Version         string
+}
+
+func (p *sshFxpExtendedPacketVersionSelect) id() uint32     { return p.ID }
+func (p *sshFxpExtendedPacketVersionSelect) readonly() bool { return true }
+func (p *sshFxpExtendedPacketVersionSelect) UnmarshalBinary(b []byte) error {
+	var err error
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Version, _, err = unmarshalStringSafe(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *sshFxpExtendedPacketVersionSelect) respond(s *Server) responsePacket {
+	return statusFromError(p.ID, selectVersion(p.Version))
+}
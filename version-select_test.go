@@ -0,0 +1,69 @@
+package sftp
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientVersionSelect(t *testing.T) {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	server, err := NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{sr, sw}, WithServerAdvertisedVersion(6))
+	require.NoError(t, err)
+	go server.Serve()
+
+	var mu sync.Mutex
+	var selected []string
+	client, err := NewClientPipe(cr, cw, WithPacketTracer(PacketTracerFunc(func(t *PacketTrace) {
+		if p, ok := t.Packet.(*sshFxpVersionSelectPacket); ok {
+			mu.Lock()
+			defer mu.Unlock()
+			selected = append(selected, p.Version)
+		}
+	})))
+	require.NoError(t, err)
+	defer client.Close()
+	defer server.Close()
+
+	data, ok := client.HasExtension("versions")
+	assert.True(t, ok)
+	assert.Equal(t, "3", data)
+
+	_, err = client.Getwd()
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"3"}, selected)
+}
+
+func TestRequestServerVersionSelect(t *testing.T) {
+	p := clientRequestServerPair(t, WithRSAdvertisedVersion(5))
+	defer p.Close()
+
+	_, err := putTestFile(p.cli, "/foo", "hello")
+	assert.NoError(t, err)
+}
+
+func TestServerVersionSelect(t *testing.T) {
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	_, err := client.Extended(context.Background(), "version-select", marshalString(nil, "3"))
+	assert.NoError(t, err)
+
+	_, err = client.Extended(context.Background(), "version-select", marshalString(nil, "4"))
+	var status *StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, ErrSSHFxOpUnsupported, status.FxCode())
+}
@@ -0,0 +1,77 @@
+package sftp
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// WalkDir walks the remote file tree rooted at root, calling fn for each file or directory in the tree,
+// including root, with the semantics of filepath.WalkDir.
+//
+// The files are walked in lexical order, and fn is called for a directory before its entries.
+// If fn returns fs.SkipDir for a directory, its entries are skipped,
+// and for a file, the remaining entries of the directory containing it are skipped.
+// If fn returns fs.SkipAll, the walk stops, and WalkDir returns nil.
+// If reading a directory fails, fn is called a second time for it, with the error.
+//
+// Like filepath.WalkDir, the root is found with Lstat, and symbolic links are not followed.
+func (c *Client) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return c.WalkDirContext(context.Background(), root, fn)
+}
+
+// WalkDirContext is WalkDir, which stops with the error of the context once it is done,
+// checking it before each directory is read.
+func (c *Client) WalkDirContext(ctx context.Context, root string, fn fs.WalkDirFunc) error {
+	info, err := c.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = c.walkDir(ctx, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) walkDir(ctx context.Context, name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	infos, err := c.ReadDirContext(ctx, name)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+
+		// the second call, to report the error reading the directory.
+		if err := fn(name, d, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	for _, info := range infos {
+		if err := c.walkDir(ctx, path.Join(name, info.Name()), fs.FileInfoToDirEntry(info), fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package sftp
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientWalkDir(t *testing.T) {
+	skipIfWindows(t)
+	client, server := clientServerPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":         "a",
+		"b/c.txt":       "c",
+		"b/d/e.txt":     "e",
+		"f/g.txt":       "g",
+		"f/h.txt":       "h",
+		"z.txt":         "z",
+		"skip/skipped":  "",
+		"skip/skipped2": "",
+	})
+	require.NoError(t, os.Symlink("b", filepath.Join(dir, "link")))
+
+	walk := func(walker func(string, fs.WalkDirFunc) error, skip func(rel string, d fs.DirEntry) error) []string {
+		var seen []string
+		err := walker(dir, func(p string, d fs.DirEntry, err error) error {
+			require.NoError(t, err)
+			rel, err := filepath.Rel(dir, p)
+			require.NoError(t, err)
+			seen = append(seen, rel)
+			if d.Type()&fs.ModeSymlink != 0 {
+				rel += "@"
+				seen[len(seen)-1] = rel
+			}
+			return skip(rel, d)
+		})
+		require.NoError(t, err)
+		return seen
+	}
+
+	for _, skip := range []func(string, fs.DirEntry) error{
+		func(string, fs.DirEntry) error { return nil },
+		func(rel string, d fs.DirEntry) error {
+			switch rel {
+			case "skip":
+				return fs.SkipDir
+			case "f/g.txt":
+				return fs.SkipDir
+			case "link@":
+				return fs.SkipAll
+			}
+			return nil
+		},
+	} {
+		want := walk(filepath.WalkDir, skip)
+		got := walk(client.WalkDir, skip)
+		assert.Equal(t, want, got)
+	}
+
+	var seen []string
+	err := client.WalkDir(filepath.Join(dir, "missing"), func(p string, d fs.DirEntry, err error) error {
+		seen = append(seen, p)
+		assert.Nil(t, d)
+		return err
+	})
+	assert.True(t, os.IsNotExist(err), err)
+	assert.Len(t, seen, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.WalkDirContext(ctx, dir, func(string, fs.DirEntry, error) error { return nil })
+	assert.Equal(t, context.Canceled, err)
+}
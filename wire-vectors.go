@@ -0,0 +1,275 @@
+package sftp
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+)
+
+// WireVector is the canonical encoding of an SFTP packet with fixed field values,
+// as this package puts it on the wire.
+//
+// The vectors are intended for other implementations of the protocol, such as in other languages, or proxies,
+// to check their compatibility with this package programmatically.
+// The encoding of a vector will not change, short of a bug in this package,
+// though vectors may be added in later versions.
+type WireVector struct {
+	// Name identifies the vector, such as "SSH_FXP_OPEN",
+	// or for an extended request, the name of the extension, such as "SSH_FXP_EXTENDED statvfs@openssh.com".
+	Name string
+
+	// Type is the packet type, which is Frame[4].
+	Type uint8
+
+	// Fields describes the field values that were encoded, as rendered by DumpPacket.
+	Fields string
+
+	// Frame is the packet as it appears on the wire,
+	// including the leading uint32(length) and byte(type).
+	Frame []byte
+}
+
+// The fixed values used by the wire vectors.
+// The request id, offset, and the like are chosen with distinct bytes, so that a wrong byte order is evident.
+const (
+	wireVectorID     = 0x01020304
+	wireVectorHandle = "\x00handle\xff"
+	wireVectorPath   = "/path/to/file"
+	wireVectorTarget = "/path/to/target"
+	wireVectorOffset = 0x0102030405060708
+)
+
+var wireVectorData = []byte("Hello, World!\n")
+
+// wireVectorStat is the file attributes of the wire vectors, with every field present.
+func wireVectorStat() *FileStat {
+	return &FileStat{
+		Size:  0x0102030405060708,
+		Mode:  0o100644,
+		Mtime: 0x5f5e1000,
+		Atime: 0x5f5e0f00,
+		UID:   1000,
+		GID:   100,
+		Extended: []StatExtended{
+			{ExtType: "vector@pkg.sftp", ExtData: "extended data"},
+		},
+	}
+}
+
+// wireVectorInfo is the file attributes of the wire vectors as an os.FileInfo,
+// which the server encodes with the size, permissions, and times.
+func wireVectorInfo() *fileInfo {
+	return &fileInfo{name: "file", stat: wireVectorStat()}
+}
+
+func wireVectorPackets() []struct {
+	name string
+	pkt  encoding.BinaryMarshaler
+} {
+	return []struct {
+		name string
+		pkt  encoding.BinaryMarshaler
+	}{
+		// Requests, as sent by the Client.
+		{"SSH_FXP_INIT", &sshFxInitPacket{
+			Version: sftpProtocolVersion,
+		}},
+		{"SSH_FXP_OPEN", &sshFxpOpenPacket{
+			ID:     wireVectorID,
+			Path:   wireVectorPath,
+			Pflags: sshFxfWrite | sshFxfCreat | sshFxfTrunc,
+			Flags:  sshFileXferAttrPermissions,
+			Attrs:  wireVectorStat(),
+		}},
+		{"SSH_FXP_CLOSE", &sshFxpClosePacket{ID: wireVectorID, Handle: wireVectorHandle}},
+		{"SSH_FXP_READ", &sshFxpReadPacket{
+			ID:     wireVectorID,
+			Handle: wireVectorHandle,
+			Offset: wireVectorOffset,
+			Len:    32768,
+		}},
+		{"SSH_FXP_WRITE", &sshFxpWritePacket{
+			ID:     wireVectorID,
+			Handle: wireVectorHandle,
+			Offset: wireVectorOffset,
+			Length: uint32(len(wireVectorData)),
+			Data:   wireVectorData,
+		}},
+		{"SSH_FXP_LSTAT", &sshFxpLstatPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_FSTAT", &sshFxpFstatPacket{ID: wireVectorID, Handle: wireVectorHandle}},
+		{"SSH_FXP_SETSTAT", &sshFxpSetstatPacket{
+			ID:    wireVectorID,
+			Path:  wireVectorPath,
+			Flags: sshFileXferAttrAll,
+			Attrs: wireVectorStat(),
+		}},
+		{"SSH_FXP_FSETSTAT", &sshFxpFsetstatPacket{
+			ID:     wireVectorID,
+			Handle: wireVectorHandle,
+			Flags:  sshFileXferAttrSize | sshFileXferAttrACmodTime,
+			Attrs:  wireVectorStat(),
+		}},
+		{"SSH_FXP_OPENDIR", &sshFxpOpendirPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_READDIR", &sshFxpReaddirPacket{ID: wireVectorID, Handle: wireVectorHandle}},
+		{"SSH_FXP_REMOVE", &sshFxpRemovePacket{ID: wireVectorID, Filename: wireVectorPath}},
+		{"SSH_FXP_MKDIR", &sshFxpMkdirPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_RMDIR", &sshFxpRmdirPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_REALPATH", &sshFxpRealpathPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_STAT", &sshFxpStatPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_RENAME", &sshFxpRenamePacket{ID: wireVectorID, Oldpath: wireVectorPath, Newpath: wireVectorTarget}},
+		{"SSH_FXP_READLINK", &sshFxpReadlinkPacket{ID: wireVectorID, Path: wireVectorPath}},
+		// The arguments are in the order OpenSSH sends them, which is the reverse of the draft, see sshFxpSymlinkPacket.
+		{"SSH_FXP_SYMLINK", &sshFxpSymlinkPacket{ID: wireVectorID, Targetpath: wireVectorTarget, Linkpath: wireVectorPath}},
+		{"SSH_FXP_EXTENDED posix-rename@openssh.com", &sshFxpPosixRenamePacket{
+			ID:      wireVectorID,
+			Oldpath: wireVectorPath,
+			Newpath: wireVectorTarget,
+		}},
+		{"SSH_FXP_EXTENDED statvfs@openssh.com", &sshFxpStatvfsPacket{ID: wireVectorID, Path: wireVectorPath}},
+		{"SSH_FXP_EXTENDED hardlink@openssh.com", &sshFxpHardlinkPacket{
+			ID:      wireVectorID,
+			Oldpath: wireVectorTarget,
+			Newpath: wireVectorPath,
+		}},
+		{"SSH_FXP_EXTENDED expand-path@openssh.com", &sshFxpExpandPathPacket{ID: wireVectorID, Path: "~/" + wireVectorPath}},
+		{"SSH_FXP_EXTENDED copy-data@openssh.com", &sshFxpCopyDataPacket{
+			ID:          wireVectorID,
+			ReadHandle:  wireVectorHandle,
+			ReadOffset:  0x1000,
+			ReadLength:  0x2000,
+			WriteHandle: wireVectorHandle + "2",
+			WriteOffset: 0x3000,
+		}},
+		{"SSH_FXP_EXTENDED copy-file", &sshFxpCopyFilePacket{
+			ID:          wireVectorID,
+			Source:      wireVectorPath,
+			Destination: wireVectorTarget,
+			Overwrite:   true,
+		}},
+		{"SSH_FXP_EXTENDED check-file-name", &sshFxpCheckFilePacket{
+			ID:         wireVectorID,
+			Extension:  "check-file-name",
+			Target:     wireVectorPath,
+			Algorithms: "sha256,md5",
+			Offset:     0x1000,
+			Length:     0x2000,
+			BlockSize:  0x400,
+		}},
+		{"SSH_FXP_EXTENDED check-file-handle", &sshFxpCheckFilePacket{
+			ID:         wireVectorID,
+			Extension:  "check-file-handle",
+			Target:     wireVectorHandle,
+			Algorithms: "sha256",
+		}},
+		{"SSH_FXP_EXTENDED fsync@openssh.com", &sshFxpFsyncPacket{ID: wireVectorID, Handle: wireVectorHandle}},
+		{"SSH_FXP_EXTENDED ping@pkg.sftp", &sshFxpPingPacket{ID: wireVectorID}},
+		{"SSH_FXP_EXTENDED cancel@pkg.sftp", &sshFxpCancelPacket{ID: wireVectorID, RequestID: wireVectorID - 1}},
+		{"SSH_FXP_EXTENDED write-ack-batch@pkg.sftp", &sshFxpWriteBatchPacket{
+			ID:     wireVectorID,
+			Handle: wireVectorHandle,
+			Offset: wireVectorOffset,
+			Flags:  writeBatchAck,
+			Data:   wireVectorData,
+		}},
+
+		// Responses, as sent by the Server and RequestServer.
+		{"SSH_FXP_VERSION", &sshFxVersionPacket{
+			Version: sftpProtocolVersion,
+			Extensions: []sshExtensionPair{
+				{"posix-rename@openssh.com", "1"},
+				{"statvfs@openssh.com", "2"},
+			},
+		}},
+		{"SSH_FXP_STATUS", &sshFxpStatusPacket{
+			ID: wireVectorID,
+			StatusError: StatusError{
+				Code: sshFxNoSuchFile,
+				msg:  "no such file",
+				lang: "en",
+			},
+		}},
+		{"SSH_FXP_HANDLE", &sshFxpHandlePacket{ID: wireVectorID, Handle: wireVectorHandle}},
+		{"SSH_FXP_DATA", &sshFxpDataPacket{
+			ID:     wireVectorID,
+			Length: uint32(len(wireVectorData)),
+			Data:   append([]byte(nil), wireVectorData...),
+		}},
+		{"SSH_FXP_NAME", &sshFxpNamePacket{
+			ID: wireVectorID,
+			NameAttrs: []*sshFxpNameAttr{
+				{
+					Name:     "file",
+					LongName: "-rw-r--r-- 1 1000 100 file",
+					Attrs:    []interface{}{wireVectorInfo()},
+				},
+				{
+					Name:     "..",
+					LongName: "..",
+					Attrs:    emptyFileStat,
+				},
+			},
+		}},
+		{"SSH_FXP_ATTRS", &sshFxpStatResponse{ID: wireVectorID, info: wireVectorInfo()}},
+		{"SSH_FXP_EXTENDED_REPLY statvfs@openssh.com", &StatVFS{
+			ID:      wireVectorID,
+			Bsize:   4096,
+			Frsize:  4096,
+			Blocks:  0x0102030405060708,
+			Bfree:   0x0102030405,
+			Bavail:  0x01020304,
+			Files:   0x010203,
+			Ffree:   0x0102,
+			Favail:  0x01,
+			Fsid:    0x0807060504030201,
+			Flag:    0x1, // ST_RDONLY
+			Namemax: 255,
+		}},
+	}
+}
+
+// WireVectors returns a wire vector for every packet type, and every extended request,
+// that this package sends.
+// Each call returns a new slice, which the caller may modify.
+func WireVectors() []WireVector {
+	pkts := wireVectorPackets()
+
+	vectors := make([]WireVector, 0, len(pkts))
+	for _, v := range pkts {
+		var buf bytes.Buffer
+		if err := sendPacket(&buf, v.pkt); err != nil {
+			panic(fmt.Sprintf("sftp: marshaling wire vector %s: %v", v.name, err))
+		}
+
+		frame := buf.Bytes()
+		vectors = append(vectors, WireVector{
+			Name:   v.name,
+			Type:   frame[4],
+			Fields: DumpPacket(frame),
+			Frame:  frame,
+		})
+	}
+	return vectors
+}
+
+// VerifyWireVector checks that frame is exactly the canonical encoding of the wire vector with the given name,
+// as returned by WireVectors.
+// The frame must include the leading uint32(length).
+// If it differs, the error gives the offset of the first differing byte.
+func VerifyWireVector(name string, frame []byte) error {
+	for _, v := range WireVectors() {
+		if v.Name != name {
+			continue
+		}
+
+		for i := 0; i < len(frame) && i < len(v.Frame); i++ {
+			if frame[i] != v.Frame[i] {
+				return fmt.Errorf("sftp: wire vector %s: byte %d is %#02x, want %#02x", name, i, frame[i], v.Frame[i])
+			}
+		}
+		if len(frame) != len(v.Frame) {
+			return fmt.Errorf("sftp: wire vector %s: frame is %d bytes, want %d", name, len(frame), len(v.Frame))
+		}
+		return nil
+	}
+	return fmt.Errorf("sftp: unknown wire vector %q", name)
+}
@@ -0,0 +1,48 @@
+package sftp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wireVectorsDigest pins the encoding of every wire vector.
+// It must only change when a vector is added, or an encoding bug is fixed.
+const wireVectorsDigest = "c175df548246cbde5c6cf1bb676724240702fb41dc7cb548f85ba4c80eac74e3"
+
+func TestWireVectors(t *testing.T) {
+	vectors := WireVectors()
+	require.NotEmpty(t, vectors)
+
+	h := sha256.New()
+	seen := make(map[string]bool)
+	for _, v := range vectors {
+		assert.False(t, seen[v.Name], "duplicate vector %s", v.Name)
+		seen[v.Name] = true
+
+		assert.Equal(t, v.Type, v.Frame[4], v.Name)
+		assert.Contains(t, v.Fields, fxp(v.Type).String(), v.Name)
+		assert.NoError(t, VerifyWireVector(v.Name, v.Frame), v.Name)
+
+		h.Write([]byte(v.Name))
+		h.Write(v.Frame)
+	}
+
+	assert.Equal(t, wireVectorsDigest, hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestVerifyWireVector(t *testing.T) {
+	frame := WireVectors()[1].Frame
+	name := WireVectors()[1].Name
+
+	bad := append([]byte(nil), frame...)
+	bad[5]++
+	assert.EqualError(t, VerifyWireVector(name, bad), "sftp: wire vector SSH_FXP_OPEN: byte 5 is 0x02, want 0x01")
+
+	assert.EqualError(t, VerifyWireVector(name, frame[:len(frame)-1]), "sftp: wire vector SSH_FXP_OPEN: frame is 37 bytes, want 38")
+
+	assert.EqualError(t, VerifyWireVector("SSH_FXP_BOGUS", frame), `sftp: unknown wire vector "SSH_FXP_BOGUS"`)
+}
@@ -0,0 +1,122 @@
+package sftp
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// WorkerPools sizes the pools of workers that serve the requests of a session, and their queues.
+// The zero value of a field selects its default.
+//
+// Reads and writes are served by the data workers, and every other request by the metadata workers,
+// so that a backlog of large reads does not hold back a stat or a readdir, as long as the data queue has room.
+type WorkerPools struct {
+	// DataWorkers is the number of workers for reads and writes, by default SftpServerWorkerCount.
+	DataWorkers int
+
+	// DataQueue is the number of reads and writes that may wait for a data worker, by default DataWorkers.
+	// Once it is full, no further request of any kind is taken from the connection until a data worker is free.
+	DataQueue int
+
+	// MetadataWorkers is the number of workers for all other requests, by default 1,
+	// which serves them one at a time, in the order they were received.
+	//
+	// With more than one, requests on the same handle, such as a sequence of readdir, are still served in order,
+	// but requests by path are served concurrently, so the backend must be safe for concurrent use,
+	// and a client must wait for the response to a request before it sends one that depends on it,
+	// such as a remove of a file it has just asked to rename.
+	MetadataWorkers int
+
+	// MetadataQueue is the number of requests that may wait for each metadata worker, by default none.
+	MetadataQueue int
+}
+
+// WorkerPoolsHinter is an optional interface for the Handlers of a RequestServer,
+// by which a backend declares the WorkerPools that suit it,
+// such as more data workers for a store of high latency,
+// or more than one metadata worker for one that is safe for concurrent use.
+//
+// The first of FileGet, FilePut, FileCmd and FileList to implement it is used,
+// and the fields set with WithRSWorkerPools take precedence over it.
+type WorkerPoolsHinter interface {
+	WorkerPools() WorkerPools
+}
+
+// or returns p, with each field that is not set taken from q.
+func (p WorkerPools) or(q WorkerPools) WorkerPools {
+	if p.DataWorkers <= 0 {
+		p.DataWorkers = q.DataWorkers
+	}
+	if p.DataQueue <= 0 {
+		p.DataQueue = q.DataQueue
+	}
+	if p.MetadataWorkers <= 0 {
+		p.MetadataWorkers = q.MetadataWorkers
+	}
+	if p.MetadataQueue <= 0 {
+		p.MetadataQueue = q.MetadataQueue
+	}
+	return p
+}
+
+// withDefaults returns p, with each field that is not set at its default.
+func (p WorkerPools) withDefaults() WorkerPools {
+	p = p.or(WorkerPools{
+		DataWorkers:     SftpServerWorkerCount,
+		MetadataWorkers: 1,
+	})
+	if p.DataQueue <= 0 {
+		p.DataQueue = p.DataWorkers
+	}
+	if p.MetadataQueue < 0 {
+		p.MetadataQueue = 0
+	}
+	return p
+}
+
+// hintedWorkerPools returns the WorkerPools declared by the Handlers h, if any, see WorkerPoolsHinter.
+func hintedWorkerPools(h Handlers) WorkerPools {
+	for _, handler := range []interface{}{h.FileGet, h.FilePut, h.FileCmd, h.FileList} {
+		if hinter, ok := handler.(WorkerPoolsHinter); ok {
+			return hinter.WorkerPools()
+		}
+	}
+	return WorkerPools{}
+}
+
+// metadataWorker returns which of the n metadata workers serves the request pkt,
+// which is the same for every request on a handle, so that they stay in order.
+func metadataWorker(pkt orderedRequest, n int) int {
+	if n == 1 {
+		return 0
+	}
+
+	if handle, ok := requestHandle(pkt); ok {
+		h := fnv.New32a()
+		h.Write([]byte(handle))
+		return int(h.Sum32() % uint32(n))
+	}
+
+	return int(pkt.orderID() % uint32(n))
+}
+
+// WithWorkerPools sets the sizes of the pools of workers of the Server, and their queues, see WorkerPools.
+// A negative size is an error.
+func WithWorkerPools(pools WorkerPools) ServerOption {
+	return func(s *Server) error {
+		if pools.DataWorkers < 0 || pools.DataQueue < 0 || pools.MetadataWorkers < 0 || pools.MetadataQueue < 0 {
+			return errors.New("sftp: negative worker pool size")
+		}
+
+		s.pktMgr.pools = pools
+		return nil
+	}
+}
+
+// WithRSWorkerPools sets the sizes of the pools of workers of the RequestServer, and their queues, see WorkerPools.
+// The fields that are not set are taken from the Handlers, if they implement WorkerPoolsHinter, or are at their defaults.
+func WithRSWorkerPools(pools WorkerPools) RequestServerOption {
+	return func(rs *RequestServer) {
+		rs.pktMgr.pools = pools
+	}
+}
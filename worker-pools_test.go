@@ -0,0 +1,84 @@
+package sftp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolsDefaults(t *testing.T) {
+	assert.Equal(t, WorkerPools{
+		DataWorkers:     SftpServerWorkerCount,
+		DataQueue:       SftpServerWorkerCount,
+		MetadataWorkers: 1,
+	}, WorkerPools{}.withDefaults())
+
+	set := WorkerPools{DataWorkers: 2}
+	hinted := WorkerPools{DataWorkers: 16, MetadataWorkers: 4}
+	assert.Equal(t, WorkerPools{
+		DataWorkers:     2,
+		DataQueue:       2,
+		MetadataWorkers: 4,
+	}, set.or(hinted).withDefaults())
+
+	_, err := NewServer(nil, WithWorkerPools(WorkerPools{MetadataWorkers: -1}))
+	assert.Error(t, err)
+}
+
+// slowStatLister holds back the requests for "/slow" until release is closed,
+// and declares that it is safe for concurrent metadata requests.
+type slowStatLister struct {
+	FileLister
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (l slowStatLister) Filelist(r *Request) (ListerAt, error) {
+	if r.Filepath == "/slow" {
+		close(l.entered)
+		<-l.release
+	}
+	return l.FileLister.Filelist(r)
+}
+
+func (l slowStatLister) WorkerPools() WorkerPools {
+	return WorkerPools{MetadataWorkers: 2}
+}
+
+func TestRequestServerMetadataWorkers(t *testing.T) {
+	lister := slowStatLister{
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	handlers := InMemHandler()
+	lister.FileLister = handlers.FileList
+	handlers.FileList = lister
+
+	p := clientRequestServerPairWithHandlers(t, handlers, WithRSResponseOrdering(ResponseOrderFree))
+	defer p.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.cli.Stat("/slow")
+		done <- err
+	}()
+	<-lister.entered
+
+	fast := make(chan error, 1)
+	go func() {
+		_, err := p.cli.Stat("/")
+		fast <- err
+	}()
+
+	select {
+	case err := <-fast:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stat held back behind a slow stat")
+	}
+
+	close(lister.release)
+	assert.Error(t, <-done) // it does not exist.
+}
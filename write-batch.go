@@ -0,0 +1,243 @@
+package sftp
+
+import (
+	"context"
+	"sync"
+)
+
+// The "write-ack-batch@pkg.sftp" extension is a write, which the server only answers if the client asks it to.
+// The request is an SSH_FXP_EXTENDED request with the fields:
+//
+//	uint32 id
+//	string "write-ack-batch@pkg.sftp"
+//	string handle
+//	uint64 offset
+//	uint32 flags
+//	string data
+//
+// If flags has writeBatchAck set, the server answers with an SSH_FXP_STATUS,
+// giving the first failure of the write, and of all the unanswered writes to the handle since the last answered one.
+// Otherwise, the server sends no response at all, and the client must not wait for one.
+// Any failure not yet reported when the handle is closed is given in the response to SSH_FXP_CLOSE instead.
+//
+// The server performs the writes in the order they are received, before any later request,
+// so the client may send a batch of them without waiting, rather than waiting for the status of each.
+
+const writeBatchExtension = "write-ack-batch@pkg.sftp"
+
+const writeBatchAck = 0x00000001
+
+// sshFxpWriteBatchPacket is the client form of a write under write-ack-batch@pkg.sftp.
+type sshFxpWriteBatchPacket struct {
+	ID     uint32
+	Handle string
+	Offset uint64
+	Flags  uint32
+	Data   []byte
+}
+
+func (p *sshFxpWriteBatchPacket) id() uint32 { return p.ID }
+
+func (p *sshFxpWriteBatchPacket) marshalPacket() ([]byte, []byte, error) {
+	l := 4 + 1 + 4 + // uint32(length) + byte(type) + uint32(id)
+		4 + len(writeBatchExtension) +
+		4 + len(p.Handle) +
+		8 + // uint64(offset)
+		4 + // uint32(flags)
+		4 // uint32(len(data))
+
+	b := make([]byte, 4, l)
+	b = append(b, sshFxpExtended)
+	b = marshalUint32(b, p.ID)
+	b = marshalString(b, writeBatchExtension)
+	b = marshalString(b, p.Handle)
+	b = marshalUint64(b, p.Offset)
+	b = marshalUint32(b, p.Flags)
+	b = marshalUint32(b, uint32(len(p.Data)))
+
+	return b, p.Data, nil
+}
+
+func (p *sshFxpWriteBatchPacket) MarshalBinary() ([]byte, error) {
+	header, payload, err := p.marshalPacket()
+	return append(header, payload...), err
+}
+
+// sshFxpExtendedPacketWriteBatch is the server form of a write under write-ack-batch@pkg.sftp.
+type sshFxpExtendedPacketWriteBatch struct {
+	ID              uint32
+	ExtendedRequest string
+	Handle          string
+	Offset          uint64
+	Flags           uint32
+	Data            []byte
+}
+
+func (p *sshFxpExtendedPacketWriteBatch) id() uint32        { return p.ID }
+func (p *sshFxpExtendedPacketWriteBatch) readonly() bool    { return false }
+func (p *sshFxpExtendedPacketWriteBatch) getHandle() string { return p.Handle }
+func (p *sshFxpExtendedPacketWriteBatch) UnmarshalBinary(b []byte) error {
+	var err error
+	var data string
+	if p.ID, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if p.ExtendedRequest, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Handle, b, err = unmarshalStringSafe(b); err != nil {
+		return err
+	} else if p.Offset, b, err = unmarshalUint64Safe(b); err != nil {
+		return err
+	} else if p.Flags, b, err = unmarshalUint32Safe(b); err != nil {
+		return err
+	} else if data, _, err = unmarshalStringSafe(b); err != nil {
+		return err
+	}
+	p.Data = []byte(data)
+	return nil
+}
+
+// writePacket returns the write as an SSH_FXP_WRITE, so that it may be performed in the same way.
+func (p *sshFxpExtendedPacketWriteBatch) writePacket() *sshFxpWritePacket {
+	return &sshFxpWritePacket{
+		ID:     p.ID,
+		Handle: p.Handle,
+		Offset: p.Offset,
+		Length: uint32(len(p.Data)),
+		Data:   p.Data,
+	}
+}
+
+func (p *sshFxpExtendedPacketWriteBatch) respond(s *Server) responsePacket {
+	f, ok := s.getHandle(p.Handle)
+	var err error = EBADF
+	if ok {
+		_, err = f.WriteAt(p.Data, int64(p.Offset))
+	}
+	return s.batches.complete(p, statusFromError(p.ID, err))
+}
+
+// noResponse stands in for the response to a request which, by agreement with the client, is not answered.
+// It keeps the place of the request in the order of responses, but is never sent.
+type noResponse struct {
+	ID uint32
+}
+
+func (p *noResponse) id() uint32                     { return p.ID }
+func (p *noResponse) MarshalBinary() ([]byte, error) { return nil, nil }
+
+func isNoResponse(p responsePacket) bool {
+	_, ok := p.(*noResponse)
+	return ok
+}
+
+// writeBatches holds the first failure of the unanswered writes to each handle under write-ack-batch@pkg.sftp.
+type writeBatches struct {
+	mu     sync.Mutex
+	failed map[string]*sshFxpStatusPacket
+}
+
+// complete returns the response to the batched write p, whose own outcome is status.
+func (b *writeBatches) complete(p *sshFxpExtendedPacketWriteBatch, status *sshFxpStatusPacket) responsePacket {
+	if p.Flags&writeBatchAck != 0 {
+		return b.settle(p.Handle, status)
+	}
+
+	if status.Code != sshFxOk {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.failed[p.Handle]; !ok {
+			if b.failed == nil {
+				b.failed = make(map[string]*sshFxpStatusPacket)
+			}
+			b.failed[p.Handle] = status
+		}
+	}
+
+	return &noResponse{ID: p.ID}
+}
+
+// refuse returns the response to the request p, which is refused with err,
+// taking care not to answer a batched write which is not to be answered,
+// whether or not it is still wrapped in its sshFxpExtendedPacket.
+func (b *writeBatches) refuse(p requestPacket, err error) responsePacket {
+	specific := p
+	if epkt, ok := p.(*sshFxpExtendedPacket); ok {
+		specific = epkt.SpecificPacket
+	}
+	if wpkt, ok := specific.(*sshFxpExtendedPacketWriteBatch); ok {
+		return b.complete(wpkt, statusFromError(p.id(), err))
+	}
+	return statusFromError(p.id(), err)
+}
+
+// settle replaces status with the first unreported failure of the batched writes to handle, if any,
+// as that failure happened first, and forgets it.
+func (b *writeBatches) settle(handle string, status *sshFxpStatusPacket) *sshFxpStatusPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failed, ok := b.failed[handle]; ok {
+		delete(b.failed, handle)
+		status.StatusError, status.extended = failed.StatusError, failed.extended
+	}
+	return status
+}
+
+// UseWriteAckBatching makes File.ReadFrom, when it is not writing concurrently,
+// send its writes under the write-ack-batch@pkg.sftp extension, if the server supports it,
+// asking for an acknowledgement only once every batchSize bytes, and at the end of the data.
+// This saves a round trip per write, and most of the responses, for uploads between this package's Client and Server.
+//
+// As the outcome of a write is only known once its batch is acknowledged,
+// if ReadFrom fails, the count it returns may include data that was not written.
+// A batchSize of zero or less disables batching.
+func UseWriteAckBatching(batchSize int) ClientOption {
+	return func(c *Client) error {
+		c.writeAckBatch = batchSize
+		return nil
+	}
+}
+
+// writeBatched writes b at off under write-ack-batch@pkg.sftp.
+// Unless ack is set, the write is sent without waiting for, or expecting, any response.
+// If ack is set, the response gives the outcome of all the writes since the last acknowledgement.
+func (f *File) writeBatched(ctx context.Context, ch chan result, b []byte, off int64, ack bool) error {
+	p := &sshFxpWriteBatchPacket{
+		ID:     f.c.nextID(),
+		Handle: f.handle,
+		Offset: uint64(off),
+		Data:   b,
+	}
+
+	if !ack {
+		// No response is awaited, so the write takes no slot among the requests in flight,
+		// but it is still held to the rate limits, as any other write.
+		if err := f.c.rateLimits.wait(ctx, p); err != nil {
+			return err
+		}
+		f.c.stats.sent(p)
+		if err := f.c.clientConn.conn.sendPacket(p); err != nil {
+			return err
+		}
+		f.advance(len(b))
+		return nil
+	}
+
+	p.Flags = writeBatchAck
+	typ, data, err := f.c.sendPacket(ctx, ch, p)
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case sshFxpStatus:
+		if err := f.c.statusError(p.ID, data); err != nil {
+			return err
+		}
+		f.advance(len(b))
+		return nil
+	default:
+		return unimplementedPacketErr(typ)
+	}
+}